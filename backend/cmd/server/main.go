@@ -3,18 +3,29 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
+	// Embedded zone data, so chat timezones resolve in minimal containers
+	_ "time/tzdata"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
 
 	"vessel-backend/internal/api"
 	"vessel-backend/internal/database"
+	"vessel-backend/internal/models"
+	"vessel-backend/internal/rpc"
+	"vessel-backend/internal/secrets"
 )
 
 // Version is set at build time via -ldflags, or defaults to dev
@@ -27,26 +38,180 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+func getEnvIntOrDefault(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if i, err := strconv.Atoi(value); err == nil {
+			return i
+		}
+	}
+	return defaultValue
+}
+
+func getEnvDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+// defaultOllamaModelsDir is where Ollama keeps models unless OLLAMA_MODELS
+// says otherwise
+func defaultOllamaModelsDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ollama", "models")
+}
+
 func main() {
+	dbDefaults := database.DefaultOptions()
+
 	var (
-		port      = flag.String("port", getEnvOrDefault("PORT", "8080"), "Server port")
-		dbPath    = flag.String("db", getEnvOrDefault("DB_PATH", "./data/vessel.db"), "Database file path")
-		ollamaURL = flag.String("ollama-url", getEnvOrDefault("OLLAMA_URL", "http://localhost:11434"), "Ollama API URL")
+		port              = flag.String("port", getEnvOrDefault("PORT", "8080"), "Server port")
+		grpcPort          = flag.String("grpc-port", getEnvOrDefault("GRPC_PORT", ""), "gRPC server port (empty disables)")
+		socketPath        = flag.String("socket", getEnvOrDefault("SOCKET_PATH", ""), "Unix socket to serve the API on, in addition to the port (set -port to empty to serve only the socket)")
+		socketMode        = flag.String("socket-mode", getEnvOrDefault("SOCKET_MODE", "0660"), "File permissions of the unix socket")
+		dbPath            = flag.String("db", getEnvOrDefault("DB_PATH", "./data/vessel.db"), "Database file path")
+		authLocalhost     = flag.Bool("auth-allow-localhost", getEnvOrDefault("AUTH_ALLOW_LOCALHOST", "false") == "true", "Allow direct loopback clients without an API token (requests with forwarding headers, such as those proxied by the frontend server, still need one)")
+		ollamaURL         = flag.String("ollama-url", getEnvOrDefault("OLLAMA_URL", "http://localhost:11434"), "Ollama API URL")
+		ollamaModels      = flag.String("ollama-models-dir", getEnvOrDefault("OLLAMA_MODELS", defaultOllamaModelsDir()), "Ollama's models directory, read to verify model checksums")
+		defaultModel      = flag.String("default-model", getEnvOrDefault("OLLAMA_DEFAULT_MODEL", ""), "Default Ollama model for requests that don't specify one")
+		cacheTTL          = flag.Duration("completion-cache-ttl", getEnvDurationOrDefault("COMPLETION_CACHE_TTL", 24*time.Hour), "How long deterministic chat completions are cached (0 disables)")
+		registryDetails   = flag.Duration("registry-details-interval", getEnvDurationOrDefault("REGISTRY_DETAILS_INTERVAL", 10*time.Second), "Minimum time between background fetches of registry model details (0 disables)")
+		retentionInterval = flag.Duration("retention-interval", getEnvDurationOrDefault("RETENTION_INTERVAL", time.Hour), "Interval for applying retention policies (0 disables)")
+		uploadRetention   = flag.Duration("upload-retention", getEnvDurationOrDefault("UPLOAD_RETENTION", 7*24*time.Hour), "How long failed and cancelled RAG uploads keep their files so they can be resumed (0 keeps them)")
+		ragRecrawl        = flag.Duration("rag-recrawl-interval", getEnvDurationOrDefault("RAG_RECRAWL_INTERVAL", 24*time.Hour), "How often RAG documents ingested from URLs are re-crawled (0 disables)")
+		modelVerify       = flag.Duration("model-verify-interval", getEnvDurationOrDefault("MODEL_VERIFY_INTERVAL", 0), "How often installed models are re-verified against their checksums (0 disables)")
+		imageMaxDimension = flag.Int("image-max-dimension", getEnvIntOrDefault("IMAGE_MAX_DIMENSION", api.DefaultImageMaxDimension), "Longest side chat images are scaled down to before they reach the model (0 keeps their size)")
+		offline           = flag.Bool("offline", getEnvOrDefault("OFFLINE", "false") == "true", "Disable all requests to the internet (registry, web search, update checks)")
+		translationModel  = flag.String("translation-model", getEnvOrDefault("TRANSLATION_MODEL", ""), "Ollama model used to translate chats (empty uses the chat's model)")
+		codeInterpreter   = flag.String("code-interpreter", getEnvOrDefault("CODE_INTERPRETER", api.CodeInterpreterOff), "Sandbox for the code interpreter tool: off, container (docker or podman), auto (container when available) or subprocess (unisolated local process)")
+		codePythonImage   = flag.String("code-interpreter-python-image", getEnvOrDefault("CODE_INTERPRETER_PYTHON_IMAGE", api.DefaultCodePythonImage), "Container image Python snippets run in; it must include matplotlib for plots, since containers have no network")
+		warmModels        = flag.Int("warm-models", getEnvIntOrDefault("WARM_MODELS", 0), "How many recently used models are kept loaded in Ollama (0 lets Ollama unload them as usual)")
+		warmVRAMBudget    = flag.Int("warm-vram-budget-mb", getEnvIntOrDefault("WARM_VRAM_BUDGET_MB", 0), "VRAM in MiB the warm models may use together (0 is unlimited)")
+		warmIdleTimeout   = flag.Duration("warm-idle-timeout", getEnvDurationOrDefault("WARM_IDLE_TIMEOUT", 0), "Unload the warm models after this long without chats (0 keeps them loaded)")
+		jobWorkers        = flag.Int("job-workers", getEnvIntOrDefault("JOB_WORKERS", 1), "How many background jobs run at the same time")
+		vramPolicy        = flag.String("vram-policy", getEnvOrDefault("VRAM_POLICY", api.VRAMPolicyOff), "When a chat's model won't fit in the VRAM left: off, unload (other Ollama models) or reject (needs nvidia-smi on this machine or -vram-budget-mb)")
+		vramBudget        = flag.Int("vram-budget-mb", getEnvIntOrDefault("VRAM_BUDGET_MB", 0), "VRAM in MiB shared by Ollama and other programs on the GPU (0 uses the GPU's total)")
+		pullOnDemand      = flag.Bool("pull-on-demand", getEnvOrDefault("PULL_ON_DEMAND", "false") == "true", "Pull a chat's model when it isn't installed, holding the request until it is ready")
+		updateChannel     = flag.String("update-channel", getEnvOrDefault("UPDATE_CHANNEL", api.UpdateChannelStable), "Release channel checked for updates: stable, beta (includes pre-releases) or off")
+
+		// Content policy sidecar
+		hookURLs     = flag.String("chat-hook-url", getEnvOrDefault("CHAT_HOOK_URL", ""), "Comma-separated URLs of policy sidecars called before and after each chat")
+		hookTimeout  = flag.Duration("chat-hook-timeout", getEnvDurationOrDefault("CHAT_HOOK_TIMEOUT", 5*time.Second), "Timeout for each policy sidecar call")
+		hookFailOpen = flag.Bool("chat-hook-fail-open", getEnvOrDefault("CHAT_HOOK_FAIL_OPEN", "false") == "true", "Allow chats when a policy sidecar is unreachable")
+
+		// Chat middleware chain
+		chatMiddlewareFlag = flag.String("chat-middleware", getEnvOrDefault("CHAT_MIDDLEWARE", strings.Join(api.DefaultChatMiddleware, ",")), "Comma-separated chat middleware, in the order they run")
+
+		// Backend circuit breaker
+		circuitThreshold = flag.Int("backend-circuit-threshold", getEnvIntOrDefault("BACKEND_CIRCUIT_THRESHOLD", 5), "Consecutive backend failures before requests are stopped")
+		circuitCooldown  = flag.Duration("backend-circuit-cooldown", getEnvDurationOrDefault("BACKEND_CIRCUIT_COOLDOWN", 30*time.Second), "How long to stop sending requests to a failing backend before probing it")
+
+		// SQLite tuning
+		dbJournalMode  = flag.String("db-journal-mode", getEnvOrDefault("DB_JOURNAL_MODE", dbDefaults.JournalMode), "SQLite journal mode")
+		dbBusyTimeout  = flag.Int("db-busy-timeout", getEnvIntOrDefault("DB_BUSY_TIMEOUT_MS", int(dbDefaults.BusyTimeout.Milliseconds())), "SQLite busy timeout in milliseconds")
+		dbMmapSize     = flag.Int("db-mmap-size", getEnvIntOrDefault("DB_MMAP_SIZE", int(dbDefaults.MmapSize)), "SQLite mmap size in bytes (0 disables)")
+		dbMaxOpenConns = flag.Int("db-max-open-conns", getEnvIntOrDefault("DB_MAX_OPEN_CONNS", dbDefaults.MaxOpenConns), "Maximum open database connections")
+		dbMaintenance  = flag.Duration("db-maintenance-interval", getEnvDurationOrDefault("DB_MAINTENANCE_INTERVAL", 24*time.Hour), "Interval for scheduled database maintenance (0 disables)")
+		dbMaxIdleConns = flag.Int("db-max-idle-conns", getEnvIntOrDefault("DB_MAX_IDLE_CONNS", dbDefaults.MaxIdleConns), "Maximum idle database connections")
 	)
 	flag.Parse()
 
 	// Initialize database
-	db, err := database.OpenDatabase(*dbPath)
+	dbOptions := dbDefaults
+	dbOptions.JournalMode = *dbJournalMode
+	dbOptions.BusyTimeout = time.Duration(*dbBusyTimeout) * time.Millisecond
+	dbOptions.MmapSize = int64(*dbMmapSize)
+	dbOptions.MaxOpenConns = *dbMaxOpenConns
+	dbOptions.MaxIdleConns = *dbMaxIdleConns
+
+	db, err := database.OpenDatabase(*dbPath, dbOptions)
 	if err != nil {
 		log.Fatalf("Failed to open database: %v", err)
 	}
 	defer db.Close()
 
+	if mode, err := database.JournalMode(db); err == nil {
+		log.Printf("Database journal mode: %s", mode)
+	}
+
 	// Run migrations
 	if err := database.RunMigrations(db); err != nil {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
+	// Uploads don't survive a restart; don't leave them looking active
+	// (uploads can be resumed, and eval runs and bulk jobs resume on their
+	// own)
+	if err := models.FailInterruptedRAGUploads(db); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	// Secrets live in the OS keyring when available, else an encrypted file
+	// next to the database
+	secretStore := secrets.Open(filepath.Dir(*dbPath))
+	log.Printf("Secret store: %s", secretStore.Backend())
+
+	// Enable content encryption when a passphrase is configured. The
+	// passphrase comes from the environment or the secret store, never a
+	// flag, so it doesn't show up in the process list.
+	passphrase, _, err := secrets.Resolve(secretStore, "encryption_passphrase")
+	if err != nil {
+		log.Fatalf("Failed to read encryption passphrase: %v", err)
+	}
+	if err := models.SetupEncryption(db, passphrase); err != nil {
+		log.Fatalf("Failed to set up encryption: %v", err)
+	}
+
+	// API tokens enable authentication; without them the API stays open
+	apiToken, _, err := secrets.Resolve(secretStore, "api_token")
+	if err != nil {
+		log.Fatalf("Failed to read API token: %v", err)
+	}
+	adminToken, _, err := secrets.Resolve(secretStore, "admin_token")
+	if err != nil {
+		log.Fatalf("Failed to read admin token: %v", err)
+	}
+
+	// Policy sidecars run in the order given
+	var chatHooks []api.ChatHook
+	for i, hookURL := range strings.Split(*hookURLs, ",") {
+		if hookURL = strings.TrimSpace(hookURL); hookURL != "" {
+			chatHooks = append(chatHooks, api.NewHTTPHook(fmt.Sprintf("sidecar-%d", i+1), hookURL, *hookTimeout, *hookFailOpen))
+			log.Printf("Chat policy hook: %s", hookURL)
+		}
+	}
+
+	// Chat middleware runs in the order given
+	var chatMiddleware []string
+	for _, name := range strings.Split(*chatMiddlewareFlag, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			chatMiddleware = append(chatMiddleware, name)
+		}
+	}
+	if err := api.ValidateChatMiddleware(chatMiddleware); err != nil {
+		log.Fatalf("Invalid -chat-middleware: %v", err)
+	}
+	if !api.ValidCodeInterpreterMode(*codeInterpreter) {
+		log.Fatalf("Invalid -code-interpreter %q: expected off, subprocess, container or auto", *codeInterpreter)
+	}
+	if !api.ValidVRAMPolicy(*vramPolicy) {
+		log.Fatalf("Invalid -vram-policy %q: expected off, unload or reject", *vramPolicy)
+	}
+	if !api.ValidUpdateChannel(*updateChannel) {
+		log.Fatalf("Invalid -update-channel %q: expected stable, beta or off", *updateChannel)
+	}
+
+	// Schedule integrity checks and vacuuming for long-lived installs
+	maintenanceCtx, stopMaintenance := context.WithCancel(context.Background())
+	defer stopMaintenance()
+	database.StartMaintenance(maintenanceCtx, db, *dbMaintenance, api.InMaintenance)
+	api.StartRetention(maintenanceCtx, db, *retentionInterval)
+
 	// Setup Gin router
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
@@ -57,19 +222,92 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", "Accept-Language", api.TimezoneHeader, api.ExportPasswordHeader},
+		ExposeHeaders:    []string{"Content-Length", api.SettingsSnapshotHeader, api.GenerationIDHeader, api.CompletionCacheHeader, api.EarlierMessagesHeader, api.GenerationSeedHeader, api.ImageProcessingHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
 	// Register routes
-	api.SetupRoutes(r, db, *ollamaURL, Version)
+	api.SetupRoutes(r, db, api.Config{
+		OllamaURL:                  *ollamaURL,
+		DefaultModel:               *defaultModel,
+		Secrets:                    secretStore,
+		CompletionCacheTTL:         *cacheTTL,
+		ChatHooks:                  chatHooks,
+		ChatMiddleware:             chatMiddleware,
+		CircuitThreshold:           *circuitThreshold,
+		CircuitCooldown:            *circuitCooldown,
+		RegistryDetailsInterval:    *registryDetails,
+		RAGRecrawlInterval:         *ragRecrawl,
+		UploadDir:                  filepath.Join(filepath.Dir(*dbPath), "uploads"),
+		UploadRetention:            *uploadRetention,
+		Offline:                    *offline,
+		UpdateChannel:              *updateChannel,
+		OllamaModelsDir:            *ollamaModels,
+		ModelVerifyInterval:        *modelVerify,
+		ImageMaxDimension:          *imageMaxDimension,
+		TranslationModel:           *translationModel,
+		CodeInterpreter:            *codeInterpreter,
+		CodeInterpreterPythonImage: *codePythonImage,
+		WarmModels:                 *warmModels,
+		WarmVRAMBudgetMB:           *warmVRAMBudget,
+		WarmIdleTimeout:            *warmIdleTimeout,
+		PullOnDemand:               *pullOnDemand,
+		JobWorkers:                 *jobWorkers,
+		VRAMPolicy:                 *vramPolicy,
+		VRAMBudgetMB:               *vramBudget,
+		Auth: api.AuthConfig{
+			APIToken:       apiToken,
+			AdminToken:     adminToken,
+			AllowLocalhost: *authLocalhost,
+		},
+	}, Version)
+
+	if *port == "" && *socketPath == "" {
+		log.Fatalf("Nothing to serve on: set -port or -socket")
+	}
 
-	// Create server
-	srv := &http.Server{
-		Addr:    ":" + *port,
-		Handler: r,
+	// Create servers
+	var srv, socketSrv *http.Server
+	if *port != "" {
+		srv = &http.Server{
+			Addr:    ":" + *port,
+			Handler: r,
+		}
+	}
+	if *socketPath != "" {
+		mode, err := strconv.ParseUint(*socketMode, 8, 32)
+		if err != nil {
+			log.Fatalf("Invalid socket mode %q: %v", *socketMode, err)
+		}
+		lis, err := api.ListenUnix(*socketPath, os.FileMode(mode))
+		if err != nil {
+			log.Fatalf("Failed to listen on unix socket: %v", err)
+		}
+		socketSrv = &http.Server{Handler: api.UnixSocketHandler(r)}
+		go func() {
+			log.Printf("Server listening on unix socket %s (mode %s)", *socketPath, *socketMode)
+			if err := socketSrv.Serve(lis); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to serve unix socket: %v", err)
+			}
+		}()
+	}
+
+	// The gRPC server answers its calls through the REST handler
+	var grpcSrv *grpc.Server
+	if *grpcPort != "" {
+		lis, err := net.Listen("tcp", ":"+*grpcPort)
+		if err != nil {
+			log.Fatalf("Failed to listen on gRPC port: %v", err)
+		}
+		grpcSrv = rpc.NewServer(r)
+		go func() {
+			log.Printf("gRPC server starting on port %s", *grpcPort)
+			if err := grpcSrv.Serve(lis); err != nil {
+				log.Printf("gRPC server stopped: %v", err)
+			}
+		}()
 	}
 
 	// Initialize fetcher and log the method being used
@@ -78,9 +316,20 @@ func main() {
 
 	// Graceful shutdown handling
 	go func() {
-		log.Printf("Server starting on port %s", *port)
+		if srv != nil {
+			log.Printf("Server starting on port %s", *port)
+		}
 		log.Printf("Ollama URL: %s (using official Go client)", *ollamaURL)
 		log.Printf("Database: %s", *dbPath)
+		if *offline {
+			log.Printf("Offline mode: external network access is disabled")
+		}
+		if apiToken != "" || adminToken != "" {
+			log.Printf("API token authentication enabled (localhost bypass: %v)", *authLocalhost)
+		}
+		if srv == nil {
+			return
+		}
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Failed to start server: %v", err)
 		}
@@ -95,8 +344,29 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+	if grpcSrv != nil {
+		// Let open calls finish, but cut long streams at the deadline
+		stopped := make(chan struct{})
+		go func() {
+			grpcSrv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcSrv.Stop()
+		}
+	}
+	if socketSrv != nil {
+		// Shutdown closes the listener, which removes the socket file
+		if err := socketSrv.Shutdown(ctx); err != nil {
+			log.Printf("Unix socket server forced to shutdown: %v", err)
+		}
+	}
+	if srv != nil {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Fatalf("Server forced to shutdown: %v", err)
+		}
 	}
 
 	log.Println("Server exited")
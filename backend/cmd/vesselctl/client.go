@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// client calls the vessel REST API
+type client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// newClient creates a client for the server at baseURL. The token, if set,
+// is sent as an API key with every request.
+func newClient(baseURL, token string) *client {
+	return &client{
+		baseURL: strings.TrimRight(baseURL, "/") + "/api/v1",
+		token:   token,
+		http:    &http.Client{},
+	}
+}
+
+// do sends a request with an optional JSON body and returns the response if
+// its status is 2xx. Error responses are turned into errors using their
+// "error" field.
+func (c *client) do(method, path string, body any) (*http.Response, error) {
+	return c.doWithHeader(method, path, body, nil)
+}
+
+// doWithHeader is do with extra request headers
+func (c *client) doWithHeader(method, path string, body any, header http.Header) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("X-API-Key", c.token)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return nil, fmt.Errorf("%s %s: %s (HTTP %d)", method, path, apiErr.Error, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("%s %s: HTTP %d", method, path, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// getJSON decodes the response of a request into out
+func (c *client) getJSON(method, path string, body, out any) error {
+	resp, err := c.do(method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// stream sends a request answered with NDJSON and calls fn with each line.
+// A line carrying an "error" field ends the stream with that error.
+func (c *client) stream(method, path string, body any, fn func(line []byte) error) error {
+	resp, err := c.do(method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var event struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(line, &event) == nil && event.Error != "" {
+			return fmt.Errorf("%s", event.Error)
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,358 @@
+// Command vesselctl is a command-line client for the vessel backend, for
+// headless servers and scripts. It talks to the same REST API as the web UI.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/encryption"
+)
+
+const usage = `Usage: vesselctl [-url URL] [-token TOKEN] <command> [arguments]
+
+Commands:
+  chat [-model NAME] [-system PROMPT] [PROMPT]  stream a reply (prompt read from stdin if omitted)
+  models list                                   list local models
+  models pull NAME                              download a model, showing progress
+  backends list                                 show backend status
+  backends validate [URL]                       check a backend URL (default: the configured one)
+  backends unload MODEL                         free a loaded model's memory
+  collections list                              list RAG collections
+  collections export ID [-o FILE] [-password PW] download a collection archive
+  chats export [-o FILE] [-password PW] [ID...]  download chats (all unarchived ones if no IDs)
+  decrypt FILE [-o FILE] [-password PW]         decrypt a password-protected export
+
+The server URL and API token default to $VESSEL_URL and $VESSEL_API_TOKEN.
+Export passwords default to $VESSEL_EXPORT_PASSWORD; exports made with a
+password are encrypted archives (.venc) that only decrypt with it.
+`
+
+func getEnvOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	serverURL := flag.String("url", getEnvOrDefault("VESSEL_URL", "http://localhost:8080"), "vessel server URL")
+	token := flag.String("token", os.Getenv("VESSEL_API_TOKEN"), "API token")
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c := newClient(*serverURL, *token)
+	var err error
+	switch args[0] {
+	case "chat":
+		err = runChat(c, args[1:])
+	case "models":
+		err = runModels(c, args[1:])
+	case "backends":
+		err = runBackends(c, args[1:])
+	case "collections":
+		err = runCollections(c, args[1:])
+	case "chats":
+		err = runChats(c, args[1:])
+	case "decrypt":
+		err = runDecrypt(args[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "vesselctl:", err)
+		os.Exit(1)
+	}
+}
+
+// subcommand returns the subcommand name and its arguments, or an error
+// naming the valid ones
+func subcommand(group string, args []string, valid ...string) (string, []string, error) {
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("%s: expected one of: %s", group, strings.Join(valid, ", "))
+	}
+	for _, v := range valid {
+		if args[0] == v {
+			return args[0], args[1:], nil
+		}
+	}
+	return "", nil, fmt.Errorf("%s: unknown command %q (expected one of: %s)", group, args[0], strings.Join(valid, ", "))
+}
+
+// runChat streams a single-turn chat to the terminal
+func runChat(c *client, args []string) error {
+	fs := flag.NewFlagSet("chat", flag.ExitOnError)
+	model := fs.String("model", "", "model to chat with (default: the server's default model)")
+	system := fs.String("system", "", "system prompt")
+	fs.Parse(args)
+
+	prompt := strings.Join(fs.Args(), " ")
+	if prompt == "" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		prompt = strings.TrimSpace(string(data))
+	}
+	if prompt == "" {
+		return fmt.Errorf("chat: prompt is required")
+	}
+
+	var messages []api.Message
+	if *system != "" {
+		messages = append(messages, api.Message{Role: "system", Content: *system})
+	}
+	messages = append(messages, api.Message{Role: "user", Content: prompt})
+	req := api.ChatRequest{Model: *model, Messages: messages}
+
+	err := c.stream(http.MethodPost, "/ollama/api/chat", req, func(line []byte) error {
+		var resp api.ChatResponse
+		if err := json.Unmarshal(line, &resp); err != nil {
+			return nil
+		}
+		fmt.Print(resp.Message.Content)
+		return nil
+	})
+	fmt.Println()
+	return err
+}
+
+// runModels lists or downloads models
+func runModels(c *client, args []string) error {
+	cmd, args, err := subcommand("models", args, "list", "pull")
+	if err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "list":
+		var resp api.ListResponse
+		if err := c.getJSON(http.MethodGet, "/ollama/api/tags", nil, &resp); err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSIZE\tMODIFIED")
+		for _, m := range resp.Models {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", m.Name, formatBytes(m.Size), m.ModifiedAt.Format("2006-01-02 15:04"))
+		}
+		return w.Flush()
+
+	default:
+		if len(args) != 1 {
+			return fmt.Errorf("models pull: expected a model name")
+		}
+		last := ""
+		err := c.stream(http.MethodPost, "/ollama/api/pull", api.PullRequest{Model: args[0]}, func(line []byte) error {
+			var p api.ProgressResponse
+			if err := json.Unmarshal(line, &p); err != nil {
+				return nil
+			}
+			status := p.Status
+			if p.Total > 0 {
+				status = fmt.Sprintf("%s %s/%s (%d%%)", p.Status, formatBytes(p.Completed), formatBytes(p.Total), p.Completed*100/p.Total)
+			}
+			if status != last {
+				fmt.Fprintf(os.Stderr, "\r\033[K%s", status)
+				last = status
+			}
+			return nil
+		})
+		fmt.Fprintln(os.Stderr)
+		return err
+	}
+}
+
+// runBackends shows, validates or controls backends
+func runBackends(c *client, args []string) error {
+	cmd, args, err := subcommand("backends", args, "list", "validate", "unload")
+	if err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "list":
+		return printJSON(c, http.MethodGet, "/backends", nil)
+
+	case "validate":
+		body := map[string]string{}
+		if len(args) > 0 {
+			body["url"] = args[0]
+		}
+		return printJSON(c, http.MethodPost, "/backends/ollama/validate", body)
+
+	default:
+		if len(args) != 1 {
+			return fmt.Errorf("backends unload: expected a model name")
+		}
+		return printJSON(c, http.MethodPost, "/backends/ollama/models/"+args[0]+"/unload", nil)
+	}
+}
+
+// runCollections lists or exports RAG collections
+func runCollections(c *client, args []string) error {
+	cmd, args, err := subcommand("collections", args, "list", "export")
+	if err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "list":
+		return printJSON(c, http.MethodGet, "/rag/collections", nil)
+
+	default:
+		if len(args) == 0 {
+			return fmt.Errorf("collections export: expected a collection ID")
+		}
+		id := args[0]
+		fs := flag.NewFlagSet("collections export", flag.ExitOnError)
+		output := fs.String("o", "", "file to write the archive to (- for stdout; default: ID.zip, or ID.zip.venc with a password)")
+		password := fs.String("password", os.Getenv("VESSEL_EXPORT_PASSWORD"), "encrypt the archive with this password")
+		fs.Parse(args[1:])
+
+		if *output == "" {
+			*output = id + ".zip"
+			if *password != "" {
+				*output += encryption.ArchiveExtension
+			}
+		}
+		resp, err := c.doWithHeader(http.MethodGet, "/rag/collections/"+url.PathEscape(id)+"/export", nil, exportHeader(*password))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		return writeOutput(*output, resp.Body)
+	}
+}
+
+// runChats exports chats
+func runChats(c *client, args []string) error {
+	_, args, err := subcommand("chats", args, "export")
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("chats export", flag.ExitOnError)
+	output := fs.String("o", "", "file to write the chats to (- for stdout; default: chats.json, or chats.json.venc with a password)")
+	password := fs.String("password", os.Getenv("VESSEL_EXPORT_PASSWORD"), "encrypt the export with this password")
+	fs.Parse(args)
+
+	if *output == "" {
+		*output = "chats.json"
+		if *password != "" {
+			*output += encryption.ArchiveExtension
+		}
+	}
+	body := map[string]any{"chat_ids": fs.Args()}
+	resp, err := c.doWithHeader(http.MethodPost, "/chats/export", body, exportHeader(*password))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return writeOutput(*output, resp.Body)
+}
+
+// runDecrypt decrypts a password-protected export locally
+func runDecrypt(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("decrypt: expected a file")
+	}
+	input := args[0]
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	output := fs.String("o", strings.TrimSuffix(input, encryption.ArchiveExtension), "file to write the decrypted content to (- for stdout)")
+	password := fs.String("password", os.Getenv("VESSEL_EXPORT_PASSWORD"), "the export's password")
+	fs.Parse(args[1:])
+
+	if *password == "" {
+		return fmt.Errorf("decrypt: a password is required (-password or $VESSEL_EXPORT_PASSWORD)")
+	}
+	if *output == input {
+		return fmt.Errorf("decrypt: -o is required when the file doesn't end in %s", encryption.ArchiveExtension)
+	}
+	f, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	reader, err := encryption.NewArchiveReader(f, *password)
+	if err != nil {
+		return err
+	}
+	if err := writeOutput(*output, reader); err != nil {
+		// Don't leave a partial file that looks decrypted
+		if *output != "-" {
+			os.Remove(*output)
+		}
+		return err
+	}
+	return nil
+}
+
+// exportHeader returns the request headers of an export made with password
+func exportHeader(password string) http.Header {
+	if password == "" {
+		return nil
+	}
+	return http.Header{"X-Export-Password": {password}}
+}
+
+// writeOutput copies r to the file output, or to stdout when it is "-"
+func writeOutput(output string, r io.Reader) error {
+	if output == "-" {
+		_, err := io.Copy(os.Stdout, r)
+		return err
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "wrote %s (%s)\n", output, formatBytes(n))
+	return nil
+}
+
+// printJSON prints the response of a request as indented JSON
+func printJSON(c *client, method, path string, body any) error {
+	var out any
+	if err := c.getJSON(method, path, body, &out); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// formatBytes formats a size for people
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
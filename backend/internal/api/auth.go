@@ -0,0 +1,249 @@
+package api
+
+import (
+	"crypto/subtle"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuthScope distinguishes the two route classes that can be protected
+type AuthScope int
+
+const (
+	// ScopeInference covers chat, models and everyday API use
+	ScopeInference AuthScope = iota
+	// ScopeControl covers administrative routes (database, secrets, model
+	// management, backend control)
+	ScopeControl
+)
+
+// AuthIdentityKey is the gin context key holding which credential a request
+// used: "admin", "api", "localhost", or "anonymous" when auth is disabled
+const AuthIdentityKey = "auth_identity"
+
+// Failure throttling for token checks
+const (
+	authFailureWindow = time.Minute
+	// authMaxFailures is how many bad tokens a client may send per window
+	// before further attempts are rejected outright
+	authMaxFailures = 10
+)
+
+// AuthConfig configures API token authentication. Authentication is
+// disabled when neither token is set.
+type AuthConfig struct {
+	// APIToken grants access to inference routes
+	APIToken string
+	// AdminToken grants access to everything; when unset, APIToken also
+	// covers control routes
+	AdminToken string
+	// AllowLocalhost lets loopback clients through without a token. Requests
+	// carrying forwarding headers still need one, since a reverse proxy on
+	// the same host (such as the frontend server) connects from loopback on
+	// behalf of remote clients.
+	AllowLocalhost bool
+}
+
+// Authenticator enforces token auth and throttles failed attempts per client
+type Authenticator struct {
+	cfg AuthConfig
+
+	mu       sync.Mutex
+	failures map[string]*authFailures
+}
+
+// authFailures tracks failed attempts from one client IP
+type authFailures struct {
+	windowStart time.Time
+	count       int
+	lastLogged  time.Time
+	suppressed  int
+}
+
+// NewAuthenticator creates an authenticator for the given configuration
+func NewAuthenticator(cfg AuthConfig) *Authenticator {
+	return &Authenticator{
+		cfg:      cfg,
+		failures: make(map[string]*authFailures),
+	}
+}
+
+// Enabled reports whether any token is configured
+func (a *Authenticator) Enabled() bool {
+	return a.cfg.APIToken != "" || a.cfg.AdminToken != ""
+}
+
+// Require returns middleware that rejects requests lacking a token valid for scope
+func (a *Authenticator) Require(scope AuthScope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.Enabled() || c.Request.Method == http.MethodOptions {
+			c.Set(AuthIdentityKey, "anonymous")
+			c.Next()
+			return
+		}
+
+		// RemoteIP is the connection's peer, which is loopback for anything a
+		// local proxy forwards, so forwarded requests don't get the bypass
+		if a.cfg.AllowLocalhost && isLoopback(c.RemoteIP()) && !isForwarded(c.Request) {
+			c.Set(AuthIdentityKey, "localhost")
+			c.Next()
+			return
+		}
+
+		ip := c.RemoteIP()
+		if a.throttled(ip) {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "too many failed authentication attempts"})
+			return
+		}
+
+		token := requestToken(c.Request)
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			return
+		}
+
+		// Compare against every configured token so timing doesn't reveal
+		// which one matched
+		isAdmin := tokensEqual(token, a.cfg.AdminToken)
+		isAPI := tokensEqual(token, a.cfg.APIToken)
+
+		if !isAdmin && !isAPI {
+			a.recordFailure(ip, c.Request.URL.Path)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			return
+		}
+
+		// A valid API token on a control route is forbidden, not a failed
+		// login, so it doesn't count towards throttling
+		if scope == ScopeControl && a.cfg.AdminToken != "" && !isAdmin {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin token required"})
+			return
+		}
+
+		if isAdmin {
+			c.Set(AuthIdentityKey, "admin")
+		} else {
+			c.Set(AuthIdentityKey, "api")
+		}
+		c.Next()
+	}
+}
+
+// authIdentity returns the credential a request authenticated with
+func authIdentity(c *gin.Context) string {
+	if identity := c.GetString(AuthIdentityKey); identity != "" {
+		return identity
+	}
+	return "anonymous"
+}
+
+// tokensEqual compares tokens in constant time; an unset token never matches
+func tokensEqual(given, expected string) bool {
+	if expected == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
+
+// throttled reports whether a client has exceeded the failure limit
+func (a *Authenticator) throttled(ip string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	f, ok := a.failures[ip]
+	if !ok {
+		return false
+	}
+	if time.Since(f.windowStart) > authFailureWindow {
+		delete(a.failures, ip)
+		return false
+	}
+	return f.count >= authMaxFailures
+}
+
+// recordFailure counts a failed attempt and logs it, at most once per window
+// per client so a brute force attempt can't flood the log
+func (a *Authenticator) recordFailure(ip, path string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+
+	// Drop expired entries so scanning clients can't grow the map forever
+	if len(a.failures) > 1000 {
+		for k, v := range a.failures {
+			if now.Sub(v.windowStart) > authFailureWindow {
+				delete(a.failures, k)
+			}
+		}
+	}
+
+	f, ok := a.failures[ip]
+	if !ok || now.Sub(f.windowStart) > authFailureWindow {
+		f = &authFailures{windowStart: now}
+		a.failures[ip] = f
+	}
+	f.count++
+
+	if now.Sub(f.lastLogged) < authFailureWindow {
+		f.suppressed++
+		return
+	}
+
+	if f.suppressed > 0 {
+		log.Printf("[Auth] Invalid token from %s for %s (%d more failures suppressed)", ip, path, f.suppressed)
+	} else {
+		log.Printf("[Auth] Invalid token from %s for %s", ip, path)
+	}
+	f.lastLogged = now
+	f.suppressed = 0
+}
+
+// requestToken extracts a token from the Authorization or X-API-Key header
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// isLoopback reports whether ip is a loopback address
+func isLoopback(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && parsed.IsLoopback()
+}
+
+// isForwarded reports whether a request passed through a proxy that names
+// the original client
+func isForwarded(r *http.Request) bool {
+	return r.Header.Get("Forwarded") != "" || r.Header.Get("X-Forwarded-For") != "" || r.Header.Get("X-Real-IP") != ""
+}
+
+// ollamaControlPaths are Ollama API paths that modify installed models
+var ollamaControlPaths = map[string]bool{
+	"/api/pull":   true,
+	"/api/push":   true,
+	"/api/create": true,
+	"/api/delete": true,
+	"/api/copy":   true,
+}
+
+// requireControlForOllamaWrites applies the control check to raw proxy
+// requests that manage models, so the proxy can't bypass route scopes
+func requireControlForOllamaWrites(control gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ollamaControlPaths[strings.TrimSuffix(c.Param("path"), "/")] {
+			control(c)
+			return
+		}
+		c.Next()
+	}
+}
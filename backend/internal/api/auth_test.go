@@ -0,0 +1,132 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authTestRouter serves an inference and a control route that echo the
+// request's auth identity
+func authTestRouter(cfg AuthConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	a := NewAuthenticator(cfg)
+	r := gin.New()
+	identity := func(c *gin.Context) { c.String(http.StatusOK, authIdentity(c)) }
+	r.GET("/chat", a.Require(ScopeInference), identity)
+	r.GET("/admin", a.Require(ScopeControl), identity)
+	return r
+}
+
+func TestAuthTokens(t *testing.T) {
+	r := authTestRouter(AuthConfig{APIToken: "api-token", AdminToken: "admin-token"})
+
+	tests := []struct {
+		name, path string
+		header     string
+		value      string
+		want       int
+		identity   string
+	}{
+		{name: "no token", path: "/chat", want: http.StatusUnauthorized},
+		{name: "wrong token", path: "/chat", header: "Authorization", value: "Bearer nope", want: http.StatusUnauthorized},
+		{name: "token prefix", path: "/chat", header: "Authorization", value: "Bearer api-toke", want: http.StatusUnauthorized},
+		{name: "api token", path: "/chat", header: "Authorization", value: "Bearer api-token", want: http.StatusOK, identity: "api"},
+		{name: "api key header", path: "/chat", header: "X-API-Key", value: "api-token", want: http.StatusOK, identity: "api"},
+		{name: "admin token on inference", path: "/chat", header: "Authorization", value: "Bearer admin-token", want: http.StatusOK, identity: "admin"},
+		{name: "api token on control", path: "/admin", header: "Authorization", value: "Bearer api-token", want: http.StatusForbidden},
+		{name: "admin token on control", path: "/admin", header: "X-API-Key", value: "admin-token", want: http.StatusOK, identity: "admin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("GET %s = %d, want %d", tt.path, w.Code, tt.want)
+			}
+			if tt.identity != "" && w.Body.String() != tt.identity {
+				t.Errorf("identity = %q, want %q", w.Body.String(), tt.identity)
+			}
+		})
+	}
+
+	// Without an admin token the API token covers control routes
+	r = authTestRouter(AuthConfig{APIToken: "api-token"})
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.Header.Set("Authorization", "Bearer api-token")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /admin with the API token and no admin token = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestAuthThrottlesFailedAttempts(t *testing.T) {
+	r := authTestRouter(AuthConfig{APIToken: "api-token"})
+	get := func(remote, token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/chat", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for i := range authMaxFailures {
+		if code := get("192.0.2.1:1000", "wrong"); code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d = %d, want %d", i+1, code, http.StatusUnauthorized)
+		}
+	}
+	if code := get("192.0.2.1:1000", "wrong"); code != http.StatusTooManyRequests {
+		t.Errorf("attempt after the limit = %d, want %d", code, http.StatusTooManyRequests)
+	}
+	// Throttled clients are refused even with the right token
+	if code := get("192.0.2.1:1001", "api-token"); code != http.StatusTooManyRequests {
+		t.Errorf("valid token from a throttled client = %d, want %d", code, http.StatusTooManyRequests)
+	}
+	if code := get("192.0.2.2:1000", "api-token"); code != http.StatusOK {
+		t.Errorf("valid token from another client = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestAuthLoopbackBypass(t *testing.T) {
+	tests := []struct {
+		name   string
+		allow  bool
+		remote string
+		header string
+		want   int
+	}{
+		{name: "loopback", allow: true, remote: "127.0.0.1:5000", want: http.StatusOK},
+		{name: "ipv6 loopback", allow: true, remote: "[::1]:5000", want: http.StatusOK},
+		{name: "bypass disabled", allow: false, remote: "127.0.0.1:5000", want: http.StatusUnauthorized},
+		{name: "remote client", allow: true, remote: "192.0.2.1:5000", want: http.StatusUnauthorized},
+		{name: "proxied with X-Forwarded-For", allow: true, remote: "127.0.0.1:5000", header: "X-Forwarded-For", want: http.StatusUnauthorized},
+		{name: "proxied with Forwarded", allow: true, remote: "127.0.0.1:5000", header: "Forwarded", want: http.StatusUnauthorized},
+		{name: "proxied with X-Real-IP", allow: true, remote: "127.0.0.1:5000", header: "X-Real-IP", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := authTestRouter(AuthConfig{APIToken: "api-token", AllowLocalhost: tt.allow})
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			req.RemoteAddr = tt.remote
+			if tt.header != "" {
+				req.Header.Set(tt.header, "203.0.113.9")
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("GET /admin from %s = %d, want %d", tt.remote, w.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && w.Body.String() != "localhost" {
+				t.Errorf("identity = %q, want localhost", w.Body.String())
+			}
+		})
+	}
+}
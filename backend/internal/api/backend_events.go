@@ -0,0 +1,281 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Backend event stream timing and buffering
+const (
+	// backendEventsPollInterval is how often the backend is probed for
+	// changes while anyone follows its events
+	backendEventsPollInterval = 2 * time.Second
+	// backendEventsKeepAlive is how often an idle stream sends a comment,
+	// so proxies don't close it
+	backendEventsKeepAlive = 30 * time.Second
+	// maxBackendEvents is how many recent events are kept for clients
+	// reconnecting with Last-Event-ID
+	maxBackendEvents = 100
+	// backendEventBuffer is how many events a slow subscriber may fall
+	// behind before it is disconnected
+	backendEventBuffer = 64
+)
+
+// Backend event types
+const (
+	// BackendEventStatus is the backend's full status, sent first on every
+	// stream so clients start from a known state
+	BackendEventStatus = "status"
+	// BackendEventHealth reports the backend becoming available or not
+	BackendEventHealth = "health"
+	// BackendEventCircuit reports a circuit breaker state change
+	BackendEventCircuit = "circuit"
+	// BackendEventModelLoaded and BackendEventModelUnloaded report models
+	// entering and leaving memory
+	BackendEventModelLoaded   = "model_loaded"
+	BackendEventModelUnloaded = "model_unloaded"
+	// BackendEventPullStarted, BackendEventPullCompleted and
+	// BackendEventPullFailed follow model downloads
+	BackendEventPullStarted   = "pull_started"
+	BackendEventPullCompleted = "pull_completed"
+	BackendEventPullFailed    = "pull_failed"
+	// BackendEventQueue reports a change in the work waiting on the backend
+	BackendEventQueue = "queue"
+)
+
+// BackendEvent is a change in the backend's state. Seq numbers the events
+// of the process from 1 and is sent as the SSE event ID.
+type BackendEvent struct {
+	Seq   int64     `json:"seq"`
+	Type  string    `json:"type"`
+	At    time.Time `json:"at"`
+	Model string    `json:"model,omitempty"`
+	// Available is set on health events
+	Available *bool `json:"available,omitempty"`
+	// From and To are set on circuit events
+	From   CircuitState `json:"from,omitempty"`
+	To     CircuitState `json:"to,omitempty"`
+	Reason string       `json:"reason,omitempty"`
+	Error  string       `json:"error,omitempty"`
+	// SizeVRAM is set on model_loaded events
+	SizeVRAM int64 `json:"size_vram,omitempty"`
+	// Generations and Jobs are set on queue events: the chat generations
+	// in progress and the bulk jobs queued or running
+	Generations *int `json:"generations,omitempty"`
+	Jobs        *int `json:"jobs,omitempty"`
+	// Status is set on status events
+	Status *BackendStatus `json:"status,omitempty"`
+}
+
+// backendEventHub fans backend events out to the clients following them
+type backendEventHub struct {
+	mu          sync.Mutex
+	seq         int64
+	recent      []BackendEvent
+	subscribers map[chan BackendEvent]struct{}
+}
+
+// newBackendEventHub creates a hub without subscribers
+func newBackendEventHub() *backendEventHub {
+	return &backendEventHub{subscribers: make(map[chan BackendEvent]struct{})}
+}
+
+// publish numbers an event and passes it to every subscriber. A subscriber
+// that has fallen too far behind is dropped; its stream ends and the client
+// reconnects with Last-Event-ID.
+func (h *backendEventHub) publish(event BackendEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	event.Seq = h.seq
+	event.At = time.Now().UTC()
+	h.recent = append(h.recent, event)
+	if len(h.recent) > maxBackendEvents {
+		h.recent = h.recent[len(h.recent)-maxBackendEvents:]
+	}
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe follows the events after seq afterSeq; the recent ones are
+// queued first
+func (h *backendEventHub) subscribe(afterSeq int64) chan BackendEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch := make(chan BackendEvent, backendEventBuffer+maxBackendEvents)
+	for _, event := range h.recent {
+		if event.Seq > afterSeq {
+			ch <- event
+		}
+	}
+	h.subscribers[ch] = struct{}{}
+	return ch
+}
+
+// unsubscribe stops following events
+func (h *backendEventHub) unsubscribe(ch chan BackendEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[ch]; ok {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// watched reports whether anyone follows the events
+func (h *backendEventHub) watched() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers) > 0
+}
+
+// backendWatch is what the last probe saw
+type backendWatch struct {
+	available   bool
+	loaded      map[string]int64
+	generations int
+	jobs        int
+}
+
+// StartBackendEvents probes the backend every backendEventsPollInterval
+// while anyone follows its events, publishing the changes it finds, until
+// ctx is cancelled. Circuit and pull events are published as they happen.
+func (s *OllamaService) StartBackendEvents(ctx context.Context) {
+	s.breaker.OnTransition(func(event CircuitEvent) {
+		s.events.publish(BackendEvent{Type: BackendEventCircuit, From: event.From, To: event.To, Reason: event.Reason})
+	})
+
+	go func() {
+		ticker := time.NewTicker(backendEventsPollInterval)
+		defer ticker.Stop()
+
+		var last *backendWatch
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if !s.events.watched() {
+				// Start over once someone follows again: the status event
+				// they get first covers what changed in between
+				last = nil
+				continue
+			}
+			last = s.publishBackendChanges(ctx, last)
+		}
+	}()
+}
+
+// publishBackendChanges probes the backend and publishes how it differs
+// from the last probe, returning what this one saw
+func (s *OllamaService) publishBackendChanges(ctx context.Context, last *backendWatch) *backendWatch {
+	status := s.backendStatus(ctx)
+	if status.Stale {
+		return last
+	}
+	current := &backendWatch{
+		available:   status.Available,
+		loaded:      make(map[string]int64, len(status.LoadedModels)),
+		generations: s.generations.active(),
+	}
+	for _, m := range status.LoadedModels {
+		current.loaded[m.Name] = m.SizeVRAM
+	}
+	s.jobs.mu.Lock()
+	current.jobs = len(s.jobs.jobs)
+	s.jobs.mu.Unlock()
+	if last == nil {
+		return current
+	}
+
+	if current.available != last.available {
+		available := current.available
+		s.events.publish(BackendEvent{Type: BackendEventHealth, Available: &available, Error: status.Error})
+	}
+	// Models can't be listed while the backend is down; keep the last list
+	if !current.available {
+		current.loaded = last.loaded
+	}
+	for name, size := range current.loaded {
+		if _, ok := last.loaded[name]; !ok {
+			s.events.publish(BackendEvent{Type: BackendEventModelLoaded, Model: name, SizeVRAM: size})
+		}
+	}
+	for name := range last.loaded {
+		if _, ok := current.loaded[name]; !ok {
+			s.events.publish(BackendEvent{Type: BackendEventModelUnloaded, Model: name})
+		}
+	}
+	if current.generations != last.generations || current.jobs != last.jobs {
+		generations, jobs := current.generations, current.jobs
+		s.events.publish(BackendEvent{Type: BackendEventQueue, Generations: &generations, Jobs: &jobs})
+	}
+	return current
+}
+
+// BackendEventsHandler streams the backend's state changes as server-sent
+// events named after their type, so clients can follow the backend instead
+// of polling its status. A status event comes first; clients reconnecting
+// with Last-Event-ID also get the recent events they missed.
+func (s *OllamaService) BackendEventsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		afterSeq, _ := strconv.ParseInt(c.GetHeader("Last-Event-ID"), 10, 64)
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+
+		flusher, ok := c.Writer.(http.Flusher)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "streaming not supported"})
+			return
+		}
+
+		ctx := c.Request.Context()
+		ch := s.events.subscribe(afterSeq)
+		defer s.events.unsubscribe(ch)
+
+		status := s.backendStatus(ctx)
+		data, _ := json.Marshal(BackendEvent{Type: BackendEventStatus, At: time.Now().UTC(), Status: &status})
+		if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", BackendEventStatus, data); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(backendEventsKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(c.Writer, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			case event, ok := <-ch:
+				if !ok {
+					return
+				}
+				data, _ := json.Marshal(event)
+				if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
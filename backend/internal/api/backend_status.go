@@ -0,0 +1,187 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// backendStatusTimeout bounds the live queries made for the backends listing.
+// A backend that doesn't answer in time is reported with its last result.
+const backendStatusTimeout = 1500 * time.Millisecond
+
+// BackendMetrics summarizes the most recent completion served by a backend
+type BackendMetrics struct {
+	// TokensPerSecond is the generation speed of the last completion
+	TokensPerSecond float64 `json:"tokens_per_second"`
+	// PromptTokensPerSecond is the prompt processing speed of the last completion
+	PromptTokensPerSecond float64   `json:"prompt_tokens_per_second"`
+	Model                 string    `json:"model"`
+	At                    time.Time `json:"at"`
+}
+
+// LoadedModel is a model currently resident in a backend
+type LoadedModel struct {
+	Name          string    `json:"name"`
+	Size          int64     `json:"size"`
+	SizeVRAM      int64     `json:"size_vram"`
+	ContextLength int       `json:"context_length,omitempty"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// BackendStatus is a backend's live state, shaped so different backend kinds
+// report comparable data
+type BackendStatus struct {
+	Available bool   `json:"available"`
+	Error     string `json:"error,omitempty"`
+	Version   string `json:"version,omitempty"`
+	// GPUMemoryUsed is the VRAM held by loaded models, in bytes
+	GPUMemoryUsed int64 `json:"gpu_memory_used"`
+	// ContextMax is the largest context length among loaded models
+	ContextMax     int             `json:"context_max,omitempty"`
+	LoadedModels   []LoadedModel   `json:"loaded_models"`
+	CurrentMetrics *BackendMetrics `json:"current_metrics,omitempty"`
+	// CheckedAt is when the backend last answered a status probe
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+	// Stale is set when the probe timed out and the last answered status is
+	// reported instead
+	Stale bool `json:"stale,omitempty"`
+}
+
+// backendStatusCache remembers the last status a backend answered with
+type backendStatusCache struct {
+	mu   sync.Mutex
+	last *BackendStatus
+}
+
+// store remembers an answered status
+func (c *backendStatusCache) store(status BackendStatus) {
+	c.mu.Lock()
+	c.last = &status
+	c.mu.Unlock()
+}
+
+// load returns the last answered status, or nil
+func (c *backendStatusCache) load() *BackendStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.last == nil {
+		return nil
+	}
+	last := *c.last
+	return &last
+}
+
+// backendMetrics remembers the speed of the last completion
+type backendMetrics struct {
+	mu   sync.Mutex
+	last *BackendMetrics
+}
+
+// observe records a completion's timings; completions without timings are ignored
+func (m *backendMetrics) observe(model string, metrics api.Metrics) {
+	if metrics.EvalDuration <= 0 {
+		return
+	}
+
+	snapshot := &BackendMetrics{
+		TokensPerSecond: float64(metrics.EvalCount) / metrics.EvalDuration.Seconds(),
+		Model:           model,
+		At:              time.Now().UTC(),
+	}
+	if metrics.PromptEvalDuration > 0 {
+		snapshot.PromptTokensPerSecond = float64(metrics.PromptEvalCount) / metrics.PromptEvalDuration.Seconds()
+	}
+
+	m.mu.Lock()
+	m.last = snapshot
+	m.mu.Unlock()
+}
+
+// current returns the last recorded metrics, or nil
+func (m *backendMetrics) current() *BackendMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.last == nil {
+		return nil
+	}
+	last := *m.last
+	return &last
+}
+
+// backendStatus queries Ollama for its version and loaded models, running
+// both probes at once. An open circuit is reported as unavailable without
+// contacting the backend until its cooldown ends, when the probe tests it;
+// a probe that times out reports the last answered status marked stale.
+func (s *OllamaService) backendStatus(ctx context.Context) BackendStatus {
+	status := BackendStatus{
+		LoadedModels:   []LoadedModel{},
+		CurrentMetrics: s.metrics.current(),
+	}
+	if retryAt := s.breaker.RetryAfter(); !retryAt.IsZero() && time.Now().Before(retryAt) {
+		status.Error = ErrCircuitOpen.Error()
+		if last := s.statusCache.load(); last != nil {
+			status.CheckedAt = last.CheckedAt
+		}
+		return status
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, backendStatusTimeout)
+	defer cancel()
+
+	var version string
+	var running *api.ProcessResponse
+	var versionErr, runningErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		version, versionErr = s.client.Version(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		running, runningErr = s.client.ListRunning(ctx)
+	}()
+	wg.Wait()
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		if last := s.statusCache.load(); last != nil {
+			last.CurrentMetrics = status.CurrentMetrics
+			last.Stale = true
+			last.Error = "status probe timed out"
+			return *last
+		}
+	}
+	if versionErr != nil {
+		status.Error = versionErr.Error()
+		return status
+	}
+	status.Available = true
+	status.Version = version
+
+	if runningErr != nil {
+		status.Error = "failed to list running models: " + runningErr.Error()
+		return status
+	}
+	for _, m := range running.Models {
+		status.LoadedModels = append(status.LoadedModels, LoadedModel{
+			Name:          m.Name,
+			Size:          m.Size,
+			SizeVRAM:      m.SizeVRAM,
+			ContextLength: m.ContextLength,
+			ExpiresAt:     m.ExpiresAt,
+		})
+		status.GPUMemoryUsed += m.SizeVRAM
+		if m.ContextLength > status.ContextMax {
+			status.ContextMax = m.ContextLength
+		}
+	}
+
+	checkedAt := time.Now().UTC()
+	status.CheckedAt = &checkedAt
+	s.statusCache.store(status)
+	return status
+}
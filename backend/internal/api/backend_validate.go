@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// backendValidateTimeout bounds the probe made when validating a backend
+const backendValidateTimeout = 5 * time.Second
+
+// BackendValidateRequest is the configuration of a backend to validate.
+// An empty URL validates the configured Ollama backend.
+type BackendValidateRequest struct {
+	URL   string `json:"url,omitempty"`
+	Token string `json:"token,omitempty"`
+}
+
+// BackendCheck is the outcome of one validation step
+type BackendCheck struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// BackendValidation reports whether a backend configuration works, with the
+// result of each step up to the first one that failed
+type BackendValidation struct {
+	URL     string         `json:"url"`
+	Valid   bool           `json:"valid"`
+	Version string         `json:"version,omitempty"`
+	Checks  []BackendCheck `json:"checks"`
+}
+
+// ValidateBackendHandler checks a backend configuration without changing
+// anything: the URL is well-formed, the server answers, the token (if any)
+// is accepted and the server speaks the Ollama API
+func (s *OllamaService) ValidateBackendHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req BackendValidateRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+				return
+			}
+		}
+		if req.URL == "" {
+			req.URL = s.ollamaURL
+		}
+
+		c.JSON(http.StatusOK, validateBackend(c.Request.Context(), req))
+	}
+}
+
+// validateBackend runs the validation steps in order, stopping at the first failure
+func validateBackend(ctx context.Context, req BackendValidateRequest) BackendValidation {
+	result := BackendValidation{URL: req.URL, Checks: []BackendCheck{}}
+	check := func(name string, err error) bool {
+		c := BackendCheck{Name: name, OK: err == nil}
+		if err != nil {
+			c.Message = err.Error()
+		}
+		result.Checks = append(result.Checks, c)
+		return c.OK
+	}
+
+	base, err := url.Parse(req.URL)
+	if err == nil && base.Scheme != unixScheme && (base.Scheme != "http" && base.Scheme != "https" || base.Host == "") {
+		err = fmt.Errorf("must be an absolute http or https URL, or a unix:// socket path")
+	}
+	var transport http.RoundTripper
+	if err == nil {
+		base, transport, err = backendEndpoint(req.URL)
+	}
+	if !check("url", err) {
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, backendValidateTimeout)
+	defer cancel()
+
+	probe, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(base.String(), "/")+"/api/version", nil)
+	if err != nil {
+		check("reachable", err)
+		return result
+	}
+	if req.Token != "" {
+		probe.Header.Set("Authorization", "Bearer "+req.Token)
+	}
+	resp, err := (&http.Client{Transport: transport}).Do(probe)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("no answer within %s", backendValidateTimeout)
+		}
+		check("reachable", err)
+		return result
+	}
+	defer resp.Body.Close()
+	check("reachable", nil)
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		if req.Token == "" {
+			err = fmt.Errorf("backend requires a token (HTTP %d)", resp.StatusCode)
+		} else {
+			err = fmt.Errorf("token rejected (HTTP %d)", resp.StatusCode)
+		}
+	}
+	if !check("auth", err) {
+		return result
+	}
+
+	var version struct {
+		Version string `json:"version"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("server does not look like Ollama: HTTP %d from /api/version", resp.StatusCode)
+	} else if body, readErr := io.ReadAll(io.LimitReader(resp.Body, 64*1024)); readErr != nil {
+		err = readErr
+	} else if json.Unmarshal(body, &version) != nil || version.Version == "" {
+		err = fmt.Errorf("server does not look like Ollama: no version in /api/version response")
+	}
+	if !check("api", err) {
+		return result
+	}
+
+	result.Valid = true
+	result.Version = version.Version
+	return result
+}
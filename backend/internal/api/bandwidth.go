@@ -0,0 +1,314 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/i18n"
+	"vessel-backend/internal/models"
+)
+
+// BandwidthCapErrorCode is the error code returned when a monthly download
+// cap is used up
+const BandwidthCapErrorCode = "BANDWIDTH_CAP"
+
+// pullFlushBytes is how many pulled bytes are buffered before they are
+// recorded and the caps are checked again
+const pullFlushBytes = 16 << 20
+
+// BandwidthCapError reports a monthly download cap that has been reached
+type BandwidthCapError struct {
+	// Source is the capped source, or empty for the overall cap
+	Source   string
+	Limit    int64
+	Used     int64
+	ResetsAt time.Time
+}
+
+func (e *BandwidthCapError) Error() string {
+	if e.Source == "" {
+		return "monthly download cap reached"
+	}
+	return "monthly download cap reached for " + e.Source
+}
+
+// bandwidthMonth returns the first and last day of t's month (UTC) and when
+// its caps reset
+func bandwidthMonth(t time.Time) (from, to string, resetsAt time.Time) {
+	t = t.UTC()
+	first := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	resetsAt = first.AddDate(0, 1, 0)
+	return models.UsageDay(first), models.UsageDay(resetsAt.AddDate(0, 0, -1)), resetsAt
+}
+
+// bandwidthMeter records bytes downloaded from external services and enforces
+// the monthly caps. Methods on a nil meter do nothing.
+type bandwidthMeter struct {
+	db *sql.DB
+}
+
+// newBandwidthMeter creates a meter storing usage in db
+func newBandwidthMeter(db *sql.DB) *bandwidthMeter {
+	return &bandwidthMeter{db: db}
+}
+
+// record adds downloaded bytes to today's usage for a source
+func (m *bandwidthMeter) record(source string, bytes int64) {
+	if m == nil || m.db == nil || bytes <= 0 {
+		return
+	}
+	if err := models.RecordBandwidth(m.db, models.UsageDay(time.Now()), source, bytes); err != nil {
+		log.Printf("[Bandwidth] %v", err)
+	}
+}
+
+// check returns a *BandwidthCapError if this month's downloads have reached
+// the overall cap or the source's cap. Accounting failures are logged and
+// don't block downloads.
+func (m *bandwidthMeter) check(source string) error {
+	if m == nil || m.db == nil {
+		return nil
+	}
+
+	caps, err := models.GetBandwidthCaps(m.db)
+	if err != nil {
+		log.Printf("[Bandwidth] %v", err)
+		return nil
+	}
+	from, to, resetsAt := bandwidthMonth(time.Now())
+
+	limits := []struct {
+		source string
+		limit  int64
+	}{
+		{"", caps.MonthlyBytes},
+		{source, caps.SourceMonthlyBytes[source]},
+	}
+	for _, l := range limits {
+		if l.limit <= 0 {
+			continue
+		}
+		used, err := models.GetBandwidthTotal(m.db, from, to, l.source)
+		if err != nil {
+			log.Printf("[Bandwidth] %v", err)
+			return nil
+		}
+		if used >= l.limit {
+			return &BandwidthCapError{Source: l.source, Limit: l.limit, Used: used, ResetsAt: resetsAt}
+		}
+	}
+	return nil
+}
+
+// Guard rejects requests that would download from source with 429 while a
+// monthly cap is used up
+func (m *bandwidthMeter) Guard(source string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := m.check(source); err != nil {
+			respondBandwidthCapExceeded(c, err.(*BandwidthCapError))
+			return
+		}
+		c.Next()
+	}
+}
+
+// respondBandwidthCapExceeded writes a 429 response saying when the cap resets
+func respondBandwidthCapExceeded(c *gin.Context, e *BandwidthCapError) {
+	c.Header("Retry-After", strconv.Itoa(int(time.Until(e.ResetsAt).Seconds())+1))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"error":      e.Error(),
+		"code":       BandwidthCapErrorCode,
+		"source":     e.Source,
+		"limit":      e.Limit,
+		"used":       e.Used,
+		"resets_at":  e.ResetsAt,
+		"suggestion": suggest(c, i18n.SuggestBandwidthCap),
+	})
+}
+
+// fetchedBytes returns how many bytes a fetch downloaded, including content
+// cut off by the length limit
+func fetchedBytes(result *FetchResult) int64 {
+	return int64(max(len(result.Content), result.OriginalSize))
+}
+
+// pullCounter turns Ollama pull progress into recorded bytes. Progress is
+// reported per layer as a running total, so only the growth since the last
+// update is counted.
+type pullCounter struct {
+	meter   *bandwidthMeter
+	mu      sync.Mutex
+	layers  map[string]int64
+	pending int64
+}
+
+// pullCounter starts counting a pull (or a group of pulls)
+func (m *bandwidthMeter) pullCounter() *pullCounter {
+	return &pullCounter{meter: m, layers: make(map[string]int64)}
+}
+
+// observe counts a progress update. Once enough bytes are buffered they are
+// recorded, and a *BandwidthCapError is returned if a cap has been reached so
+// the caller can stop the pull; Ollama keeps the partial layers, so pulling
+// again later continues where it stopped.
+func (p *pullCounter) observe(resp api.ProgressResponse) error {
+	if resp.Digest == "" {
+		return nil
+	}
+
+	p.mu.Lock()
+	last, seen := p.layers[resp.Digest]
+	p.layers[resp.Digest] = resp.Completed
+	// The first update of a resumed layer includes bytes downloaded before,
+	// so it only sets the baseline
+	if seen && resp.Completed > last {
+		p.pending += resp.Completed - last
+	}
+	flush := p.pending >= pullFlushBytes
+	p.mu.Unlock()
+
+	if !flush {
+		return nil
+	}
+	p.flush()
+	return p.meter.check(models.BandwidthSourceOllamaPull)
+}
+
+// flush records the buffered bytes
+func (p *pullCounter) flush() {
+	p.mu.Lock()
+	pending := p.pending
+	p.pending = 0
+	p.mu.Unlock()
+
+	p.meter.record(models.BandwidthSourceOllamaPull, pending)
+}
+
+// GetBandwidthCapsHandler returns the configured monthly download caps
+func GetBandwidthCapsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		caps, err := models.GetBandwidthCaps(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, caps)
+	}
+}
+
+// UpdateBandwidthCapsHandler replaces the monthly download caps
+func UpdateBandwidthCapsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var caps models.BandwidthCaps
+		if err := c.ShouldBindJSON(&caps); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+
+		var fieldErrs []FieldError
+		if caps.MonthlyBytes < 0 {
+			fieldErrs = append(fieldErrs, FieldError{Field: "monthly_bytes", Message: "must not be negative"})
+		}
+		for source, limit := range caps.SourceMonthlyBytes {
+			field := "source_monthly_bytes." + source
+			if !slices.Contains(models.BandwidthSources, source) {
+				fieldErrs = append(fieldErrs, FieldError{Field: field, Message: fmt.Sprintf("unknown source, expected one of %v", models.BandwidthSources)})
+			} else if limit < 0 {
+				fieldErrs = append(fieldErrs, FieldError{Field: field, Message: "must not be negative"})
+			}
+		}
+		if len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+
+		if caps.SourceMonthlyBytes == nil {
+			caps.SourceMonthlyBytes = map[string]int64{}
+		}
+
+		if err := models.SaveBandwidthCaps(db, &caps); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, caps)
+	}
+}
+
+// BandwidthUsageStatsHandler returns bytes downloaded per day and per source
+// between ?from and ?to (YYYY-MM-DD, default the current month in UTC),
+// alongside the caps and how much of them this month has used
+func BandwidthUsageStatsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		monthFrom, monthTo, resetsAt := bandwidthMonth(time.Now())
+
+		from, to := c.DefaultQuery("from", monthFrom), c.DefaultQuery("to", monthTo)
+		for _, day := range []string{from, to} {
+			if _, err := time.Parse("2006-01-02", day); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "from and to must be in YYYY-MM-DD format"})
+				return
+			}
+		}
+
+		caps, err := models.GetBandwidthCaps(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		days, err := models.ListBandwidthUsage(db, from, to)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var total int64
+		sources := make(map[string]int64)
+		for _, source := range models.BandwidthSources {
+			sources[source] = 0
+		}
+		for _, d := range days {
+			total += d.Total
+			for source, bytes := range d.Sources {
+				sources[source] += bytes
+			}
+		}
+
+		month, err := models.ListBandwidthUsage(db, monthFrom, monthTo)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		var monthUsed int64
+		monthSources := make(map[string]int64)
+		for _, d := range month {
+			monthUsed += d.Total
+			for source, bytes := range d.Sources {
+				monthSources[source] += bytes
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"from":    from,
+			"to":      to,
+			"total":   total,
+			"sources": sources,
+			"days":    days,
+			"caps":    caps,
+			"month": gin.H{
+				"from":      monthFrom,
+				"to":        monthTo,
+				"used":      monthUsed,
+				"sources":   monthSources,
+				"resets_at": resetsAt,
+			},
+		})
+	}
+}
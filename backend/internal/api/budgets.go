@@ -0,0 +1,193 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/i18n"
+	"vessel-backend/internal/models"
+)
+
+// checkTokenBudgets rejects a chat request with 429 if its chat or API key
+// has used up its daily token budget, and records the key the request's
+// usage is counted against
+func (s *OllamaService) checkTokenBudgets(c *gin.Context, req *ChatPipelineRequest) bool {
+	req.usageKey = authIdentity(c)
+	if s.db == nil {
+		return true
+	}
+
+	budgets, err := models.GetTokenBudgets(s.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if slices.Contains(budgets.ExemptKeys, req.usageKey) {
+		return true
+	}
+
+	day := models.UsageDay(time.Now())
+
+	if budgets.KeyDaily > 0 {
+		used, err := models.GetTokenUsageTotal(s.db, day, models.UsageScopeKey, req.usageKey)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return false
+		}
+		if used >= budgets.KeyDaily {
+			respondBudgetExceeded(c, models.UsageScopeKey, budgets.KeyDaily, used)
+			return false
+		}
+	}
+
+	if budgets.ChatDaily > 0 && req.ChatID != "" && !slices.Contains(budgets.ExemptChats, req.ChatID) {
+		used, err := models.GetTokenUsageTotal(s.db, day, models.UsageScopeChat, req.ChatID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return false
+		}
+		if used >= budgets.ChatDaily {
+			respondBudgetExceeded(c, models.UsageScopeChat, budgets.ChatDaily, used)
+			return false
+		}
+	}
+
+	return true
+}
+
+// respondBudgetExceeded writes a 429 response saying when the budget resets
+func respondBudgetExceeded(c *gin.Context, scope string, limit, used int64) {
+	now := time.Now().UTC()
+	resetsAt := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+
+	suggestion := i18n.SuggestKeyBudget
+	if scope == models.UsageScopeChat {
+		suggestion = i18n.SuggestChatBudget
+	}
+
+	c.Header("Retry-After", strconv.Itoa(int(resetsAt.Sub(now).Seconds())+1))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":      "daily token budget exceeded for this " + scope,
+		"scope":      scope,
+		"limit":      limit,
+		"used":       used,
+		"resets_at":  resetsAt,
+		"suggestion": suggest(c, suggestion),
+	})
+}
+
+// recordTokenUsage counts a completion's tokens against its chat and API key.
+// Usage is recorded even for exempt subjects so it shows up in the stats.
+// The completion's timings also feed the backend's current metrics, and the
+// model's use is counted for sorting model lists and cleanup suggestions.
+func (s *OllamaService) recordTokenUsage(req *ChatPipelineRequest, metrics api.Metrics) {
+	s.metrics.observe(req.Model, metrics)
+
+	if s.db == nil {
+		return
+	}
+	if err := models.RecordModelUsage(s.db, normalizeModelName(req.Model), time.Now()); err != nil {
+		log.Printf("[Models] %v", err)
+	}
+	if metrics.PromptEvalCount == 0 && metrics.EvalCount == 0 {
+		return
+	}
+
+	day := models.UsageDay(time.Now())
+	input, output := int64(metrics.PromptEvalCount), int64(metrics.EvalCount)
+
+	if err := models.RecordTokenUsage(s.db, day, models.UsageScopeKey, req.usageKey, input, output); err != nil {
+		log.Printf("[Budgets] %v", err)
+	}
+	if req.ChatID != "" {
+		if err := models.RecordTokenUsage(s.db, day, models.UsageScopeChat, req.ChatID, input, output); err != nil {
+			log.Printf("[Budgets] %v", err)
+		}
+	}
+}
+
+// GetTokenBudgetsHandler returns the configured daily token budgets
+func GetTokenBudgetsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		budgets, err := models.GetTokenBudgets(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, budgets)
+	}
+}
+
+// UpdateTokenBudgetsHandler replaces the daily token budgets
+func UpdateTokenBudgetsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var budgets models.TokenBudgets
+		if err := c.ShouldBindJSON(&budgets); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+
+		var fieldErrs []FieldError
+		if budgets.ChatDaily < 0 {
+			fieldErrs = append(fieldErrs, FieldError{Field: "chat_daily", Message: "must not be negative"})
+		}
+		if budgets.KeyDaily < 0 {
+			fieldErrs = append(fieldErrs, FieldError{Field: "key_daily", Message: "must not be negative"})
+		}
+		if len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+
+		if budgets.ExemptKeys == nil {
+			budgets.ExemptKeys = []string{}
+		}
+		if budgets.ExemptChats == nil {
+			budgets.ExemptChats = []string{}
+		}
+
+		if err := models.SaveTokenBudgets(db, &budgets); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, budgets)
+	}
+}
+
+// TokenUsageStatsHandler returns token usage per chat and API key for a day
+// (?day=YYYY-MM-DD, default today in UTC) alongside the configured budgets
+func TokenUsageStatsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		day := c.Query("day")
+		if day == "" {
+			day = models.UsageDay(time.Now())
+		} else if _, err := time.Parse("2006-01-02", day); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "day must be in YYYY-MM-DD format"})
+			return
+		}
+
+		budgets, err := models.GetTokenBudgets(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		usage, err := models.ListTokenUsage(db, day)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"day":     day,
+			"budgets": budgets,
+			"usage":   usage,
+		})
+	}
+}
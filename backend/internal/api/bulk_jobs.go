@@ -0,0 +1,772 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/models"
+)
+
+const (
+	// maxBulkChatIDs caps how many chats one delete job names
+	maxBulkChatIDs = 10000
+	// bulkSaveInterval is how often a running job's progress is saved;
+	// followers are woken on every item regardless
+	bulkSaveInterval = time.Second
+	// maxBulkPullModels caps how many models one pull job names
+	maxBulkPullModels = 50
+)
+
+// Bulk job retries
+const (
+	// bulkJobAttempts is how many times a job is run before it is given up
+	// as dead. A run fails when the job can't start, or when the backend
+	// stays down for one of its items.
+	bulkJobAttempts = 3
+	// bulkRetryDelay is the wait before a failed job's first retry; it
+	// doubles with every further attempt, up to bulkMaxRetryDelay
+	bulkRetryDelay    = 30 * time.Second
+	bulkMaxRetryDelay = 10 * time.Minute
+	// bulkItemAttempts is how many times an item that fails because the
+	// backend is down is tried within one run, bulkItemRetryDelay apart
+	bulkItemAttempts   = 3
+	bulkItemRetryDelay = 5 * time.Second
+)
+
+// bulkRunner executes bulk jobs in the background on a fixed number of
+// workers and lets clients follow their progress. Jobs are stored with
+// their items, so the ones a restart interrupted carry on (see
+// ResumeBulkJobs).
+type bulkRunner struct {
+	slot chan struct{}
+
+	mu   sync.Mutex
+	jobs map[string]*bulkJob
+}
+
+// newBulkRunner creates a runner that executes up to workers jobs at a time
+func newBulkRunner(workers int) *bulkRunner {
+	return &bulkRunner{
+		slot: make(chan struct{}, max(workers, 1)),
+		jobs: make(map[string]*bulkJob),
+	}
+}
+
+// bulkJob is a job being executed
+type bulkJob struct {
+	cancel context.CancelFunc
+
+	mu  sync.Mutex
+	job models.BulkJob
+	// updated is closed and replaced whenever the job's progress changes
+	updated chan struct{}
+	savedAt time.Time
+}
+
+// bulkTask is the work of a job: what to do with each of its items.
+// prepare, when set, runs before the first item of every run of the job.
+// Tasks are built from the job's kind and params (see bulkTask), so a
+// stored job can be run again.
+type bulkTask struct {
+	prepare func(ctx context.Context) error
+	run     func(ctx context.Context, item string) error
+}
+
+// snapshot returns the job's current state and a channel that is closed
+// when it changes
+func (j *bulkJob) snapshot() (models.BulkJob, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job := j.job
+	job.Results = slices.Clone(j.job.Results)
+	return job, j.updated
+}
+
+// update applies a change to the job and wakes any followers. The change is
+// saved when the job finishes, or at most every bulkSaveInterval while it runs.
+func (j *bulkJob) update(db *sql.DB, change func(job *models.BulkJob)) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	change(&j.job)
+	close(j.updated)
+	j.updated = make(chan struct{})
+
+	if j.job.Status == models.BulkJobRunning && time.Since(j.savedAt) < bulkSaveInterval {
+		return nil
+	}
+	j.savedAt = time.Now()
+	return models.SaveBulkJobProgress(db, &j.job)
+}
+
+// DeleteChatsJobRequest is the request body for deleting chats in bulk
+type DeleteChatsJobRequest struct {
+	ChatIDs []string `json:"chat_ids"`
+}
+
+// ArchiveChatsJobRequest is the request body for archiving the chats that
+// match a filter. At least one of the filter's fields must be set.
+type ArchiveChatsJobRequest struct {
+	models.ChatFilter
+}
+
+// ReembedCollectionJobRequest is the request body for re-embedding a
+// collection's chunks
+type ReembedCollectionJobRequest struct {
+	// EmbeddingModel switches the collection to another model; empty keeps
+	// its current one
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+}
+
+// reembedCollectionParams are the params of a reembed_collection job
+type reembedCollectionParams struct {
+	CollectionID   string `json:"collection_id"`
+	EmbeddingModel string `json:"embedding_model"`
+}
+
+// PullModelsJobRequest is the request body for pulling models in the
+// background
+type PullModelsJobRequest struct {
+	Models []string `json:"models"`
+}
+
+// DeleteChatsJobHandler deletes the named chats in the background
+func (s *OllamaService) DeleteChatsJobHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req DeleteChatsJobRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+		ids := slices.Compact(slices.Sorted(slices.Values(req.ChatIDs)))
+		ids = slices.DeleteFunc(ids, func(id string) bool { return strings.TrimSpace(id) == "" })
+		switch {
+		case len(ids) == 0:
+			respondValidationError(c, []FieldError{{Field: "chat_ids", Message: "at least one chat ID is required"}})
+			return
+		case len(ids) > maxBulkChatIDs:
+			respondValidationError(c, []FieldError{{Field: "chat_ids", Message: fmt.Sprintf("at most %d chats per job", maxBulkChatIDs)}})
+			return
+		}
+
+		s.startBulkJob(c, models.BulkJobDeleteChats, req, ids)
+	}
+}
+
+// ArchiveChatsJobHandler archives every unarchived chat matching a filter in
+// the background. The chats are matched when the job is created.
+func (s *OllamaService) ArchiveChatsJobHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ArchiveChatsJobRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+		f := req.ChatFilter
+		if f.ProjectID == "" && f.Model == "" && f.TitleContains == "" && f.UpdatedBefore == nil {
+			respondValidationError(c, []FieldError{{
+				Field:   "updated_before",
+				Message: "set at least one of project_id, model, title_contains and updated_before",
+			}})
+			return
+		}
+
+		ids, err := models.FindUnarchivedChatIDs(s.db, f)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		s.startBulkJob(c, models.BulkJobArchiveChats, req, ids)
+	}
+}
+
+// ReembedCollectionJobHandler embeds every chunk of a collection again in the
+// background, optionally with a different embedding model. The collection
+// switches to the new model when the job starts, so search results are
+// incomplete until it finishes; a job that stops part way can be run again.
+func (s *OllamaService) ReembedCollectionJobHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collection, err := models.GetRAGCollection(s.db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if collection == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "collection not found"})
+			return
+		}
+
+		var req ReembedCollectionJobRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+		model := strings.TrimSpace(req.EmbeddingModel)
+		if model == "" {
+			model = collection.EmbeddingModel
+		}
+
+		docs, err := models.ListRAGDocuments(s.db, collection.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		ids := make([]string, 0, len(docs))
+		for _, doc := range docs {
+			ids = append(ids, doc.ID)
+		}
+
+		s.startBulkJob(c, models.BulkJobReembedCollection, reembedCollectionParams{
+			CollectionID:   collection.ID,
+			EmbeddingModel: model,
+		}, ids)
+	}
+}
+
+// reembedCollectionTask embeds the chunks of a collection's documents again,
+// switching the collection to the job's model first
+func (s *OllamaService) reembedCollectionTask(p reembedCollectionParams) bulkTask {
+	return bulkTask{
+		prepare: func(ctx context.Context) error {
+			// Check the model answers before touching the collection
+			if _, err := s.embed(ctx, p.EmbeddingModel, []string{"dimension check"}); err != nil {
+				return fmt.Errorf("embedding model %q is not available: %w", p.EmbeddingModel, err)
+			}
+			current, err := models.GetRAGCollection(s.db, p.CollectionID)
+			if err != nil {
+				return err
+			}
+			if current == nil {
+				return fmt.Errorf("collection not found")
+			}
+			if current.EmbeddingModel == p.EmbeddingModel {
+				return nil
+			}
+			current.EmbeddingModel = p.EmbeddingModel
+			return models.UpdateRAGCollection(s.db, current)
+		},
+		run: func(ctx context.Context, id string) error {
+			return s.reembedDocument(ctx, p.EmbeddingModel, id)
+		},
+	}
+}
+
+// PullModelsJobHandler pulls models one after another in the background.
+// Unlike the streamed pulls, the job survives the client going away and a
+// restart, and pulls interrupted by an Ollama outage are retried.
+func (s *OllamaService) PullModelsJobHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req PullModelsJobRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+
+		var fieldErrs []FieldError
+		names := make([]string, 0, len(req.Models))
+		seen := make(map[string]bool)
+		for i, model := range req.Models {
+			model = strings.TrimSpace(model)
+			switch {
+			case model == "":
+				fieldErrs = append(fieldErrs, FieldError{Field: fmt.Sprintf("models[%d]", i), Message: "model name must not be empty"})
+			case !seen[normalizeModelName(model)]:
+				seen[normalizeModelName(model)] = true
+				names = append(names, model)
+			}
+		}
+		switch {
+		case len(req.Models) == 0:
+			fieldErrs = append(fieldErrs, FieldError{Field: "models", Message: "at least one model is required"})
+		case len(req.Models) > maxBulkPullModels:
+			fieldErrs = append(fieldErrs, FieldError{Field: "models", Message: fmt.Sprintf("at most %d models per job", maxBulkPullModels)})
+		}
+		if len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+
+		s.startBulkJob(c, models.BulkJobPullModels, PullModelsJobRequest{Models: names}, names)
+	}
+}
+
+// pullModelsTask pulls each model, following a pull already in progress
+func (s *OllamaService) pullModelsTask() bulkTask {
+	return bulkTask{
+		run: func(ctx context.Context, model string) error {
+			return s.pull(ctx, &api.PullRequest{Model: model}, func(api.ProgressResponse) error { return nil })
+		},
+	}
+}
+
+// bulkTask builds the task of a job from its kind and params
+func (s *OllamaService) bulkTask(job *models.BulkJob) (bulkTask, error) {
+	switch job.Kind {
+	case models.BulkJobDeleteChats:
+		return bulkTask{run: func(ctx context.Context, id string) error {
+			return models.DeleteChat(s.db, id)
+		}}, nil
+	case models.BulkJobArchiveChats:
+		return bulkTask{run: func(ctx context.Context, id string) error {
+			return models.ArchiveChat(s.db, id)
+		}}, nil
+	case models.BulkJobReembedCollection:
+		var p reembedCollectionParams
+		if err := json.Unmarshal(job.Params, &p); err != nil {
+			return bulkTask{}, fmt.Errorf("invalid job params: %w", err)
+		}
+		return s.reembedCollectionTask(p), nil
+	case models.BulkJobVerifyModels:
+		if s.modelsDir == "" {
+			return bulkTask{}, fmt.Errorf("model verification is disabled; set -ollama-models-dir")
+		}
+		return s.verifyModelsTask(), nil
+	case models.BulkJobTranslateChat:
+		var p translateChatParams
+		if err := json.Unmarshal(job.Params, &p); err != nil {
+			return bulkTask{}, fmt.Errorf("invalid job params: %w", err)
+		}
+		return s.translateChatTask(p), nil
+	case models.BulkJobPullModels:
+		return s.pullModelsTask(), nil
+	case models.BulkJobRecrawlDocuments:
+		var p recrawlDocumentsParams
+		if err := json.Unmarshal(job.Params, &p); err != nil {
+			return bulkTask{}, fmt.Errorf("invalid job params: %w", err)
+		}
+		return s.recrawlDocumentsTask(p), nil
+	}
+	return bulkTask{}, fmt.Errorf("unknown job kind %q", job.Kind)
+}
+
+// reembedDocument replaces the embeddings of a document's chunks
+func (s *OllamaService) reembedDocument(ctx context.Context, model, documentID string) error {
+	chunks, err := models.GetRAGDocumentChunks(s.db, documentID)
+	if err != nil {
+		return err
+	}
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Content
+	}
+	embedded, err := s.embedChunks(ctx, model, texts)
+	if err != nil {
+		return err
+	}
+	for i := range chunks {
+		chunks[i].Embedding = embedded[i].Embedding
+	}
+	return models.UpdateRAGChunkEmbeddings(s.db, chunks)
+}
+
+// ListBulkJobsHandler returns recent jobs, newest first; ?kind and ?status
+// limit the list to one kind and status (?status=dead lists the jobs that
+// failed on every attempt) and ?limit caps it (default 50, max 200)
+func ListBulkJobsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := 50
+		if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 200 {
+			limit = l
+		}
+		jobs, err := models.ListBulkJobs(db, c.Query("kind"), c.Query("status"), limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"jobs": jobs})
+	}
+}
+
+// GetBulkJobHandler returns a job's status, progress and results
+func (s *OllamaService) GetBulkJobHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, err := models.GetBulkJob(s.db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if job == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+		current, _ := s.watchBulkJob(job)
+		c.JSON(http.StatusOK, current)
+	}
+}
+
+// BulkJobEventsHandler streams a job's progress as server-sent events. A
+// "progress" event is sent on every change, and a final event named after
+// the job's status (completed, failed, cancelled or dead) ends the stream.
+func (s *OllamaService) BulkJobEventsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, err := models.GetBulkJob(s.db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if job == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+
+		flusher, ok := c.Writer.(http.Flusher)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "streaming not supported"})
+			return
+		}
+
+		ctx := c.Request.Context()
+		for {
+			current, updated := s.watchBulkJob(job)
+			event := "progress"
+			if current.Finished() {
+				event = current.Status
+			}
+			data, _ := json.Marshal(current)
+			if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, data); err != nil {
+				return
+			}
+			flusher.Flush()
+
+			if updated == nil || current.Finished() {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				// The job carries on; the client can follow it again later
+				return
+			case <-updated:
+			}
+		}
+	}
+}
+
+// CancelBulkJobHandler stops a queued or running job, including one waiting
+// to be retried. Items already processed stay done.
+func (s *OllamaService) CancelBulkJobHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.jobs.mu.Lock()
+		job, ok := s.jobs.jobs[c.Param("id")]
+		s.jobs.mu.Unlock()
+
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not active"})
+			return
+		}
+		job.cancel()
+		c.JSON(http.StatusOK, gin.H{"message": "job cancelled"})
+	}
+}
+
+// RetryBulkJobHandler runs a dead, failed or cancelled job again with fresh
+// attempts. It carries on with the items it hadn't processed yet.
+func (s *OllamaService) RetryBulkJobHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, err := models.GetBulkJob(s.db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if job == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+		s.jobs.mu.Lock()
+		_, active := s.jobs.jobs[job.ID]
+		s.jobs.mu.Unlock()
+		if active || !job.Finished() || job.Status == models.BulkJobCompleted {
+			c.JSON(http.StatusConflict, gin.H{"error": "only dead, failed or cancelled jobs can be retried"})
+			return
+		}
+		if len(job.Items) < job.Total {
+			c.JSON(http.StatusConflict, gin.H{"error": "the job's items weren't stored; start a new job instead"})
+			return
+		}
+
+		task, err := s.bulkTask(job)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		job.Status, job.Error, job.Attempts, job.NextRunAt = models.BulkJobQueued, "", 0, nil
+		if err := models.SaveBulkJobProgress(s.db, job); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		s.runBulkJob(job, task)
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// ResumeBulkJobs runs the jobs a previous process left queued or running
+// again, from the first item they hadn't processed. Jobs that can't be run
+// any more are failed. In maintenance mode this waits until it is turned
+// off.
+func (s *OllamaService) ResumeBulkJobs() {
+	if s.db == nil {
+		return
+	}
+	if InMaintenance() {
+		go func() {
+			waitOutMaintenance(context.Background())
+			s.ResumeBulkJobs()
+		}()
+		return
+	}
+	jobs, err := models.ListUnfinishedBulkJobs(s.db)
+	if err != nil {
+		log.Printf("[Jobs] %v", err)
+		return
+	}
+	for i := range jobs {
+		job := &jobs[i]
+		task, err := s.bulkTask(job)
+		if err == nil && len(job.Items) < job.Total {
+			err = fmt.Errorf("the job's items weren't stored")
+		}
+		if err != nil {
+			job.Status, job.Error = models.BulkJobFailed, "interrupted by server restart: "+err.Error()
+			if err := models.SaveBulkJobProgress(s.db, job); err != nil {
+				log.Printf("[Jobs] %v", err)
+			}
+			continue
+		}
+		job.Status = models.BulkJobQueued
+		log.Printf("[Jobs] Resuming %s job %s at item %d of %d", job.Kind, job.ID, job.Done+1, job.Total)
+		s.runBulkJob(job, task)
+	}
+}
+
+// watchBulkJob returns a job's current state and a channel closed when it
+// changes. The channel is nil once the job is no longer running.
+func (s *OllamaService) watchBulkJob(job *models.BulkJob) (models.BulkJob, <-chan struct{}) {
+	s.jobs.mu.Lock()
+	active, ok := s.jobs.jobs[job.ID]
+	s.jobs.mu.Unlock()
+	if ok {
+		return active.snapshot()
+	}
+
+	// The job may have finished since it was loaded
+	if current, err := models.GetBulkJob(s.db, job.ID); err == nil && current != nil {
+		return *current, nil
+	}
+	return *job, nil
+}
+
+// startBulkJob queues a job of a kind over items and responds with 202
+// and the job
+func (s *OllamaService) startBulkJob(c *gin.Context, kind string, params any, items []string) {
+	job, err := s.queueBulkJob(kind, params, items)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+// queueBulkJob stores a job of a kind over items and runs it in the
+// background
+func (s *OllamaService) queueBulkJob(kind string, params any, items []string) (*models.BulkJob, error) {
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	job := &models.BulkJob{
+		Kind:   kind,
+		Status: models.BulkJobQueued,
+		Params: encoded,
+		Items:  items,
+		Total:  len(items),
+	}
+	task, err := s.bulkTask(job)
+	if err != nil {
+		return nil, err
+	}
+	if err := models.CreateBulkJob(s.db, job); err != nil {
+		return nil, err
+	}
+	s.runBulkJob(job, task)
+	return job, nil
+}
+
+// runBulkJob executes a stored job in the background
+func (s *OllamaService) runBulkJob(job *models.BulkJob, task bulkTask) {
+	ctx, cancel := context.WithCancel(context.Background())
+	active := &bulkJob{cancel: cancel, job: *job, updated: make(chan struct{})}
+	s.jobs.mu.Lock()
+	s.jobs.jobs[job.ID] = active
+	s.jobs.mu.Unlock()
+
+	go s.executeBulkJob(ctx, active, task)
+}
+
+// activeBulkJob reports whether a job of a kind is queued or running
+func (s *OllamaService) activeBulkJob(kind string) bool {
+	s.jobs.mu.Lock()
+	defer s.jobs.mu.Unlock()
+	for _, job := range s.jobs.jobs {
+		if current, _ := job.snapshot(); current.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// executeBulkJob runs a job until it completes, retrying failed runs with
+// backoff. After bulkJobAttempts failed runs the job is dead.
+func (s *OllamaService) executeBulkJob(ctx context.Context, job *bulkJob, task bulkTask) {
+	current, _ := job.snapshot()
+	defer func() {
+		s.jobs.mu.Lock()
+		if s.jobs.jobs[current.ID] == job {
+			delete(s.jobs.jobs, current.ID)
+		}
+		s.jobs.mu.Unlock()
+		job.cancel()
+	}()
+
+	for {
+		if current.NextRunAt != nil {
+			timer := time.NewTimer(time.Until(*current.NextRunAt))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				s.finishBulkJob(job, models.BulkJobCancelled, "")
+				return
+			}
+		}
+
+		err := s.runBulkJobOnce(ctx, job, task)
+		switch {
+		case ctx.Err() != nil:
+			s.finishBulkJob(job, models.BulkJobCancelled, "")
+			return
+		case err == nil:
+			s.finishBulkJob(job, models.BulkJobCompleted, "")
+			return
+		}
+
+		current, _ = job.snapshot()
+		if current.Attempts+1 >= bulkJobAttempts {
+			log.Printf("[Jobs] Job %s is dead after %d attempts: %v", current.ID, current.Attempts+1, err)
+			if err := job.update(s.db, func(j *models.BulkJob) { j.Attempts++ }); err != nil {
+				log.Printf("[Jobs] %v", err)
+			}
+			s.finishBulkJob(job, models.BulkJobDead, err.Error())
+			return
+		}
+		delay := min(bulkRetryDelay<<current.Attempts, bulkMaxRetryDelay)
+		log.Printf("[Jobs] Job %s failed, retrying in %s: %v", current.ID, delay, err)
+		if err := job.update(s.db, func(j *models.BulkJob) {
+			nextRunAt := time.Now().UTC().Add(delay)
+			j.Status, j.Error, j.NextRunAt = models.BulkJobQueued, err.Error(), &nextRunAt
+			j.Attempts++
+		}); err != nil {
+			log.Printf("[Jobs] %v", err)
+		}
+		current, _ = job.snapshot()
+	}
+}
+
+// runBulkJobOnce waits for a worker, then processes the items the job
+// hasn't processed yet in order, recording the outcome of each. It pauses
+// before each item while maintenance mode is enabled. It returns
+// an error when the run failed as a whole: the task couldn't be prepared,
+// or the backend stayed down for an item, which is left for the next run.
+func (s *OllamaService) runBulkJobOnce(ctx context.Context, job *bulkJob, task bulkTask) error {
+	if err := waitOutMaintenance(ctx); err != nil {
+		return err
+	}
+	select {
+	case s.jobs.slot <- struct{}{}:
+		defer func() { <-s.jobs.slot }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if err := job.update(s.db, func(j *models.BulkJob) {
+		j.Status, j.NextRunAt = models.BulkJobRunning, nil
+	}); err != nil {
+		log.Printf("[Jobs] %v", err)
+	}
+
+	if task.prepare != nil {
+		if err := task.prepare(ctx); err != nil {
+			return err
+		}
+	}
+
+	current, _ := job.snapshot()
+	for _, item := range current.Items[current.Done:] {
+		if err := waitOutMaintenance(ctx); err != nil {
+			return err
+		}
+
+		result := models.BulkJobItem{ID: item, Status: models.BulkItemOK}
+		if err := runBulkItem(ctx, task, item); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if isBackendOutage(err) {
+				return fmt.Errorf("%s: %w", item, err)
+			}
+			result.Status, result.Error = models.BulkItemFailed, err.Error()
+		}
+		if err := job.update(s.db, func(j *models.BulkJob) {
+			j.Done++
+			if result.Status == models.BulkItemFailed {
+				j.Failed++
+			}
+			j.Results = append(j.Results, result)
+		}); err != nil {
+			log.Printf("[Jobs] %v", err)
+		}
+	}
+	return nil
+}
+
+// runBulkItem processes one item, trying it again with backoff while the
+// backend is down
+func runBulkItem(ctx context.Context, task bulkTask, item string) error {
+	delay := bulkItemRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := task.run(ctx, item)
+		if err == nil || attempt == bulkItemAttempts || !isBackendOutage(err) {
+			return err
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// finishBulkJob records a job's final status
+func (s *OllamaService) finishBulkJob(job *bulkJob, status, errMsg string) {
+	if err := job.update(s.db, func(j *models.BulkJob) {
+		j.Status = status
+		j.Error = errMsg
+		j.NextRunAt = nil
+	}); err != nil {
+		log.Printf("[Jobs] %v", err)
+	}
+}
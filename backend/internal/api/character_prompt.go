@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/models"
+)
+
+// defaultCharacterUserName stands in for {{user}} when the request doesn't
+// name the user
+const defaultCharacterUserName = "User"
+
+// defaultCharacterSystemPrompt is used for cards without a system prompt,
+// and replaces {{original}} in cards that extend it
+const defaultCharacterSystemPrompt = "Write {{char}}'s next reply in a fictional chat between {{char}} and {{user}}."
+
+// characterMacros replaces the card macros with the character's and the
+// user's names
+func characterMacros(card *models.CharacterCard, userName string) *strings.Replacer {
+	if userName == "" {
+		userName = defaultCharacterUserName
+	}
+	return strings.NewReplacer(
+		"{{char}}", card.Name, "{{Char}}", card.Name, "<BOT>", card.Name, "<bot>", card.Name,
+		"{{user}}", userName, "{{User}}", userName, "<USER>", userName, "<user>", userName,
+	)
+}
+
+// characterGreeting returns the greeting a chat with the character opens
+// with: 0 is the card's first message, 1 and up its alternate greetings
+func characterGreeting(card *models.CharacterCard, index int, userName string) (string, error) {
+	greeting := card.FirstMessage
+	if index < 0 || index > len(card.AlternateGreetings) {
+		return "", fmt.Errorf("must be between 0 and %d", len(card.AlternateGreetings))
+	}
+	if index > 0 {
+		greeting = card.AlternateGreetings[index-1]
+	}
+	return characterMacros(card, userName).Replace(greeting), nil
+}
+
+// characterPrompt puts a character card in front of a conversation. The
+// card becomes a system message (its system prompt, description,
+// personality and scenario), and its example dialogs become real user and
+// assistant turns, so the model's chat template formats them like the rest
+// of the chat. Post-history instructions follow the conversation, before a
+// trailing assistant prefill. A system message the client sent first is
+// merged into the card's, since many templates allow only one.
+func characterPrompt(card *models.CharacterCard, userName string, messages []api.Message) []api.Message {
+	if userName == "" {
+		userName = defaultCharacterUserName
+	}
+	macros := characterMacros(card, userName)
+
+	system := card.SystemPrompt
+	if strings.TrimSpace(system) == "" {
+		system = defaultCharacterSystemPrompt
+	}
+	system = strings.ReplaceAll(system, "{{original}}", defaultCharacterSystemPrompt)
+	parts := []string{system}
+	if s := strings.TrimSpace(card.Description); s != "" {
+		parts = append(parts, s)
+	}
+	if s := strings.TrimSpace(card.Personality); s != "" {
+		parts = append(parts, "{{char}}'s personality: "+s)
+	}
+	if s := strings.TrimSpace(card.Scenario); s != "" {
+		parts = append(parts, "Scenario: "+s)
+	}
+	if len(messages) > 0 && messages[0].Role == "system" {
+		if s := strings.TrimSpace(messages[0].Content); s != "" {
+			parts = append(parts, s)
+		}
+		messages = messages[1:]
+	}
+
+	result := []api.Message{{Role: "system", Content: macros.Replace(strings.Join(parts, "\n\n"))}}
+	result = append(result, characterExamples(card.ExampleMessages, macros, card.Name, userName)...)
+
+	var prefill *api.Message
+	if len(messages) > 0 && messages[len(messages)-1].Role == "assistant" {
+		prefill = &messages[len(messages)-1]
+		messages = messages[:len(messages)-1]
+	}
+	result = append(result, messages...)
+	if s := strings.TrimSpace(card.PostHistoryInstructions); s != "" {
+		s = strings.ReplaceAll(s, "{{original}}", "")
+		result = append(result, api.Message{Role: "system", Content: macros.Replace(s)})
+	}
+	if prefill != nil {
+		result = append(result, *prefill)
+	}
+	return result
+}
+
+// characterExamples turns a card's example dialogs into chat turns. Dialogs
+// are separated by <START>, and each line starting with "{{user}}:" or
+// "{{char}}:" begins a turn; other lines continue the current one.
+func characterExamples(examples string, macros *strings.Replacer, charName, userName string) []api.Message {
+	var result []api.Message
+	for _, dialog := range strings.Split(examples, "<START>") {
+		current := -1 // the turn continuation lines belong to
+		for _, line := range strings.Split(macros.Replace(dialog), "\n") {
+			var role, rest string
+			switch {
+			case strings.HasPrefix(line, userName+":"):
+				role, rest = "user", line[len(userName)+1:]
+			case strings.HasPrefix(line, charName+":"):
+				role, rest = "assistant", line[len(charName)+1:]
+			case current >= 0:
+				result[current].Content += "\n" + line
+				continue
+			default:
+				continue
+			}
+			result = append(result, api.Message{Role: role, Content: rest})
+			current = len(result) - 1
+		}
+	}
+	for i := range result {
+		result[i].Content = strings.TrimSpace(result[i].Content)
+	}
+	return result
+}
+
+// characterMiddleware plays the character card the request or its chat
+// names (see characterPrompt)
+type characterMiddleware struct {
+	ChatMiddlewareBase
+	s *OllamaService
+}
+
+func (characterMiddleware) Name() string { return "character" }
+
+func (m characterMiddleware) PrepareChat(_ context.Context, req *ChatPipelineRequest) error {
+	if req.CharacterID == "" || m.s.db == nil {
+		return nil
+	}
+	card, err := models.GetCharacterCard(m.s.db, req.CharacterID)
+	if err != nil {
+		return err
+	}
+	if card == nil {
+		return &ChatRejectedError{Status: http.StatusNotFound, Message: "character card not found"}
+	}
+	req.Messages = characterPrompt(card, req.UserName, req.Messages)
+	return nil
+}
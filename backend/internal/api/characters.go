@@ -0,0 +1,305 @@
+package api
+
+import (
+	"bytes"
+	"compress/zlib"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"vessel-backend/internal/models"
+)
+
+// characterCardMaxSize caps the size of an imported card; PNG cards carry
+// the character's portrait
+const characterCardMaxSize = 20 * 1024 * 1024
+
+// pngSignature starts every PNG file
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// Character card specs; cards without a spec field are v1
+const (
+	characterSpecV1 = "chara_card_v1"
+	characterSpecV2 = "chara_card_v2"
+	characterSpecV3 = "chara_card_v3"
+)
+
+// characterCardData holds the card fields shared by the v1 layout (at the
+// top level) and the v2 and v3 layouts (under "data")
+type characterCardData struct {
+	Name                    string   `json:"name"`
+	Description             string   `json:"description"`
+	Personality             string   `json:"personality"`
+	Scenario                string   `json:"scenario"`
+	FirstMessage            string   `json:"first_mes"`
+	ExampleMessages         string   `json:"mes_example"`
+	CreatorNotes            string   `json:"creator_notes"`
+	SystemPrompt            string   `json:"system_prompt"`
+	PostHistoryInstructions string   `json:"post_history_instructions"`
+	AlternateGreetings      []string `json:"alternate_greetings"`
+	Tags                    []string `json:"tags"`
+	Creator                 string   `json:"creator"`
+	CharacterVersion        string   `json:"character_version"`
+}
+
+// characterCardFile is a character card as exported by SillyTavern and
+// compatible tools
+type characterCardFile struct {
+	Spec string             `json:"spec"`
+	Data *characterCardData `json:"data"`
+	characterCardData
+}
+
+// parseCharacterCard reads a character card from a PNG with the card
+// embedded in a text chunk, or from the card's JSON
+func parseCharacterCard(data []byte) (*models.CharacterCard, error) {
+	var avatar []byte
+	if bytes.HasPrefix(data, pngSignature) {
+		embedded, err := pngCharacterData(data)
+		if err != nil {
+			return nil, err
+		}
+		avatar, data = data, embedded
+	}
+
+	var file characterCardFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid character card: %w", err)
+	}
+	fields := file.characterCardData
+	spec := characterSpecV1
+	if file.Spec != "" {
+		if file.Spec != characterSpecV2 && file.Spec != characterSpecV3 {
+			return nil, fmt.Errorf("unsupported character card spec %q", file.Spec)
+		}
+		if file.Data == nil {
+			return nil, fmt.Errorf("invalid character card: %s card without data", file.Spec)
+		}
+		fields, spec = *file.Data, file.Spec
+	}
+	if strings.TrimSpace(fields.Name) == "" {
+		return nil, fmt.Errorf("invalid character card: the character has no name")
+	}
+
+	return &models.CharacterCard{
+		Name:                    strings.TrimSpace(fields.Name),
+		Description:             fields.Description,
+		Personality:             fields.Personality,
+		Scenario:                fields.Scenario,
+		FirstMessage:            fields.FirstMessage,
+		AlternateGreetings:      fields.AlternateGreetings,
+		ExampleMessages:         fields.ExampleMessages,
+		SystemPrompt:            fields.SystemPrompt,
+		PostHistoryInstructions: fields.PostHistoryInstructions,
+		CreatorNotes:            fields.CreatorNotes,
+		Creator:                 fields.Creator,
+		CharacterVersion:        fields.CharacterVersion,
+		Tags:                    fields.Tags,
+		Spec:                    spec,
+		Avatar:                  avatar,
+	}, nil
+}
+
+// pngCharacterData returns the card JSON embedded in a PNG. Cards are
+// stored base64-encoded in a tEXt or iTXt chunk named "ccv3" (v3) or
+// "chara"; the v3 chunk wins when both are present.
+func pngCharacterData(data []byte) ([]byte, error) {
+	chunks := make(map[string]string)
+	for pos := len(pngSignature); pos+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		kind := string(data[pos+4 : pos+8])
+		if length < 0 || pos+12+length > len(data) {
+			return nil, fmt.Errorf("invalid character card: truncated PNG")
+		}
+		body := data[pos+8 : pos+8+length]
+		pos += 12 + length
+
+		var keyword, text string
+		switch kind {
+		case "tEXt":
+			k, v, ok := bytes.Cut(body, []byte{0})
+			if !ok {
+				continue
+			}
+			keyword, text = string(k), string(v)
+		case "iTXt":
+			k, rest, ok := bytes.Cut(body, []byte{0})
+			if !ok || len(rest) < 2 {
+				continue
+			}
+			compressed := rest[0] == 1
+			// Skip the compression method, language tag and translated keyword
+			_, rest, _ = bytes.Cut(rest[2:], []byte{0})
+			_, rest, _ = bytes.Cut(rest, []byte{0})
+			if compressed {
+				r, err := zlib.NewReader(bytes.NewReader(rest))
+				if err != nil {
+					continue
+				}
+				rest, err = io.ReadAll(io.LimitReader(r, characterCardMaxSize))
+				if err != nil {
+					continue
+				}
+			}
+			keyword, text = string(k), string(rest)
+		case "IEND":
+			pos = len(data)
+			continue
+		default:
+			continue
+		}
+		keyword = strings.ToLower(keyword)
+		if keyword == "chara" || keyword == "ccv3" {
+			chunks[keyword] = text
+		}
+	}
+
+	for _, keyword := range []string{"ccv3", "chara"} {
+		text, ok := chunks[keyword]
+		if !ok {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("invalid character card: %s chunk is not base64: %w", keyword, err)
+		}
+		return decoded, nil
+	}
+	return nil, fmt.Errorf("invalid character card: the PNG has no embedded character")
+}
+
+// ListCharactersHandler returns all character cards
+func ListCharactersHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cards, err := models.ListCharacterCards(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"characters": cards})
+	}
+}
+
+// GetCharacterHandler returns a single character card
+func GetCharacterHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		card, err := models.GetCharacterCard(db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if card == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "character card not found"})
+			return
+		}
+		c.JSON(http.StatusOK, card)
+	}
+}
+
+// ImportCharacterHandler imports a character card, sent either as the
+// "file" field of a multipart form or as the request body. PNG cards (v2
+// and v3) and JSON cards (v1, v2 and v3) are accepted.
+func ImportCharacterHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, characterCardMaxSize+1024*1024)
+
+		var reader io.Reader = c.Request.Body
+		if strings.HasPrefix(c.ContentType(), "multipart/") {
+			header, err := c.FormFile("file")
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "expected the card in a \"file\" field"})
+				return
+			}
+			file, err := header.Open()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			defer file.Close()
+			reader = file
+		}
+
+		data, err := io.ReadAll(io.LimitReader(reader, characterCardMaxSize+1))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "character card is too large"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(data) > characterCardMaxSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "character card is too large"})
+			return
+		}
+
+		card, err := parseCharacterCard(data)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := models.CreateCharacterCard(db, card); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, card)
+	}
+}
+
+// CharacterAvatarHandler serves the image a character card was imported from
+func CharacterAvatarHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		avatar, err := models.GetCharacterAvatar(db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(avatar) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "character has no avatar"})
+			return
+		}
+		c.Header("Cache-Control", "private, max-age=86400")
+		c.Data(http.StatusOK, "image/png", avatar)
+	}
+}
+
+// DeleteCharacterHandler deletes a character card; chats playing it keep
+// their messages
+func DeleteCharacterHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := models.DeleteCharacterCard(db, c.Param("id")); err != nil {
+			if err.Error() == "character card not found" {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "character card deleted"})
+	}
+}
+
+// resolveCharacterID checks that a character card exists, returning nil
+// for an empty ID
+func resolveCharacterID(db *sql.DB, id string) (*models.CharacterCard, []FieldError, error) {
+	if id == "" {
+		return nil, nil, nil
+	}
+	card, err := models.GetCharacterCard(db, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if card == nil {
+		return nil, []FieldError{{Field: "character_id", Message: "character card not found"}}, nil
+	}
+	return card, nil, nil
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+)
+
+// TimezoneHeader lets clients send their IANA timezone with chat requests;
+// the locale is taken from Accept-Language
+const TimezoneHeader = "X-Timezone"
+
+// localePattern matches BCP 47 style language tags such as "en", "de-DE"
+// and "zh-Hant-TW"
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(?:[-_][A-Za-z0-9]{2,8})*$`)
+
+// dateContextVariables are the template variables expanded in system
+// messages when date context is enabled
+var dateContextVariables = []string{"{{date}}", "{{time}}", "{{datetime}}", "{{weekday}}", "{{timezone}}", "{{locale}}"}
+
+// validateLocale checks a locale tag; empty is allowed
+func validateLocale(locale string) error {
+	if locale != "" && !localePattern.MatchString(locale) {
+		return fmt.Errorf("invalid locale %q, expected a language tag such as \"en-US\"", locale)
+	}
+	return nil
+}
+
+// validateTimezone checks an IANA timezone name; empty is allowed
+func validateTimezone(timezone string) error {
+	if timezone == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q, expected an IANA name such as \"Europe/Berlin\"", timezone)
+	}
+	return nil
+}
+
+// applyLocaleHeaders fills the request's locale and timezone from the
+// Accept-Language and X-Timezone headers when the body doesn't set them
+func applyLocaleHeaders(c *gin.Context, req *ChatPipelineRequest) {
+	if req.Locale == "" {
+		lang := c.GetHeader("Accept-Language")
+		lang, _, _ = strings.Cut(lang, ",")
+		lang, _, _ = strings.Cut(lang, ";")
+		if lang = strings.TrimSpace(lang); lang != "*" && localePattern.MatchString(lang) {
+			req.Locale = lang
+		}
+	}
+	if req.Timezone == "" {
+		req.Timezone = strings.TrimSpace(c.GetHeader(TimezoneHeader))
+	}
+}
+
+// validateDateContext checks the resolved locale and timezone
+func validateDateContext(req *ChatPipelineRequest) []FieldError {
+	var errs []FieldError
+	if err := validateLocale(req.Locale); err != nil {
+		errs = append(errs, FieldError{Field: "locale", Message: err.Error()})
+	}
+	if err := validateTimezone(req.Timezone); err != nil {
+		errs = append(errs, FieldError{Field: "timezone", Message: err.Error()})
+	}
+	return errs
+}
+
+// injectDateContext gives the model the current date and time when the
+// request enables it. Template variables in system messages are expanded;
+// if no system message uses them, a line with the date, time and locale is
+// added to the system prompt instead.
+func injectDateContext(req *ChatPipelineRequest, now time.Time) {
+	if req.InjectDateTime == nil || !*req.InjectDateTime {
+		return
+	}
+
+	loc := time.UTC
+	if req.Timezone != "" {
+		if l, err := time.LoadLocation(req.Timezone); err == nil {
+			loc = l
+		}
+	}
+	now = now.In(loc)
+
+	replacer := strings.NewReplacer(
+		"{{date}}", now.Format("2006-01-02"),
+		"{{time}}", now.Format("15:04"),
+		"{{datetime}}", now.Format("2006-01-02 15:04 MST"),
+		"{{weekday}}", now.Weekday().String(),
+		"{{timezone}}", loc.String(),
+		"{{locale}}", req.Locale,
+	)
+
+	expanded := false
+	messages := make([]api.Message, len(req.Messages))
+	copy(messages, req.Messages)
+	for i, m := range messages {
+		if m.Role != "system" || !containsAny(m.Content, dateContextVariables) {
+			continue
+		}
+		messages[i].Content = replacer.Replace(m.Content)
+		expanded = true
+	}
+
+	if !expanded {
+		line := fmt.Sprintf("Current date and time: %s, %s (%s).",
+			now.Weekday(), now.Format("2006-01-02 15:04"), loc.String())
+		if req.Locale != "" {
+			line += " The user's locale is " + req.Locale + "."
+		}
+
+		if i := firstSystemMessage(messages); i >= 0 {
+			messages[i].Content = strings.TrimRight(messages[i].Content, "\n") + "\n\n" + line
+		} else {
+			messages = append([]api.Message{{Role: "system", Content: line}}, messages...)
+		}
+	}
+	req.Messages = messages
+}
+
+// containsAny reports whether s contains any of the substrings
+func containsAny(s string, subs []string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstSystemMessage returns the index of the first system message, or -1
+func firstSystemMessage(messages []api.Message) int {
+	for i, m := range messages {
+		if m.Role == "system" {
+			return i
+		}
+	}
+	return -1
+}
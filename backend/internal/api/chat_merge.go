@@ -0,0 +1,88 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"vessel-backend/internal/models"
+)
+
+// MergeChatRequest is the request body for merging a branch, or another
+// chat, into a chat's thread. Exactly one of BranchID and SourceChatID is set.
+type MergeChatRequest struct {
+	// BranchID is the last message of the branch to merge
+	BranchID string `json:"branch_id,omitempty"`
+	// SourceChatID names a chat to append; it is deleted once its messages
+	// have moved
+	SourceChatID string `json:"source_chat_id,omitempty"`
+	// TargetID is the last message of the thread to merge into; empty uses
+	// the main thread, which follows the first sibling at every fork
+	TargetID string `json:"target_id,omitempty"`
+}
+
+// MergeChatHandler consolidates a chat: it moves an exploratory branch onto
+// the end of the main thread (or another thread), or appends another chat.
+// Messages are re-parented in one transaction and keep their IDs.
+func MergeChatHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		var req MergeChatRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+		switch {
+		case req.BranchID == "" && req.SourceChatID == "":
+			respondValidationError(c, []FieldError{{Field: "branch_id", Message: "branch_id or source_chat_id is required"}})
+			return
+		case req.BranchID != "" && req.SourceChatID != "":
+			respondValidationError(c, []FieldError{{Field: "source_chat_id", Message: "cannot be combined with branch_id"}})
+			return
+		case req.SourceChatID == id:
+			respondValidationError(c, []FieldError{{Field: "source_chat_id", Message: "cannot append a chat to itself"}})
+			return
+		}
+
+		chat, err := models.GetChatMetadata(db, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if chat == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "chat not found"})
+			return
+		}
+
+		var moved int
+		if req.BranchID != "" {
+			moved, err = models.MergeBranch(db, id, req.BranchID, req.TargetID)
+		} else {
+			moved, err = models.AppendChat(db, id, req.SourceChatID, req.TargetID)
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrNothingToMerge):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			case err.Error() == "chat not found" || err.Error() == "message not found":
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		chat, err = models.GetChat(db, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"chat":  chat,
+			"moved": moved,
+		})
+	}
+}
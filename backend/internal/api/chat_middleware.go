@@ -0,0 +1,219 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+)
+
+// ChatMiddleware is a step of the chat pipeline. The configured middlewares
+// run in order around every chat: PrepareChat adjusts the request once it
+// has been validated, ObserveChunk sees each response chunk as it arrives and
+// FinishChat post-processes the complete reply before it is returned, saved
+// or cached. Embed ChatMiddlewareBase to implement only some of the stages.
+type ChatMiddleware interface {
+	Name() string
+	// PrepareChat may modify the request; an error rejects the chat
+	PrepareChat(ctx context.Context, req *ChatPipelineRequest) error
+	// ObserveChunk is called from the streaming goroutine and must not block
+	ObserveChunk(req *ChatPipelineRequest, resp api.ChatResponse)
+	// FinishChat may replace the reply; an error withholds it
+	FinishChat(ctx context.Context, req *ChatPipelineRequest, msg *api.Message) error
+}
+
+// ChatMiddlewareBase implements every ChatMiddleware stage as a no-op
+type ChatMiddlewareBase struct{}
+
+func (ChatMiddlewareBase) PrepareChat(context.Context, *ChatPipelineRequest) error { return nil }
+func (ChatMiddlewareBase) ObserveChunk(*ChatPipelineRequest, api.ChatResponse)     {}
+func (ChatMiddlewareBase) FinishChat(context.Context, *ChatPipelineRequest, *api.Message) error {
+	return nil
+}
+
+// ChatRejectedError is returned by a middleware to reject a chat with a
+// specific HTTP status; other errors are reported as internal errors
+type ChatRejectedError struct {
+	Status  int
+	Message string
+}
+
+func (e *ChatRejectedError) Error() string {
+	return e.Message
+}
+
+// policyDeniedError is a denial by a policy hook
+type policyDeniedError struct {
+	Stage  HookStage
+	Result *HookResult
+}
+
+func (e *policyDeniedError) Error() string {
+	return policyDeniedMessage(e.Stage, e.Result)
+}
+
+// ChatMiddlewareFactory creates a middleware for an Ollama service
+type ChatMiddlewareFactory func(s *OllamaService) ChatMiddleware
+
+// DefaultChatMiddleware is the middleware order used when none is configured
+var DefaultChatMiddleware = []string{"seed", "images", "urls", "character", "language", "datetime", "policy"}
+
+var (
+	chatMiddlewareMu       sync.Mutex
+	chatMiddlewareRegistry = map[string]ChatMiddlewareFactory{
+		"seed":      func(*OllamaService) ChatMiddleware { return seedMiddleware{} },
+		"images":    func(s *OllamaService) ChatMiddleware { return imageMiddleware{s: s} },
+		"urls":      func(s *OllamaService) ChatMiddleware { return urlContextMiddleware{s: s} },
+		"character": func(s *OllamaService) ChatMiddleware { return characterMiddleware{s: s} },
+		"language":  func(*OllamaService) ChatMiddleware { return languageMiddleware{} },
+		"datetime":  func(*OllamaService) ChatMiddleware { return dateContextMiddleware{} },
+		"policy":    func(s *OllamaService) ChatMiddleware { return policyMiddleware{s: s} },
+	}
+)
+
+// RegisterChatMiddleware makes a middleware available under name, so it can
+// be listed in the configured order. It must be called before the routes
+// are set up.
+func RegisterChatMiddleware(name string, factory ChatMiddlewareFactory) {
+	chatMiddlewareMu.Lock()
+	defer chatMiddlewareMu.Unlock()
+	chatMiddlewareRegistry[name] = factory
+}
+
+// ValidateChatMiddleware checks that every name in a middleware order is
+// registered and listed once
+func ValidateChatMiddleware(names []string) error {
+	chatMiddlewareMu.Lock()
+	defer chatMiddlewareMu.Unlock()
+
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, ok := chatMiddlewareRegistry[name]; !ok {
+			known := make([]string, 0, len(chatMiddlewareRegistry))
+			for k := range chatMiddlewareRegistry {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return fmt.Errorf("unknown chat middleware %q (available: %v)", name, known)
+		}
+		if seen[name] {
+			return fmt.Errorf("chat middleware %q is listed twice", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// setChatMiddleware builds the service's middleware chain in the given
+// order; an empty order uses DefaultChatMiddleware
+func (s *OllamaService) setChatMiddleware(names []string) error {
+	if len(names) == 0 {
+		names = DefaultChatMiddleware
+	}
+	if err := ValidateChatMiddleware(names); err != nil {
+		return err
+	}
+
+	chatMiddlewareMu.Lock()
+	defer chatMiddlewareMu.Unlock()
+	chain := make([]ChatMiddleware, 0, len(names))
+	for _, name := range names {
+		chain = append(chain, chatMiddlewareRegistry[name](s))
+	}
+	s.middleware = chain
+	return nil
+}
+
+// chatMiddlewareNames lists the middleware chain in order
+func (s *OllamaService) chatMiddlewareNames() []string {
+	names := make([]string, 0, len(s.middleware))
+	for _, m := range s.middleware {
+		names = append(names, m.Name())
+	}
+	return names
+}
+
+// prepareChat runs the PrepareChat stage of every middleware in order,
+// stopping at the first error
+func (s *OllamaService) prepareChat(ctx context.Context, req *ChatPipelineRequest) error {
+	for _, m := range s.middleware {
+		if err := m.PrepareChat(ctx, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// observeChunk passes a response chunk to every middleware
+func (s *OllamaService) observeChunk(req *ChatPipelineRequest, resp api.ChatResponse) {
+	for _, m := range s.middleware {
+		m.ObserveChunk(req, resp)
+	}
+}
+
+// finishChat runs the FinishChat stage of every middleware in order on the
+// reply, stopping at the first error
+func (s *OllamaService) finishChat(ctx context.Context, req *ChatPipelineRequest, msg *api.Message) error {
+	for _, m := range s.middleware {
+		if err := m.FinishChat(ctx, req, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// respondChatMiddlewareError writes the response for a chat a middleware
+// rejected
+func respondChatMiddlewareError(c *gin.Context, err error) {
+	var denied *policyDeniedError
+	var rejected *ChatRejectedError
+	switch {
+	case errors.As(err, &denied):
+		respondPolicyDenied(c, denied.Stage, denied.Result)
+	case errors.As(err, &rejected):
+		c.JSON(rejected.Status, gin.H{"error": rejected.Message})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// dateContextMiddleware gives the model the current date and time when the
+// request asks for it (see injectDateContext)
+type dateContextMiddleware struct {
+	ChatMiddlewareBase
+}
+
+func (dateContextMiddleware) Name() string { return "datetime" }
+
+func (dateContextMiddleware) PrepareChat(_ context.Context, req *ChatPipelineRequest) error {
+	injectDateContext(req, time.Now())
+	return nil
+}
+
+// policyMiddleware runs the configured policy hooks on prompts and replies
+type policyMiddleware struct {
+	ChatMiddlewareBase
+	s *OllamaService
+}
+
+func (policyMiddleware) Name() string { return "policy" }
+
+func (m policyMiddleware) PrepareChat(ctx context.Context, req *ChatPipelineRequest) error {
+	if denied := m.s.applyPreHooks(ctx, req); denied != nil {
+		return &policyDeniedError{Stage: HookStagePre, Result: denied}
+	}
+	return nil
+}
+
+func (m policyMiddleware) FinishChat(ctx context.Context, req *ChatPipelineRequest, msg *api.Message) error {
+	if _, denied := m.s.applyPostHooks(ctx, req.ChatID, &req.ChatRequest, msg); denied != nil {
+		return &policyDeniedError{Stage: HookStagePost, Result: denied}
+	}
+	return nil
+}
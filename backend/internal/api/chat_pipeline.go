@@ -0,0 +1,450 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/i18n"
+	"vessel-backend/internal/models"
+)
+
+// errChatNotFound is returned when a request references a chat that doesn't exist
+var errChatNotFound = errors.New("chat not found")
+
+// errModelPinned is returned when a request asks for a model other than the
+// one its chat is pinned to
+var errModelPinned = errors.New("chat is pinned to a different model")
+
+// ModelUnavailableError is returned when a chat's pinned model isn't
+// installed on the backend
+type ModelUnavailableError struct {
+	Model        string   `json:"model"`
+	Backend      string   `json:"backend"`
+	Alternatives []string `json:"alternatives"`
+}
+
+func (e *ModelUnavailableError) Error() string {
+	return fmt.Sprintf("model %q is not available on %s", e.Model, e.Backend)
+}
+
+// respondModelUnavailable writes a 409 response listing alternative models
+func respondModelUnavailable(c *gin.Context, e *ModelUnavailableError) {
+	c.JSON(http.StatusConflict, gin.H{
+		"error":        e.Error(),
+		"model":        e.Model,
+		"backend":      e.Backend,
+		"alternatives": e.Alternatives,
+		"suggestion":   suggest(c, i18n.SuggestPullModel, e.Model),
+	})
+}
+
+// ChatPipelineRequest extends Ollama's chat request with Vessel-specific fields.
+// Ollama ignores unknown fields, so plain Ollama requests remain valid.
+type ChatPipelineRequest struct {
+	api.ChatRequest
+
+	// ChatID links the request to a stored chat so per-chat settings apply
+	ChatID string `json:"chat_id,omitempty"`
+	// Persist saves the streamed reply to the chat server-side once it
+	// completes, even if the client disconnected
+	Persist bool `json:"persist,omitempty"`
+	// ParentID is the message the persisted reply answers
+	ParentID *string `json:"parent_id,omitempty"`
+	// ContinueMessageID names the stored assistant message that a trailing
+	// assistant message (a prefill) was taken from. The persisted reply is
+	// appended to that message instead of becoming a new sibling.
+	ContinueMessageID string `json:"continue_message_id,omitempty"`
+	// N requests several candidate completions. N > 1 returns a single
+	// ChatChoicesResponse and is never persisted.
+	N int `json:"n,omitempty"`
+	// NoCache bypasses the completion cache for deterministic requests
+	NoCache bool `json:"no_cache,omitempty"`
+	// Locale and Timezone describe the user; unset values come from the
+	// Accept-Language and X-Timezone headers, the chat, then the defaults
+	Locale   string `json:"locale,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+	// InjectDateTime gives the model the current date and time (see
+	// injectDateContext); unset follows the chat, then the defaults
+	InjectDateTime *bool `json:"inject_datetime,omitempty"`
+	// ExpandURLs fetches the pages linked in the last user message into
+	// the model's context (see expandURLs); unset follows the chat
+	ExpandURLs *bool `json:"expand_urls,omitempty"`
+	// CharacterID plays a character card (see characterPrompt); unset
+	// follows the chat. UserName stands in for {{user}} in the card.
+	CharacterID string `json:"character_id,omitempty"`
+	UserName    string `json:"user_name,omitempty"`
+	// Language makes the model reply in a language; unset follows the chat
+	// (see TranslateChatRequest)
+	Language string `json:"language,omitempty"`
+	// StreamFormat is the wire format of a streamed reply: ollama (the
+	// default) or delta (see StreamEvent)
+	StreamFormat string `json:"stream_format,omitempty"`
+
+	// usageKey is the API key identity token usage is counted against
+	usageKey string
+	// generatedSeed is set when the seed middleware picked the seed
+	generatedSeed bool
+	// imageProcessing records what the image middleware did
+	imageProcessing *ImageProcessing
+	// urlContext records the linked pages the urls middleware fetched
+	urlContext []URLSnippet
+	// sources records the layer each setting came from (see
+	// EffectiveConfig.Sources)
+	sources map[string]string
+}
+
+// prepareChatRequest applies stored settings and validates the request,
+// writing an error response and returning false if it can't be dispatched
+func (s *OllamaService) prepareChatRequest(c *gin.Context, req *ChatPipelineRequest) bool {
+	// Fail fast while the backend's circuit is open
+	if retryAt := s.breaker.RetryAfter(); !retryAt.IsZero() && time.Now().Before(retryAt) {
+		respondCircuitOpen(c, "ollama", retryAt)
+		return false
+	}
+
+	applyLocaleHeaders(c, req)
+	if err := s.applyChatSettings(c.Request.Context(), req); err != nil {
+		respondChatSettingsError(c, err)
+		return false
+	}
+	if s.pullOnDemand {
+		if err := s.pullModelOnDemand(c.Request.Context(), req.Model); err != nil {
+			respondChatSettingsError(c, err)
+			return false
+		}
+	}
+
+	// Reject malformed requests before they reach Ollama
+	fieldErrs := append(validateChatRequest(&req.ChatRequest), validateChoices(req.N)...)
+	fieldErrs = append(fieldErrs, s.validatePrefill(req)...)
+	fieldErrs = append(fieldErrs, validateDateContext(req)...)
+	if !validStreamFormat(req.StreamFormat) {
+		fieldErrs = append(fieldErrs, FieldError{Field: "stream_format", Message: "must be ollama or delta"})
+	}
+	if len(fieldErrs) > 0 {
+		respondValidationError(c, fieldErrs)
+		return false
+	}
+	if !s.checkModelLicense(c, req.Model) {
+		return false
+	}
+
+	if !s.checkTokenBudgets(c, req) {
+		return false
+	}
+
+	if err := s.prepareChat(c.Request.Context(), req); err != nil {
+		respondChatMiddlewareError(c, err)
+		return false
+	}
+	if req.imageProcessing != nil {
+		c.Header(ImageProcessingHeader, req.imageProcessing.String())
+	}
+
+	return true
+}
+
+// respondChatSettingsError writes the response for a request whose chat
+// settings couldn't be applied
+func respondChatSettingsError(c *gin.Context, err error) {
+	var unavailable *ModelUnavailableError
+	var conflict *VRAMConflictError
+	switch {
+	case errors.Is(err, errChatNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errModelPinned):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.As(err, &unavailable):
+		respondModelUnavailable(c, unavailable)
+	case errors.As(err, &conflict):
+		respondVRAMConflict(c, conflict)
+	case errors.Is(err, errModelPullFailed):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// assistantPrefill returns the content of a trailing assistant message.
+// Ollama continues such a message instead of starting a new reply, and
+// streams only the continuation.
+func assistantPrefill(req *api.ChatRequest) (string, bool) {
+	if len(req.Messages) == 0 {
+		return "", false
+	}
+	last := req.Messages[len(req.Messages)-1]
+	if last.Role != "assistant" {
+		return "", false
+	}
+	return last.Content, true
+}
+
+// validatePrefill checks a trailing assistant message and the stored
+// message it continues
+func (s *OllamaService) validatePrefill(req *ChatPipelineRequest) []FieldError {
+	prefill, ok := assistantPrefill(&req.ChatRequest)
+	if ok && prefill == "" && len(req.Messages[len(req.Messages)-1].ToolCalls) == 0 {
+		return []FieldError{{
+			Field:   fmt.Sprintf("messages[%d].content", len(req.Messages)-1),
+			Message: "a trailing assistant message is continued and must not be empty",
+		}}
+	}
+	if req.ContinueMessageID == "" {
+		return nil
+	}
+
+	switch {
+	case !ok:
+		return []FieldError{{Field: "continue_message_id", Message: "the last message must be the assistant message to continue"}}
+	case req.ChatID == "" || s.db == nil:
+		return []FieldError{{Field: "continue_message_id", Message: "chat_id is required to continue a stored message"}}
+	}
+	msg, err := models.GetMessage(s.db, req.ChatID, req.ContinueMessageID)
+	if err != nil || msg == nil || msg.Role != "assistant" {
+		return []FieldError{{Field: "continue_message_id", Message: "assistant message not found in this chat"}}
+	}
+	return nil
+}
+
+// applyChatSettings fills request fields the client left unset from the
+// settings stored on the linked chat, then from the global inference
+// defaults, recording where each setting came from
+func (s *OllamaService) applyChatSettings(ctx context.Context, req *ChatPipelineRequest) error {
+	recordRequestSources(req)
+	if req.ChatID == "" || s.db == nil {
+		if req.Model == "" {
+			req.Model = s.defaultModel
+			req.setSource("model", ConfigSourceServer)
+		}
+	} else if err := s.applyStoredChatSettings(ctx, req); err != nil {
+		return err
+	}
+
+	// Global defaults are the base layer: they only fill what the request
+	// and chat left unset
+	if s.db != nil {
+		defaults, err := models.GetInferenceDefaults(s.db)
+		if err != nil {
+			return err
+		}
+		recordDefaultsSources(req, defaults)
+		applyInferenceDefaults(&req.ChatRequest, defaults)
+		applyDateContextDefaults(req, defaults)
+	}
+
+	return nil
+}
+
+// applyStoredChatSettings applies the model, keep_alive, locale, timezone,
+// date context setting, character card and language stored on the linked
+// chat
+func (s *OllamaService) applyStoredChatSettings(ctx context.Context, req *ChatPipelineRequest) error {
+	chat, err := models.GetChatMetadata(s.db, req.ChatID)
+	if err != nil {
+		return err
+	}
+	if chat == nil {
+		return errChatNotFound
+	}
+
+	// The chat's model is pinned: requests can't silently switch to another one
+	if chat.Model != "" {
+		if req.Model != "" && !sameModel(req.Model, chat.Model) {
+			return fmt.Errorf("%w: chat uses %q, migrate it to use %q", errModelPinned, chat.Model, req.Model)
+		}
+		if req.Model == "" {
+			req.setSource("model", ConfigSourceChat)
+		}
+		req.Model = chat.Model
+		// With pull on demand, the missing model is pulled once the
+		// request is dispatched instead
+		if !s.pullOnDemand {
+			if err := s.ensureModelAvailable(ctx, chat.Model); err != nil {
+				return err
+			}
+		}
+	} else if req.Model == "" {
+		req.Model = s.defaultModel
+		req.setSource("model", ConfigSourceServer)
+	}
+
+	// An explicit keep_alive on the request always wins
+	if req.KeepAlive == nil && chat.KeepAlive != nil {
+		d, err := parseKeepAlive(*chat.KeepAlive)
+		if err != nil {
+			return fmt.Errorf("invalid keep_alive on chat: %w", err)
+		}
+		req.KeepAlive = d
+		req.setSource("keep_alive", ConfigSourceChat)
+	}
+
+	if req.Locale == "" && chat.Locale != nil {
+		req.Locale = *chat.Locale
+		req.setSource("locale", ConfigSourceChat)
+	}
+	if req.Timezone == "" && chat.Timezone != nil {
+		req.Timezone = *chat.Timezone
+		req.setSource("timezone", ConfigSourceChat)
+	}
+	if req.InjectDateTime == nil && chat.InjectDateTime != nil {
+		inject := *chat.InjectDateTime
+		req.InjectDateTime = &inject
+		req.setSource("inject_datetime", ConfigSourceChat)
+	}
+	if req.ExpandURLs == nil && chat.ExpandURLs != nil {
+		expand := *chat.ExpandURLs
+		req.ExpandURLs = &expand
+		req.setSource("expand_urls", ConfigSourceChat)
+	}
+	if req.CharacterID == "" && chat.CharacterID != nil {
+		req.CharacterID = *chat.CharacterID
+		req.setSource("character_id", ConfigSourceChat)
+	}
+	if req.Language == "" && chat.Language != nil {
+		req.Language = *chat.Language
+		req.setSource("language", ConfigSourceChat)
+	}
+
+	return nil
+}
+
+// ensureModelAvailable checks that a model is installed in Ollama, returning
+// a ModelUnavailableError listing installed alternatives if it isn't
+func (s *OllamaService) ensureModelAvailable(ctx context.Context, model string) error {
+	resp, err := s.client.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list models: %w", err)
+	}
+
+	names := make([]string, 0, len(resp.Models))
+	for _, m := range resp.Models {
+		if sameModel(m.Name, model) {
+			return nil
+		}
+		names = append(names, m.Name)
+	}
+
+	return &ModelUnavailableError{
+		Model:        model,
+		Backend:      "ollama",
+		Alternatives: rankAlternatives(model, names),
+	}
+}
+
+// sameModel compares model names, treating a missing tag as ":latest"
+func sameModel(a, b string) bool {
+	return normalizeModelName(a) == normalizeModelName(b)
+}
+
+// normalizeModelName appends the implicit ":latest" tag to bare model names
+func normalizeModelName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !strings.Contains(name[strings.LastIndex(name, "/")+1:], ":") {
+		name += ":latest"
+	}
+	return name
+}
+
+// rankAlternatives orders installed models so that other tags of the same
+// model come first, then the rest alphabetically
+func rankAlternatives(model string, installed []string) []string {
+	base := strings.SplitN(normalizeModelName(model), ":", 2)[0]
+
+	alts := append([]string{}, installed...)
+	sort.SliceStable(alts, func(i, j int) bool {
+		iSame := strings.HasPrefix(normalizeModelName(alts[i]), base+":")
+		jSame := strings.HasPrefix(normalizeModelName(alts[j]), base+":")
+		if iSame != jSame {
+			return iSame
+		}
+		return alts[i] < alts[j]
+	})
+	return alts
+}
+
+// MigrateChatModelRequest is the request body for moving a chat to another model
+type MigrateChatModelRequest struct {
+	Model string `json:"model" binding:"required"`
+}
+
+// MigrateChatModelHandler re-pins a chat to a different model after checking
+// the new model is installed
+func (s *OllamaService) MigrateChatModelHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		var req MigrateChatModelRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+			return
+		}
+
+		chat, err := models.GetChatMetadata(s.db, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if chat == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "chat not found"})
+			return
+		}
+
+		if err := s.ensureModelAvailable(c.Request.Context(), req.Model); err != nil {
+			var unavailable *ModelUnavailableError
+			if errors.As(err, &unavailable) {
+				respondModelUnavailable(c, unavailable)
+				return
+			}
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+
+		previous := chat.Model
+		chat.Model = req.Model
+		if err := models.UpdateChat(s.db, chat); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"chat":           chat,
+			"previous_model": previous,
+		})
+	}
+}
+
+// BackendInfoHandler returns the Ollama backend's configuration
+func (s *OllamaService) BackendInfoHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, s.backendInfo(c.Request.Context()))
+	}
+}
+
+// ListBackendsHandler lists the configured backends with their circuit state
+func (s *OllamaService) ListBackendsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"backends": []gin.H{s.backendInfo(c.Request.Context())}})
+	}
+}
+
+// backendInfo describes the Ollama backend, its live status and its
+// circuit breaker
+func (s *OllamaService) backendInfo(ctx context.Context) gin.H {
+	return gin.H{
+		"name":          "ollama",
+		"url":           s.ollamaURL,
+		"default_model": s.defaultModel,
+		"status":        s.backendStatus(ctx),
+		"circuit":       s.breaker.Status(),
+		"middleware":    s.chatMiddlewareNames(),
+		"warm_pool":     s.warmPoolStatus(),
+	}
+}
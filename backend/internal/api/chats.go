@@ -4,18 +4,24 @@ import (
 	"database/sql"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
 	"vessel-backend/internal/models"
 )
 
-// ListChatsHandler returns a handler for listing all chats
+// EarlierMessagesHeader reports how many messages of the thread come before
+// a page of messages
+const EarlierMessagesHeader = "X-Earlier-Messages"
+
+// ListChatsHandler returns a handler for listing all chats. project_id limits
+// the listing to a project's chats, or to unfiled chats when "none".
 func ListChatsHandler(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		includeArchived := c.Query("include_archived") == "true"
 
-		chats, err := models.ListChats(db, includeArchived)
+		chats, err := models.ListChats(db, includeArchived, c.Query("project_id"))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -50,7 +56,7 @@ func ListGroupedChatsHandler(db *sql.DB) gin.HandlerFunc {
 			}
 		}
 
-		response, err := models.ListChatsGrouped(db, search, includeArchived, limit, offset)
+		response, err := models.ListChatsGrouped(db, search, includeArchived, c.Query("project_id"), limit, offset)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -65,7 +71,13 @@ func GetChatHandler(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 
-		chat, err := models.GetChat(db, id)
+		// ?messages=false returns the chat without its messages, for clients
+		// that page through them with ListMessagesHandler
+		get := models.GetChat
+		if c.Query("messages") == "false" {
+			get = models.GetChatMetadata
+		}
+		chat, err := get(db, id)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -80,10 +92,64 @@ func GetChatHandler(db *sql.DB) gin.HandlerFunc {
 	}
 }
 
+// ListMessagesHandler returns one page of a chat's active thread, newest
+// page first: ?leaf picks the thread (default the latest message), ?before
+// is the next_cursor of the previous page and ?limit caps the page size
+// (default 50, max 500). Messages before the page are only summarized.
+func ListMessagesHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		limit := 50
+		if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 500 {
+			limit = l
+		}
+
+		chat, err := models.GetChatMetadata(db, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if chat == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "chat not found"})
+			return
+		}
+
+		page, err := models.GetMessagePage(db, id, c.Query("leaf"), c.Query("before"), limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if page == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+			return
+		}
+
+		c.Header(EarlierMessagesHeader, strconv.Itoa(page.Earlier.Count))
+		c.JSON(http.StatusOK, page)
+	}
+}
+
 // CreateChatRequest represents the request body for creating a chat
 type CreateChatRequest struct {
-	Title string `json:"title"`
-	Model string `json:"model"`
+	Title     string  `json:"title"`
+	Model     string  `json:"model"`
+	KeepAlive *string `json:"keep_alive,omitempty"`
+	ProjectID string  `json:"project_id,omitempty"`
+	// Locale, Timezone and InjectDateTime configure the chat's date context
+	Locale         *string `json:"locale,omitempty"`
+	Timezone       *string `json:"timezone,omitempty"`
+	InjectDateTime *bool   `json:"inject_datetime,omitempty"`
+	// ExpandURLs fetches the pages linked in the chat's messages into the
+	// model's context
+	ExpandURLs *bool `json:"expand_urls,omitempty"`
+	// CharacterID makes the chat play a character card. The chat is titled
+	// after the character and opens with the card's greeting: Greeting 0
+	// is its first message, 1 and up its alternate greetings, and UserName
+	// stands in for {{user}}.
+	CharacterID string `json:"character_id,omitempty"`
+	Greeting    int    `json:"greeting,omitempty"`
+	UserName    string `json:"user_name,omitempty"`
 }
 
 // CreateChatHandler returns a handler for creating a new chat
@@ -95,9 +161,51 @@ func CreateChatHandler(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
+		if req.KeepAlive != nil {
+			if err := validateKeepAlive(*req.KeepAlive); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		projectID, fieldErrs, err := resolveProjectID(db, req.ProjectID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		fieldErrs = append(fieldErrs, validateChatDateContext(req.Locale, req.Timezone)...)
+		card, cardErrs, err := resolveCharacterID(db, req.CharacterID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		fieldErrs = append(fieldErrs, cardErrs...)
+		var greeting string
+		if card != nil {
+			if greeting, err = characterGreeting(card, req.Greeting, req.UserName); err != nil {
+				fieldErrs = append(fieldErrs, FieldError{Field: "greeting", Message: err.Error()})
+			}
+		}
+		if len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+
 		chat := &models.Chat{
-			Title: req.Title,
-			Model: req.Model,
+			Title:          req.Title,
+			Model:          req.Model,
+			KeepAlive:      req.KeepAlive,
+			ProjectID:      projectID,
+			Locale:         emptyToNil(req.Locale),
+			Timezone:       emptyToNil(req.Timezone),
+			InjectDateTime: req.InjectDateTime,
+			ExpandURLs:     req.ExpandURLs,
+		}
+		if card != nil {
+			chat.CharacterID = &card.ID
+			if chat.Title == "" {
+				chat.Title = card.Name
+			}
 		}
 
 		if chat.Title == "" {
@@ -108,6 +216,14 @@ func CreateChatHandler(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		if strings.TrimSpace(greeting) != "" {
+			msg := &models.Message{ChatID: chat.ID, Role: "assistant", Content: greeting}
+			if err := models.CreateMessage(db, msg); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			chat.Messages = []models.Message{*msg}
+		}
 
 		c.JSON(http.StatusCreated, chat)
 	}
@@ -119,6 +235,25 @@ type UpdateChatRequest struct {
 	Model    *string `json:"model,omitempty"`
 	Pinned   *bool   `json:"pinned,omitempty"`
 	Archived *bool   `json:"archived,omitempty"`
+	// KeepAlive sets the chat's Ollama keep_alive; an empty string clears it
+	KeepAlive *string `json:"keep_alive,omitempty"`
+	// ProjectID moves the chat into a project; an empty string unfiles it
+	ProjectID *string `json:"project_id,omitempty"`
+	// Locale and Timezone set the chat's date context; an empty string
+	// clears them so the defaults apply
+	Locale   *string `json:"locale,omitempty"`
+	Timezone *string `json:"timezone,omitempty"`
+	// InjectDateTime overrides whether the model is given the current date
+	InjectDateTime *bool `json:"inject_datetime,omitempty"`
+	// ExpandURLs overrides whether linked pages are fetched into the
+	// model's context
+	ExpandURLs *bool `json:"expand_urls,omitempty"`
+	// CharacterID sets the character card the chat plays; an empty string
+	// clears it
+	CharacterID *string `json:"character_id,omitempty"`
+	// Language sets the language the chat replies in; an empty string
+	// clears it
+	Language *string `json:"language,omitempty"`
 }
 
 // UpdateChatHandler returns a handler for updating a chat
@@ -157,6 +292,70 @@ func UpdateChatHandler(db *sql.DB) gin.HandlerFunc {
 		if req.Archived != nil {
 			chat.Archived = *req.Archived
 		}
+		if req.KeepAlive != nil {
+			if *req.KeepAlive == "" {
+				chat.KeepAlive = nil
+			} else if err := validateKeepAlive(*req.KeepAlive); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			} else {
+				chat.KeepAlive = req.KeepAlive
+			}
+		}
+		if req.ProjectID != nil {
+			projectID, fieldErrs, err := resolveProjectID(db, *req.ProjectID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if len(fieldErrs) > 0 {
+				respondValidationError(c, fieldErrs)
+				return
+			}
+			chat.ProjectID = projectID
+		}
+		if fieldErrs := validateChatDateContext(req.Locale, req.Timezone); len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+		if req.Locale != nil {
+			chat.Locale = emptyToNil(req.Locale)
+		}
+		if req.Timezone != nil {
+			chat.Timezone = emptyToNil(req.Timezone)
+		}
+		if req.InjectDateTime != nil {
+			chat.InjectDateTime = req.InjectDateTime
+		}
+		if req.ExpandURLs != nil {
+			chat.ExpandURLs = req.ExpandURLs
+		}
+		if req.CharacterID != nil {
+			card, fieldErrs, err := resolveCharacterID(db, *req.CharacterID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if len(fieldErrs) > 0 {
+				respondValidationError(c, fieldErrs)
+				return
+			}
+			chat.CharacterID = nil
+			if card != nil {
+				chat.CharacterID = &card.ID
+			}
+		}
+		if req.Language != nil {
+			chat.Language = nil
+			if *req.Language != "" {
+				language, err := validateLanguage(*req.Language)
+				if err != nil {
+					respondValidationError(c, []FieldError{{Field: "language", Message: err.Error()}})
+					return
+				}
+				chat.Language = &language
+			}
+		}
 
 		if err := models.UpdateChat(db, chat); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -167,6 +366,30 @@ func UpdateChatHandler(db *sql.DB) gin.HandlerFunc {
 	}
 }
 
+// validateChatDateContext checks the locale and timezone set on a chat
+func validateChatDateContext(locale, timezone *string) []FieldError {
+	var errs []FieldError
+	if locale != nil {
+		if err := validateLocale(*locale); err != nil {
+			errs = append(errs, FieldError{Field: "locale", Message: err.Error()})
+		}
+	}
+	if timezone != nil {
+		if err := validateTimezone(*timezone); err != nil {
+			errs = append(errs, FieldError{Field: "timezone", Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+// emptyToNil returns nil for a nil or empty string
+func emptyToNil(s *string) *string {
+	if s == nil || *s == "" {
+		return nil
+	}
+	return s
+}
+
 // DeleteChatHandler returns a handler for deleting a chat
 func DeleteChatHandler(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -185,12 +408,56 @@ func DeleteChatHandler(db *sql.DB) gin.HandlerFunc {
 	}
 }
 
+// DuplicateChatRequest is the optional request body for duplicating a chat
+type DuplicateChatRequest struct {
+	// UpToMessageID copies only the thread leading to this message
+	UpToMessageID string `json:"up_to_message_id,omitempty"`
+	// Title names the copy; empty appends " (copy)" to the original title
+	Title string `json:"title,omitempty"`
+}
+
+// DuplicateChatHandler copies a chat, its settings, messages and attachments
+// into an independent chat, so experiments can branch off without touching
+// the original
+func DuplicateChatHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req DuplicateChatRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+				return
+			}
+		}
+
+		chat, err := models.DuplicateChat(db, c.Param("id"), req.UpToMessageID, strings.TrimSpace(req.Title))
+		if err != nil {
+			if err.Error() == "message not found" {
+				c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if chat == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "chat not found"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, chat)
+	}
+}
+
 // CreateMessageRequest represents the request body for creating a message
 type CreateMessageRequest struct {
 	ParentID     *string `json:"parent_id,omitempty"`
 	Role         string  `json:"role" binding:"required"`
 	Content      string  `json:"content" binding:"required"`
 	SiblingIndex int     `json:"sibling_index"`
+	// SettingsHash is the snapshot returned in the X-Settings-Snapshot header
+	// of the chat response that produced this message
+	SettingsHash *string `json:"settings_hash,omitempty"`
+	// Seed is the seed returned in the X-Generation-Seed header
+	Seed *int64 `json:"seed,omitempty"`
 }
 
 // CreateMessageHandler returns a handler for creating a new message
@@ -227,6 +494,8 @@ func CreateMessageHandler(db *sql.DB) gin.HandlerFunc {
 			Role:         req.Role,
 			Content:      req.Content,
 			SiblingIndex: req.SiblingIndex,
+			SettingsHash: req.SettingsHash,
+			Seed:         req.Seed,
 		}
 
 		if err := models.CreateMessage(db, msg); err != nil {
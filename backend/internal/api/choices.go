@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+)
+
+// maxChatChoices caps how many candidate completions one request may ask for
+const maxChatChoices = 8
+
+// ChatChoice is one candidate completion of an n-best request
+type ChatChoice struct {
+	Index      int          `json:"index"`
+	Message    api.Message  `json:"message"`
+	DoneReason string       `json:"done_reason,omitempty"`
+	Error      string       `json:"error,omitempty"`
+	Timings    *ChatTimings `json:"timings,omitempty"`
+	JSONRepair *JSONRepair  `json:"json_repair,omitempty"`
+	api.Metrics
+}
+
+// ChatChoicesResponse is returned for chat requests with n > 1
+type ChatChoicesResponse struct {
+	Model   string       `json:"model"`
+	Choices []ChatChoice `json:"choices"`
+	// Config is the configuration the candidates were generated with; each
+	// candidate's seed is the configured seed plus its index
+	Config *EffectiveConfig `json:"config"`
+}
+
+// validateChoices checks the requested number of candidate completions
+func validateChoices(n int) []FieldError {
+	if n < 0 || n > maxChatChoices {
+		return []FieldError{{Field: "n", Message: fmt.Sprintf("must be between 1 and %d", maxChatChoices)}}
+	}
+	return nil
+}
+
+// handleChatChoices generates n candidate completions. Ollama has no native
+// n parameter, so candidates are generated one after another. When a seed is
+// set each candidate uses seed+index so they still differ. The result is
+// always a single JSON response, whatever the stream setting.
+func (s *OllamaService) handleChatChoices(c *gin.Context, req *ChatPipelineRequest) {
+	n := req.N
+	resp := ChatChoicesResponse{Model: req.Model, Choices: make([]ChatChoice, 0, n), Config: s.effectiveConfig(req)}
+
+	failed := 0
+	for i := 0; i < n; i++ {
+		choice := s.generateChoice(c.Request.Context(), req, i)
+		if choice.Error != "" {
+			failed++
+		}
+		resp.Choices = append(resp.Choices, choice)
+
+		if c.Request.Context().Err() != nil {
+			return
+		}
+	}
+
+	if failed == n {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "chat failed: " + resp.Choices[0].Error})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// generateChoice runs one non-streaming completion for candidate index
+func (s *OllamaService) generateChoice(ctx context.Context, req *ChatPipelineRequest, index int) ChatChoice {
+	choiceReq := req.ChatRequest
+	stream := false
+	choiceReq.Stream = &stream
+
+	if seed, present, ok := optionFloat(req.Options, "seed"); present && ok {
+		opts := make(map[string]any, len(req.Options))
+		for k, v := range req.Options {
+			opts[k] = v
+		}
+		opts["seed"] = int(seed) + index
+		choiceReq.Options = opts
+	}
+
+	choice := ChatChoice{Index: index}
+	timer := newChatTimer()
+	err := s.client.Chat(ctx, &choiceReq, func(resp api.ChatResponse) error {
+		timer.observe(resp)
+		s.observeChunk(req, resp)
+		choice.Message = resp.Message
+		choice.DoneReason = resp.DoneReason
+		choice.Metrics = resp.Metrics
+		return nil
+	})
+	if err != nil {
+		choice.Error = err.Error()
+		return choice
+	}
+	choice.Timings = timer.timings(choice.Metrics)
+	s.recordTokenUsage(req, choice.Metrics)
+	if choice.DoneReason == JSONRepairLength {
+		choice.JSONRepair = repairStructuredReply(&req.ChatRequest, &choice.Message, JSONRepairLength)
+	}
+
+	// Candidates are checked individually; a denied one is reported as failed
+	if err := s.finishChat(ctx, req, &choice.Message); err != nil {
+		choice.Message = api.Message{Role: "assistant"}
+		choice.Error = err.Error()
+	}
+	return choice
+}
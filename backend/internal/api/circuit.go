@@ -0,0 +1,262 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"vessel-backend/internal/i18n"
+)
+
+// Circuit breaker defaults
+const (
+	defaultCircuitThreshold = 5
+	defaultCircuitCooldown  = 30 * time.Second
+	// maxCircuitEvents is how many state changes are kept for the listing
+	maxCircuitEvents = 20
+)
+
+// CircuitState is the state of a backend's circuit breaker
+type CircuitState string
+
+const (
+	// CircuitClosed passes requests through normally
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen rejects requests immediately until the cooldown ends
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a single probe request through
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// ErrCircuitOpen is returned for requests rejected by an open circuit
+var ErrCircuitOpen = errors.New("backend circuit is open")
+
+// CircuitEvent records a circuit state change
+type CircuitEvent struct {
+	From   CircuitState `json:"from"`
+	To     CircuitState `json:"to"`
+	Reason string       `json:"reason,omitempty"`
+	At     time.Time    `json:"at"`
+}
+
+// CircuitStatus is the listing view of a circuit breaker
+type CircuitStatus struct {
+	State               CircuitState   `json:"state"`
+	ConsecutiveFailures int            `json:"consecutive_failures"`
+	Threshold           int            `json:"threshold"`
+	CooldownSeconds     float64        `json:"cooldown_seconds"`
+	RetryAfter          *time.Time     `json:"retry_after,omitempty"`
+	LastError           string         `json:"last_error,omitempty"`
+	Events              []CircuitEvent `json:"events"`
+}
+
+// CircuitBreaker stops sending requests to a backend after repeated failures.
+// Once the cooldown passes, one probe request is let through: success closes
+// the circuit, failure opens it again.
+type CircuitBreaker struct {
+	name string
+
+	mu        sync.Mutex
+	state     CircuitState
+	failures  int
+	threshold int
+	cooldown  time.Duration
+	openedAt  time.Time
+	probing   bool
+	lastError string
+	events    []CircuitEvent
+	// onTransition, when set, is told about every state change
+	onTransition func(CircuitEvent)
+}
+
+// NewCircuitBreaker creates a closed circuit breaker with default limits
+func NewCircuitBreaker(name string) *CircuitBreaker {
+	return &CircuitBreaker{
+		name:      name,
+		state:     CircuitClosed,
+		threshold: defaultCircuitThreshold,
+		cooldown:  defaultCircuitCooldown,
+		events:    []CircuitEvent{},
+	}
+}
+
+// SetLimits changes the failure threshold and cooldown; zero values keep
+// the current setting
+func (cb *CircuitBreaker) SetLimits(threshold int, cooldown time.Duration) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if threshold > 0 {
+		cb.threshold = threshold
+	}
+	if cooldown > 0 {
+		cb.cooldown = cooldown
+	}
+}
+
+// OnTransition sets a function told about every state change. It is called
+// with the breaker locked and must not call back into it.
+func (cb *CircuitBreaker) OnTransition(fn func(CircuitEvent)) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.onTransition = fn
+}
+
+// Allow reports whether a request may be sent. When the cooldown of an open
+// circuit has passed, the first caller becomes the half-open probe.
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if time.Since(cb.openedAt) < cb.cooldown {
+			return false
+		}
+		cb.transition(CircuitHalfOpen, "cooldown elapsed")
+		cb.probing = true
+		return true
+	case CircuitHalfOpen:
+		if cb.probing {
+			return false
+		}
+		cb.probing = true
+		return true
+	}
+	return true
+}
+
+// RecordSuccess closes the circuit and resets the failure count
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures = 0
+	cb.probing = false
+	if cb.state != CircuitClosed {
+		cb.transition(CircuitClosed, "probe succeeded")
+	}
+}
+
+// RecordFailure counts a failure, opening the circuit at the threshold or
+// when a half-open probe fails
+func (cb *CircuitBreaker) RecordFailure(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures++
+	cb.lastError = err.Error()
+	cb.probing = false
+
+	switch {
+	case cb.state == CircuitHalfOpen:
+		cb.openedAt = time.Now()
+		cb.transition(CircuitOpen, "probe failed: "+cb.lastError)
+	case cb.state == CircuitClosed && cb.failures >= cb.threshold:
+		cb.openedAt = time.Now()
+		cb.transition(CircuitOpen, fmt.Sprintf("%d consecutive failures: %s", cb.failures, cb.lastError))
+	}
+}
+
+// releaseProbe frees the half-open probe slot without changing state
+func (cb *CircuitBreaker) releaseProbe() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.probing = false
+}
+
+// RetryAfter returns when an open circuit will accept a probe, or zero if
+// requests are currently allowed
+func (cb *CircuitBreaker) RetryAfter() time.Time {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state != CircuitOpen {
+		return time.Time{}
+	}
+	return cb.openedAt.Add(cb.cooldown)
+}
+
+// Status returns a snapshot of the breaker for listings
+func (cb *CircuitBreaker) Status() CircuitStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	status := CircuitStatus{
+		State:               cb.state,
+		ConsecutiveFailures: cb.failures,
+		Threshold:           cb.threshold,
+		CooldownSeconds:     cb.cooldown.Seconds(),
+		LastError:           cb.lastError,
+		Events:              append([]CircuitEvent{}, cb.events...),
+	}
+	if cb.state == CircuitOpen {
+		retry := cb.openedAt.Add(cb.cooldown)
+		status.RetryAfter = &retry
+	}
+	return status
+}
+
+// transition changes state and records the event; callers hold cb.mu
+func (cb *CircuitBreaker) transition(to CircuitState, reason string) {
+	event := CircuitEvent{From: cb.state, To: to, Reason: reason, At: time.Now().UTC()}
+	cb.state = to
+
+	cb.events = append(cb.events, event)
+	if len(cb.events) > maxCircuitEvents {
+		cb.events = cb.events[len(cb.events)-maxCircuitEvents:]
+	}
+	log.Printf("[Circuit] %s: %s -> %s (%s)", cb.name, event.From, event.To, reason)
+	if cb.onTransition != nil {
+		cb.onTransition(event)
+	}
+}
+
+// circuitTransport fails requests fast while the breaker is open and feeds
+// the outcome of every other request back into it. Connection errors and 5xx
+// responses count as failures; cancelled requests count as neither.
+type circuitTransport struct {
+	breaker *CircuitBreaker
+	next    http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *circuitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.breaker.Allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	switch {
+	case err != nil && (errors.Is(err, context.Canceled) || req.Context().Err() != nil):
+		// The caller gave up; that says nothing about the backend
+		t.breaker.releaseProbe()
+	case err != nil:
+		t.breaker.RecordFailure(err)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		t.breaker.RecordFailure(fmt.Errorf("status %d", resp.StatusCode))
+	default:
+		t.breaker.RecordSuccess()
+	}
+	return resp, err
+}
+
+// respondCircuitOpen writes a 503 telling the client when to retry
+func respondCircuitOpen(c *gin.Context, backend string, retryAt time.Time) {
+	seconds := int(time.Until(retryAt).Seconds()) + 1
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error":       backend + " is unavailable after repeated failures",
+		"backend":     backend,
+		"retry_after": retryAt.UTC(),
+		"suggestion":  suggest(c, i18n.SuggestBackendDown, seconds),
+	})
+}
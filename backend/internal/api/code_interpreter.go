@@ -0,0 +1,546 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"maps"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/models"
+)
+
+// Code interpreter sandboxes
+const (
+	// CodeInterpreterOff disables the code interpreter
+	CodeInterpreterOff = "off"
+	// CodeInterpreterSubprocess runs snippets as a local subprocess with
+	// resource limits only: snippets can reach the network and read what the
+	// server can, so it must be chosen explicitly
+	CodeInterpreterSubprocess = "subprocess"
+	// CodeInterpreterContainer runs snippets in a throwaway Docker or Podman
+	// container without network access
+	CodeInterpreterContainer = "container"
+	// CodeInterpreterAuto uses a container when a container runtime is
+	// installed, and leaves the interpreter off otherwise
+	CodeInterpreterAuto = "auto"
+)
+
+// ValidCodeInterpreterMode reports whether mode is a known sandbox
+func ValidCodeInterpreterMode(mode string) bool {
+	switch mode {
+	case CodeInterpreterOff, CodeInterpreterSubprocess, CodeInterpreterContainer, CodeInterpreterAuto:
+		return true
+	}
+	return false
+}
+
+// Limits applied to every snippet
+const (
+	// codeDefaultTimeout and codeMaxTimeout bound a snippet's wall time
+	codeDefaultTimeout = 10 * time.Second
+	codeMaxTimeout     = 60 * time.Second
+	// codeMemoryLimit caps a snippet's memory
+	codeMemoryLimit = 512 * 1024 * 1024
+	// codeFileSizeLimit caps each file a snippet writes
+	codeFileSizeLimit = 16 * 1024 * 1024
+	// codeMaxAttachments and codeMaxAttachmentSize bound the files returned
+	codeMaxAttachments    = 8
+	codeMaxAttachmentSize = 5 * 1024 * 1024
+)
+
+// DefaultCodePythonImage is the container image Python snippets run in
+// unless configured otherwise. Containers have no network, so the image must
+// already ship the libraries snippets use; this one includes matplotlib,
+// numpy, pandas and scipy.
+const DefaultCodePythonImage = "quay.io/jupyter/scipy-notebook:python-3.12"
+
+// codeContainerImages are the default images snippets run in, per language
+var codeContainerImages = map[string]string{
+	"python":     DefaultCodePythonImage,
+	"javascript": "node:22-slim",
+}
+
+// codePythonRunner runs main.py after registering a hook that saves the
+// matplotlib figures a snippet leaves open, so plots come back as
+// attachments without the snippet saving them. Compiling the file keeps
+// its line numbers in tracebacks.
+const codePythonRunner = `import atexit, sys
+def _vessel_save_figures():
+    plt = sys.modules.get("matplotlib.pyplot")
+    if plt is None:
+        return
+    for i, num in enumerate(plt.get_fignums()):
+        plt.figure(num).savefig("figure_%d.png" % (i + 1))
+atexit.register(_vessel_save_figures)
+exec(compile(open("main.py").read(), "main.py", "exec"), {"__name__": "__main__"})
+`
+
+// tool returns the Ollama tool definition that lets a model run code
+// through the interpreter, describing the sandbox actually in use
+func (ci *CodeInterpreter) tool() api.Tool {
+	where := "in a sandbox without network access"
+	if ci.mode == CodeInterpreterSubprocess {
+		where = "as a local process on the server"
+	}
+	return api.Tool{
+		Type: "function",
+		Function: api.ToolFunction{
+			Name: models.AgentToolCodeInterpreter,
+			Description: "Run a Python or JavaScript snippet " + where + " and return what it prints. " +
+				"Matplotlib figures and image files written to the working directory are returned as images.",
+			Parameters: api.ToolFunctionParameters{
+				Type:     "object",
+				Required: []string{"language", "code"},
+				Properties: map[string]api.ToolProperty{
+					"language": {Type: api.PropertyType{"string"}, Enum: []any{"python", "javascript"}, Description: "Language of the snippet"},
+					"code":     {Type: api.PropertyType{"string"}, Description: "The code to run; print results to stdout"},
+				},
+			},
+		},
+	}
+}
+
+// CodeInterpreter runs code snippets in a sandbox. Snippets get a fresh
+// working directory, no network in a container, and limits on wall time,
+// CPU time, memory and file size.
+type CodeInterpreter struct {
+	mode string
+	// runtime is the container CLI (docker or podman) in container mode
+	runtime string
+	// images are the container images per language
+	images map[string]string
+}
+
+// NewCodeInterpreter resolves the sandbox for a mode. Container and auto
+// modes look for a container runtime and without one leave the interpreter
+// off with an error; they never fall back to a subprocess. pythonImage
+// replaces DefaultCodePythonImage when set.
+func NewCodeInterpreter(mode, pythonImage string) (*CodeInterpreter, error) {
+	ci := &CodeInterpreter{mode: mode, images: maps.Clone(codeContainerImages)}
+	if mode == "" {
+		ci.mode = CodeInterpreterOff
+	}
+	if pythonImage != "" {
+		ci.images["python"] = pythonImage
+	}
+	if ci.mode == CodeInterpreterSubprocess {
+		log.Printf("Warning: the code interpreter runs snippets as local subprocesses; " +
+			"they are not isolated and can reach the network and read the server's data directory")
+	}
+	if ci.mode != CodeInterpreterContainer && ci.mode != CodeInterpreterAuto {
+		return ci, nil
+	}
+	for _, runtime := range []string{"docker", "podman"} {
+		if path, err := exec.LookPath(runtime); err == nil {
+			ci.mode, ci.runtime = CodeInterpreterContainer, path
+			return ci, nil
+		}
+	}
+	return &CodeInterpreter{mode: CodeInterpreterOff}, fmt.Errorf("code interpreter: no container runtime (docker or podman) found")
+}
+
+// Enabled reports whether snippets can run at all
+func (ci *CodeInterpreter) Enabled() bool {
+	return ci != nil && ci.mode != CodeInterpreterOff
+}
+
+// CodeInterpreterRequest is the request body for running a snippet
+type CodeInterpreterRequest struct {
+	// AgentID is the agent running the snippet; it must have been granted
+	// the code interpreter
+	AgentID  string `json:"agent_id"`
+	Language string `json:"language"`
+	Code     string `json:"code"`
+	// Timeout is in seconds (default 10, at most 60)
+	Timeout int `json:"timeout,omitempty"`
+	// ToolCallID is copied to the tool message, for models that match tool
+	// results to their calls
+	ToolCallID string `json:"tool_call_id,omitempty"`
+}
+
+// CodeAttachment is a file a snippet wrote, such as a plot
+type CodeAttachment struct {
+	Name     string `json:"name"`
+	MimeType string `json:"mime_type"`
+	Data     []byte `json:"data"`
+}
+
+// CodeInterpreterResult is the outcome of a snippet. ToolMessage carries it
+// back to the model: append it to the conversation after the assistant
+// message that called the tool.
+type CodeInterpreterResult struct {
+	Success     bool             `json:"success"`
+	ExitCode    int              `json:"exit_code"`
+	TimedOut    bool             `json:"timed_out,omitempty"`
+	Stdout      string           `json:"stdout"`
+	Stderr      string           `json:"stderr"`
+	Attachments []CodeAttachment `json:"attachments"`
+	Sandbox     string           `json:"sandbox"`
+	DurationMs  int64            `json:"duration_ms"`
+	ToolMessage api.Message      `json:"tool_message"`
+}
+
+// CodeInterpreterInfoHandler reports whether the code interpreter is
+// available, and returns its tool definition for chat requests
+func CodeInterpreterInfoHandler(ci *CodeInterpreter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"enabled":   ci.Enabled(),
+			"sandbox":   ci.mode,
+			"languages": []string{"python", "javascript"},
+			"tool":      ci.tool(),
+		})
+	}
+}
+
+// RunCodeHandler runs a snippet for an agent that was granted the code
+// interpreter
+func RunCodeHandler(db *sql.DB, ci *CodeInterpreter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ci.Enabled() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "the code interpreter is disabled on this server"})
+			return
+		}
+
+		var req CodeInterpreterRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+		var fieldErrs []FieldError
+		if strings.TrimSpace(req.AgentID) == "" {
+			fieldErrs = append(fieldErrs, FieldError{Field: "agent_id", Message: "agent_id is required"})
+		}
+		if _, ok := codeContainerImages[req.Language]; !ok {
+			fieldErrs = append(fieldErrs, FieldError{Field: "language", Message: "must be python or javascript"})
+		}
+		if strings.TrimSpace(req.Code) == "" {
+			fieldErrs = append(fieldErrs, FieldError{Field: "code", Message: "code is required"})
+		}
+		// Compared in seconds: converting a huge timeout to a Duration overflows
+		if req.Timeout < 0 || req.Timeout > int(codeMaxTimeout/time.Second) {
+			fieldErrs = append(fieldErrs, FieldError{Field: "timeout", Message: fmt.Sprintf("must be between 1 and %d seconds", int(codeMaxTimeout.Seconds()))})
+		}
+		if len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+
+		granted, err := models.AgentHasTool(db, req.AgentID, models.AgentToolCodeInterpreter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !granted {
+			c.JSON(http.StatusForbidden, gin.H{"error": "the agent has not been granted the code interpreter"})
+			return
+		}
+
+		timeout := codeDefaultTimeout
+		if req.Timeout > 0 {
+			timeout = time.Duration(req.Timeout) * time.Second
+		}
+		result, err := ci.Run(c.Request.Context(), req.Language, req.Code, timeout)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		result.ToolMessage.ToolCallID = req.ToolCallID
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// Run executes a snippet and collects its output and the images it wrote
+func (ci *CodeInterpreter) Run(ctx context.Context, language, code string, timeout time.Duration) (*CodeInterpreterResult, error) {
+	workDir, err := os.MkdirTemp("", "vessel-code-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+	// Containers may run as another user; let them write the directory
+	if err := os.Chmod(workDir, 0o777); err != nil {
+		return nil, fmt.Errorf("failed to prepare working directory: %w", err)
+	}
+
+	script := "main.py"
+	if language == "javascript" {
+		script = "main.js"
+	}
+	if err := os.WriteFile(filepath.Join(workDir, script), []byte(code), 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write snippet: %w", err)
+	}
+
+	if ci.mode == CodeInterpreterContainer {
+		// Pull before the snippet's clock starts, and never in offline mode
+		if err := ci.ensureImage(ctx, ci.images[language]); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	var containerName string
+	if ci.mode == CodeInterpreterContainer {
+
+		containerName = "vessel-code-" + uuid.New().String()
+		cmd = ci.containerCommand(ctx, containerName, workDir, language, script)
+	} else {
+		cmd = subprocessCommand(ctx, workDir, language, script, timeout)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = 2 * time.Second
+
+	start := time.Now()
+	runErr := cmd.Run()
+	duration := time.Since(start)
+	timedOut := ctx.Err() == context.DeadlineExceeded
+
+	if containerName != "" && ctx.Err() != nil {
+		// Killing the CLI leaves the container running
+		rm := exec.Command(ci.runtime, "rm", "-f", containerName)
+		if err := rm.Run(); err != nil {
+			log.Printf("[CodeInterpreter] Failed to remove container %s: %v", containerName, err)
+		}
+	}
+
+	exitCode := 0
+	if runErr != nil {
+		exitErr, ok := runErr.(*exec.ExitError)
+		if !ok && !timedOut {
+			return nil, fmt.Errorf("failed to run snippet: %w", runErr)
+		}
+		exitCode = -1
+		if ok {
+			exitCode = exitErr.ExitCode()
+		}
+	}
+
+	result := &CodeInterpreterResult{
+		Success:     runErr == nil,
+		ExitCode:    exitCode,
+		TimedOut:    timedOut,
+		Stdout:      truncateOutput(stdout.String()),
+		Stderr:      truncateOutput(stderr.String()),
+		Attachments: collectCodeAttachments(workDir, script),
+		Sandbox:     ci.mode,
+		DurationMs:  duration.Milliseconds(),
+	}
+	result.ToolMessage = codeToolMessage(result, timeout)
+	return result, nil
+}
+
+// subprocessCommand runs a snippet as a local subprocess. The shell applies
+// the CPU, memory and file size limits before it execs the interpreter; the
+// environment is reduced to what the interpreter needs.
+func subprocessCommand(ctx context.Context, workDir, language, script string, timeout time.Duration) *exec.Cmd {
+	limits := fmt.Sprintf("ulimit -t %d && ulimit -f %d && ulimit -n 256",
+		int(timeout.Seconds())+1, codeFileSizeLimit/512)
+	argv := []string{"python3", "-I", "-c", codePythonRunner}
+	if language == "javascript" {
+		// V8 reserves far more address space than it uses, so node gets a
+		// heap limit instead of an address space limit
+		argv = []string{"node", fmt.Sprintf("--max-old-space-size=%d", codeMemoryLimit/(1024*1024)), script}
+	} else {
+		limits += fmt.Sprintf(" && ulimit -v %d", codeMemoryLimit/1024)
+	}
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", append([]string{"-c", limits + ` && exec "$@"`, "sh"}, argv...)...)
+	cmd.Dir = workDir
+	cmd.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + workDir,
+		"TMPDIR=" + workDir,
+		"LANG=C.UTF-8",
+		"MPLBACKEND=Agg",
+		"MPLCONFIGDIR=" + workDir,
+		"PYTHONDONTWRITEBYTECODE=1",
+	}
+	sandboxProcess(cmd)
+	return cmd
+}
+
+// ensureImage pulls a container image that isn't present locally. The image
+// is never pulled in offline mode, and snippets run with --pull never so the
+// runtime can't fetch one either.
+func (ci *CodeInterpreter) ensureImage(ctx context.Context, image string) error {
+	if exec.CommandContext(ctx, ci.runtime, "image", "inspect", image).Run() == nil {
+		return nil
+	}
+	if err := checkOnline(); err != nil {
+		return fmt.Errorf("container image %s is not available locally: %w", image, err)
+	}
+	log.Printf("[CodeInterpreter] Pulling %s", image)
+	if out, err := exec.CommandContext(ctx, ci.runtime, "pull", image).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to pull %s: %w: %s", image, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// containerCommand runs a snippet in a throwaway container with no network,
+// no capabilities, a read-only root and the working directory mounted
+func (ci *CodeInterpreter) containerCommand(ctx context.Context, name, workDir, language, script string) *exec.Cmd {
+	argv := []string{"python3", "-I", "-c", codePythonRunner}
+	if language == "javascript" {
+		argv = []string{"node", script}
+	}
+	args := []string{
+		"run", "--rm", "--name", name,
+		"--pull", "never",
+		"--network", "none",
+		"--memory", strconv.Itoa(codeMemoryLimit),
+		"--cpus", "1",
+		"--pids-limit", "64",
+		"--read-only",
+		"--tmpfs", "/tmp:size=64m",
+		"--cap-drop", "ALL",
+		"--security-opt", "no-new-privileges",
+		"--ulimit", fmt.Sprintf("fsize=%d", codeFileSizeLimit),
+		"-e", "HOME=/work", "-e", "MPLBACKEND=Agg", "-e", "MPLCONFIGDIR=/tmp", "-e", "PYTHONDONTWRITEBYTECODE=1",
+		"-v", workDir + ":/work",
+		"-w", "/work",
+	}
+	if uid := os.Getuid(); uid >= 0 {
+		// Run as the server's user so it can read and remove what the
+		// snippet wrote
+		args = append(args, "--user", fmt.Sprintf("%d:%d", uid, os.Getgid()))
+	}
+	args = append(append(args, ci.images[language]), argv...)
+	return exec.CommandContext(ctx, ci.runtime, args...)
+}
+
+// codeAttachmentTypes are the files returned from a snippet's working
+// directory
+var codeAttachmentTypes = []string{".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp"}
+
+// collectCodeAttachments returns the images a snippet wrote to its working
+// directory, in name order, skipping files that are too large
+func collectCodeAttachments(workDir, script string) []CodeAttachment {
+	attachments := []CodeAttachment{}
+	entries, err := os.ReadDir(workDir)
+	if err != nil {
+		return attachments
+	}
+	for _, entry := range entries {
+		if len(attachments) == codeMaxAttachments {
+			break
+		}
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if !entry.Type().IsRegular() || entry.Name() == script || !slices.Contains(codeAttachmentTypes, ext) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.Size() > codeMaxAttachmentSize {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(workDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		attachments = append(attachments, CodeAttachment{
+			Name:     entry.Name(),
+			MimeType: mime.TypeByExtension(ext),
+			Data:     data,
+		})
+	}
+	return attachments
+}
+
+// codeToolMessage formats a snippet's outcome as a tool message. PNG and
+// JPEG attachments are passed as images so vision models can look at plots.
+func codeToolMessage(result *CodeInterpreterResult, timeout time.Duration) api.Message {
+	var b strings.Builder
+	switch {
+	case result.TimedOut:
+		fmt.Fprintf(&b, "The code timed out after %s.\n", timeout)
+	case result.Success:
+		b.WriteString("The code ran successfully.\n")
+	default:
+		fmt.Fprintf(&b, "The code failed with exit code %d.\n", result.ExitCode)
+	}
+	if s := strings.TrimRight(result.Stdout, "\n"); s != "" {
+		fmt.Fprintf(&b, "\nstdout:\n%s\n", s)
+	}
+	if s := strings.TrimRight(result.Stderr, "\n"); s != "" {
+		fmt.Fprintf(&b, "\nstderr:\n%s\n", s)
+	}
+
+	msg := api.Message{Role: "tool", ToolName: models.AgentToolCodeInterpreter}
+	var files []string
+	for _, a := range result.Attachments {
+		files = append(files, a.Name)
+		if a.MimeType == "image/png" || a.MimeType == "image/jpeg" {
+			msg.Images = append(msg.Images, api.ImageData(a.Data))
+		}
+	}
+	if len(files) > 0 {
+		fmt.Fprintf(&b, "\nFiles written: %s\n", strings.Join(files, ", "))
+	}
+	msg.Content = strings.TrimSpace(b.String())
+	return msg
+}
+
+// agentTools are the tools that can be granted to agents
+var agentTools = []string{models.AgentToolCodeInterpreter}
+
+// ListAgentToolsHandler returns the tools granted to an agent
+func ListAgentToolsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		grants, err := models.ListAgentToolGrants(db, c.Param("agentId"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"tools": grants})
+	}
+}
+
+// GrantAgentToolHandler allows an agent to use a tool
+func GrantAgentToolHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tool := c.Param("tool")
+		if !slices.Contains(agentTools, tool) {
+			respondValidationError(c, []FieldError{{Field: "tool", Message: "must be one of: " + strings.Join(agentTools, ", ")}})
+			return
+		}
+		grant, err := models.GrantAgentTool(db, c.Param("agentId"), tool)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, grant)
+	}
+}
+
+// RevokeAgentToolHandler takes a tool away from an agent
+func RevokeAgentToolHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := models.RevokeAgentTool(db, c.Param("agentId"), c.Param("tool")); err != nil {
+			if err.Error() == "tool grant not found" {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "tool revoked"})
+	}
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRunCodeRejectsOutOfRangeTimeouts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/run", RunCodeHandler(openTestDB(t), &CodeInterpreter{mode: CodeInterpreterSubprocess}))
+
+	// The largest values overflow when converted to a Duration
+	for _, timeout := range []int{-1, 61, math.MaxInt64 / 1_000_000, math.MaxInt64} {
+		body := fmt.Sprintf(`{"agent_id":"agent","language":"python","code":"print(1)","timeout":%d}`, timeout)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/run", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"timeout"`) {
+			t.Errorf("timeout %d = %d %s, want a validation error", timeout, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package api
+
+import "os/exec"
+
+// sandboxProcess leaves the snippet's process as is; process groups are
+// only set up on unix
+func sandboxProcess(cmd *exec.Cmd) {}
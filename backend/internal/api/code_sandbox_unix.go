@@ -0,0 +1,17 @@
+//go:build unix
+
+package api
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// sandboxProcess starts a snippet in its own process group, so a timeout
+// kills any processes it spawned along with it
+func sandboxProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
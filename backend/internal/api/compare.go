@@ -0,0 +1,255 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/models"
+)
+
+// maxCompareTargets caps how many backend/model pairs one comparison may run
+const maxCompareTargets = 8
+
+// CompareTarget is a single backend/model pair to run the prompt against
+type CompareTarget struct {
+	Backend string         `json:"backend,omitempty"`
+	Model   string         `json:"model"`
+	Options map[string]any `json:"options,omitempty"`
+}
+
+// CompareRequest is the request body for the comparison endpoint
+type CompareRequest struct {
+	Prompt  string          `json:"prompt"`
+	System  string          `json:"system,omitempty"`
+	Targets []CompareTarget `json:"targets"`
+	// MaxConcurrent limits how many targets run at once (0 runs all at once)
+	MaxConcurrent int `json:"max_concurrent,omitempty"`
+}
+
+// CompareMetrics holds the timing results for one target
+type CompareMetrics struct {
+	FirstTokenMs    int64   `json:"first_token_ms"`
+	TotalMs         int64   `json:"total_ms"`
+	PromptTokens    int     `json:"prompt_tokens"`
+	OutputTokens    int     `json:"output_tokens"`
+	TokensPerSecond float64 `json:"tokens_per_second"`
+}
+
+// CompareResult is the final outcome for one target
+type CompareResult struct {
+	Index   int             `json:"index"`
+	Backend string          `json:"backend"`
+	Model   string          `json:"model"`
+	Content string          `json:"content,omitempty"`
+	Metrics *CompareMetrics `json:"metrics,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	// SettingsHash identifies the snapshot of the settings this result used
+	SettingsHash string `json:"settings_hash,omitempty"`
+}
+
+// CompareEvent is one line of the multiplexed NDJSON stream.
+// Type is "chunk", "done", "error", or "summary".
+type CompareEvent struct {
+	Type    string          `json:"type"`
+	Index   int             `json:"index"`
+	Backend string          `json:"backend,omitempty"`
+	Model   string          `json:"model,omitempty"`
+	Content string          `json:"content,omitempty"`
+	Metrics *CompareMetrics `json:"metrics,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	Results []CompareResult `json:"results,omitempty"`
+}
+
+// CompareHandler sends the same prompt to several backend/model pairs
+// concurrently and streams every response on one NDJSON channel, tagged with
+// the target index, followed by a side-by-side summary
+func (s *OllamaService) CompareHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CompareRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+
+		if fieldErrs := validateCompareRequest(&req); len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("Transfer-Encoding", "chunked")
+
+		flusher, ok := c.Writer.(http.Flusher)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "streaming not supported"})
+			return
+		}
+
+		// Responses from all targets share one writer
+		var mu sync.Mutex
+		emit := func(ev CompareEvent) {
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			c.Writer.Write(append(data, '\n'))
+			flusher.Flush()
+		}
+
+		limit := req.MaxConcurrent
+		if limit <= 0 || limit > len(req.Targets) {
+			limit = len(req.Targets)
+		}
+		sem := make(chan struct{}, limit)
+
+		ctx := c.Request.Context()
+		results := make([]CompareResult, len(req.Targets))
+		var wg sync.WaitGroup
+		for i, target := range req.Targets {
+			wg.Add(1)
+			go func(i int, target CompareTarget) {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+
+				results[i] = s.runCompareTarget(ctx, i, target, &req, emit)
+			}(i, target)
+		}
+		wg.Wait()
+
+		emit(CompareEvent{Type: "summary", Index: -1, Results: results})
+	}
+}
+
+// runCompareTarget streams one target's response and measures its timings
+func (s *OllamaService) runCompareTarget(ctx context.Context, index int, target CompareTarget, req *CompareRequest, emit func(CompareEvent)) CompareResult {
+	result := CompareResult{Index: index, Backend: target.Backend, Model: target.Model}
+
+	var messages []api.Message
+	if req.System != "" {
+		messages = append(messages, api.Message{Role: "system", Content: req.System})
+	}
+	messages = append(messages, api.Message{Role: "user", Content: req.Prompt})
+
+	chatReq := &api.ChatRequest{
+		Model:    target.Model,
+		Messages: messages,
+		Options:  target.Options,
+	}
+
+	if s.db != nil {
+		if defaults, err := models.GetInferenceDefaults(s.db); err == nil {
+			applyInferenceDefaults(chatReq, defaults)
+		}
+	}
+
+	if s.db != nil {
+		if hash, err := s.snapshotSettings(ctx, chatReq); err == nil {
+			result.SettingsHash = hash
+		}
+	}
+
+	var content strings.Builder
+	var final api.ChatResponse
+	var firstToken time.Duration
+	start := time.Now()
+
+	err := s.client.Chat(ctx, chatReq, func(resp api.ChatResponse) error {
+		if resp.Message.Content != "" {
+			if firstToken == 0 {
+				firstToken = time.Since(start)
+			}
+			content.WriteString(resp.Message.Content)
+			emit(CompareEvent{
+				Type:    "chunk",
+				Index:   index,
+				Backend: target.Backend,
+				Model:   target.Model,
+				Content: resp.Message.Content,
+			})
+		}
+		if resp.Done {
+			final = resp
+		}
+		return nil
+	})
+	if err != nil {
+		result.Error = err.Error()
+		emit(CompareEvent{Type: "error", Index: index, Backend: target.Backend, Model: target.Model, Error: result.Error})
+		return result
+	}
+
+	metrics := &CompareMetrics{
+		FirstTokenMs: firstToken.Milliseconds(),
+		TotalMs:      time.Since(start).Milliseconds(),
+		PromptTokens: final.PromptEvalCount,
+		OutputTokens: final.EvalCount,
+	}
+	if final.EvalDuration > 0 {
+		metrics.TokensPerSecond = float64(final.EvalCount) / final.EvalDuration.Seconds()
+	}
+
+	result.Content = content.String()
+	result.Metrics = metrics
+	emit(CompareEvent{Type: "done", Index: index, Backend: target.Backend, Model: target.Model, Metrics: metrics})
+	return result
+}
+
+// validateCompareRequest checks a comparison request and fills in default backends
+func validateCompareRequest(req *CompareRequest) []FieldError {
+	var errs []FieldError
+
+	if strings.TrimSpace(req.Prompt) == "" {
+		errs = append(errs, FieldError{Field: "prompt", Message: "prompt is required"})
+	}
+
+	switch {
+	case len(req.Targets) == 0:
+		errs = append(errs, FieldError{Field: "targets", Message: "at least one target is required"})
+	case len(req.Targets) > maxCompareTargets:
+		errs = append(errs, FieldError{
+			Field:   "targets",
+			Message: fmt.Sprintf("at most %d targets are allowed", maxCompareTargets),
+		})
+	}
+
+	for i := range req.Targets {
+		target := &req.Targets[i]
+		errs = append(errs, validateTarget(fmt.Sprintf("targets[%d]", i), &target.Backend, target.Model, target.Options)...)
+	}
+
+	return errs
+}
+
+// validateTarget checks one backend/model pair, defaulting the backend to Ollama
+func validateTarget(field string, backend *string, model string, options map[string]any) []FieldError {
+	var errs []FieldError
+
+	if *backend == "" {
+		*backend = "ollama"
+	}
+	if *backend != "ollama" {
+		errs = append(errs, FieldError{Field: field + ".backend", Message: "unknown backend: " + *backend})
+	}
+	if strings.TrimSpace(model) == "" {
+		errs = append(errs, FieldError{Field: field + ".model", Message: "model is required"})
+	}
+	for _, optErr := range validateOptions(options) {
+		optErr.Field = field + "." + optErr.Field
+		errs = append(errs, optErr)
+	}
+
+	return errs
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/models"
+)
+
+// CompletionCacheHeader reports whether a chat response came from the
+// completion cache ("hit") or was generated and stored ("miss")
+const CompletionCacheHeader = "X-Completion-Cache"
+
+// completionCacheKey returns the cache key for a deterministic request, or ""
+// if the request can't be cached. Only requests with a seed and temperature 0
+// are cached; persisted requests and n-best requests are not, and NoCache
+// bypasses the cache entirely.
+func (s *OllamaService) completionCacheKey(req *ChatPipelineRequest) string {
+	if s.db == nil || s.completionCacheTTL <= 0 || req.NoCache || req.Persist || req.N > 1 {
+		return ""
+	}
+
+	// A generated seed makes every request unique, so it is never a hit
+	if _, present, ok := optionFloat(req.Options, "seed"); !present || !ok || req.generatedSeed {
+		return ""
+	}
+	if temp, present, ok := optionFloat(req.Options, "temperature"); !present || !ok || temp != 0 {
+		return ""
+	}
+
+	// Options is a map, so its keys marshal in sorted order
+	data, err := json.Marshal(struct {
+		Model    string          `json:"model"`
+		Messages []api.Message   `json:"messages"`
+		Options  map[string]any  `json:"options"`
+		Format   json.RawMessage `json:"format,omitempty"`
+		Tools    api.Tools       `json:"tools,omitempty"`
+		Think    *api.ThinkValue `json:"think,omitempty"`
+	}{
+		Model:    normalizeModelName(req.Model),
+		Messages: req.Messages,
+		Options:  req.Options,
+		Format:   req.Format,
+		Tools:    req.Tools,
+		Think:    req.Think,
+	})
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// serveCachedCompletion writes a cached response if one exists for key and
+// reports whether it did. Streaming requests receive the cached response as
+// a single final NDJSON event (followed by the end event in the delta
+// format). The response carries the request's effective
+// config, like a fresh one.
+func (s *OllamaService) serveCachedCompletion(c *gin.Context, req *ChatPipelineRequest, key string, streaming bool) bool {
+	cached, ok, err := models.GetCachedCompletion(s.db, key)
+	if err != nil {
+		log.Printf("[Cache] %v", err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+	resp := TimedChatResponse{Config: s.effectiveConfig(req)}
+	if err := json.Unmarshal([]byte(cached), &resp.ChatResponse); err != nil {
+		log.Printf("[Cache] Ignoring unreadable cached completion: %v", err)
+		return false
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return false
+	}
+
+	c.Header(CompletionCacheHeader, "hit")
+	switch {
+	case streaming && req.StreamFormat == StreamFormatDelta:
+		c.Header(StreamFormatHeader, StreamFormatDelta)
+		end := deltaEndEvent(GenerationStatus{Events: 1, Content: resp.Message.Content})
+		c.Data(http.StatusOK, "application/x-ndjson", slices.Concat(deltaEvent(0, data), []byte("\n"), end, []byte("\n")))
+	case streaming:
+		c.Data(http.StatusOK, "application/x-ndjson", append(data, '\n'))
+	default:
+		c.Data(http.StatusOK, "application/json", data)
+	}
+	return true
+}
+
+// storeCompletion caches a final chat response under key
+func (s *OllamaService) storeCompletion(key string, resp api.ChatResponse) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	if err := models.SaveCachedCompletion(s.db, key, resp.Model, string(data), s.completionCacheTTL); err != nil {
+		log.Printf("[Cache] %v", err)
+	}
+}
+
+// ClearCompletionCacheHandler removes every cached completion
+func ClearCompletionCacheHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		removed, err := models.ClearCompletionCache(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"removed": removed})
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"time"
+
+	"vessel-backend/internal/secrets"
+)
+
+// Config holds server-level settings passed in from the command line
+type Config struct {
+	// OllamaURL is the base URL of the Ollama backend
+	OllamaURL string
+	// DefaultModel is used when a chat request names no model and isn't
+	// linked to a chat with one
+	DefaultModel string
+	// Secrets stores credentials managed through the admin API
+	Secrets secrets.Store
+	// Auth configures API token authentication (disabled without tokens)
+	Auth AuthConfig
+	// CompletionCacheTTL is how long deterministic chat completions are
+	// cached (0 disables the cache)
+	CompletionCacheTTL time.Duration
+	// ChatHooks inspect, modify or deny chat prompts and responses, in order
+	ChatHooks []ChatHook
+	// ChatMiddleware names the chat middleware to run, in order (empty uses
+	// DefaultChatMiddleware)
+	ChatMiddleware []string
+	// CircuitThreshold is how many consecutive backend failures open the
+	// circuit (0 uses the default)
+	CircuitThreshold int
+	// CircuitCooldown is how long an open circuit rejects requests before
+	// letting a probe through (0 uses the default)
+	CircuitCooldown time.Duration
+	// RegistryDetailsInterval is the minimum time between background fetches
+	// of registry model details (0 disables the worker)
+	RegistryDetailsInterval time.Duration
+	// RAGRecrawlInterval is how old a URL document's last crawl may get
+	// before it is fetched and re-indexed (0 disables re-crawling)
+	RAGRecrawlInterval time.Duration
+	// UploadDir is where files uploaded to RAG collections are spooled while
+	// they are ingested (empty uses the system temp directory)
+	UploadDir string
+	// UploadRetention is how long failed and cancelled uploads keep their
+	// spooled files so they can be resumed (0 keeps them until deleted)
+	UploadRetention time.Duration
+	// Offline disables every request to the internet (registry scraping, web
+	// search and fetches, geolocation, update checks) for air-gapped installs
+	Offline bool
+	// OllamaModelsDir is Ollama's models directory, read (never written) to
+	// verify the checksums of installed models; empty disables verification
+	OllamaModelsDir string
+	// ModelVerifyInterval is how often installed models are re-verified
+	// against their checksums (0 disables; they can still be verified on
+	// demand)
+	ModelVerifyInterval time.Duration
+	// ImageMaxDimension is the longest side chat images are scaled down to
+	// before they reach the model (0 keeps their size)
+	ImageMaxDimension int
+	// UpdateChannel is the release channel checked for updates (stable,
+	// beta or off; empty means stable)
+	UpdateChannel string
+	// TranslationModel translates chats; empty uses the chat's own model,
+	// then the default model
+	TranslationModel string
+	// CodeInterpreter is the sandbox code interpreter snippets run in:
+	// off, subprocess, container or auto (empty means off). Only subprocess
+	// runs snippets outside a container.
+	CodeInterpreter string
+	// CodeInterpreterPythonImage is the container image Python snippets run
+	// in (empty uses DefaultCodePythonImage)
+	CodeInterpreterPythonImage string
+	// WarmModels is how many recently used models are kept loaded (0
+	// disables the warm pool); WarmVRAMBudgetMB caps the VRAM they may use
+	// together (0 is unlimited)
+	WarmModels       int
+	WarmVRAMBudgetMB int
+	// WarmIdleTimeout unloads the warm models once no chat has used a model
+	// for this long (0 keeps them loaded)
+	WarmIdleTimeout time.Duration
+	// PullOnDemand pulls the model a chat request names when it isn't
+	// installed, holding the request until the pull finishes
+	PullOnDemand bool
+	// JobWorkers is how many background jobs run at the same time (at
+	// least 1)
+	JobWorkers int
+	// VRAMPolicy is what happens when a chat's model won't fit in the VRAM
+	// left: off, unload or reject (empty means off). VRAMBudgetMB caps the
+	// VRAM Ollama and the GPU's other users share (0 uses the GPU's total).
+	VRAMPolicy   string
+	VRAMBudgetMB int
+}
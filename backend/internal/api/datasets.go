@@ -0,0 +1,381 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/models"
+)
+
+// Dataset formats
+const (
+	DatasetFormatOpenAI   = "openai"
+	DatasetFormatShareGPT = "sharegpt"
+	DatasetFormatAlpaca   = "alpaca"
+)
+
+// Ways of handling system messages in dataset examples
+const (
+	DatasetSystemKeep = "keep"
+	// DatasetSystemMerge prepends system messages to the first user turn,
+	// for chat templates without a system role
+	DatasetSystemMerge = "merge"
+	DatasetSystemDrop  = "drop"
+)
+
+// datasetRoles are each format's role names. Alpaca has no roles.
+var datasetRoles = map[string]map[string]string{
+	DatasetFormatOpenAI:   {"system": "system", "user": "user", "assistant": "assistant"},
+	DatasetFormatShareGPT: {"system": "system", "user": "human", "assistant": "gpt"},
+	DatasetFormatAlpaca:   {},
+}
+
+// datasetScrubber replaces one kind of personal data
+type datasetScrubber struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// datasetScrubbers are the built-in PII scrubbers by name
+var datasetScrubbers = map[string]datasetScrubber{
+	"email":       {regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "[EMAIL]"},
+	"credit_card": {regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), "[CARD]"},
+	"ip":          {regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`), "[IP]"},
+	"phone":       {regexp.MustCompile(`(?:\+|\b)\d[\d ().-]{6,}\d\b`), "[PHONE]"},
+}
+
+// datasetScrubOrder is the order scrubbers run in. Card numbers and IP
+// addresses go before phone numbers, which would also match them.
+var datasetScrubOrder = []string{"email", "credit_card", "ip", "phone"}
+
+// DatasetExportRequest selects chats and describes the dataset to build
+type DatasetExportRequest struct {
+	Format string `json:"format"`
+	// ChatIDs limits the export to these chats; empty exports every
+	// unarchived chat
+	ChatIDs []string `json:"chat_ids,omitempty"`
+	// AllBranches exports every branch of a chat instead of only the most
+	// recent one
+	AllBranches bool `json:"all_branches,omitempty"`
+	// PositiveOnly keeps only conversations ending in a positively rated
+	// reply: each branch is cut before its first negatively rated reply and
+	// after its last positively rated one
+	PositiveOnly bool `json:"positive_only,omitempty"`
+	// System is keep (default), merge or drop
+	System string `json:"system,omitempty"`
+	// RoleMap overrides the format's role names, e.g. {"assistant": "model"}
+	RoleMap map[string]string `json:"role_map,omitempty"`
+	// Scrub lists built-in PII scrubbers to apply: email, credit_card, ip, phone
+	Scrub []string `json:"scrub,omitempty"`
+	// ScrubHooks runs the configured chat hooks on each example at the
+	// export stage; hooks can rewrite an example or deny it to leave it out
+	ScrubHooks bool `json:"scrub_hooks,omitempty"`
+}
+
+// validateDatasetExport checks an export request and fills in defaults
+func validateDatasetExport(req *DatasetExportRequest) []FieldError {
+	var errs []FieldError
+	if _, ok := datasetRoles[req.Format]; !ok {
+		errs = append(errs, FieldError{Field: "format", Message: "must be openai, sharegpt or alpaca"})
+	}
+	if req.System == "" {
+		req.System = DatasetSystemKeep
+	}
+	if req.System != DatasetSystemKeep && req.System != DatasetSystemMerge && req.System != DatasetSystemDrop {
+		errs = append(errs, FieldError{Field: "system", Message: "must be keep, merge or drop"})
+	}
+	for role, name := range req.RoleMap {
+		if role != "system" && role != "user" && role != "assistant" {
+			errs = append(errs, FieldError{Field: "role_map." + role, Message: "only system, user and assistant can be mapped"})
+		} else if strings.TrimSpace(name) == "" {
+			errs = append(errs, FieldError{Field: "role_map." + role, Message: "must not be empty"})
+		}
+	}
+	for i, name := range req.Scrub {
+		if _, ok := datasetScrubbers[name]; !ok {
+			errs = append(errs, FieldError{Field: fmt.Sprintf("scrub[%d]", i), Message: "must be email, credit_card, ip or phone"})
+		}
+	}
+	return errs
+}
+
+// ExportDatasetHandler turns chats into an instruction-tuning dataset and
+// downloads it as JSONL, one example per line
+func (s *OllamaService) ExportDatasetHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req DatasetExportRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+		if fieldErrs := validateDatasetExport(&req); len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+		password, ok := exportPassword(c)
+		if !ok {
+			return
+		}
+
+		chatIDs := req.ChatIDs
+		if len(chatIDs) == 0 {
+			chats, err := models.ListChats(s.db, false, "")
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			for _, chat := range chats {
+				chatIDs = append(chatIDs, chat.ID)
+			}
+		}
+
+		// Build every example before responding, so errors can still be reported
+		var lines []any
+		for _, chatID := range chatIDs {
+			chat, err := models.GetChat(s.db, chatID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if chat == nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "chat not found: " + chatID})
+				return
+			}
+			examples, err := s.datasetExamples(c.Request.Context(), chat, &req)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			lines = append(lines, examples...)
+		}
+
+		filename := fmt.Sprintf("dataset-%s-%s.jsonl", req.Format, time.Now().UTC().Format("20060102"))
+		w, finish, err := startExport(c, filename, "application/x-ndjson", password)
+		if err != nil {
+			return
+		}
+		defer finish()
+		// Branches share their beginnings, so Alpaca pairs can repeat;
+		// identical lines are written once
+		written := make(map[string]bool)
+		for _, line := range lines {
+			data, err := json.Marshal(line)
+			if err != nil || written[string(data)] {
+				continue
+			}
+			written[string(data)] = true
+			if _, err := w.Write(append(data, '\n')); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// datasetExamples converts a chat's branches into dataset lines
+func (s *OllamaService) datasetExamples(ctx context.Context, chat *models.Chat, req *DatasetExportRequest) ([]any, error) {
+	ratings := make(map[string]int)
+	if req.PositiveOnly {
+		feedback, err := models.ListFeedback(s.db, models.FeedbackFilter{ChatID: chat.ID})
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range feedback {
+			ratings[f.MessageID] = f.Rating
+		}
+	}
+
+	var lines []any
+	seen := make(map[string]bool)
+	for _, branch := range chatBranches(chat.Messages, req.AllBranches) {
+		if req.PositiveOnly {
+			branch = positivePrefix(branch, ratings)
+		}
+		// Examples end with a reply
+		for len(branch) > 0 && branch[len(branch)-1].Role != "assistant" {
+			branch = branch[:len(branch)-1]
+		}
+		if len(branch) == 0 {
+			continue
+		}
+
+		// Cut branches can end at the same reply
+		key := branch[len(branch)-1].ID
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		messages := make([]api.Message, len(branch))
+		for i, m := range branch {
+			messages[i] = api.Message{Role: m.Role, Content: scrubText(m.Content, req.Scrub)}
+		}
+		if req.ScrubHooks && len(s.hooks) > 0 {
+			payload := &HookPayload{Stage: HookStageExport, ChatID: chat.ID, Model: chat.Model, Messages: messages}
+			if denied := s.runHooks(ctx, payload); denied != nil {
+				log.Printf("[Datasets] Example from chat %s left out by %s: %s", chat.ID, denied.Hook, denied.Reason)
+				continue
+			}
+			messages = payload.Messages
+		}
+
+		lines = append(lines, formatDatasetExample(applySystemMode(messages, req.System), req)...)
+	}
+	return lines, nil
+}
+
+// chatBranches returns the root-to-leaf paths through a chat's message tree,
+// or only the path to the most recent leaf. Chats stored without parent
+// links are one linear branch.
+func chatBranches(messages []models.Message, all bool) [][]models.Message {
+	byID := make(map[string]*models.Message, len(messages))
+	hasChildren := make(map[string]bool)
+	linked := false
+	for i := range messages {
+		byID[messages[i].ID] = &messages[i]
+		if p := messages[i].ParentID; p != nil {
+			hasChildren[*p] = true
+			linked = true
+		}
+	}
+	if !linked {
+		if len(messages) == 0 {
+			return nil
+		}
+		return [][]models.Message{messages}
+	}
+
+	var leaves []*models.Message
+	for i := range messages {
+		if !hasChildren[messages[i].ID] {
+			leaves = append(leaves, &messages[i])
+		}
+	}
+	// Messages are ordered by creation, so the last leaf is the newest
+	if !all && len(leaves) > 0 {
+		leaves = leaves[len(leaves)-1:]
+	}
+
+	branches := make([][]models.Message, 0, len(leaves))
+	for _, leaf := range leaves {
+		var path []models.Message
+		for m := leaf; m != nil; {
+			path = append([]models.Message{*m}, path...)
+			if m.ParentID == nil || len(path) > len(messages) {
+				break
+			}
+			m = byID[*m.ParentID]
+		}
+		branches = append(branches, path)
+	}
+	return branches
+}
+
+// positivePrefix cuts a branch before its first negatively rated reply and
+// after its last positively rated one; branches without one are dropped
+func positivePrefix(branch []models.Message, ratings map[string]int) []models.Message {
+	end := 0
+	for i, m := range branch {
+		rating := ratings[m.ID]
+		if rating < 0 {
+			break
+		}
+		if m.Role == "assistant" && rating > 0 {
+			end = i + 1
+		}
+	}
+	return branch[:end]
+}
+
+// scrubText applies the named PII scrubbers in their fixed order
+func scrubText(text string, names []string) string {
+	for _, name := range datasetScrubOrder {
+		for _, n := range names {
+			if n == name {
+				s := datasetScrubbers[name]
+				text = s.pattern.ReplaceAllString(text, s.replacement)
+				break
+			}
+		}
+	}
+	return text
+}
+
+// applySystemMode keeps, merges or drops system messages
+func applySystemMode(messages []api.Message, mode string) []api.Message {
+	if mode == DatasetSystemKeep {
+		return messages
+	}
+
+	var system []string
+	out := make([]api.Message, 0, len(messages))
+	for _, m := range messages {
+		if m.Role == "system" {
+			system = append(system, m.Content)
+			continue
+		}
+		out = append(out, m)
+	}
+	if mode == DatasetSystemMerge && len(system) > 0 {
+		for i := range out {
+			if out[i].Role == "user" {
+				out[i].Content = strings.Join(system, "\n\n") + "\n\n" + out[i].Content
+				break
+			}
+		}
+	}
+	return out
+}
+
+// formatDatasetExample writes a conversation in the requested format. Alpaca
+// has no multi-turn form, so each user/reply pair becomes its own line.
+func formatDatasetExample(messages []api.Message, req *DatasetExportRequest) []any {
+	roles := make(map[string]string)
+	for k, v := range datasetRoles[req.Format] {
+		roles[k] = v
+	}
+	for k, v := range req.RoleMap {
+		roles[k] = v
+	}
+
+	switch req.Format {
+	case DatasetFormatShareGPT:
+		turns := make([]gin.H, 0, len(messages))
+		for _, m := range messages {
+			turns = append(turns, gin.H{"from": roles[m.Role], "value": m.Content})
+		}
+		return []any{gin.H{"conversations": turns}}
+
+	case DatasetFormatAlpaca:
+		var lines []any
+		var system []string
+		for i, m := range messages {
+			switch {
+			case m.Role == "system":
+				system = append(system, m.Content)
+			case m.Role == "user" && i+1 < len(messages) && messages[i+1].Role == "assistant":
+				line := gin.H{"instruction": m.Content, "input": "", "output": messages[i+1].Content}
+				if len(system) > 0 {
+					line["system"] = strings.Join(system, "\n\n")
+				}
+				lines = append(lines, line)
+			}
+		}
+		return lines
+
+	default:
+		turns := make([]gin.H, 0, len(messages))
+		for _, m := range messages {
+			turns = append(turns, gin.H{"role": roles[m.Role], "content": m.Content})
+		}
+		return []any{gin.H{"messages": turns}}
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/models"
+)
+
+// defaultsOptionFields maps Ollama option keys to InferenceDefaults fields
+// for validation messages
+var defaultsOptionFields = map[string]string{
+	"options.temperature": "temperature",
+	"options.num_predict": "max_tokens",
+	"options.num_ctx":     "context_budget",
+}
+
+// GetDefaultsHandler returns the global inference defaults
+func GetDefaultsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defaults, err := models.GetInferenceDefaults(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, defaults)
+	}
+}
+
+// UpdateDefaultsHandler replaces the global inference defaults. Omitted
+// fields are cleared, so the backend's own default applies again.
+func UpdateDefaultsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var defaults models.InferenceDefaults
+		if err := c.ShouldBindJSON(&defaults); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+
+		if fieldErrs := validateInferenceDefaults(&defaults); len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+
+		if err := models.SaveInferenceDefaults(db, &defaults); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, defaults)
+	}
+}
+
+// validateInferenceDefaults applies the same range checks as chat request options
+func validateInferenceDefaults(d *models.InferenceDefaults) []FieldError {
+	d.SystemPrompt = strings.TrimSpace(d.SystemPrompt)
+	d.Locale = strings.TrimSpace(d.Locale)
+	d.Timezone = strings.TrimSpace(d.Timezone)
+
+	errs := validateOptions(defaultsToOptions(d))
+	for i := range errs {
+		if field, ok := defaultsOptionFields[errs[i].Field]; ok {
+			errs[i].Field = field
+		}
+	}
+	if err := validateLocale(d.Locale); err != nil {
+		errs = append(errs, FieldError{Field: "locale", Message: err.Error()})
+	}
+	if err := validateTimezone(d.Timezone); err != nil {
+		errs = append(errs, FieldError{Field: "timezone", Message: err.Error()})
+	}
+	return errs
+}
+
+// defaultsToOptions converts the numeric defaults to Ollama option keys
+func defaultsToOptions(d *models.InferenceDefaults) map[string]any {
+	opts := make(map[string]any)
+	if d.Temperature != nil {
+		opts["temperature"] = *d.Temperature
+	}
+	if d.MaxTokens != nil {
+		opts["num_predict"] = float64(*d.MaxTokens)
+	}
+	if d.ContextBudget != nil {
+		opts["num_ctx"] = float64(*d.ContextBudget)
+	}
+	return opts
+}
+
+// applyInferenceDefaults fills options, streaming and the system prompt that
+// neither the request nor its chat set. It copies req.Options rather than
+// modifying a map the caller may share.
+func applyInferenceDefaults(req *api.ChatRequest, d *models.InferenceDefaults) {
+	if d == nil {
+		return
+	}
+
+	if defaults := defaultsToOptions(d); len(defaults) > 0 {
+		opts := make(map[string]any, len(req.Options)+len(defaults))
+		for k, v := range defaults {
+			opts[k] = v
+		}
+		for k, v := range req.Options {
+			opts[k] = v
+		}
+		req.Options = opts
+	}
+
+	if req.Stream == nil && d.Stream != nil {
+		stream := *d.Stream
+		req.Stream = &stream
+	}
+
+	if d.SystemPrompt != "" && !hasSystemMessage(req.Messages) {
+		req.Messages = append([]api.Message{{Role: "system", Content: d.SystemPrompt}}, req.Messages...)
+	}
+}
+
+// applyDateContextDefaults fills the locale, timezone and date context
+// setting that neither the request nor its chat set
+func applyDateContextDefaults(req *ChatPipelineRequest, d *models.InferenceDefaults) {
+	if req.Locale == "" {
+		req.Locale = d.Locale
+	}
+	if req.Timezone == "" {
+		req.Timezone = d.Timezone
+	}
+	if req.InjectDateTime == nil && d.InjectDateTime {
+		inject := true
+		req.InjectDateTime = &inject
+	}
+}
+
+// hasSystemMessage reports whether any message has the system role
+func hasSystemMessage(messages []api.Message) bool {
+	for _, m := range messages {
+		if m.Role == "system" {
+			return true
+		}
+	}
+	return false
+}
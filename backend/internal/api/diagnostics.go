@@ -0,0 +1,317 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/database"
+)
+
+// diagnosticsTimeout bounds a diagnostics pass
+const diagnosticsTimeout = 15 * time.Second
+
+// Diagnostic check statuses, from best to worst
+const (
+	DiagnosticOK      = "ok"
+	DiagnosticSkipped = "skipped"
+	DiagnosticWarning = "warning"
+	DiagnosticError   = "error"
+)
+
+// diagnosticSeverity orders statuses so a report takes its worst check's
+var diagnosticSeverity = map[string]int{
+	DiagnosticOK:      0,
+	DiagnosticSkipped: 0,
+	DiagnosticWarning: 1,
+	DiagnosticError:   2,
+}
+
+// DiagnosticCheck is the outcome of one diagnostics check. Warnings and
+// errors carry a hint saying how to fix them.
+type DiagnosticCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Hint    string `json:"hint,omitempty"`
+}
+
+// DiagnosticsReport is the result of a diagnostics pass. Status is that of
+// the worst check.
+type DiagnosticsReport struct {
+	RanAt    time.Time         `json:"ran_at"`
+	Duration string            `json:"duration"`
+	Status   string            `json:"status"`
+	Checks   []DiagnosticCheck `json:"checks"`
+}
+
+// Diagnostics checks that the backend is set up to work: the database is
+// intact and migrated, the data directory is writable, Ollama answers and
+// has models, and the optional tools and settings are in place. A pass runs
+// at startup and its report is kept for GET /diagnostics.
+type Diagnostics struct {
+	db     *sql.DB
+	cfg    Config
+	ollama *OllamaService
+
+	mu   sync.Mutex
+	last *DiagnosticsReport
+}
+
+// NewDiagnostics creates the diagnostics for a configured backend; ollama
+// is nil when the Ollama service failed to initialize
+func NewDiagnostics(db *sql.DB, cfg Config, ollama *OllamaService) *Diagnostics {
+	return &Diagnostics{db: db, cfg: cfg, ollama: ollama}
+}
+
+// Run runs every check and keeps the report as the latest
+func (d *Diagnostics) Run(ctx context.Context) *DiagnosticsReport {
+	ctx, cancel := context.WithTimeout(ctx, diagnosticsTimeout)
+	defer cancel()
+
+	start := time.Now()
+	report := &DiagnosticsReport{RanAt: start.UTC(), Status: DiagnosticOK}
+	report.Checks = append(report.Checks, d.checkDatabase(ctx))
+	report.Checks = append(report.Checks, d.checkDataDir())
+	report.Checks = append(report.Checks, d.checkOllama(ctx)...)
+	report.Checks = append(report.Checks, d.checkModelsDir())
+	report.Checks = append(report.Checks, d.checkAuth())
+	report.Checks = append(report.Checks, d.checkWebFetcher())
+	for _, check := range report.Checks {
+		if diagnosticSeverity[check.Status] > diagnosticSeverity[report.Status] {
+			report.Status = check.Status
+		}
+	}
+	report.Duration = time.Since(start).Round(time.Millisecond).String()
+
+	d.mu.Lock()
+	d.last = report
+	d.mu.Unlock()
+	return report
+}
+
+// RunAtStartup runs a pass and logs a summary, with the problems found and
+// how to fix them
+func (d *Diagnostics) RunAtStartup() {
+	report := d.Run(context.Background())
+
+	counts := make(map[string]int)
+	for _, check := range report.Checks {
+		counts[check.Status]++
+	}
+	log.Printf("[Diagnostics] %s: %d ok, %d warnings, %d errors, %d skipped (GET /api/v1/diagnostics for details)",
+		report.Status, counts[DiagnosticOK], counts[DiagnosticWarning], counts[DiagnosticError], counts[DiagnosticSkipped])
+	for _, check := range report.Checks {
+		if check.Status != DiagnosticWarning && check.Status != DiagnosticError {
+			continue
+		}
+		log.Printf("[Diagnostics] %s %s: %s", strings.ToUpper(check.Status), check.Name, check.Message)
+		if check.Hint != "" {
+			log.Printf("[Diagnostics]   -> %s", check.Hint)
+		}
+	}
+}
+
+// Handler returns the latest report; refresh=true runs a new pass first
+func (d *Diagnostics) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d.mu.Lock()
+		report := d.last
+		d.mu.Unlock()
+		if report == nil || c.Query("refresh") == "true" {
+			report = d.Run(c.Request.Context())
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// checkDatabase runs a quick integrity check and verifies every migration
+// has been applied
+func (d *Diagnostics) checkDatabase(ctx context.Context) DiagnosticCheck {
+	check := DiagnosticCheck{Name: "database"}
+	problems, err := database.IntegrityCheck(ctx, d.db, true)
+	if err != nil {
+		check.Status = DiagnosticError
+		check.Message = err.Error()
+		check.Hint = "Check that the database file is readable and not locked by another process"
+		return check
+	}
+	if len(problems) > 0 {
+		check.Status = DiagnosticError
+		check.Message = fmt.Sprintf("integrity check found %d problems: %s", len(problems), problems[0])
+		check.Hint = "Restore the database from a backup, or run a full check with GET /api/v1/admin/db/integrity"
+		return check
+	}
+	missing, err := database.CheckSchema(ctx, d.db)
+	if err != nil {
+		check.Status = DiagnosticError
+		check.Message = err.Error()
+		return check
+	}
+	if len(missing) > 0 {
+		check.Status = DiagnosticError
+		check.Message = "schema is missing " + strings.Join(missing, ", ")
+		check.Hint = "Restart the backend to rerun the migrations; if this persists, the database was changed by a newer version"
+		return check
+	}
+	check.Status = DiagnosticOK
+	check.Message = "integrity check passed and migrations are applied"
+	return check
+}
+
+// checkDataDir verifies files can be created where uploads are spooled and
+// next to the database
+func (d *Diagnostics) checkDataDir() DiagnosticCheck {
+	check := DiagnosticCheck{Name: "data_dir"}
+	dir := d.cfg.UploadDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	for _, path := range []string{filepath.Dir(dir), dir} {
+		if err := checkWritable(path); err != nil {
+			check.Status = DiagnosticError
+			check.Message = fmt.Sprintf("%s is not writable: %v", path, err)
+			check.Hint = fmt.Sprintf("Give the user the backend runs as write access to %s, or move the database with -db", path)
+			return check
+		}
+	}
+	check.Status = DiagnosticOK
+	check.Message = filepath.Dir(dir) + " is writable"
+	return check
+}
+
+// checkWritable creates and removes a file in dir, creating dir if needed
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".vessel-diagnostics-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkOllama verifies Ollama answers and has models, including the default
+// model when one is configured
+func (d *Diagnostics) checkOllama(ctx context.Context) []DiagnosticCheck {
+	check := DiagnosticCheck{Name: "ollama"}
+	urlHint := fmt.Sprintf("Start Ollama (ollama serve), or point -ollama-url / OLLAMA_URL at it (currently %s)", redactURL(d.cfg.OllamaURL))
+	if d.ollama == nil {
+		check.Status = DiagnosticError
+		check.Message = "the Ollama client could not be created from the configured URL"
+		check.Hint = urlHint
+		return []DiagnosticCheck{check}
+	}
+
+	status := d.ollama.backendStatus(ctx)
+	if status.Error != "" {
+		check.Status = DiagnosticError
+		check.Message = "Ollama is not reachable: " + status.Error
+		check.Hint = urlHint
+		return []DiagnosticCheck{check}
+	}
+	check.Status = DiagnosticOK
+	check.Message = fmt.Sprintf("Ollama %s is reachable at %s", status.Version, redactURL(d.cfg.OllamaURL))
+	checks := []DiagnosticCheck{check}
+
+	models := DiagnosticCheck{Name: "models"}
+	list, err := d.ollama.client.List(ctx)
+	switch {
+	case err != nil:
+		models.Status = DiagnosticWarning
+		models.Message = "failed to list models: " + err.Error()
+	case len(list.Models) == 0:
+		models.Status = DiagnosticWarning
+		models.Message = "no models are installed, so chats can't be answered"
+		models.Hint = "Pull a model from the model browser, or run: vesselctl models pull llama3.2"
+	case d.cfg.DefaultModel != "" && !modelListed(list.Models, d.cfg.DefaultModel):
+		models.Status = DiagnosticWarning
+		models.Message = fmt.Sprintf("the default model %s is not installed", d.cfg.DefaultModel)
+		models.Hint = fmt.Sprintf("Pull it (vesselctl models pull %s), or change -default-model / OLLAMA_DEFAULT_MODEL", d.cfg.DefaultModel)
+	default:
+		models.Status = DiagnosticOK
+		models.Message = fmt.Sprintf("%d models installed", len(list.Models))
+	}
+	return append(checks, models)
+}
+
+// modelListed reports whether a model is among the installed ones; names
+// without a tag match the latest tag
+func modelListed(installed []api.ListModelResponse, name string) bool {
+	if !strings.Contains(name, ":") {
+		name += ":latest"
+	}
+	for _, m := range installed {
+		if m.Name == name || m.Model == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkModelsDir verifies Ollama's models directory can be read for checksum
+// verification
+func (d *Diagnostics) checkModelsDir() DiagnosticCheck {
+	check := DiagnosticCheck{Name: "ollama_models_dir"}
+	if d.cfg.OllamaModelsDir == "" {
+		check.Status = DiagnosticSkipped
+		check.Message = "no models directory is configured, so model checksums aren't verified"
+		return check
+	}
+	if _, err := os.Stat(filepath.Join(d.cfg.OllamaModelsDir, "manifests")); err != nil {
+		check.Status = DiagnosticWarning
+		check.Message = fmt.Sprintf("%s can't be read as an Ollama models directory: %v", d.cfg.OllamaModelsDir, err)
+		check.Hint = "Set -ollama-models-dir / OLLAMA_MODELS to Ollama's models directory, or to empty when Ollama runs on another host"
+		return check
+	}
+	check.Status = DiagnosticOK
+	check.Message = d.cfg.OllamaModelsDir + " is readable"
+	return check
+}
+
+// checkAuth warns when the API is open to anyone who can reach it
+func (d *Diagnostics) checkAuth() DiagnosticCheck {
+	check := DiagnosticCheck{Name: "auth"}
+	if d.cfg.Auth.APIToken == "" && d.cfg.Auth.AdminToken == "" {
+		check.Status = DiagnosticWarning
+		check.Message = "no API token is set, so anyone who can reach the server can use it"
+		check.Hint = "Set VESSEL_API_TOKEN (and VESSEL_ADMIN_TOKEN for administrative routes), or keep the server on a trusted network"
+		return check
+	}
+	check.Status = DiagnosticOK
+	check.Message = "API token authentication is enabled"
+	return check
+}
+
+// checkWebFetcher reports whether web pages can be rendered with headless
+// Chrome
+func (d *Diagnostics) checkWebFetcher() DiagnosticCheck {
+	check := DiagnosticCheck{Name: "web_fetcher"}
+	if IsOffline() {
+		check.Status = DiagnosticSkipped
+		check.Message = "offline mode is enabled"
+		return check
+	}
+	fetcher := GetFetcher()
+	if !fetcher.HasChrome() {
+		check.Status = DiagnosticWarning
+		check.Message = fmt.Sprintf("headless Chrome was not found; pages are fetched with %s, so pages rendered by JavaScript may come back empty", fetcher.Method())
+		check.Hint = "Install Chromium or Google Chrome to fetch JavaScript-heavy pages"
+		return check
+	}
+	check.Status = DiagnosticOK
+	check.Message = "headless Chrome is available"
+	return check
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/models"
+)
+
+// Layers an effective setting can come from, from the lowest to the highest
+// precedence
+const (
+	// ConfigSourceModel is the model's own Modelfile parameters, which
+	// Ollama uses for options no layer above sets
+	ConfigSourceModel = "model"
+	// ConfigSourceServer is the server's configuration, e.g. -default-model
+	ConfigSourceServer = "server"
+	// ConfigSourceDefaults is the global inference defaults
+	ConfigSourceDefaults = "defaults"
+	// ConfigSourceChat is the settings stored on the chat
+	ConfigSourceChat = "chat"
+	// ConfigSourceRequest is the request itself, including its headers
+	ConfigSourceRequest = "request"
+	// ConfigSourceGenerated is a value a middleware picked, e.g. a random seed
+	ConfigSourceGenerated = "generated"
+)
+
+// EffectiveConfig is the fully resolved configuration of a chat request,
+// as sent to the backend, and the layer each setting came from
+type EffectiveConfig struct {
+	Backend        string         `json:"backend"`
+	Model          string         `json:"model"`
+	Options        map[string]any `json:"options"`
+	KeepAlive      string         `json:"keep_alive,omitempty"`
+	Stream         bool           `json:"stream"`
+	Think          any            `json:"think,omitempty"`
+	Format         any            `json:"format,omitempty"`
+	Locale         string         `json:"locale,omitempty"`
+	Timezone       string         `json:"timezone,omitempty"`
+	InjectDateTime bool           `json:"inject_datetime"`
+	ExpandURLs     bool           `json:"expand_urls"`
+	CharacterID    string         `json:"character_id,omitempty"`
+	Language       string         `json:"language,omitempty"`
+	Middleware     []string       `json:"middleware"`
+	// URLContext lists the linked pages fetched into the last user message
+	URLContext []URLSnippet `json:"url_context,omitempty"`
+	// Sources maps each setting that was set to the ConfigSource it came
+	// from; options are keyed "options.<name>". Settings without an entry
+	// are left to the backend.
+	Sources map[string]string `json:"sources"`
+}
+
+// setSource records the layer a setting came from
+func (r *ChatPipelineRequest) setSource(key, source string) {
+	if r.sources == nil {
+		r.sources = make(map[string]string)
+	}
+	r.sources[key] = source
+}
+
+// recordRequestSources marks the settings the client sent, before the
+// chat's settings and the defaults fill the rest
+func recordRequestSources(req *ChatPipelineRequest) {
+	set := map[string]bool{
+		"model":           req.Model != "",
+		"keep_alive":      req.KeepAlive != nil,
+		"stream":          req.Stream != nil,
+		"think":           req.Think != nil,
+		"format":          len(req.Format) > 0,
+		"locale":          req.Locale != "",
+		"timezone":        req.Timezone != "",
+		"inject_datetime": req.InjectDateTime != nil,
+		"expand_urls":     req.ExpandURLs != nil,
+		"character_id":    req.CharacterID != "",
+		"language":        req.Language != "",
+		"system_prompt":   hasSystemMessage(req.Messages),
+	}
+	for key, ok := range set {
+		if ok {
+			req.setSource(key, ConfigSourceRequest)
+		}
+	}
+	for key := range req.Options {
+		req.setSource("options."+key, ConfigSourceRequest)
+	}
+}
+
+// recordDefaultsSources marks the settings the global defaults are about to
+// fill (see applyInferenceDefaults and applyDateContextDefaults)
+func recordDefaultsSources(req *ChatPipelineRequest, d *models.InferenceDefaults) {
+	for key := range defaultsToOptions(d) {
+		if _, ok := req.Options[key]; !ok {
+			req.setSource("options."+key, ConfigSourceDefaults)
+		}
+	}
+	if req.Stream == nil && d.Stream != nil {
+		req.setSource("stream", ConfigSourceDefaults)
+	}
+	if d.SystemPrompt != "" && !hasSystemMessage(req.Messages) {
+		req.setSource("system_prompt", ConfigSourceDefaults)
+	}
+	if req.Locale == "" && d.Locale != "" {
+		req.setSource("locale", ConfigSourceDefaults)
+	}
+	if req.Timezone == "" && d.Timezone != "" {
+		req.setSource("timezone", ConfigSourceDefaults)
+	}
+	if req.InjectDateTime == nil && d.InjectDateTime {
+		req.setSource("inject_datetime", ConfigSourceDefaults)
+	}
+}
+
+// effectiveConfig describes a prepared chat request
+func (s *OllamaService) effectiveConfig(req *ChatPipelineRequest) *EffectiveConfig {
+	config := &EffectiveConfig{
+		Backend:     "ollama",
+		Model:       req.Model,
+		Options:     make(map[string]any, len(req.Options)),
+		Stream:      req.Stream == nil || *req.Stream,
+		Locale:      req.Locale,
+		Timezone:    req.Timezone,
+		CharacterID: req.CharacterID,
+		Language:    req.Language,
+		Middleware:  s.chatMiddlewareNames(),
+		Sources:     make(map[string]string, len(req.sources)),
+	}
+	for k, v := range req.Options {
+		config.Options[k] = v
+	}
+	for k, v := range req.sources {
+		config.Sources[k] = v
+	}
+	switch {
+	case req.KeepAlive == nil:
+	case req.KeepAlive.Duration < 0:
+		config.KeepAlive = "-1"
+	default:
+		config.KeepAlive = req.KeepAlive.String()
+	}
+	if req.Think != nil {
+		config.Think = req.Think.Value
+	}
+	if len(req.Format) > 0 {
+		config.Format = req.Format
+	}
+	if req.InjectDateTime != nil {
+		config.InjectDateTime = *req.InjectDateTime
+	}
+	if req.ExpandURLs != nil {
+		config.ExpandURLs = *req.ExpandURLs
+	}
+	config.URLContext = req.urlContext
+	return config
+}
+
+// EffectiveConfigHandler returns the configuration a message sent to a chat
+// would be generated with: the request layers are resolved as for a request
+// that sets nothing itself, and options none of them set are filled from
+// the model's Modelfile parameters. A random seed is picked per request
+// unless a layer sets one.
+func (s *OllamaService) EffectiveConfigHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.db == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not available"})
+			return
+		}
+		ctx := c.Request.Context()
+
+		req := &ChatPipelineRequest{ChatID: c.Param("id")}
+		if err := s.applyChatSettings(ctx, req); err != nil {
+			respondChatSettingsError(c, err)
+			return
+		}
+		s.applyWarmPool(req, false)
+		config := s.effectiveConfig(req)
+
+		if show, err := s.client.Show(ctx, &api.ShowRequest{Model: config.Model}); err == nil {
+			for k, v := range parseOllamaParams(show.Parameters) {
+				if str, ok := v.(string); ok {
+					if unquoted, err := strconv.Unquote(str); err == nil {
+						v = unquoted
+					}
+				}
+				if _, ok := config.Options[k]; !ok {
+					config.Options[k] = v
+					config.Sources["options."+k] = ConfigSourceModel
+				}
+			}
+		}
+
+		c.JSON(http.StatusOK, config)
+	}
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"vessel-backend/internal/models"
+	"vessel-backend/internal/secrets"
+)
+
+// encryptionPassphraseSecret is the secret holding the content passphrase
+const encryptionPassphraseSecret = "encryption_passphrase"
+
+// RotateEncryptionKeyRequest is the request body for rotating the content key
+type RotateEncryptionKeyRequest struct {
+	// Passphrase derives the new key; it may repeat the current passphrase
+	Passphrase string `json:"passphrase" binding:"required"`
+}
+
+// EncryptionStatusHandler reports whether content encryption is enabled
+func EncryptionStatusHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, err := models.GetEncryptionStatus(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	}
+}
+
+// RotateEncryptionKeyHandler replaces the content key and re-encrypts all
+// messages. The new passphrase is saved in the secret store as part of the
+// rotation, so the next start derives the same key. A passphrase set through
+// VESSEL_ENCRYPTION_PASSPHRASE can't be updated that way, so rotation is
+// refused then.
+func RotateEncryptionKeyHandler(db *sql.DB, store secrets.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RotateEncryptionKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "passphrase is required"})
+			return
+		}
+		if store == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "no secret store is available to save the new passphrase"})
+			return
+		}
+
+		oldPassphrase, source, err := secrets.Resolve(store, encryptionPassphraseSecret)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if source == secrets.SourceEnv {
+			secret, _ := secrets.Lookup(encryptionPassphraseSecret)
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("the passphrase is set by %s and can't be updated here; "+
+				"save it in the secret store and unset the variable before rotating", secret.EnvVar)})
+			return
+		}
+		before, err := models.GetEncryptionStatus(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		persisted := false
+		count, err := models.RotateEncryptionKey(db, req.Passphrase, func() error {
+			if err := store.Set(encryptionPassphraseSecret, req.Passphrase); err != nil {
+				return fmt.Errorf("failed to save the new passphrase: %w", err)
+			}
+			persisted = true
+			return nil
+		})
+		if err != nil {
+			// The passphrase was saved but the new key never took effect
+			if current, statusErr := models.GetEncryptionStatus(db); persisted && statusErr == nil && current.KeyID == before.KeyID {
+				if restoreErr := store.Set(encryptionPassphraseSecret, oldPassphrase); restoreErr != nil {
+					log.Printf("[Encryption] Failed to restore the previous passphrase: %v", restoreErr)
+				}
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		status, err := models.GetEncryptionStatus(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"reencrypted_messages": count,
+			"status":               status,
+		})
+	}
+}
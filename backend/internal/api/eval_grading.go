@@ -0,0 +1,260 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/models"
+)
+
+// graderSystemPrompt instructs the grader model to answer in a parseable form
+const graderSystemPrompt = `You are grading an AI assistant's answer against the given criteria.
+Reply with PASS or FAIL on the first line, followed by a one-sentence reason.`
+
+// evalCheck is the outcome of one check on a case's output
+type evalCheck struct {
+	passed bool
+	reason string
+}
+
+// gradeEvalCase runs every check configured on a case. The score is the
+// fraction of checks passed; the case passes only if all of them do.
+func (s *OllamaService) gradeEvalCase(ctx context.Context, evalCase models.EvalCase, output, graderModel string) (bool, float64, string) {
+	var checks []evalCheck
+
+	if evalCase.ExpectPattern != "" {
+		re, err := regexp.Compile(evalCase.ExpectPattern)
+		switch {
+		case err != nil:
+			checks = append(checks, evalCheck{reason: "invalid pattern: " + err.Error()})
+		case re.MatchString(output):
+			checks = append(checks, evalCheck{passed: true})
+		default:
+			checks = append(checks, evalCheck{reason: "output does not match pattern"})
+		}
+	}
+
+	if len(evalCase.ExpectSchema) > 0 {
+		checks = append(checks, checkJSONSchema(output, evalCase.ExpectSchema))
+	}
+
+	if evalCase.GraderPrompt != "" {
+		checks = append(checks, s.checkWithGrader(ctx, evalCase, output, graderModel))
+	}
+
+	if len(checks) == 0 {
+		return true, 1, ""
+	}
+
+	passed := 0
+	var reasons []string
+	for _, check := range checks {
+		if check.passed {
+			passed++
+		} else if check.reason != "" {
+			reasons = append(reasons, check.reason)
+		}
+	}
+	return passed == len(checks), float64(passed) / float64(len(checks)), strings.Join(reasons, "; ")
+}
+
+// checkWithGrader asks the grader model whether output meets the case's criteria
+func (s *OllamaService) checkWithGrader(ctx context.Context, evalCase models.EvalCase, output, graderModel string) evalCheck {
+	prompt := fmt.Sprintf("Criteria:\n%s\n\nPrompt given to the assistant:\n%s\n\nAssistant's answer:\n%s",
+		evalCase.GraderPrompt, evalCase.Prompt, output)
+
+	stream := false
+	req := &api.ChatRequest{
+		Model: graderModel,
+		Messages: []api.Message{
+			{Role: "system", Content: graderSystemPrompt},
+			{Role: "user", Content: prompt},
+		},
+		Stream:  &stream,
+		Options: map[string]any{"temperature": 0},
+	}
+
+	var verdict string
+	err := s.client.Chat(ctx, req, func(resp api.ChatResponse) error {
+		verdict += resp.Message.Content
+		return nil
+	})
+	if err != nil {
+		return evalCheck{reason: "grader failed: " + err.Error()}
+	}
+
+	verdict = strings.TrimSpace(verdict)
+	first, rest, _ := strings.Cut(verdict, "\n")
+	reason := strings.TrimSpace(rest)
+	switch upper := strings.ToUpper(strings.TrimSpace(first)); {
+	case strings.HasPrefix(upper, "PASS"):
+		return evalCheck{passed: true}
+	case strings.HasPrefix(upper, "FAIL"):
+		if reason == "" {
+			reason = "grader: fail"
+		} else {
+			reason = "grader: " + reason
+		}
+		return evalCheck{reason: reason}
+	default:
+		return evalCheck{reason: "grader gave no verdict: " + first}
+	}
+}
+
+// jsonFence matches a fenced code block so JSON wrapped in markdown still parses
+var jsonFence = regexp.MustCompile("(?s)```(?:json)?\\s*(.*?)```")
+
+// checkJSONSchema parses output as JSON and validates it against schema
+func checkJSONSchema(output string, schema json.RawMessage) evalCheck {
+	text := strings.TrimSpace(output)
+	if m := jsonFence.FindStringSubmatch(text); m != nil {
+		text = strings.TrimSpace(m[1])
+	}
+
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return evalCheck{reason: "output is not valid JSON"}
+	}
+
+	var schemaValue map[string]any
+	if err := json.Unmarshal(schema, &schemaValue); err != nil {
+		return evalCheck{reason: "invalid schema: " + err.Error()}
+	}
+
+	if err := validateJSONSchema(value, schemaValue, "$"); err != nil {
+		return evalCheck{reason: err.Error()}
+	}
+	return evalCheck{passed: true}
+}
+
+// validateJSONSchema checks value against the common subset of JSON Schema:
+// type, enum, required, properties, additionalProperties (false), items,
+// minItems and maxItems
+func validateJSONSchema(value any, schema map[string]any, path string) error {
+	if t, ok := schema["type"]; ok {
+		var types []string
+		switch tv := t.(type) {
+		case string:
+			types = []string{tv}
+		case []any:
+			for _, item := range tv {
+				if s, ok := item.(string); ok {
+					types = append(types, s)
+				}
+			}
+		}
+		matched := false
+		for _, typ := range types {
+			if jsonTypeMatches(value, typ) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: expected %s", path, strings.Join(types, " or "))
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, allowed := range enum {
+			if jsonEqual(value, allowed) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value not in enum", path)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		if required, ok := schema["required"].([]any); ok {
+			for _, r := range required {
+				if name, ok := r.(string); ok {
+					if _, present := v[name]; !present {
+						return fmt.Errorf("%s: missing required property %q", path, name)
+					}
+				}
+			}
+		}
+
+		props, _ := schema["properties"].(map[string]any)
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			propSchema, known := props[k].(map[string]any)
+			if !known {
+				if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+					return fmt.Errorf("%s: unexpected property %q", path, k)
+				}
+				continue
+			}
+			if err := validateJSONSchema(v[k], propSchema, path+"."+k); err != nil {
+				return err
+			}
+		}
+
+	case []any:
+		if min, ok := schema["minItems"].(float64); ok && float64(len(v)) < min {
+			return fmt.Errorf("%s: expected at least %g items", path, min)
+		}
+		if max, ok := schema["maxItems"].(float64); ok && float64(len(v)) > max {
+			return fmt.Errorf("%s: expected at most %g items", path, max)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				if err := validateJSONSchema(item, items, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// jsonTypeMatches reports whether a decoded JSON value has the given schema type
+func jsonTypeMatches(value any, typ string) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == math.Trunc(f)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return false
+}
+
+// jsonEqual compares two decoded JSON values
+func jsonEqual(a, b any) bool {
+	aj, errA := json.Marshal(a)
+	bj, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(aj) == string(bj)
+}
@@ -0,0 +1,576 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/models"
+)
+
+// Limits for eval suites and runs
+const (
+	maxEvalCases   = 200
+	maxEvalTargets = 8
+)
+
+// Eval run checkpointing. The case being generated is streamed and its
+// partial output saved, so after a restart or while the backend is down the
+// generation continues where it stopped instead of starting over.
+const (
+	// evalCheckpointInterval is how often a case's partial output is saved
+	evalCheckpointInterval = 10 * time.Second
+	// evalRetryDelay is the first wait before retrying a case while the
+	// backend is unavailable; it doubles up to evalMaxRetryDelay
+	evalRetryDelay    = 5 * time.Second
+	evalMaxRetryDelay = time.Minute
+	// evalOutageTimeout is how long a run waits for the backend to come back
+	// before it fails
+	evalOutageTimeout = 30 * time.Minute
+)
+
+// evalRunner executes eval runs one at a time in the background so they
+// don't compete with each other (or starve interactive chats) for the GPU
+type evalRunner struct {
+	slot chan struct{}
+
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+// newEvalRunner creates a runner that executes one run at a time
+func newEvalRunner() *evalRunner {
+	return &evalRunner{
+		slot:    make(chan struct{}, 1),
+		cancels: make(map[string]context.CancelFunc),
+	}
+}
+
+// EvalSuiteRequest is the request body for creating or replacing a suite
+type EvalSuiteRequest struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Cases       []models.EvalCase `json:"cases"`
+}
+
+// StartEvalRunRequest is the request body for running a suite
+type StartEvalRunRequest struct {
+	Targets []models.EvalTarget `json:"targets"`
+	// GraderModel judges cases with a grader_prompt
+	GraderModel string `json:"grader_model,omitempty"`
+}
+
+// ListEvalSuitesHandler returns all eval suites
+func ListEvalSuitesHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		suites, err := models.ListEvalSuites(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"suites": suites})
+	}
+}
+
+// GetEvalSuiteHandler returns a single eval suite
+func GetEvalSuiteHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		suite, err := models.GetEvalSuite(db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if suite == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "eval suite not found"})
+			return
+		}
+		c.JSON(http.StatusOK, suite)
+	}
+}
+
+// CreateEvalSuiteHandler creates an eval suite
+func CreateEvalSuiteHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req EvalSuiteRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+		if fieldErrs := validateEvalSuite(&req); len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+
+		suite := &models.EvalSuite{Name: req.Name, Description: req.Description, Cases: req.Cases}
+		if err := models.CreateEvalSuite(db, suite); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, suite)
+	}
+}
+
+// UpdateEvalSuiteHandler replaces a suite's name, description and cases.
+// Past runs keep their results; case indexes refer to the cases at run time.
+func UpdateEvalSuiteHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		suite, err := models.GetEvalSuite(db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if suite == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "eval suite not found"})
+			return
+		}
+
+		var req EvalSuiteRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+		if fieldErrs := validateEvalSuite(&req); len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+
+		suite.Name = req.Name
+		suite.Description = req.Description
+		suite.Cases = req.Cases
+		if err := models.UpdateEvalSuite(db, suite); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, suite)
+	}
+}
+
+// DeleteEvalSuiteHandler deletes a suite with its run history
+func DeleteEvalSuiteHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := models.DeleteEvalSuite(db, c.Param("id")); err != nil {
+			if err.Error() == "eval suite not found" {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "eval suite deleted"})
+	}
+}
+
+// ListEvalRunsHandler returns run history with aggregate scores.
+// Query params: suite_id (optional), limit (default 50, max 200).
+func ListEvalRunsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := 50
+		if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 200 {
+			limit = l
+		}
+
+		runs, err := models.ListEvalRuns(db, c.Query("suite_id"), limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"runs": runs})
+	}
+}
+
+// GetEvalRunHandler returns a run with its scores and per-case results
+func GetEvalRunHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		run, err := models.GetEvalRun(db, c.Param("id"), true)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if run == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "eval run not found"})
+			return
+		}
+		c.JSON(http.StatusOK, run)
+	}
+}
+
+// StartEvalRunHandler queues a run of a suite against the given targets and
+// returns immediately; poll GET /evals/runs/:id for progress
+func (s *OllamaService) StartEvalRunHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		suite, err := models.GetEvalSuite(s.db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if suite == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "eval suite not found"})
+			return
+		}
+
+		var req StartEvalRunRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+		if fieldErrs := validateEvalRun(&req, suite); len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+
+		run := &models.EvalRun{SuiteID: suite.ID, Targets: req.Targets, GraderModel: req.GraderModel}
+		if err := models.CreateEvalRun(s.db, run); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		s.startEvalRun(run, suite)
+		c.JSON(http.StatusAccepted, run)
+	}
+}
+
+// startEvalRun executes a run in the background
+func (s *OllamaService) startEvalRun(run *models.EvalRun, suite *models.EvalSuite) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.evals.mu.Lock()
+	s.evals.cancels[run.ID] = cancel
+	s.evals.mu.Unlock()
+
+	go s.executeEvalRun(ctx, run, suite)
+}
+
+// ResumeEvalRuns queues the runs a previous process left unfinished again.
+// They skip the cases that already have results, and the case that was
+// being generated continues from its checkpoint. Runs whose suite was
+// edited since resume with the suite's current cases. In maintenance mode
+// this waits until it is turned off.
+func (s *OllamaService) ResumeEvalRuns() {
+	if s.db == nil {
+		return
+	}
+	if InMaintenance() {
+		go func() {
+			waitOutMaintenance(context.Background())
+			s.ResumeEvalRuns()
+		}()
+		return
+	}
+	runs, err := models.ListInterruptedEvalRuns(s.db)
+	if err != nil {
+		log.Printf("[Evals] %v", err)
+		return
+	}
+	for i := range runs {
+		run := &runs[i]
+		suite, err := models.GetEvalSuite(s.db, run.SuiteID)
+		if err != nil || suite == nil {
+			s.finishEvalRun(run.ID, models.EvalStatusFailed, "interrupted by server restart")
+			continue
+		}
+		if err := models.SetEvalRunStatus(s.db, run.ID, models.EvalStatusQueued, ""); err != nil {
+			log.Printf("[Evals] %v", err)
+		}
+		log.Printf("[Evals] Resuming run %s of suite %q", run.ID, suite.Name)
+		s.startEvalRun(run, suite)
+	}
+}
+
+// CancelEvalRunHandler stops a queued or running eval run
+func (s *OllamaService) CancelEvalRunHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.evals.mu.Lock()
+		cancel, ok := s.evals.cancels[c.Param("id")]
+		s.evals.mu.Unlock()
+
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "eval run not active"})
+			return
+		}
+		cancel()
+		c.JSON(http.StatusOK, gin.H{"message": "eval run cancelled"})
+	}
+}
+
+// executeEvalRun waits for the runner slot, then runs every case against
+// every target and records the results. Cases with results are skipped, so
+// a resumed run continues where it stopped.
+func (s *OllamaService) executeEvalRun(ctx context.Context, run *models.EvalRun, suite *models.EvalSuite) {
+	defer func() {
+		s.evals.mu.Lock()
+		if cancel, ok := s.evals.cancels[run.ID]; ok {
+			cancel()
+			delete(s.evals.cancels, run.ID)
+		}
+		s.evals.mu.Unlock()
+	}()
+
+	if waitOutMaintenance(ctx) != nil {
+		s.finishEvalRun(run.ID, models.EvalStatusCancelled, "")
+		return
+	}
+	select {
+	case s.evals.slot <- struct{}{}:
+		defer func() { <-s.evals.slot }()
+	case <-ctx.Done():
+		s.finishEvalRun(run.ID, models.EvalStatusCancelled, "")
+		return
+	}
+
+	if err := models.SetEvalRunStatus(s.db, run.ID, models.EvalStatusRunning, ""); err != nil {
+		log.Printf("[Evals] %v", err)
+	}
+	done, err := models.CompletedEvalCases(s.db, run.ID)
+	if err != nil {
+		s.finishEvalRun(run.ID, models.EvalStatusFailed, err.Error())
+		return
+	}
+	checkpoint, err := models.GetEvalCheckpoint(s.db, run.ID)
+	if err != nil {
+		log.Printf("[Evals] %v", err)
+	}
+
+	for t, target := range run.Targets {
+		for i, evalCase := range suite.Cases {
+			if done[[2]int{t, i}] {
+				continue
+			}
+			// Pause between cases while maintenance mode is enabled
+			if waitOutMaintenance(ctx) != nil {
+				s.finishEvalRun(run.ID, models.EvalStatusCancelled, "")
+				return
+			}
+
+			cp := &models.EvalCheckpoint{TargetIndex: t, CaseIndex: i}
+			if checkpoint != nil && checkpoint.TargetIndex == t && checkpoint.CaseIndex == i {
+				cp = checkpoint
+			}
+			result, err := s.runEvalCase(ctx, run.ID, target, evalCase, run.GraderModel, cp)
+			if err != nil {
+				if ctx.Err() != nil {
+					s.finishEvalRun(run.ID, models.EvalStatusCancelled, "")
+				} else {
+					s.finishEvalRun(run.ID, models.EvalStatusFailed, err.Error())
+				}
+				return
+			}
+			result.TargetIndex, result.CaseIndex = t, i
+			if err := models.SaveEvalResult(s.db, run.ID, result); err != nil {
+				s.finishEvalRun(run.ID, models.EvalStatusFailed, err.Error())
+				return
+			}
+		}
+	}
+
+	s.finishEvalRun(run.ID, models.EvalStatusCompleted, "")
+}
+
+// finishEvalRun records a run's final status and drops its checkpoint
+func (s *OllamaService) finishEvalRun(id, status, errMsg string) {
+	if err := models.SetEvalRunStatus(s.db, id, status, errMsg); err != nil {
+		log.Printf("[Evals] %v", err)
+	}
+	if err := models.ClearEvalCheckpoint(s.db, id); err != nil {
+		log.Printf("[Evals] %v", err)
+	}
+}
+
+// runEvalCase sends one case to a target and grades the output. The output
+// continues from the checkpoint's, and while the backend is unavailable the
+// case is retried from its latest checkpoint. It returns an error, rather
+// than a failed result, only when the run can't go on: it was cancelled or
+// the backend stayed down for evalOutageTimeout.
+func (s *OllamaService) runEvalCase(ctx context.Context, runID string, target models.EvalTarget, evalCase models.EvalCase, graderModel string, cp *models.EvalCheckpoint) (*models.EvalResult, error) {
+	result := &models.EvalResult{Backend: target.Backend, Model: target.Model}
+
+	var outageStart time.Time
+	delay := evalRetryDelay
+	for {
+		err := s.generateEvalOutput(ctx, runID, target, evalCase, cp)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !isBackendOutage(err) {
+			result.Output, result.LatencyMs, result.Error = cp.Output, cp.ElapsedMs, err.Error()
+			return result, nil
+		}
+
+		if outageStart.IsZero() {
+			outageStart = time.Now()
+		} else if time.Since(outageStart) > evalOutageTimeout {
+			return nil, fmt.Errorf("backend unavailable for %s: %w", evalOutageTimeout, err)
+		}
+		log.Printf("[Evals] Run %s: backend unavailable (%v), retrying in %s", runID, err, delay)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, evalMaxRetryDelay)
+	}
+
+	result.Output, result.LatencyMs = cp.Output, cp.ElapsedMs
+	result.Passed, result.Score, result.Reason = s.gradeEvalCase(ctx, evalCase, result.Output, graderModel)
+	return result, nil
+}
+
+// generateEvalOutput streams a case's output onto the checkpoint, saving it
+// every evalCheckpointInterval and when the generation fails. Output from
+// an earlier attempt is sent as an assistant prefill to continue from.
+func (s *OllamaService) generateEvalOutput(ctx context.Context, runID string, target models.EvalTarget, evalCase models.EvalCase, cp *models.EvalCheckpoint) error {
+	var messages []api.Message
+	if evalCase.System != "" {
+		messages = append(messages, api.Message{Role: "system", Content: evalCase.System})
+	}
+	messages = append(messages, api.Message{Role: "user", Content: evalCase.Prompt})
+	if cp.Output != "" {
+		messages = append(messages, api.Message{Role: "assistant", Content: cp.Output})
+	}
+
+	stream := true
+	req := &api.ChatRequest{
+		Model:    target.Model,
+		Messages: messages,
+		Stream:   &stream,
+		Options:  target.Options,
+	}
+	if len(evalCase.ExpectSchema) > 0 {
+		req.Format = json.RawMessage(`"json"`)
+	}
+
+	var output strings.Builder
+	output.WriteString(cp.Output)
+	elapsed := cp.ElapsedMs
+	start := time.Now()
+	lastSaved := start
+	checkpoint := func() {
+		cp.Output = output.String()
+		cp.ElapsedMs = elapsed + time.Since(start).Milliseconds()
+		if err := models.SaveEvalCheckpoint(s.db, runID, cp); err != nil {
+			log.Printf("[Evals] %v", err)
+		}
+	}
+
+	done := false
+	err := s.client.Chat(ctx, req, func(resp api.ChatResponse) error {
+		output.WriteString(resp.Message.Content)
+		done = resp.Done
+		if time.Since(lastSaved) >= evalCheckpointInterval {
+			checkpoint()
+			lastSaved = time.Now()
+		}
+		return nil
+	})
+	if err == nil && !done {
+		// The client ends a stream that broke off without an error
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		checkpoint()
+		return err
+	}
+	cp.Output = output.String()
+	cp.ElapsedMs = elapsed + time.Since(start).Milliseconds()
+	return nil
+}
+
+// isBackendOutage reports whether a failed request means the backend is
+// down or restarting, rather than that the request itself failed: the
+// connection failed or broke off, the circuit is open or the backend
+// answered with a server error (e.g. the model runner stopped)
+func isBackendOutage(err error) bool {
+	var statusErr api.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.Is(err, ErrCircuitOpen) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr)
+}
+
+// validateEvalSuite checks a suite definition
+func validateEvalSuite(req *EvalSuiteRequest) []FieldError {
+	var errs []FieldError
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		errs = append(errs, FieldError{Field: "name", Message: "name is required"})
+	}
+
+	switch {
+	case len(req.Cases) == 0:
+		errs = append(errs, FieldError{Field: "cases", Message: "at least one case is required"})
+	case len(req.Cases) > maxEvalCases:
+		errs = append(errs, FieldError{
+			Field:   "cases",
+			Message: fmt.Sprintf("at most %d cases are allowed", maxEvalCases),
+		})
+	}
+
+	for i, evalCase := range req.Cases {
+		field := fmt.Sprintf("cases[%d]", i)
+		if strings.TrimSpace(evalCase.Prompt) == "" {
+			errs = append(errs, FieldError{Field: field + ".prompt", Message: "prompt is required"})
+		}
+		if evalCase.ExpectPattern != "" {
+			if _, err := regexp.Compile(evalCase.ExpectPattern); err != nil {
+				errs = append(errs, FieldError{Field: field + ".expect_pattern", Message: "invalid regular expression: " + err.Error()})
+			}
+		}
+		if len(evalCase.ExpectSchema) > 0 {
+			var schema map[string]any
+			if err := json.Unmarshal(evalCase.ExpectSchema, &schema); err != nil {
+				errs = append(errs, FieldError{Field: field + ".expect_schema", Message: "must be a JSON object"})
+			}
+		}
+	}
+
+	return errs
+}
+
+// validateEvalRun checks run targets and requires a grader model when any
+// case uses a grader prompt
+func validateEvalRun(req *StartEvalRunRequest, suite *models.EvalSuite) []FieldError {
+	var errs []FieldError
+
+	switch {
+	case len(req.Targets) == 0:
+		errs = append(errs, FieldError{Field: "targets", Message: "at least one target is required"})
+	case len(req.Targets) > maxEvalTargets:
+		errs = append(errs, FieldError{
+			Field:   "targets",
+			Message: fmt.Sprintf("at most %d targets are allowed", maxEvalTargets),
+		})
+	}
+
+	for i := range req.Targets {
+		target := &req.Targets[i]
+		errs = append(errs, validateTarget(fmt.Sprintf("targets[%d]", i), &target.Backend, target.Model, target.Options)...)
+	}
+
+	if strings.TrimSpace(req.GraderModel) == "" {
+		for _, evalCase := range suite.Cases {
+			if evalCase.GraderPrompt != "" {
+				errs = append(errs, FieldError{Field: "grader_model", Message: "required because the suite has grader prompts"})
+				break
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"vessel-backend/internal/encryption"
+	"vessel-backend/internal/models"
+)
+
+// ExportPasswordHeader carries the password an export is encrypted with.
+// Exports requested with it are downloaded as password-protected archives
+// (see encryption.NewArchiveWriter) that are safe to keep in cloud storage;
+// `vesselctl decrypt` turns them back into the plain file.
+const ExportPasswordHeader = "X-Export-Password"
+
+const (
+	// chatExportFormat identifies chat exports
+	chatExportFormat = "vessel-chats"
+	// chatExportVersion is the layout version written by chat exports
+	chatExportVersion = 1
+)
+
+// ChatExportRequest selects the chats to export; all of them (without
+// archived chats unless asked for) when ChatIDs is empty
+type ChatExportRequest struct {
+	ChatIDs         []string `json:"chat_ids"`
+	IncludeArchived bool     `json:"include_archived"`
+}
+
+// ChatExport is the document written by a chat export
+type ChatExport struct {
+	Format     string        `json:"format"`
+	Version    int           `json:"version"`
+	ExportedAt time.Time     `json:"exported_at"`
+	Chats      []models.Chat `json:"chats"`
+}
+
+// exportPassword returns the password an export was requested with, or ""
+// for a plain export. It responds with a validation error, returning false,
+// when the password is too short.
+func exportPassword(c *gin.Context) (string, bool) {
+	password := c.GetHeader(ExportPasswordHeader)
+	if password != "" && len(password) < encryption.MinArchivePasswordLength {
+		respondValidationError(c, []FieldError{{
+			Field:   ExportPasswordHeader,
+			Message: fmt.Sprintf("must be at least %d characters", encryption.MinArchivePasswordLength),
+		}})
+		return "", false
+	}
+	return password, true
+}
+
+// startExport starts an export download of filename. With a password the
+// content is encrypted: the download is an octet-stream named filename plus
+// encryption.ArchiveExtension. The returned finish func must be called once
+// the content is written; after an error the response has been aborted.
+func startExport(c *gin.Context, filename, contentType, password string) (io.Writer, func(), error) {
+	if password == "" {
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		c.Status(http.StatusOK)
+		return c.Writer, func() {}, nil
+	}
+
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s%s"`, filename, encryption.ArchiveExtension))
+	c.Status(http.StatusOK)
+	archive, err := encryption.NewArchiveWriter(c.Writer, password)
+	if err != nil {
+		c.Abort()
+		return nil, nil, err
+	}
+	return archive, func() { archive.Close() }, nil
+}
+
+// ExportChatsHandler downloads chats with all their messages as one JSON
+// document, optionally encrypted with ExportPasswordHeader
+func ExportChatsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ChatExportRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+				return
+			}
+		}
+		password, ok := exportPassword(c)
+		if !ok {
+			return
+		}
+
+		chatIDs := req.ChatIDs
+		if len(chatIDs) == 0 {
+			chats, err := models.ListChats(db, req.IncludeArchived, "")
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			for _, chat := range chats {
+				chatIDs = append(chatIDs, chat.ID)
+			}
+		}
+
+		export := ChatExport{
+			Format:     chatExportFormat,
+			Version:    chatExportVersion,
+			ExportedAt: time.Now().UTC(),
+			Chats:      make([]models.Chat, 0, len(chatIDs)),
+		}
+		for _, id := range chatIDs {
+			chat, err := models.GetChat(db, id)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if chat == nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "chat not found: " + id})
+				return
+			}
+			export.Chats = append(export.Chats, *chat)
+		}
+
+		filename := fmt.Sprintf("chats-%s.json", export.ExportedAt.Format("20060102"))
+		w, finish, err := startExport(c, filename, "application/json", password)
+		if err != nil {
+			return
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(export); err != nil {
+			return
+		}
+		finish()
+	}
+}
+
+// decryptUpload returns the path of an uploaded file's plain content. Files
+// that are password-protected archives are decrypted with the password in
+// ExportPasswordHeader into a new temporary file, which the caller removes;
+// other files are returned as they are. On error a response has been
+// written.
+func decryptUpload(c *gin.Context, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return "", err
+	}
+	defer f.Close()
+
+	magic := make([]byte, len(encryption.ArchiveMagic))
+	if n, _ := io.ReadFull(f, magic); !encryption.IsArchive(magic[:n]) {
+		return path, nil
+	}
+	password := c.GetHeader(ExportPasswordHeader)
+	if password == "" {
+		err := errors.New("the file is password-protected")
+		respondValidationError(c, []FieldError{{Field: ExportPasswordHeader, Message: "is required to open a password-protected file"}})
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return "", err
+	}
+
+	reader, err := encryption.NewArchiveReader(f, password)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", err
+	}
+	plain, err := os.CreateTemp("", "vessel-decrypted-*")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return "", err
+	}
+	defer plain.Close()
+	if _, err := io.Copy(plain, reader); err != nil {
+		os.Remove(plain.Name())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to decrypt file: " + err.Error()})
+		return "", err
+	}
+	return plain.Name(), nil
+}
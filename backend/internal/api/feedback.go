@@ -0,0 +1,288 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"vessel-backend/internal/models"
+)
+
+const (
+	// maxFeedbackTags caps how many tags one message can carry
+	maxFeedbackTags = 20
+	// maxFeedbackTagLength caps the length of a single tag
+	maxFeedbackTagLength = 64
+	// maxFeedbackNoteLength caps the length of a feedback note
+	maxFeedbackNoteLength = 10000
+)
+
+// MessageFeedbackRequest is the request body for setting a message's feedback
+type MessageFeedbackRequest struct {
+	// Rating is 1 (thumbs up), -1 (thumbs down) or 0 (no rating)
+	Rating int      `json:"rating"`
+	Note   string   `json:"note,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// FeedbackExample is one exported feedback entry with the messages it rates
+type FeedbackExample struct {
+	models.MessageFeedback
+	Prompt   string `json:"prompt,omitempty"`
+	Response string `json:"response"`
+}
+
+// validateFeedback checks a feedback request and normalizes its tags:
+// trimmed, lowercased and without duplicates
+func validateFeedback(req *MessageFeedbackRequest) []FieldError {
+	var errs []FieldError
+	if req.Rating < models.FeedbackNegative || req.Rating > models.FeedbackPositive {
+		errs = append(errs, FieldError{Field: "rating", Message: "must be -1, 0 or 1"})
+	}
+	if len(req.Note) > maxFeedbackNoteLength {
+		errs = append(errs, FieldError{Field: "note", Message: fmt.Sprintf("must be at most %d characters", maxFeedbackNoteLength)})
+	}
+
+	seen := make(map[string]bool)
+	tags := []string{}
+	for i, tag := range req.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		switch {
+		case tag == "":
+			errs = append(errs, FieldError{Field: fmt.Sprintf("tags[%d]", i), Message: "must not be empty"})
+		case len(tag) > maxFeedbackTagLength:
+			errs = append(errs, FieldError{Field: fmt.Sprintf("tags[%d]", i), Message: fmt.Sprintf("must be at most %d characters", maxFeedbackTagLength)})
+		case !seen[tag]:
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > maxFeedbackTags {
+		errs = append(errs, FieldError{Field: "tags", Message: fmt.Sprintf("at most %d tags are allowed", maxFeedbackTags)})
+	}
+	req.Tags = tags
+	return errs
+}
+
+// SetMessageFeedbackHandler sets or replaces the feedback on a message
+func SetMessageFeedbackHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chatID, messageID := c.Param("id"), c.Param("messageId")
+
+		var req MessageFeedbackRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+		if fieldErrs := validateFeedback(&req); len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+
+		msg, err := models.GetMessage(db, chatID, messageID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if msg == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+			return
+		}
+
+		feedback := &models.MessageFeedback{
+			MessageID: messageID,
+			ChatID:    chatID,
+			Rating:    req.Rating,
+			Note:      strings.TrimSpace(req.Note),
+			Tags:      req.Tags,
+		}
+		if err := models.SetMessageFeedback(db, feedback); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		saved, err := models.GetMessageFeedback(db, chatID, messageID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, saved)
+	}
+}
+
+// GetMessageFeedbackHandler returns the feedback on a message
+func GetMessageFeedbackHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		feedback, err := models.GetMessageFeedback(db, c.Param("id"), c.Param("messageId"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if feedback == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "feedback not found"})
+			return
+		}
+		c.JSON(http.StatusOK, feedback)
+	}
+}
+
+// DeleteMessageFeedbackHandler removes the feedback on a message
+func DeleteMessageFeedbackHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := models.DeleteMessageFeedback(db, c.Param("id"), c.Param("messageId")); err != nil {
+			if err.Error() == "feedback not found" {
+				c.JSON(http.StatusNotFound, gin.H{"error": "feedback not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "feedback deleted"})
+	}
+}
+
+// ListChatFeedbackHandler returns the feedback on a chat's messages
+func ListChatFeedbackHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		feedback, err := models.ListFeedback(db, models.FeedbackFilter{ChatID: c.Param("id")})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"feedback": feedback})
+	}
+}
+
+// feedbackFilterFromQuery reads ?chat_id, ?rating (up, down, neutral or
+// -1/0/1), ?tag and ?model
+func feedbackFilterFromQuery(c *gin.Context) (models.FeedbackFilter, []FieldError) {
+	filter := models.FeedbackFilter{
+		ChatID: c.Query("chat_id"),
+		Tag:    strings.ToLower(strings.TrimSpace(c.Query("tag"))),
+		Model:  c.Query("model"),
+	}
+
+	var rating int
+	switch c.Query("rating") {
+	case "":
+		return filter, nil
+	case "up", "1", "positive":
+		rating = models.FeedbackPositive
+	case "down", "-1", "negative":
+		rating = models.FeedbackNegative
+	case "neutral", "0":
+		rating = models.FeedbackNeutral
+	default:
+		return filter, []FieldError{{Field: "rating", Message: "must be up, down or neutral"}}
+	}
+	filter.Rating = &rating
+	return filter, nil
+}
+
+// ListFeedbackHandler returns feedback across all chats, filtered by query parameters
+func ListFeedbackHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, fieldErrs := feedbackFilterFromQuery(c)
+		if len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+
+		feedback, err := models.ListFeedback(db, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"feedback": feedback})
+	}
+}
+
+// FeedbackSummaryHandler aggregates feedback overall, per model and per tag
+func FeedbackSummaryHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, fieldErrs := feedbackFilterFromQuery(c)
+		if len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+
+		summary, err := models.SummarizeFeedback(db, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, summary)
+	}
+}
+
+// ExportFeedbackHandler downloads feedback as JSONL, one entry per line with
+// the rated response and the prompt it answered
+func ExportFeedbackHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, fieldErrs := feedbackFilterFromQuery(c)
+		if len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+
+		password, ok := exportPassword(c)
+		if !ok {
+			return
+		}
+
+		feedback, err := models.ListFeedback(db, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		filename := fmt.Sprintf("feedback-%s.jsonl", time.Now().UTC().Format("20060102"))
+		w, finish, err := startExport(c, filename, "application/x-ndjson", password)
+		if err != nil {
+			return
+		}
+		defer finish()
+
+		enc := json.NewEncoder(w)
+		for _, f := range feedback {
+			example, err := feedbackExample(db, f)
+			if err != nil {
+				// The response has started; skip entries that can't be read
+				log.Printf("[Feedback] %v", err)
+				continue
+			}
+			if err := enc.Encode(example); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// feedbackExample loads the rated message and its parent for export
+func feedbackExample(db *sql.DB, f models.MessageFeedback) (*FeedbackExample, error) {
+	msg, err := models.GetMessage(db, f.ChatID, f.MessageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		return nil, fmt.Errorf("message %s not found", f.MessageID)
+	}
+
+	example := &FeedbackExample{MessageFeedback: f, Response: msg.Content}
+	if msg.ParentID != nil {
+		parent, err := models.GetMessage(db, f.ChatID, *msg.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent != nil {
+			example.Prompt = parent.Content
+		}
+	}
+	return example, nil
+}
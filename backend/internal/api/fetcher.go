@@ -226,6 +226,10 @@ func (f *Fetcher) HasChrome() bool {
 // Fetch fetches a URL using the best available method
 // For most sites, uses curl/wget. Falls back to headless browser for JS-heavy sites.
 func (f *Fetcher) Fetch(ctx context.Context, url string, opts FetchOptions) (*FetchResult, error) {
+	if err := checkOnline(); err != nil {
+		return nil, err
+	}
+
 	// If force headless is set and Chrome is available, use it directly
 	if opts.ForceHeadless && f.hasChrome {
 		return f.fetchWithChrome(ctx, url, opts)
@@ -648,6 +652,9 @@ func (f *Fetcher) fetchNative(ctx context.Context, url string, opts FetchOptions
 
 // FetchWithHeadless explicitly uses headless browser (for API use)
 func (f *Fetcher) FetchWithHeadless(ctx context.Context, url string, opts FetchOptions) (*FetchResult, error) {
+	if err := checkOnline(); err != nil {
+		return nil, err
+	}
 	if !f.hasChrome {
 		return nil, fmt.Errorf("headless Chrome not available - Chrome/Chromium not found")
 	}
@@ -656,6 +663,9 @@ func (f *Fetcher) FetchWithHeadless(ctx context.Context, url string, opts FetchO
 
 // TryFetchWithFallback attempts to fetch using all available methods
 func (f *Fetcher) TryFetchWithFallback(ctx context.Context, url string, opts FetchOptions) (*FetchResult, error) {
+	if err := checkOnline(); err != nil {
+		return nil, err
+	}
 	f.mu.RLock()
 	curlPath := f.curlPath
 	wgetPath := f.wgetPath
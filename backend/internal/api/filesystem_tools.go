@@ -0,0 +1,501 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/models"
+)
+
+// Limits on the filesystem tools
+const (
+	// fsMaxReadBytes is the most a read returns; larger files are read in
+	// pieces with offset
+	fsMaxReadBytes = 256 * 1024
+	// fsMaxWriteBytes caps the content of a write
+	fsMaxWriteBytes = 1024 * 1024
+	// fsMaxListEntries caps a directory listing
+	fsMaxListEntries = 1000
+	// fsAuditDefaultLimit is how many audit entries are listed by default
+	fsAuditDefaultLimit = 100
+)
+
+// errFilesystemDenied is returned for paths outside the agent's directories
+// and writes to read-only ones
+var errFilesystemDenied = errors.New("access denied")
+
+// filesystemTools are the Ollama tool definitions for the filesystem tools
+var filesystemTools = map[string]api.Tool{
+	models.FilesystemList: {
+		Type: "function",
+		Function: api.ToolFunction{
+			Name:        "list_directory",
+			Description: "List the files and directories in a directory you have been given access to.",
+			Parameters: api.ToolFunctionParameters{
+				Type:     "object",
+				Required: []string{"path"},
+				Properties: map[string]api.ToolProperty{
+					"path": {Type: api.PropertyType{"string"}, Description: "Absolute path, or a path relative to your first directory"},
+				},
+			},
+		},
+	},
+	models.FilesystemRead: {
+		Type: "function",
+		Function: api.ToolFunction{
+			Name:        "read_file",
+			Description: fmt.Sprintf("Read a file you have been given access to, at most %d KiB at a time.", fsMaxReadBytes/1024),
+			Parameters: api.ToolFunctionParameters{
+				Type:     "object",
+				Required: []string{"path"},
+				Properties: map[string]api.ToolProperty{
+					"path":   {Type: api.PropertyType{"string"}, Description: "Absolute path, or a path relative to your first directory"},
+					"offset": {Type: api.PropertyType{"integer"}, Description: "Byte offset to start reading at, to continue a truncated read"},
+				},
+			},
+		},
+	},
+	models.FilesystemWrite: {
+		Type: "function",
+		Function: api.ToolFunction{
+			Name:        "write_file",
+			Description: "Create or overwrite a file in a writable directory you have been given access to.",
+			Parameters: api.ToolFunctionParameters{
+				Type:     "object",
+				Required: []string{"path", "content"},
+				Properties: map[string]api.ToolProperty{
+					"path":    {Type: api.PropertyType{"string"}, Description: "Absolute path, or a path relative to your first directory"},
+					"content": {Type: api.PropertyType{"string"}, Description: "The file's new content"},
+					"append":  {Type: api.PropertyType{"boolean"}, Description: "Add to the end of the file instead of replacing it"},
+				},
+			},
+		},
+	},
+}
+
+// FilesystemToolRequest is the request body for the filesystem tools
+type FilesystemToolRequest struct {
+	AgentID string `json:"agent_id"`
+	// Path is absolute, or relative to the agent's first directory
+	Path string `json:"path"`
+	// Offset is where a read starts
+	Offset int64 `json:"offset,omitempty"`
+	// Content is written, decoded first when Encoding is "base64"
+	Content  string `json:"content,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	// Append adds the content to the end of the file
+	Append bool `json:"append,omitempty"`
+}
+
+// FileEntry is an entry of a directory listing
+type FileEntry struct {
+	Name string `json:"name"`
+	// Type is file, directory, symlink or other
+	Type     string    `json:"type"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// AddAgentDirectoryRequest is the request body for giving an agent a
+// directory
+type AddAgentDirectoryRequest struct {
+	Path     string `json:"path"`
+	Writable bool   `json:"writable"`
+}
+
+// resolveAgentPath finds the agent directory a path is in, and the path
+// relative to it. Relative paths are taken from the agent's first
+// directory. The path is only checked lexically here; symlinkEscapes and
+// os.Root keep symlinks from leading out of the directory.
+func resolveAgentPath(dirs []models.AgentDirectory, path string) (*models.AgentDirectory, string, error) {
+	if len(dirs) == 0 {
+		return nil, "", fmt.Errorf("%w: the agent has no directories", errFilesystemDenied)
+	}
+	path = strings.TrimSpace(path)
+	if path == "" {
+		path = "."
+	}
+	if !filepath.IsAbs(path) {
+		if !filepath.IsLocal(path) && path != "." {
+			return nil, "", fmt.Errorf("%w: %s is outside the agent's directories", errFilesystemDenied, path)
+		}
+		// Resolved like an absolute path, so a directory nested in the
+		// first one still decides for the paths inside it
+		path = filepath.Join(dirs[0].Path, path)
+	}
+
+	path = filepath.Clean(path)
+	var best *models.AgentDirectory
+	var bestRel string
+	for i := range dirs {
+		rel, err := filepath.Rel(dirs[i].Path, path)
+		if err != nil || !(rel == "." || filepath.IsLocal(rel)) {
+			continue
+		}
+		// The innermost directory decides, so a writable subdirectory of a
+		// read-only one stays writable
+		if best == nil || len(dirs[i].Path) > len(best.Path) {
+			best, bestRel = &dirs[i], rel
+		}
+	}
+	if best == nil {
+		return nil, "", fmt.Errorf("%w: %s is outside the agent's directories", errFilesystemDenied, path)
+	}
+	return best, bestRel, nil
+}
+
+// symlinkEscapes reports whether following the symlinks along rel leads out
+// of dir. Components that don't exist yet, such as a file about to be
+// written, can't be links and are taken as they are.
+func symlinkEscapes(dir, rel string) bool {
+	base, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		// Opening the directory fails the same way
+		return false
+	}
+	cur := base
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if part == "" || part == "." {
+			continue
+		}
+		next := filepath.Join(cur, part)
+		target, err := os.Readlink(next)
+		if err != nil {
+			cur = next
+			continue
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(cur, target)
+		}
+		if resolved, err := filepath.EvalSymlinks(target); err == nil {
+			target = resolved
+		}
+		inside, err := filepath.Rel(base, filepath.Clean(target))
+		if err != nil || !(inside == "." || filepath.IsLocal(inside)) {
+			return true
+		}
+		cur = target
+	}
+	return false
+}
+
+// FilesystemToolsHandler returns the directories an agent (?agent_id=) may
+// use and the tool definitions to give the model; write_file is only
+// included when one of them is writable
+func FilesystemToolsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		agentID := c.Query("agent_id")
+		if agentID == "" {
+			respondValidationError(c, []FieldError{{Field: "agent_id", Message: "agent_id is required"}})
+			return
+		}
+		dirs, err := models.ListAgentDirectories(db, agentID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		tools := []api.Tool{}
+		if len(dirs) > 0 {
+			tools = append(tools, filesystemTools[models.FilesystemList], filesystemTools[models.FilesystemRead])
+			for _, d := range dirs {
+				if d.Writable {
+					tools = append(tools, filesystemTools[models.FilesystemWrite])
+					break
+				}
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"directories": dirs, "tools": tools})
+	}
+}
+
+// filesystemToolHandler runs a filesystem operation for an agent and
+// records it in the audit trail, whether it was allowed or not
+func filesystemToolHandler(db *sql.DB, operation string,
+	run func(root *os.Root, rel string, req *FilesystemToolRequest) (gin.H, int64, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req FilesystemToolRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+		if strings.TrimSpace(req.AgentID) == "" {
+			respondValidationError(c, []FieldError{{Field: "agent_id", Message: "agent_id is required"}})
+			return
+		}
+		dirs, err := models.ListAgentDirectories(db, req.AgentID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		entry := &models.FilesystemAuditEntry{AgentID: req.AgentID, Operation: operation, Path: req.Path}
+		result, err := func() (gin.H, error) {
+			dir, rel, err := resolveAgentPath(dirs, req.Path)
+			if err != nil {
+				return nil, err
+			}
+			entry.Path = filepath.Join(dir.Path, rel)
+			if operation == models.FilesystemWrite && !dir.Writable {
+				return nil, fmt.Errorf("%w: %s is read-only", errFilesystemDenied, dir.Path)
+			}
+			if symlinkEscapes(dir.Path, rel) {
+				return nil, fmt.Errorf("%w: %s leads outside the agent's directories", errFilesystemDenied, entry.Path)
+			}
+			// os.Root still refuses links swapped in after the check
+			root, err := os.OpenRoot(dir.Path)
+			if err != nil {
+				return nil, err
+			}
+			defer root.Close()
+			result, n, err := run(root, rel, &req)
+			entry.Bytes = n
+			if err == nil {
+				result["path"] = entry.Path
+			}
+			return result, err
+		}()
+
+		entry.Allowed = !errors.Is(err, errFilesystemDenied)
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		if auditErr := models.RecordFilesystemAccess(db, entry); auditErr != nil {
+			log.Printf("[Filesystem] %v", auditErr)
+		}
+
+		var pathErr *fs.PathError
+		switch {
+		case err == nil:
+			c.JSON(http.StatusOK, result)
+		case !entry.Allowed:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, fs.ErrNotExist):
+			c.JSON(http.StatusNotFound, gin.H{"error": "no such file or directory: " + entry.Path})
+		case errors.As(err, &pathErr):
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s %s: %v", pathErr.Op, entry.Path, pathErr.Err)})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+	}
+}
+
+// ListDirectoryHandler lists a directory for an agent
+func ListDirectoryHandler(db *sql.DB) gin.HandlerFunc {
+	return filesystemToolHandler(db, models.FilesystemList,
+		func(root *os.Root, rel string, _ *FilesystemToolRequest) (gin.H, int64, error) {
+			f, err := root.Open(rel)
+			if err != nil {
+				return nil, 0, err
+			}
+			defer f.Close()
+			dirEntries, err := f.ReadDir(fsMaxListEntries + 1)
+			if err != nil && err != io.EOF {
+				return nil, 0, err
+			}
+
+			truncated := len(dirEntries) > fsMaxListEntries
+			if truncated {
+				dirEntries = dirEntries[:fsMaxListEntries]
+			}
+			entries := make([]FileEntry, 0, len(dirEntries))
+			for _, e := range dirEntries {
+				entry := FileEntry{Name: e.Name(), Type: "other"}
+				switch {
+				case e.Type().IsRegular():
+					entry.Type = "file"
+				case e.IsDir():
+					entry.Type = "directory"
+				case e.Type()&fs.ModeSymlink != 0:
+					entry.Type = "symlink"
+				}
+				if info, err := e.Info(); err == nil {
+					entry.Size, entry.Modified = info.Size(), info.ModTime().UTC()
+				}
+				entries = append(entries, entry)
+			}
+			return gin.H{"entries": entries, "truncated": truncated}, 0, nil
+		})
+}
+
+// ReadFileHandler reads a file for an agent. Content that isn't UTF-8 is
+// returned base64-encoded.
+func ReadFileHandler(db *sql.DB) gin.HandlerFunc {
+	return filesystemToolHandler(db, models.FilesystemRead,
+		func(root *os.Root, rel string, req *FilesystemToolRequest) (gin.H, int64, error) {
+			f, err := root.Open(rel)
+			if err != nil {
+				return nil, 0, err
+			}
+			defer f.Close()
+			info, err := f.Stat()
+			if err != nil {
+				return nil, 0, err
+			}
+			if info.IsDir() {
+				return nil, 0, fmt.Errorf("%s is a directory", rel)
+			}
+			if req.Offset < 0 || req.Offset > info.Size() {
+				return nil, 0, fmt.Errorf("offset must be between 0 and %d", info.Size())
+			}
+
+			data, err := io.ReadAll(io.LimitReader(io.NewSectionReader(f, req.Offset, info.Size()-req.Offset), fsMaxReadBytes))
+			if err != nil {
+				return nil, 0, err
+			}
+			content, encoding := string(data), "utf-8"
+			if !utf8.Valid(data) {
+				content, encoding = base64.StdEncoding.EncodeToString(data), "base64"
+			}
+			return gin.H{
+				"size":      info.Size(),
+				"offset":    req.Offset,
+				"content":   content,
+				"encoding":  encoding,
+				"truncated": req.Offset+int64(len(data)) < info.Size(),
+			}, int64(len(data)), nil
+		})
+}
+
+// WriteFileHandler creates, overwrites or appends to a file in one of the
+// agent's writable directories; the file's directory must exist
+func WriteFileHandler(db *sql.DB) gin.HandlerFunc {
+	return filesystemToolHandler(db, models.FilesystemWrite,
+		func(root *os.Root, rel string, req *FilesystemToolRequest) (gin.H, int64, error) {
+			data := []byte(req.Content)
+			switch req.Encoding {
+			case "", "utf-8":
+			case "base64":
+				decoded, err := base64.StdEncoding.DecodeString(req.Content)
+				if err != nil {
+					return nil, 0, fmt.Errorf("content is not valid base64: %w", err)
+				}
+				data = decoded
+			default:
+				return nil, 0, fmt.Errorf("encoding must be utf-8 or base64")
+			}
+			if len(data) > fsMaxWriteBytes {
+				return nil, 0, fmt.Errorf("content is larger than %d bytes", fsMaxWriteBytes)
+			}
+			if rel == "." {
+				return nil, 0, fmt.Errorf("a file name is required")
+			}
+
+			flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			if req.Append {
+				flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+			}
+			f, err := root.OpenFile(rel, flags, 0o644)
+			if err != nil {
+				return nil, 0, err
+			}
+			n, err := f.Write(data)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return nil, int64(n), err
+			}
+			return gin.H{"bytes": n, "append": req.Append}, int64(n), nil
+		})
+}
+
+// ListAgentDirectoriesHandler returns the directories an agent may use
+func ListAgentDirectoriesHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dirs, err := models.ListAgentDirectories(db, c.Param("agentId"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"directories": dirs})
+	}
+}
+
+// AddAgentDirectoryHandler gives an agent's filesystem tools access to a
+// directory and everything under it. The path must be an existing
+// directory; symlinks in it are resolved first.
+func AddAgentDirectoryHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req AddAgentDirectoryRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+		path := strings.TrimSpace(req.Path)
+		if !filepath.IsAbs(path) {
+			respondValidationError(c, []FieldError{{Field: "path", Message: "must be an absolute path"}})
+			return
+		}
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			var info os.FileInfo
+			if info, err = os.Stat(resolved); err == nil && !info.IsDir() {
+				err = fmt.Errorf("not a directory")
+			}
+		}
+		if err != nil {
+			respondValidationError(c, []FieldError{{Field: "path", Message: err.Error()}})
+			return
+		}
+
+		dir := &models.AgentDirectory{AgentID: c.Param("agentId"), Path: resolved, Writable: req.Writable}
+		if err := models.AddAgentDirectory(db, dir); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, dir)
+	}
+}
+
+// RemoveAgentDirectoryHandler takes a directory away from an agent
+func RemoveAgentDirectoryHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := models.RemoveAgentDirectory(db, c.Param("agentId"), c.Param("dirId")); err != nil {
+			if err.Error() == "agent directory not found" {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "directory removed"})
+	}
+}
+
+// ListFilesystemAuditHandler returns the filesystem tool audit trail, newest
+// first, optionally filtered with ?agent_id= and limited with ?limit=
+func ListFilesystemAuditHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := fsAuditDefaultLimit
+		if s := c.Query("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > 1000 {
+				respondValidationError(c, []FieldError{{Field: "limit", Message: "must be between 1 and 1000"}})
+				return
+			}
+			limit = n
+		}
+		entries, err := models.ListFilesystemAudit(db, c.Query("agent_id"), limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"entries": entries})
+	}
+}
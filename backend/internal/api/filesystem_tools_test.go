@@ -0,0 +1,167 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"vessel-backend/internal/database"
+	"vessel-backend/internal/models"
+)
+
+// openTestDB opens a migrated database in a temporary directory
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := database.OpenDatabase(filepath.Join(t.TempDir(), "vessel.db"), database.DefaultOptions())
+	if err != nil {
+		t.Fatalf("OpenDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	return db
+}
+
+func TestResolveAgentPath(t *testing.T) {
+	root := filepath.FromSlash("/srv/agent")
+	dirs := []models.AgentDirectory{
+		{Path: root, Writable: true},
+		{Path: filepath.Join(root, "docs"), Writable: false},
+		{Path: filepath.Join(root, "docs", "drafts"), Writable: true},
+		{Path: filepath.FromSlash("/srv/other"), Writable: false},
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		wantDir  string
+		wantRel  string
+		denied   bool
+		writable bool
+	}{
+		{name: "empty is the first directory", path: "", wantDir: root, wantRel: ".", writable: true},
+		{name: "relative", path: "notes.txt", wantDir: root, wantRel: "notes.txt", writable: true},
+		{name: "relative into read-only subdirectory", path: "docs/readme.md", wantDir: filepath.Join(root, "docs"), wantRel: "readme.md"},
+		{name: "relative into nested writable directory", path: "docs/drafts/a.md", wantDir: filepath.Join(root, "docs", "drafts"), wantRel: "a.md", writable: true},
+		{name: "absolute", path: filepath.Join(root, "notes.txt"), wantDir: root, wantRel: "notes.txt", writable: true},
+		{name: "absolute into read-only subdirectory", path: filepath.Join(root, "docs", "x"), wantDir: filepath.Join(root, "docs"), wantRel: "x"},
+		{name: "absolute second directory", path: filepath.FromSlash("/srv/other/y"), wantDir: filepath.FromSlash("/srv/other"), wantRel: "y"},
+		{name: "relative escape", path: "../etc/passwd", denied: true},
+		{name: "relative escape after descent", path: "docs/../../etc", denied: true},
+		{name: "absolute escape", path: filepath.Join(root, "..", "etc"), denied: true},
+		{name: "absolute outside", path: filepath.FromSlash("/etc/passwd"), denied: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, rel, err := resolveAgentPath(dirs, tt.path)
+			if tt.denied {
+				if !errors.Is(err, errFilesystemDenied) {
+					t.Fatalf("resolveAgentPath(%q) error = %v, want access denied", tt.path, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveAgentPath(%q): %v", tt.path, err)
+			}
+			if dir.Path != tt.wantDir || rel != filepath.FromSlash(tt.wantRel) {
+				t.Errorf("resolveAgentPath(%q) = %s, %s; want %s, %s", tt.path, dir.Path, rel, tt.wantDir, tt.wantRel)
+			}
+			if dir.Writable != tt.writable {
+				t.Errorf("resolveAgentPath(%q) writable = %v, want %v", tt.path, dir.Writable, tt.writable)
+			}
+		})
+	}
+
+	if _, _, err := resolveAgentPath(nil, "x"); !errors.Is(err, errFilesystemDenied) {
+		t.Errorf("resolveAgentPath without directories error = %v, want access denied", err)
+	}
+}
+
+func TestFilesystemToolsDenySymlinkEscapes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := openTestDB(t)
+
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "ok.txt"), []byte("ok"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"out":         outside,
+		"secret-link": filepath.Join(outside, "secret.txt"),
+		"sub/up":      "../..",
+		"inside":      "ok.txt",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("symlinks unavailable: %v", err)
+		}
+	}
+	if err := models.AddAgentDirectory(db, &models.AgentDirectory{AgentID: "agent", Path: root, Writable: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.POST("/read", ReadFileHandler(db))
+	r.POST("/write", WriteFileHandler(db))
+	r.POST("/list", ListDirectoryHandler(db))
+
+	tests := []struct {
+		route, path string
+		want        int
+	}{
+		{"/read", "ok.txt", http.StatusOK},
+		{"/read", "inside", http.StatusOK},
+		{"/read", "secret-link", http.StatusForbidden},
+		{"/read", "out/secret.txt", http.StatusForbidden},
+		{"/list", "out", http.StatusForbidden},
+		{"/list", "sub/up", http.StatusForbidden},
+		{"/write", "out/new.txt", http.StatusForbidden},
+		{"/write", "new.txt", http.StatusOK},
+	}
+	for _, tt := range tests {
+		body := `{"agent_id":"agent","path":"` + tt.path + `","content":"x"}`
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.route, strings.NewReader(body)))
+		if w.Code != tt.want {
+			t.Errorf("POST %s %s = %d (%s), want %d", tt.route, tt.path, w.Code, w.Body.String(), tt.want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new.txt")); !os.IsNotExist(err) {
+		t.Errorf("write through a symlink created a file outside the directory")
+	}
+
+	audit, err := models.ListFilesystemAudit(db, "agent", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	denied := 0
+	for _, e := range audit {
+		if !e.Allowed {
+			denied++
+		}
+	}
+	if denied != 5 {
+		t.Errorf("audit recorded %d denied calls, want 5", denied)
+	}
+}
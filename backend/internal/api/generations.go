@@ -0,0 +1,509 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/models"
+)
+
+// GenerationIDHeader carries the ID clients use to resume a chat stream
+const GenerationIDHeader = "X-Generation-ID"
+
+// generationRetention is how long finished generations stay resumable
+const generationRetention = 10 * time.Minute
+
+// generationOrphanTimeout is how long a generation keeps running once its
+// last client has disconnected; a client that resumes within it picks the
+// stream up, otherwise the generation is cancelled
+var generationOrphanTimeout = 2 * time.Minute
+
+// Generation buffers the output of one streaming chat request so it can be
+// replayed if the client disconnects. It keeps running server-side after
+// the client goes away, until generationOrphanTimeout passes without a
+// client resuming it.
+type Generation struct {
+	ID     string
+	ChatID string
+	Model  string
+
+	mu         sync.Mutex
+	events     [][]byte
+	content    strings.Builder
+	thinking   strings.Builder
+	done       bool
+	err        string
+	messageID  string
+	finishedAt time.Time
+	// updated is closed and replaced whenever an event is appended
+	updated chan struct{}
+	cancel  context.CancelFunc
+	// followers counts the clients streaming the generation; orphaned
+	// cancels it once the last one has been gone too long
+	followers int
+	orphaned  *time.Timer
+}
+
+// GenerationStatus is the non-streaming view of a generation
+type GenerationStatus struct {
+	ID        string `json:"id"`
+	ChatID    string `json:"chat_id,omitempty"`
+	Model     string `json:"model"`
+	Done      bool   `json:"done"`
+	Error     string `json:"error,omitempty"`
+	Events    int    `json:"events"`
+	Content   string `json:"content"`
+	Thinking  string `json:"thinking,omitempty"`
+	MessageID string `json:"message_id,omitempty"`
+}
+
+// append records an event and wakes any followers
+func (g *Generation) append(event []byte) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.events = append(g.events, event)
+	close(g.updated)
+	g.updated = make(chan struct{})
+}
+
+// finish marks the generation complete
+func (g *Generation) finish(errMsg string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.done = true
+	g.err = errMsg
+	g.finishedAt = time.Now()
+	close(g.updated)
+	g.updated = make(chan struct{})
+}
+
+// follow registers a client streaming the generation and returns the
+// function to call when it stops. When the last client leaves before the
+// generation is done, it is cancelled after generationOrphanTimeout unless
+// another client follows it by then.
+func (g *Generation) follow() (leave func()) {
+	g.mu.Lock()
+	g.followers++
+	if g.orphaned != nil {
+		g.orphaned.Stop()
+		g.orphaned = nil
+	}
+	g.mu.Unlock()
+
+	return func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		g.followers--
+		if g.followers == 0 && !g.done {
+			g.orphaned = time.AfterFunc(generationOrphanTimeout, g.cancelIfOrphaned)
+		}
+	}
+}
+
+// cancelIfOrphaned cancels the generation if no client has resumed it
+func (g *Generation) cancelIfOrphaned() {
+	g.mu.Lock()
+	orphaned := g.followers == 0 && !g.done
+	g.mu.Unlock()
+	if orphaned {
+		log.Printf("[Generations] Cancelling generation %s: no client resumed it within %s", g.ID, generationOrphanTimeout)
+		g.cancel()
+	}
+}
+
+// since returns events from offset on, whether the generation is done, and
+// a channel that is closed when more events arrive
+func (g *Generation) since(offset int) ([][]byte, bool, <-chan struct{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(g.events) {
+		offset = len(g.events)
+	}
+	return g.events[offset:], g.done, g.updated
+}
+
+// Status returns a snapshot of the generation's state
+func (g *Generation) Status() GenerationStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return GenerationStatus{
+		ID:        g.ID,
+		ChatID:    g.ChatID,
+		Model:     g.Model,
+		Done:      g.done,
+		Error:     g.err,
+		Events:    len(g.events),
+		Content:   g.content.String(),
+		Thinking:  g.thinking.String(),
+		MessageID: g.messageID,
+	}
+}
+
+// GenerationStore tracks in-flight and recently finished generations
+type GenerationStore struct {
+	mu          sync.Mutex
+	generations map[string]*Generation
+}
+
+// NewGenerationStore creates an empty generation store
+func NewGenerationStore() *GenerationStore {
+	return &GenerationStore{generations: make(map[string]*Generation)}
+}
+
+// Get returns a generation by ID, or nil if unknown or expired
+func (gs *GenerationStore) Get(id string) *Generation {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	return gs.generations[id]
+}
+
+// active returns how many generations are still running
+func (gs *GenerationStore) active() int {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	n := 0
+	for _, g := range gs.generations {
+		g.mu.Lock()
+		if !g.done {
+			n++
+		}
+		g.mu.Unlock()
+	}
+	return n
+}
+
+// add registers a generation and evicts expired ones
+func (gs *GenerationStore) add(g *Generation) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	for id, existing := range gs.generations {
+		existing.mu.Lock()
+		expired := existing.done && time.Since(existing.finishedAt) > generationRetention
+		existing.mu.Unlock()
+		if expired {
+			delete(gs.generations, id)
+		}
+	}
+	gs.generations[g.ID] = g
+}
+
+// startGeneration runs a chat request in the background, detached from the
+// client connection, buffering every response chunk. It outlives its clients
+// only for generationOrphanTimeout. When persist is set and
+// the request is linked to a chat, the final assistant message is saved; when
+// cacheKey is set, the assembled response is cached.
+func (s *OllamaService) startGeneration(req *ChatPipelineRequest, settingsHash, cacheKey string) *Generation {
+	ctx, cancel := context.WithCancel(context.Background())
+	g := &Generation{
+		ID:      uuid.New().String(),
+		ChatID:  req.ChatID,
+		Model:   req.Model,
+		updated: make(chan struct{}),
+		cancel:  cancel,
+	}
+	s.generations.add(g)
+
+	chatReq := req.ChatRequest
+	config := s.effectiveConfig(req)
+	go func() {
+		defer cancel()
+
+		var final api.ChatResponse
+		var toolCalls []api.ToolCall
+		timer := newChatTimer()
+		err := s.client.Chat(ctx, &chatReq, func(resp api.ChatResponse) error {
+			timer.observe(resp)
+			s.observeChunk(req, resp)
+			event := TimedChatResponse{ChatResponse: resp}
+			if resp.Done {
+				event.Timings = timer.timings(resp.Metrics)
+				event.Config = config
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			final = resp
+			toolCalls = append(toolCalls, resp.Message.ToolCalls...)
+			if resp.Done {
+				s.recordTokenUsage(req, resp.Metrics)
+			}
+			g.mu.Lock()
+			g.content.WriteString(resp.Message.Content)
+			g.thinking.WriteString(resp.Message.Thinking)
+			g.mu.Unlock()
+			g.append(data)
+			return nil
+		})
+
+		// A structured reply cut off by the token limit or a cancel is
+		// repaired to parse
+		switch {
+		case ctx.Err() != nil:
+			s.repairGeneration(g, req, JSONRepairCancelled)
+		case err == nil && final.DoneReason == JSONRepairLength:
+			s.repairGeneration(g, req, JSONRepairLength)
+		}
+
+		// Middleware may withhold or rewrite the reply before it is kept
+		errMsg := ""
+		if err != nil {
+			errMsg = err.Error()
+			data, _ := json.Marshal(gin.H{"error": errMsg})
+			g.append(data)
+		} else if errMsg = s.postProcessGeneration(ctx, g, req); errMsg == "" {
+			if req.Persist && req.ChatID != "" && s.db != nil {
+				s.persistGeneration(g, req, settingsHash)
+			}
+			if cacheKey != "" {
+				g.mu.Lock()
+				final.Message.Content = g.content.String()
+				final.Message.Thinking = g.thinking.String()
+				g.mu.Unlock()
+				final.Message.ToolCalls = toolCalls
+				s.storeCompletion(cacheKey, final)
+			}
+		}
+		g.finish(errMsg)
+	}()
+
+	return g
+}
+
+// postProcessGeneration runs the middleware's FinishChat stage on a finished
+// generation. An error is appended as an error event and returned; a
+// modification replaces the buffered content and is announced with a policy
+// event carrying the replacement message, so clients can swap out what they
+// displayed.
+func (s *OllamaService) postProcessGeneration(ctx context.Context, g *Generation, req *ChatPipelineRequest) string {
+	if len(s.middleware) == 0 {
+		return ""
+	}
+
+	g.mu.Lock()
+	msg := api.Message{Role: "assistant", Content: g.content.String(), Thinking: g.thinking.String()}
+	g.mu.Unlock()
+	original := msg
+
+	if err := s.finishChat(ctx, req, &msg); err != nil {
+		event := gin.H{"error": err.Error()}
+		var denied *policyDeniedError
+		if errors.As(err, &denied) {
+			event["policy"] = denied.Result
+		}
+		data, _ := json.Marshal(event)
+		g.append(data)
+		return err.Error()
+	}
+
+	if msg.Content != original.Content || msg.Thinking != original.Thinking {
+		g.mu.Lock()
+		g.content.Reset()
+		g.content.WriteString(msg.Content)
+		g.thinking.Reset()
+		g.thinking.WriteString(msg.Thinking)
+		g.mu.Unlock()
+
+		data, _ := json.Marshal(gin.H{"policy": HookResult{Action: HookModify, Response: &msg}})
+		g.append(data)
+	}
+	return ""
+}
+
+// repairGeneration repairs the buffered content of a structured reply that
+// was cut short. The repair is announced with a json_repair event carrying
+// the replacement message, so clients can swap out what they displayed.
+func (s *OllamaService) repairGeneration(g *Generation, req *ChatPipelineRequest, reason string) {
+	g.mu.Lock()
+	msg := api.Message{Role: "assistant", Content: g.content.String()}
+	g.mu.Unlock()
+
+	repair := repairStructuredReply(&req.ChatRequest, &msg, reason)
+	if repair == nil {
+		return
+	}
+	g.mu.Lock()
+	g.content.Reset()
+	g.content.WriteString(msg.Content)
+	g.mu.Unlock()
+
+	data, _ := json.Marshal(gin.H{"json_repair": repair, "message": msg})
+	g.append(data)
+}
+
+// persistGeneration saves a finished generation as an assistant message,
+// with the linked pages fetched into its context as attachments. A
+// continued prefill is saved with the prefill in front, replacing the
+// content of the message it continues when the request names one.
+func (s *OllamaService) persistGeneration(g *Generation, req *ChatPipelineRequest, settingsHash string) {
+	g.mu.Lock()
+	content := g.content.String()
+	g.mu.Unlock()
+	if prefill, ok := assistantPrefill(&req.ChatRequest); ok {
+		content = prefill + content
+	}
+
+	var hash *string
+	if settingsHash != "" {
+		hash = &settingsHash
+	}
+
+	if req.ContinueMessageID != "" {
+		msg, err := models.GetMessage(s.db, g.ChatID, req.ContinueMessageID)
+		if err == nil && msg == nil {
+			err = fmt.Errorf("message %s not found", req.ContinueMessageID)
+		}
+		if err == nil {
+			msg.Content = content
+			msg.SettingsHash = hash
+			msg.Seed = requestSeed(req.Options)
+			err = models.UpdateMessageContent(s.db, msg)
+		}
+		if err != nil {
+			log.Printf("[Generations] Failed to persist generation %s: %v", g.ID, err)
+			return
+		}
+		g.mu.Lock()
+		g.messageID = msg.ID
+		g.mu.Unlock()
+		return
+	}
+
+	msg := &models.Message{
+		ChatID:       g.ChatID,
+		ParentID:     req.ParentID,
+		Role:         "assistant",
+		Content:      content,
+		SettingsHash: hash,
+		Seed:         requestSeed(req.Options),
+		Attachments:  urlContextAttachments(req.urlContext),
+	}
+	if err := models.CreateMessage(s.db, msg); err != nil {
+		log.Printf("[Generations] Failed to persist generation %s: %v", g.ID, err)
+		return
+	}
+
+	g.mu.Lock()
+	g.messageID = msg.ID
+	g.mu.Unlock()
+}
+
+// streamGeneration writes a generation's events to the client from offset,
+// following new events until the generation finishes or the client leaves.
+// The delta format numbers the events and closes with an end event.
+func streamGeneration(c *gin.Context, g *Generation, offset int, format string) {
+	if format == "" {
+		format = StreamFormatOllama
+	}
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("Transfer-Encoding", "chunked")
+	c.Header(GenerationIDHeader, g.ID)
+	c.Header(StreamFormatHeader, format)
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "streaming not supported"})
+		return
+	}
+	leave := g.follow()
+	defer leave()
+
+	ctx := c.Request.Context()
+	for {
+		events, done, updated := g.since(offset)
+		for i, event := range events {
+			if format == StreamFormatDelta {
+				event = deltaEvent(offset+i, event)
+			}
+			if _, err := c.Writer.Write(append(event, '\n')); err != nil {
+				return
+			}
+		}
+		offset += len(events)
+
+		if done {
+			if format == StreamFormatDelta {
+				c.Writer.Write(append(deltaEndEvent(g.Status()), '\n'))
+			}
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-ctx.Done():
+			// The generation keeps running for a while; the client can
+			// resume it before it is cancelled
+			return
+		case <-updated:
+		}
+	}
+}
+
+// GetGenerationHandler returns a generation's buffered output. By default it
+// streams NDJSON events starting at ?offset= (the number of events already
+// received) and follows until done, in the ?format= given (ollama or
+// delta); ?stream=false returns a JSON summary.
+func (s *OllamaService) GetGenerationHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		g := s.generations.Get(c.Param("id"))
+		if g == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "generation not found"})
+			return
+		}
+
+		if c.Query("stream") == "false" {
+			c.JSON(http.StatusOK, g.Status())
+			return
+		}
+
+		offset := 0
+		if offsetStr := c.Query("offset"); offsetStr != "" {
+			o, err := strconv.Atoi(offsetStr)
+			if err != nil || o < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+				return
+			}
+			offset = o
+		}
+		format := c.Query("format")
+		if !validStreamFormat(format) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be ollama or delta"})
+			return
+		}
+
+		streamGeneration(c, g, offset, format)
+	}
+}
+
+// CancelGenerationHandler stops a running generation
+func (s *OllamaService) CancelGenerationHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		g := s.generations.Get(c.Param("id"))
+		if g == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "generation not found"})
+			return
+		}
+
+		g.cancel()
+		c.JSON(http.StatusOK, gin.H{"message": "generation cancelled"})
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGenerationCancelledWithoutFollowers(t *testing.T) {
+	timeout := generationOrphanTimeout
+	generationOrphanTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { generationOrphanTimeout = timeout })
+
+	newGeneration := func() (*Generation, context.Context) {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		return &Generation{ID: "gen", updated: make(chan struct{}), cancel: cancel}, ctx
+	}
+	cancelled := func(ctx context.Context, within time.Duration) bool {
+		select {
+		case <-ctx.Done():
+			return true
+		case <-time.After(within):
+			return false
+		}
+	}
+
+	// The last client leaving starts the countdown
+	g, ctx := newGeneration()
+	first, second := g.follow(), g.follow()
+	first()
+	if cancelled(ctx, 4*generationOrphanTimeout) {
+		t.Fatal("generation cancelled while a client still followed it")
+	}
+	second()
+	if !cancelled(ctx, time.Second) {
+		t.Fatal("generation kept running after its last client left")
+	}
+
+	// A client resuming in time keeps it running
+	g, ctx = newGeneration()
+	g.follow()()
+	resumed := g.follow()
+	if cancelled(ctx, 4*generationOrphanTimeout) {
+		t.Fatal("generation cancelled although a client resumed it")
+	}
+	resumed()
+
+	// A finished generation is left alone
+	g, ctx = newGeneration()
+	leave := g.follow()
+	g.finish("")
+	leave()
+	if cancelled(ctx, 4*generationOrphanTimeout) {
+		t.Fatal("finished generation was cancelled")
+	}
+}
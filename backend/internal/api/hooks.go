@@ -0,0 +1,233 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/i18n"
+)
+
+// HookStage identifies where in the chat pipeline a hook runs
+type HookStage string
+
+const (
+	// HookStagePre runs before the request is sent to the model
+	HookStagePre HookStage = "pre"
+	// HookStagePost runs on the complete response before it is returned,
+	// persisted or cached
+	HookStagePost HookStage = "post"
+	// HookStageExport runs on each conversation written to a dataset
+	// export, so sidecars can scrub personal data or deny the example
+	HookStageExport HookStage = "export"
+)
+
+// HookAction is a hook's verdict
+type HookAction string
+
+const (
+	HookAllow  HookAction = "allow"
+	HookModify HookAction = "modify"
+	HookDeny   HookAction = "deny"
+)
+
+// HookPayload is what a hook inspects
+type HookPayload struct {
+	Stage    HookStage     `json:"stage"`
+	ChatID   string        `json:"chat_id,omitempty"`
+	Model    string        `json:"model"`
+	Messages []api.Message `json:"messages"`
+	// Response is set for post hooks
+	Response *api.Message `json:"response,omitempty"`
+}
+
+// HookResult is a hook's verdict. With HookModify, pre hooks return the
+// replacement Messages and post hooks the replacement Response.
+type HookResult struct {
+	Action   HookAction    `json:"action"`
+	Messages []api.Message `json:"messages,omitempty"`
+	Response *api.Message  `json:"response,omitempty"`
+	Reason   string        `json:"reason,omitempty"`
+	// Hook names the hook that produced the verdict
+	Hook string `json:"hook,omitempty"`
+}
+
+// ChatHook inspects, modifies or denies chat prompts and responses.
+// Implementations are called for every stage and should return HookAllow
+// for stages they don't handle.
+type ChatHook interface {
+	Name() string
+	Run(ctx context.Context, payload *HookPayload) (*HookResult, error)
+}
+
+// HTTPHook calls out to a sidecar service: the payload is POSTed as JSON and
+// the response body is decoded as a HookResult
+type HTTPHook struct {
+	name     string
+	url      string
+	client   *http.Client
+	failOpen bool
+}
+
+// NewHTTPHook creates a sidecar hook. With failOpen, requests are allowed
+// when the sidecar can't be reached; otherwise they are denied.
+func NewHTTPHook(name, url string, timeout time.Duration, failOpen bool) *HTTPHook {
+	return &HTTPHook{
+		name:     name,
+		url:      url,
+		client:   &http.Client{Timeout: timeout},
+		failOpen: failOpen,
+	}
+}
+
+// Name returns the hook's name
+func (h *HTTPHook) Name() string {
+	return h.name
+}
+
+// Run posts the payload to the sidecar and returns its verdict
+func (h *HTTPHook) Run(ctx context.Context, payload *HookPayload) (*HookResult, error) {
+	result, err := h.call(ctx, payload)
+	if err != nil && h.failOpen {
+		log.Printf("[Hooks] %s unavailable, allowing: %v", h.name, err)
+		return &HookResult{Action: HookAllow}, nil
+	}
+	return result, err
+}
+
+// call performs the sidecar request
+func (h *HTTPHook) call(ctx context.Context, payload *HookPayload) (*HookResult, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("sidecar returned %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	var result HookResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid sidecar response: %w", err)
+	}
+	return &result, nil
+}
+
+// runHooks passes the payload through every hook in order. Modifications are
+// applied to the payload and seen by later hooks. The first denial (or hook
+// failure) stops the chain and is returned; otherwise nil is returned.
+func (s *OllamaService) runHooks(ctx context.Context, payload *HookPayload) *HookResult {
+	for _, hook := range s.hooks {
+		result, err := hook.Run(ctx, payload)
+		if err != nil {
+			log.Printf("[Hooks] %s failed: %v", hook.Name(), err)
+			return &HookResult{Action: HookDeny, Reason: "policy check failed", Hook: hook.Name()}
+		}
+
+		switch result.Action {
+		case HookAllow, "":
+		case HookModify:
+			if payload.Stage != HookStagePost && result.Messages != nil {
+				payload.Messages = result.Messages
+			}
+			if payload.Stage == HookStagePost && result.Response != nil {
+				payload.Response = result.Response
+			}
+		case HookDeny:
+			result.Hook = hook.Name()
+			return result
+		default:
+			log.Printf("[Hooks] %s returned unknown action %q", hook.Name(), result.Action)
+			return &HookResult{Action: HookDeny, Reason: "policy check failed", Hook: hook.Name()}
+		}
+	}
+	return nil
+}
+
+// applyPreHooks runs pre hooks on a request, replacing its messages if a hook
+// modifies them. Returns the denial, if any.
+func (s *OllamaService) applyPreHooks(ctx context.Context, req *ChatPipelineRequest) *HookResult {
+	if len(s.hooks) == 0 {
+		return nil
+	}
+
+	payload := &HookPayload{
+		Stage:    HookStagePre,
+		ChatID:   req.ChatID,
+		Model:    req.Model,
+		Messages: req.Messages,
+	}
+	if denied := s.runHooks(ctx, payload); denied != nil {
+		return denied
+	}
+	req.Messages = payload.Messages
+	return nil
+}
+
+// applyPostHooks runs post hooks on a response message, replacing it if a
+// hook modifies it. Returns whether it was modified and the denial, if any.
+func (s *OllamaService) applyPostHooks(ctx context.Context, chatID string, req *api.ChatRequest, msg *api.Message) (bool, *HookResult) {
+	if len(s.hooks) == 0 {
+		return false, nil
+	}
+
+	original := *msg
+	payload := &HookPayload{
+		Stage:    HookStagePost,
+		ChatID:   chatID,
+		Model:    req.Model,
+		Messages: req.Messages,
+		Response: &original,
+	}
+	if denied := s.runHooks(ctx, payload); denied != nil {
+		return false, denied
+	}
+
+	if payload.Response != &original {
+		*msg = *payload.Response
+		return true, nil
+	}
+	return false, nil
+}
+
+// respondPolicyDenied writes a 403 response for a denied prompt or response
+func respondPolicyDenied(c *gin.Context, stage HookStage, denied *HookResult) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":      policyDeniedMessage(stage, denied),
+		"policy":     denied,
+		"suggestion": suggest(c, i18n.SuggestPolicyDenied),
+	})
+}
+
+// policyDeniedMessage describes a denial for error messages
+func policyDeniedMessage(stage HookStage, denied *HookResult) string {
+	what := "request"
+	if stage == HookStagePost {
+		what = "response"
+	}
+	if denied.Reason != "" {
+		return fmt.Sprintf("%s blocked by policy: %s", what, denied.Reason)
+	}
+	return what + " blocked by policy"
+}
@@ -0,0 +1,269 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"net/http"
+
+	_ "golang.org/x/image/bmp"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// ImageProcessingHeader summarizes how a chat request's images were
+// processed: "images=2 original=8123456 processed=402113" (bytes)
+const ImageProcessingHeader = "X-Image-Processing"
+
+// DefaultImageMaxDimension is the longest side images are scaled down to
+const DefaultImageMaxDimension = 1920
+
+// imageJPEGQuality is the quality images are re-encoded with as JPEG
+const imageJPEGQuality = 90
+
+// ImageProcessing records the sizes of the images in a request before and
+// after processing
+type ImageProcessing struct {
+	Images    int `json:"images"`
+	Processed int `json:"processed"`
+	Original  int `json:"original_bytes"`
+	Final     int `json:"processed_bytes"`
+}
+
+// String formats the record for the ImageProcessingHeader
+func (p ImageProcessing) String() string {
+	return fmt.Sprintf("images=%d original=%d processed=%d", p.Images, p.Original, p.Final)
+}
+
+// imageMiddleware prepares images before they reach the model: photos are
+// scaled down to the configured maximum dimension, turned upright and
+// stripped of their metadata (EXIF can carry GPS positions), and formats
+// vision models don't read (GIF, WebP, BMP, TIFF) are converted. Images
+// that need none of this are passed on untouched.
+type imageMiddleware struct {
+	ChatMiddlewareBase
+	s *OllamaService
+}
+
+func (imageMiddleware) Name() string { return "images" }
+
+func (m imageMiddleware) PrepareChat(_ context.Context, req *ChatPipelineRequest) error {
+	stats := ImageProcessing{}
+	for i := range req.Messages {
+		for j, img := range req.Messages[i].Images {
+			stats.Images++
+			stats.Original += len(img)
+			processed, changed, err := processImage(img, m.s.imageMaxDimension)
+			if err != nil {
+				return &ChatRejectedError{
+					Status:  http.StatusBadRequest,
+					Message: fmt.Sprintf("messages[%d].images[%d]: %v", i, j, err),
+				}
+			}
+			if changed {
+				stats.Processed++
+				req.Messages[i].Images[j] = processed
+			}
+			stats.Final += len(req.Messages[i].Images[j])
+		}
+	}
+	if stats.Images > 0 {
+		req.imageProcessing = &stats
+		if stats.Processed > 0 {
+			log.Printf("[Images] Processed %d of %d images: %d -> %d bytes", stats.Processed, stats.Images, stats.Original, stats.Final)
+		}
+	}
+	return nil
+}
+
+// processImage normalizes one image. It returns the image unchanged (and
+// false) when it is a JPEG or PNG without metadata that fits maxDimension;
+// a maxDimension of 0 disables scaling.
+func processImage(data []byte, maxDimension int) ([]byte, bool, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, false, fmt.Errorf("unsupported or corrupt image: %w", err)
+	}
+
+	orientation := 1
+	hasMetadata := false
+	switch format {
+	case "jpeg":
+		orientation, hasMetadata = jpegMetadata(data)
+	case "png":
+		hasMetadata = bytes.Contains(data, []byte("eXIf"))
+	}
+	oversized := maxDimension > 0 && (cfg.Width > maxDimension || cfg.Height > maxDimension)
+	if (format == "jpeg" || format == "png") && !oversized && !hasMetadata {
+		return data, false, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, false, fmt.Errorf("unsupported or corrupt image: %w", err)
+	}
+	// Scaling first keeps turning the image cheap
+	if oversized {
+		img = scaleImage(img, maxDimension)
+	}
+	img = orient(img, orientation)
+
+	var buf bytes.Buffer
+	if format == "png" || (format != "jpeg" && hasAlpha(img)) {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, flatten(img), &jpeg.Options{Quality: imageJPEGQuality})
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode image: %w", err)
+	}
+	return buf.Bytes(), true, nil
+}
+
+// scaleImage scales an image down so its longest side is maxDimension
+func scaleImage(img image.Image, maxDimension int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w >= h {
+		h = max(1, h*maxDimension/w)
+		w = maxDimension
+	} else {
+		w = max(1, w*maxDimension/h)
+		h = maxDimension
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, xdraw.Src, nil)
+	return dst
+}
+
+// hasAlpha reports whether an image has any transparent pixels
+func hasAlpha(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return !o.Opaque()
+	}
+	return true
+}
+
+// flatten draws an image with transparency onto white, since JPEG has none
+func flatten(img image.Image) image.Image {
+	if !hasAlpha(img) {
+		return img
+	}
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+	return dst
+}
+
+// jpegMetadata scans a JPEG's header segments and returns its EXIF
+// orientation (1 when absent) and whether it carries EXIF or other
+// application metadata (APP1-APP15 and comments)
+func jpegMetadata(data []byte) (orientation int, hasMetadata bool) {
+	orientation = 1
+	pos := 2 // after the SOI marker
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break // image data follows; there is no more metadata
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			break
+		}
+		segment := data[pos+4 : pos+2+length]
+		if (marker >= 0xE1 && marker <= 0xEF) || marker == 0xFE {
+			hasMetadata = true
+		}
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			if o := exifOrientation(segment[6:]); o != 0 {
+				orientation = o
+			}
+		}
+		pos += 2 + length
+	}
+	return orientation, hasMetadata
+}
+
+// exifOrientation reads the orientation tag from the first IFD of a TIFF
+// structure, returning 0 if it is missing or malformed
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			o := int(order.Uint16(tiff[entry+8:]))
+			if o >= 1 && o <= 8 {
+				return o
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// orient turns an image upright according to its EXIF orientation, since
+// the tag is dropped when the image is re-encoded
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	// Orientations 5-8 swap width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // mirrored along the top-left diagonal
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise
+				dx, dy = h-1-y, x
+			case 7: // mirrored along the top-right diagonal
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90° counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
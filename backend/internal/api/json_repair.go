@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Why a structured reply was cut short before it was repaired
+const (
+	// JSONRepairLength means the reply hit the token limit (num_predict)
+	JSONRepairLength = "length"
+	// JSONRepairCancelled means the generation was cancelled
+	JSONRepairCancelled = "cancelled"
+)
+
+// JSONRepair flags a structured reply whose truncated JSON was completed
+// so it parses. The repair is best-effort: open strings, arrays and objects
+// are closed, and a member that can't be completed is dropped.
+type JSONRepair struct {
+	Reason string `json:"reason"`
+}
+
+// structuredOutput reports whether a chat asks for JSON output, either plain
+// JSON or a schema
+func structuredOutput(req *api.ChatRequest) bool {
+	format := strings.TrimSpace(string(req.Format))
+	return format != "" && format != "null" && format != `""`
+}
+
+// repairStructuredReply repairs the content of a structured reply that was
+// cut short. It returns nil, leaving the message alone, when the chat
+// doesn't ask for JSON or the content is valid or can't be repaired.
+func repairStructuredReply(req *api.ChatRequest, msg *api.Message, reason string) *JSONRepair {
+	if !structuredOutput(req) || json.Valid([]byte(msg.Content)) {
+		return nil
+	}
+	repaired, ok := repairJSON(msg.Content)
+	if !ok {
+		return nil
+	}
+	msg.Content = repaired
+	return &JSONRepair{Reason: reason}
+}
+
+// jsonCut is a point where partial JSON can be cut and closed: just after
+// an opening bracket or just before a comma, with the closers needed there
+type jsonCut struct {
+	pos     int
+	closers string
+}
+
+// repairJSON completes truncated JSON. It first closes an open string,
+// finishes a dangling literal, number, comma or colon and closes the open
+// containers; if that doesn't parse, it cuts back to the last complete
+// member. Text that doesn't start with an object or array isn't repaired.
+func repairJSON(partial string) (string, bool) {
+	text := strings.TrimSpace(partial)
+	if text == "" || (text[0] != '{' && text[0] != '[') {
+		return "", false
+	}
+
+	var stack []byte // closers for the open containers
+	var cuts []jsonCut
+	inString, escaped := false, false
+	hexLeft := 0 // hex digits still expected in a \u escape
+	for i := 0; i < len(text); i++ {
+		ch := text[i]
+		if inString {
+			switch {
+			case hexLeft > 0:
+				hexLeft--
+			case escaped:
+				escaped = false
+				if ch == 'u' {
+					hexLeft = 4
+				}
+			case ch == '\\':
+				escaped = true
+			case ch == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch ch {
+		case '"':
+			inString = true
+		case '{', '[':
+			closer := byte('}')
+			if ch == '[' {
+				closer = ']'
+			}
+			stack = append(stack, closer)
+			cuts = append(cuts, jsonCut{pos: i + 1, closers: closeJSON(stack)})
+		case '}', ']':
+			if len(stack) == 0 || stack[len(stack)-1] != ch {
+				return "", false
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				// The value is complete; anything after it is dropped
+				complete := text[:i+1]
+				return complete, json.Valid([]byte(complete))
+			}
+		case ',':
+			cuts = append(cuts, jsonCut{pos: i, closers: closeJSON(stack)})
+		}
+	}
+
+	tail := text
+	if inString {
+		switch {
+		case hexLeft > 0:
+			tail = tail[:len(tail)-(2+4-hexLeft)]
+		case escaped:
+			tail = tail[:len(tail)-1]
+		}
+		tail += `"`
+	}
+	if candidate := completeJSONTail(tail) + closeJSON(stack); json.Valid([]byte(candidate)) {
+		return candidate, true
+	}
+
+	for i := len(cuts) - 1; i >= 0; i-- {
+		candidate := strings.TrimRight(text[:cuts[i].pos], " \t\r\n") + cuts[i].closers
+		if json.Valid([]byte(candidate)) {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// closeJSON returns the closers for the open containers, innermost first
+func closeJSON(stack []byte) string {
+	closers := make([]byte, len(stack))
+	for i, c := range stack {
+		closers[len(stack)-1-i] = c
+	}
+	return string(closers)
+}
+
+// completeJSONTail finishes the token partial JSON ends in: a literal is
+// spelled out, an unfinished number is trimmed to its digits, a trailing
+// comma is dropped and a key left without a value gets null
+func completeJSONTail(s string) string {
+	s = strings.TrimRight(s, " \t\r\n")
+
+	j := len(s)
+	for j > 0 && s[j-1] >= 'a' && s[j-1] <= 'z' {
+		j--
+	}
+	if word := s[j:]; word != "" {
+		for _, literal := range []string{"true", "false", "null"} {
+			if strings.HasPrefix(literal, word) {
+				return s[:j] + literal
+			}
+		}
+	}
+
+	s = strings.TrimRight(s, ".eE+-")
+	s = strings.TrimRight(s, " \t\r\n")
+	switch {
+	case strings.HasSuffix(s, ","):
+		s = strings.TrimRight(s[:len(s)-1], " \t\r\n")
+	case strings.HasSuffix(s, ":"):
+		s += "null"
+	}
+	return s
+}
@@ -0,0 +1,308 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/i18n"
+	"vessel-backend/internal/models"
+)
+
+// License sources
+const (
+	licenseSourceOllama   = "ollama"
+	licenseSourceRegistry = "registry"
+)
+
+// knownLicense maps a phrase found in license text to the license it identifies
+type knownLicense struct {
+	phrase      string
+	name        string
+	restrictive bool
+}
+
+// knownLicenses is checked in order against the lowercased license text;
+// restrictive licenses come first so a model bundling several is flagged
+var knownLicenses = []knownLicense{
+	{"llama 4 community license", "Llama-4-Community", true},
+	{"llama 3.3 community license", "Llama-3.3-Community", true},
+	{"llama 3.2 community license", "Llama-3.2-Community", true},
+	{"llama 3.1 community license", "Llama-3.1-Community", true},
+	{"meta llama 3 community license", "Llama-3-Community", true},
+	{"llama 2 community license", "Llama-2-Community", true},
+	{"gemma terms of use", "Gemma", true},
+	{"tongyi qianwen", "Tongyi-Qianwen", true},
+	{"qwen license agreement", "Qwen", true},
+	{"attribution-noncommercial", "CC-BY-NC", true},
+	{"cc by-nc", "CC-BY-NC", true},
+	{"mistral ai research license", "Mistral-Research", true},
+	{"mistral ai non-production license", "Mistral-Non-Production", true},
+	{"openrail", "OpenRAIL", true},
+	{"responsible ai license", "RAIL", true},
+	{"apache license", "Apache-2.0", false},
+	{"mit license", "MIT", false},
+	{"permission is hereby granted, free of charge", "MIT", false},
+	{"bsd 3-clause", "BSD-3-Clause", false},
+	{"redistribution and use in source and binary forms", "BSD", false},
+	{"creative commons attribution 4.0", "CC-BY-4.0", false},
+}
+
+// identifyLicense names a license from its text. Unrecognized licenses are
+// treated as restrictive so they have to be reviewed before use.
+func identifyLicense(text string) (name string, restrictive bool) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", false
+	}
+	lower := strings.ToLower(text)
+	for _, known := range knownLicenses {
+		if strings.Contains(lower, known.phrase) {
+			return known.name, known.restrictive
+		}
+	}
+	return "custom", true
+}
+
+// licenseHash identifies a license text
+func licenseHash(text string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(text)))
+	return hex.EncodeToString(sum[:])
+}
+
+// modelLicense returns the stored license for a model, fetching it from
+// Ollama (falling back to the registry cache) the first time it's needed
+func (s *OllamaService) modelLicense(ctx context.Context, model string) (*models.ModelLicense, error) {
+	name := normalizeModelName(model)
+	license, err := models.GetModelLicense(s.db, name)
+	if err != nil || license != nil {
+		return license, err
+	}
+
+	resp, err := s.client.Show(ctx, &api.ShowRequest{Model: model})
+	if err != nil {
+		return nil, err
+	}
+
+	license = &models.ModelLicense{Model: name, Text: strings.TrimSpace(resp.License), Source: licenseSourceOllama}
+	if license.Text == "" {
+		if text := s.registryLicense(ctx, name); text != "" {
+			license.Text, license.Source = text, licenseSourceRegistry
+		}
+	}
+	license.Name, license.Restrictive = identifyLicense(license.Text)
+	if license.Text != "" {
+		license.Hash = licenseHash(license.Text)
+	}
+
+	if err := models.SaveModelLicense(s.db, license); err != nil {
+		return nil, err
+	}
+	return license, nil
+}
+
+// forgetModelLicense drops a model's stored license after it is pulled or
+// deleted, so an updated license is fetched (and must be accepted) again
+func (s *OllamaService) forgetModelLicense(model string) {
+	if s.db == nil {
+		return
+	}
+	if err := models.DeleteModelLicense(s.db, normalizeModelName(model)); err != nil {
+		log.Printf("[Licenses] Failed to reset license for %s: %v", model, err)
+	}
+}
+
+// registryLicense looks up a model's license in the ollama.com registry cache
+func (s *OllamaService) registryLicense(ctx context.Context, name string) string {
+	slug := strings.SplitN(name, ":", 2)[0]
+	var license sql.NullString
+	err := s.db.QueryRowContext(ctx, `SELECT license FROM remote_models WHERE slug = ?`, slug).Scan(&license)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("[Licenses] Failed to look up registry license for %s: %v", slug, err)
+	}
+	return license.String
+}
+
+// checkModelLicense rejects a chat request with 403 if its model has a
+// restrictive license that hasn't been accepted. Requests are let through if
+// the license can't be fetched; Ollama reports the underlying problem.
+func (s *OllamaService) checkModelLicense(c *gin.Context, model string) bool {
+	if s.db == nil || model == "" {
+		return true
+	}
+
+	license, err := s.modelLicense(c.Request.Context(), model)
+	if err != nil {
+		log.Printf("[Licenses] Failed to get license for %s: %v", model, err)
+		return true
+	}
+	if !license.Restrictive {
+		return true
+	}
+
+	accepted, err := models.GetLicenseAcceptance(s.db, license.Model, license.Hash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if accepted != nil {
+		return true
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":                       "the license for " + license.Model + " must be accepted before use",
+		"license_acceptance_required": true,
+		"model":                       license.Model,
+		"license":                     license.Name,
+		"license_hash":                license.Hash,
+		"suggestion":                  suggest(c, i18n.SuggestAcceptLicense, license.Model),
+	})
+	return false
+}
+
+// ModelLicenseStatus is a model's license with its acceptance, if any
+type ModelLicenseStatus struct {
+	models.ModelLicense
+	Accepted   bool                      `json:"accepted"`
+	Acceptance *models.LicenseAcceptance `json:"acceptance,omitempty"`
+}
+
+// licenseStatus pairs a license with its acceptance
+func (s *OllamaService) licenseStatus(license *models.ModelLicense) (*ModelLicenseStatus, error) {
+	status := &ModelLicenseStatus{ModelLicense: *license, Accepted: !license.Restrictive}
+	if license.Hash == "" {
+		return status, nil
+	}
+	acceptance, err := models.GetLicenseAcceptance(s.db, license.Model, license.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if acceptance != nil {
+		status.Accepted = true
+		status.Acceptance = acceptance
+	}
+	return status, nil
+}
+
+// ListModelLicensesHandler lists the licenses of models used so far with
+// their acceptance state. License texts are left out; use
+// GET /models/licenses/lookup?model= for a single model's full text.
+func (s *OllamaService) ListModelLicensesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		licenses, err := models.ListModelLicenses(s.db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		result := make([]*ModelLicenseStatus, 0, len(licenses))
+		for i := range licenses {
+			licenses[i].Text = ""
+			status, err := s.licenseStatus(&licenses[i])
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			result = append(result, status)
+		}
+		c.JSON(http.StatusOK, gin.H{"licenses": result})
+	}
+}
+
+// GetModelLicenseHandler returns a model's license and acceptance state,
+// fetching the license from Ollama if it isn't stored yet
+func (s *OllamaService) GetModelLicenseHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		model := c.Query("model")
+		if model == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+			return
+		}
+
+		license, err := s.modelLicense(c.Request.Context(), model)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to get license: " + err.Error()})
+			return
+		}
+		status, err := s.licenseStatus(license)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	}
+}
+
+// AcceptLicenseRequest accepts a model's current license
+type AcceptLicenseRequest struct {
+	Model string `json:"model" binding:"required"`
+	// LicenseHash, if set, must match the current license so a client can't
+	// accept a license text it hasn't seen
+	LicenseHash string `json:"license_hash,omitempty"`
+	Note        string `json:"note,omitempty"`
+}
+
+// AcceptLicenseHandler records acceptance of a model's license
+func (s *OllamaService) AcceptLicenseHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req AcceptLicenseRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+
+		license, err := s.modelLicense(c.Request.Context(), req.Model)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to get license: " + err.Error()})
+			return
+		}
+		if license.Hash == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": license.Model + " declares no license"})
+			return
+		}
+		if req.LicenseHash != "" && req.LicenseHash != license.Hash {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":        "the license has changed; review it before accepting",
+				"license_hash": license.Hash,
+			})
+			return
+		}
+
+		acceptance := &models.LicenseAcceptance{
+			Model:       license.Model,
+			LicenseName: license.Name,
+			LicenseHash: license.Hash,
+			AcceptedBy:  authIdentity(c),
+			Note:        req.Note,
+		}
+		if err := models.RecordLicenseAcceptance(s.db, acceptance); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, acceptance)
+	}
+}
+
+// ListLicenseAcceptancesHandler returns the license acceptance audit trail,
+// optionally filtered with ?model=
+func ListLicenseAcceptancesHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		model := c.Query("model")
+		if model != "" {
+			model = normalizeModelName(model)
+		}
+		acceptances, err := models.ListLicenseAcceptances(db, model)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"acceptances": acceptances})
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"vessel-backend/internal/database"
+)
+
+// DatabaseIntegrityHandler runs an integrity check ("?quick=true" for the
+// faster quick_check that skips index consistency)
+func DatabaseIntegrityHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		quick := c.Query("quick") == "true"
+
+		start := time.Now()
+		problems, err := database.IntegrityCheck(c.Request.Context(), db, quick)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"ok":          len(problems) == 0,
+			"quick":       quick,
+			"problems":    problems,
+			"duration_ms": time.Since(start).Milliseconds(),
+		})
+	}
+}
+
+// DatabaseVacuumHandler reclaims free space ("?full=true" rewrites the file)
+func DatabaseVacuumHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		full := c.Query("full") == "true"
+		ctx := c.Request.Context()
+
+		before, err := database.GetStats(ctx, db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := database.Vacuum(ctx, db, full); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		after, err := database.GetStats(ctx, db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"full":            full,
+			"bytes_before":    before.TotalBytes,
+			"bytes_after":     after.TotalBytes,
+			"bytes_reclaimed": before.TotalBytes - after.TotalBytes,
+		})
+	}
+}
+
+// DatabaseAnalyzeHandler refreshes query planner statistics
+func DatabaseAnalyzeHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := database.Analyze(c.Request.Context(), db); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "analyze complete"})
+	}
+}
+
+// DatabaseStatsHandler reports database size broken down per table
+func DatabaseStatsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stats, err := database.GetStats(c.Request.Context(), db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, stats)
+	}
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"vessel-backend/internal/models"
+)
+
+// defaultMaintenanceMessage is returned for rejected writes when maintenance
+// mode is enabled without a message
+const defaultMaintenanceMessage = "server is in maintenance mode; changes are disabled"
+
+// maintenanceReadOnlyRoutes lists POST routes that don't change anything and
+// so stay available in maintenance mode. Cancelling running work and the
+// database maintenance actions are also allowed, so work can be drained and
+// the database tidied while writes are blocked.
+var maintenanceReadOnlyRoutes = map[string]bool{
+	"/api/v1/ollama/api/show":                              true,
+	"/api/v1/ollama/api/embed":                             true,
+	"/api/v1/ollama/api/embeddings":                        true,
+	"/api/v1/chat/preview":                                 true,
+	"/api/v1/chats/export":                                 true,
+	"/api/v1/rag/query":                                    true,
+	"/api/v1/admin/retention/preview":                      true,
+	"/api/v1/backends/ollama/validate":                     true,
+	"/api/v1/proxy/fetch":                                  true,
+	"/api/v1/proxy/search":                                 true,
+	"/api/v1/datasets/export":                              true,
+	"/api/v1/admin/maintenance":                            true,
+	"/api/v1/admin/db/vacuum":                              true,
+	"/api/v1/admin/db/analyze":                             true,
+	"/api/v1/generations/:id":                              true,
+	"/api/v1/evals/runs/:id/cancel":                        true,
+	"/api/v1/rag/collections/:id/uploads/:uploadId/cancel": true,
+}
+
+// maintenanceState mirrors the gate for background work, which pauses while
+// maintenance mode is enabled so a backup or migration sees no writes.
+// ended is closed when maintenance mode is turned off.
+var maintenanceState struct {
+	sync.Mutex
+	enabled bool
+	ended   chan struct{}
+}
+
+// setMaintenanceActive records whether maintenance mode is enabled
+func setMaintenanceActive(enabled bool) {
+	maintenanceState.Lock()
+	defer maintenanceState.Unlock()
+	switch {
+	case enabled && !maintenanceState.enabled:
+		maintenanceState.ended = make(chan struct{})
+	case !enabled && maintenanceState.enabled:
+		close(maintenanceState.ended)
+	}
+	maintenanceState.enabled = enabled
+}
+
+// InMaintenance reports whether maintenance mode is enabled. Schedulers skip
+// their ticks while it is.
+func InMaintenance() bool {
+	maintenanceState.Lock()
+	defer maintenanceState.Unlock()
+	return maintenanceState.enabled
+}
+
+// waitOutMaintenance blocks while maintenance mode is enabled. It returns
+// ctx's error if ctx is cancelled first.
+func waitOutMaintenance(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	maintenanceState.Lock()
+	enabled, ended := maintenanceState.enabled, maintenanceState.ended
+	maintenanceState.Unlock()
+	if !enabled {
+		return nil
+	}
+	select {
+	case <-ended:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// maintenanceGate holds the current maintenance mode so requests can be
+// checked without a database query
+type maintenanceGate struct {
+	mu   sync.RWMutex
+	mode models.MaintenanceMode
+}
+
+// newMaintenanceGate loads the stored maintenance mode
+func newMaintenanceGate(db *sql.DB) *maintenanceGate {
+	g := &maintenanceGate{}
+	mode, err := models.GetMaintenanceMode(db)
+	if err != nil {
+		log.Printf("[Maintenance] %v", err)
+		return g
+	}
+	g.mode = *mode
+	setMaintenanceActive(mode.Enabled)
+	if mode.Enabled {
+		log.Printf("[Maintenance] Maintenance mode is enabled; the API is read-only")
+	}
+	return g
+}
+
+// current returns the current maintenance mode
+func (g *maintenanceGate) current() models.MaintenanceMode {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.mode
+}
+
+// set replaces the current maintenance mode
+func (g *maintenanceGate) set(mode models.MaintenanceMode) {
+	g.mu.Lock()
+	g.mode = mode
+	g.mu.Unlock()
+	setMaintenanceActive(mode.Enabled)
+}
+
+// Guard rejects requests that change data with 503 while maintenance mode is
+// enabled. Reads and the routes in maintenanceReadOnlyRoutes pass through.
+func (g *maintenanceGate) Guard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mode := g.current()
+		if !mode.Enabled {
+			c.Next()
+			return
+		}
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if maintenanceReadOnlyRoutes[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		message := mode.Message
+		if message == "" {
+			message = defaultMaintenanceMessage
+		}
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error":       message,
+			"maintenance": mode,
+		})
+	}
+}
+
+// GetMaintenanceHandler returns the current maintenance mode
+func GetMaintenanceHandler(gate *maintenanceGate) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gate.current())
+	}
+}
+
+// UpdateMaintenanceHandler enables or disables maintenance mode. The mode is
+// stored, so it survives restarts in the middle of a migration.
+func UpdateMaintenanceHandler(db *sql.DB, gate *maintenanceGate) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.MaintenanceMode
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+
+		mode := models.MaintenanceMode{Enabled: req.Enabled, Message: strings.TrimSpace(req.Message)}
+		if mode.Enabled {
+			since := time.Now().UTC()
+			if current := gate.current(); current.Enabled && current.Since != nil {
+				since = *current.Since
+			}
+			mode.Since = &since
+		}
+
+		if err := models.SaveMaintenanceMode(db, &mode); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		gate.set(mode)
+		log.Printf("[Maintenance] Maintenance mode enabled: %v", mode.Enabled)
+		c.JSON(http.StatusOK, mode)
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"vessel-backend/internal/models"
+)
+
+func TestMaintenanceGuardAllowsReadOnlyRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gate := &maintenanceGate{}
+	gate.set(models.MaintenanceMode{Enabled: true, Message: "backup running"})
+	t.Cleanup(func() { setMaintenanceActive(false) })
+
+	r := gin.New()
+	r.Use(gate.Guard())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	for route := range maintenanceReadOnlyRoutes {
+		r.POST(route, ok)
+	}
+	r.POST("/api/v1/chats", ok)
+	r.GET("/api/v1/chats", ok)
+
+	post := func(path string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		return w.Code
+	}
+
+	for route := range maintenanceReadOnlyRoutes {
+		path := strings.NewReplacer(":id", "1", ":uploadId", "2").Replace(route)
+		if code := post(path); code != http.StatusOK {
+			t.Errorf("POST %s = %d in maintenance mode, want %d", path, code, http.StatusOK)
+		}
+	}
+	if code := post("/api/v1/chats/export"); code != http.StatusOK {
+		t.Errorf("POST /api/v1/chats/export = %d in maintenance mode, want %d", code, http.StatusOK)
+	}
+
+	if code := post("/api/v1/chats"); code != http.StatusServiceUnavailable {
+		t.Errorf("POST /api/v1/chats = %d in maintenance mode, want %d", code, http.StatusServiceUnavailable)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/chats", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /api/v1/chats = %d in maintenance mode, want %d", w.Code, http.StatusOK)
+	}
+}
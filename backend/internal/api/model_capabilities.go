@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+// toolTemplateMarkers appear in chat templates that render tool definitions
+// or parse tool calls
+var toolTemplateMarkers = []string{".Tools", ".ToolCalls", "<tool_call>", "[TOOL_CALLS]", "<|python_tag|>"}
+
+// capabilityCache remembers detected capabilities per model name and
+// digest, so listings only inspect a model again after it changes
+type capabilityCache struct {
+	mu      sync.Mutex
+	byModel map[string][]string
+}
+
+// newCapabilityCache creates an empty capability cache
+func newCapabilityCache() *capabilityCache {
+	return &capabilityCache{byModel: make(map[string][]string)}
+}
+
+// modelCapabilities returns what an installed model can do, asking Ollama
+// for the model's details the first time a digest is seen
+func (s *ModelRegistryService) modelCapabilities(ctx context.Context, name, digest string) ([]string, error) {
+	key := name + "@" + digest
+	s.capabilities.mu.Lock()
+	caps, ok := s.capabilities.byModel[key]
+	s.capabilities.mu.Unlock()
+	if ok {
+		return caps, nil
+	}
+
+	resp, err := s.ollamaClient.Show(ctx, &api.ShowRequest{Model: name})
+	if err != nil {
+		return nil, err
+	}
+	caps = detectCapabilities(resp)
+
+	s.capabilities.mu.Lock()
+	s.capabilities.byModel[key] = caps
+	s.capabilities.mu.Unlock()
+	return caps, nil
+}
+
+// detectCapabilities combines the capabilities Ollama reports with what the
+// model's metadata shows: tool markers in the chat template, a vision
+// projector (mmproj) or vision tensors, and embedding pooling. Older Ollama
+// versions report no capabilities, so the metadata is always checked.
+func detectCapabilities(resp *api.ShowResponse) []string {
+	found := make(map[string]bool)
+	for _, c := range resp.Capabilities {
+		found[string(c)] = true
+	}
+
+	for _, marker := range toolTemplateMarkers {
+		if strings.Contains(resp.Template, marker) {
+			found[string(model.CapabilityTools)] = true
+			break
+		}
+	}
+	if strings.Contains(resp.Template, ".Thinking") {
+		found[string(model.CapabilityThinking)] = true
+	}
+
+	if len(resp.ProjectorInfo) > 0 {
+		found[string(model.CapabilityVision)] = true
+	}
+	for key := range resp.ModelInfo {
+		switch {
+		case strings.Contains(key, ".vision."):
+			found[string(model.CapabilityVision)] = true
+		case strings.HasSuffix(key, ".pooling_type"):
+			found[string(model.CapabilityEmbedding)] = true
+		}
+	}
+
+	if !found[string(model.CapabilityEmbedding)] {
+		found[string(model.CapabilityCompletion)] = true
+	}
+
+	caps := make([]string, 0, len(found))
+	for c := range found {
+		caps = append(caps, c)
+	}
+	sort.Strings(caps)
+	return caps
+}
+
+// hasCapability reports whether a capability list contains c
+func hasCapability(caps []string, c string) bool {
+	return slices.Contains(caps, strings.ToLower(c))
+}
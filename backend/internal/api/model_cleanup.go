@@ -0,0 +1,101 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"vessel-backend/internal/models"
+)
+
+// defaultCleanupUnusedDays is how long a model must go unused before it is
+// suggested for deletion
+const defaultCleanupUnusedDays = 90
+
+// CleanupCandidate is an installed model that hasn't been used recently
+type CleanupCandidate struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName,omitempty"`
+	Size        int64  `json:"size"`
+	ModifiedAt  string `json:"modifiedAt"`
+	LastUsedAt  string `json:"lastUsedAt,omitempty"`
+	UseCount    int64  `json:"useCount"`
+}
+
+// CleanupSuggestionResponse lists the models that could be deleted to free
+// disk space, largest first
+type CleanupSuggestionResponse struct {
+	UnusedDays       int                `json:"unusedDays"`
+	Models           []CleanupCandidate `json:"models"`
+	ReclaimableBytes int64              `json:"reclaimableBytes"`
+}
+
+// CleanupSuggestionsHandler suggests installed models to delete: those not
+// used for unused_days (default 90). A model never used counts from when it
+// was pulled, and favorites are never suggested.
+func (s *ModelRegistryService) CleanupSuggestionsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.ollamaClient == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Ollama client not available"})
+			return
+		}
+
+		days := defaultCleanupUnusedDays
+		if v := c.Query("unused_days"); v != "" {
+			d, err := strconv.Atoi(v)
+			if err != nil || d < 1 {
+				respondValidationError(c, []FieldError{{Field: "unused_days", Message: "must be a positive number of days"}})
+				return
+			}
+			days = d
+		}
+		cutoff := time.Now().Add(-time.Duration(days) * 24 * time.Hour)
+
+		resp, err := s.ollamaClient.List(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to list models from Ollama: " + err.Error()})
+			return
+		}
+		metadata, err := models.ListModelMetadata(s.db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		result := CleanupSuggestionResponse{UnusedDays: days, Models: []CleanupCandidate{}}
+		for _, m := range resp.Models {
+			candidate := CleanupCandidate{
+				Name:       m.Name,
+				Size:       m.Size,
+				ModifiedAt: m.ModifiedAt.Format(time.RFC3339),
+			}
+			lastActive := m.ModifiedAt
+			if meta, ok := metadata[normalizeModelName(m.Name)]; ok {
+				if meta.Favorite {
+					continue
+				}
+				candidate.DisplayName = meta.DisplayName
+				candidate.UseCount = meta.UseCount
+				if meta.LastUsedAt != nil {
+					candidate.LastUsedAt = meta.LastUsedAt.Format(time.RFC3339)
+					if meta.LastUsedAt.After(lastActive) {
+						lastActive = *meta.LastUsedAt
+					}
+				}
+			}
+			if lastActive.After(cutoff) {
+				continue
+			}
+			result.Models = append(result.Models, candidate)
+			result.ReclaimableBytes += m.Size
+		}
+
+		sort.Slice(result.Models, func(i, j int) bool {
+			return result.Models[i].Size > result.Models[j].Size
+		})
+		c.JSON(http.StatusOK, result)
+	}
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/models"
+)
+
+// Limits for user-defined model labels
+const (
+	maxModelDisplayNameLen = 100
+	maxModelTags           = 20
+	maxModelTagLen         = 32
+	maxModelNotesLen       = 4000
+)
+
+// UpdateModelMetadataRequest is the request body for labelling a local model.
+// Omitted fields are left unchanged.
+type UpdateModelMetadataRequest struct {
+	DisplayName *string   `json:"displayName"`
+	Tags        *[]string `json:"tags"`
+	Notes       *string   `json:"notes"`
+	Favorite    *bool     `json:"favorite"`
+	Hidden      *bool     `json:"hidden"`
+}
+
+// UpdateModelMetadataHandler sets the display name, tags, notes and
+// favorite/hidden flags of an installed model. The model name is the wildcard path, so namespaced names
+// like user/model:tag work unescaped.
+func (s *ModelRegistryService) UpdateModelMetadataHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := strings.Trim(c.Param("name"), "/")
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "model name is required"})
+			return
+		}
+
+		var req UpdateModelMetadataRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+
+		if fieldErrs := validateModelMetadataRequest(&req); len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+
+		if s.ollamaClient == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Ollama client not available"})
+			return
+		}
+
+		list, err := s.ollamaClient.List(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to list models from Ollama: " + err.Error()})
+			return
+		}
+		installed := false
+		for _, m := range list.Models {
+			if sameModel(m.Name, name) {
+				installed = true
+				break
+			}
+		}
+		if !installed {
+			c.JSON(http.StatusNotFound, gin.H{"error": "model not installed: " + name})
+			return
+		}
+
+		meta, err := models.GetModelMetadata(s.db, normalizeModelName(name))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if req.DisplayName != nil {
+			meta.DisplayName = *req.DisplayName
+		}
+		if req.Tags != nil {
+			meta.Tags = *req.Tags
+		}
+		if req.Notes != nil {
+			meta.Notes = *req.Notes
+		}
+		if req.Favorite != nil {
+			meta.Favorite = *req.Favorite
+		}
+		if req.Hidden != nil {
+			meta.Hidden = *req.Hidden
+		}
+
+		if err := models.SaveModelMetadata(s.db, meta); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, meta)
+	}
+}
+
+// validateModelMetadataRequest checks label lengths and normalizes tags
+// (trimmed, lowercased, de-duplicated)
+func validateModelMetadataRequest(req *UpdateModelMetadataRequest) []FieldError {
+	var errs []FieldError
+
+	if req.DisplayName != nil {
+		trimmed := strings.TrimSpace(*req.DisplayName)
+		req.DisplayName = &trimmed
+		if len(trimmed) > maxModelDisplayNameLen {
+			errs = append(errs, FieldError{
+				Field:   "displayName",
+				Message: fmt.Sprintf("must be at most %d characters", maxModelDisplayNameLen),
+			})
+		}
+	}
+
+	if req.Tags != nil {
+		seen := make(map[string]bool)
+		tags := []string{}
+		for i, tag := range *req.Tags {
+			tag = strings.ToLower(strings.TrimSpace(tag))
+			field := fmt.Sprintf("tags[%d]", i)
+			switch {
+			case tag == "":
+				errs = append(errs, FieldError{Field: field, Message: "tag must not be empty"})
+			case len(tag) > maxModelTagLen:
+				errs = append(errs, FieldError{
+					Field:   field,
+					Message: fmt.Sprintf("must be at most %d characters", maxModelTagLen),
+				})
+			case !seen[tag]:
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+		if len(tags) > maxModelTags {
+			errs = append(errs, FieldError{
+				Field:   "tags",
+				Message: fmt.Sprintf("at most %d tags are allowed", maxModelTags),
+			})
+		}
+		req.Tags = &tags
+	}
+
+	if req.Notes != nil && len(*req.Notes) > maxModelNotesLen {
+		errs = append(errs, FieldError{
+			Field:   "notes",
+			Message: fmt.Sprintf("must be at most %d characters", maxModelNotesLen),
+		})
+	}
+
+	return errs
+}
+
+// includeHiddenModels reports whether a listing request asked for hidden (and
+// quarantined) models
+func includeHiddenModels(c *gin.Context) bool {
+	return c.Query("include_hidden") == "true"
+}
+
+// filterModelList drops hidden and quarantined models from an Ollama model
+// list (unless includeHidden) and moves favorites to the front, keeping
+// Ollama's order otherwise
+func filterModelList(db *sql.DB, resp *api.ListResponse, includeHidden bool) error {
+	metadata, err := models.ListModelMetadata(db)
+	if err != nil {
+		return err
+	}
+
+	visible := resp.Models[:0]
+	for _, m := range resp.Models {
+		if meta, ok := metadata[normalizeModelName(m.Name)]; ok && (meta.Hidden || meta.Corruption != "") && !includeHidden {
+			continue
+		}
+		visible = append(visible, m)
+	}
+
+	isFavorite := func(name string) bool {
+		meta, ok := metadata[normalizeModelName(name)]
+		return ok && meta.Favorite
+	}
+	sort.SliceStable(visible, func(i, j int) bool {
+		return isFavorite(visible[i].Name) && !isFavorite(visible[j].Name)
+	})
+
+	resp.Models = visible
+	return nil
+}
+
+// sortName is the name a local model sorts by: its display name when set
+func (m LocalModel) sortName() string {
+	if m.DisplayName != "" {
+		return strings.ToLower(m.DisplayName)
+	}
+	return strings.ToLower(m.Name)
+}
+
+// hasTag reports whether tags contains tag, ignoring case
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
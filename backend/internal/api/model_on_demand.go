@@ -0,0 +1,41 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// errModelPullFailed is returned when a model pulled on demand couldn't be
+// pulled
+var errModelPullFailed = errors.New("failed to pull model")
+
+// pullModelOnDemand makes sure the request's model is installed before the
+// request is dispatched. Ollama loads installed models on demand, but a
+// model that isn't installed fails the request; with pull on demand it is
+// pulled first and the request waits for the pull, following it when
+// another request already started it. Without pull on demand, and in
+// offline mode, a missing model is reported as a ModelUnavailableError.
+func (s *OllamaService) pullModelOnDemand(ctx context.Context, model string) error {
+	err := s.ensureModelAvailable(ctx, model)
+	var unavailable *ModelUnavailableError
+	if !s.pullOnDemand || IsOffline() || !errors.As(err, &unavailable) {
+		return err
+	}
+
+	log.Printf("[Ollama] Pulling %s on demand", model)
+	start := time.Now()
+	err = s.pull(ctx, &api.PullRequest{Model: model}, func(api.ProgressResponse) error { return nil })
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%w %q: %v", errModelPullFailed, model, err)
+	}
+	log.Printf("[Ollama] Pulled %s on demand in %s", model, time.Since(start).Round(time.Second))
+	return nil
+}
@@ -17,6 +17,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/models"
 )
 
 // RemoteModel represents a model from ollama.com with cached details
@@ -48,6 +50,12 @@ type ModelRegistryService struct {
 	ollamaClient *api.Client
 	httpClient  *http.Client
 	mu          sync.RWMutex
+	// details lazily fetches model details; nil when the worker is disabled
+	details     *detailsWorker
+	// capabilities caches detected capabilities of installed models
+	capabilities *capabilityCache
+	// bandwidth counts scraped pages against the monthly download caps
+	bandwidth *bandwidthMeter
 }
 
 // NewModelRegistryService creates a new model registry service
@@ -58,6 +66,7 @@ func NewModelRegistryService(db *sql.DB, ollamaClient *api.Client) *ModelRegistr
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		capabilities: newCapabilityCache(),
 	}
 }
 
@@ -75,6 +84,13 @@ type ScrapedModel struct {
 
 // scrapeOllamaLibrary fetches the model list from ollama.com/library
 func (s *ModelRegistryService) scrapeOllamaLibrary(ctx context.Context) ([]ScrapedModel, error) {
+	if err := checkOnline(); err != nil {
+		return nil, err
+	}
+	if err := s.bandwidth.check(models.BandwidthSourceRegistry); err != nil {
+		return nil, err
+	}
+
 	req, err := http.NewRequestWithContext(ctx, "GET", "https://ollama.com/library", nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -95,6 +111,7 @@ func (s *ModelRegistryService) scrapeOllamaLibrary(ctx context.Context) ([]Scrap
 	if err != nil {
 		return nil, fmt.Errorf("failed to read body: %w", err)
 	}
+	s.bandwidth.record(models.BandwidthSourceRegistry, int64(len(body)))
 
 	return parseLibraryHTML(string(body))
 }
@@ -319,29 +336,47 @@ func parsePullCount(s string) int64 {
 // scrapeModelDetailPage fetches the individual model page and extracts file sizes per tag
 // Example: "2.0GB · 128K context window" -> {"8b": 2147483648}
 func (s *ModelRegistryService) scrapeModelDetailPage(ctx context.Context, slug string) (map[string]int64, error) {
+	page, err := s.fetchModelPage(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseModelPageForSizes(page)
+}
+
+// fetchModelPage fetches a model's ollama.com library page
+func (s *ModelRegistryService) fetchModelPage(ctx context.Context, slug string) (string, error) {
+	if err := checkOnline(); err != nil {
+		return "", err
+	}
+	if err := s.bandwidth.check(models.BandwidthSourceRegistry); err != nil {
+		return "", err
+	}
+
 	url := "https://ollama.com/library/" + slug
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return "", fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("User-Agent", "OllamaWebUI/1.0")
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch model page: %w", err)
+		return "", fmt.Errorf("failed to fetch model page: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+		return "", fmt.Errorf("unexpected status: %d", resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read body: %w", err)
+		return "", fmt.Errorf("failed to read body: %w", err)
 	}
+	s.bandwidth.record(models.BandwidthSourceRegistry, int64(len(body)))
 
-	return parseModelPageForSizes(string(body))
+	return string(body), nil
 }
 
 // parseModelPageForSizes extracts file sizes from the model detail page
@@ -859,6 +894,16 @@ func (s *ModelRegistryService) SearchModelsAdvanced(ctx context.Context, params
 		orderBy = "pull_count DESC"
 	case "updated_desc":
 		orderBy = "ollama_updated_at DESC NULLS LAST, scraped_at DESC"
+	case "updated_asc":
+		orderBy = "ollama_updated_at ASC NULLS LAST, scraped_at ASC"
+	case "size_asc", "size_desc":
+		// By the smallest download among the model's tags; models whose
+		// sizes haven't been fetched sort last
+		dir := "ASC"
+		if params.SortBy == "size_desc" {
+			dir = "DESC"
+		}
+		orderBy = "(SELECT MIN(value) FROM json_each(tag_sizes)) " + dir + " NULLS LAST, pull_count DESC"
 	}
 
 	// For size/context filtering, we need to fetch all matching models first
@@ -1065,7 +1110,7 @@ func (s *ModelRegistryService) ListRemoteModelsHandler() gin.HandlerFunc {
 		params := ModelSearchParams{
 			Query:     c.Query("search"),
 			ModelType: c.Query("type"),
-			SortBy:    c.Query("sort"), // name_asc, name_desc, pulls_asc, pulls_desc, updated_desc
+			SortBy:    c.Query("sort"), // name_asc, name_desc, pulls_asc, pulls_desc, updated_asc, updated_desc, size_asc, size_desc
 			Family:    c.Query("family"),
 			Limit:     50,
 			Offset:    0,
@@ -1113,6 +1158,8 @@ func (s *ModelRegistryService) ListRemoteModelsHandler() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		// Models viewed without details get them fetched in the background
+		s.QueueDetails(models...)
 
 		c.JSON(http.StatusOK, gin.H{
 			"models": models,
@@ -1137,6 +1184,7 @@ func (s *ModelRegistryService) GetRemoteModelHandler() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		s.QueueDetails(*model)
 
 		c.JSON(http.StatusOK, model)
 	}
@@ -1215,9 +1263,25 @@ type LocalModel struct {
 	Family          string `json:"family"`
 	ParameterSize   string `json:"parameterSize"`
 	QuantizationLevel string `json:"quantizationLevel"`
+	// Capabilities detected from the model's template and metadata
+	// (completion, tools, vision, thinking, embedding)
+	Capabilities []string `json:"capabilities"`
+	// User-defined labels (see UpdateModelMetadataHandler)
+	DisplayName string   `json:"displayName,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Notes       string   `json:"notes,omitempty"`
+	Favorite    bool     `json:"favorite,omitempty"`
+	Hidden      bool     `json:"hidden,omitempty"`
+	// Corruption is set while the model is quarantined after failing
+	// checksum verification
+	Corruption string `json:"corruption,omitempty"`
 	// Update status (populated by CheckUpdatesHandler)
 	HasUpdate       bool   `json:"hasUpdate,omitempty"`
 	RemoteUpdatedAt string `json:"remoteUpdatedAt,omitempty"`
+	// LastUsedAt is when the model last answered a chat, and UseCount how
+	// many completions it has produced
+	LastUsedAt string `json:"lastUsedAt,omitempty"`
+	UseCount   int64  `json:"useCount"`
 }
 
 // LocalModelsResponse is the response for listing local models
@@ -1239,7 +1303,13 @@ type UpdateCheckResponse struct {
 // Query params:
 //   - search: filter by name (case-insensitive substring match)
 //   - family: filter by model family
-//   - sort: name_asc, name_desc, size_asc, size_desc, modified_asc, modified_desc (default: name_asc)
+//   - tag: filter by user-defined tag
+//   - capability: filter by detected capability (e.g. tools, vision)
+//   - include_hidden: include models marked hidden or quarantined as corrupt (default false)
+//   - sort: name_asc, name_desc, size_asc, size_desc, modified_asc, modified_desc,
+//     last_used_desc, last_used_asc, uses_desc, uses_asc (default: last_used_desc);
+//     modified is when the model was pulled, and models never used sort last
+//     by last use, by name
 //   - limit: max results (default 50, max 200)
 //   - offset: pagination offset
 func (s *ModelRegistryService) ListLocalModelsHandler() gin.HandlerFunc {
@@ -1252,9 +1322,12 @@ func (s *ModelRegistryService) ListLocalModelsHandler() gin.HandlerFunc {
 		// Parse query params
 		search := strings.ToLower(c.Query("search"))
 		family := strings.ToLower(c.Query("family"))
+		tag := c.Query("tag")
+		capability := c.Query("capability")
+		includeHidden := includeHiddenModels(c)
 		sortBy := c.Query("sort")
 		if sortBy == "" {
-			sortBy = "name_asc"
+			sortBy = "last_used_desc"
 		}
 
 		limit := 50
@@ -1273,6 +1346,12 @@ func (s *ModelRegistryService) ListLocalModelsHandler() gin.HandlerFunc {
 			return
 		}
 
+		metadata, err := models.ListModelMetadata(s.db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
 		// Convert to LocalModel and apply filters
 		var filtered []LocalModel
 		for _, m := range resp.Models {
@@ -1286,9 +1365,31 @@ func (s *ModelRegistryService) ListLocalModelsHandler() gin.HandlerFunc {
 				ParameterSize:     m.Details.ParameterSize,
 				QuantizationLevel: m.Details.QuantizationLevel,
 			}
+			if meta, ok := metadata[normalizeModelName(m.Name)]; ok {
+				lm.DisplayName = meta.DisplayName
+				lm.Tags = meta.Tags
+				lm.Notes = meta.Notes
+				lm.Favorite = meta.Favorite
+				lm.Hidden = meta.Hidden
+				lm.Corruption = meta.Corruption
+				if meta.LastUsedAt != nil {
+					lm.LastUsedAt = meta.LastUsedAt.Format(time.RFC3339)
+				}
+				lm.UseCount = meta.UseCount
+			}
+
+			if (lm.Hidden || lm.Corruption != "") && !includeHidden {
+				continue
+			}
+
+			// Apply search filter (name, display name, or tag)
+			if search != "" && !strings.Contains(strings.ToLower(lm.Name), search) &&
+				!strings.Contains(strings.ToLower(lm.DisplayName), search) && !hasTag(lm.Tags, search) {
+				continue
+			}
 
-			// Apply search filter
-			if search != "" && !strings.Contains(strings.ToLower(lm.Name), search) {
+			// Apply tag filter
+			if tag != "" && !hasTag(lm.Tags, tag) {
 				continue
 			}
 
@@ -1297,6 +1398,18 @@ func (s *ModelRegistryService) ListLocalModelsHandler() gin.HandlerFunc {
 				continue
 			}
 
+			caps, err := s.modelCapabilities(c.Request.Context(), m.Name, m.Digest)
+			if err != nil {
+				log.Printf("Warning: failed to detect capabilities for %s: %v", m.Name, err)
+				caps = []string{}
+			}
+			lm.Capabilities = caps
+
+			// Apply capability filter
+			if capability != "" && !hasCapability(lm.Capabilities, capability) {
+				continue
+			}
+
 			filtered = append(filtered, lm)
 		}
 
@@ -1304,11 +1417,11 @@ func (s *ModelRegistryService) ListLocalModelsHandler() gin.HandlerFunc {
 		switch sortBy {
 		case "name_asc":
 			sort.Slice(filtered, func(i, j int) bool {
-				return strings.ToLower(filtered[i].Name) < strings.ToLower(filtered[j].Name)
+				return filtered[i].sortName() < filtered[j].sortName()
 			})
 		case "name_desc":
 			sort.Slice(filtered, func(i, j int) bool {
-				return strings.ToLower(filtered[i].Name) > strings.ToLower(filtered[j].Name)
+				return filtered[i].sortName() > filtered[j].sortName()
 			})
 		case "size_asc":
 			sort.Slice(filtered, func(i, j int) bool {
@@ -1326,8 +1439,43 @@ func (s *ModelRegistryService) ListLocalModelsHandler() gin.HandlerFunc {
 			sort.Slice(filtered, func(i, j int) bool {
 				return filtered[i].ModifiedAt > filtered[j].ModifiedAt
 			})
+		case "last_used_desc", "last_used_asc":
+			desc := sortBy == "last_used_desc"
+			sort.Slice(filtered, func(i, j int) bool {
+				a, b := filtered[i].LastUsedAt, filtered[j].LastUsedAt
+				if a == "" || b == "" {
+					if a == b {
+						return filtered[i].sortName() < filtered[j].sortName()
+					}
+					return b == ""
+				}
+				if desc {
+					return a > b
+				}
+				return a < b
+			})
+		case "uses_desc", "uses_asc":
+			desc := sortBy == "uses_desc"
+			sort.Slice(filtered, func(i, j int) bool {
+				a, b := filtered[i].UseCount, filtered[j].UseCount
+				if a == b {
+					if filtered[i].LastUsedAt != filtered[j].LastUsedAt {
+						return filtered[i].LastUsedAt > filtered[j].LastUsedAt
+					}
+					return filtered[i].sortName() < filtered[j].sortName()
+				}
+				if desc {
+					return a > b
+				}
+				return a < b
+			})
 		}
 
+		// Favorites first, keeping the requested order within each group
+		sort.SliceStable(filtered, func(i, j int) bool {
+			return filtered[i].Favorite && !filtered[j].Favorite
+		})
+
 		// Paginate
 		total := len(filtered)
 		if offset >= total {
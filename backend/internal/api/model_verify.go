@@ -0,0 +1,284 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/models"
+)
+
+// defaultModelRegistry is the registry Ollama leaves out of model names
+const defaultModelRegistry = "registry.ollama.ai"
+
+// modelManifest is the part of an Ollama model manifest naming its files
+type modelManifest struct {
+	Config modelBlob   `json:"config"`
+	Layers []modelBlob `json:"layers"`
+}
+
+// modelBlob is a file of a model, stored under its digest
+type modelBlob struct {
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+// RedownloadModelRequest is the request body for re-downloading a model
+type RedownloadModelRequest struct {
+	Model string `json:"model"`
+}
+
+// VerifyModelsJobHandler checks every installed model's files against the
+// checksums in its manifest in the background. Models that fail are
+// quarantined: they are left out of model lists until re-downloaded (see
+// RedownloadModelHandler). It reads Ollama's models directory, so it only
+// works when that is on this machine.
+func (s *OllamaService) VerifyModelsJobHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.modelsDir == "" {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "model verification is disabled; set -ollama-models-dir"})
+			return
+		}
+		if s.activeBulkJob(models.BulkJobVerifyModels) {
+			c.JSON(http.StatusConflict, gin.H{"error": "models are already being verified"})
+			return
+		}
+		names, err := s.installedModelManifests()
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		s.startBulkJob(c, models.BulkJobVerifyModels, gin.H{"models_dir": s.modelsDir}, names)
+	}
+}
+
+// installedModelManifests returns the names of the models with a manifest
+// in the models directory, sorted
+func (s *OllamaService) installedModelManifests() ([]string, error) {
+	manifests, err := listModelManifests(s.modelsDir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(manifests))
+	for name := range manifests {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// verifyModelsTask verifies each model, updating its quarantine. The
+// manifests are read again before the first model of every attempt.
+func (s *OllamaService) verifyModelsTask() bulkTask {
+	var manifests map[string]string
+	return bulkTask{
+		prepare: func(ctx context.Context) error {
+			var err error
+			manifests, err = listModelManifests(s.modelsDir)
+			return err
+		},
+		run: func(ctx context.Context, name string) error {
+			path, ok := manifests[name]
+			if !ok {
+				return fmt.Errorf("model is no longer installed")
+			}
+			verifyErr := verifyModelManifest(ctx, s.modelsDir, path)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			reason := ""
+			if verifyErr != nil {
+				reason = verifyErr.Error()
+				log.Printf("[Models] Quarantined %s: %s", name, reason)
+			}
+			if err := models.SetModelCorruption(s.db, normalizeModelName(name), reason); err != nil {
+				return err
+			}
+			return verifyErr
+		},
+	}
+}
+
+// StartModelVerification re-verifies all installed models every interval as
+// a bulk job, skipping a round while one is still going or maintenance mode
+// is enabled. A zero interval or
+// no models directory disables it.
+func (s *OllamaService) StartModelVerification(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || s.modelsDir == "" || s.db == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if InMaintenance() || s.activeBulkJob(models.BulkJobVerifyModels) {
+				continue
+			}
+			names, err := s.installedModelManifests()
+			if err != nil {
+				log.Printf("[Models] Scheduled verification skipped: %v", err)
+				continue
+			}
+			if _, err := s.queueBulkJob(models.BulkJobVerifyModels, gin.H{"models_dir": s.modelsDir, "scheduled": true}, names); err != nil {
+				log.Printf("[Models] %v", err)
+			}
+		}
+	}()
+}
+
+// RedownloadModelHandler replaces a quarantined model's files: it deletes the
+// model from Ollama, keeping its metadata, and pulls it again, streaming the
+// progress like PullModelHandler. The quarantine is lifted once the pull
+// succeeds.
+func (s *OllamaService) RedownloadModelHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RedownloadModelRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+		if strings.TrimSpace(req.Model) == "" {
+			respondValidationError(c, []FieldError{{Field: "model", Message: "is required"}})
+			return
+		}
+
+		// Ollama skips layers it already has when pulling, so the damaged
+		// files have to go first
+		if err := s.client.Delete(c.Request.Context(), &api.DeleteRequest{Model: req.Model}); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "delete failed: " + err.Error()})
+			return
+		}
+
+		if !s.streamPull(c, &api.PullRequest{Model: req.Model}) {
+			return
+		}
+		if err := models.SetModelCorruption(s.db, normalizeModelName(req.Model), ""); err != nil {
+			log.Printf("[Models] Failed to lift quarantine of %s: %v", req.Model, err)
+		}
+	}
+}
+
+// listModelManifests returns the manifest paths of the models in an Ollama
+// models directory, by model name
+func listModelManifests(dir string) (map[string]string, error) {
+	root := filepath.Join(dir, "manifests")
+	if _, err := os.Stat(root); err != nil {
+		return nil, fmt.Errorf("cannot read Ollama models directory %s: %w", dir, err)
+	}
+
+	manifests := make(map[string]string)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		// Manifests live at <registry>/<namespace>/<model>/<tag>
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) != 4 {
+			return nil
+		}
+		name := strings.Join(parts[:3], "/") + ":" + parts[3]
+		switch {
+		case parts[0] == defaultModelRegistry && parts[1] == "library":
+			name = parts[2] + ":" + parts[3]
+		case parts[0] == defaultModelRegistry:
+			name = parts[1] + "/" + parts[2] + ":" + parts[3]
+		}
+		manifests[name] = path
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list model manifests: %w", err)
+	}
+	return manifests, nil
+}
+
+// verifyModelManifest checks that every file a manifest names is present,
+// has the recorded size and matches its digest
+func verifyModelManifest(ctx context.Context, dir, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var manifest modelManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	blobs := append([]modelBlob{manifest.Config}, manifest.Layers...)
+	for _, blob := range blobs {
+		if blob.Digest == "" {
+			continue
+		}
+		if err := verifyModelBlob(ctx, dir, blob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyModelBlob hashes one file of a model and compares it with its digest
+func verifyModelBlob(ctx context.Context, dir string, blob modelBlob) error {
+	algorithm, want, ok := strings.Cut(blob.Digest, ":")
+	if !ok || algorithm != "sha256" {
+		return fmt.Errorf("unsupported digest %s", blob.Digest)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "blobs", "sha256-"+want))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("file %s is missing", blob.Digest)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", blob.Digest, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, &contextReader{ctx: ctx, r: f})
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", blob.Digest, err)
+	}
+	if blob.Size > 0 && n != blob.Size {
+		return fmt.Errorf("file %s has %d bytes, expected %d", blob.Digest, n, blob.Size)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return fmt.Errorf("file %s is corrupt: checksum is sha256:%s", blob.Digest, got)
+	}
+	return nil
+}
+
+// contextReader stops reading once its context is done, so hashing a large
+// file can be cancelled
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OfflineErrorCode is the error code returned by endpoints that need the
+// internet while offline mode is enabled
+const OfflineErrorCode = "OFFLINE"
+
+// ErrOffline is returned instead of making an external request in offline mode
+var ErrOffline = errors.New("offline mode is enabled; external network access is disabled")
+
+// offlineMode disables every request to the internet: registry scraping, web
+// search and fetches, geolocation and update checks. The Ollama backend is
+// not affected. It is set once at startup from Config.Offline.
+var offlineMode atomic.Bool
+
+// SetOffline enables or disables offline mode
+func SetOffline(offline bool) {
+	offlineMode.Store(offline)
+}
+
+// IsOffline reports whether offline mode is enabled
+func IsOffline() bool {
+	return offlineMode.Load()
+}
+
+// checkOnline returns ErrOffline in offline mode. External requests call it
+// before dialing, so background jobs can't reach the internet either.
+func checkOnline() error {
+	if IsOffline() {
+		return ErrOffline
+	}
+	return nil
+}
+
+// respondOffline rejects a request that would need the internet
+func respondOffline(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+		"error": ErrOffline.Error(),
+		"code":  OfflineErrorCode,
+	})
+}
+
+// RequireOnline rejects requests with an OFFLINE error in offline mode; it
+// guards endpoints that only exist to reach external services
+func RequireOnline() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if IsOffline() {
+			respondOffline(c)
+			return
+		}
+		c.Next()
+	}
+}
@@ -10,9 +10,14 @@ import (
 
 // OllamaProxyHandler returns a handler that proxies requests to Ollama
 func OllamaProxyHandler(ollamaURL string) gin.HandlerFunc {
+	baseURL, transport, err := backendEndpoint(ollamaURL)
 	return func(c *gin.Context) {
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid Ollama URL: " + err.Error()})
+			return
+		}
 		path := c.Param("path")
-		targetURL := strings.TrimSuffix(ollamaURL, "/") + path
+		targetURL := strings.TrimSuffix(baseURL.String(), "/") + path
 
 		// Create proxy request
 		req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, targetURL, c.Request.Body)
@@ -29,7 +34,7 @@ func OllamaProxyHandler(ollamaURL string) gin.HandlerFunc {
 		}
 
 		// Execute request
-		client := &http.Client{}
+		client := &http.Client{Transport: transport}
 		resp, err := client.Do(req)
 		if err != nil {
 			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to reach Ollama: " + err.Error()})
@@ -2,20 +2,73 @@ package api
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
-	"net/url"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/models"
 )
 
 // OllamaService wraps the official Ollama client
 type OllamaService struct {
 	client    *api.Client
 	ollamaURL string
+	db        *sql.DB
+	// defaultModel is used when neither the request nor its chat names a model
+	defaultModel string
+	// generations buffers streaming chats so clients can resume them
+	generations *GenerationStore
+	// completionCacheTTL is how long deterministic completions are cached
+	completionCacheTTL time.Duration
+	// evals executes eval runs in the background
+	evals *evalRunner
+	// hooks inspect, modify or deny prompts and responses, in order
+	hooks []ChatHook
+	// middleware is the chat pipeline's middleware chain, in order
+	middleware []ChatMiddleware
+	// breaker stops requests to Ollama after repeated failures
+	breaker *CircuitBreaker
+	// metrics remembers the speed of the last completion
+	metrics *backendMetrics
+	// statusCache keeps the last status probe answer for when a probe times out
+	statusCache *backendStatusCache
+	// uploads ingests uploaded files into RAG collections in the background
+	uploads *uploadRunner
+	// uploadDir is where uploaded files are spooled while they are ingested
+	uploadDir string
+	// bandwidth counts pulled and fetched bytes against the monthly caps
+	bandwidth *bandwidthMeter
+	// jobs executes bulk jobs in the background
+	jobs *bulkRunner
+	// modelsDir is Ollama's models directory, read to verify model files
+	modelsDir string
+	// baseURL and transport reach Ollama, which may be behind a unix socket
+	baseURL   string
+	transport http.RoundTripper
+	// imageMaxDimension is the longest side images are scaled down to
+	imageMaxDimension int
+	// pulls shares each model's pull between the requests for it
+	pulls *pullRegistry
+	// translationModel translates chats when the request names no model
+	translationModel string
+	// warm keeps the most recently used models loaded; nil when off
+	warm *warmPool
+	// pullOnDemand pulls a chat's model when it isn't installed instead of
+	// failing the request
+	pullOnDemand bool
+	// vram keeps chats' models within the GPU's memory; nil when off
+	vram *vramBudget
+	// events fans out the backend's state changes
+	events *backendEventHub
 }
 
 // Client returns the underlying Ollama API client
@@ -23,22 +76,46 @@ func (s *OllamaService) Client() *api.Client {
 	return s.client
 }
 
-// NewOllamaService creates a new Ollama service with the official client
-func NewOllamaService(ollamaURL string) (*OllamaService, error) {
-	baseURL, err := url.Parse(ollamaURL)
+// NewOllamaService creates a new Ollama service with the official client.
+// The database is used to look up per-chat settings and may be nil.
+func NewOllamaService(ollamaURL string, db *sql.DB) (*OllamaService, error) {
+	baseURL, transport, err := backendEndpoint(ollamaURL)
 	if err != nil {
 		return nil, fmt.Errorf("invalid Ollama URL: %w", err)
 	}
 
-	client := api.NewClient(baseURL, http.DefaultClient)
-
-	return &OllamaService{
-		client:    client,
-		ollamaURL: ollamaURL,
-	}, nil
+	breaker := NewCircuitBreaker("ollama")
+	httpClient := &http.Client{
+		Transport: &circuitTransport{breaker: breaker, next: transport},
+	}
+	client := api.NewClient(baseURL, httpClient)
+
+	s := &OllamaService{
+		client:      client,
+		ollamaURL:   ollamaURL,
+		baseURL:     strings.TrimSuffix(baseURL.String(), "/"),
+		transport:   transport,
+		db:          db,
+		generations: NewGenerationStore(),
+		evals:       newEvalRunner(),
+		breaker:     breaker,
+		metrics:     &backendMetrics{},
+		statusCache: &backendStatusCache{},
+		uploads:     newUploadRunner(),
+		jobs:        newBulkRunner(1),
+		pulls:       newPullRegistry(),
+		events:      newBackendEventHub(),
+
+		imageMaxDimension: DefaultImageMaxDimension,
+	}
+	if err := s.setChatMiddleware(nil); err != nil {
+		return nil, err
+	}
+	return s, nil
 }
 
-// ListModelsHandler returns available models
+// ListModelsHandler returns available models, favorites first and without
+// hidden ones unless ?include_hidden=true
 func (s *OllamaService) ListModelsHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		resp, err := s.client.List(c.Request.Context())
@@ -46,6 +123,12 @@ func (s *OllamaService) ListModelsHandler() gin.HandlerFunc {
 			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to list models: " + err.Error()})
 			return
 		}
+		if s.db != nil {
+			if err := filterModelList(s.db, resp, includeHiddenModels(c)); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
 		c.JSON(http.StatusOK, resp)
 	}
 }
@@ -71,74 +154,74 @@ func (s *OllamaService) ShowModelHandler() gin.HandlerFunc {
 // ChatHandler handles streaming chat requests
 func (s *OllamaService) ChatHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req api.ChatRequest
+		var req ChatPipelineRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
 			return
 		}
 
-		// Check if streaming is requested (default true for chat)
-		streaming := req.Stream == nil || *req.Stream
-
-		if streaming {
-			s.handleStreamingChat(c, &req)
-		} else {
-			s.handleNonStreamingChat(c, &req)
+		if !s.prepareChatRequest(c, &req) {
+			return
+		}
+		s.applyWarmPool(&req, true)
+		if err := s.reserveVRAM(c.Request.Context(), req.Model); err != nil {
+			respondChatSettingsError(c, err)
+			return
 		}
-	}
-}
-
-// handleStreamingChat handles streaming chat responses
-func (s *OllamaService) handleStreamingChat(c *gin.Context, req *api.ChatRequest) {
-	// Set headers for streaming
-	c.Header("Content-Type", "application/x-ndjson")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-	c.Header("Transfer-Encoding", "chunked")
-
-	ctx := c.Request.Context()
-	flusher, ok := c.Writer.(http.Flusher)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "streaming not supported"})
-		return
-	}
 
-	err := s.client.Chat(ctx, req, func(resp api.ChatResponse) error {
-		// Check if context is cancelled
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
+		// Snapshot the effective settings so saved messages stay interpretable
+		var settingsHash string
+		if s.db != nil {
+			snapshotReq := req.ChatRequest
+			if req.generatedSeed {
+				snapshotReq.Options = withoutSeed(req.Options)
+			}
+			if hash, err := s.snapshotSettings(c.Request.Context(), &snapshotReq); err == nil {
+				settingsHash = hash
+				c.Header(SettingsSnapshotHeader, hash)
+			}
+		}
+		if seed := requestSeed(req.Options); seed != nil {
+			c.Header(GenerationSeedHeader, formatSeed(*seed))
 		}
 
-		// Marshal and write response
-		data, err := json.Marshal(resp)
-		if err != nil {
-			return err
+		if req.N > 1 {
+			s.handleChatChoices(c, &req)
+			return
 		}
 
-		_, err = c.Writer.Write(append(data, '\n'))
-		if err != nil {
-			return err
+		// Check if streaming is requested (default true for chat)
+		streaming := req.Stream == nil || *req.Stream
+
+		// Deterministic requests can be answered from the completion cache
+		cacheKey := s.completionCacheKey(&req)
+		if cacheKey != "" {
+			if s.serveCachedCompletion(c, &req, cacheKey, streaming) {
+				return
+			}
+			c.Header(CompletionCacheHeader, "miss")
 		}
-		flusher.Flush()
-		return nil
-	})
 
-	if err != nil && err != context.Canceled {
-		// Write error as final message if we haven't finished
-		errResp := gin.H{"error": err.Error()}
-		data, _ := json.Marshal(errResp)
-		c.Writer.Write(append(data, '\n'))
-		flusher.Flush()
+		if streaming {
+			// Streams run detached from the connection and are buffered so an
+			// interrupted client can resume via /generations/:id
+			g := s.startGeneration(&req, settingsHash, cacheKey)
+			streamGeneration(c, g, 0, req.StreamFormat)
+		} else {
+			s.handleNonStreamingChat(c, &req, cacheKey)
+		}
 	}
 }
 
-// handleNonStreamingChat handles non-streaming chat responses
-func (s *OllamaService) handleNonStreamingChat(c *gin.Context, req *api.ChatRequest) {
+// handleNonStreamingChat handles non-streaming chat responses, caching the
+// result under cacheKey when it is set
+func (s *OllamaService) handleNonStreamingChat(c *gin.Context, req *ChatPipelineRequest, cacheKey string) {
 	var finalResp api.ChatResponse
 
-	err := s.client.Chat(c.Request.Context(), req, func(resp api.ChatResponse) error {
+	timer := newChatTimer()
+	err := s.client.Chat(c.Request.Context(), &req.ChatRequest, func(resp api.ChatResponse) error {
+		timer.observe(resp)
+		s.observeChunk(req, resp)
 		finalResp = resp
 		return nil
 	})
@@ -147,8 +230,29 @@ func (s *OllamaService) handleNonStreamingChat(c *gin.Context, req *api.ChatRequ
 		c.JSON(http.StatusBadGateway, gin.H{"error": "chat failed: " + err.Error()})
 		return
 	}
+	s.recordTokenUsage(req, finalResp.Metrics)
 
-	c.JSON(http.StatusOK, finalResp)
+	// A structured reply cut off by the token limit is repaired to parse
+	var repair *JSONRepair
+	if finalResp.DoneReason == JSONRepairLength {
+		repair = repairStructuredReply(&req.ChatRequest, &finalResp.Message, JSONRepairLength)
+	}
+
+	if err := s.finishChat(c.Request.Context(), req, &finalResp.Message); err != nil {
+		respondChatMiddlewareError(c, err)
+		return
+	}
+
+	if cacheKey != "" {
+		s.storeCompletion(cacheKey, finalResp)
+	}
+
+	c.JSON(http.StatusOK, TimedChatResponse{
+		ChatResponse: finalResp,
+		Timings:      timer.timings(finalResp.Metrics),
+		Config:       s.effectiveConfig(req),
+		JSONRepair:   repair,
+	})
 }
 
 // GenerateHandler handles streaming generate requests
@@ -258,44 +362,50 @@ func (s *OllamaService) PullModelHandler() gin.HandlerFunc {
 			return
 		}
 
-		c.Header("Content-Type", "application/x-ndjson")
-		c.Header("Cache-Control", "no-cache")
-		c.Header("Connection", "keep-alive")
+		s.streamPull(c, &req)
+	}
+}
 
-		ctx := c.Request.Context()
-		flusher, ok := c.Writer.(http.Flusher)
-		if !ok {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "streaming not supported"})
-			return
-		}
+// streamPull pulls a model, streaming Ollama's progress as NDJSON with a
+// final error line if the pull fails, and reports whether it succeeded
+func (s *OllamaService) streamPull(c *gin.Context, req *api.PullRequest) bool {
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
 
-		err := s.client.Pull(ctx, &req, func(resp api.ProgressResponse) error {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
-			}
+	ctx := c.Request.Context()
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "streaming not supported"})
+		return false
+	}
 
-			data, err := json.Marshal(resp)
-			if err != nil {
-				return err
-			}
+	err := s.pull(ctx, req, func(resp api.ProgressResponse) error {
+		data, err := json.Marshal(resp)
+		if err != nil {
+			return err
+		}
 
-			_, err = c.Writer.Write(append(data, '\n'))
-			if err != nil {
-				return err
-			}
-			flusher.Flush()
-			return nil
-		})
+		_, err = c.Writer.Write(append(data, '\n'))
+		if err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
 
-		if err != nil && err != context.Canceled {
-			errResp := gin.H{"error": err.Error()}
-			data, _ := json.Marshal(errResp)
-			c.Writer.Write(append(data, '\n'))
-			flusher.Flush()
+	if err != nil && err != context.Canceled {
+		errResp := gin.H{"error": err.Error()}
+		var capErr *BandwidthCapError
+		if errors.As(err, &capErr) {
+			errResp["code"] = BandwidthCapErrorCode
+			errResp["resets_at"] = capErr.ResetsAt
 		}
+		data, _ := json.Marshal(errResp)
+		c.Writer.Write(append(data, '\n'))
+		flusher.Flush()
 	}
+	return err == nil
 }
 
 // DeleteModelHandler handles model deletion
@@ -313,6 +423,13 @@ func (s *OllamaService) DeleteModelHandler() gin.HandlerFunc {
 			return
 		}
 
+		if s.db != nil {
+			if err := models.DeleteModelMetadata(s.db, normalizeModelName(req.Model)); err != nil {
+				log.Printf("[Ollama] Failed to remove metadata for %s: %v", req.Model, err)
+			}
+		}
+		s.forgetModelLicense(req.Model)
+
 		c.JSON(http.StatusOK, gin.H{"status": "success"})
 	}
 }
@@ -386,6 +503,72 @@ func (s *OllamaService) CreateModelHandler() gin.HandlerFunc {
 	}
 }
 
+// ListRunningHandler returns the models currently loaded into memory
+func (s *OllamaService) ListRunningHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp, err := s.client.ListRunning(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to list running models: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// UnloadModelHandler evicts a model from memory to free VRAM.
+// The route uses a wildcard (/models/*path) because model names may contain
+// slashes (e.g. "user/model:tag"), so the path must end in "/unload".
+func (s *OllamaService) UnloadModelHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Param("path")
+		if !strings.HasSuffix(path, "/unload") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown model action"})
+			return
+		}
+		name := strings.Trim(strings.TrimSuffix(path, "/unload"), "/")
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "model name is required"})
+			return
+		}
+
+		if err := s.unloadModel(c.Request.Context(), name); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to unload model: " + err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "unloaded", "model": name})
+	}
+}
+
+// unloadModel asks Ollama to unload a model by sending an empty generate
+// request with keep_alive set to zero
+func (s *OllamaService) unloadModel(ctx context.Context, name string) error {
+	stream := false
+	req := &api.GenerateRequest{
+		Model:     name,
+		Stream:    &stream,
+		KeepAlive: &api.Duration{Duration: 0},
+	}
+	return s.client.Generate(ctx, req, func(api.GenerateResponse) error { return nil })
+}
+
+// parseKeepAlive parses an Ollama keep_alive value such as "5m", "0", "-1",
+// or a number of seconds
+func parseKeepAlive(value string) (*api.Duration, error) {
+	var d api.Duration
+	raw, _ := json.Marshal(value)
+	if err := d.UnmarshalJSON(raw); err != nil {
+		return nil, fmt.Errorf("invalid keep_alive %q: %w", value, err)
+	}
+	return &d, nil
+}
+
+// validateKeepAlive reports whether a keep_alive value can be parsed
+func validateKeepAlive(value string) error {
+	_, err := parseKeepAlive(value)
+	return err
+}
+
 // VersionHandler returns Ollama version
 func (s *OllamaService) VersionHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -417,7 +600,7 @@ func (s *OllamaService) HeartbeatHandler() gin.HandlerFunc {
 func (s *OllamaService) ProxyHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		path := c.Param("path")
-		targetURL := s.ollamaURL + path
+		targetURL := s.baseURL + path
 
 		req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, targetURL, c.Request.Body)
 		if err != nil {
@@ -432,7 +615,7 @@ func (s *OllamaService) ProxyHandler() gin.HandlerFunc {
 			}
 		}
 
-		client := &http.Client{}
+		client := &http.Client{Transport: s.transport}
 		resp, err := client.Do(req)
 		if err != nil {
 			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to reach Ollama: " + err.Error()})
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+)
+
+// PreviewTemplate describes the prompt template Ollama will use for a model
+type PreviewTemplate struct {
+	// Source is "renderer" when Ollama uses a built-in renderer, "modelfile" otherwise
+	Source   string `json:"source"`
+	Renderer string `json:"renderer,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+// PreviewTokenCounts holds estimated token usage for a previewed request
+type PreviewTokenCounts struct {
+	Messages       []int `json:"messages"`
+	Total          int   `json:"total"`
+	RenderedPrompt int   `json:"renderedPrompt,omitempty"`
+	ContextBudget  int   `json:"contextBudget,omitempty"`
+	FitsContext    bool  `json:"fitsContext"`
+}
+
+// ChatPreviewResponse is the result of a dry-run chat request
+type ChatPreviewResponse struct {
+	Model             string             `json:"model"`
+	Messages          []api.Message      `json:"messages"`
+	Options           map[string]any     `json:"options,omitempty"`
+	ModelSystemPrompt string             `json:"modelSystemPrompt,omitempty"`
+	Template          PreviewTemplate    `json:"template"`
+	RenderedPrompt    string             `json:"renderedPrompt,omitempty"`
+	RenderError       string             `json:"renderError,omitempty"`
+	TokenCounts       PreviewTokenCounts `json:"tokenCounts"`
+}
+
+// ChatPreviewHandler runs a chat request through the backend pipeline but
+// stops before inference, returning exactly what would be sent to the model
+func (s *OllamaService) ChatPreviewHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var pipelineReq ChatPipelineRequest
+		if err := c.ShouldBindJSON(&pipelineReq); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+
+		if !s.prepareChatRequest(c, &pipelineReq) {
+			return
+		}
+		req := pipelineReq.ChatRequest
+
+		ctx := c.Request.Context()
+
+		show, err := s.client.Show(ctx, &api.ShowRequest{Model: req.Model})
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to show model: " + err.Error()})
+			return
+		}
+
+		resp := ChatPreviewResponse{
+			Model:             req.Model,
+			Messages:          req.Messages,
+			Options:           req.Options,
+			ModelSystemPrompt: show.System,
+			Template:          previewTemplate(show),
+		}
+
+		// Ask Ollama to render the template without running the model
+		renderReq := req
+		renderReq.DebugRenderOnly = true
+		stream := false
+		renderReq.Stream = &stream
+
+		err = s.client.Chat(ctx, &renderReq, func(r api.ChatResponse) error {
+			if r.DebugInfo != nil {
+				resp.RenderedPrompt = r.DebugInfo.RenderedTemplate
+			}
+			return nil
+		})
+		if err != nil {
+			resp.RenderError = err.Error()
+		}
+
+		// Estimate token usage against the context budget
+		counts := PreviewTokenCounts{Messages: make([]int, len(req.Messages))}
+		for i, msg := range req.Messages {
+			counts.Messages[i] = estimateMessageTokens(msg)
+			counts.Total += counts.Messages[i]
+		}
+		counts.RenderedPrompt = estimateTokens(resp.RenderedPrompt)
+
+		if numCtx, present, ok := optionFloat(req.Options, "num_ctx"); present && ok {
+			counts.ContextBudget = int(numCtx)
+		} else {
+			counts.ContextBudget = modelContextLength(show)
+		}
+
+		used := counts.Total
+		if counts.RenderedPrompt > used {
+			used = counts.RenderedPrompt
+		}
+		counts.FitsContext = counts.ContextBudget == 0 || used <= counts.ContextBudget
+		resp.TokenCounts = counts
+
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// previewTemplate reports which template Ollama selects for a model
+func previewTemplate(show *api.ShowResponse) PreviewTemplate {
+	if show.Renderer != "" {
+		return PreviewTemplate{Source: "renderer", Renderer: show.Renderer}
+	}
+	return PreviewTemplate{Source: "modelfile", Content: show.Template}
+}
+
+// modelContextLength extracts the trained context length from model info
+// (keys look like "llama.context_length")
+func modelContextLength(show *api.ShowResponse) int {
+	for k, v := range show.ModelInfo {
+		if strings.HasSuffix(k, ".context_length") {
+			if f, ok := v.(float64); ok {
+				return int(f)
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"vessel-backend/internal/models"
+)
+
+// CreateProjectRequest is the request body for creating a project
+type CreateProjectRequest struct {
+	Name           string  `json:"name"`
+	Description    string  `json:"description"`
+	Instructions   string  `json:"instructions"`
+	Color          string  `json:"color"`
+	DefaultAgentID *string `json:"default_agent_id,omitempty"`
+}
+
+// UpdateProjectRequest is the request body for updating a project
+type UpdateProjectRequest struct {
+	Name         *string `json:"name,omitempty"`
+	Description  *string `json:"description,omitempty"`
+	Instructions *string `json:"instructions,omitempty"`
+	Color        *string `json:"color,omitempty"`
+	// DefaultAgentID sets the project's default agent; an empty string clears it
+	DefaultAgentID *string `json:"default_agent_id,omitempty"`
+}
+
+// CreateProjectLinkRequest is the request body for attaching a link to a project
+type CreateProjectLinkRequest struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// ListProjectsHandler returns all projects with their chat counts
+func ListProjectsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		projects, err := models.ListProjects(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"projects": projects})
+	}
+}
+
+// GetProjectHandler returns a single project with its links
+func GetProjectHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		project, err := models.GetProject(db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if project == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+			return
+		}
+		c.JSON(http.StatusOK, project)
+	}
+}
+
+// CreateProjectHandler creates a project
+func CreateProjectHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateProjectRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			respondValidationError(c, []FieldError{{Field: "name", Message: "name is required"}})
+			return
+		}
+		if req.DefaultAgentID != nil && *req.DefaultAgentID == "" {
+			req.DefaultAgentID = nil
+		}
+
+		project := &models.Project{
+			Name:           req.Name,
+			Description:    req.Description,
+			Instructions:   req.Instructions,
+			Color:          req.Color,
+			DefaultAgentID: req.DefaultAgentID,
+		}
+		if err := models.CreateProject(db, project); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, project)
+	}
+}
+
+// UpdateProjectHandler updates the fields present in the request
+func UpdateProjectHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		project, err := models.GetProject(db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if project == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+			return
+		}
+
+		var req UpdateProjectRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		if req.Name != nil {
+			name := strings.TrimSpace(*req.Name)
+			if name == "" {
+				respondValidationError(c, []FieldError{{Field: "name", Message: "name must not be empty"}})
+				return
+			}
+			project.Name = name
+		}
+		if req.Description != nil {
+			project.Description = *req.Description
+		}
+		if req.Instructions != nil {
+			project.Instructions = *req.Instructions
+		}
+		if req.Color != nil {
+			project.Color = *req.Color
+		}
+		if req.DefaultAgentID != nil {
+			if *req.DefaultAgentID == "" {
+				project.DefaultAgentID = nil
+			} else {
+				project.DefaultAgentID = req.DefaultAgentID
+			}
+		}
+
+		if err := models.UpdateProject(db, project); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, project)
+	}
+}
+
+// DeleteProjectHandler deletes a project; its chats become unfiled
+func DeleteProjectHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := models.DeleteProject(db, c.Param("id")); err != nil {
+			if err.Error() == "project not found" {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "project deleted"})
+	}
+}
+
+// CreateProjectLinkHandler attaches a knowledge link to a project
+func CreateProjectLinkHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		project, err := models.GetProject(db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if project == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+			return
+		}
+
+		var req CreateProjectLinkRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		req.URL = strings.TrimSpace(req.URL)
+		if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			respondValidationError(c, []FieldError{{Field: "url", Message: "url must be an absolute http(s) URL"}})
+			return
+		}
+
+		link := &models.ProjectLink{
+			ProjectID:   project.ID,
+			URL:         req.URL,
+			Title:       strings.TrimSpace(req.Title),
+			Description: req.Description,
+		}
+		if link.Title == "" {
+			link.Title = req.URL
+		}
+		if err := models.CreateProjectLink(db, link); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, link)
+	}
+}
+
+// DeleteProjectLinkHandler removes a link from a project
+func DeleteProjectLinkHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := models.DeleteProjectLink(db, c.Param("id"), c.Param("linkId")); err != nil {
+			if err.Error() == "project link not found" {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "project link deleted"})
+	}
+}
+
+// resolveProjectID checks that a chat's requested project exists. An empty
+// ID means no project and yields nil.
+func resolveProjectID(db *sql.DB, id string) (*string, []FieldError, error) {
+	if id == "" {
+		return nil, nil, nil
+	}
+	project, err := models.GetProject(db, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if project == nil {
+		return nil, []FieldError{{Field: "project_id", Message: "project not found"}}, nil
+	}
+	return &project.ID, nil, nil
+}
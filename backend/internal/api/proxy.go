@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"vessel-backend/internal/models"
 )
 
 // URLFetchRequest represents a request to fetch a URL
@@ -18,7 +20,7 @@ type URLFetchRequest struct {
 // URLFetchProxyHandler returns a handler that fetches URLs for the frontend
 // This bypasses CORS restrictions for the fetch_url tool
 // Uses curl/wget when available for better compatibility, falls back to native Go
-func URLFetchProxyHandler() gin.HandlerFunc {
+func URLFetchProxyHandler(bandwidth *bandwidthMeter) gin.HandlerFunc {
 	fetcher := GetFetcher()
 
 	return func(c *gin.Context) {
@@ -62,6 +64,7 @@ func URLFetchProxyHandler() gin.HandlerFunc {
 			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to fetch URL: " + err.Error()})
 			return
 		}
+		bandwidth.record(models.BandwidthSourceWebFetch, fetchedBytes(result))
 
 		// Check status
 		if result.StatusCode >= 400 {
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+)
+
+// maxGroupPullConcurrency caps simultaneous pulls within one group
+const maxGroupPullConcurrency = 4
+
+// GroupPullRequest is the request body for pulling several models together
+type GroupPullRequest struct {
+	Models []string `json:"models"`
+	// MaxConcurrent limits simultaneous pulls (default 2)
+	MaxConcurrent int  `json:"max_concurrent,omitempty"`
+	Insecure      bool `json:"insecure,omitempty"`
+}
+
+// GroupPullEvent is one line of the combined NDJSON progress stream.
+// Type is "progress", "model_done", "done", or "error".
+type GroupPullEvent struct {
+	Type      string `json:"type"`
+	Model     string `json:"model,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	// GroupCompleted and GroupTotal sum the known layer sizes of every model
+	GroupCompleted int64    `json:"group_completed"`
+	GroupTotal     int64    `json:"group_total"`
+	Error          string   `json:"error,omitempty"`
+	RolledBack     []string `json:"rolled_back,omitempty"`
+}
+
+// groupPullProgress aggregates layer progress across all pulls in a group
+type groupPullProgress struct {
+	mu     sync.Mutex
+	layers map[string]map[string][2]int64 // model -> digest -> {completed, total}
+}
+
+// update records a progress response and returns the model and group totals
+func (p *groupPullProgress) update(model string, resp api.ProgressResponse) (completed, total, groupCompleted, groupTotal int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if resp.Digest != "" {
+		if p.layers[model] == nil {
+			p.layers[model] = make(map[string][2]int64)
+		}
+		p.layers[model][resp.Digest] = [2]int64{resp.Completed, resp.Total}
+	}
+
+	for m, layers := range p.layers {
+		for _, l := range layers {
+			groupCompleted += l[0]
+			groupTotal += l[1]
+			if m == model {
+				completed += l[0]
+				total += l[1]
+			}
+		}
+	}
+	return completed, total, groupCompleted, groupTotal
+}
+
+// GroupPullHandler pulls several models as one unit: progress is combined
+// into a single stream, pulls share a concurrency limit, and if any pull
+// fails (or the client disconnects) the rest are cancelled and models newly
+// installed by the group are removed again
+func (s *OllamaService) GroupPullHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req GroupPullRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+
+		if fieldErrs := validateGroupPullRequest(&req); len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+
+		// Remember what was installed beforehand so rollback never removes
+		// models the user already had
+		installed := make(map[string]bool)
+		if list, err := s.client.List(c.Request.Context()); err == nil {
+			for _, m := range list.Models {
+				installed[normalizeModelName(m.Name)] = true
+			}
+		}
+
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+
+		flusher, ok := c.Writer.(http.Flusher)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "streaming not supported"})
+			return
+		}
+
+		var writeMu sync.Mutex
+		emit := func(ev GroupPullEvent) {
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return
+			}
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			c.Writer.Write(append(data, '\n'))
+			flusher.Flush()
+		}
+
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+
+		progress := &groupPullProgress{layers: make(map[string]map[string][2]int64)}
+		sem := make(chan struct{}, req.MaxConcurrent)
+
+		var (
+			wg        sync.WaitGroup
+			failOnce  sync.Once
+			failModel string
+			failErr   error
+			doneMu    sync.Mutex
+			completed []string
+		)
+
+		for _, model := range req.Models {
+			wg.Add(1)
+			go func(model string) {
+				defer wg.Done()
+
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				defer func() { <-sem }()
+
+				pullReq := &api.PullRequest{Model: model, Insecure: req.Insecure}
+				err := s.pull(ctx, pullReq, func(resp api.ProgressResponse) error {
+					done, total, groupDone, groupTotal := progress.update(model, resp)
+					emit(GroupPullEvent{
+						Type:           "progress",
+						Model:          model,
+						Status:         resp.Status,
+						Completed:      done,
+						Total:          total,
+						GroupCompleted: groupDone,
+						GroupTotal:     groupTotal,
+					})
+					return nil
+				})
+				if err != nil {
+					failOnce.Do(func() {
+						failModel, failErr = model, err
+						cancel()
+					})
+					return
+				}
+
+				doneMu.Lock()
+				completed = append(completed, model)
+				doneMu.Unlock()
+				_, _, groupDone, groupTotal := progress.update(model, api.ProgressResponse{})
+				emit(GroupPullEvent{Type: "model_done", Model: model, GroupCompleted: groupDone, GroupTotal: groupTotal})
+			}(model)
+		}
+		wg.Wait()
+
+		if failErr == nil && c.Request.Context().Err() != nil {
+			failErr = c.Request.Context().Err()
+		}
+
+		if failErr == nil {
+			_, _, groupDone, groupTotal := progress.update("", api.ProgressResponse{})
+			emit(GroupPullEvent{Type: "done", GroupCompleted: groupDone, GroupTotal: groupTotal})
+			return
+		}
+
+		// All or nothing: remove models this group installed
+		rollbackCtx := context.WithoutCancel(c.Request.Context())
+		var rolledBack []string
+		for _, model := range completed {
+			if installed[normalizeModelName(model)] {
+				continue
+			}
+			if err := s.client.Delete(rollbackCtx, &api.DeleteRequest{Model: model}); err == nil {
+				rolledBack = append(rolledBack, model)
+			}
+		}
+
+		emit(GroupPullEvent{
+			Type:       "error",
+			Model:      failModel,
+			Error:      failErr.Error(),
+			RolledBack: rolledBack,
+		})
+	}
+}
+
+// validateGroupPullRequest checks a group pull request and applies defaults
+func validateGroupPullRequest(req *GroupPullRequest) []FieldError {
+	var errs []FieldError
+
+	if len(req.Models) == 0 {
+		errs = append(errs, FieldError{Field: "models", Message: "at least one model is required"})
+	}
+
+	seen := make(map[string]bool)
+	for i, model := range req.Models {
+		field := fmt.Sprintf("models[%d]", i)
+		if strings.TrimSpace(model) == "" {
+			errs = append(errs, FieldError{Field: field, Message: "model name must not be empty"})
+			continue
+		}
+		if seen[normalizeModelName(model)] {
+			errs = append(errs, FieldError{Field: field, Message: "duplicate model: " + model})
+		}
+		seen[normalizeModelName(model)] = true
+	}
+
+	switch {
+	case req.MaxConcurrent == 0:
+		req.MaxConcurrent = 2
+	case req.MaxConcurrent < 0 || req.MaxConcurrent > maxGroupPullConcurrency:
+		errs = append(errs, FieldError{
+			Field:   "max_concurrent",
+			Message: fmt.Sprintf("must be between 1 and %d", maxGroupPullConcurrency),
+		})
+	}
+
+	return errs
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ollama/ollama/api"
+)
+
+// pullSubscriberBuffer is how many progress updates a slow subscriber may
+// fall behind before updates are skipped for it
+const pullSubscriberBuffer = 64
+
+// pullRegistry tracks the pulls in progress, so a model is only ever pulled
+// once at a time: Ollama writes every pull of a model to the same blobs, and
+// a second concurrent pull of it would compete with the first.
+type pullRegistry struct {
+	mu    sync.Mutex
+	pulls map[string]*sharedPull
+}
+
+func newPullRegistry() *pullRegistry {
+	return &pullRegistry{pulls: make(map[string]*sharedPull)}
+}
+
+// sharedPull is a pull of one model that every request for the model
+// follows. It is cancelled when the last of them goes away.
+type sharedPull struct {
+	key    string
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+
+	mu          sync.Mutex
+	subscribers map[chan api.ProgressResponse]struct{}
+	// layers holds the latest update per layer, replayed to subscribers
+	// that join late so their totals start out right
+	layers []api.ProgressResponse
+	// final is the last update, which subscribers that skipped it get once
+	// the pull is done
+	final *api.ProgressResponse
+}
+
+// pull pulls a model, passing its progress to fn. When the model is already
+// being pulled, the request follows that pull instead of starting another.
+// Bytes downloaded are counted once per pull. Pulls reach the registry, so
+// they fail with ErrOffline in offline mode, including queued bulk jobs.
+func (s *OllamaService) pull(ctx context.Context, req *api.PullRequest, fn func(api.ProgressResponse) error) error {
+	if err := checkOnline(); err != nil {
+		return err
+	}
+	p, ch := s.pulls.subscribe(s, req)
+	var last *api.ProgressResponse
+	for {
+		select {
+		case resp := <-ch:
+			last = &resp
+			if err := fn(resp); err != nil {
+				s.pulls.unsubscribe(p, ch)
+				return err
+			}
+		case <-ctx.Done():
+			s.pulls.unsubscribe(p, ch)
+			return ctx.Err()
+		case <-p.done:
+			// Pass on what was sent before the pull ended
+		drain:
+			for {
+				select {
+				case resp := <-ch:
+					last = &resp
+					if err := fn(resp); err != nil {
+						return err
+					}
+				default:
+					break drain
+				}
+			}
+			if p.err == nil && p.final != nil && (last == nil || *last != *p.final) {
+				if err := fn(*p.final); err != nil {
+					return err
+				}
+			}
+			return p.err
+		}
+	}
+}
+
+// subscribe follows the pull of a model, starting it if none is running
+func (r *pullRegistry) subscribe(s *OllamaService, req *api.PullRequest) (*sharedPull, chan api.ProgressResponse) {
+	key := normalizeModelName(req.Model)
+	ch := make(chan api.ProgressResponse, pullSubscriberBuffer)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.pulls[key]
+	if p == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		p = &sharedPull{
+			key:         key,
+			cancel:      cancel,
+			done:        make(chan struct{}),
+			subscribers: make(map[chan api.ProgressResponse]struct{}),
+		}
+		r.pulls[key] = p
+		go r.run(ctx, s, p, req)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, resp := range p.layers {
+		select {
+		case ch <- resp:
+		default:
+		}
+	}
+	p.subscribers[ch] = struct{}{}
+	return p, ch
+}
+
+// unsubscribe stops following a pull, cancelling it when nobody else is
+func (r *pullRegistry) unsubscribe(p *sharedPull, ch chan api.ProgressResponse) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.subscribers, ch)
+	if len(p.subscribers) == 0 {
+		// A new request for the model starts a new pull rather than joining
+		// this cancelled one
+		if r.pulls[p.key] == p {
+			delete(r.pulls, p.key)
+		}
+		p.cancel()
+	}
+}
+
+// run pulls the model and broadcasts its progress
+func (r *pullRegistry) run(ctx context.Context, s *OllamaService, p *sharedPull, req *api.PullRequest) {
+	defer p.cancel()
+	s.events.publish(BackendEvent{Type: BackendEventPullStarted, Model: req.Model})
+	counter := s.bandwidth.pullCounter()
+	err := s.client.Pull(ctx, req, func(resp api.ProgressResponse) error {
+		p.broadcast(resp)
+		return counter.observe(resp)
+	})
+	counter.flush()
+
+	r.mu.Lock()
+	if r.pulls[p.key] == p {
+		delete(r.pulls, p.key)
+	}
+	r.mu.Unlock()
+
+	if err == nil {
+		s.forgetModelLicense(req.Model)
+		s.events.publish(BackendEvent{Type: BackendEventPullCompleted, Model: req.Model})
+	} else {
+		s.events.publish(BackendEvent{Type: BackendEventPullFailed, Model: req.Model, Error: err.Error()})
+	}
+	p.err = err
+	close(p.done)
+}
+
+// broadcast passes an update to every subscriber. Subscribers that have
+// fallen behind skip it rather than holding up the pull.
+func (p *sharedPull) broadcast(resp api.ProgressResponse) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.final = &resp
+	replaced := false
+	if resp.Digest != "" {
+		for i := range p.layers {
+			if p.layers[i].Digest == resp.Digest {
+				p.layers[i] = resp
+				replaced = true
+				break
+			}
+		}
+	}
+	if !replaced && resp.Digest != "" {
+		p.layers = append(p.layers, resp)
+	}
+
+	for ch := range p.subscribers {
+		select {
+		case ch <- resp:
+		default:
+		}
+	}
+}
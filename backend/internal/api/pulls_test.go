@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestConcurrentPullsShareOneUpstreamPull(t *testing.T) {
+	var upstreamPulls atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/pull" {
+			http.NotFound(w, r)
+			return
+		}
+		upstreamPulls.Add(1)
+		<-release
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		for _, resp := range []api.ProgressResponse{
+			{Status: "pulling manifest"},
+			{Status: "pulling abc", Digest: "sha256:abc", Total: 100, Completed: 50},
+			{Status: "pulling abc", Digest: "sha256:abc", Total: 100, Completed: 100},
+			{Status: "success"},
+		} {
+			enc.Encode(resp)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	s, err := NewOllamaService(server.URL, nil)
+	if err != nil {
+		t.Fatalf("NewOllamaService: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const callers = 2
+	var wg sync.WaitGroup
+	progress := make([][]api.ProgressResponse, callers)
+	errs := make([]error, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = s.pull(ctx, &api.PullRequest{Model: "llama3"}, func(resp api.ProgressResponse) error {
+				progress[i] = append(progress[i], resp)
+				return nil
+			})
+		}()
+	}
+
+	// Hold the upstream pull until both callers follow it
+	deadline := time.Now().Add(5 * time.Second)
+	for subscriberCount(s.pulls, "llama3") < callers {
+		if time.Now().After(deadline) {
+			t.Fatal("callers never joined the same pull")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if n := upstreamPulls.Load(); n != 1 {
+		t.Errorf("upstream /api/pull requests = %d, want 1", n)
+	}
+	for i := range callers {
+		if errs[i] != nil {
+			t.Errorf("caller %d: pull failed: %v", i, errs[i])
+			continue
+		}
+		got := progress[i]
+		if len(got) == 0 || got[len(got)-1].Status != "success" {
+			t.Errorf("caller %d: progress = %+v, want it to end with success", i, got)
+		}
+		sawLayer := false
+		for _, resp := range got {
+			if resp.Digest == "sha256:abc" {
+				sawLayer = true
+			}
+		}
+		if !sawLayer {
+			t.Errorf("caller %d: no layer progress in %+v", i, got)
+		}
+	}
+}
+
+// subscriberCount returns how many requests follow the pull of a model
+func subscriberCount(r *pullRegistry, model string) int {
+	r.mu.Lock()
+	p := r.pulls[normalizeModelName(model)]
+	r.mu.Unlock()
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.subscribers)
+}
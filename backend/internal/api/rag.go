@@ -0,0 +1,543 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/models"
+)
+
+const (
+	// defaultEmbeddingModel matches the frontend's preferred embedding model
+	defaultEmbeddingModel = "embeddinggemma:latest"
+	// ragChunkSize is the target chunk size in characters (~128 tokens)
+	ragChunkSize = 512
+	// ragChunkOverlap is how many characters consecutive chunks share
+	ragChunkOverlap = 50
+	// ragMinChunkSize drops fragments too small to be useful
+	ragMinChunkSize = 50
+	// ragEmbedBatchSize is how many chunks are embedded per Ollama request
+	ragEmbedBatchSize = 32
+	// ragMaxDocumentSize caps the text of a single ingested document (10MB)
+	ragMaxDocumentSize = 10 * 1024 * 1024
+	// defaultRAGTopK and maxRAGTopK bound how many chunks a query returns
+	defaultRAGTopK = 5
+	maxRAGTopK     = 50
+)
+
+// RAGCollectionRequest is the request body for creating or replacing a collection
+type RAGCollectionRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// EmbeddingModel defaults to defaultEmbeddingModel. It can only change
+	// while the collection is empty, since stored embeddings depend on it.
+	EmbeddingModel string `json:"embedding_model"`
+	// Chunking applies to documents ingested after it changes. Omitted, it
+	// keeps the current setting; new collections chunk by paragraph.
+	Chunking   *models.RAGChunking `json:"chunking,omitempty"`
+	ProjectIDs []string            `json:"project_ids"`
+	AgentIDs   []string            `json:"agent_ids"`
+}
+
+// RAGQueryRequest is the request body for searching collections.
+// CollectionIDs searches those collections directly; otherwise the
+// collections attached to the project (taken from ChatID when ProjectID is
+// empty) and agent are searched.
+type RAGQueryRequest struct {
+	Query         string   `json:"query"`
+	TopK          int      `json:"top_k"`
+	CollectionIDs []string `json:"collection_ids,omitempty"`
+	ChatID        string   `json:"chat_id,omitempty"`
+	ProjectID     string   `json:"project_id,omitempty"`
+	AgentID       string   `json:"agent_id,omitempty"`
+	// VectorWeight and KeywordWeight scale the embedding and keyword rankings
+	// when they are fused (default 1 each); 0 turns a ranking off
+	VectorWeight  *float64 `json:"vector_weight,omitempty"`
+	KeywordWeight *float64 `json:"keyword_weight,omitempty"`
+}
+
+// RAGQueryResult is a chunk matching a query. Score is the fused rank score;
+// the per-ranking scores are set when the chunk appeared in that ranking.
+type RAGQueryResult struct {
+	models.RAGChunk
+	Score        float64  `json:"score"`
+	VectorScore  *float64 `json:"vector_score,omitempty"`
+	KeywordScore *float64 `json:"keyword_score,omitempty"`
+}
+
+// RAGQueryResponse lists the best matching chunks across the searched collections
+type RAGQueryResponse struct {
+	Collections []string         `json:"collections"`
+	Results     []RAGQueryResult `json:"results"`
+}
+
+// ListRAGCollectionsHandler returns collections, optionally only those
+// attached to ?project_id= or ?agent_id=
+func ListRAGCollectionsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		targetType, targetID := "", ""
+		if id := c.Query("project_id"); id != "" {
+			targetType, targetID = models.RAGTargetProject, id
+		} else if id := c.Query("agent_id"); id != "" {
+			targetType, targetID = models.RAGTargetAgent, id
+		}
+
+		collections, err := models.ListRAGCollections(db, targetType, targetID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"collections": collections})
+	}
+}
+
+// GetRAGCollectionHandler returns a collection with its documents
+func GetRAGCollectionHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collection, err := models.GetRAGCollection(db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if collection == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "collection not found"})
+			return
+		}
+
+		documents, err := models.ListRAGDocuments(db, collection.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"collection": collection, "documents": documents})
+	}
+}
+
+// CreateRAGCollectionHandler creates a collection
+func CreateRAGCollectionHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RAGCollectionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+		if fieldErrs := validateRAGCollection(db, &req); len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+
+		collection := &models.RAGCollection{
+			Name:           req.Name,
+			Description:    req.Description,
+			EmbeddingModel: req.EmbeddingModel,
+			Chunking:       models.RAGChunking{Strategy: models.RAGChunkParagraph},
+			ProjectIDs:     req.ProjectIDs,
+			AgentIDs:       req.AgentIDs,
+		}
+		if req.Chunking != nil {
+			collection.Chunking = *req.Chunking
+		}
+		collection.Chunking = normalizeRAGChunking(collection.Chunking)
+		if err := models.CreateRAGCollection(db, collection); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, collection)
+	}
+}
+
+// UpdateRAGCollectionHandler replaces a collection's settings and links
+func UpdateRAGCollectionHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collection, err := models.GetRAGCollection(db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if collection == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "collection not found"})
+			return
+		}
+
+		var req RAGCollectionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+		if fieldErrs := validateRAGCollection(db, &req); len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+		if req.EmbeddingModel != collection.EmbeddingModel && collection.ChunkCount > 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "embedding model can't change while the collection has documents; delete them first",
+			})
+			return
+		}
+
+		collection.Name = req.Name
+		collection.Description = req.Description
+		collection.EmbeddingModel = req.EmbeddingModel
+		if req.Chunking != nil {
+			collection.Chunking = normalizeRAGChunking(*req.Chunking)
+		}
+		collection.ProjectIDs = req.ProjectIDs
+		collection.AgentIDs = req.AgentIDs
+		if err := models.UpdateRAGCollection(db, collection); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, collection)
+	}
+}
+
+// DeleteRAGCollectionHandler deletes a collection with its documents
+func DeleteRAGCollectionHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := models.DeleteRAGCollection(db, c.Param("id")); err != nil {
+			if err.Error() == "collection not found" {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "collection deleted"})
+	}
+}
+
+// DeleteDocumentHandler removes a document from a collection
+func DeleteDocumentHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := models.DeleteRAGDocument(db, c.Param("id"), c.Param("docId")); err != nil {
+			if err.Error() == "document not found" {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "document deleted"})
+	}
+}
+
+// RAGQueryHandler returns the chunks most similar to a query from the
+// collections in scope
+func (s *OllamaService) RAGQueryHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RAGQueryRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+
+		var fieldErrs []FieldError
+		if strings.TrimSpace(req.Query) == "" {
+			fieldErrs = append(fieldErrs, FieldError{Field: "query", Message: "query is required"})
+		}
+		if req.TopK < 0 || req.TopK > maxRAGTopK {
+			fieldErrs = append(fieldErrs, FieldError{
+				Field:   "top_k",
+				Message: fmt.Sprintf("top_k must be between 1 and %d", maxRAGTopK),
+			})
+		}
+		weights := ragWeights{Vector: 1, Keyword: 1}
+		if req.VectorWeight != nil {
+			weights.Vector = *req.VectorWeight
+		}
+		if req.KeywordWeight != nil {
+			weights.Keyword = *req.KeywordWeight
+		}
+		switch {
+		case weights.Vector < 0 || weights.Keyword < 0:
+			fieldErrs = append(fieldErrs, FieldError{Field: "vector_weight", Message: "weights must not be negative"})
+		case weights.Vector == 0 && weights.Keyword == 0:
+			fieldErrs = append(fieldErrs, FieldError{Field: "vector_weight", Message: "at least one weight must be positive"})
+		}
+		if len(req.CollectionIDs) == 0 && req.ChatID == "" && req.ProjectID == "" && req.AgentID == "" {
+			fieldErrs = append(fieldErrs, FieldError{
+				Field:   "collection_ids",
+				Message: "collection_ids, chat_id, project_id or agent_id is required",
+			})
+		}
+		if len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+		if req.TopK == 0 {
+			req.TopK = defaultRAGTopK
+		}
+
+		collections, err := s.ragScope(&req)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp, err := s.searchCollections(c.Request.Context(), collections, req.Query, req.TopK, weights)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "search failed: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// ragScope resolves the collections a query searches
+func (s *OllamaService) ragScope(req *RAGQueryRequest) ([]*models.RAGCollection, error) {
+	ids := req.CollectionIDs
+	if len(ids) == 0 {
+		projectID := req.ProjectID
+		if projectID == "" && req.ChatID != "" {
+			chat, err := models.GetChatMetadata(s.db, req.ChatID)
+			if err != nil {
+				return nil, err
+			}
+			if chat != nil && chat.ProjectID != nil {
+				projectID = *chat.ProjectID
+			}
+		}
+
+		var err error
+		ids, err = models.LinkedRAGCollectionIDs(s.db, projectID, req.AgentID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	collections := make([]*models.RAGCollection, 0, len(ids))
+	for _, id := range ids {
+		collection, err := models.GetRAGCollection(s.db, id)
+		if err != nil {
+			return nil, err
+		}
+		if collection != nil {
+			collections = append(collections, collection)
+		}
+	}
+	return collections, nil
+}
+
+// vectorSearch embeds the query once per embedding model in use and returns
+// the topK chunks in the collections by cosine similarity
+func (s *OllamaService) vectorSearch(ctx context.Context, collections []*models.RAGCollection, query string, topK int) ([]RAGQueryResult, error) {
+	var results []RAGQueryResult
+	queryEmbeddings := make(map[string][]float32)
+
+	for _, collection := range collections {
+		queryEmbedding, ok := queryEmbeddings[collection.EmbeddingModel]
+		if !ok {
+			embedded, err := s.embed(ctx, collection.EmbeddingModel, []string{query})
+			if err != nil {
+				return nil, err
+			}
+			queryEmbedding = embedded[0]
+			queryEmbeddings[collection.EmbeddingModel] = queryEmbedding
+		}
+
+		err := models.ForEachRAGChunk(s.db, collection.ID, func(chunk *models.RAGChunk) {
+			score := cosineSimilarity(queryEmbedding, chunk.Embedding)
+			results = insertTopK(results, RAGQueryResult{RAGChunk: *chunk, Score: score}, topK)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// insertTopK adds a result to a slice kept sorted by descending score and
+// capped at k entries
+func insertTopK(results []RAGQueryResult, r RAGQueryResult, k int) []RAGQueryResult {
+	if len(results) == k && r.Score <= results[k-1].Score {
+		return results
+	}
+	i := sort.Search(len(results), func(i int) bool { return results[i].Score < r.Score })
+	if len(results) < k {
+		results = append(results, RAGQueryResult{})
+	}
+	copy(results[i+1:], results[i:])
+	results[i] = r
+	return results
+}
+
+// embedChunks embeds chunk texts in batches
+func (s *OllamaService) embedChunks(ctx context.Context, model string, texts []string) ([]models.RAGChunk, error) {
+	chunks := make([]models.RAGChunk, 0, len(texts))
+	for start := 0; start < len(texts); start += ragEmbedBatchSize {
+		end := min(start+ragEmbedBatchSize, len(texts))
+		embeddings, err := s.embed(ctx, model, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for i, embedding := range embeddings {
+			chunks = append(chunks, models.RAGChunk{Seq: start + i, Content: texts[start+i], Embedding: embedding})
+		}
+	}
+	return chunks, nil
+}
+
+// embed returns one embedding per input
+func (s *OllamaService) embed(ctx context.Context, model string, input []string) ([][]float32, error) {
+	resp, err := s.client.Embed(ctx, &api.EmbedRequest{Model: model, Input: input})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Embeddings) != len(input) {
+		return nil, fmt.Errorf("model %q returned %d embeddings for %d inputs", model, len(resp.Embeddings), len(input))
+	}
+	return resp.Embeddings, nil
+}
+
+// cosineSimilarity returns the cosine of the angle between two vectors, or 0
+// if their dimensions differ
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// chunkText splits text into overlapping chunks of about ragChunkSize
+// characters, preferring paragraph and then sentence boundaries. It mirrors
+// the frontend's chunker so client and server retrieval behave alike.
+func chunkText(text string) []string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) <= ragChunkSize {
+		return []string{string(runes)}
+	}
+
+	var chunks []string
+	for start := 0; start < len(runes); {
+		end := min(start+ragChunkSize, len(runes))
+		if end < len(runes) {
+			end = chunkBreakPoint(runes, start, end)
+		}
+		if chunk := strings.TrimSpace(string(runes[start:end])); len([]rune(chunk)) >= ragMinChunkSize {
+			chunks = append(chunks, chunk)
+		}
+		if end >= len(runes) {
+			break
+		}
+		start = max(end-ragChunkOverlap, start+1)
+	}
+	return chunks
+}
+
+// chunkBreakPoint moves a chunk's end back to the last paragraph break, or
+// else sentence end or whitespace, in the second half of the chunk
+func chunkBreakPoint(runes []rune, start, end int) int {
+	half := start + (end-start)/2
+	for i := end - 1; i > half; i-- {
+		if runes[i] == '\n' && runes[i-1] == '\n' {
+			return i + 1
+		}
+	}
+	for i := end - 1; i > half; i-- {
+		if (runes[i-1] == '.' || runes[i-1] == '!' || runes[i-1] == '?') && unicode.IsSpace(runes[i]) {
+			return i
+		}
+	}
+	for i := end - 1; i > half; i-- {
+		if unicode.IsSpace(runes[i]) {
+			return i
+		}
+	}
+	return end
+}
+
+// validateRAGCollection checks a collection definition and fills in defaults
+func validateRAGCollection(db *sql.DB, req *RAGCollectionRequest) []FieldError {
+	var errs []FieldError
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		errs = append(errs, FieldError{Field: "name", Message: "name is required"})
+	}
+	req.EmbeddingModel = strings.TrimSpace(req.EmbeddingModel)
+	if req.EmbeddingModel == "" {
+		req.EmbeddingModel = defaultEmbeddingModel
+	}
+	if req.ProjectIDs == nil {
+		req.ProjectIDs = []string{}
+	}
+	if req.AgentIDs == nil {
+		req.AgentIDs = []string{}
+	}
+	if req.Chunking != nil {
+		errs = append(errs, validateRAGChunking(req.Chunking)...)
+	}
+
+	for i, id := range req.ProjectIDs {
+		project, err := models.GetProject(db, id)
+		if err != nil || project == nil {
+			errs = append(errs, FieldError{Field: fmt.Sprintf("project_ids[%d]", i), Message: "project not found"})
+		}
+	}
+	for i, id := range req.AgentIDs {
+		if strings.TrimSpace(id) == "" {
+			errs = append(errs, FieldError{Field: fmt.Sprintf("agent_ids[%d]", i), Message: "agent ID must not be empty"})
+		}
+	}
+	return errs
+}
+
+// validateRAGChunking checks a chunking configuration
+func validateRAGChunking(chunking *models.RAGChunking) []FieldError {
+	var errs []FieldError
+
+	chunking.Strategy = strings.TrimSpace(chunking.Strategy)
+	if chunking.Strategy == "" {
+		chunking.Strategy = models.RAGChunkParagraph
+	}
+	if !slices.Contains(ragChunkStrategies, chunking.Strategy) {
+		errs = append(errs, FieldError{
+			Field:   "chunking.strategy",
+			Message: "strategy must be one of: " + strings.Join(ragChunkStrategies, ", "),
+		})
+	}
+	if chunking.Strategy == models.RAGChunkCharacters || chunking.Size == 0 {
+		return errs
+	}
+	if chunking.Size < ragMinChunkTokens || chunking.Size > ragMaxChunkTokens {
+		errs = append(errs, FieldError{
+			Field:   "chunking.size",
+			Message: fmt.Sprintf("size must be between %d and %d tokens", ragMinChunkTokens, ragMaxChunkTokens),
+		})
+	}
+	if chunking.Overlap < 0 || chunking.Overlap > chunking.Size/2 {
+		errs = append(errs, FieldError{Field: "chunking.overlap", Message: "overlap must be between 0 and half the size"})
+	}
+	return errs
+}
+
+// normalizeRAGChunking fills in the default size and overlap of token-based
+// strategies. The character strategy has fixed sizes, so it stores none.
+func normalizeRAGChunking(chunking models.RAGChunking) models.RAGChunking {
+	if chunking.Strategy == models.RAGChunkCharacters {
+		return models.RAGChunking{Strategy: models.RAGChunkCharacters}
+	}
+	if chunking.Size == 0 {
+		chunking.Size, chunking.Overlap = ragDefaultChunkTokens, ragDefaultChunkOverlap
+	}
+	return chunking
+}
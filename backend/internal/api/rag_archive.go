@@ -0,0 +1,426 @@
+package api
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"vessel-backend/internal/models"
+)
+
+const (
+	// ragArchiveFormat identifies collection archives in their manifest
+	ragArchiveFormat = "vessel-rag-collection"
+	// ragArchiveVersion is the archive layout version written by exports
+	ragArchiveVersion = 1
+	// ragArchiveMaxSize caps the size of an imported archive (2GB)
+	ragArchiveMaxSize = 2 * 1024 * 1024 * 1024
+)
+
+// Files in a collection archive
+const (
+	archiveManifestFile  = "manifest.json"
+	archiveDocumentsFile = "documents.jsonl"
+	archiveChunksFile    = "chunks.jsonl"
+)
+
+// archiveNamePattern matches characters left out of archive file names
+var archiveNamePattern = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// RAGArchiveManifest describes a collection archive. The embedding model's
+// name, digest and dimensions identify the vector space the chunks were
+// embedded in.
+type RAGArchiveManifest struct {
+	Format               string             `json:"format"`
+	Version              int                `json:"version"`
+	ExportedAt           time.Time          `json:"exported_at"`
+	Name                 string             `json:"name"`
+	Description          string             `json:"description"`
+	Chunking             models.RAGChunking `json:"chunking"`
+	EmbeddingModel       string             `json:"embedding_model"`
+	EmbeddingModelDigest string             `json:"embedding_model_digest,omitempty"`
+	EmbeddingDimensions  int                `json:"embedding_dimensions"`
+	DocumentCount        int                `json:"document_count"`
+	ChunkCount           int                `json:"chunk_count"`
+}
+
+// ragArchiveChunk is a chunk as stored in an archive. The embedding holds
+// little-endian float32s, base64-encoded by encoding/json.
+type ragArchiveChunk struct {
+	DocumentID string `json:"document_id"`
+	Seq        int    `json:"seq"`
+	Content    string `json:"content"`
+	Embedding  []byte `json:"embedding"`
+}
+
+// ImportRAGCollectionResponse is the collection created by an import, with
+// any compatibility concerns that didn't stop it
+type ImportRAGCollectionResponse struct {
+	Collection *models.RAGCollection `json:"collection"`
+	Warnings   []string              `json:"warnings"`
+}
+
+// ExportRAGCollectionHandler downloads a collection as a zip archive holding
+// a manifest, its documents and its embedded chunks
+func (s *OllamaService) ExportRAGCollectionHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		password, ok := exportPassword(c)
+		if !ok {
+			return
+		}
+		collection, err := models.GetRAGCollection(s.db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if collection == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "collection not found"})
+			return
+		}
+		documents, err := models.ListRAGDocuments(s.db, collection.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		manifest := RAGArchiveManifest{
+			Format:               ragArchiveFormat,
+			Version:              ragArchiveVersion,
+			ExportedAt:           time.Now().UTC(),
+			Name:                 collection.Name,
+			Description:          collection.Description,
+			Chunking:             collection.Chunking,
+			EmbeddingModel:       collection.EmbeddingModel,
+			EmbeddingModelDigest: s.modelDigest(c.Request.Context(), collection.EmbeddingModel),
+			DocumentCount:        len(documents),
+		}
+
+		filename := strings.Trim(archiveNamePattern.ReplaceAllString(collection.Name, "-"), "-")
+		if filename == "" {
+			filename = "collection"
+		}
+		out, finish, err := startExport(c, filename+".zip", "application/zip", password)
+		if err != nil {
+			return
+		}
+
+		// The response has started, so failures past here can only cut the
+		// archive short, which makes it unreadable on import
+		archive := zip.NewWriter(out)
+		if err := writeArchiveDocuments(archive, documents); err != nil {
+			return
+		}
+		if err := s.writeArchiveChunks(archive, collection.ID, &manifest); err != nil {
+			return
+		}
+		w, err := archive.Create(archiveManifestFile)
+		if err != nil {
+			return
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(manifest); err != nil {
+			return
+		}
+		if err := archive.Close(); err != nil {
+			return
+		}
+		finish()
+	}
+}
+
+// ImportRAGCollectionHandler creates a collection from an uploaded archive
+// (multipart field "file", plus an optional "name"); password-protected
+// archives are decrypted with ExportPasswordHeader. The archive's embedding
+// dimensions are checked against the local embedding model; a different
+// model version or a missing model only adds a warning.
+func (s *OllamaService) ImportRAGCollectionHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, ragArchiveMaxSize+1024*1024)
+		reader, err := c.Request.MultipartReader()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expected a multipart/form-data upload"})
+			return
+		}
+
+		spool, err := os.CreateTemp("", "vessel-rag-import-*.zip")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		spool.Close()
+		defer os.Remove(spool.Name())
+
+		name := ""
+		var size int64
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				respondUploadError(c, err)
+				return
+			}
+			switch part.FormName() {
+			case "name":
+				value, err := io.ReadAll(io.LimitReader(part, 1024))
+				if err != nil {
+					respondUploadError(c, err)
+					return
+				}
+				name = strings.TrimSpace(string(value))
+			case "file":
+				if size, err = spoolFile(part, spool.Name(), ragArchiveMaxSize); err != nil {
+					respondUploadError(c, err)
+					return
+				}
+			}
+			part.Close()
+		}
+		if size == 0 {
+			respondValidationError(c, []FieldError{{Field: "file", Message: "file is required"}})
+			return
+		}
+
+		path, err := decryptUpload(c, spool.Name())
+		if err != nil {
+			return
+		}
+		if path != spool.Name() {
+			defer os.Remove(path)
+		}
+
+		archive, err := zip.OpenReader(path)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is not a zip archive"})
+			return
+		}
+		defer archive.Close()
+
+		manifest, documents, err := readArchiveIndex(&archive.Reader)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid collection archive: " + err.Error()})
+			return
+		}
+
+		warnings, err := s.checkArchiveModel(c.Request.Context(), manifest)
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		collection := &models.RAGCollection{
+			Name:           manifest.Name,
+			Description:    manifest.Description,
+			EmbeddingModel: manifest.EmbeddingModel,
+			Chunking:       manifest.Chunking,
+		}
+		if name != "" {
+			collection.Name = name
+		}
+		if fieldErrs := validateRAGChunking(&collection.Chunking); len(fieldErrs) > 0 {
+			collection.Chunking = models.RAGChunking{Strategy: models.RAGChunkParagraph}
+			warnings = append(warnings, "the archive's chunking settings aren't supported here; new documents use paragraph chunking")
+		}
+		collection.Chunking = normalizeRAGChunking(collection.Chunking)
+
+		chunks, err := openArchiveFile(&archive.Reader, archiveChunksFile)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid collection archive: " + err.Error()})
+			return
+		}
+		defer chunks.Close()
+
+		scanner := bufio.NewScanner(chunks)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		nextChunk := func() (*models.RAGChunk, error) {
+			if !scanner.Scan() {
+				return nil, scanner.Err()
+			}
+			var chunk ragArchiveChunk
+			if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+				return nil, fmt.Errorf("invalid chunk: %w", err)
+			}
+			embedding := models.DecodeEmbedding(chunk.Embedding)
+			if len(embedding) != manifest.EmbeddingDimensions || len(chunk.Embedding)%4 != 0 {
+				return nil, fmt.Errorf("chunk %d of document %q has %d dimensions, the manifest says %d",
+					chunk.Seq, chunk.DocumentID, len(embedding), manifest.EmbeddingDimensions)
+			}
+			return &models.RAGChunk{DocumentID: chunk.DocumentID, Seq: chunk.Seq, Content: chunk.Content, Embedding: embedding}, nil
+		}
+
+		if err := models.ImportRAGCollection(s.db, collection, documents, nextChunk); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "import failed: " + err.Error()})
+			return
+		}
+
+		// Reload for the document and chunk counts
+		if imported, err := models.GetRAGCollection(s.db, collection.ID); err == nil && imported != nil {
+			collection = imported
+		}
+		if collection.ChunkCount != manifest.ChunkCount {
+			warnings = append(warnings, fmt.Sprintf("the manifest lists %d chunks but %d were imported",
+				manifest.ChunkCount, collection.ChunkCount))
+		}
+		if warnings == nil {
+			warnings = []string{}
+		}
+		c.JSON(http.StatusCreated, ImportRAGCollectionResponse{Collection: collection, Warnings: warnings})
+	}
+}
+
+// writeArchiveDocuments writes a collection's documents as JSON lines
+func writeArchiveDocuments(archive *zip.Writer, documents []models.RAGDocument) error {
+	w, err := archive.Create(archiveDocumentsFile)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	for _, doc := range documents {
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeArchiveChunks streams a collection's chunks as JSON lines and records
+// their count and embedding dimensions in the manifest
+func (s *OllamaService) writeArchiveChunks(archive *zip.Writer, collectionID string, manifest *RAGArchiveManifest) error {
+	w, err := archive.Create(archiveChunksFile)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	var writeErr error
+	err = models.ForEachRAGChunk(s.db, collectionID, func(chunk *models.RAGChunk) {
+		if writeErr != nil {
+			return
+		}
+		if manifest.EmbeddingDimensions == 0 {
+			manifest.EmbeddingDimensions = len(chunk.Embedding)
+		}
+		writeErr = enc.Encode(ragArchiveChunk{
+			DocumentID: chunk.DocumentID,
+			Seq:        chunk.Seq,
+			Content:    chunk.Content,
+			Embedding:  models.EncodeEmbedding(chunk.Embedding),
+		})
+		manifest.ChunkCount++
+	})
+	if writeErr != nil {
+		return writeErr
+	}
+	return err
+}
+
+// readArchiveIndex reads and checks an archive's manifest and documents
+func readArchiveIndex(archive *zip.Reader) (*RAGArchiveManifest, []models.RAGDocument, error) {
+	f, err := openArchiveFile(archive, archiveManifestFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var manifest RAGArchiveManifest
+	if err := json.NewDecoder(f).Decode(&manifest); err != nil {
+		return nil, nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	switch {
+	case manifest.Format != ragArchiveFormat:
+		return nil, nil, fmt.Errorf("not a Vessel collection archive")
+	case manifest.Version > ragArchiveVersion:
+		return nil, nil, fmt.Errorf("archive version %d is newer than this server supports (%d)", manifest.Version, ragArchiveVersion)
+	case strings.TrimSpace(manifest.Name) == "" || strings.TrimSpace(manifest.EmbeddingModel) == "":
+		return nil, nil, fmt.Errorf("manifest must name the collection and its embedding model")
+	case manifest.ChunkCount > 0 && manifest.EmbeddingDimensions <= 0:
+		return nil, nil, fmt.Errorf("manifest must give the embedding dimensions")
+	}
+
+	docs, err := openArchiveFile(archive, archiveDocumentsFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer docs.Close()
+
+	documents := []models.RAGDocument{}
+	dec := json.NewDecoder(docs)
+	for {
+		var doc models.RAGDocument
+		if err := dec.Decode(&doc); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("invalid document: %w", err)
+		}
+		if doc.ID == "" {
+			return nil, nil, fmt.Errorf("document %q has no ID", doc.Title)
+		}
+		documents = append(documents, doc)
+	}
+	return &manifest, documents, nil
+}
+
+// openArchiveFile opens a file in an archive by name
+func openArchiveFile(archive *zip.Reader, name string) (io.ReadCloser, error) {
+	f, err := archive.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("missing %s", name)
+	}
+	return f, nil
+}
+
+// checkArchiveModel compares an archive's embedding model with the local
+// one. Different dimensions make the embeddings unusable and return an
+// error; a missing or different version of the model only warns.
+func (s *OllamaService) checkArchiveModel(ctx context.Context, manifest *RAGArchiveManifest) ([]string, error) {
+	var warnings []string
+	if manifest.ChunkCount == 0 {
+		return warnings, nil
+	}
+
+	probe, err := s.embed(ctx, manifest.EmbeddingModel, []string{"dimension check"})
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf(
+			"couldn't check embedding model %q (%v); pull it before querying this collection", manifest.EmbeddingModel, err))
+		return warnings, nil
+	}
+	if len(probe[0]) != manifest.EmbeddingDimensions {
+		return nil, fmt.Errorf("the archive's embeddings have %d dimensions but %q here produces %d; they can't be searched with it",
+			manifest.EmbeddingDimensions, manifest.EmbeddingModel, len(probe[0]))
+	}
+
+	if manifest.EmbeddingModelDigest != "" {
+		if digest := s.modelDigest(ctx, manifest.EmbeddingModel); digest != "" && digest != manifest.EmbeddingModelDigest {
+			warnings = append(warnings, fmt.Sprintf(
+				"the local %q is a different version than the one the archive was embedded with; re-ingest documents for the best results",
+				manifest.EmbeddingModel))
+		}
+	}
+	return warnings, nil
+}
+
+// modelDigest returns the digest of an installed model, or "" if it isn't
+// installed or Ollama can't be reached
+func (s *OllamaService) modelDigest(ctx context.Context, model string) string {
+	resp, err := s.client.List(ctx)
+	if err != nil {
+		return ""
+	}
+	for _, m := range resp.Models {
+		if sameModel(m.Name, model) {
+			return m.Digest
+		}
+	}
+	return ""
+}
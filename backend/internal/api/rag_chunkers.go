@@ -0,0 +1,286 @@
+package api
+
+import (
+	"regexp"
+	"strings"
+
+	"vessel-backend/internal/models"
+)
+
+const (
+	// ragDefaultChunkTokens is the chunk size of token-based strategies when
+	// a collection doesn't set one
+	ragDefaultChunkTokens = 256
+	// ragDefaultChunkOverlap is the overlap used with the default chunk size
+	ragDefaultChunkOverlap = 32
+	// ragMinChunkTokens and ragMaxChunkTokens bound configured chunk sizes;
+	// the maximum keeps chunks within embedding model context windows
+	ragMinChunkTokens = 32
+	ragMaxChunkTokens = 2048
+)
+
+// ragChunkStrategies lists the chunking strategies collections can use
+var ragChunkStrategies = []string{
+	models.RAGChunkParagraph,
+	models.RAGChunkFixed,
+	models.RAGChunkMarkdown,
+	models.RAGChunkCode,
+	models.RAGChunkCharacters,
+}
+
+// Patterns used to find the boundaries chunkers split at
+var (
+	sentenceEndPattern    = regexp.MustCompile(`[.!?]["')\]]*\s+|\n`)
+	wordPattern           = regexp.MustCompile(`\S+\s*`)
+	markdownHeaderPattern = regexp.MustCompile(`^#{1,6}\s+\S`)
+	markdownFencePattern  = regexp.MustCompile("^\\s*(```|~~~)")
+	// codeSymbolPattern matches an unindented line starting a top-level
+	// definition in common languages
+	codeSymbolPattern = regexp.MustCompile(`^(?:(?:export|pub(?:\([^)]*\))?|public|private|protected|internal|static|async|abstract|final|default|unsafe|extern)\s+)*` +
+		`(?:func|def|class|struct|enum|interface|trait|impl|fn|type|module|namespace|function|const|var|let|object|record|macro_rules!)\b`)
+	// codeAttachPattern matches unindented comment, decorator and attribute
+	// lines that belong to the definition below them
+	codeAttachPattern = regexp.MustCompile(`^(?://|#|/\*|\*|--|@|\[)`)
+)
+
+// textPiece is a span of text a chunker keeps whole when it fits a chunk
+type textPiece struct {
+	text  string
+	chars int
+	words int
+}
+
+// newTextPiece measures a piece of text
+func newTextPiece(text string) textPiece {
+	return textPiece{text: text, chars: len(text), words: len(strings.Fields(text))}
+}
+
+// chunkCollectionDocument splits a document with its collection's chunking strategy
+func chunkCollectionDocument(chunking models.RAGChunking, text string) []string {
+	size, overlap := chunking.Size, chunking.Overlap
+	if size <= 0 {
+		size, overlap = ragDefaultChunkTokens, ragDefaultChunkOverlap
+	}
+
+	switch chunking.Strategy {
+	case models.RAGChunkFixed:
+		return packPieces(wordPattern.FindAllString(text, -1), size, overlap)
+	case models.RAGChunkParagraph:
+		return chunkParagraphs(text, size, overlap)
+	case models.RAGChunkMarkdown:
+		return chunkMarkdown(text, size, overlap)
+	case models.RAGChunkCode:
+		return chunkCode(text, size, overlap)
+	default:
+		return chunkDocument(text)
+	}
+}
+
+// chunkParagraphs packs whole paragraphs into chunks, splitting paragraphs
+// that don't fit into sentences. Fenced code blocks count as one paragraph.
+func chunkParagraphs(text string, size, overlap int) []string {
+	var pieces []string
+	for _, block := range splitBlocks(text) {
+		if estimateTokens(block) > size {
+			pieces = append(pieces, splitAfter(block, sentenceEndPattern)...)
+		} else {
+			pieces = append(pieces, block)
+		}
+	}
+	return packPieces(pieces, size, overlap)
+}
+
+// chunkMarkdown chunks each markdown section on its own and starts every
+// chunk with the section's header path, so a chunk keeps the context of the
+// headings above it
+func chunkMarkdown(text string, size, overlap int) []string {
+	var chunks []string
+	var headers []string
+	var levels []int
+	var body strings.Builder
+
+	flush := func() {
+		defer body.Reset()
+		if strings.TrimSpace(body.String()) == "" {
+			return
+		}
+		prefix := strings.Join(headers, "\n")
+		budget := max(size-estimateTokens(prefix), ragMinChunkTokens)
+		for _, chunk := range chunkParagraphs(body.String(), budget, overlap) {
+			if prefix != "" {
+				chunk = prefix + "\n\n" + chunk
+			}
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	inFence := false
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if markdownFencePattern.MatchString(line) {
+			inFence = !inFence
+		}
+		if !inFence && markdownHeaderPattern.MatchString(line) {
+			flush()
+			level := strings.IndexFunc(line, func(r rune) bool { return r != '#' })
+			for len(levels) > 0 && levels[len(levels)-1] >= level {
+				headers, levels = headers[:len(headers)-1], levels[:len(levels)-1]
+			}
+			headers = append(headers, strings.TrimSpace(line))
+			levels = append(levels, level)
+			continue
+		}
+		body.WriteString(line)
+	}
+	flush()
+	return chunks
+}
+
+// chunkCode packs whole top-level definitions into chunks, together with the
+// comments and decorators directly above them. Definitions that don't fit
+// are split between lines.
+func chunkCode(text string, size, overlap int) []string {
+	lines := strings.SplitAfter(text, "\n")
+
+	// Find where each definition starts, including its leading comments
+	starts := []int{0}
+	for i, line := range lines {
+		if i == 0 || !codeSymbolPattern.MatchString(line) {
+			continue
+		}
+		start := i
+		for start > 0 && codeAttachPattern.MatchString(lines[start-1]) {
+			start--
+		}
+		if start > starts[len(starts)-1] {
+			starts = append(starts, start)
+		}
+	}
+	starts = append(starts, len(lines))
+
+	var pieces []string
+	for i := 0; i+1 < len(starts); i++ {
+		block := strings.Join(lines[starts[i]:starts[i+1]], "")
+		if estimateTokens(block) > size {
+			pieces = append(pieces, lines[starts[i]:starts[i+1]]...)
+		} else {
+			pieces = append(pieces, block)
+		}
+	}
+	return packPieces(pieces, size, overlap)
+}
+
+// packPieces joins consecutive pieces into chunks of at most size tokens.
+// Each chunk after the first starts with the trailing pieces of the one
+// before that fit in overlap tokens. Pieces larger than a chunk are split
+// between words.
+func packPieces(pieces []string, size, overlap int) []string {
+	var chunks []string
+	var current []textPiece
+	chars, words := 0, 0
+	// fresh is set while current holds pieces not yet in a chunk
+	fresh := false
+
+	emit := func() {
+		var b strings.Builder
+		for _, p := range current {
+			b.WriteString(p.text)
+		}
+		if chunk := strings.TrimSpace(b.String()); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+
+		var carried []textPiece
+		chars, words = 0, 0
+		for i := len(current) - 1; i >= 0; i-- {
+			p := current[i]
+			if tokenEstimate(chars+p.chars, words+p.words) > overlap {
+				break
+			}
+			carried = append([]textPiece{p}, carried...)
+			chars, words = chars+p.chars, words+p.words
+		}
+		current, fresh = carried, false
+	}
+
+	for _, text := range pieces {
+		p := newTextPiece(text)
+		if tokenEstimate(p.chars, p.words) > size {
+			if fresh {
+				emit()
+			}
+			current, chars, words = nil, 0, 0
+			chunks = append(chunks, splitOversized(text, size, overlap)...)
+			continue
+		}
+
+		if fresh && tokenEstimate(chars+p.chars, words+p.words) > size {
+			emit()
+		}
+		if tokenEstimate(chars+p.chars, words+p.words) > size {
+			current, chars, words = nil, 0, 0
+		}
+		current = append(current, p)
+		chars, words = chars+p.chars, words+p.words
+		fresh = true
+	}
+	if fresh {
+		emit()
+	}
+	return chunks
+}
+
+// splitOversized splits a piece that doesn't fit a chunk between words, or
+// for a single huge word such as an encoded blob, into character windows
+func splitOversized(text string, size, overlap int) []string {
+	if words := wordPattern.FindAllString(text, -1); len(words) > 1 {
+		return packPieces(words, size, overlap)
+	}
+
+	runes := []rune(strings.TrimSpace(text))
+	width := max(int(float64(size)*charsPerToken), 1)
+	var chunks []string
+	for start := 0; start < len(runes); start += width {
+		chunks = append(chunks, string(runes[start:min(start+width, len(runes))]))
+	}
+	return chunks
+}
+
+// splitBlocks splits text into paragraphs at blank lines, keeping fenced
+// code blocks whole. Each block keeps its trailing blank lines.
+func splitBlocks(text string) []string {
+	var blocks []string
+	var block strings.Builder
+	inFence := false
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if markdownFencePattern.MatchString(line) {
+			inFence = !inFence
+		}
+		if !inFence && strings.TrimSpace(line) == "" && strings.TrimSpace(block.String()) != "" {
+			block.WriteString(line)
+			blocks = append(blocks, block.String())
+			block.Reset()
+			continue
+		}
+		block.WriteString(line)
+	}
+	if block.Len() > 0 {
+		blocks = append(blocks, block.String())
+	}
+	return blocks
+}
+
+// splitAfter splits text after each match of pattern
+func splitAfter(text string, pattern *regexp.Regexp) []string {
+	var pieces []string
+	start := 0
+	for _, m := range pattern.FindAllStringIndex(text, -1) {
+		if m[1] > start {
+			pieces = append(pieces, text[start:m[1]])
+			start = m[1]
+		}
+	}
+	if start < len(text) {
+		pieces = append(pieces, text[start:])
+	}
+	return pieces
+}
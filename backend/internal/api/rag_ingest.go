@@ -0,0 +1,500 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"vessel-backend/internal/models"
+)
+
+const (
+	// ragFetchMaxLength caps how much of a page is fetched for ingestion (2MB)
+	ragFetchMaxLength = 2000000
+	// ragRecrawlCheckInterval is how often the re-crawl worker looks for
+	// stale URL documents
+	ragRecrawlCheckInterval = 15 * time.Minute
+	// ragRecrawlBatchSize caps how many documents one check re-crawls
+	ragRecrawlBatchSize = 20
+	// ragRecrawlTimeout bounds fetching and re-indexing a single document
+	ragRecrawlTimeout = 2 * time.Minute
+)
+
+// Ingestion outcomes reported in IngestResult.Status
+const (
+	ingestCreated   = "created"
+	ingestUpdated   = "updated"
+	ingestUnchanged = "unchanged"
+)
+
+// Patterns used to turn fetched HTML into text with paragraph breaks
+var (
+	htmlTitlePattern    = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	htmlDropPattern     = regexp.MustCompile(`(?is)<(script|style|noscript|head)[^>]*>.*?</(script|style|noscript|head)>`)
+	htmlBlockPattern    = regexp.MustCompile(`(?i)</?(p|div|section|article|h[1-6]|li|ul|ol|pre|blockquote|table|tr|br)[^>]*>`)
+	htmlTagPattern      = regexp.MustCompile(`<[^>]*>`)
+	inlineSpacePattern  = regexp.MustCompile(`[ \t\r\f\v]+`)
+	blankLinesPattern   = regexp.MustCompile(`\n\s*\n\s*`)
+	paragraphBreakSplit = regexp.MustCompile(`\n\s*\n`)
+)
+
+// IngestDocumentRequest is the request body for adding a document to a
+// collection, either as text or fetched from a URL. Ingesting a URL or a
+// source that is already in the collection re-indexes that document.
+type IngestDocumentRequest struct {
+	Title   string `json:"title"`
+	Source  string `json:"source"`
+	Content string `json:"content"`
+	URL     string `json:"url"`
+}
+
+// IngestResult reports what ingesting a document changed
+type IngestResult struct {
+	Document       *models.RAGDocument `json:"document"`
+	Status         string              `json:"status"`
+	ChunksReused   int                 `json:"chunks_reused"`
+	ChunksEmbedded int                 `json:"chunks_embedded"`
+	ChunksRemoved  int                 `json:"chunks_removed"`
+}
+
+// ragDocumentInput is the text and metadata of a document to (re-)ingest
+type ragDocumentInput struct {
+	Title   string
+	Source  string
+	URL     string
+	Content string
+	// pageTitle names new URL documents ingested without a title
+	pageTitle string
+}
+
+// IngestDocumentHandler chunks a document, embeds the chunks with the
+// collection's model and stores them. Re-ingesting a known document only
+// embeds the chunks whose text changed.
+func (s *OllamaService) IngestDocumentHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collection, err := models.GetRAGCollection(s.db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if collection == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "collection not found"})
+			return
+		}
+
+		var req IngestDocumentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+		if fieldErrs := validateIngestDocument(&req); len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+
+		in := ragDocumentInput{Title: req.Title, Source: req.Source, URL: req.URL, Content: req.Content}
+		if req.URL != "" {
+			in.Content, in.pageTitle, err = s.fetchDocumentText(c.Request.Context(), req.URL)
+			if err != nil {
+				respondDocumentFetchError(c, fmt.Errorf("failed to fetch URL: %w", err))
+				return
+			}
+		}
+
+		existing, err := models.FindRAGDocument(s.db, collection.ID, req.URL, req.Source)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		result, err := s.ingestDocument(c.Request.Context(), collection, in, existing)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "ingest failed: " + err.Error()})
+			return
+		}
+		status := http.StatusOK
+		if result.Status == ingestCreated {
+			status = http.StatusCreated
+		}
+		c.JSON(status, result)
+	}
+}
+
+// RefreshDocumentHandler re-crawls a URL document now and re-indexes what changed
+func (s *OllamaService) RefreshDocumentHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collection, err := models.GetRAGCollection(s.db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		doc, err := models.GetRAGDocument(s.db, c.Param("id"), c.Param("docId"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if collection == nil || doc == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+			return
+		}
+		if doc.URL == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "document was not ingested from a URL; ingest its new content instead"})
+			return
+		}
+
+		result, err := s.recrawlDocument(c.Request.Context(), collection, doc)
+		if err != nil {
+			respondDocumentFetchError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// respondDocumentFetchError writes the response for a failed fetch or ingest:
+// an OFFLINE error in offline mode, 429 when the download cap is used up, and
+// 502 otherwise
+func respondDocumentFetchError(c *gin.Context, err error) {
+	var capErr *BandwidthCapError
+	switch {
+	case errors.Is(err, ErrOffline):
+		respondOffline(c)
+	case errors.As(err, &capErr):
+		respondBandwidthCapExceeded(c, capErr)
+	default:
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	}
+}
+
+// StartRAGRecrawl periodically queues a bulk job re-crawling the URL
+// documents not fetched within interval, until ctx is cancelled. A zero
+// interval or offline mode disables re-crawling.
+func (s *OllamaService) StartRAGRecrawl(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || s.db == nil || IsOffline() {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(min(interval, ragRecrawlCheckInterval))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.queueRecrawl(interval)
+			}
+		}
+	}()
+}
+
+// recrawlDocumentsParams are the params of a recrawl_documents job
+type recrawlDocumentsParams struct {
+	// Collections maps each document to its collection
+	Collections map[string]string `json:"collections"`
+}
+
+// queueRecrawl queues a job re-crawling a batch of URL documents older than
+// maxAge, unless one is still going or maintenance mode is enabled
+func (s *OllamaService) queueRecrawl(maxAge time.Duration) {
+	if InMaintenance() || s.activeBulkJob(models.BulkJobRecrawlDocuments) {
+		return
+	}
+	docs, err := models.ListRAGDocumentsToRecrawl(s.db, time.Now().UTC().Add(-maxAge), ragRecrawlBatchSize)
+	if err != nil {
+		log.Printf("[RAG] Failed to list documents to re-crawl: %v", err)
+		return
+	}
+	if len(docs) == 0 {
+		return
+	}
+
+	params := recrawlDocumentsParams{Collections: make(map[string]string, len(docs))}
+	ids := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		params.Collections[doc.ID] = doc.CollectionID
+		ids = append(ids, doc.ID)
+	}
+	if _, err := s.queueBulkJob(models.BulkJobRecrawlDocuments, params, ids); err != nil {
+		log.Printf("[RAG] %v", err)
+	}
+}
+
+// recrawlDocumentsTask re-crawls each document
+func (s *OllamaService) recrawlDocumentsTask(p recrawlDocumentsParams) bulkTask {
+	return bulkTask{
+		run: func(ctx context.Context, id string) error {
+			collection, err := models.GetRAGCollection(s.db, p.Collections[id])
+			if err != nil {
+				return err
+			}
+			if collection == nil {
+				return fmt.Errorf("collection not found")
+			}
+			doc, err := models.GetRAGDocument(s.db, collection.ID, id)
+			if err != nil {
+				return err
+			}
+			if doc == nil {
+				return fmt.Errorf("document not found")
+			}
+
+			docCtx, cancel := context.WithTimeout(ctx, ragRecrawlTimeout)
+			result, err := s.recrawlDocument(docCtx, collection, doc)
+			cancel()
+			if err != nil {
+				log.Printf("[RAG] Failed to re-crawl %s: %v", doc.URL, err)
+				// Count the attempt so an unreachable page doesn't block the batch
+				_ = models.SetRAGDocumentFetched(s.db, doc.ID, time.Now().UTC())
+				return err
+			}
+			if result.Status != ingestUnchanged {
+				log.Printf("[RAG] Re-indexed %s: %d chunks embedded, %d reused, %d removed",
+					doc.URL, result.ChunksEmbedded, result.ChunksReused, result.ChunksRemoved)
+			}
+			return nil
+		},
+	}
+}
+
+// recrawlDocument fetches a URL document again and re-indexes it
+func (s *OllamaService) recrawlDocument(ctx context.Context, collection *models.RAGCollection, doc *models.RAGDocument) (*IngestResult, error) {
+	content, _, err := s.fetchDocumentText(ctx, doc.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch URL: %w", err)
+	}
+	in := ragDocumentInput{Title: doc.Title, Source: doc.Source, URL: doc.URL, Content: content}
+	result, err := s.ingestDocument(ctx, collection, in, doc)
+	if err != nil {
+		return nil, fmt.Errorf("ingest failed: %w", err)
+	}
+	return result, nil
+}
+
+// ingestDocument stores a new document, or re-indexes an existing one by
+// reusing the embeddings of chunks whose text is unchanged
+func (s *OllamaService) ingestDocument(ctx context.Context, collection *models.RAGCollection, in ragDocumentInput, existing *models.RAGDocument) (*IngestResult, error) {
+	if len(in.Content) > ragMaxDocumentSize {
+		return nil, fmt.Errorf("content must be at most %d bytes", ragMaxDocumentSize)
+	}
+	hash := contentHash(in.Content)
+	now := time.Now().UTC()
+	var fetchedAt *time.Time
+	if in.URL != "" {
+		fetchedAt = &now
+	}
+
+	if existing != nil && existing.ContentHash == hash {
+		if fetchedAt != nil {
+			if err := models.SetRAGDocumentFetched(s.db, existing.ID, now); err != nil {
+				return nil, err
+			}
+			existing.FetchedAt = fetchedAt
+		}
+		return &IngestResult{Document: existing, Status: ingestUnchanged, ChunksReused: existing.ChunkCount}, nil
+	}
+
+	// Index existing chunks by text so unchanged ones keep their embedding
+	reusable := make(map[string][]models.RAGChunk)
+	oldCount := 0
+	if existing != nil {
+		old, err := models.GetRAGDocumentChunks(s.db, existing.ID)
+		if err != nil {
+			return nil, err
+		}
+		oldCount = len(old)
+		for _, chunk := range old {
+			h := contentHash(chunk.Content)
+			reusable[h] = append(reusable[h], chunk)
+		}
+	}
+
+	result := &IngestResult{}
+	texts := chunkCollectionDocument(collection.Chunking, in.Content)
+	chunks := make([]models.RAGChunk, len(texts))
+	var missing []int
+	var missingTexts []string
+	for i, text := range texts {
+		h := contentHash(text)
+		if candidates := reusable[h]; len(candidates) > 0 {
+			chunks[i] = candidates[0]
+			reusable[h] = candidates[1:]
+			result.ChunksReused++
+			continue
+		}
+		chunks[i] = models.RAGChunk{Seq: i, Content: text}
+		missing = append(missing, i)
+		missingTexts = append(missingTexts, text)
+	}
+
+	embedded, err := s.embedChunks(ctx, collection.EmbeddingModel, missingTexts)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range missing {
+		chunks[i].Embedding = embedded[j].Embedding
+	}
+	result.ChunksEmbedded = len(missing)
+	result.ChunksRemoved = oldCount - result.ChunksReused
+
+	if existing == nil {
+		doc := &models.RAGDocument{
+			CollectionID: collection.ID,
+			Title:        in.Title,
+			Source:       in.Source,
+			URL:          in.URL,
+			ContentHash:  hash,
+			FetchedAt:    fetchedAt,
+		}
+		if doc.Title == "" {
+			doc.Title = in.pageTitle
+		}
+		if doc.Title == "" {
+			doc.Title = in.URL
+		}
+		if doc.Source == "" {
+			doc.Source = in.URL
+		}
+		if err := models.CreateRAGDocument(s.db, doc, chunks); err != nil {
+			return nil, err
+		}
+		result.Document, result.Status = doc, ingestCreated
+		return result, nil
+	}
+
+	if in.Title != "" {
+		existing.Title = in.Title
+	}
+	existing.ContentHash = hash
+	if fetchedAt != nil {
+		existing.FetchedAt = fetchedAt
+	}
+	if err := models.UpdateRAGDocument(s.db, existing, chunks); err != nil {
+		return nil, err
+	}
+	result.Document, result.Status = existing, ingestUpdated
+	return result, nil
+}
+
+// chunkDocument splits a document into sections at paragraph breaks and
+// chunks each section on its own. Sections close at the first paragraph
+// break past half a chunk, so after an edit the section boundaries quickly
+// line up with the old ones again and only the chunks around the edit change.
+func chunkDocument(text string) []string {
+	var chunks []string
+	var section strings.Builder
+	flush := func() {
+		if strings.TrimSpace(section.String()) != "" {
+			chunks = append(chunks, chunkText(section.String())...)
+		}
+		section.Reset()
+	}
+
+	for _, paragraph := range paragraphBreakSplit.Split(text, -1) {
+		if section.Len() > 0 {
+			section.WriteString("\n\n")
+		}
+		section.WriteString(paragraph)
+		if section.Len() >= ragChunkSize/2 {
+			flush()
+		}
+	}
+	flush()
+	return chunks
+}
+
+// contentHash identifies a text by its SHA-256 digest
+func contentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// fetchDocumentText fetches a URL and returns its text and page title. The
+// download counts against the web fetch cap.
+func (s *OllamaService) fetchDocumentText(ctx context.Context, rawURL string) (string, string, error) {
+	return s.fetchPageText(ctx, rawURL, ragFetchMaxLength)
+}
+
+// fetchPageText fetches at most maxLength bytes of a URL and returns its
+// text and page title, counting the download against the web fetch cap
+func (s *OllamaService) fetchPageText(ctx context.Context, rawURL string, maxLength int) (string, string, error) {
+	if err := s.bandwidth.check(models.BandwidthSourceWebFetch); err != nil {
+		return "", "", err
+	}
+
+	opts := DefaultFetchOptions()
+	opts.MaxLength = maxLength
+
+	result, err := GetFetcher().Fetch(ctx, rawURL, opts)
+	if err != nil {
+		return "", "", err
+	}
+	s.bandwidth.record(models.BandwidthSourceWebFetch, fetchedBytes(result))
+	if result.StatusCode >= 400 {
+		return "", "", fmt.Errorf("HTTP %d %s", result.StatusCode, http.StatusText(result.StatusCode))
+	}
+
+	content := result.Content
+	if !strings.Contains(result.ContentType, "html") && !strings.HasPrefix(strings.TrimSpace(content), "<") {
+		return content, "", nil
+	}
+	text, title := htmlToText(content)
+	return text, title, nil
+}
+
+// htmlToText reduces an HTML page to text, keeping block elements as
+// paragraph breaks, and returns it with the page title
+func htmlToText(content string) (string, string) {
+	title := ""
+	if m := htmlTitlePattern.FindStringSubmatch(content); m != nil {
+		title = strings.TrimSpace(html.UnescapeString(m[1]))
+	}
+	content = htmlDropPattern.ReplaceAllString(content, "")
+	content = htmlBlockPattern.ReplaceAllString(content, "\n\n")
+	content = htmlTagPattern.ReplaceAllString(content, " ")
+	content = html.UnescapeString(content)
+	content = inlineSpacePattern.ReplaceAllString(content, " ")
+	content = blankLinesPattern.ReplaceAllString(content, "\n\n")
+	return strings.TrimSpace(content), title
+}
+
+// validateIngestDocument checks that a document has text or a URL, but not both
+func validateIngestDocument(req *IngestDocumentRequest) []FieldError {
+	var errs []FieldError
+
+	req.Title = strings.TrimSpace(req.Title)
+	req.URL = strings.TrimSpace(req.URL)
+	hasContent := strings.TrimSpace(req.Content) != ""
+
+	switch {
+	case req.URL != "" && hasContent:
+		errs = append(errs, FieldError{Field: "url", Message: "give either content or url, not both"})
+	case req.URL != "":
+		if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, FieldError{Field: "url", Message: "url must be an absolute http(s) URL"})
+		}
+	case !hasContent:
+		errs = append(errs, FieldError{Field: "content", Message: "content or url is required"})
+	case req.Title == "":
+		errs = append(errs, FieldError{Field: "title", Message: "title is required"})
+	}
+	if len(req.Content) > ragMaxDocumentSize {
+		errs = append(errs, FieldError{
+			Field:   "content",
+			Message: fmt.Sprintf("content must be at most %d bytes", ragMaxDocumentSize),
+		})
+	}
+	return errs
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+
+	"vessel-backend/internal/models"
+)
+
+const (
+	// rrfK dampens the weight of top ranks in reciprocal rank fusion; 60 is
+	// the value from the original RRF paper
+	rrfK = 60
+	// ragCandidateFactor is how many candidates per requested result each
+	// ranking contributes to fusion
+	ragCandidateFactor = 4
+	// minRAGCandidates is the least number of candidates taken from each ranking
+	minRAGCandidates = 20
+)
+
+// ragWeights scales the vector and keyword rankings in fusion
+type ragWeights struct {
+	Vector  float64
+	Keyword float64
+}
+
+// searchCollections ranks chunks by embedding similarity and by BM25 keyword
+// relevance, then fuses both rankings with weighted reciprocal rank fusion.
+// Keyword search catches exact identifiers and code symbols that embeddings
+// tend to blur.
+func (s *OllamaService) searchCollections(ctx context.Context, collections []*models.RAGCollection, query string, topK int, weights ragWeights) (*RAGQueryResponse, error) {
+	resp := &RAGQueryResponse{Collections: []string{}, Results: []RAGQueryResult{}}
+	for _, collection := range collections {
+		resp.Collections = append(resp.Collections, collection.ID)
+	}
+	if len(collections) == 0 {
+		return resp, nil
+	}
+	candidates := max(topK*ragCandidateFactor, minRAGCandidates)
+
+	var keyword []models.RAGKeywordMatch
+	if weights.Keyword > 0 {
+		var err error
+		keyword, err = models.SearchRAGChunks(s.db, resp.Collections, ftsQuery(query), candidates)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var vector []RAGQueryResult
+	if weights.Vector > 0 {
+		var err error
+		vector, err = s.vectorSearch(ctx, collections, query, candidates)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resp.Results = fuseRankings(vector, keyword, weights, topK)
+	return resp, nil
+}
+
+// fuseRankings combines the vector and keyword rankings. Each chunk scores
+// weight/(rrfK+rank) for every ranking it appears in.
+func fuseRankings(vector []RAGQueryResult, keyword []models.RAGKeywordMatch, weights ragWeights, topK int) []RAGQueryResult {
+	fused := make(map[int64]*RAGQueryResult)
+	var order []int64
+
+	entry := func(chunk models.RAGChunk) *RAGQueryResult {
+		r, ok := fused[chunk.ID]
+		if !ok {
+			r = &RAGQueryResult{RAGChunk: chunk}
+			fused[chunk.ID] = r
+			order = append(order, chunk.ID)
+		}
+		return r
+	}
+
+	for rank, v := range vector {
+		r := entry(v.RAGChunk)
+		similarity := v.Score
+		r.VectorScore = &similarity
+		r.Score += weights.Vector / float64(rrfK+rank+1)
+	}
+	for rank, m := range keyword {
+		r := entry(m.Chunk)
+		// bm25() is negative with lower being better; flip it so higher is better
+		relevance := -m.BM25
+		r.KeywordScore = &relevance
+		r.Score += weights.Keyword / float64(rrfK+rank+1)
+	}
+
+	results := make([]RAGQueryResult, 0, len(order))
+	for _, id := range order {
+		r := fused[id]
+		r.Embedding = nil
+		results = append(results, *r)
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > topK {
+		results = results[:topK]
+	}
+	return results
+}
+
+// ftsQuery turns free text into an FTS5 expression matching any of its
+// words. Terms are quoted so punctuation and FTS operators in the query are
+// taken literally.
+func ftsQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	terms := make([]string, 0, len(words))
+	for _, w := range words {
+		terms = append(terms, `"`+w+`"`)
+	}
+	return strings.Join(terms, " OR ")
+}
@@ -0,0 +1,848 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"vessel-backend/internal/models"
+)
+
+const (
+	// ragUploadMaxSize caps the size of an uploaded file (512MB)
+	ragUploadMaxSize = 512 * 1024 * 1024
+	// ragPDFPageBatch is how many PDF pages are extracted between progress updates
+	ragPDFPageBatch = 10
+)
+
+// Files spooled for an upload, one per finished stage
+const (
+	uploadSourceFile     = "source"
+	uploadTextFile       = "text.txt"
+	uploadChunksFile     = "chunks.json"
+	uploadEmbeddingsFile = "embeddings.jsonl"
+)
+
+// uploadRunner ingests uploads one at a time in the background and lets
+// clients follow their progress
+type uploadRunner struct {
+	slot chan struct{}
+
+	mu   sync.Mutex
+	jobs map[string]*uploadJob
+}
+
+// newUploadRunner creates a runner that ingests one upload at a time
+func newUploadRunner() *uploadRunner {
+	return &uploadRunner{
+		slot: make(chan struct{}, 1),
+		jobs: make(map[string]*uploadJob),
+	}
+}
+
+// uploadJob is an upload being ingested
+type uploadJob struct {
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	upload models.RAGUpload
+	// updated is closed and replaced whenever the upload's progress changes
+	updated chan struct{}
+}
+
+// snapshot returns the upload's current state and a channel that is closed
+// when it changes
+func (j *uploadJob) snapshot() (models.RAGUpload, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.upload, j.updated
+}
+
+// update applies a change to the upload, saves it and wakes any followers
+func (j *uploadJob) update(db *sql.DB, change func(u *models.RAGUpload)) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	change(&j.upload)
+	close(j.updated)
+	j.updated = make(chan struct{})
+	return models.SaveRAGUploadProgress(db, &j.upload)
+}
+
+// ListRAGUploadsHandler returns a collection's uploads
+func ListRAGUploadsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uploads, err := models.ListRAGUploads(db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"uploads": uploads})
+	}
+}
+
+// GetRAGUploadHandler returns an upload's status and progress
+func GetRAGUploadHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		upload, err := models.GetRAGUpload(db, c.Param("id"), c.Param("uploadId"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if upload == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "upload not found"})
+			return
+		}
+		c.JSON(http.StatusOK, upload)
+	}
+}
+
+// UploadDocumentHandler streams a multipart file upload (field "file", plus
+// an optional "title") to disk and ingests it in the background. Follow the
+// progress at GET /rag/collections/:id/uploads/:uploadId/events.
+func (s *OllamaService) UploadDocumentHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collection, err := models.GetRAGCollection(s.db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if collection == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "collection not found"})
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, ragUploadMaxSize+1024*1024)
+		reader, err := c.Request.MultipartReader()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expected a multipart/form-data upload"})
+			return
+		}
+
+		upload := &models.RAGUpload{
+			ID:           uuid.New().String(),
+			CollectionID: collection.ID,
+			Status:       models.RAGUploadQueued,
+			Stage:        models.RAGStageExtract,
+		}
+		dir := s.uploadSpoolDir(upload.ID)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create upload directory: " + err.Error()})
+			return
+		}
+		stored := false
+		defer func() {
+			if !stored {
+				os.RemoveAll(dir)
+			}
+		}()
+
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				respondUploadError(c, err)
+				return
+			}
+
+			switch part.FormName() {
+			case "title":
+				title, err := io.ReadAll(io.LimitReader(part, 1024))
+				if err != nil {
+					respondUploadError(c, err)
+					return
+				}
+				upload.Title = strings.TrimSpace(string(title))
+			case "file":
+				if upload.Filename != "" {
+					respondValidationError(c, []FieldError{{Field: "file", Message: "upload one file at a time"}})
+					return
+				}
+				upload.Filename = filepath.Base(part.FileName())
+				upload.Size, err = spoolFile(part, filepath.Join(dir, uploadSourceFile), ragUploadMaxSize)
+				if err != nil {
+					respondUploadError(c, err)
+					return
+				}
+			}
+			part.Close()
+		}
+
+		if fieldErrs := validateUpload(upload); len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+		if err := models.CreateRAGUpload(s.db, upload); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		stored = true
+
+		s.startUpload(upload)
+		c.JSON(http.StatusAccepted, upload)
+	}
+}
+
+// UploadEventsHandler streams an upload's progress as server-sent events.
+// A "progress" event is sent on every change, and a final event named after
+// the upload's status (completed, failed or cancelled) ends the stream.
+func (s *OllamaService) UploadEventsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		upload, err := models.GetRAGUpload(s.db, c.Param("id"), c.Param("uploadId"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if upload == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "upload not found"})
+			return
+		}
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+
+		flusher, ok := c.Writer.(http.Flusher)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "streaming not supported"})
+			return
+		}
+
+		ctx := c.Request.Context()
+		for {
+			current, updated := s.watchUpload(upload)
+			event := "progress"
+			if current.Finished() {
+				event = current.Status
+			}
+			data, _ := json.Marshal(current)
+			if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, data); err != nil {
+				return
+			}
+			flusher.Flush()
+
+			if updated == nil || current.Finished() {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				// Ingestion carries on; the client can follow it again later
+				return
+			case <-updated:
+			}
+		}
+	}
+}
+
+// CancelUploadHandler stops an upload. The stages it finished are kept, so
+// it can be resumed later.
+func (s *OllamaService) CancelUploadHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.uploads.mu.Lock()
+		job, ok := s.uploads.jobs[c.Param("uploadId")]
+		s.uploads.mu.Unlock()
+
+		if !ok || job.upload.CollectionID != c.Param("id") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "upload not active"})
+			return
+		}
+		job.cancel()
+		c.JSON(http.StatusOK, gin.H{"message": "upload cancelled"})
+	}
+}
+
+// ResumeUploadHandler restarts a failed or cancelled upload at the stage it
+// stopped in
+func (s *OllamaService) ResumeUploadHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		upload, err := models.GetRAGUpload(s.db, c.Param("id"), c.Param("uploadId"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if upload == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "upload not found"})
+			return
+		}
+		if upload.Status != models.RAGUploadFailed && upload.Status != models.RAGUploadCancelled {
+			c.JSON(http.StatusConflict, gin.H{"error": "only failed or cancelled uploads can be resumed"})
+			return
+		}
+		if _, err := os.Stat(filepath.Join(s.uploadSpoolDir(upload.ID), uploadSourceFile)); err != nil {
+			c.JSON(http.StatusGone, gin.H{"error": "the uploaded file is no longer available; upload it again"})
+			return
+		}
+
+		upload.Status = models.RAGUploadQueued
+		upload.Error = ""
+		if err := models.SaveRAGUploadProgress(s.db, upload); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		s.startUpload(upload)
+		c.JSON(http.StatusAccepted, upload)
+	}
+}
+
+// DeleteUploadHandler cancels an upload if it is running and removes it
+// along with its spooled files. A document it already stored is kept.
+func (s *OllamaService) DeleteUploadHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("uploadId")
+		s.uploads.mu.Lock()
+		job, ok := s.uploads.jobs[id]
+		s.uploads.mu.Unlock()
+		if ok {
+			job.cancel()
+		}
+
+		if err := models.DeleteRAGUpload(s.db, c.Param("id"), id); err != nil {
+			if err.Error() == "upload not found" {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !ok {
+			os.RemoveAll(s.uploadSpoolDir(id))
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "upload deleted"})
+	}
+}
+
+// watchUpload returns an upload's current state and a channel closed when it
+// changes. The channel is nil once the upload is no longer being ingested.
+func (s *OllamaService) watchUpload(upload *models.RAGUpload) (models.RAGUpload, <-chan struct{}) {
+	s.uploads.mu.Lock()
+	job, ok := s.uploads.jobs[upload.ID]
+	s.uploads.mu.Unlock()
+	if ok {
+		return job.snapshot()
+	}
+
+	// The job may have finished since the upload was loaded
+	if current, err := models.GetRAGUpload(s.db, upload.CollectionID, upload.ID); err == nil && current != nil {
+		return *current, nil
+	}
+	return *upload, nil
+}
+
+// startUpload registers an upload with the runner and ingests it in the background
+func (s *OllamaService) startUpload(upload *models.RAGUpload) {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &uploadJob{cancel: cancel, upload: *upload, updated: make(chan struct{})}
+
+	s.uploads.mu.Lock()
+	s.uploads.jobs[upload.ID] = job
+	s.uploads.mu.Unlock()
+
+	go s.executeUpload(ctx, job)
+}
+
+// executeUpload waits for the runner slot, then runs the upload's remaining
+// stages: extract the text, chunk it, embed the chunks and store the document
+func (s *OllamaService) executeUpload(ctx context.Context, job *uploadJob) {
+	upload, _ := job.snapshot()
+	defer func() {
+		s.uploads.mu.Lock()
+		if s.uploads.jobs[upload.ID] == job {
+			delete(s.uploads.jobs, upload.ID)
+		}
+		s.uploads.mu.Unlock()
+		job.cancel()
+	}()
+
+	select {
+	case s.uploads.slot <- struct{}{}:
+		defer func() { <-s.uploads.slot }()
+	case <-ctx.Done():
+		s.finishUpload(job, models.RAGUploadCancelled, "")
+		return
+	}
+
+	if err := job.update(s.db, func(u *models.RAGUpload) { u.Status = models.RAGUploadRunning }); err != nil {
+		log.Printf("[RAG] %v", err)
+	}
+
+	err := s.runUploadStages(ctx, job)
+	switch {
+	case ctx.Err() != nil:
+		s.finishUpload(job, models.RAGUploadCancelled, "")
+	case err != nil:
+		log.Printf("[RAG] Upload %s failed: %v", upload.ID, err)
+		s.finishUpload(job, models.RAGUploadFailed, err.Error())
+	default:
+		s.finishUpload(job, models.RAGUploadCompleted, "")
+	}
+
+	// Completed uploads don't need their files any more, and deleted ones
+	// were cancelled without removing them
+	current, err := models.GetRAGUpload(s.db, upload.CollectionID, upload.ID)
+	if err == nil && (current == nil || current.Status == models.RAGUploadCompleted) {
+		os.RemoveAll(s.uploadSpoolDir(upload.ID))
+	}
+}
+
+// finishUpload records an upload's final status
+func (s *OllamaService) finishUpload(job *uploadJob, status, errMsg string) {
+	err := job.update(s.db, func(u *models.RAGUpload) {
+		u.Status = status
+		u.Error = errMsg
+	})
+	if err != nil {
+		log.Printf("[RAG] %v", err)
+	}
+}
+
+// runUploadStages runs the stages from the one the upload stopped in
+func (s *OllamaService) runUploadStages(ctx context.Context, job *uploadJob) error {
+	upload, _ := job.snapshot()
+	collection, err := models.GetRAGCollection(s.db, upload.CollectionID)
+	if err != nil {
+		return err
+	}
+	if collection == nil {
+		return fmt.Errorf("collection not found")
+	}
+	existing, err := models.FindRAGDocument(s.db, collection.ID, "", upload.Filename)
+	if err != nil {
+		return err
+	}
+	dir := s.uploadSpoolDir(upload.ID)
+
+	stages := []struct {
+		name string
+		run  func() error
+	}{
+		{models.RAGStageExtract, func() error { return s.extractUpload(ctx, job, dir) }},
+		{models.RAGStageChunk, func() error { return s.chunkUpload(job, dir, collection) }},
+		{models.RAGStageEmbed, func() error { return s.embedUpload(ctx, job, dir, collection, existing) }},
+		{models.RAGStageStore, func() error { return s.storeUpload(job, dir, collection, existing) }},
+	}
+
+	started := false
+	for i, stage := range stages {
+		if stage.name == upload.Stage {
+			started = true
+		}
+		if !started {
+			continue
+		}
+		if err := stage.run(); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if i+1 < len(stages) {
+			next := stages[i+1].name
+			if err := job.update(s.db, func(u *models.RAGUpload) { u.Stage = next }); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// extractUpload converts the uploaded file to text. PDFs are converted a
+// batch of pages at a time with pdftotext so progress can be reported.
+func (s *OllamaService) extractUpload(ctx context.Context, job *uploadJob, dir string) error {
+	upload, _ := job.snapshot()
+	src := filepath.Join(dir, uploadSourceFile)
+	dst := filepath.Join(dir, uploadTextFile)
+
+	if isPDFUpload(upload.Filename, src) {
+		return s.extractPDF(ctx, job, src, dst)
+	}
+
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if !utf8.Valid(content) {
+		return fmt.Errorf("%s is not a text file or PDF", upload.Filename)
+	}
+	text := string(content)
+	switch strings.ToLower(filepath.Ext(upload.Filename)) {
+	case ".html", ".htm", ".xhtml":
+		text, _ = htmlToText(text)
+	}
+	if err := os.WriteFile(dst, []byte(text), 0o644); err != nil {
+		return err
+	}
+	return job.update(s.db, func(u *models.RAGUpload) {
+		u.PagesTotal = 1
+		u.PagesDone = 1
+	})
+}
+
+// extractPDF converts a PDF to text page batch by page batch. Without
+// pdfinfo to count the pages, the whole PDF is converted at once.
+func (s *OllamaService) extractPDF(ctx context.Context, job *uploadJob, src, dst string) error {
+	pdftotext, err := exec.LookPath("pdftotext")
+	if err != nil {
+		return fmt.Errorf("PDF uploads need pdftotext (poppler-utils) installed on the server")
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	pages := pdfPageCount(ctx, src)
+	if pages == 0 {
+		text, err := exec.CommandContext(ctx, pdftotext, "-enc", "UTF-8", src, "-").Output()
+		if err != nil {
+			return fmt.Errorf("pdftotext failed: %w", err)
+		}
+		pages = bytes.Count(text, []byte("\f"))
+		if _, err := out.Write(bytes.ReplaceAll(text, []byte("\f"), []byte("\n\n"))); err != nil {
+			return err
+		}
+		return job.update(s.db, func(u *models.RAGUpload) {
+			u.PagesTotal = pages
+			u.PagesDone = pages
+		})
+	}
+
+	if err := job.update(s.db, func(u *models.RAGUpload) {
+		u.PagesTotal = pages
+		u.PagesDone = 0
+	}); err != nil {
+		return err
+	}
+	for first := 1; first <= pages; first += ragPDFPageBatch {
+		last := min(first+ragPDFPageBatch-1, pages)
+		text, err := exec.CommandContext(ctx, pdftotext, "-enc", "UTF-8",
+			"-f", strconv.Itoa(first), "-l", strconv.Itoa(last), src, "-").Output()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("pdftotext failed on pages %d-%d: %w", first, last, err)
+		}
+		if _, err := out.Write(bytes.ReplaceAll(text, []byte("\f"), []byte("\n\n"))); err != nil {
+			return err
+		}
+		if err := job.update(s.db, func(u *models.RAGUpload) { u.PagesDone = last }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chunkUpload splits the extracted text with the collection's chunking strategy
+func (s *OllamaService) chunkUpload(job *uploadJob, dir string, collection *models.RAGCollection) error {
+	text, err := os.ReadFile(filepath.Join(dir, uploadTextFile))
+	if err != nil {
+		return err
+	}
+	chunks := chunkCollectionDocument(collection.Chunking, string(text))
+	if len(chunks) == 0 {
+		return fmt.Errorf("no text could be extracted from the file")
+	}
+
+	data, err := json.Marshal(chunks)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, uploadChunksFile), data, 0o644); err != nil {
+		return err
+	}
+	// A fresh chunking invalidates embeddings from an earlier attempt
+	os.Remove(filepath.Join(dir, uploadEmbeddingsFile))
+	return job.update(s.db, func(u *models.RAGUpload) {
+		u.ChunksTotal = len(chunks)
+		u.ChunksEmbedded = 0
+	})
+}
+
+// embedUpload embeds the chunks a batch at a time, appending each embedding
+// as a JSON line. A resumed upload continues after the last complete line.
+// Chunks unchanged from an earlier version of the document keep their
+// embedding.
+func (s *OllamaService) embedUpload(ctx context.Context, job *uploadJob, dir string, collection *models.RAGCollection, existing *models.RAGDocument) error {
+	chunks, err := readUploadChunks(dir)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, uploadEmbeddingsFile)
+	done, err := truncateEmbeddings(path)
+	if err != nil {
+		return err
+	}
+	if done > len(chunks) {
+		done = 0
+		os.Remove(path)
+	}
+
+	reusable := make(map[string][]float32)
+	if existing != nil {
+		old, err := models.GetRAGDocumentChunks(s.db, existing.ID)
+		if err != nil {
+			return err
+		}
+		for _, chunk := range old {
+			reusable[contentHash(chunk.Content)] = chunk.Embedding
+		}
+	}
+
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	for start := done; start < len(chunks); start += ragEmbedBatchSize {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		end := min(start+ragEmbedBatchSize, len(chunks))
+
+		embeddings := make([][]float32, end-start)
+		var missing []int
+		var missingTexts []string
+		for i := start; i < end; i++ {
+			if embedding, ok := reusable[contentHash(chunks[i])]; ok {
+				embeddings[i-start] = embedding
+				continue
+			}
+			missing = append(missing, i-start)
+			missingTexts = append(missingTexts, chunks[i])
+		}
+		if len(missingTexts) > 0 {
+			embedded, err := s.embed(ctx, collection.EmbeddingModel, missingTexts)
+			if err != nil {
+				return err
+			}
+			for j, i := range missing {
+				embeddings[i] = embedded[j]
+			}
+		}
+
+		var lines bytes.Buffer
+		for _, embedding := range embeddings {
+			data, err := json.Marshal(embedding)
+			if err != nil {
+				return err
+			}
+			lines.Write(data)
+			lines.WriteByte('\n')
+		}
+		if _, err := out.Write(lines.Bytes()); err != nil {
+			return err
+		}
+		if err := job.update(s.db, func(u *models.RAGUpload) { u.ChunksEmbedded = end }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storeUpload saves the embedded chunks as a document, replacing the
+// earlier version of the same file
+func (s *OllamaService) storeUpload(job *uploadJob, dir string, collection *models.RAGCollection, existing *models.RAGDocument) error {
+	upload, _ := job.snapshot()
+	text, err := os.ReadFile(filepath.Join(dir, uploadTextFile))
+	if err != nil {
+		return err
+	}
+	texts, err := readUploadChunks(dir)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(filepath.Join(dir, uploadEmbeddingsFile))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	chunks := make([]models.RAGChunk, 0, len(texts))
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() && len(chunks) < len(texts) {
+		var embedding []float32
+		if err := json.Unmarshal(scanner.Bytes(), &embedding); err != nil {
+			return fmt.Errorf("corrupt embeddings file: %w", err)
+		}
+		seq := len(chunks)
+		chunks = append(chunks, models.RAGChunk{Seq: seq, Content: texts[seq], Embedding: embedding})
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(chunks) != len(texts) {
+		return fmt.Errorf("only %d of %d chunks were embedded", len(chunks), len(texts))
+	}
+
+	hash := contentHash(string(text))
+	var documentID string
+	if existing != nil {
+		if upload.Title != "" {
+			existing.Title = upload.Title
+		}
+		existing.ContentHash = hash
+		if err := models.UpdateRAGDocument(s.db, existing, chunks); err != nil {
+			return err
+		}
+		documentID = existing.ID
+	} else {
+		doc := &models.RAGDocument{
+			CollectionID: collection.ID,
+			Title:        upload.Title,
+			Source:       upload.Filename,
+			ContentHash:  hash,
+		}
+		if doc.Title == "" {
+			doc.Title = strings.TrimSuffix(upload.Filename, filepath.Ext(upload.Filename))
+		}
+		if err := models.CreateRAGDocument(s.db, doc, chunks); err != nil {
+			return err
+		}
+		documentID = doc.ID
+	}
+	return job.update(s.db, func(u *models.RAGUpload) { u.DocumentID = &documentID })
+}
+
+// uploadSpoolBase is the directory holding every upload's spool directory
+func (s *OllamaService) uploadSpoolBase() string {
+	if s.uploadDir == "" {
+		return filepath.Join(os.TempDir(), "vessel-uploads")
+	}
+	return s.uploadDir
+}
+
+// uploadSpoolDir is where an upload's file and stage outputs are kept
+func (s *OllamaService) uploadSpoolDir(id string) string {
+	return filepath.Join(s.uploadSpoolBase(), id)
+}
+
+// spoolFile copies an uploaded file to disk, refusing files over limit bytes
+func spoolFile(r io.Reader, path string, limit int64) (int64, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, io.LimitReader(r, limit+1))
+	if err != nil {
+		return n, err
+	}
+	if n > limit {
+		return n, &http.MaxBytesError{Limit: limit}
+	}
+	return n, f.Close()
+}
+
+// respondUploadError reports a failure while receiving an upload
+func respondUploadError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("file must be at most %d bytes", tooLarge.Limit),
+		})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read upload: " + err.Error()})
+}
+
+// readUploadChunks loads the chunk texts saved by the chunk stage
+func readUploadChunks(dir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, uploadChunksFile))
+	if err != nil {
+		return nil, err
+	}
+	var chunks []string
+	if err := json.Unmarshal(data, &chunks); err != nil {
+		return nil, fmt.Errorf("corrupt chunks file: %w", err)
+	}
+	return chunks, nil
+}
+
+// truncateEmbeddings drops a partially written last line from the embeddings
+// file and returns how many complete lines it holds
+func truncateEmbeddings(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	complete := bytes.LastIndexByte(data, '\n') + 1
+	if complete < len(data) {
+		if err := os.Truncate(path, int64(complete)); err != nil {
+			return 0, err
+		}
+	}
+	return bytes.Count(data[:complete], []byte("\n")), nil
+}
+
+// isPDFUpload reports whether an upload is a PDF, by extension or signature
+func isPDFUpload(filename, path string) bool {
+	if strings.EqualFold(filepath.Ext(filename), ".pdf") {
+		return true
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	header := make([]byte, 5)
+	n, _ := io.ReadFull(f, header)
+	return string(header[:n]) == "%PDF-"
+}
+
+// pdfPageCount returns a PDF's page count from pdfinfo, or 0 if unknown
+func pdfPageCount(ctx context.Context, path string) int {
+	pdfinfo, err := exec.LookPath("pdfinfo")
+	if err != nil {
+		return 0
+	}
+	out, err := exec.CommandContext(ctx, pdfinfo, path).Output()
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if value, ok := strings.CutPrefix(line, "Pages:"); ok {
+			pages, _ := strconv.Atoi(strings.TrimSpace(value))
+			return pages
+		}
+	}
+	return 0
+}
+
+// validateUpload checks that an upload included a non-empty file
+func validateUpload(upload *models.RAGUpload) []FieldError {
+	var errs []FieldError
+	switch {
+	case upload.Filename == "" || upload.Filename == "." || upload.Filename == "/":
+		errs = append(errs, FieldError{Field: "file", Message: "file is required"})
+	case upload.Size == 0:
+		errs = append(errs, FieldError{Field: "file", Message: "file must not be empty"})
+	}
+	return errs
+}
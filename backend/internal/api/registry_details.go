@@ -0,0 +1,275 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// detailsQueueSize caps how many models can wait for a details fetch
+	detailsQueueSize = 256
+	// detailsFetchTimeout bounds a single model's details fetch
+	detailsFetchTimeout = 30 * time.Second
+	// popularDetailsLimit is how many of the most pulled models are fetched
+	// in the background when nothing was requested
+	popularDetailsLimit = 50
+)
+
+// Patterns for specs in the text of an ollama.com model page
+var (
+	pageArchPattern       = regexp.MustCompile(`\barch\s+([a-z0-9_.-]+)`)
+	pageParamsPattern     = regexp.MustCompile(`\bparameters\s+(\d+(?:\.\d+)?[KMBT])\b`)
+	pageQuantPattern      = regexp.MustCompile(`\bquantization\s+([A-Za-z0-9_]+)`)
+	pageContextPattern    = regexp.MustCompile(`(\d+(?:\.\d+)?)([KM]?)\s*context window`)
+	pageImageInputPattern = regexp.MustCompile(`context window\s*·\s*Text,\s*Image`)
+)
+
+// detailsWorker fetches registry model details in the background, one model
+// per interval. Requested models are fetched first; when the queue is empty
+// the most pulled models without details are fetched.
+type detailsWorker struct {
+	registry *ModelRegistryService
+	queue    chan string
+
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+// StartDetailsWorker starts lazily fetching registry model details at most
+// once per interval until ctx is cancelled. A zero interval or offline mode
+// disables it.
+func (s *ModelRegistryService) StartDetailsWorker(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || IsOffline() {
+		return
+	}
+
+	w := &detailsWorker{
+		registry: s,
+		queue:    make(chan string, detailsQueueSize),
+		pending:  make(map[string]bool),
+	}
+	s.details = w
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				w.fetchNext(ctx)
+			}
+		}
+	}()
+}
+
+// QueueDetails schedules a details fetch for models that don't have details
+// yet. It never blocks; models are dropped when the queue is full.
+func (s *ModelRegistryService) QueueDetails(models ...RemoteModel) {
+	w := s.details
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, m := range models {
+		if m.DetailsFetchedAt != "" || w.pending[m.Slug] {
+			continue
+		}
+		select {
+		case w.queue <- m.Slug:
+			w.pending[m.Slug] = true
+		default:
+			return
+		}
+	}
+}
+
+// fetchNext fetches one queued model, or a popular one if none is queued
+func (w *detailsWorker) fetchNext(ctx context.Context) {
+	var slug string
+	select {
+	case slug = <-w.queue:
+		w.mu.Lock()
+		delete(w.pending, slug)
+		w.mu.Unlock()
+	default:
+		var err error
+		slug, err = w.registry.nextPopularWithoutDetails(ctx)
+		if err != nil {
+			log.Printf("[Registry] Failed to pick model for details: %v", err)
+			return
+		}
+		if slug == "" {
+			return
+		}
+	}
+
+	fetchCtx, cancel := context.WithTimeout(ctx, detailsFetchTimeout)
+	defer cancel()
+	if _, err := w.registry.RefreshModelDetails(fetchCtx, slug); err != nil {
+		log.Printf("[Registry] Failed to fetch details for %s: %v", slug, err)
+	}
+}
+
+// nextPopularWithoutDetails returns the most pulled model among the top
+// popularDetailsLimit that has no details yet, or "" if all have them
+func (s *ModelRegistryService) nextPopularWithoutDetails(ctx context.Context) (string, error) {
+	var slug string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT slug FROM (
+			SELECT slug, details_fetched_at, pull_count FROM remote_models
+			ORDER BY pull_count DESC LIMIT ?
+		) WHERE details_fetched_at IS NULL OR details_fetched_at = ''
+		ORDER BY pull_count DESC LIMIT 1`, popularDetailsLimit).Scan(&slug)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return slug, err
+}
+
+// RefreshModelDetails fetches a registry model's details now. Installed models
+// are described by Ollama; others are read from their ollama.com page.
+func (s *ModelRegistryService) RefreshModelDetails(ctx context.Context, slug string) (*RemoteModel, error) {
+	if _, err := s.GetModel(ctx, slug); err != nil {
+		return nil, err
+	}
+
+	if s.ollamaClient != nil {
+		if model, err := s.FetchModelDetails(ctx, slug); err == nil {
+			return model, nil
+		}
+	}
+
+	page, err := s.fetchModelPage(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	sizes, _ := parseModelPageForSizes(page)
+	specs := parseModelPageSpecs(page)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sizesJSON, _ := json.Marshal(sizes)
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE remote_models SET
+			architecture = COALESCE(NULLIF(?, ''), architecture),
+			parameter_size = COALESCE(NULLIF(?, ''), parameter_size),
+			context_length = CASE WHEN ? > 0 THEN ? ELSE context_length END,
+			quantization = COALESCE(NULLIF(?, ''), quantization),
+			tag_sizes = CASE WHEN ? != '{}' THEN ? ELSE tag_sizes END,
+			details_fetched_at = ?
+		WHERE slug = ?`,
+		specs.architecture, specs.parameterSize, specs.contextLength, specs.contextLength,
+		specs.quantization, string(sizesJSON), string(sizesJSON),
+		time.Now().UTC().Format(time.RFC3339), slug)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update model details: %w", err)
+	}
+
+	if specs.vision {
+		if err := s.addCapability(ctx, slug, "vision"); err != nil {
+			return nil, err
+		}
+	}
+	return s.GetModel(ctx, slug)
+}
+
+// addCapability adds a capability to a registry model if it's missing
+func (s *ModelRegistryService) addCapability(ctx context.Context, slug, capability string) error {
+	var capsJSON sql.NullString
+	if err := s.db.QueryRowContext(ctx, `SELECT capabilities FROM remote_models WHERE slug = ?`, slug).Scan(&capsJSON); err != nil {
+		return fmt.Errorf("failed to get capabilities: %w", err)
+	}
+
+	var caps []string
+	if capsJSON.String != "" {
+		_ = json.Unmarshal([]byte(capsJSON.String), &caps)
+	}
+	for _, c := range caps {
+		if c == capability {
+			return nil
+		}
+	}
+
+	updated, _ := json.Marshal(append(caps, capability))
+	if _, err := s.db.ExecContext(ctx, `UPDATE remote_models SET capabilities = ? WHERE slug = ?`, string(updated), slug); err != nil {
+		return fmt.Errorf("failed to update capabilities: %w", err)
+	}
+	return nil
+}
+
+// modelPageSpecs holds the specs read from an ollama.com model page
+type modelPageSpecs struct {
+	architecture  string
+	parameterSize string
+	quantization  string
+	contextLength int64
+	vision        bool
+}
+
+// parseModelPageSpecs reads architecture, size, quantization and the largest
+// context window from an ollama.com model page
+func parseModelPageSpecs(html string) modelPageSpecs {
+	var specs modelPageSpecs
+	text := strings.Join(strings.Fields(stripHTML(html)), " ")
+
+	if m := pageArchPattern.FindStringSubmatch(text); m != nil {
+		specs.architecture = m[1]
+	}
+	if m := pageParamsPattern.FindStringSubmatch(text); m != nil {
+		specs.parameterSize = m[1]
+	}
+	if m := pageQuantPattern.FindStringSubmatch(text); m != nil {
+		specs.quantization = m[1]
+	}
+	for _, m := range pageContextPattern.FindAllStringSubmatch(text, -1) {
+		n, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			continue
+		}
+		switch m[2] {
+		case "K":
+			n *= 1024
+		case "M":
+			n *= 1024 * 1024
+		}
+		if int64(n) > specs.contextLength {
+			specs.contextLength = int64(n)
+		}
+	}
+	specs.vision = pageImageInputPattern.MatchString(text)
+	return specs
+}
+
+// RefreshModelDetailsHandler fetches a registry model's details immediately,
+// bypassing the background queue
+func (s *ModelRegistryService) RefreshModelDetailsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		model, err := s.RefreshModelDetails(c.Request.Context(), c.Param("slug"))
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "model not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, model)
+	}
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"vessel-backend/internal/models"
+)
+
+// StartRetention applies the stored retention policies on the given interval
+// until ctx is cancelled
+func StartRetention(ctx context.Context, db *sql.DB, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runScheduledRetention(ctx, db)
+			}
+		}
+	}()
+}
+
+// runScheduledRetention performs one scheduled retention pass, logging what
+// was removed. Passes are skipped in maintenance mode.
+func runScheduledRetention(ctx context.Context, db *sql.DB) {
+	if InMaintenance() {
+		return
+	}
+	policies, err := models.GetRetentionPolicies(db)
+	if err != nil {
+		log.Printf("[Retention] %v", err)
+		return
+	}
+
+	report, err := models.RunRetention(ctx, db, policies, false)
+	if err != nil {
+		log.Printf("[Retention] %v", err)
+		return
+	}
+	for _, result := range report.Policies {
+		if result.Count > 0 {
+			log.Printf("[Retention] %s: %d records before %s", result.Policy, result.Count, result.Cutoff)
+		}
+	}
+}
+
+// validateRetentionPolicies checks that no retention period is negative
+func validateRetentionPolicies(p *models.RetentionPolicies) []FieldError {
+	var errs []FieldError
+	if p.ArchiveChatsAfterDays < 0 {
+		errs = append(errs, FieldError{Field: "archive_chats_after_days", Message: "must not be negative"})
+	}
+	if p.PurgeUsageAfterDays < 0 {
+		errs = append(errs, FieldError{Field: "purge_usage_after_days", Message: "must not be negative"})
+	}
+	if p.PurgeEvalRunsAfterDays < 0 {
+		errs = append(errs, FieldError{Field: "purge_eval_runs_after_days", Message: "must not be negative"})
+	}
+	return errs
+}
+
+// GetRetentionPoliciesHandler returns the configured retention policies
+func GetRetentionPoliciesHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policies, err := models.GetRetentionPolicies(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, policies)
+	}
+}
+
+// UpdateRetentionPoliciesHandler replaces the retention policies
+func UpdateRetentionPoliciesHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var policies models.RetentionPolicies
+		if err := c.ShouldBindJSON(&policies); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+		if fieldErrs := validateRetentionPolicies(&policies); len(fieldErrs) > 0 {
+			respondValidationError(c, fieldErrs)
+			return
+		}
+
+		if err := models.SaveRetentionPolicies(db, &policies); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, policies)
+	}
+}
+
+// PreviewRetentionHandler reports what the retention policies would remove
+// without changing anything. A request body previews those policies instead
+// of the stored ones, so changes can be checked before saving them.
+func PreviewRetentionHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policies, err := models.GetRetentionPolicies(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(policies); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+				return
+			}
+			if fieldErrs := validateRetentionPolicies(policies); len(fieldErrs) > 0 {
+				respondValidationError(c, fieldErrs)
+				return
+			}
+		}
+
+		report, err := models.RunRetention(c.Request.Context(), db, policies, true)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// RunRetentionHandler applies the stored retention policies now
+func RunRetentionHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policies, err := models.GetRetentionPolicies(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		report, err := models.RunRetention(c.Request.Context(), db, policies, false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"vessel-backend/internal/models"
+)
+
+func TestScheduledRetentionSkippedInMaintenance(t *testing.T) {
+	db := openTestDB(t)
+	chat := &models.Chat{Title: "old", Model: "llama3"}
+	if err := models.CreateChat(db, chat); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().UTC().AddDate(0, 0, -30).Format(time.RFC3339)
+	if _, err := db.Exec(`UPDATE chats SET updated_at = ? WHERE id = ?`, old, chat.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.SaveRetentionPolicies(db, &models.RetentionPolicies{ArchiveChatsAfterDays: 7}); err != nil {
+		t.Fatal(err)
+	}
+	archived := func() bool {
+		t.Helper()
+		got, err := models.GetChat(db, chat.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got.Archived
+	}
+
+	gate := &maintenanceGate{}
+	gate.set(models.MaintenanceMode{Enabled: true})
+	t.Cleanup(func() { setMaintenanceActive(false) })
+
+	runScheduledRetention(context.Background(), db)
+	if archived() {
+		t.Fatal("scheduled retention archived a chat in maintenance mode")
+	}
+
+	gate.set(models.MaintenanceMode{})
+	runScheduledRetention(context.Background(), db)
+	if !archived() {
+		t.Fatal("scheduled retention didn't archive the chat after maintenance mode ended")
+	}
+}
+
+func TestWaitOutMaintenance(t *testing.T) {
+	setMaintenanceActive(true)
+	t.Cleanup(func() { setMaintenanceActive(false) })
+
+	done := make(chan error, 1)
+	go func() { done <- waitOutMaintenance(context.Background()) }()
+	select {
+	case <-done:
+		t.Fatal("waitOutMaintenance returned while maintenance mode was enabled")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	setMaintenanceActive(false)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("waitOutMaintenance: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waitOutMaintenance didn't return when maintenance mode ended")
+	}
+
+	setMaintenanceActive(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := waitOutMaintenance(ctx); err != context.Canceled {
+		t.Fatalf("waitOutMaintenance with a cancelled context = %v, want context.Canceled", err)
+	}
+}
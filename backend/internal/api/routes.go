@@ -1,18 +1,66 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"log"
 
 	"github.com/gin-gonic/gin"
+
+	"vessel-backend/internal/models"
 )
 
 // SetupRoutes configures all API routes
-func SetupRoutes(r *gin.Engine, db *sql.DB, ollamaURL string, appVersion string) {
+func SetupRoutes(r *gin.Engine, db *sql.DB, cfg Config, appVersion string) {
+	// Offline mode is set first so no background job reaches the internet
+	SetOffline(cfg.Offline)
+
+	// Maintenance mode makes the API read-only during backups and migrations;
+	// it is loaded first so resumed background work waits for it too
+	maintenance := newMaintenanceGate(db)
+
+	// Downloads from external services are counted per day, and monthly
+	// caps stop new downloads once they are used up
+	bandwidth := newBandwidthMeter(db)
+	capPulls := bandwidth.Guard(models.BandwidthSourceOllamaPull)
+	capWebFetch := bandwidth.Guard(models.BandwidthSourceWebFetch)
+	capWebSearch := bandwidth.Guard(models.BandwidthSourceWebSearch)
+	capRegistry := bandwidth.Guard(models.BandwidthSourceRegistry)
+
 	// Initialize Ollama service with official client
-	ollamaService, err := NewOllamaService(ollamaURL)
+	ollamaService, err := NewOllamaService(cfg.OllamaURL, db)
 	if err != nil {
 		log.Printf("Warning: Failed to initialize Ollama service: %v", err)
+		if err := models.FailInterruptedEvalRuns(db); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+		if err := models.FailInterruptedBulkJobs(db); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	} else {
+		ollamaService.defaultModel = cfg.DefaultModel
+		ollamaService.completionCacheTTL = cfg.CompletionCacheTTL
+		ollamaService.hooks = cfg.ChatHooks
+		if err := ollamaService.setChatMiddleware(cfg.ChatMiddleware); err != nil {
+			log.Printf("Warning: %v; using the default chat middleware", err)
+		}
+		ollamaService.breaker.SetLimits(cfg.CircuitThreshold, cfg.CircuitCooldown)
+		ollamaService.jobs = newBulkRunner(cfg.JobWorkers)
+		ollamaService.StartRAGRecrawl(context.Background(), cfg.RAGRecrawlInterval)
+		ollamaService.uploadDir = cfg.UploadDir
+		ollamaService.bandwidth = bandwidth
+		ollamaService.modelsDir = cfg.OllamaModelsDir
+		ollamaService.imageMaxDimension = cfg.ImageMaxDimension
+		ollamaService.translationModel = cfg.TranslationModel
+		ollamaService.warm = newWarmPool(cfg.WarmModels, cfg.WarmVRAMBudgetMB)
+		ollamaService.StartWarmPoolIdleUnload(context.Background(), cfg.WarmIdleTimeout)
+		ollamaService.pullOnDemand = cfg.PullOnDemand
+		ollamaService.vram = newVRAMBudget(cfg.VRAMPolicy, cfg.VRAMBudgetMB)
+		ollamaService.StartBackendEvents(context.Background())
+		ollamaService.StartModelVerification(context.Background(), cfg.ModelVerifyInterval)
+		ollamaService.StartUploadWatchdog(context.Background(), cfg.UploadRetention)
+		ollamaService.ResumeEvalRuns()
+		ollamaService.ResumeBulkJobs()
 	}
 
 	// Initialize model registry service
@@ -22,6 +70,23 @@ func SetupRoutes(r *gin.Engine, db *sql.DB, ollamaURL string, appVersion string)
 	} else {
 		modelRegistry = NewModelRegistryService(db, nil)
 	}
+	modelRegistry.bandwidth = bandwidth
+	modelRegistry.StartDetailsWorker(context.Background(), cfg.RegistryDetailsInterval)
+
+	// Check the setup in the background and log what needs fixing
+	diagnostics := NewDiagnostics(db, cfg, ollamaService)
+	go diagnostics.RunAtStartup()
+
+	// Token auth; inference routes accept either token, control routes
+	// require the admin token when one is set
+	auth := NewAuthenticator(cfg.Auth)
+	control := auth.Require(ScopeControl)
+
+	// Code interpreter sandbox; off unless configured
+	codeInterpreter, err := NewCodeInterpreter(cfg.CodeInterpreter, cfg.CodeInterpreterPythonImage)
+	if err != nil {
+		log.Printf("Warning: %v; the code interpreter is disabled", err)
+	}
 
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
@@ -29,10 +94,14 @@ func SetupRoutes(r *gin.Engine, db *sql.DB, ollamaURL string, appVersion string)
 	})
 
 	// Version endpoint (for update notifications)
-	r.GET("/api/v1/version", VersionHandler(appVersion))
+	updateChannel := cfg.UpdateChannel
+	if updateChannel == "" {
+		updateChannel = UpdateChannelStable
+	}
+	r.GET("/api/v1/version", RequireOnline(), VersionHandler(appVersion, updateChannel))
 
 	// API v1 routes
-	v1 := r.Group("/api/v1")
+	v1 := r.Group("/api/v1", auth.Require(ScopeInference), maintenance.Guard())
 	{
 		// Chat routes
 		chats := v1.Group("/chats")
@@ -43,9 +112,55 @@ func SetupRoutes(r *gin.Engine, db *sql.DB, ollamaURL string, appVersion string)
 			chats.GET("/:id", GetChatHandler(db))
 			chats.PUT("/:id", UpdateChatHandler(db))
 			chats.DELETE("/:id", DeleteChatHandler(db))
+			chats.POST("/:id/duplicate", DuplicateChatHandler(db))
+			// Download chats with their messages, optionally password-protected
+			chats.POST("/export", ExportChatsHandler(db))
 
 			// Message routes (nested under chats)
+			chats.GET("/:id/messages", ListMessagesHandler(db))
 			chats.POST("/:id/messages", CreateMessageHandler(db))
+
+			// Merge a branch into the main thread, or append another chat
+			chats.POST("/:id/merge", MergeChatHandler(db))
+
+			// Translations of a chat's messages
+			chats.GET("/:id/translations", ListChatTranslationsHandler(db))
+
+			// Feedback on messages (ratings, notes and tags)
+			chats.GET("/:id/feedback", ListChatFeedbackHandler(db))
+			chats.GET("/:id/messages/:messageId/feedback", GetMessageFeedbackHandler(db))
+			chats.PUT("/:id/messages/:messageId/feedback", SetMessageFeedbackHandler(db))
+			chats.DELETE("/:id/messages/:messageId/feedback", DeleteMessageFeedbackHandler(db))
+		}
+
+		// Feedback across chats, aggregated or exported for dataset curation
+		feedback := v1.Group("/feedback")
+		{
+			feedback.GET("", ListFeedbackHandler(db))
+			feedback.GET("/summary", FeedbackSummaryHandler(db))
+			feedback.GET("/export", ExportFeedbackHandler(db))
+		}
+
+		// Project routes; chats are filed into projects via their project_id
+		projects := v1.Group("/projects")
+		{
+			projects.GET("", ListProjectsHandler(db))
+			projects.POST("", CreateProjectHandler(db))
+			projects.GET("/:id", GetProjectHandler(db))
+			projects.PUT("/:id", UpdateProjectHandler(db))
+			projects.DELETE("/:id", DeleteProjectHandler(db))
+			projects.POST("/:id/links", CreateProjectLinkHandler(db))
+			projects.DELETE("/:id/links/:linkId", DeleteProjectLinkHandler(db))
+		}
+
+		// Character cards (SillyTavern-compatible) that chats can play
+		characters := v1.Group("/characters")
+		{
+			characters.GET("", ListCharactersHandler(db))
+			characters.POST("", ImportCharacterHandler(db))
+			characters.GET("/:id", GetCharacterHandler(db))
+			characters.GET("/:id/avatar", CharacterAvatarHandler(db))
+			characters.DELETE("/:id", DeleteCharacterHandler(db))
 		}
 
 		// Sync routes
@@ -55,20 +170,142 @@ func SetupRoutes(r *gin.Engine, db *sql.DB, ollamaURL string, appVersion string)
 			sync.GET("/pull", PullChangesHandler(db))
 		}
 
+		// Settings snapshots attached to messages and comparison results
+		snapshots := v1.Group("/snapshots")
+		{
+			snapshots.GET("/diff", DiffSettingsSnapshotsHandler(db))
+			snapshots.GET("/:hash", GetSettingsSnapshotHandler(db))
+		}
+
+		// Eval suites and run history
+		evals := v1.Group("/evals")
+		{
+			evals.GET("/suites", ListEvalSuitesHandler(db))
+			evals.POST("/suites", CreateEvalSuiteHandler(db))
+			evals.GET("/suites/:id", GetEvalSuiteHandler(db))
+			evals.PUT("/suites/:id", UpdateEvalSuiteHandler(db))
+			evals.DELETE("/suites/:id", DeleteEvalSuiteHandler(db))
+			evals.GET("/runs", ListEvalRunsHandler(db))
+			evals.GET("/runs/:id", GetEvalRunHandler(db))
+		}
+
+		// RAG collections; ingestion and queries need Ollama for embeddings
+		rag := v1.Group("/rag")
+		{
+			rag.GET("/collections", ListRAGCollectionsHandler(db))
+			rag.POST("/collections", CreateRAGCollectionHandler(db))
+			rag.GET("/collections/:id", GetRAGCollectionHandler(db))
+			rag.PUT("/collections/:id", UpdateRAGCollectionHandler(db))
+			rag.DELETE("/collections/:id", DeleteRAGCollectionHandler(db))
+			rag.DELETE("/collections/:id/documents/:docId", DeleteDocumentHandler(db))
+			rag.GET("/collections/:id/uploads", ListRAGUploadsHandler(db))
+			rag.GET("/collections/:id/uploads/:uploadId", GetRAGUploadHandler(db))
+		}
+
+		// Global inference defaults, applied beneath per-chat and per-request settings
+		v1.GET("/defaults", GetDefaultsHandler(db))
+		v1.PUT("/defaults", control, UpdateDefaultsHandler(db))
+
+		// Database maintenance
+		admin := v1.Group("/admin/db", control)
+		{
+			admin.GET("/stats", DatabaseStatsHandler(db))
+			admin.GET("/integrity", DatabaseIntegrityHandler(db))
+			admin.POST("/vacuum", DatabaseVacuumHandler(db))
+			admin.POST("/analyze", DatabaseAnalyzeHandler(db))
+		}
+
+		// Content encryption at rest
+		encryption := v1.Group("/admin/encryption", control)
+		{
+			encryption.GET("", EncryptionStatusHandler(db))
+			encryption.POST("/rotate", RotateEncryptionKeyHandler(db, cfg.Secrets))
+		}
+
+		// Daily token budgets per chat and API key
+		v1.GET("/stats/usage", TokenUsageStatsHandler(db))
+		budgets := v1.Group("/admin/budgets", control)
+		{
+			budgets.GET("", GetTokenBudgetsHandler(db))
+			budgets.PUT("", UpdateTokenBudgetsHandler(db))
+		}
+
+		// Bytes downloaded per day and source, with optional monthly caps
+		v1.GET("/stats/bandwidth", BandwidthUsageStatsHandler(db))
+		v1.GET("/admin/bandwidth-caps", control, GetBandwidthCapsHandler(db))
+		v1.PUT("/admin/bandwidth-caps", control, UpdateBandwidthCapsHandler(db))
+
+		// Maintenance mode toggle
+		v1.GET("/admin/maintenance", control, GetMaintenanceHandler(maintenance))
+		v1.PUT("/admin/maintenance", control, UpdateMaintenanceHandler(db, maintenance))
+
+		// Environment report for bug reports (secrets redacted)
+		v1.GET("/system/report", control, SystemReportHandler(db, cfg, appVersion, ollamaService))
+
+		// Setup problems found at startup, with how to fix them
+		v1.GET("/diagnostics", control, diagnostics.Handler())
+
+		// Retention policies enforced by a scheduled job, with dry-run previews
+		retention := v1.Group("/admin/retention", control)
+		{
+			retention.GET("", GetRetentionPoliciesHandler(db))
+			retention.PUT("", UpdateRetentionPoliciesHandler(db))
+			retention.POST("/preview", PreviewRetentionHandler(db))
+			retention.POST("/run", RunRetentionHandler(db))
+		}
+
+		// Completion cache for deterministic chat requests
+		v1.DELETE("/admin/cache", control, ClearCompletionCacheHandler(db))
+
+		// Secrets (values are never returned, only masked)
+		if cfg.Secrets != nil {
+			secretsGroup := v1.Group("/admin/secrets", control)
+			{
+				secretsGroup.GET("", ListSecretsHandler(cfg.Secrets))
+				secretsGroup.PUT("/:name", SetSecretHandler(cfg.Secrets))
+				secretsGroup.DELETE("/:name", DeleteSecretHandler(cfg.Secrets))
+			}
+		}
+
 		// URL fetch proxy (for tools that need to fetch external URLs)
 		// Uses curl/wget when available, falls back to native Go HTTP client
-		v1.POST("/proxy/fetch", URLFetchProxyHandler())
+		v1.POST("/proxy/fetch", RequireOnline(), capWebFetch, URLFetchProxyHandler(bandwidth))
 		v1.GET("/proxy/fetch-method", GetFetchMethodHandler())
 
 		// Web search proxy (for web_search tool)
-		v1.POST("/proxy/search", WebSearchProxyHandler())
+		v1.POST("/proxy/search", RequireOnline(), capWebSearch, WebSearchProxyHandler(bandwidth))
 
 		// IP-based geolocation (fallback when browser geolocation fails)
-		v1.GET("/location", IPGeolocationHandler())
+		v1.GET("/location", RequireOnline(), IPGeolocationHandler())
 
 		// Tool execution (for Python tools)
 		v1.POST("/tools/execute", ExecuteToolHandler())
 
+		// Sandboxed code interpreter; off unless enabled on the server and
+		// granted to the agent calling it
+		v1.GET("/tools/code-interpreter", CodeInterpreterInfoHandler(codeInterpreter))
+		v1.POST("/tools/code-interpreter/run", RunCodeHandler(db, codeInterpreter))
+		agentTools := v1.Group("/agents/:agentId/tools")
+		{
+			agentTools.GET("", ListAgentToolsHandler(db))
+			agentTools.PUT("/:tool", control, GrantAgentToolHandler(db))
+			agentTools.DELETE("/:tool", control, RevokeAgentToolHandler(db))
+		}
+
+		// Filesystem tools, confined to the directories given to each agent;
+		// every call is audited
+		v1.GET("/tools/filesystem", FilesystemToolsHandler(db))
+		v1.POST("/tools/filesystem/list", ListDirectoryHandler(db))
+		v1.POST("/tools/filesystem/read", ReadFileHandler(db))
+		v1.POST("/tools/filesystem/write", WriteFileHandler(db))
+		agentDirs := v1.Group("/agents/:agentId/directories")
+		{
+			agentDirs.GET("", ListAgentDirectoriesHandler(db))
+			agentDirs.POST("", control, AddAgentDirectoryHandler(db))
+			agentDirs.DELETE("/:dirId", control, RemoveAgentDirectoryHandler(db))
+		}
+		v1.GET("/admin/filesystem-audit", control, ListFilesystemAuditHandler(db))
+
 		// Model registry routes (cached models from ollama.com)
 		models := v1.Group("/models")
 		{
@@ -79,6 +316,10 @@ func SetupRoutes(r *gin.Engine, db *sql.DB, ollamaURL string, appVersion string)
 			models.GET("/local/families", modelRegistry.GetLocalFamiliesHandler())
 			// Check for available updates (compares local vs remote registry)
 			models.GET("/local/updates", modelRegistry.CheckUpdatesHandler())
+			// Suggest models unused for a while that could be deleted to free space
+			models.GET("/local/cleanup", modelRegistry.CleanupSuggestionsHandler())
+			// Set display name, tags and notes for an installed model
+			models.PATCH("/local/*name", modelRegistry.UpdateModelMetadataHandler())
 
 			// === Remote Models (from ollama.com cache) ===
 			// List/search remote models (from cache)
@@ -89,10 +330,12 @@ func SetupRoutes(r *gin.Engine, db *sql.DB, ollamaURL string, appVersion string)
 			models.GET("/remote/:slug", modelRegistry.GetRemoteModelHandler())
 			// Fetch detailed info from Ollama (requires model to be pulled)
 			models.POST("/remote/:slug/details", modelRegistry.FetchModelDetailsHandler())
+			// Fetch details now instead of waiting for the background worker
+			models.POST("/remote/:slug/refresh", RequireOnline(), capRegistry, modelRegistry.RefreshModelDetailsHandler())
 			// Fetch tag sizes from ollama.com (scrapes model detail page)
-			models.POST("/remote/:slug/sizes", modelRegistry.FetchTagSizesHandler())
+			models.POST("/remote/:slug/sizes", RequireOnline(), capRegistry, modelRegistry.FetchTagSizesHandler())
 			// Sync models from ollama.com
-			models.POST("/remote/sync", modelRegistry.SyncModelsHandler())
+			models.POST("/remote/sync", control, RequireOnline(), capRegistry, modelRegistry.SyncModelsHandler())
 			// Get sync status
 			models.GET("/remote/status", modelRegistry.SyncStatusHandler())
 		}
@@ -104,10 +347,15 @@ func SetupRoutes(r *gin.Engine, db *sql.DB, ollamaURL string, appVersion string)
 				// Model management
 				ollama.GET("/api/tags", ollamaService.ListModelsHandler())
 				ollama.POST("/api/show", ollamaService.ShowModelHandler())
-				ollama.POST("/api/pull", ollamaService.PullModelHandler())
-				ollama.POST("/api/create", ollamaService.CreateModelHandler())
-				ollama.DELETE("/api/delete", ollamaService.DeleteModelHandler())
-				ollama.POST("/api/copy", ollamaService.CopyModelHandler())
+				ollama.POST("/api/pull", control, RequireOnline(), capPulls, ollamaService.PullModelHandler())
+				// Pull several models as one unit with combined progress
+				ollama.POST("/pulls", control, RequireOnline(), capPulls, ollamaService.GroupPullHandler())
+				// Replace the files of a model quarantined by verification
+				ollama.POST("/redownload", control, RequireOnline(), capPulls, ollamaService.RedownloadModelHandler())
+				ollama.POST("/api/create", control, ollamaService.CreateModelHandler())
+				ollama.DELETE("/api/delete", control, ollamaService.DeleteModelHandler())
+				ollama.POST("/api/copy", control, ollamaService.CopyModelHandler())
+				ollama.GET("/api/ps", ollamaService.ListRunningHandler())
 
 				// Chat and generation
 				ollama.POST("/api/chat", ollamaService.ChatHandler())
@@ -121,9 +369,102 @@ func SetupRoutes(r *gin.Engine, db *sql.DB, ollamaURL string, appVersion string)
 				ollama.GET("/api/version", ollamaService.VersionHandler())
 				ollama.GET("/", ollamaService.HeartbeatHandler())
 			}
+
+			// Model licenses: restrictive ones must be accepted before first use
+			licenses := v1.Group("/models/licenses")
+			{
+				licenses.GET("", ollamaService.ListModelLicensesHandler())
+				licenses.GET("/lookup", ollamaService.GetModelLicenseHandler())
+				licenses.POST("/accept", control, ollamaService.AcceptLicenseHandler())
+				licenses.GET("/acceptances", ListLicenseAcceptancesHandler(db))
+			}
+
+			// Backend runtime control
+			backends := v1.Group("/backends", control)
+			{
+				backends.GET("", ollamaService.ListBackendsHandler())
+				backends.GET("/ollama", ollamaService.BackendInfoHandler())
+				// GET /backends/ollama/events streams state changes as SSE
+				backends.GET("/ollama/events", ollamaService.BackendEventsHandler())
+				// GET /backends/ollama/vram shows who holds the GPU's memory
+				backends.GET("/ollama/vram", ollamaService.VRAMStatusHandler())
+				// POST /backends/ollama/validate checks a URL and token before they are used
+				backends.POST("/ollama/validate", ollamaService.ValidateBackendHandler())
+				// POST /backends/ollama/models/:name/unload frees the model's VRAM
+				backends.POST("/ollama/models/*path", ollamaService.UnloadModelHandler())
+			}
+
+			// Chat pipeline routes
+			chat := v1.Group("/chat")
+			{
+				// Dry-run: render the prompt without running inference
+				chat.POST("/preview", ollamaService.ChatPreviewHandler())
+			}
+
+			// Resume or cancel buffered streaming generations
+			generations := v1.Group("/generations")
+			{
+				generations.GET("/:id", ollamaService.GetGenerationHandler())
+				generations.DELETE("/:id", ollamaService.CancelGenerationHandler())
+			}
+
+			// Run one prompt against several models side by side
+			v1.POST("/compare", ollamaService.CompareHandler())
+
+			// Move a chat to a different model (checks the model is available first)
+			v1.POST("/chats/:id/migrate", ollamaService.MigrateChatModelHandler())
+
+			// The resolved model parameters a chat's next message would use
+			v1.GET("/chats/:id/effective-config", ollamaService.EffectiveConfigHandler())
+
+			// Rerun a stored reply with its recorded settings and seed
+			v1.POST("/chats/:id/messages/:messageId/reproduce", ollamaService.ReproduceMessageHandler())
+
+			// Translate stored messages; the translations are kept beside them
+			v1.POST("/chats/:id/messages/:messageId/translate", ollamaService.TranslateMessageHandler())
+
+			// Run eval suites in the background, one run at a time
+			v1.POST("/evals/suites/:id/runs", ollamaService.StartEvalRunHandler())
+			v1.POST("/evals/runs/:id/cancel", ollamaService.CancelEvalRunHandler())
+
+			// Ingest documents into RAG collections and search them
+			v1.POST("/rag/collections/:id/documents", ollamaService.IngestDocumentHandler())
+			v1.POST("/rag/collections/:id/documents/:docId/refresh", ollamaService.RefreshDocumentHandler())
+			v1.POST("/rag/query", ollamaService.RAGQueryHandler())
+
+			// Upload files to RAG collections and follow their ingestion
+			v1.POST("/rag/collections/:id/uploads", ollamaService.UploadDocumentHandler())
+			v1.GET("/rag/collections/:id/uploads/:uploadId/events", ollamaService.UploadEventsHandler())
+			v1.POST("/rag/collections/:id/uploads/:uploadId/cancel", ollamaService.CancelUploadHandler())
+			v1.POST("/rag/collections/:id/uploads/:uploadId/resume", ollamaService.ResumeUploadHandler())
+			v1.DELETE("/rag/collections/:id/uploads/:uploadId", ollamaService.DeleteUploadHandler())
+
+			// Bulk operations run as background jobs; follow them at
+			// /jobs/:id or /jobs/:id/events instead of looping requests
+			jobs := v1.Group("/jobs")
+			{
+				jobs.GET("", ListBulkJobsHandler(db))
+				jobs.GET("/:id", ollamaService.GetBulkJobHandler())
+				jobs.GET("/:id/events", ollamaService.BulkJobEventsHandler())
+				jobs.POST("/:id/cancel", ollamaService.CancelBulkJobHandler())
+				jobs.POST("/:id/retry", ollamaService.RetryBulkJobHandler())
+				jobs.POST("/chats/delete", ollamaService.DeleteChatsJobHandler())
+				jobs.POST("/chats/archive", ollamaService.ArchiveChatsJobHandler())
+				jobs.POST("/chats/:id/translate", ollamaService.TranslateChatJobHandler())
+				jobs.POST("/rag/collections/:id/reembed", ollamaService.ReembedCollectionJobHandler())
+				jobs.POST("/models/verify", control, ollamaService.VerifyModelsJobHandler())
+				jobs.POST("/models/pull", control, RequireOnline(), capPulls, ollamaService.PullModelsJobHandler())
+			}
+
+			// Turn chats into instruction-tuning datasets
+			v1.POST("/datasets/export", ollamaService.ExportDatasetHandler())
+
+			// Move collections with their embeddings between instances
+			v1.GET("/rag/collections/:id/export", ollamaService.ExportRAGCollectionHandler())
+			v1.POST("/rag/collections/import", ollamaService.ImportRAGCollectionHandler())
 		}
 
 		// Fallback proxy for direct Ollama access (separate path to avoid conflicts)
-		v1.Any("/ollama-proxy/*path", OllamaProxyHandler(ollamaURL))
+		v1.Any("/ollama-proxy/*path", requireControlForOllamaWrites(control), OllamaProxyHandler(cfg.OllamaURL))
 	}
 }
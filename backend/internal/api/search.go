@@ -9,6 +9,8 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"vessel-backend/internal/models"
 )
 
 // SearchRequest represents a web search request
@@ -30,7 +32,7 @@ type SearchResult struct {
 
 // WebSearchProxyHandler returns a handler that performs web searches via DuckDuckGo
 // Uses curl/wget when available for better compatibility
-func WebSearchProxyHandler() gin.HandlerFunc {
+func WebSearchProxyHandler(bandwidth *bandwidthMeter) gin.HandlerFunc {
 	fetcher := GetFetcher()
 
 	return func(c *gin.Context) {
@@ -98,6 +100,7 @@ func WebSearchProxyHandler() gin.HandlerFunc {
 			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to perform search: " + err.Error()})
 			return
 		}
+		bandwidth.record(models.BandwidthSourceWebSearch, fetchedBytes(result))
 
 		// Check status
 		if result.StatusCode >= 400 {
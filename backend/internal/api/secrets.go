@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"vessel-backend/internal/secrets"
+)
+
+// SecretStatus describes a known secret without revealing its value
+type SecretStatus struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	EnvVar      string `json:"env_var,omitempty"`
+	Set         bool   `json:"set"`
+	Source      string `json:"source,omitempty"`
+	Masked      string `json:"masked,omitempty"`
+}
+
+// SetSecretRequest is the request body for storing a secret
+type SetSecretRequest struct {
+	Value string `json:"value" binding:"required"`
+}
+
+// ListSecretsHandler lists known secrets with masked values
+func ListSecretsHandler(store secrets.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		statuses := make([]SecretStatus, 0, len(secrets.Known))
+		for _, s := range secrets.Known {
+			value, source, err := secrets.Resolve(store, s.Name)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			statuses = append(statuses, SecretStatus{
+				Name:        s.Name,
+				Description: s.Description,
+				EnvVar:      s.EnvVar,
+				Set:         value != "",
+				Source:      string(source),
+				Masked:      secrets.Mask(value),
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"backend": store.Backend(),
+			"secrets": statuses,
+		})
+	}
+}
+
+// SetSecretHandler stores a secret. Values from environment variables still
+// take precedence, and changes apply on the next restart.
+func SetSecretHandler(store secrets.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		if _, ok := secrets.Lookup(name); !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown secret: " + name})
+			return
+		}
+
+		var req SetSecretRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "value is required"})
+			return
+		}
+
+		if err := store.Set(name, req.Value); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"name": name, "masked": secrets.Mask(req.Value)})
+	}
+}
+
+// DeleteSecretHandler removes a stored secret
+func DeleteSecretHandler(store secrets.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		if _, ok := secrets.Lookup(name); !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown secret: " + name})
+			return
+		}
+
+		if err := store.Delete(name); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "secret deleted"})
+	}
+}
@@ -0,0 +1,337 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/models"
+)
+
+// GenerationSeedHeader carries the sampling seed a chat response was
+// generated with, so clients can attach it to saved messages
+const GenerationSeedHeader = "X-Generation-Seed"
+
+// maxDiffTokens bounds the token count of texts diffed word by word; longer
+// texts are reported as a single replacement
+const maxDiffTokens = 4000
+
+// seedMiddleware gives every chat a sampling seed. Requests that set none
+// get a random one, so any generation can be rerun with the same sampling.
+type seedMiddleware struct {
+	ChatMiddlewareBase
+}
+
+func (seedMiddleware) Name() string { return "seed" }
+
+func (seedMiddleware) PrepareChat(_ context.Context, req *ChatPipelineRequest) error {
+	if _, present, _ := optionFloat(req.Options, "seed"); present {
+		return nil
+	}
+	opts := make(map[string]any, len(req.Options)+1)
+	for k, v := range req.Options {
+		opts[k] = v
+	}
+	opts["seed"] = rand.IntN(math.MaxInt32)
+	req.Options = opts
+	req.generatedSeed = true
+	req.setSource("options.seed", ConfigSourceGenerated)
+	return nil
+}
+
+// requestSeed returns the seed a request is sampled with, if any
+func requestSeed(opts map[string]any) *int64 {
+	seed, present, ok := optionFloat(opts, "seed")
+	if !present || !ok {
+		return nil
+	}
+	v := int64(seed)
+	return &v
+}
+
+// withoutSeed returns a copy of opts without the seed. Generated seeds are
+// kept out of settings snapshots, which would otherwise all differ.
+func withoutSeed(opts map[string]any) map[string]any {
+	out := make(map[string]any, len(opts))
+	for k, v := range opts {
+		if k != "seed" {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Reproduction verdicts
+const (
+	// ReproductionIdentical: the rerun produced the same reply
+	ReproductionIdentical = "identical"
+	// ReproductionSettingsChanged: the model, backend or options changed
+	// since the message was generated (see SettingsChanges)
+	ReproductionSettingsChanged = "settings_changed"
+	// ReproductionNotSeeded: the message has no recorded seed, so sampling
+	// noise alone can explain the difference
+	ReproductionNotSeeded = "not_seeded"
+	// ReproductionNondeterministic: same seed and settings, different reply;
+	// the backend isn't deterministic (e.g. GPU kernels or batching)
+	ReproductionNondeterministic = "nondeterministic"
+)
+
+// TextDiffOp is one run of a word-level diff: "equal", "delete" (only in
+// the original) or "insert" (only in the reproduction)
+type TextDiffOp struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// ReproductionReport compares a stored assistant message with a rerun of
+// the generation that produced it
+type ReproductionReport struct {
+	MessageID     string `json:"message_id"`
+	Model         string `json:"model"`
+	Seed          *int64 `json:"seed,omitempty"`
+	Verdict       string `json:"verdict"`
+	Identical     bool   `json:"identical"`
+	Original      string `json:"original"`
+	Reproduction  string `json:"reproduction"`
+	SettingsHash  string `json:"settings_hash"`
+	RerunSettings string `json:"rerun_settings_hash,omitempty"`
+	// SettingsChanges lists what differs between the recorded settings and
+	// the rerun's (model, backend version, options)
+	SettingsChanges []models.SettingsChange `json:"settings_changes"`
+	Diff            []TextDiffOp            `json:"diff"`
+	Timings         *ChatTimings            `json:"timings,omitempty"`
+}
+
+// ReproduceMessageHandler reruns the generation of a stored assistant
+// message with the same history, model, options and seed, and reports how
+// the new reply differs and whether the settings drifted since
+func (s *OllamaService) ReproduceMessageHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.db == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not available"})
+			return
+		}
+		ctx := c.Request.Context()
+
+		msg, history, err := models.GetMessageHistory(s.db, c.Param("id"), c.Param("messageId"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if msg == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+			return
+		}
+		if msg.Role != "assistant" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only assistant messages can be reproduced"})
+			return
+		}
+		if msg.SettingsHash == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "message has no recorded settings, so it can't be reproduced"})
+			return
+		}
+		snapshot, err := models.GetSettingsSnapshot(s.db, *msg.SettingsHash)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if snapshot == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "the message's settings snapshot no longer exists"})
+			return
+		}
+
+		req, err := reproductionRequest(snapshot, history)
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "recorded settings can't be replayed: " + err.Error()})
+			return
+		}
+		if err := s.ensureModelAvailable(ctx, req.Model); err != nil {
+			var unavailable *ModelUnavailableError
+			if errors.As(err, &unavailable) {
+				respondModelUnavailable(c, unavailable)
+				return
+			}
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+
+		report := ReproductionReport{
+			MessageID:       msg.ID,
+			Model:           req.Model,
+			Original:        msg.Content,
+			SettingsHash:    snapshot.Hash,
+			SettingsChanges: []models.SettingsChange{},
+		}
+
+		// Snapshot the rerun before the seed is added, as the original was
+		if hash, err := s.snapshotSettings(ctx, req); err == nil {
+			report.RerunSettings = hash
+			if rerun, err := models.GetSettingsSnapshot(s.db, hash); err == nil && rerun != nil {
+				if changes, err := models.DiffSettingsSnapshots(snapshot, rerun); err == nil {
+					report.SettingsChanges = changes
+				}
+			}
+		}
+
+		report.Seed = msg.Seed
+		if report.Seed == nil {
+			report.Seed = requestSeed(req.Options)
+		}
+		if report.Seed != nil {
+			opts := withoutSeed(req.Options)
+			opts["seed"] = *report.Seed
+			req.Options = opts
+		}
+
+		var final api.ChatResponse
+		timer := newChatTimer()
+		err = s.client.Chat(ctx, req, func(resp api.ChatResponse) error {
+			timer.observe(resp)
+			final = resp
+			return nil
+		})
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "chat failed: " + err.Error()})
+			return
+		}
+		report.Reproduction = final.Message.Content
+		report.Timings = timer.timings(final.Metrics)
+
+		report.Identical = report.Reproduction == report.Original
+		report.Diff = diffWords(report.Original, report.Reproduction)
+		switch {
+		case report.Identical:
+			report.Verdict = ReproductionIdentical
+		case len(report.SettingsChanges) > 0:
+			report.Verdict = ReproductionSettingsChanged
+		case report.Seed == nil:
+			report.Verdict = ReproductionNotSeeded
+		default:
+			report.Verdict = ReproductionNondeterministic
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// reproductionRequest rebuilds a non-streaming chat request from a settings
+// snapshot and the messages that preceded the reproduced one
+func reproductionRequest(snapshot *models.SettingsSnapshot, history []models.Message) (*api.ChatRequest, error) {
+	var settings effectiveSettings
+	if err := json.Unmarshal(snapshot.Data, &settings); err != nil {
+		return nil, err
+	}
+
+	stream := false
+	req := &api.ChatRequest{
+		Model:    settings.Model,
+		Options:  settings.Options,
+		Stream:   &stream,
+		Messages: make([]api.Message, 0, len(history)),
+	}
+	for _, m := range history {
+		req.Messages = append(req.Messages, api.Message{Role: m.Role, Content: m.Content})
+	}
+	if settings.KeepAlive != "" {
+		d, err := parseKeepAlive(settings.KeepAlive)
+		if err != nil {
+			return nil, err
+		}
+		req.KeepAlive = d
+	}
+	if settings.Think != nil {
+		req.Think = &api.ThinkValue{Value: settings.Think}
+	}
+	if settings.Format != nil {
+		format, err := json.Marshal(settings.Format)
+		if err != nil {
+			return nil, err
+		}
+		req.Format = format
+	}
+	return req, nil
+}
+
+// diffTokens splits text into words and the whitespace between them
+var diffTokens = regexp.MustCompile(`\s+|[^\s]+`)
+
+// diffWords returns a word-level diff turning a into b
+func diffWords(a, b string) []TextDiffOp {
+	x, y := diffTokens.FindAllString(a, -1), diffTokens.FindAllString(b, -1)
+	if len(x) > maxDiffTokens || len(y) > maxDiffTokens {
+		ops := []TextDiffOp{}
+		if a != b {
+			ops = appendDiffOp(ops, "delete", a)
+			ops = appendDiffOp(ops, "insert", b)
+		} else {
+			ops = appendDiffOp(ops, "equal", a)
+		}
+		return ops
+	}
+
+	// Longest common subsequence table, filled from the end
+	n, m := len(x), len(y)
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := []TextDiffOp{}
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case x[i] == y[j]:
+			ops = appendDiffOp(ops, "equal", x[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = appendDiffOp(ops, "delete", x[i])
+			i++
+		default:
+			ops = appendDiffOp(ops, "insert", y[j])
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = appendDiffOp(ops, "delete", x[i])
+	}
+	for ; j < m; j++ {
+		ops = appendDiffOp(ops, "insert", y[j])
+	}
+	return ops
+}
+
+// appendDiffOp adds text to the diff, merging it into the last run when
+// that has the same op
+func appendDiffOp(ops []TextDiffOp, op, text string) []TextDiffOp {
+	if text == "" {
+		return ops
+	}
+	if last := len(ops) - 1; last >= 0 && ops[last].Op == op {
+		ops[last].Text += text
+		return ops
+	}
+	return append(ops, TextDiffOp{Op: op, Text: text})
+}
+
+// formatSeed formats a seed for the GenerationSeedHeader
+func formatSeed(seed int64) string {
+	return strconv.FormatInt(seed, 10)
+}
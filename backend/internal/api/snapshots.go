@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/models"
+)
+
+// SettingsSnapshotHeader carries the hash of the effective settings a chat
+// response was generated with, so clients can attach it to saved messages
+const SettingsSnapshotHeader = "X-Settings-Snapshot"
+
+// effectiveSettings describes everything that shapes a generation result
+type effectiveSettings struct {
+	Backend        string         `json:"backend"`
+	BackendVersion string         `json:"backend_version,omitempty"`
+	Model          string         `json:"model"`
+	Options        map[string]any `json:"options,omitempty"`
+	KeepAlive      string         `json:"keep_alive,omitempty"`
+	Think          any            `json:"think,omitempty"`
+	Format         any            `json:"format,omitempty"`
+}
+
+// snapshotSettings records the effective settings for a chat request and
+// returns the snapshot hash
+func (s *OllamaService) snapshotSettings(ctx context.Context, req *api.ChatRequest) (string, error) {
+	settings := effectiveSettings{
+		Backend: "ollama",
+		Model:   req.Model,
+		Options: req.Options,
+	}
+	if version, err := s.client.Version(ctx); err == nil {
+		settings.BackendVersion = version
+	}
+	if req.KeepAlive != nil {
+		settings.KeepAlive = req.KeepAlive.String()
+	}
+	if req.Think != nil {
+		settings.Think = req.Think.Value
+	}
+	if len(req.Format) > 0 {
+		settings.Format = req.Format
+	}
+
+	snapshot, err := models.SaveSettingsSnapshot(s.db, settings)
+	if err != nil {
+		return "", err
+	}
+	return snapshot.Hash, nil
+}
+
+// GetSettingsSnapshotHandler returns a stored settings snapshot
+func GetSettingsSnapshotHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		snapshot, err := models.GetSettingsSnapshot(db, c.Param("hash"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if snapshot == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "snapshot not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, snapshot)
+	}
+}
+
+// DiffSettingsSnapshotsHandler lists the settings that differ between the
+// snapshots given by the "from" and "to" query parameters
+func DiffSettingsSnapshotsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fromHash, toHash := c.Query("from"), c.Query("to")
+		if fromHash == "" || toHash == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from and to are required"})
+			return
+		}
+
+		from, err := models.GetSettingsSnapshot(db, fromHash)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		to, err := models.GetSettingsSnapshot(db, toHash)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if from == nil || to == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "snapshot not found"})
+			return
+		}
+
+		changes, err := models.DiffSettingsSnapshots(from, to)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"from":    from.Hash,
+			"to":      to.Hash,
+			"changes": changes,
+		})
+	}
+}
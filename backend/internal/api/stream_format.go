@@ -0,0 +1,127 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Wire formats of streamed chat responses
+const (
+	// StreamFormatOllama streams Ollama's own chat responses, extended with
+	// timings and the effective config (the default)
+	StreamFormatOllama = "ollama"
+	// StreamFormatDelta streams compact StreamEvents numbered by seq and
+	// closed by an end event, so clients can detect dropped events
+	StreamFormatDelta = "delta"
+)
+
+// StreamFormatHeader names the format a stream is sent in
+const StreamFormatHeader = "X-Stream-Format"
+
+// Delta stream event types
+const (
+	// StreamEventDelta carries new content, thinking or tool calls
+	StreamEventDelta = "delta"
+	// StreamEventDone is the backend's final response, with the metrics,
+	// timings and effective config
+	StreamEventDone = "done"
+	// StreamEventReplace replaces everything streamed so far with Message,
+	// after a policy hook or a JSON repair changed the reply
+	StreamEventReplace = "replace"
+	// StreamEventError reports that the generation failed
+	StreamEventError = "error"
+	// StreamEventEnd is always the last event; it isn't numbered among the
+	// buffered events, so its seq is the number of events before it
+	StreamEventEnd = "end"
+)
+
+// StreamEvent is an event of a delta stream. Seq numbers the events from 0
+// without gaps; a stream cut short can be resumed from /generations/:id
+// with ?offset= set to the next seq.
+type StreamEvent struct {
+	Seq       int            `json:"seq"`
+	Type      string         `json:"type"`
+	Content   string         `json:"content,omitempty"`
+	Thinking  string         `json:"thinking,omitempty"`
+	ToolCalls []api.ToolCall `json:"tool_calls,omitempty"`
+
+	// Done fields
+	DoneReason string           `json:"done_reason,omitempty"`
+	Metrics    *api.Metrics     `json:"metrics,omitempty"`
+	Timings    *ChatTimings     `json:"timings,omitempty"`
+	Config     *EffectiveConfig `json:"config,omitempty"`
+
+	// Replace and error fields
+	Message    *api.Message    `json:"message,omitempty"`
+	Policy     json.RawMessage `json:"policy,omitempty"`
+	JSONRepair json.RawMessage `json:"json_repair,omitempty"`
+	Error      string          `json:"error,omitempty"`
+
+	// End fields: the size and SHA-256 of the final content, to check
+	// the deltas (and replacements) were assembled correctly
+	ContentLength int    `json:"content_length,omitempty"`
+	ContentSHA256 string `json:"content_sha256,omitempty"`
+	MessageID     string `json:"message_id,omitempty"`
+}
+
+// validStreamFormat reports whether format names a stream format; empty
+// means StreamFormatOllama
+func validStreamFormat(format string) bool {
+	return format == "" || format == StreamFormatOllama || format == StreamFormatDelta
+}
+
+// deltaEvent converts a buffered generation event to a delta stream event
+func deltaEvent(seq int, data []byte) []byte {
+	var raw struct {
+		TimedChatResponse
+		Error      string          `json:"error"`
+		Policy     json.RawMessage `json:"policy"`
+		JSONRepair json.RawMessage `json:"json_repair"`
+	}
+	event := StreamEvent{Seq: seq, Type: StreamEventDelta}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		event.Type, event.Error = StreamEventError, "unreadable event: "+err.Error()
+	}
+
+	switch {
+	case raw.Error != "":
+		event.Type, event.Error, event.Policy = StreamEventError, raw.Error, raw.Policy
+	case len(raw.Policy) > 0:
+		var result HookResult
+		json.Unmarshal(raw.Policy, &result)
+		event.Type, event.Policy, event.Message = StreamEventReplace, raw.Policy, result.Response
+	case len(raw.JSONRepair) > 0:
+		message := raw.Message
+		event.Type, event.JSONRepair, event.Message = StreamEventReplace, raw.JSONRepair, &message
+	default:
+		event.Content = raw.Message.Content
+		event.Thinking = raw.Message.Thinking
+		event.ToolCalls = raw.Message.ToolCalls
+		if raw.Done {
+			metrics := raw.Metrics
+			event.Type, event.DoneReason, event.Metrics = StreamEventDone, raw.DoneReason, &metrics
+			event.Timings, event.Config = raw.Timings, raw.Config
+		}
+	}
+
+	out, _ := json.Marshal(event)
+	return out
+}
+
+// deltaEndEvent is the last event of a delta stream, summarizing the
+// finished generation
+func deltaEndEvent(status GenerationStatus) []byte {
+	sum := sha256.Sum256([]byte(status.Content))
+	out, _ := json.Marshal(StreamEvent{
+		Seq:           status.Events,
+		Type:          StreamEventEnd,
+		Error:         status.Error,
+		ContentLength: len(status.Content),
+		ContentSHA256: hex.EncodeToString(sum[:]),
+		MessageID:     status.MessageID,
+	})
+	return out
+}
@@ -0,0 +1,15 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"vessel-backend/internal/i18n"
+)
+
+// suggest renders a recovery suggestion for an error response in the
+// language negotiated from the request's Accept-Language header
+func suggest(c *gin.Context, key i18n.Key, args ...any) string {
+	lang := i18n.Negotiate(c.GetHeader("Accept-Language"))
+	c.Header("Content-Language", lang)
+	return i18n.T(lang, key, args...)
+}
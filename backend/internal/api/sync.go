@@ -32,6 +32,13 @@ func PushChangesHandler(db *sql.DB) gin.HandlerFunc {
 		}
 		defer tx.Rollback()
 
+		// Pushed messages may arrive before their parents; check foreign keys
+		// at commit instead of per statement
+		if _, err := tx.Exec("PRAGMA defer_foreign_keys = ON"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start transaction"})
+			return
+		}
+
 		// Process chats
 		for _, chat := range req.Chats {
 			// Check if chat exists
@@ -65,16 +72,22 @@ func PushChangesHandler(db *sql.DB) gin.HandlerFunc {
 
 		// Process messages
 		for _, msg := range req.Messages {
+			content, err := models.EncryptContent(msg.Content)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sync message: " + err.Error()})
+				return
+			}
+
 			// Check if message exists
 			var existingVersion int64
-			err := tx.QueryRow("SELECT sync_version FROM messages WHERE id = ?", msg.ID).Scan(&existingVersion)
+			err = tx.QueryRow("SELECT sync_version FROM messages WHERE id = ?", msg.ID).Scan(&existingVersion)
 
 			if err == sql.ErrNoRows {
 				// Insert new message
 				_, err = tx.Exec(`
 					INSERT INTO messages (id, chat_id, parent_id, role, content, sibling_index, created_at, sync_version)
 					VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-					msg.ID, msg.ChatID, msg.ParentID, msg.Role, msg.Content,
+					msg.ID, msg.ChatID, msg.ParentID, msg.Role, content,
 					msg.SiblingIndex, msg.CreatedAt, msg.SyncVersion,
 				)
 			} else if err == nil && msg.SyncVersion > existingVersion {
@@ -82,7 +95,7 @@ func PushChangesHandler(db *sql.DB) gin.HandlerFunc {
 				_, err = tx.Exec(`
 					UPDATE messages SET content = ?, sibling_index = ?, sync_version = ?
 					WHERE id = ?`,
-					msg.Content, msg.SiblingIndex, msg.SyncVersion, msg.ID,
+					content, msg.SiblingIndex, msg.SyncVersion, msg.ID,
 				)
 			}
 
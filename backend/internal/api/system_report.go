@@ -0,0 +1,257 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// systemReportTimeout bounds the probes run while building a system report
+const systemReportTimeout = 5 * time.Second
+
+// SystemReport describes the environment Vessel runs in, for bug reports
+type SystemReport struct {
+	GeneratedAt time.Time        `json:"generated_at"`
+	Vessel      VesselBuildInfo  `json:"vessel"`
+	OS          OSInfo           `json:"os"`
+	GPU         GPUInfo          `json:"gpu"`
+	Database    DatabaseInfo     `json:"database"`
+	Backends    []BackendSummary `json:"backends"`
+	Config      ConfigSummary    `json:"config"`
+}
+
+// VesselBuildInfo identifies the running build
+type VesselBuildInfo struct {
+	Version     string `json:"version"`
+	GoVersion   string `json:"go_version"`
+	VCSRevision string `json:"vcs_revision,omitempty"`
+	VCSTime     string `json:"vcs_time,omitempty"`
+	VCSModified bool   `json:"vcs_modified,omitempty"`
+}
+
+// OSInfo describes the host operating system
+type OSInfo struct {
+	GOOS         string `json:"goos"`
+	GOARCH       string `json:"goarch"`
+	NumCPU       int    `json:"num_cpu"`
+	Distribution string `json:"distribution,omitempty"`
+	Kernel       string `json:"kernel,omitempty"`
+	Container    bool   `json:"container"`
+}
+
+// GPUInfo holds hints about available GPUs. Detection is best effort; Ollama
+// may run on a different host than Vessel.
+type GPUInfo struct {
+	NVIDIA       []NVIDIAGPU `json:"nvidia,omitempty"`
+	NVIDIADriver string      `json:"nvidia_driver,omitempty"`
+	AMDKFD       bool        `json:"amd_kfd"`
+	Errors       []string    `json:"errors,omitempty"`
+}
+
+// NVIDIAGPU is one GPU reported by nvidia-smi
+type NVIDIAGPU struct {
+	Name          string `json:"name"`
+	DriverVersion string `json:"driver_version"`
+	MemoryTotal   string `json:"memory_total"`
+}
+
+// DatabaseInfo describes the SQLite database
+type DatabaseInfo struct {
+	SQLiteVersion string `json:"sqlite_version,omitempty"`
+	JournalMode   string `json:"journal_mode,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// BackendSummary describes a configured inference backend
+type BackendSummary struct {
+	Name         string         `json:"name"`
+	URL          string         `json:"url"`
+	DefaultModel string         `json:"default_model,omitempty"`
+	Status       *BackendStatus `json:"status,omitempty"`
+	Circuit      *CircuitStatus `json:"circuit,omitempty"`
+}
+
+// ConfigSummary lists configuration relevant to bug reports. Secret values
+// are never included, only whether they are set.
+type ConfigSummary struct {
+	APITokenSet        bool     `json:"api_token_set"`
+	AdminTokenSet      bool     `json:"admin_token_set"`
+	AuthAllowLocalhost bool     `json:"auth_allow_localhost"`
+	SecretsConfigured  bool     `json:"secrets_configured"`
+	CompletionCacheTTL string   `json:"completion_cache_ttl"`
+	ChatHooks          []string `json:"chat_hooks"`
+	CircuitThreshold   int      `json:"circuit_threshold,omitempty"`
+	CircuitCooldown    string   `json:"circuit_cooldown,omitempty"`
+	Offline            bool     `json:"offline"`
+}
+
+// SystemReportHandler returns a single JSON document describing the build,
+// host, GPUs, database, backends and configuration, with secrets redacted
+func SystemReportHandler(db *sql.DB, cfg Config, appVersion string, ollama *OllamaService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), systemReportTimeout)
+		defer cancel()
+
+		report := SystemReport{
+			GeneratedAt: time.Now().UTC(),
+			Vessel:      vesselBuildInfo(appVersion),
+			OS:          osInfo(),
+			GPU:         gpuInfo(ctx),
+			Database:    databaseInfo(ctx, db),
+			Backends:    []BackendSummary{},
+			Config:      configSummary(cfg),
+		}
+
+		backend := BackendSummary{Name: "ollama", URL: redactURL(cfg.OllamaURL), DefaultModel: cfg.DefaultModel}
+		if ollama != nil {
+			status := ollama.backendStatus(ctx)
+			circuit := ollama.breaker.Status()
+			backend.Status, backend.Circuit = &status, &circuit
+		}
+		report.Backends = append(report.Backends, backend)
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// vesselBuildInfo reads version and VCS details embedded at build time
+func vesselBuildInfo(appVersion string) VesselBuildInfo {
+	info := VesselBuildInfo{Version: appVersion, GoVersion: runtime.Version()}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.VCSRevision = setting.Value
+		case "vcs.time":
+			info.VCSTime = setting.Value
+		case "vcs.modified":
+			info.VCSModified = setting.Value == "true"
+		}
+	}
+	return info
+}
+
+// osInfo describes the host from the Go runtime and, on Linux, /etc and /proc
+func osInfo() OSInfo {
+	info := OSInfo{GOOS: runtime.GOOS, GOARCH: runtime.GOARCH, NumCPU: runtime.NumCPU()}
+
+	if kernel, err := os.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		info.Kernel = strings.TrimSpace(string(kernel))
+	}
+	if f, err := os.Open("/etc/os-release"); err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if value, ok := strings.CutPrefix(scanner.Text(), "PRETTY_NAME="); ok {
+				info.Distribution = strings.Trim(value, `"`)
+				break
+			}
+		}
+	}
+	if _, err := os.Stat("/.dockerenv"); err == nil {
+		info.Container = true
+	} else if _, err := os.Stat("/run/.containerenv"); err == nil {
+		info.Container = true
+	}
+	return info
+}
+
+// gpuInfo queries nvidia-smi when available and checks for the AMD ROCm
+// kernel driver
+func gpuInfo(ctx context.Context) GPUInfo {
+	info := GPUInfo{}
+
+	if _, err := os.Stat("/dev/kfd"); err == nil {
+		info.AMDKFD = true
+	}
+	if version, err := os.ReadFile("/proc/driver/nvidia/version"); err == nil {
+		line, _, _ := strings.Cut(string(version), "\n")
+		info.NVIDIADriver = strings.TrimSpace(line)
+	}
+
+	path, err := exec.LookPath("nvidia-smi")
+	if err != nil {
+		return info
+	}
+	out, err := exec.CommandContext(ctx, path,
+		"--query-gpu=name,driver_version,memory.total", "--format=csv,noheader").Output()
+	if err != nil {
+		info.Errors = append(info.Errors, "nvidia-smi: "+err.Error())
+		return info
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Split(line, ",")
+		if len(fields) != 3 {
+			continue
+		}
+		info.NVIDIA = append(info.NVIDIA, NVIDIAGPU{
+			Name:          strings.TrimSpace(fields[0]),
+			DriverVersion: strings.TrimSpace(fields[1]),
+			MemoryTotal:   strings.TrimSpace(fields[2]),
+		})
+	}
+	return info
+}
+
+// databaseInfo reports the SQLite version and journal mode
+func databaseInfo(ctx context.Context, db *sql.DB) DatabaseInfo {
+	info := DatabaseInfo{}
+	if err := db.QueryRowContext(ctx, `SELECT sqlite_version()`).Scan(&info.SQLiteVersion); err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	if err := db.QueryRowContext(ctx, `PRAGMA journal_mode`).Scan(&info.JournalMode); err != nil {
+		info.Error = err.Error()
+	}
+	return info
+}
+
+// configSummary describes the configuration without secret values
+func configSummary(cfg Config) ConfigSummary {
+	summary := ConfigSummary{
+		APITokenSet:        cfg.Auth.APIToken != "",
+		AdminTokenSet:      cfg.Auth.AdminToken != "",
+		AuthAllowLocalhost: cfg.Auth.AllowLocalhost,
+		SecretsConfigured:  cfg.Secrets != nil,
+		CompletionCacheTTL: cfg.CompletionCacheTTL.String(),
+		ChatHooks:          []string{},
+		CircuitThreshold:   cfg.CircuitThreshold,
+		Offline:            cfg.Offline,
+	}
+	if cfg.CircuitCooldown > 0 {
+		summary.CircuitCooldown = cfg.CircuitCooldown.String()
+	}
+	for _, hook := range cfg.ChatHooks {
+		summary.ChatHooks = append(summary.ChatHooks, hook.Name())
+	}
+	return summary
+}
+
+// redactURL removes credentials and query parameters, which may carry
+// tokens, from a URL
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "[invalid url]"
+	}
+	if u.User != nil {
+		u.User = url.User("REDACTED")
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = "REDACTED"
+	}
+	return u.String()
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// ChatTimings is the latency breakdown of one completion, in milliseconds.
+// QueueWaitMs is only set by backends that queue requests before running
+// them; TimeToFirstTokenMs and TotalMs are measured here, from when the
+// request was sent until the first content and the final response arrived.
+type ChatTimings struct {
+	QueueWaitMs        int64 `json:"queue_wait_ms,omitempty"`
+	LoadMs             int64 `json:"load_ms,omitempty"`
+	TimeToFirstTokenMs int64 `json:"time_to_first_token_ms"`
+	PromptEvalMs       int64 `json:"prompt_eval_ms"`
+	GenerationMs       int64 `json:"generation_ms"`
+	TotalMs            int64 `json:"total_ms"`
+}
+
+// TimedChatResponse is a chat response with its latency breakdown. Only the
+// final response of a completion carries timings and the effective config.
+type TimedChatResponse struct {
+	api.ChatResponse
+	Timings *ChatTimings `json:"timings,omitempty"`
+	// Config is the configuration the completion was generated with
+	Config *EffectiveConfig `json:"config,omitempty"`
+	// JSONRepair is set when a structured reply was cut short and repaired
+	JSONRepair *JSONRepair `json:"json_repair,omitempty"`
+}
+
+// chatTimer measures the timings of one completion
+type chatTimer struct {
+	start      time.Time
+	firstToken time.Duration
+}
+
+// newChatTimer starts timing a completion
+func newChatTimer() *chatTimer {
+	return &chatTimer{start: time.Now()}
+}
+
+// observe records the arrival of a response chunk
+func (t *chatTimer) observe(resp api.ChatResponse) {
+	if t.firstToken > 0 {
+		return
+	}
+	msg := resp.Message
+	if msg.Content != "" || msg.Thinking != "" || len(msg.ToolCalls) > 0 || resp.Done {
+		t.firstToken = time.Since(t.start)
+	}
+}
+
+// timings builds the breakdown for a completion ending with metrics
+func (t *chatTimer) timings(metrics api.Metrics) *ChatTimings {
+	firstToken := t.firstToken
+	if firstToken == 0 {
+		firstToken = time.Since(t.start)
+	}
+	return &ChatTimings{
+		LoadMs:             metrics.LoadDuration.Milliseconds(),
+		TimeToFirstTokenMs: firstToken.Milliseconds(),
+		PromptEvalMs:       metrics.PromptEvalDuration.Milliseconds(),
+		GenerationMs:       metrics.EvalDuration.Milliseconds(),
+		TotalMs:            time.Since(t.start).Milliseconds(),
+	}
+}
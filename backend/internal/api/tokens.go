@@ -0,0 +1,46 @@
+package api
+
+import (
+	"math"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Token estimation heuristics, kept in sync with frontend/src/lib/memory/tokenizer.ts
+const (
+	// charsPerToken is the average characters per token (calibrated for LLaMA tokenizer)
+	charsPerToken = 3.7
+	// tokensPerWord accounts for subword tokenization
+	tokensPerWord = 1.3
+	// tokensPerImage is a conservative estimate for vision models
+	tokensPerImage = 765
+)
+
+// estimateTokens returns a hybrid character/word based token estimate for text
+func estimateTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+
+	return tokenEstimate(len(text), len(strings.Fields(text)))
+}
+
+// tokenEstimate estimates the tokens in a text of the given length in bytes
+// and number of words
+func tokenEstimate(chars, words int) int {
+	if chars == 0 {
+		return 0
+	}
+
+	charEstimate := math.Ceil(float64(chars) / charsPerToken)
+	wordEstimate := math.Ceil(float64(words) * tokensPerWord)
+
+	// Weighted average (char-based is usually more accurate for code)
+	return int(math.Ceil(charEstimate*0.6 + wordEstimate*0.4))
+}
+
+// estimateMessageTokens estimates the tokens used by a single chat message
+func estimateMessageTokens(msg api.Message) int {
+	return estimateTokens(msg.Content) + estimateTokens(msg.Thinking) + len(msg.Images)*tokensPerImage
+}
@@ -0,0 +1,341 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/models"
+)
+
+// maxLanguageLength caps the language a chat is translated into, which is
+// named in free text ("German", "pt-BR", ...)
+const maxLanguageLength = 64
+
+// translatorSystemPrompt instructs the translation model; %s is the target
+// language
+const translatorSystemPrompt = `You are a translator. Translate the user's message into %s.
+Keep the formatting, markdown, code, names and URLs as they are. Reply with the translation only, without notes or quotes.`
+
+// TranslateChatRequest is the request body for translating a chat
+type TranslateChatRequest struct {
+	// Language is the target language, e.g. "German" or "pt-BR"
+	Language string `json:"language"`
+	// Model translates the messages; empty uses the configured translation
+	// model, then the chat's model
+	Model string `json:"model,omitempty"`
+	// MessageIDs limits the translation to some messages; empty translates
+	// every user and assistant message
+	MessageIDs []string `json:"message_ids,omitempty"`
+	// Continue makes the chat reply in the language from now on
+	Continue bool `json:"continue,omitempty"`
+}
+
+// TranslateMessageRequest is the request body for translating one message
+type TranslateMessageRequest struct {
+	Language string `json:"language"`
+	Model    string `json:"model,omitempty"`
+}
+
+// validateLanguage checks a target language, returning it trimmed
+func validateLanguage(language string) (string, error) {
+	language = strings.TrimSpace(language)
+	switch {
+	case language == "":
+		return "", fmt.Errorf("language is required")
+	case len(language) > maxLanguageLength:
+		return "", fmt.Errorf("must be at most %d characters", maxLanguageLength)
+	case strings.ContainsAny(language, "\r\n"):
+		return "", fmt.Errorf("must be a single line")
+	}
+	return language, nil
+}
+
+// translationModelFor picks the model that translates a chat: the
+// request's, the configured translation model, the chat's, then the default
+func (s *OllamaService) translationModelFor(requested string, chat *models.Chat) string {
+	for _, model := range []string{strings.TrimSpace(requested), s.translationModel, chat.Model} {
+		if model != "" {
+			return model
+		}
+	}
+	return s.defaultModel
+}
+
+// translate asks a model to translate text into a language
+func (s *OllamaService) translate(ctx context.Context, model, language, text string) (string, error) {
+	stream := false
+	req := &api.ChatRequest{
+		Model: model,
+		Messages: []api.Message{
+			{Role: "system", Content: fmt.Sprintf(translatorSystemPrompt, language)},
+			{Role: "user", Content: text},
+		},
+		Stream:  &stream,
+		Options: map[string]any{"temperature": 0},
+	}
+
+	var translation strings.Builder
+	err := s.client.Chat(ctx, req, func(resp api.ChatResponse) error {
+		translation.WriteString(resp.Message.Content)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(translation.String()), nil
+}
+
+// translateMessage translates a stored message and saves the translation
+func (s *OllamaService) translateMessage(ctx context.Context, model, language string, msg *models.Message) (*models.MessageTranslation, error) {
+	content, err := s.translate(ctx, model, language, msg.Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to translate message %s: %w", msg.ID, err)
+	}
+	t := &models.MessageTranslation{MessageID: msg.ID, Language: language, Content: content, Model: model}
+	if err := models.SaveMessageTranslation(s.db, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// respondTranslationModelError writes the response for a translation model
+// that can't be used
+func respondTranslationModelError(c *gin.Context, err error) {
+	var unavailable *ModelUnavailableError
+	if errors.As(err, &unavailable) {
+		respondModelUnavailable(c, unavailable)
+		return
+	}
+	c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+}
+
+// TranslateChatJobHandler translates a chat's messages in the background.
+// Translations are stored beside the originals, which stay unchanged; a
+// message translated again into the same language is replaced. With
+// continue set, the chat replies in the language from then on.
+func (s *OllamaService) TranslateChatJobHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chat, err := models.GetChatMetadata(s.db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if chat == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "chat not found"})
+			return
+		}
+
+		var req TranslateChatRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+		language, err := validateLanguage(req.Language)
+		if err != nil {
+			respondValidationError(c, []FieldError{{Field: "language", Message: err.Error()}})
+			return
+		}
+		model := s.translationModelFor(req.Model, chat)
+		if model == "" {
+			respondValidationError(c, []FieldError{{Field: "model", Message: "no translation model is configured"}})
+			return
+		}
+
+		messages, err := models.GetMessagesByChatID(s.db, chat.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		ids := make([]string, 0, len(messages))
+		for _, msg := range messages {
+			if msg.Role != "user" && msg.Role != "assistant" || strings.TrimSpace(msg.Content) == "" {
+				continue
+			}
+			if len(req.MessageIDs) > 0 && !slices.Contains(req.MessageIDs, msg.ID) {
+				continue
+			}
+			ids = append(ids, msg.ID)
+		}
+		if len(req.MessageIDs) > 0 && len(ids) == 0 {
+			respondValidationError(c, []FieldError{{Field: "message_ids", Message: "no translatable messages of this chat"}})
+			return
+		}
+
+		s.startBulkJob(c, models.BulkJobTranslateChat, translateChatParams{
+			ChatID:     chat.ID,
+			Language:   language,
+			Model:      model,
+			MessageIDs: req.MessageIDs,
+			Continue:   req.Continue,
+		}, ids)
+	}
+}
+
+// translateChatParams are the params of a translate_chat job
+type translateChatParams struct {
+	ChatID     string   `json:"chat_id"`
+	Language   string   `json:"language"`
+	Model      string   `json:"model"`
+	MessageIDs []string `json:"message_ids"`
+	Continue   bool     `json:"continue"`
+}
+
+// translateChatTask translates the messages of a chat one by one
+func (s *OllamaService) translateChatTask(p translateChatParams) bulkTask {
+	return bulkTask{
+		prepare: func(ctx context.Context) error {
+			if err := s.ensureModelAvailable(ctx, p.Model); err != nil {
+				return err
+			}
+			if !p.Continue {
+				return nil
+			}
+			current, err := models.GetChatMetadata(s.db, p.ChatID)
+			if err != nil {
+				return err
+			}
+			if current == nil {
+				return fmt.Errorf("chat not found")
+			}
+			current.Language = &p.Language
+			return models.UpdateChat(s.db, current)
+		},
+		run: func(ctx context.Context, id string) error {
+			msg, err := models.GetMessage(s.db, p.ChatID, id)
+			if err != nil {
+				return err
+			}
+			if msg == nil {
+				return fmt.Errorf("message not found")
+			}
+			_, err = s.translateMessage(ctx, p.Model, p.Language, msg)
+			return err
+		},
+	}
+}
+
+// TranslateMessageHandler translates a single message and returns the
+// stored translation
+func (s *OllamaService) TranslateMessageHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.db == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not available"})
+			return
+		}
+		ctx := c.Request.Context()
+
+		chat, err := models.GetChatMetadata(s.db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if chat == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "chat not found"})
+			return
+		}
+		msg, err := models.GetMessage(s.db, chat.ID, c.Param("messageId"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if msg == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+			return
+		}
+
+		var req TranslateMessageRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+		language, err := validateLanguage(req.Language)
+		if err != nil {
+			respondValidationError(c, []FieldError{{Field: "language", Message: err.Error()}})
+			return
+		}
+		model := s.translationModelFor(req.Model, chat)
+		if model == "" {
+			respondValidationError(c, []FieldError{{Field: "model", Message: "no translation model is configured"}})
+			return
+		}
+		if err := s.ensureModelAvailable(ctx, model); err != nil {
+			respondTranslationModelError(c, err)
+			return
+		}
+
+		t, err := s.translateMessage(ctx, model, language, msg)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, t)
+	}
+}
+
+// ListChatTranslationsHandler returns a chat's translations into the
+// language given by ?language=, or the languages it has translations into
+// when none is given
+func ListChatTranslationsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chat, err := models.GetChatMetadata(db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if chat == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "chat not found"})
+			return
+		}
+
+		language := strings.TrimSpace(c.Query("language"))
+		if language == "" {
+			languages, err := models.ListTranslationLanguages(db, chat.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"languages": languages})
+			return
+		}
+
+		translations, err := models.ListChatTranslations(db, chat.ID, language)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"language": language, "translations": translations})
+	}
+}
+
+// languageMiddleware makes the model reply in the language the request or
+// its chat names, so a translated chat continues in that language
+type languageMiddleware struct {
+	ChatMiddlewareBase
+}
+
+func (languageMiddleware) Name() string { return "language" }
+
+func (languageMiddleware) PrepareChat(_ context.Context, req *ChatPipelineRequest) error {
+	if req.Language == "" {
+		return nil
+	}
+	instruction := fmt.Sprintf("Always reply in %s.", req.Language)
+	messages := make([]api.Message, 0, len(req.Messages)+1)
+	if len(req.Messages) > 0 && req.Messages[0].Role == "system" {
+		first := req.Messages[0]
+		first.Content = strings.TrimRight(first.Content, "\n") + "\n\n" + instruction
+		messages = append(append(messages, first), req.Messages[1:]...)
+	} else {
+		messages = append(append(messages, api.Message{Role: "system", Content: instruction}), req.Messages...)
+	}
+	req.Messages = messages
+	return nil
+}
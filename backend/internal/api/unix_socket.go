@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// unixScheme marks a backend URL as a unix socket: unix:///run/ollama.sock
+const unixScheme = "unix"
+
+// unixSocketBase is the base URL of requests sent over a unix socket; the
+// host is only used for the Host header
+const unixSocketBase = "http://localhost"
+
+// backendEndpoint resolves a backend URL to the base URL requests are made
+// against and the transport that reaches it. unix:// URLs dial the socket
+// at their path; other URLs use the default transport.
+func backendEndpoint(rawURL string) (*url.URL, http.RoundTripper, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.Scheme != unixScheme {
+		return u, http.DefaultTransport, nil
+	}
+
+	path := u.Path
+	if u.Host != "" {
+		// unix://relative/path.sock
+		path = u.Host + u.Path
+	}
+	if path == "" {
+		return nil, nil, fmt.Errorf("unix socket URL has no path")
+	}
+	base, _ := url.Parse(unixSocketBase)
+	return base, unixSocketTransport(path), nil
+}
+
+// unixSocketTransport returns a transport that sends every request over the
+// unix socket at path
+func unixSocketTransport(path string) http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", path)
+	}
+	return transport
+}
+
+// ListenUnix listens on a unix socket at path with the given file mode,
+// replacing a socket left behind by an earlier run
+func ListenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		lis.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	return lis, nil
+}
+
+// UnixSocketHandler wraps the handler of a unix socket listener. Socket
+// clients have no address, so they are given the loopback address: they
+// are on this machine, and file permissions decide who may connect.
+func UnixSocketHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.RemoteAddr = "127.0.0.1:0"
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"vessel-backend/internal/models"
+)
+
+// Upload watchdog timing
+const (
+	// uploadWatchdogInterval is how often spooled uploads are reconciled
+	// with the database
+	uploadWatchdogInterval = time.Hour
+	// uploadStaleAfter is how old a spool directory without an upload, or a
+	// queued or running upload nothing is ingesting, must be before the
+	// watchdog treats it as left behind. Files are spooled before their
+	// upload is stored, so younger ones may still be arriving.
+	uploadStaleAfter = 15 * time.Minute
+)
+
+// StartUploadWatchdog reconciles RAG uploads with their spooled files now
+// and every uploadWatchdogInterval until ctx is cancelled (see
+// reconcileUploads), skipping passes in maintenance mode
+func (s *OllamaService) StartUploadWatchdog(ctx context.Context, retention time.Duration) {
+	if s.db == nil {
+		return
+	}
+	go func() {
+		if !InMaintenance() {
+			s.reconcileUploads(retention)
+		}
+
+		ticker := time.NewTicker(uploadWatchdogInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !InMaintenance() {
+					s.reconcileUploads(retention)
+				}
+			}
+		}
+	}()
+}
+
+// reconcileUploads fixes what crashes and abandoned uploads leave behind:
+//   - uploads left queued or running that nothing is ingesting are failed,
+//     so they can be resumed
+//   - spooled files of uploads that no longer exist, or that completed,
+//     are deleted
+//   - failed and cancelled uploads not touched within retention lose their
+//     spooled files and can't be resumed any more (0 keeps them)
+func (s *OllamaService) reconcileUploads(retention time.Duration) {
+	uploads, err := models.ListAllRAGUploads(s.db)
+	if err != nil {
+		log.Printf("[RAG] %v", err)
+		return
+	}
+	now := time.Now()
+	byID := make(map[string]*models.RAGUpload, len(uploads))
+
+	s.uploads.mu.Lock()
+	active := make(map[string]bool, len(s.uploads.jobs))
+	for id := range s.uploads.jobs {
+		active[id] = true
+	}
+	s.uploads.mu.Unlock()
+
+	for i := range uploads {
+		upload := &uploads[i]
+		byID[upload.ID] = upload
+		if upload.Finished() || active[upload.ID] || now.Sub(upload.UpdatedAt) < uploadStaleAfter {
+			continue
+		}
+		upload.Status = models.RAGUploadFailed
+		upload.Error = "ingestion stopped unexpectedly"
+		if err := models.SaveRAGUploadProgress(s.db, upload); err != nil {
+			log.Printf("[RAG] %v", err)
+			continue
+		}
+		log.Printf("[RAG] Upload %s was stalled; marked it failed", upload.ID)
+	}
+
+	base := s.uploadSpoolBase()
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(base, entry.Name())
+		upload, ok := byID[entry.Name()]
+
+		switch {
+		case !ok || !entry.IsDir():
+			if now.Sub(info.ModTime()) < uploadStaleAfter {
+				continue
+			}
+			log.Printf("[RAG] Removing orphaned upload files %s", path)
+		case active[upload.ID] || !upload.Finished():
+			continue
+		case upload.Status == models.RAGUploadCompleted:
+			log.Printf("[RAG] Removing leftover files of completed upload %s", upload.ID)
+		case retention > 0 && now.Sub(upload.UpdatedAt) > retention:
+			upload.Error = fmt.Sprintf("the uploaded file was removed after %s; upload it again", retention)
+			if err := models.SaveRAGUploadProgress(s.db, upload); err != nil {
+				log.Printf("[RAG] %v", err)
+				continue
+			}
+			log.Printf("[RAG] Removing expired files of %s upload %s", upload.Status, upload.ID)
+		default:
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("[RAG] %v", err)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/models"
+)
+
+// URL expansion limits
+const (
+	// urlContextMaxURLs is how many links of a message are fetched
+	urlContextMaxURLs = 3
+	// urlContextFetchLength caps the download of each page (512KB)
+	urlContextFetchLength = 512 * 1024
+	// urlContextMaxChars caps the text of each page given to the model
+	urlContextMaxChars = 8000
+	// urlContextTimeout bounds fetching all of a message's links
+	urlContextTimeout = 20 * time.Second
+)
+
+// linkPattern matches http(s) links in message text
+var linkPattern = regexp.MustCompile(`https?://[^\s<>"'` + "`" + `]+`)
+
+// URLSnippet is a linked page fetched into a chat's context. Content is the
+// text the model was given; a page that couldn't be fetched has Error set
+// and adds nothing.
+type URLSnippet struct {
+	URL       string `json:"url"`
+	Title     string `json:"title,omitempty"`
+	Content   string `json:"-"`
+	Chars     int    `json:"chars"`
+	Truncated bool   `json:"truncated,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// urlContextMiddleware fetches the pages linked in the last user message
+// when the request enables it (see expandURLs)
+type urlContextMiddleware struct {
+	ChatMiddlewareBase
+	s *OllamaService
+}
+
+func (urlContextMiddleware) Name() string { return "urls" }
+
+func (m urlContextMiddleware) PrepareChat(ctx context.Context, req *ChatPipelineRequest) error {
+	m.s.expandURLs(ctx, req)
+	return nil
+}
+
+// expandURLs appends the text of the pages linked in the last user message
+// to that message, so the model can read what the user points it to. Only
+// the first urlContextMaxURLs links are fetched, each cut to
+// urlContextMaxChars; pages that fail are skipped and recorded with their
+// error. Earlier messages are sent as the client stored them, without the
+// pages fetched for them.
+func (s *OllamaService) expandURLs(ctx context.Context, req *ChatPipelineRequest) {
+	if req.ExpandURLs == nil || !*req.ExpandURLs {
+		return
+	}
+	i := lastUserMessage(req.Messages)
+	if i < 0 {
+		return
+	}
+	links := findLinks(req.Messages[i].Content)
+	if len(links) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, urlContextTimeout)
+	defer cancel()
+
+	var sections []string
+	for _, link := range links {
+		snippet := URLSnippet{URL: link}
+		text, title, err := s.fetchPageText(ctx, link, urlContextFetchLength)
+		switch {
+		case err != nil:
+			snippet.Error = err.Error()
+		case strings.TrimSpace(text) == "":
+			snippet.Error = "no text content"
+		default:
+			if runes := []rune(text); len(runes) > urlContextMaxChars {
+				text = strings.TrimSpace(string(runes[:urlContextMaxChars])) + " ..."
+				snippet.Truncated = true
+			}
+			snippet.Title, snippet.Content, snippet.Chars = title, text, len([]rune(text))
+			heading := link
+			if title != "" {
+				heading = title + " (" + link + ")"
+			}
+			sections = append(sections, "### "+heading+"\n\n"+text)
+		}
+		if snippet.Error != "" {
+			log.Printf("[URLs] Failed to fetch %s for chat context: %s", link, snippet.Error)
+		}
+		req.urlContext = append(req.urlContext, snippet)
+	}
+	if len(sections) == 0 {
+		return
+	}
+
+	messages := make([]api.Message, len(req.Messages))
+	copy(messages, req.Messages)
+	messages[i].Content = strings.TrimRight(messages[i].Content, "\n") +
+		"\n\n---\nContent of the linked pages:\n\n" + strings.Join(sections, "\n\n")
+	req.Messages = messages
+}
+
+// lastUserMessage returns the index of the last user message, or -1
+func lastUserMessage(messages []api.Message) int {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return i
+		}
+	}
+	return -1
+}
+
+// findLinks returns the distinct http(s) links in text, in order, up to
+// urlContextMaxURLs. Punctuation that ends a sentence is not part of a
+// link, nor is a closing parenthesis without an opening one.
+func findLinks(text string) []string {
+	var links []string
+	seen := make(map[string]bool)
+	for _, link := range linkPattern.FindAllString(text, -1) {
+		for {
+			trimmed := strings.TrimRight(link, ".,;:!?]}")
+			if strings.HasSuffix(trimmed, ")") && strings.Count(trimmed, "(") < strings.Count(trimmed, ")") {
+				trimmed = trimmed[:len(trimmed)-1]
+			}
+			if trimmed == link {
+				break
+			}
+			link = trimmed
+		}
+		if u, err := url.Parse(link); err != nil || u.Host == "" || seen[link] {
+			continue
+		}
+		seen[link] = true
+		links = append(links, link)
+		if len(links) == urlContextMaxURLs {
+			break
+		}
+	}
+	return links
+}
+
+// urlContextAttachments turns the fetched pages into text attachments for
+// the persisted reply, so the chat shows what the model was given
+func urlContextAttachments(snippets []URLSnippet) []models.Attachment {
+	var attachments []models.Attachment
+	for _, snippet := range snippets {
+		if snippet.Error != "" {
+			continue
+		}
+		data := "Source: " + snippet.URL + "\n"
+		if snippet.Title != "" {
+			data += "Title: " + snippet.Title + "\n"
+		}
+		data += "\n" + snippet.Content + "\n"
+		attachments = append(attachments, models.Attachment{
+			MimeType: "text/plain",
+			Data:     []byte(data),
+			Filename: linkFilename(snippet.URL),
+		})
+	}
+	return attachments
+}
+
+// linkFilenamePattern matches runs of characters left out of filenames
+var linkFilenamePattern = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// linkFilename names the attachment of a fetched page after its URL, e.g.
+// "example.com-docs-intro.txt"
+func linkFilename(link string) string {
+	name := link
+	if u, err := url.Parse(link); err == nil {
+		name = u.Host + u.Path
+	}
+	name = strings.Trim(linkFilenamePattern.ReplaceAllString(name, "-"), "-.")
+	if len(name) > 80 {
+		name = strings.TrimRight(name[:80], "-.")
+	}
+	if name == "" {
+		name = "page"
+	}
+	return fmt.Sprintf("%s.txt", name)
+}
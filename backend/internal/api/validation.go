@@ -0,0 +1,183 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ollama/ollama/api"
+
+	"vessel-backend/internal/i18n"
+)
+
+// Limits applied to chat requests before they are dispatched to Ollama
+const (
+	// MaxImageSize is the maximum size of a single image attachment (20MB)
+	MaxImageSize = 20 * 1024 * 1024
+	// MaxTotalImageSize is the maximum combined size of all images in a request (50MB)
+	MaxTotalImageSize = 50 * 1024 * 1024
+)
+
+// FieldError describes a single invalid field in a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrorResponse is the structured 400 response for invalid requests
+type ValidationErrorResponse struct {
+	Error      string       `json:"error"`
+	Fields     []FieldError `json:"fields"`
+	Suggestion string       `json:"suggestion,omitempty"`
+}
+
+// validChatRoles lists the message roles accepted by Ollama's chat endpoint
+var validChatRoles = map[string]bool{
+	"system":    true,
+	"user":      true,
+	"assistant": true,
+	"tool":      true,
+}
+
+// respondValidationError writes a structured 400 response with field-level errors
+func respondValidationError(c *gin.Context, fields []FieldError) {
+	c.JSON(http.StatusBadRequest, ValidationErrorResponse{
+		Error:      "validation failed",
+		Fields:     fields,
+		Suggestion: suggest(c, i18n.SuggestFixFields),
+	})
+}
+
+// validateChatRequest checks a chat request for problems that would otherwise
+// surface as opaque upstream errors. Returns nil if the request is valid.
+func validateChatRequest(req *api.ChatRequest) []FieldError {
+	var errs []FieldError
+
+	if strings.TrimSpace(req.Model) == "" {
+		errs = append(errs, FieldError{Field: "model", Message: "model is required"})
+	}
+
+	if len(req.Messages) == 0 {
+		errs = append(errs, FieldError{Field: "messages", Message: "at least one message is required"})
+	}
+
+	totalImageSize := 0
+	for i, msg := range req.Messages {
+		field := fmt.Sprintf("messages[%d]", i)
+
+		if !validChatRoles[msg.Role] {
+			errs = append(errs, FieldError{
+				Field:   field + ".role",
+				Message: "role must be 'system', 'user', 'assistant', or 'tool'",
+			})
+		}
+
+		// A message needs some payload: text, images, or tool calls
+		if strings.TrimSpace(msg.Content) == "" && len(msg.Images) == 0 && len(msg.ToolCalls) == 0 && msg.Role != "assistant" {
+			errs = append(errs, FieldError{Field: field + ".content", Message: "content must not be empty"})
+		}
+
+		for j, img := range msg.Images {
+			if len(img) > MaxImageSize {
+				errs = append(errs, FieldError{
+					Field:   fmt.Sprintf("%s.images[%d]", field, j),
+					Message: fmt.Sprintf("image exceeds maximum size of %d bytes", MaxImageSize),
+				})
+			}
+			totalImageSize += len(img)
+		}
+	}
+
+	if totalImageSize > MaxTotalImageSize {
+		errs = append(errs, FieldError{
+			Field:   "messages",
+			Message: fmt.Sprintf("combined image size exceeds maximum of %d bytes", MaxTotalImageSize),
+		})
+	}
+
+	errs = append(errs, validateOptions(req.Options)...)
+
+	return errs
+}
+
+// validateOptions checks sampling parameters against their allowed ranges
+func validateOptions(opts map[string]any) []FieldError {
+	var errs []FieldError
+
+	checkRange := func(key string, min, max float64) {
+		v, present, ok := optionFloat(opts, key)
+		if !present {
+			return
+		}
+		if !ok {
+			errs = append(errs, FieldError{Field: "options." + key, Message: "must be a number"})
+			return
+		}
+		if v < min || v > max {
+			errs = append(errs, FieldError{
+				Field:   "options." + key,
+				Message: fmt.Sprintf("must be between %g and %g", min, max),
+			})
+		}
+	}
+
+	checkRange("temperature", 0, 2)
+	checkRange("top_p", 0, 1)
+	checkRange("min_p", 0, 1)
+
+	// top_k and num_ctx must be positive when provided
+	for _, key := range []string{"top_k", "num_ctx"} {
+		v, present, ok := optionFloat(opts, key)
+		if !present {
+			continue
+		}
+		if !ok || v < 1 {
+			errs = append(errs, FieldError{Field: "options." + key, Message: "must be a positive number"})
+		}
+	}
+
+	// num_predict (max tokens) must fit in the context window.
+	// Ollama accepts -1 (infinite) and -2 (fill context) as special values.
+	numPredict, present, ok := optionFloat(opts, "num_predict")
+	if present {
+		switch {
+		case !ok:
+			errs = append(errs, FieldError{Field: "options.num_predict", Message: "must be a number"})
+		case numPredict == -1 || numPredict == -2:
+			// Special values, always allowed
+		case numPredict < 1:
+			errs = append(errs, FieldError{Field: "options.num_predict", Message: "must be positive, -1 (unlimited), or -2 (fill context)"})
+		default:
+			if numCtx, ctxPresent, ctxOK := optionFloat(opts, "num_ctx"); ctxPresent && ctxOK && numPredict > numCtx {
+				errs = append(errs, FieldError{
+					Field:   "options.num_predict",
+					Message: fmt.Sprintf("must not exceed the context budget (num_ctx=%g)", numCtx),
+				})
+			}
+		}
+	}
+
+	return errs
+}
+
+// optionFloat reads a numeric option. present reports whether the key was set,
+// ok reports whether its value is numeric.
+func optionFloat(opts map[string]any, key string) (value float64, present bool, ok bool) {
+	raw, exists := opts[key]
+	if !exists || raw == nil {
+		return 0, false, false
+	}
+
+	switch v := raw.(type) {
+	case float64:
+		return v, true, true
+	case float32:
+		return float64(v), true, true
+	case int:
+		return float64(v), true, true
+	case int64:
+		return float64(v), true, true
+	}
+	return 0, true, false
+}
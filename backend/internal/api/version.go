@@ -12,25 +12,57 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// Update channels, which decide the releases update checks consider
+const (
+	// UpdateChannelStable only considers full releases
+	UpdateChannelStable = "stable"
+	// UpdateChannelBeta also considers pre-releases
+	UpdateChannelBeta = "beta"
+	// UpdateChannelOff disables update checks
+	UpdateChannelOff = "off"
+)
+
+// ValidUpdateChannel reports whether channel is a known update channel
+func ValidUpdateChannel(channel string) bool {
+	switch channel {
+	case UpdateChannelStable, UpdateChannelBeta, UpdateChannelOff:
+		return true
+	}
+	return false
+}
+
 // VersionInfo contains version information for the API response
 type VersionInfo struct {
 	Current   string `json:"current"`
 	Latest    string `json:"latest,omitempty"`
 	UpdateURL string `json:"updateUrl,omitempty"`
 	HasUpdate bool   `json:"hasUpdate"`
+	// Channel is the update channel checked; Prerelease marks a latest
+	// version that is a pre-release (only on the beta channel)
+	Channel    string `json:"channel"`
+	Prerelease bool   `json:"prerelease,omitempty"`
 }
 
 // GitHubRelease represents the relevant fields from GitHub releases API
 type GitHubRelease struct {
-	TagName string `json:"tag_name"`
-	HTMLURL string `json:"html_url"`
+	TagName    string `json:"tag_name"`
+	HTMLURL    string `json:"html_url"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+}
+
+// latestRelease is the newest release on a channel
+type latestRelease struct {
+	version    string
+	url        string
+	prerelease bool
 }
 
 // versionCache holds cached version info with TTL
 type versionCache struct {
 	mu          sync.RWMutex
-	latest      string
-	updateURL   string
+	channel     string
+	latest      latestRelease
 	lastFetched time.Time
 	ttl         time.Duration
 }
@@ -47,15 +79,19 @@ func getGitHubRepo() string {
 	return "VikingOwl91/vessel"
 }
 
-// fetchLatestRelease fetches the latest release from GitHub
-func fetchLatestRelease() (string, string, error) {
-	repo := getGitHubRepo()
-	url := "https://api.github.com/repos/" + repo + "/releases/latest"
+// fetchGitHub requests a GitHub API path into out. It returns false without
+// an error when the resource doesn't exist or GitHub doesn't answer it.
+func fetchGitHub(path string, out any) (bool, error) {
+	if err := checkOnline(); err != nil {
+		return false, err
+	}
+
+	url := "https://api.github.com/repos/" + getGitHubRepo() + path
 
 	client := &http.Client{Timeout: 10 * time.Second}
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return "", "", err
+		return false, err
 	}
 
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
@@ -63,105 +99,186 @@ func fetchLatestRelease() (string, string, error) {
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", "", err
+		return false, err
 	}
 	defer resp.Body.Close()
 
 	// 404 means no releases yet - not an error
-	if resp.StatusCode == http.StatusNotFound {
-		return "", "", nil
+	if resp.StatusCode != http.StatusOK {
+		return false, nil
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", "", nil
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, err
 	}
+	return true, nil
+}
 
-	var release GitHubRelease
-	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
-		return "", "", err
+// fetchLatestRelease fetches the latest release on a channel from GitHub.
+// GitHub's latest release is never a pre-release, so the beta channel looks
+// through the recent releases for the highest version instead.
+func fetchLatestRelease(channel string) (latestRelease, error) {
+	if channel != UpdateChannelBeta {
+		var release GitHubRelease
+		found, err := fetchGitHub("/releases/latest", &release)
+		if err != nil || !found {
+			return latestRelease{}, err
+		}
+		// Strip 'v' prefix if present
+		return latestRelease{
+			version: strings.TrimPrefix(release.TagName, "v"),
+			url:     release.HTMLURL,
+		}, nil
 	}
 
-	// Strip 'v' prefix if present
-	version := strings.TrimPrefix(release.TagName, "v")
-	return version, release.HTMLURL, nil
+	var releases []GitHubRelease
+	found, err := fetchGitHub("/releases?per_page=30", &releases)
+	if err != nil || !found {
+		return latestRelease{}, err
+	}
+	var latest latestRelease
+	for _, release := range releases {
+		version := strings.TrimPrefix(release.TagName, "v")
+		if release.Draft || (latest.version != "" && !compareVersions(latest.version, version)) {
+			continue
+		}
+		latest = latestRelease{version: version, url: release.HTMLURL, prerelease: release.Prerelease}
+	}
+	return latest, nil
 }
 
 // getLatestVersion returns cached version or fetches fresh
-func getLatestVersion() (string, string) {
+func getLatestVersion(channel string) latestRelease {
 	cache.mu.RLock()
-	if time.Since(cache.lastFetched) < cache.ttl && cache.latest != "" {
-		latest, url := cache.latest, cache.updateURL
+	if cache.channel == channel && time.Since(cache.lastFetched) < cache.ttl && cache.latest.version != "" {
+		latest := cache.latest
 		cache.mu.RUnlock()
-		return latest, url
+		return latest
 	}
 	cache.mu.RUnlock()
 
 	// Fetch fresh
-	latest, url, err := fetchLatestRelease()
+	latest, err := fetchLatestRelease(channel)
 	if err != nil {
-		return "", ""
+		return latestRelease{}
 	}
 
 	// Update cache
 	cache.mu.Lock()
+	cache.channel = channel
 	cache.latest = latest
-	cache.updateURL = url
 	cache.lastFetched = time.Now()
 	cache.mu.Unlock()
 
-	return latest, url
+	return latest
 }
 
-// compareVersions returns true if latest > current (semver comparison)
+// compareVersions returns true if latest > current (semver comparison). A
+// pre-release ("1.2.0-beta.1") is older than its release, and pre-releases
+// of the same version compare by their dot-separated identifiers.
 func compareVersions(current, latest string) bool {
 	if latest == "" || current == "" {
 		return false
 	}
 
-	// Strip 'v' prefix if present
-	current = strings.TrimPrefix(current, "v")
-	latest = strings.TrimPrefix(latest, "v")
+	// Strip 'v' prefix and build metadata if present
+	current, _, _ = strings.Cut(strings.TrimPrefix(current, "v"), "+")
+	latest, _, _ = strings.Cut(strings.TrimPrefix(latest, "v"), "+")
 
-	currentParts := strings.Split(current, ".")
-	latestParts := strings.Split(latest, ".")
+	current, currentPre, _ := strings.Cut(current, "-")
+	latest, latestPre, _ := strings.Cut(latest, "-")
 
-	// Compare each segment
-	maxLen := len(currentParts)
-	if len(latestParts) > maxLen {
-		maxLen = len(latestParts)
+	if c := compareIdentifiers(strings.Split(current, "."), strings.Split(latest, "."), true); c != 0 {
+		return c > 0
 	}
 
-	for i := 0; i < maxLen; i++ {
-		var currentNum, latestNum int
+	// Same version: a release is newer than its pre-releases
+	switch {
+	case currentPre == latestPre:
+		return false
+	case latestPre == "":
+		return true
+	case currentPre == "":
+		return false
+	}
+	return compareIdentifiers(strings.Split(currentPre, "."), strings.Split(latestPre, "."), false) > 0
+}
 
-		if i < len(currentParts) {
-			currentNum, _ = strconv.Atoi(strings.Split(currentParts[i], "-")[0])
-		}
-		if i < len(latestParts) {
-			latestNum, _ = strconv.Atoi(strings.Split(latestParts[i], "-")[0])
+// compareIdentifiers compares dot-separated version identifiers, returning
+// 1 if b is higher than a, -1 if lower and 0 if equal. Numeric identifiers
+// compare as numbers and below alphanumeric ones; with pad, missing
+// identifiers count as 0 ("1.2" == "1.2.0"), otherwise the longer list of
+// otherwise equal identifiers is higher.
+func compareIdentifiers(a, b []string, pad bool) int {
+	n := max(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if i >= len(a) || i >= len(b) {
+			if pad {
+				var x, y string
+				if i < len(a) {
+					x = a[i]
+				}
+				if i < len(b) {
+					y = b[i]
+				}
+				xn, _ := strconv.Atoi(x)
+				yn, _ := strconv.Atoi(y)
+				if c := cmpInt(xn, yn); c != 0 {
+					return c
+				}
+				continue
+			}
+			if i >= len(a) {
+				return 1
+			}
+			return -1
 		}
 
-		if latestNum > currentNum {
-			return true
-		}
-		if latestNum < currentNum {
-			return false
+		xn, xErr := strconv.Atoi(a[i])
+		yn, yErr := strconv.Atoi(b[i])
+		switch {
+		case xErr == nil && yErr == nil:
+			if c := cmpInt(xn, yn); c != 0 {
+				return c
+			}
+		case xErr == nil:
+			return 1
+		case yErr == nil:
+			return -1
+		default:
+			if c := strings.Compare(b[i], a[i]); c != 0 {
+				return c
+			}
 		}
 	}
+	return 0
+}
 
-	return false
+// cmpInt returns 1 if b > a, -1 if b < a and 0 if equal
+func cmpInt(a, b int) int {
+	switch {
+	case b > a:
+		return 1
+	case b < a:
+		return -1
+	}
+	return 0
 }
 
-// VersionHandler returns a handler that provides version information
-func VersionHandler(currentVersion string) gin.HandlerFunc {
+// VersionHandler returns a handler that provides version information,
+// checking for updates on the given channel
+func VersionHandler(currentVersion, channel string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		latest, updateURL := getLatestVersion()
-
 		info := VersionInfo{
-			Current:   currentVersion,
-			Latest:    latest,
-			UpdateURL: updateURL,
-			HasUpdate: compareVersions(currentVersion, latest),
+			Current: currentVersion,
+			Channel: channel,
+		}
+		if channel != UpdateChannelOff {
+			latest := getLatestVersion(channel)
+			info.Latest = latest.version
+			info.UpdateURL = latest.url
+			info.Prerelease = latest.prerelease
+			info.HasUpdate = compareVersions(currentVersion, latest.version)
 		}
 
 		c.JSON(http.StatusOK, info)
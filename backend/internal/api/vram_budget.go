@@ -0,0 +1,264 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VRAM policies: what to do when loading a chat's model would overflow the
+// GPU
+const (
+	// VRAMPolicyOff leaves memory to Ollama (the default)
+	VRAMPolicyOff = "off"
+	// VRAMPolicyUnload unloads other Ollama models, those outside the warm
+	// pool first, until the model fits
+	VRAMPolicyUnload = "unload"
+	// VRAMPolicyReject refuses the request with a VRAMConflictError
+	VRAMPolicyReject = "reject"
+)
+
+// vramBudget coordinates the VRAM Ollama's models need with what the rest
+// of the GPU holds: other programs, like a second inference runtime, show
+// up in the GPU's telemetry but not in Ollama's. Loading a model that
+// doesn't fit fails deep inside Ollama with an out of memory error, or
+// pushes the model onto the CPU; the budget catches it before the request
+// is sent and surfaces who holds the memory instead.
+type vramBudget struct {
+	policy string
+	// budget caps the VRAM in bytes; 0 uses the GPU's total memory
+	budget int64
+
+	// mu serializes decisions, so two requests don't both count on the
+	// same free memory
+	mu sync.Mutex
+}
+
+// newVRAMBudget returns a budget following policy, or nil when it is off
+func newVRAMBudget(policy string, budgetMB int) *vramBudget {
+	if policy == "" || policy == VRAMPolicyOff {
+		return nil
+	}
+	return &vramBudget{policy: policy, budget: int64(budgetMB) * 1024 * 1024}
+}
+
+// ValidVRAMPolicy reports whether policy is a known VRAM policy
+func ValidVRAMPolicy(policy string) bool {
+	switch policy {
+	case VRAMPolicyOff, VRAMPolicyUnload, VRAMPolicyReject:
+		return true
+	}
+	return false
+}
+
+// VRAMHolder is a model, or the GPU's other users, holding VRAM
+type VRAMHolder struct {
+	// Runtime is "ollama", or "other" for everything outside Ollama
+	Runtime string `json:"runtime"`
+	Model   string `json:"model,omitempty"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// VRAMStatus describes the GPU memory and who holds it
+type VRAMStatus struct {
+	Policy string `json:"policy"`
+	// CapacityBytes is the budget, or the GPU's total memory without one;
+	// 0 when neither is known
+	CapacityBytes int64 `json:"capacity_bytes"`
+	// GPUTotalBytes and GPUUsedBytes come from nvidia-smi on this machine
+	// and are 0 when it isn't available
+	GPUTotalBytes int64        `json:"gpu_total_bytes"`
+	GPUUsedBytes  int64        `json:"gpu_used_bytes"`
+	OllamaBytes   int64        `json:"ollama_bytes"`
+	OtherBytes    int64        `json:"other_bytes"`
+	FreeBytes     int64        `json:"free_bytes"`
+	Holders       []VRAMHolder `json:"holders"`
+	Telemetry     string       `json:"telemetry,omitempty"`
+}
+
+// VRAMConflictError is returned when a model doesn't fit in the VRAM left
+// and the policy couldn't, or wasn't allowed to, make room
+type VRAMConflictError struct {
+	Model       string       `json:"model"`
+	NeededBytes int64        `json:"needed_bytes"`
+	FreeBytes   int64        `json:"free_bytes"`
+	Holders     []VRAMHolder `json:"holders"`
+}
+
+func (e *VRAMConflictError) Error() string {
+	return fmt.Sprintf("model %q needs about %d MiB of VRAM but only %d MiB are free",
+		e.Model, e.NeededBytes/(1024*1024), max(e.FreeBytes, 0)/(1024*1024))
+}
+
+// respondVRAMConflict writes a 409 response naming what holds the VRAM
+func respondVRAMConflict(c *gin.Context, e *VRAMConflictError) {
+	c.JSON(http.StatusConflict, gin.H{
+		"error":        e.Error(),
+		"model":        e.Model,
+		"needed_bytes": e.NeededBytes,
+		"free_bytes":   e.FreeBytes,
+		"holders":      e.Holders,
+	})
+}
+
+// gpuMemory returns the total and used memory of this machine's NVIDIA GPUs
+// in bytes, summed over all of them
+func gpuMemory(ctx context.Context) (total, used int64, err error) {
+	path, err := exec.LookPath("nvidia-smi")
+	if err != nil {
+		return 0, 0, err
+	}
+	out, err := exec.CommandContext(ctx, path,
+		"--query-gpu=memory.total,memory.used", "--format=csv,noheader,nounits").Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("nvidia-smi: %w", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		t, u, ok := strings.Cut(line, ",")
+		if !ok {
+			continue
+		}
+		totalMB, err1 := strconv.ParseInt(strings.TrimSpace(t), 10, 64)
+		usedMB, err2 := strconv.ParseInt(strings.TrimSpace(u), 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		total += totalMB * 1024 * 1024
+		used += usedMB * 1024 * 1024
+	}
+	return total, used, nil
+}
+
+// vramStatus measures the GPU memory and who holds it
+func (s *OllamaService) vramStatus(ctx context.Context) (*VRAMStatus, error) {
+	running, err := s.client.ListRunning(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list loaded models: %w", err)
+	}
+	status := &VRAMStatus{Policy: VRAMPolicyOff, Holders: []VRAMHolder{}}
+	if s.vram != nil {
+		status.Policy = s.vram.policy
+		status.CapacityBytes = s.vram.budget
+	}
+	for _, m := range running.Models {
+		status.OllamaBytes += m.SizeVRAM
+		status.Holders = append(status.Holders, VRAMHolder{Runtime: "ollama", Model: m.Name, Bytes: m.SizeVRAM})
+	}
+
+	total, used, err := gpuMemory(ctx)
+	if err != nil {
+		status.Telemetry = err.Error()
+	} else {
+		status.GPUTotalBytes, status.GPUUsedBytes = total, used
+		status.OtherBytes = max(used-status.OllamaBytes, 0)
+		if status.CapacityBytes == 0 || total < status.CapacityBytes {
+			status.CapacityBytes = total
+		}
+	}
+	if status.OtherBytes > 0 {
+		status.Holders = append(status.Holders, VRAMHolder{Runtime: "other", Bytes: status.OtherBytes})
+	}
+	if status.CapacityBytes > 0 {
+		status.FreeBytes = status.CapacityBytes - status.OllamaBytes - status.OtherBytes
+	}
+	return status, nil
+}
+
+// reserveVRAM makes sure a model about to be used fits in the VRAM left,
+// following the policy. Loaded models always fit. A model's size on disk
+// stands in for the VRAM it needs, which is a lower bound: the context
+// needs memory on top. Without telemetry or a budget nothing is checked.
+func (s *OllamaService) reserveVRAM(ctx context.Context, model string) error {
+	if s.vram == nil {
+		return nil
+	}
+	s.vram.mu.Lock()
+	defer s.vram.mu.Unlock()
+
+	status, err := s.vramStatus(ctx)
+	if err != nil || status.CapacityBytes == 0 {
+		return nil
+	}
+	for _, h := range status.Holders {
+		if h.Runtime == "ollama" && sameModel(h.Model, model) {
+			return nil
+		}
+	}
+	needed := s.modelDiskSize(ctx, model)
+	if needed == 0 || needed <= status.FreeBytes {
+		return nil
+	}
+
+	conflict := &VRAMConflictError{Model: model, NeededBytes: needed, FreeBytes: status.FreeBytes, Holders: status.Holders}
+	if s.vram.policy != VRAMPolicyUnload {
+		return conflict
+	}
+
+	// Unload models outside the warm pool first, then the largest
+	candidates := slices.DeleteFunc(slices.Clone(status.Holders), func(h VRAMHolder) bool { return h.Runtime != "ollama" })
+	slices.SortStableFunc(candidates, func(a, b VRAMHolder) int {
+		aWarm := s.warm != nil && s.warm.contains(a.Model)
+		bWarm := s.warm != nil && s.warm.contains(b.Model)
+		if aWarm != bWarm {
+			if aWarm {
+				return 1
+			}
+			return -1
+		}
+		return cmp.Compare(b.Bytes, a.Bytes)
+	})
+	free := status.FreeBytes
+	for _, h := range candidates {
+		if needed <= free {
+			break
+		}
+		if err := s.unloadModel(ctx, h.Model); err != nil {
+			log.Printf("[Ollama] Failed to unload %s to make room for %s: %v", h.Model, model, err)
+			continue
+		}
+		log.Printf("[Ollama] Unloaded %s to make room for %s", h.Model, model)
+		free += h.Bytes
+	}
+	if needed > free {
+		conflict.FreeBytes = free
+		return conflict
+	}
+	return nil
+}
+
+// modelDiskSize returns the size of an installed model's files, or 0 if
+// it isn't installed
+func (s *OllamaService) modelDiskSize(ctx context.Context, model string) int64 {
+	resp, err := s.client.List(ctx)
+	if err != nil {
+		return 0
+	}
+	for _, m := range resp.Models {
+		if sameModel(m.Name, model) {
+			return m.Size
+		}
+	}
+	return 0
+}
+
+// VRAMStatusHandler returns the GPU memory, the models and other programs
+// holding it, and the VRAM policy
+func (s *OllamaService) VRAMStatusHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, err := s.vramStatus(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	}
+}
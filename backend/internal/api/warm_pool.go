@@ -0,0 +1,297 @@
+package api
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// warmReleaseKeepAlive is the keep_alive a model leaving the warm pool gets,
+// so Ollama unloads it like any other idle model
+const warmReleaseKeepAlive = 5 * time.Minute
+
+// warmRefreshTimeout bounds a warm pool refresh
+const warmRefreshTimeout = 30 * time.Second
+
+// warmIdleCheckInterval is how often an idle timeout is checked at most
+const warmIdleCheckInterval = time.Minute
+
+// warmPool keeps the most recently used chat models loaded, so switching
+// between a few favorite models doesn't reload them every time. Chats with
+// a pool model are sent with keep_alive -1, which keeps Ollama from
+// unloading it; a model that drops out of the pool is given an ordinary
+// keep_alive again. Ollama still needs room for every pinned model (see
+// OLLAMA_MAX_LOADED_MODELS), which the VRAM budget accounts for.
+type warmPool struct {
+	// size is how many models are kept loaded
+	size int
+	// budget caps the VRAM the pool's models use together, in bytes
+	// (0 is unlimited); the model in use always stays in the pool
+	budget int64
+
+	mu sync.Mutex
+	// recent holds the used models, most recent first
+	recent []string
+	// sizes is the VRAM each model used when last seen loaded
+	sizes map[string]int64
+	// pinned are the models sent with keep_alive -1
+	pinned map[string]bool
+	// released dropped out of the pool and still need a keep_alive
+	released map[string]bool
+	// lastUse is when a chat last used a model
+	lastUse time.Time
+	// idle is set once the pool was unloaded for being idle, until the
+	// next use
+	idle bool
+}
+
+// WarmPoolStatus describes the warm pool
+type WarmPoolStatus struct {
+	Size      int      `json:"size"`
+	BudgetMB  int64    `json:"budget_mb,omitempty"`
+	Models    []string `json:"models"`
+	VRAMBytes int64    `json:"vram_bytes"`
+	// Idle is set while the pool's models are unloaded for lack of use;
+	// the next chat loads its model again
+	Idle    bool       `json:"idle"`
+	LastUse *time.Time `json:"last_use,omitempty"`
+	// Recent is every model used lately, most recent first
+	Recent []string `json:"recent"`
+}
+
+// newWarmPool returns a pool of size models within budgetMB of VRAM, or
+// nil when size is 0
+func newWarmPool(size, budgetMB int) *warmPool {
+	if size <= 0 {
+		return nil
+	}
+	return &warmPool{
+		size:     size,
+		budget:   int64(budgetMB) * 1024 * 1024,
+		sizes:    make(map[string]int64),
+		pinned:   make(map[string]bool),
+		released: make(map[string]bool),
+	}
+}
+
+// members returns the models in the pool: the most recently used ones that
+// fit the size and the VRAM budget. Models whose size isn't known yet are
+// counted once they have been seen loaded. Must be called with p.mu held.
+func (p *warmPool) members() []string {
+	var members []string
+	var used int64
+	for _, model := range p.recent {
+		if len(members) == p.size {
+			break
+		}
+		size := p.sizes[model]
+		if len(members) > 0 && p.budget > 0 && used+size > p.budget {
+			continue
+		}
+		members = append(members, model)
+		used += size
+	}
+	return members
+}
+
+// update pins the current members and marks the models that dropped out
+// as released. Must be called with p.mu held.
+func (p *warmPool) update() {
+	current := make(map[string]bool, p.size)
+	for _, model := range p.members() {
+		current[model] = true
+	}
+	for model := range p.pinned {
+		if !current[model] {
+			p.released[model] = true
+		}
+	}
+	for model := range current {
+		delete(p.released, model)
+	}
+	p.pinned = current
+}
+
+// use records that a chat is about to use a model and reports whether the
+// model is in the pool
+func (p *warmPool) use(model string) bool {
+	model = normalizeModelName(model)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	recent := make([]string, 0, len(p.recent)+1)
+	recent = append(recent, model)
+	for _, m := range p.recent {
+		if m != model {
+			recent = append(recent, m)
+		}
+	}
+	// Only a few more models than the pool holds can ever get back in
+	if len(recent) > 4*p.size {
+		recent = recent[:4*p.size]
+	}
+	p.recent = recent
+	p.lastUse = time.Now()
+	p.idle = false
+	p.update()
+	return p.pinned[model]
+}
+
+// contains reports whether a model is in the pool
+func (p *warmPool) contains(model string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pinned[normalizeModelName(model)]
+}
+
+// applyWarmPool pins the request's model when it is in the warm pool and
+// neither the request nor its chat set a keep_alive. With use set, the
+// request counts as a use of the model.
+func (s *OllamaService) applyWarmPool(req *ChatPipelineRequest, use bool) {
+	if s.warm == nil {
+		return
+	}
+	warm := s.warm.contains(req.Model)
+	if use {
+		warm = s.warm.use(req.Model)
+		go s.refreshWarmPool()
+	}
+	if warm && req.KeepAlive == nil {
+		req.KeepAlive = &api.Duration{Duration: -1}
+		req.setSource("keep_alive", ConfigSourceServer)
+	}
+}
+
+// refreshWarmPool learns the VRAM of the loaded models, which may push
+// models out of the pool, and gives the models that left it an ordinary
+// keep_alive so they unload when idle
+func (s *OllamaService) refreshWarmPool() {
+	ctx, cancel := context.WithTimeout(context.Background(), warmRefreshTimeout)
+	defer cancel()
+
+	running, err := s.client.ListRunning(ctx)
+	if err != nil {
+		return
+	}
+	loaded := make(map[string]bool, len(running.Models))
+
+	s.warm.mu.Lock()
+	for _, m := range running.Models {
+		name := normalizeModelName(m.Name)
+		loaded[name] = true
+		if m.SizeVRAM > 0 {
+			s.warm.sizes[name] = m.SizeVRAM
+		} else {
+			s.warm.sizes[name] = m.Size
+		}
+	}
+	s.warm.update()
+	var release []string
+	for model := range s.warm.released {
+		if loaded[model] {
+			release = append(release, model)
+		}
+		delete(s.warm.released, model)
+	}
+	s.warm.mu.Unlock()
+
+	stream := false
+	for _, model := range release {
+		req := &api.GenerateRequest{
+			Model:     model,
+			Stream:    &stream,
+			KeepAlive: &api.Duration{Duration: warmReleaseKeepAlive},
+		}
+		if err := s.client.Generate(ctx, req, func(api.GenerateResponse) error { return nil }); err != nil {
+			log.Printf("[Ollama] Failed to release %s from the warm pool: %v", model, err)
+			continue
+		}
+		log.Printf("[Ollama] Released %s from the warm pool", model)
+	}
+}
+
+// warmPoolStatus describes the warm pool, or returns nil when it is off
+func (s *OllamaService) warmPoolStatus() *WarmPoolStatus {
+	if s.warm == nil {
+		return nil
+	}
+	s.warm.mu.Lock()
+	defer s.warm.mu.Unlock()
+
+	status := &WarmPoolStatus{
+		Size:     s.warm.size,
+		BudgetMB: s.warm.budget / (1024 * 1024),
+		Models:   s.warm.members(),
+		Recent:   append([]string{}, s.warm.recent...),
+	}
+	for _, model := range status.Models {
+		status.VRAMBytes += s.warm.sizes[model]
+	}
+	status.Idle = s.warm.idle
+	if !s.warm.lastUse.IsZero() {
+		lastUse := s.warm.lastUse.UTC()
+		status.LastUse = &lastUse
+	}
+	return status
+}
+
+// StartWarmPoolIdleUnload unloads the warm pool's models once no chat has
+// used a model for timeout, to free the VRAM they hold. Ollama loads a
+// model again when the next chat needs it; that chat waits for the load.
+// A zero timeout keeps the models loaded.
+func (s *OllamaService) StartWarmPoolIdleUnload(ctx context.Context, timeout time.Duration) {
+	if s.warm == nil || timeout <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(max(min(timeout/4, warmIdleCheckInterval), time.Second))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.unloadIdleWarmPool(ctx, timeout)
+			}
+		}
+	}()
+}
+
+// unloadIdleWarmPool unloads the pool's loaded models if none was used
+// within timeout
+func (s *OllamaService) unloadIdleWarmPool(ctx context.Context, timeout time.Duration) {
+	s.warm.mu.Lock()
+	if s.warm.idle || s.warm.lastUse.IsZero() || time.Since(s.warm.lastUse) < timeout {
+		s.warm.mu.Unlock()
+		return
+	}
+	s.warm.idle = true
+	pinned := make(map[string]bool, len(s.warm.pinned))
+	for model := range s.warm.pinned {
+		pinned[model] = true
+	}
+	s.warm.mu.Unlock()
+
+	running, err := s.client.ListRunning(ctx)
+	if err != nil {
+		log.Printf("[Ollama] Warm pool idle check failed: %v", err)
+		s.warm.mu.Lock()
+		s.warm.idle = false
+		s.warm.mu.Unlock()
+		return
+	}
+	for _, m := range running.Models {
+		model := normalizeModelName(m.Name)
+		if !pinned[model] {
+			continue
+		}
+		if err := s.unloadModel(ctx, model); err != nil {
+			log.Printf("[Ollama] Failed to unload idle %s: %v", model, err)
+			continue
+		}
+		log.Printf("[Ollama] Unloaded %s after %s without chats", model, timeout)
+	}
+}
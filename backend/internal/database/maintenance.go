@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// TableSize is the on-disk size of a table including its indexes
+type TableSize struct {
+	Table string `json:"table"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Stats summarizes database size and reclaimable space
+type Stats struct {
+	TotalBytes int64       `json:"total_bytes"`
+	FreeBytes  int64       `json:"free_bytes"`
+	PageSize   int64       `json:"page_size"`
+	AutoVacuum string      `json:"auto_vacuum"`
+	Tables     []TableSize `json:"tables"`
+	CheckedAt  time.Time   `json:"checked_at"`
+}
+
+// IntegrityCheck runs PRAGMA integrity_check (or quick_check when quick is
+// set) and returns the problems found. An empty slice means the database is ok.
+func IntegrityCheck(ctx context.Context, db *sql.DB, quick bool) ([]string, error) {
+	pragma := "PRAGMA integrity_check"
+	if quick {
+		pragma = "PRAGMA quick_check"
+	}
+
+	rows, err := db.QueryContext(ctx, pragma)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run integrity check: %w", err)
+	}
+	defer rows.Close()
+
+	problems := []string{}
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, fmt.Errorf("failed to scan integrity check: %w", err)
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	return problems, rows.Err()
+}
+
+// Vacuum reclaims free pages. Incremental vacuum only works when auto_vacuum
+// is INCREMENTAL; full rewrites the whole file and blocks writers meanwhile.
+func Vacuum(ctx context.Context, db *sql.DB, full bool) error {
+	if full {
+		if _, err := db.ExecContext(ctx, "VACUUM"); err != nil {
+			return fmt.Errorf("failed to vacuum: %w", err)
+		}
+		return nil
+	}
+
+	if _, err := db.ExecContext(ctx, "PRAGMA incremental_vacuum"); err != nil {
+		return fmt.Errorf("failed to run incremental vacuum: %w", err)
+	}
+	return nil
+}
+
+// Analyze refreshes the query planner statistics
+func Analyze(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, "ANALYZE"); err != nil {
+		return fmt.Errorf("failed to analyze: %w", err)
+	}
+	return nil
+}
+
+// GetStats reports database size per table using the dbstat virtual table
+func GetStats(ctx context.Context, db *sql.DB) (*Stats, error) {
+	stats := &Stats{CheckedAt: time.Now().UTC(), Tables: []TableSize{}}
+
+	var pageCount, freePages, autoVacuum int64
+	if err := db.QueryRowContext(ctx, "PRAGMA page_size").Scan(&stats.PageSize); err != nil {
+		return nil, fmt.Errorf("failed to read page size: %w", err)
+	}
+	if err := db.QueryRowContext(ctx, "PRAGMA page_count").Scan(&pageCount); err != nil {
+		return nil, fmt.Errorf("failed to read page count: %w", err)
+	}
+	if err := db.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&freePages); err != nil {
+		return nil, fmt.Errorf("failed to read freelist count: %w", err)
+	}
+	if err := db.QueryRowContext(ctx, "PRAGMA auto_vacuum").Scan(&autoVacuum); err != nil {
+		return nil, fmt.Errorf("failed to read auto_vacuum: %w", err)
+	}
+
+	stats.TotalBytes = pageCount * stats.PageSize
+	stats.FreeBytes = freePages * stats.PageSize
+	stats.AutoVacuum = [...]string{"none", "full", "incremental"}[autoVacuum%3]
+
+	// Indexes are attributed to the table they belong to
+	rows, err := db.QueryContext(ctx, `
+		SELECT m.tbl_name, SUM(s.pgsize)
+		FROM dbstat s JOIN sqlite_master m ON m.name = s.name
+		GROUP BY m.tbl_name
+		ORDER BY SUM(s.pgsize) DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table sizes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t TableSize
+		if err := rows.Scan(&t.Table, &t.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to scan table size: %w", err)
+		}
+		stats.Tables = append(stats.Tables, t)
+	}
+
+	return stats, rows.Err()
+}
+
+// StartMaintenance runs a quick integrity check, incremental vacuum and
+// query planner optimization on the given interval until ctx is cancelled.
+// Passes are skipped while paused reports true, e.g. during a backup.
+func StartMaintenance(ctx context.Context, db *sql.DB, interval time.Duration, paused func() bool) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if paused == nil || !paused() {
+					runMaintenance(ctx, db)
+				}
+			}
+		}
+	}()
+}
+
+// runMaintenance performs one scheduled maintenance pass, logging problems
+func runMaintenance(ctx context.Context, db *sql.DB) {
+	problems, err := IntegrityCheck(ctx, db, true)
+	if err != nil {
+		log.Printf("Database maintenance: %v", err)
+		return
+	}
+	if len(problems) > 0 {
+		// Don't touch a damaged database further; surface it loudly instead
+		log.Printf("Database maintenance: integrity check found %d problem(s): %v", len(problems), problems)
+		return
+	}
+
+	if err := Vacuum(ctx, db, false); err != nil {
+		log.Printf("Database maintenance: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, "PRAGMA optimize"); err != nil {
+		log.Printf("Database maintenance: failed to optimize: %v", err)
+	}
+}
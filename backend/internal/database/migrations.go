@@ -1,10 +1,16 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"regexp"
+	"sort"
 )
 
+// createTablePattern finds the tables created by the migrations
+var createTablePattern = regexp.MustCompile(`CREATE (?:VIRTUAL )?TABLE IF NOT EXISTS (\w+)`)
+
 const migrationsSQL = `
 -- Chats table
 CREATE TABLE IF NOT EXISTS chats (
@@ -93,6 +99,366 @@ CREATE INDEX IF NOT EXISTS idx_remote_models_name ON remote_models(name);
 CREATE INDEX IF NOT EXISTS idx_remote_models_model_type ON remote_models(model_type);
 CREATE INDEX IF NOT EXISTS idx_remote_models_pull_count ON remote_models(pull_count DESC);
 CREATE INDEX IF NOT EXISTS idx_remote_models_scraped_at ON remote_models(scraped_at);
+
+-- Effective configuration snapshots, addressed by hash of the normalized JSON
+CREATE TABLE IF NOT EXISTS settings_snapshots (
+    hash TEXT PRIMARY KEY,
+    data TEXT NOT NULL,
+    created_at TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+-- Content encryption key metadata (the key itself is derived from a passphrase)
+CREATE TABLE IF NOT EXISTS encryption_keys (
+    id TEXT PRIMARY KEY,
+    salt BLOB NOT NULL,
+    verifier TEXT NOT NULL,
+    created_at TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+-- User-defined labels for installed models, keyed by normalized model name
+CREATE TABLE IF NOT EXISTS model_metadata (
+    name TEXT PRIMARY KEY,
+    display_name TEXT NOT NULL DEFAULT '',
+    tags TEXT NOT NULL DEFAULT '[]',
+    notes TEXT NOT NULL DEFAULT '',
+    updated_at TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+-- Server-wide settings stored as JSON values (e.g. inference defaults)
+CREATE TABLE IF NOT EXISTS app_settings (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL,
+    updated_at TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+-- Cached completions for deterministic chat requests, keyed by request hash
+CREATE TABLE IF NOT EXISTS completion_cache (
+    key TEXT PRIMARY KEY,
+    model TEXT NOT NULL,
+    response TEXT NOT NULL,
+    created_at TEXT NOT NULL DEFAULT (datetime('now')),
+    expires_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_completion_cache_expires_at ON completion_cache(expires_at);
+
+-- Eval suites: prompt cases with expected patterns, JSON schemas or grader prompts
+CREATE TABLE IF NOT EXISTS eval_suites (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    cases TEXT NOT NULL DEFAULT '[]',
+    created_at TEXT NOT NULL DEFAULT (datetime('now')),
+    updated_at TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+-- Eval runs of a suite against one or more backend/model targets
+CREATE TABLE IF NOT EXISTS eval_runs (
+    id TEXT PRIMARY KEY,
+    suite_id TEXT NOT NULL REFERENCES eval_suites(id) ON DELETE CASCADE,
+    status TEXT NOT NULL,
+    targets TEXT NOT NULL DEFAULT '[]',
+    grader_model TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL DEFAULT (datetime('now')),
+    finished_at TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_eval_runs_suite_id ON eval_runs(suite_id, created_at);
+
+-- Per-case, per-target eval results
+CREATE TABLE IF NOT EXISTS eval_results (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id TEXT NOT NULL REFERENCES eval_runs(id) ON DELETE CASCADE,
+    case_index INTEGER NOT NULL,
+    backend TEXT NOT NULL,
+    model TEXT NOT NULL,
+    output TEXT NOT NULL DEFAULT '',
+    passed INTEGER NOT NULL DEFAULT 0,
+    score REAL NOT NULL DEFAULT 0,
+    reason TEXT NOT NULL DEFAULT '',
+    latency_ms INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_eval_results_run_id ON eval_results(run_id);
+
+-- Daily token usage per chat and per API key, for budget enforcement
+CREATE TABLE IF NOT EXISTS token_usage (
+    day TEXT NOT NULL,
+    scope TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    input_tokens INTEGER NOT NULL DEFAULT 0,
+    output_tokens INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, scope, subject)
+);
+
+-- Daily bytes downloaded from external services, per source, for
+-- accounting and monthly caps
+CREATE TABLE IF NOT EXISTS bandwidth_usage (
+    day TEXT NOT NULL,
+    source TEXT NOT NULL,
+    bytes INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, source)
+);
+
+-- License of each installed model, fetched from Ollama on first use
+CREATE TABLE IF NOT EXISTS model_licenses (
+    model TEXT PRIMARY KEY,
+    license_name TEXT NOT NULL DEFAULT '',
+    license_hash TEXT NOT NULL DEFAULT '',
+    license_text TEXT NOT NULL DEFAULT '',
+    restrictive INTEGER NOT NULL DEFAULT 0,
+    source TEXT NOT NULL DEFAULT '',
+    fetched_at TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+-- Audit trail of accepted model licenses; kept when the model is removed
+CREATE TABLE IF NOT EXISTS license_acceptances (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    model TEXT NOT NULL,
+    license_name TEXT NOT NULL DEFAULT '',
+    license_hash TEXT NOT NULL,
+    accepted_by TEXT NOT NULL DEFAULT '',
+    note TEXT NOT NULL DEFAULT '',
+    accepted_at TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_license_acceptances_model ON license_acceptances(model, license_hash);
+
+-- Projects group chats; default_agent_id names the agent new chats start with
+CREATE TABLE IF NOT EXISTS projects (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    instructions TEXT NOT NULL DEFAULT '',
+    color TEXT NOT NULL DEFAULT '',
+    default_agent_id TEXT,
+    created_at TEXT NOT NULL DEFAULT (datetime('now')),
+    updated_at TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+-- Knowledge links (reference URLs) attached to a project
+CREATE TABLE IF NOT EXISTS project_links (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL,
+    url TEXT NOT NULL,
+    title TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL DEFAULT (datetime('now')),
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_project_links_project_id ON project_links(project_id);
+
+-- RAG collections: named groups of ingested documents sharing an embedding model
+CREATE TABLE IF NOT EXISTS rag_collections (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    embedding_model TEXT NOT NULL,
+    created_at TEXT NOT NULL DEFAULT (datetime('now')),
+    updated_at TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+-- Projects and agents a collection is attached to; retrieval for a chat only
+-- searches collections attached to its project or agent
+CREATE TABLE IF NOT EXISTS rag_collection_links (
+    collection_id TEXT NOT NULL,
+    target_type TEXT NOT NULL CHECK (target_type IN ('project', 'agent')),
+    target_id TEXT NOT NULL,
+    PRIMARY KEY (collection_id, target_type, target_id),
+    FOREIGN KEY (collection_id) REFERENCES rag_collections(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_rag_collection_links_target ON rag_collection_links(target_type, target_id);
+
+CREATE TABLE IF NOT EXISTS rag_documents (
+    id TEXT PRIMARY KEY,
+    collection_id TEXT NOT NULL,
+    title TEXT NOT NULL,
+    source TEXT NOT NULL DEFAULT '',
+    chunk_count INTEGER NOT NULL DEFAULT 0,
+    created_at TEXT NOT NULL DEFAULT (datetime('now')),
+    FOREIGN KEY (collection_id) REFERENCES rag_collections(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_rag_documents_collection_id ON rag_documents(collection_id);
+
+-- Chunks store their embedding as little-endian float32s
+CREATE TABLE IF NOT EXISTS rag_chunks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    document_id TEXT NOT NULL,
+    collection_id TEXT NOT NULL,
+    seq INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    embedding BLOB NOT NULL,
+    FOREIGN KEY (document_id) REFERENCES rag_documents(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_rag_chunks_collection_id ON rag_chunks(collection_id);
+CREATE INDEX IF NOT EXISTS idx_rag_chunks_document_id ON rag_chunks(document_id);
+
+-- Keyword index over RAG chunks (rowid = rag_chunks.id), kept in sync by
+-- triggers. Underscores are token characters so code identifiers stay whole.
+CREATE VIRTUAL TABLE IF NOT EXISTS rag_chunks_fts USING fts5(
+    content,
+    tokenize = "unicode61 tokenchars '_'"
+);
+
+CREATE TRIGGER IF NOT EXISTS rag_chunks_fts_insert AFTER INSERT ON rag_chunks BEGIN
+    INSERT INTO rag_chunks_fts (rowid, content) VALUES (new.id, new.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS rag_chunks_fts_delete AFTER DELETE ON rag_chunks BEGIN
+    DELETE FROM rag_chunks_fts WHERE rowid = old.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS rag_chunks_fts_update AFTER UPDATE OF content ON rag_chunks BEGIN
+    UPDATE rag_chunks_fts SET content = new.content WHERE rowid = old.id;
+END;
+
+-- File uploads being ingested into RAG collections; the file and the output
+-- of each finished stage are spooled to disk so an upload can be resumed
+CREATE TABLE IF NOT EXISTS rag_uploads (
+    id TEXT PRIMARY KEY,
+    collection_id TEXT NOT NULL,
+    filename TEXT NOT NULL,
+    title TEXT NOT NULL DEFAULT '',
+    size INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL,
+    stage TEXT NOT NULL,
+    pages_total INTEGER NOT NULL DEFAULT 0,
+    pages_done INTEGER NOT NULL DEFAULT 0,
+    chunks_total INTEGER NOT NULL DEFAULT 0,
+    chunks_embedded INTEGER NOT NULL DEFAULT 0,
+    document_id TEXT,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL DEFAULT (datetime('now')),
+    updated_at TEXT NOT NULL DEFAULT (datetime('now')),
+    FOREIGN KEY (collection_id) REFERENCES rag_collections(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_rag_uploads_collection_id ON rag_uploads(collection_id, created_at);
+
+-- User feedback on messages: a rating (-1, 0, 1), a note and tags (JSON array)
+CREATE TABLE IF NOT EXISTS message_feedback (
+    message_id TEXT PRIMARY KEY,
+    chat_id TEXT NOT NULL,
+    rating INTEGER NOT NULL DEFAULT 0 CHECK (rating IN (-1, 0, 1)),
+    note TEXT NOT NULL DEFAULT '',
+    tags TEXT NOT NULL DEFAULT '[]',
+    created_at TEXT NOT NULL DEFAULT (datetime('now')),
+    updated_at TEXT NOT NULL DEFAULT (datetime('now')),
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (chat_id) REFERENCES chats(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_feedback_chat_id ON message_feedback(chat_id);
+
+-- Covering indexes for paging long chats: threads and pages are found from
+-- these alone, and only the messages on a page are read in full
+CREATE INDEX IF NOT EXISTS idx_messages_chat_created ON messages(chat_id, created_at, id, role, parent_id);
+CREATE INDEX IF NOT EXISTS idx_messages_thread ON messages(id, parent_id, chat_id, role, created_at);
+
+-- Bulk jobs: batch operations (deleting chats, re-embedding a collection,
+-- verifying models) run in the background with their progress and results
+CREATE TABLE IF NOT EXISTS bulk_jobs (
+    id TEXT PRIMARY KEY,
+    kind TEXT NOT NULL,
+    status TEXT NOT NULL,
+    params TEXT NOT NULL DEFAULT '{}',
+    total INTEGER NOT NULL DEFAULT 0,
+    done INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    results TEXT NOT NULL DEFAULT '[]',
+    error TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL DEFAULT (datetime('now')),
+    updated_at TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_bulk_jobs_created_at ON bulk_jobs(created_at);
+
+-- Character cards (SillyTavern-compatible) give chats a persona. The card's
+-- fields are kept as imported, including the avatar of PNG cards, and are
+-- assembled into the prompt for every request of a chat using the card.
+CREATE TABLE IF NOT EXISTS character_cards (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    personality TEXT NOT NULL DEFAULT '',
+    scenario TEXT NOT NULL DEFAULT '',
+    first_message TEXT NOT NULL DEFAULT '',
+    alternate_greetings TEXT NOT NULL DEFAULT '[]',
+    example_messages TEXT NOT NULL DEFAULT '',
+    system_prompt TEXT NOT NULL DEFAULT '',
+    post_history_instructions TEXT NOT NULL DEFAULT '',
+    creator_notes TEXT NOT NULL DEFAULT '',
+    creator TEXT NOT NULL DEFAULT '',
+    character_version TEXT NOT NULL DEFAULT '',
+    tags TEXT NOT NULL DEFAULT '[]',
+    spec TEXT NOT NULL DEFAULT '',
+    avatar BLOB,
+    created_at TEXT NOT NULL DEFAULT (datetime('now')),
+    updated_at TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+-- Translations of messages, kept alongside the originals; content is
+-- encrypted like message content
+CREATE TABLE IF NOT EXISTS message_translations (
+    message_id TEXT NOT NULL,
+    language TEXT NOT NULL,
+    content TEXT NOT NULL,
+    model TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL DEFAULT (datetime('now')),
+    PRIMARY KEY (message_id, language),
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+
+-- Tools granted to agents; tools that run code are off for every agent
+-- until granted here
+CREATE TABLE IF NOT EXISTS agent_tool_grants (
+    agent_id TEXT NOT NULL,
+    tool TEXT NOT NULL,
+    created_at TEXT NOT NULL DEFAULT (datetime('now')),
+    PRIMARY KEY (agent_id, tool)
+);
+
+-- Directories an agent's filesystem tools may use; nothing outside them is
+-- reachable
+CREATE TABLE IF NOT EXISTS agent_directories (
+    id TEXT PRIMARY KEY,
+    agent_id TEXT NOT NULL,
+    path TEXT NOT NULL,
+    writable INTEGER NOT NULL DEFAULT 0,
+    created_at TEXT NOT NULL DEFAULT (datetime('now')),
+    UNIQUE (agent_id, path)
+);
+
+-- Audit trail of filesystem tool calls, including denied ones
+CREATE TABLE IF NOT EXISTS filesystem_audit (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    agent_id TEXT NOT NULL,
+    operation TEXT NOT NULL,
+    path TEXT NOT NULL,
+    bytes INTEGER NOT NULL DEFAULT 0,
+    allowed INTEGER NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_filesystem_audit_agent ON filesystem_audit(agent_id, id);
+
+-- Partial output of the case an eval run is generating, so a restart or a
+-- backend outage continues the generation instead of starting it over
+CREATE TABLE IF NOT EXISTS eval_checkpoints (
+    run_id TEXT PRIMARY KEY REFERENCES eval_runs(id) ON DELETE CASCADE,
+    target_index INTEGER NOT NULL,
+    case_index INTEGER NOT NULL,
+    output TEXT NOT NULL DEFAULT '',
+    elapsed_ms INTEGER NOT NULL DEFAULT 0,
+    updated_at TEXT NOT NULL DEFAULT (datetime('now'))
+);
 `
 
 // Additional migrations for schema updates (run separately to handle existing tables)
@@ -102,6 +468,69 @@ const additionalMigrations = `
 -- Example: {"8b": 4700000000, "70b": 40000000000}
 `
 
+// addedColumns are the columns added after the initial schema. SQLite
+// doesn't have IF NOT EXISTS for ALTER TABLE, so they are checked
+// individually.
+var addedColumns = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	// tag_sizes maps tag names to file sizes in bytes
+	{"remote_models", "tag_sizes", "TEXT NOT NULL DEFAULT '{}'"},
+	{"chats", "system_prompt_id", "TEXT"},
+	// keep_alive is an Ollama duration ("5m", "0", "-1") applied to the chat's requests
+	{"chats", "keep_alive", "TEXT"},
+	// settings_hash references the settings_snapshots row the message was generated with
+	{"messages", "settings_hash", "TEXT"},
+	// favorite models sort first in pickers; hidden ones are left out of listings
+	{"model_metadata", "favorite", "INTEGER NOT NULL DEFAULT 0"},
+	{"model_metadata", "hidden", "INTEGER NOT NULL DEFAULT 0"},
+	// corruption quarantines models that failed checksum verification
+	{"model_metadata", "corruption", "TEXT NOT NULL DEFAULT ''"},
+	{"model_metadata", "corrupted_at", "TEXT"},
+	// project_id places the chat in a project; NULL chats are unfiled
+	{"chats", "project_id", "TEXT"},
+	// url, content_hash and fetched_at let documents be re-ingested
+	// incrementally and URL sources re-crawled
+	{"rag_documents", "url", "TEXT NOT NULL DEFAULT ''"},
+	{"rag_documents", "content_hash", "TEXT NOT NULL DEFAULT ''"},
+	{"rag_documents", "updated_at", "TEXT"},
+	{"rag_documents", "fetched_at", "TEXT"},
+	// chunk_strategy, chunk_size and chunk_overlap configure how the
+	// collection's documents are chunked; collections from before this
+	// keep the character chunker they were indexed with
+	{"rag_collections", "chunk_strategy", "TEXT NOT NULL DEFAULT 'characters'"},
+	{"rag_collections", "chunk_size", "INTEGER NOT NULL DEFAULT 0"},
+	{"rag_collections", "chunk_overlap", "INTEGER NOT NULL DEFAULT 0"},
+	// locale, timezone and inject_datetime control the date context given
+	// to the chat's model; NULL follows the inference defaults
+	{"chats", "locale", "TEXT"},
+	{"chats", "timezone", "TEXT"},
+	{"chats", "inject_datetime", "INTEGER"},
+	// seed is the sampling seed an assistant message was generated with
+	{"messages", "seed", "INTEGER"},
+	// last_used_at is when the model last answered a chat, for sorting by use
+	{"model_metadata", "last_used_at", "TEXT"},
+	// use_count is how many completions the model has produced
+	{"model_metadata", "use_count", "INTEGER NOT NULL DEFAULT 0"},
+	// character_id is the character card a chat plays
+	{"chats", "character_id", "TEXT"},
+	// language is the language a chat continues in after being translated
+	{"chats", "language", "TEXT"},
+	// target_index tells apart targets that share a model, so interrupted
+	// runs resume at the right case
+	{"eval_results", "target_index", "INTEGER NOT NULL DEFAULT 0"},
+	// items, attempts and next_run_at let bulk jobs resume after a restart
+	// and retry with backoff
+	{"bulk_jobs", "items", "TEXT NOT NULL DEFAULT '[]'"},
+	{"bulk_jobs", "attempts", "INTEGER NOT NULL DEFAULT 0"},
+	{"bulk_jobs", "next_run_at", "TEXT"},
+	// expand_urls fetches the pages linked in a chat's messages into the
+	// model's context
+	{"chats", "expand_urls", "INTEGER"},
+}
+
 // RunMigrations executes all database migrations
 func RunMigrations(db *sql.DB) error {
 	_, err := db.Exec(migrationsSQL)
@@ -109,31 +538,69 @@ func RunMigrations(db *sql.DB) error {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
-	// Add tag_sizes column if it doesn't exist
-	// SQLite doesn't have IF NOT EXISTS for ALTER TABLE, so we check first
+	for _, col := range addedColumns {
+		if err := addColumnIfMissing(db, col.table, col.column, col.definition); err != nil {
+			return err
+		}
+	}
+
+	// Index chunks stored before the keyword index existed
+	if _, err := db.Exec(`
+		INSERT INTO rag_chunks_fts (rowid, content)
+		SELECT id, content FROM rag_chunks WHERE id NOT IN (SELECT rowid FROM rag_chunks_fts)`); err != nil {
+		return fmt.Errorf("failed to index rag chunks: %w", err)
+	}
+
+	return nil
+}
+
+// addColumnIfMissing adds a column to a table unless it already exists
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
 	var count int
-	err = db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('remote_models') WHERE name='tag_sizes'`).Scan(&count)
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&count)
 	if err != nil {
-		return fmt.Errorf("failed to check tag_sizes column: %w", err)
+		return fmt.Errorf("failed to check %s column: %w", column, err)
 	}
-	if count == 0 {
-		_, err = db.Exec(`ALTER TABLE remote_models ADD COLUMN tag_sizes TEXT NOT NULL DEFAULT '{}'`)
-		if err != nil {
-			return fmt.Errorf("failed to add tag_sizes column: %w", err)
-		}
+	if count > 0 {
+		return nil
 	}
 
-	// Add system_prompt_id column to chats table if it doesn't exist
-	err = db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('chats') WHERE name='system_prompt_id'`).Scan(&count)
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
 	if err != nil {
-		return fmt.Errorf("failed to check system_prompt_id column: %w", err)
+		return fmt.Errorf("failed to add %s column: %w", column, err)
 	}
-	if count == 0 {
-		_, err = db.Exec(`ALTER TABLE chats ADD COLUMN system_prompt_id TEXT`)
+	return nil
+}
+
+// CheckSchema returns the tables and columns of the current schema that are
+// missing from the database, as "table" or "table.column". An empty slice
+// means the migrations are fully applied.
+func CheckSchema(ctx context.Context, db *sql.DB) ([]string, error) {
+	missing := []string{}
+	tables := make(map[string]bool)
+	for _, m := range createTablePattern.FindAllStringSubmatch(migrationsSQL, -1) {
+		tables[m[1]] = true
+	}
+	for table := range tables {
+		var count int
+		err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE name = ?`, table).Scan(&count)
 		if err != nil {
-			return fmt.Errorf("failed to add system_prompt_id column: %w", err)
+			return nil, fmt.Errorf("failed to check %s table: %w", table, err)
+		}
+		if count == 0 {
+			missing = append(missing, table)
 		}
 	}
-
-	return nil
+	for _, col := range addedColumns {
+		var count int
+		err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, col.table, col.column).Scan(&count)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check %s column: %w", col.column, err)
+		}
+		if count == 0 {
+			missing = append(missing, col.table+"."+col.column)
+		}
+	}
+	sort.Strings(missing)
+	return missing, nil
 }
@@ -3,30 +3,117 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	_ "modernc.org/sqlite"
 )
 
-// OpenDatabase opens a SQLite database connection with WAL mode enabled
-func OpenDatabase(path string) (*sql.DB, error) {
+// Options tunes the SQLite connection. Pragmas are applied to every pooled
+// connection, since SQLite settings such as busy_timeout are per-connection.
+type Options struct {
+	// JournalMode is the journal_mode pragma (WAL allows readers during writes)
+	JournalMode string
+	// BusyTimeout is how long a writer waits for a lock before SQLITE_BUSY
+	BusyTimeout time.Duration
+	// Synchronous is the synchronous pragma (NORMAL is safe with WAL)
+	Synchronous string
+	// ForeignKeys enables foreign key enforcement (and ON DELETE CASCADE)
+	ForeignKeys bool
+	// CacheSize is the cache_size pragma in pages (negative values are KiB)
+	CacheSize int
+	// MmapSize is the maximum bytes of the database to memory-map (0 disables)
+	MmapSize int64
+	// MaxOpenConns and MaxIdleConns size the connection pool
+	MaxOpenConns int
+	MaxIdleConns int
+}
+
+// DefaultOptions returns the connection settings used when none are configured
+func DefaultOptions() Options {
+	return Options{
+		JournalMode:  "WAL",
+		BusyTimeout:  5 * time.Second,
+		Synchronous:  "NORMAL",
+		ForeignKeys:  true,
+		CacheSize:    10000,
+		MmapSize:     0,
+		MaxOpenConns: 25,
+		MaxIdleConns: 5,
+	}
+}
+
+var (
+	validJournalModes = []string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}
+	validSynchronous  = []string{"OFF", "NORMAL", "FULL", "EXTRA"}
+)
+
+// validate checks option values before they are interpolated into pragmas
+func (o Options) validate() error {
+	if !containsFold(validJournalModes, o.JournalMode) {
+		return fmt.Errorf("invalid journal mode %q", o.JournalMode)
+	}
+	if !containsFold(validSynchronous, o.Synchronous) {
+		return fmt.Errorf("invalid synchronous mode %q", o.Synchronous)
+	}
+	if o.BusyTimeout < 0 {
+		return fmt.Errorf("busy timeout must not be negative")
+	}
+	if o.MmapSize < 0 {
+		return fmt.Errorf("mmap size must not be negative")
+	}
+	if o.MaxOpenConns < 1 {
+		return fmt.Errorf("max open connections must be at least 1")
+	}
+	return nil
+}
+
+// dsn builds a modernc.org/sqlite connection string. The driver only honors
+// pragmas passed as _pragma=name(value); other query parameters are ignored.
+func (o Options) dsn(path string) string {
+	foreignKeys := "OFF"
+	if o.ForeignKeys {
+		foreignKeys = "ON"
+	}
+
+	params := url.Values{}
+	// auto_vacuum only takes effect before the file is initialized (or after a
+	// full VACUUM), so it must precede the journal_mode switch
+	params.Add("_pragma", "auto_vacuum(INCREMENTAL)")
+	// busy_timeout comes next so it also covers the journal_mode switch
+	params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", o.BusyTimeout.Milliseconds()))
+	params.Add("_pragma", fmt.Sprintf("journal_mode(%s)", strings.ToUpper(o.JournalMode)))
+	params.Add("_pragma", fmt.Sprintf("synchronous(%s)", strings.ToUpper(o.Synchronous)))
+	params.Add("_pragma", fmt.Sprintf("foreign_keys(%s)", foreignKeys))
+	params.Add("_pragma", fmt.Sprintf("cache_size(%d)", o.CacheSize))
+	params.Add("_pragma", fmt.Sprintf("mmap_size(%d)", o.MmapSize))
+
+	return "file:" + path + "?" + params.Encode()
+}
+
+// OpenDatabase opens a SQLite database connection with the given options
+func OpenDatabase(path string, opts Options) (*sql.DB, error) {
+	if err := opts.validate(); err != nil {
+		return nil, fmt.Errorf("invalid database options: %w", err)
+	}
+
 	// Ensure directory exists
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
 
-	// Open database with connection parameters
-	dsn := fmt.Sprintf("%s?_journal_mode=WAL&_busy_timeout=5000&_synchronous=NORMAL&_cache_size=10000&_foreign_keys=ON", path)
-	db, err := sql.Open("sqlite", dsn)
+	db, err := sql.Open("sqlite", opts.dsn(path))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	// Configure connection pool
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
 
 	// Verify connection
 	if err := db.Ping(); err != nil {
@@ -36,3 +123,21 @@ func OpenDatabase(path string) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// JournalMode reports the journal mode SQLite actually applied
+func JournalMode(db *sql.DB) (string, error) {
+	var mode string
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		return "", fmt.Errorf("failed to read journal mode: %w", err)
+	}
+	return mode, nil
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,238 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Password-protected archives wrap a file (an export, a backup) so it can be
+// stored somewhere untrusted. The key is derived from the password with
+// Argon2id and the data is sealed with AES-256-GCM in chunks, so archives
+// of any size can be written and read as streams:
+//
+//	magic "VSLENC01" | salt (16) | nonce prefix (7)
+//	chunks: final flag (1) | ciphertext length (4) | ciphertext
+//
+// Each chunk's nonce is the prefix, the chunk counter and the final flag,
+// and the header is authenticated with every chunk, so reordered, dropped
+// or truncated chunks fail to decrypt.
+
+// ArchiveMagic starts every password-protected archive
+const ArchiveMagic = "VSLENC01"
+
+// ArchiveExtension is appended to the names of password-protected archives
+const ArchiveExtension = ".venc"
+
+// MinArchivePasswordLength is the shortest password archives accept
+const MinArchivePasswordLength = 8
+
+const (
+	archiveChunkSize   = 64 * 1024
+	archivePrefixSize  = 7
+	archiveHeaderSize  = len(ArchiveMagic) + SaltSize + archivePrefixSize
+	archiveChunkHeader = 5
+)
+
+// ErrWrongPassword is returned when an archive can't be opened with the
+// password given (or was tampered with before its first chunk)
+var ErrWrongPassword = errors.New("wrong password or corrupt archive")
+
+// IsArchive reports whether data starts like a password-protected archive
+func IsArchive(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(ArchiveMagic))
+}
+
+// archiveAEAD derives the archive key and returns its cipher
+func archiveAEAD(password string, salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(DeriveKey(password, salt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// archiveNonce builds the nonce of a chunk
+func archiveNonce(prefix []byte, counter uint32, final bool) []byte {
+	nonce := make([]byte, archivePrefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[archivePrefixSize:], counter)
+	if final {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// ArchiveWriter encrypts everything written to it into a password-protected
+// archive. Close must be called to write the final chunk.
+type ArchiveWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	prefix  []byte
+	counter uint32
+	buf     []byte
+	closed  bool
+}
+
+// NewArchiveWriter writes the archive header to w and returns a writer that
+// encrypts into it
+func NewArchiveWriter(w io.Writer, password string) (*ArchiveWriter, error) {
+	if len(password) < MinArchivePasswordLength {
+		return nil, fmt.Errorf("password must be at least %d characters", MinArchivePasswordLength)
+	}
+	header := make([]byte, archiveHeaderSize)
+	copy(header, ArchiveMagic)
+	if _, err := rand.Read(header[len(ArchiveMagic):]); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	salt := header[len(ArchiveMagic) : len(ArchiveMagic)+SaltSize]
+	aead, err := archiveAEAD(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &ArchiveWriter{
+		w:      w,
+		aead:   aead,
+		header: header,
+		prefix: header[len(ArchiveMagic)+SaltSize:],
+		buf:    make([]byte, 0, archiveChunkSize),
+	}, nil
+}
+
+// Write encrypts p, writing each chunk once it is full
+func (a *ArchiveWriter) Write(p []byte) (int, error) {
+	if a.closed {
+		return 0, errors.New("archive is closed")
+	}
+	n := len(p)
+	for len(p) > 0 {
+		take := min(archiveChunkSize-len(a.buf), len(p))
+		a.buf = append(a.buf, p[:take]...)
+		p = p[take:]
+		// A full chunk is only written once more data follows, since the
+		// last chunk has to be marked final
+		if len(a.buf) == archiveChunkSize && len(p) > 0 {
+			if err := a.flush(false); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close writes the final chunk. It doesn't close the underlying writer.
+func (a *ArchiveWriter) Close() error {
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+	return a.flush(true)
+}
+
+// flush seals the buffered data as the next chunk
+func (a *ArchiveWriter) flush(final bool) error {
+	sealed := a.aead.Seal(nil, archiveNonce(a.prefix, a.counter, final), a.buf, a.header)
+	a.counter++
+	a.buf = a.buf[:0]
+
+	chunkHeader := make([]byte, archiveChunkHeader)
+	if final {
+		chunkHeader[0] = 1
+	}
+	binary.BigEndian.PutUint32(chunkHeader[1:], uint32(len(sealed)))
+	if _, err := a.w.Write(chunkHeader); err != nil {
+		return err
+	}
+	_, err := a.w.Write(sealed)
+	return err
+}
+
+// ArchiveReader decrypts a password-protected archive
+type ArchiveReader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	header  []byte
+	prefix  []byte
+	counter uint32
+	plain   []byte
+	done    bool
+}
+
+// NewArchiveReader reads the archive header from r and returns a reader of
+// the decrypted contents. A wrong password is reported by the first Read.
+func NewArchiveReader(r io.Reader, password string) (*ArchiveReader, error) {
+	header := make([]byte, archiveHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("not a password-protected archive: %w", err)
+	}
+	if !IsArchive(header) {
+		return nil, errors.New("not a password-protected archive")
+	}
+	salt := header[len(ArchiveMagic) : len(ArchiveMagic)+SaltSize]
+	aead, err := archiveAEAD(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &ArchiveReader{
+		r:      r,
+		aead:   aead,
+		header: header,
+		prefix: header[len(ArchiveMagic)+SaltSize:],
+	}, nil
+}
+
+// Read returns decrypted data, one chunk at a time
+func (a *ArchiveReader) Read(p []byte) (int, error) {
+	for len(a.plain) == 0 {
+		if a.done {
+			return 0, io.EOF
+		}
+		if err := a.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, a.plain)
+	a.plain = a.plain[n:]
+	return n, nil
+}
+
+// next reads and decrypts the next chunk
+func (a *ArchiveReader) next() error {
+	chunkHeader := make([]byte, archiveChunkHeader)
+	if _, err := io.ReadFull(a.r, chunkHeader); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errors.New("archive is truncated")
+		}
+		return err
+	}
+	final := chunkHeader[0] == 1
+	size := binary.BigEndian.Uint32(chunkHeader[1:])
+	if size > archiveChunkSize+uint32(a.aead.Overhead()) {
+		return errors.New("archive is corrupt: chunk too large")
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(a.r, sealed); err != nil {
+		return errors.New("archive is truncated")
+	}
+
+	plain, err := a.aead.Open(nil, archiveNonce(a.prefix, a.counter, final), sealed, a.header)
+	if err != nil {
+		if a.counter == 0 {
+			return ErrWrongPassword
+		}
+		return errors.New("archive is corrupt")
+	}
+	a.counter++
+	a.plain = plain
+	a.done = final
+	return nil
+}
@@ -0,0 +1,148 @@
+// Package encryption provides application-level AES-GCM encryption for
+// content stored in the database.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// prefix marks an encrypted value: enc:v1:<key id>:<base64(nonce|ciphertext)>
+const prefix = "enc:v1:"
+
+// SaltSize is the length of the random salt used for key derivation
+const SaltSize = 16
+
+// ErrWrongKey is returned when a value was encrypted with a different key
+var ErrWrongKey = errors.New("value was encrypted with a different key")
+
+// Cipher encrypts and decrypts values with a single AES-256-GCM key
+type Cipher struct {
+	keyID string
+	aead  cipher.AEAD
+}
+
+// DeriveKey derives a 256-bit key from a passphrase using Argon2id
+func DeriveKey(passphrase string, salt []byte) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, 1, 64*1024, 4, 32)
+}
+
+// NewSalt returns a random salt for DeriveKey
+func NewSalt() ([]byte, error) {
+	salt := make([]byte, SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	return salt, nil
+}
+
+// NewCipher creates a cipher for a 32-byte key identified by keyID
+func NewCipher(keyID string, key []byte) (*Cipher, error) {
+	if strings.Contains(keyID, ":") {
+		return nil, fmt.Errorf("key id must not contain ':'")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return &Cipher{keyID: keyID, aead: aead}, nil
+}
+
+// KeyID returns the identifier of the cipher's key
+func (c *Cipher) KeyID() string {
+	return c.keyID
+}
+
+// Seal encrypts data, returning nonce|ciphertext
+func (c *Cipher) Seal(data []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return c.aead.Seal(nonce, nonce, data, []byte(c.keyID)), nil
+}
+
+// Open decrypts data produced by Seal
+func (c *Cipher) Open(data []byte) ([]byte, error) {
+	nonceSize := c.aead.NonceSize()
+	if len(data) < nonceSize {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	plain, err := c.aead.Open(nil, data[:nonceSize], data[nonceSize:], []byte(c.keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return plain, nil
+}
+
+// EncryptString encrypts a string into its prefixed text form
+func (c *Cipher) EncryptString(plaintext string) (string, error) {
+	sealed, err := c.Seal([]byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return prefix + c.keyID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptString decrypts a value produced by EncryptString. Values without
+// the encryption prefix are returned unchanged, so plaintext rows written
+// before encryption was enabled keep working.
+func (c *Cipher) DecryptString(value string) (string, error) {
+	keyID, payload, ok := Parse(value)
+	if !ok {
+		return value, nil
+	}
+	if keyID != c.keyID {
+		return "", ErrWrongKey
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", fmt.Errorf("invalid ciphertext encoding: %w", err)
+	}
+	plain, err := c.Open(sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// Parse splits an encrypted value into its key id and payload. Values that
+// only look like one, such as plaintext starting with the prefix but
+// without a base64 payload, are not encrypted.
+func Parse(value string) (keyID, payload string, ok bool) {
+	if !strings.HasPrefix(value, prefix) {
+		return "", "", false
+	}
+	keyID, payload, ok = strings.Cut(value[len(prefix):], ":")
+	if !ok || keyID == "" || payload == "" {
+		return "", "", false
+	}
+	if _, err := base64.StdEncoding.DecodeString(payload); err != nil {
+		return "", "", false
+	}
+	return keyID, payload, true
+}
+
+// IsEncrypted reports whether a value is in encrypted form
+func IsEncrypted(value string) bool {
+	_, _, ok := Parse(value)
+	return ok
+}
+
+// KeyPrefix returns the prefix shared by all values encrypted with keyID,
+// for use in SQL LIKE queries
+func KeyPrefix(keyID string) string {
+	return prefix + keyID + ":"
+}
@@ -0,0 +1,120 @@
+package encryption
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newTestCipher(t *testing.T, keyID, passphrase string) *Cipher {
+	t.Helper()
+	salt, err := NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCipher(keyID, DeriveKey(passphrase, salt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestEncryptStringRoundTrip(t *testing.T) {
+	c := newTestCipher(t, "key1", "passphrase")
+	for _, plain := range []string{"", "hello", "enc:v1:foo:", "ünïcödé \x00 bytes"} {
+		encrypted, err := c.EncryptString(plain)
+		if err != nil {
+			t.Fatalf("EncryptString(%q): %v", plain, err)
+		}
+		if !strings.HasPrefix(encrypted, KeyPrefix("key1")) || !IsEncrypted(encrypted) {
+			t.Fatalf("EncryptString(%q) = %q, want a value with prefix %q", plain, encrypted, KeyPrefix("key1"))
+		}
+		got, err := c.DecryptString(encrypted)
+		if err != nil {
+			t.Fatalf("DecryptString: %v", err)
+		}
+		if got != plain {
+			t.Errorf("round trip = %q, want %q", got, plain)
+		}
+	}
+}
+
+func TestDecryptStringPlaintextPassesThrough(t *testing.T) {
+	c := newTestCipher(t, "key1", "passphrase")
+	for _, plain := range []string{"hello", "enc:v1:", "enc:v1:foo:", "enc:v1:foo:not base64!"} {
+		got, err := c.DecryptString(plain)
+		if err != nil || got != plain {
+			t.Errorf("DecryptString(%q) = %q, %v; want it unchanged", plain, got, err)
+		}
+	}
+}
+
+func TestDecryptStringWrongKey(t *testing.T) {
+	a := newTestCipher(t, "key1", "passphrase")
+	encrypted, err := a.EncryptString("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newTestCipher(t, "key2", "passphrase").DecryptString(encrypted); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("DecryptString with another key id error = %v, want ErrWrongKey", err)
+	}
+	// Same key id, different key material: authentication fails
+	if _, err := newTestCipher(t, "key1", "other").DecryptString(encrypted); err == nil {
+		t.Error("DecryptString with the wrong key succeeded")
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	c := newTestCipher(t, "key1", "passphrase")
+	data := []byte{0, 1, 2, 0xff}
+	sealed, err := c.Seal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, err := c.Open(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, data) {
+		t.Errorf("Open(Seal(%v)) = %v", data, opened)
+	}
+
+	sealed[len(sealed)-1] ^= 1
+	if _, err := c.Open(sealed); err == nil {
+		t.Error("Open accepted tampered ciphertext")
+	}
+	if _, err := c.Open([]byte{1}); err == nil {
+		t.Error("Open accepted a short ciphertext")
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value   string
+		keyID   string
+		payload string
+		ok      bool
+	}{
+		{value: "plain"},
+		{value: "enc:v1:"},
+		{value: "enc:v1:key"},
+		{value: "enc:v1:key:"},
+		{value: "enc:v1::YWJj"},
+		{value: "enc:v1:key:%%%"},
+		{value: "enc:v1:key:YWJj", keyID: "key", payload: "YWJj", ok: true},
+	}
+	for _, tt := range tests {
+		keyID, payload, ok := Parse(tt.value)
+		if keyID != tt.keyID || payload != tt.payload || ok != tt.ok {
+			t.Errorf("Parse(%q) = %q, %q, %v; want %q, %q, %v", tt.value, keyID, payload, ok, tt.keyID, tt.payload, tt.ok)
+		}
+	}
+}
+
+func TestNewCipherRejectsColonInKeyID(t *testing.T) {
+	if _, err := NewCipher("a:b", make([]byte, 32)); err == nil {
+		t.Error("NewCipher accepted a key id containing ':'")
+	}
+}
@@ -0,0 +1,13 @@
+package i18n
+
+// german translates the English catalog
+var german = map[Key]string{
+	SuggestFixFields:     "Korrigiere die aufgeführten Felder und sende die Anfrage erneut.",
+	SuggestPullModel:     "Lade %s herunter oder wähle eine der installierten Alternativen.",
+	SuggestBackendDown:   "Prüfe, ob Ollama läuft. Anfragen werden in %d Sekunden automatisch wieder versucht.",
+	SuggestChatBudget:    "Dieser Chat hat sein tägliches Token-Budget aufgebraucht. Es wird um Mitternacht (UTC) zurückgesetzt, oder ein Administrator kann es erhöhen.",
+	SuggestKeyBudget:     "Dieser API-Schlüssel hat sein tägliches Token-Budget aufgebraucht. Es wird um Mitternacht (UTC) zurückgesetzt, oder ein Administrator kann es erhöhen.",
+	SuggestAcceptLicense: "Lies die Lizenz von %s und akzeptiere sie, bevor du das Modell verwendest.",
+	SuggestPolicyDenied:  "Formuliere die Nachricht um oder wende dich wegen der Inhaltsrichtlinie an einen Administrator.",
+	SuggestBandwidthCap:  "Das monatliche Download-Limit ist aufgebraucht. Es wird am Monatsersten (UTC) zurückgesetzt, oder ein Administrator kann es erhöhen; abgebrochene Downloads werden dort fortgesetzt, wo sie angehalten wurden.",
+}
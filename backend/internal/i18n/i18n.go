@@ -0,0 +1,77 @@
+// Package i18n renders user-facing messages from a keyed catalog in the
+// language a client asks for. English is the fallback for languages and keys
+// without a translation.
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Key identifies a message in the catalog
+type Key string
+
+// DefaultLanguage is used when no requested language is supported
+const DefaultLanguage = "en"
+
+// catalogs maps a base language tag to its messages. Messages are
+// fmt.Sprintf format strings; every translation of a key takes the same
+// arguments in the same order.
+var catalogs = map[string]map[Key]string{
+	"en": english,
+	"de": german,
+}
+
+// Supported returns the languages with a catalog, sorted
+func Supported() []string {
+	langs := make([]string, 0, len(catalogs))
+	for lang := range catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Negotiate picks the supported language best matching an Accept-Language
+// header, e.g. "de-DE,de;q=0.9,en;q=0.8". Region subtags are ignored.
+func Negotiate(acceptLanguage string) string {
+	best, bestQ := DefaultLanguage, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if _, ok := catalogs[base]; !ok {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > bestQ {
+			best, bestQ = base, q
+		}
+	}
+	return best
+}
+
+// T renders a message in the given language, falling back to English and
+// finally to the key itself
+func T(lang string, key Key, args ...any) string {
+	format, ok := catalogs[lang][key]
+	if !ok {
+		format, ok = english[key]
+	}
+	if !ok {
+		return string(key)
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
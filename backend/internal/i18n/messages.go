@@ -0,0 +1,25 @@
+package i18n
+
+// Suggestions shown alongside API errors, telling the user how to recover
+const (
+	SuggestFixFields     Key = "suggest.fix_fields"
+	SuggestPullModel     Key = "suggest.pull_model"
+	SuggestBackendDown   Key = "suggest.backend_down"
+	SuggestChatBudget    Key = "suggest.chat_budget"
+	SuggestKeyBudget     Key = "suggest.key_budget"
+	SuggestAcceptLicense Key = "suggest.accept_license"
+	SuggestPolicyDenied  Key = "suggest.policy_denied"
+	SuggestBandwidthCap  Key = "suggest.bandwidth_cap"
+)
+
+// english is the reference catalog; every key must have an entry here
+var english = map[Key]string{
+	SuggestFixFields:     "Correct the listed fields and send the request again.",
+	SuggestPullModel:     "Pull %s or pick one of the installed alternatives.",
+	SuggestBackendDown:   "Check that Ollama is running. Requests are retried automatically in %d seconds.",
+	SuggestChatBudget:    "This chat has used its daily token budget. It resets at midnight UTC, or an administrator can raise it.",
+	SuggestKeyBudget:     "This API key has used its daily token budget. It resets at midnight UTC, or an administrator can raise it.",
+	SuggestAcceptLicense: "Review the license of %s and accept it before using the model.",
+	SuggestPolicyDenied:  "Rephrase the message, or ask an administrator about the content policy.",
+	SuggestBandwidthCap:  "The monthly download cap is used up. It resets on the first of the month (UTC), or an administrator can raise it; interrupted pulls continue where they stopped.",
+}
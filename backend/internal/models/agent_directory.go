@@ -0,0 +1,134 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Filesystem tool operations, as recorded in the audit trail
+const (
+	FilesystemList  = "list"
+	FilesystemRead  = "read"
+	FilesystemWrite = "write"
+)
+
+// AgentDirectory is a directory an agent's filesystem tools may use
+type AgentDirectory struct {
+	ID      string `json:"id"`
+	AgentID string `json:"agent_id"`
+	// Path is absolute, with symlinks resolved
+	Path      string    `json:"path"`
+	Writable  bool      `json:"writable"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FilesystemAuditEntry records a filesystem tool call
+type FilesystemAuditEntry struct {
+	ID        int64     `json:"id"`
+	AgentID   string    `json:"agent_id"`
+	Operation string    `json:"operation"`
+	Path      string    `json:"path"`
+	Bytes     int64     `json:"bytes"`
+	Allowed   bool      `json:"allowed"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ListAgentDirectories returns an agent's directories, oldest first
+func ListAgentDirectories(db *sql.DB, agentID string) ([]AgentDirectory, error) {
+	rows, err := db.Query(`
+		SELECT id, agent_id, path, writable, created_at FROM agent_directories
+		WHERE agent_id = ? ORDER BY created_at, rowid`, agentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list agent directories: %w", err)
+	}
+	defer rows.Close()
+
+	dirs := []AgentDirectory{}
+	for rows.Next() {
+		var d AgentDirectory
+		var createdAt string
+		if err := rows.Scan(&d.ID, &d.AgentID, &d.Path, &d.Writable, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan agent directory: %w", err)
+		}
+		d.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+		dirs = append(dirs, d)
+	}
+	return dirs, rows.Err()
+}
+
+// AddAgentDirectory allows an agent to use a directory. Adding a directory
+// again updates whether it is writable.
+func AddAgentDirectory(db *sql.DB, d *AgentDirectory) error {
+	var createdAt string
+	err := db.QueryRow(`
+		INSERT INTO agent_directories (id, agent_id, path, writable, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(agent_id, path) DO UPDATE SET writable = excluded.writable
+		RETURNING id, created_at`,
+		uuid.New().String(), d.AgentID, d.Path, d.Writable, time.Now().UTC().Format(time.RFC3339)).Scan(&d.ID, &createdAt)
+	if err != nil {
+		return fmt.Errorf("failed to add agent directory: %w", err)
+	}
+	d.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	return nil
+}
+
+// RemoveAgentDirectory takes a directory away from an agent
+func RemoveAgentDirectory(db *sql.DB, agentID, id string) error {
+	result, err := db.Exec(`DELETE FROM agent_directories WHERE id = ? AND agent_id = ?`, id, agentID)
+	if err != nil {
+		return fmt.Errorf("failed to remove agent directory: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("agent directory not found")
+	}
+	return nil
+}
+
+// RecordFilesystemAccess appends a filesystem tool call to the audit trail
+func RecordFilesystemAccess(db *sql.DB, e *FilesystemAuditEntry) error {
+	e.CreatedAt = time.Now().UTC()
+	result, err := db.Exec(`
+		INSERT INTO filesystem_audit (agent_id, operation, path, bytes, allowed, error, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		e.AgentID, e.Operation, e.Path, e.Bytes, e.Allowed, e.Error, e.CreatedAt.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to record filesystem access: %w", err)
+	}
+	e.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// ListFilesystemAudit returns the most recent filesystem tool calls, newest
+// first, optionally limited to one agent
+func ListFilesystemAudit(db *sql.DB, agentID string, limit int) ([]FilesystemAuditEntry, error) {
+	query := `SELECT id, agent_id, operation, path, bytes, allowed, error, created_at FROM filesystem_audit`
+	var args []any
+	if agentID != "" {
+		query += ` WHERE agent_id = ?`
+		args = append(args, agentID)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list filesystem audit: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []FilesystemAuditEntry{}
+	for rows.Next() {
+		var e FilesystemAuditEntry
+		var createdAt string
+		if err := rows.Scan(&e.ID, &e.AgentID, &e.Operation, &e.Path, &e.Bytes, &e.Allowed, &e.Error, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan filesystem audit entry: %w", err)
+		}
+		e.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
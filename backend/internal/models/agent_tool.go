@@ -0,0 +1,84 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Tools that must be granted to an agent before it can use them
+const (
+	AgentToolCodeInterpreter = "code_interpreter"
+)
+
+// AgentToolGrant allows an agent to use a tool
+type AgentToolGrant struct {
+	AgentID   string    `json:"agent_id"`
+	Tool      string    `json:"tool"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ListAgentToolGrants returns the tools granted to an agent
+func ListAgentToolGrants(db *sql.DB, agentID string) ([]AgentToolGrant, error) {
+	rows, err := db.Query(`
+		SELECT agent_id, tool, created_at FROM agent_tool_grants
+		WHERE agent_id = ? ORDER BY tool`, agentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tool grants: %w", err)
+	}
+	defer rows.Close()
+
+	grants := []AgentToolGrant{}
+	for rows.Next() {
+		var g AgentToolGrant
+		var createdAt string
+		if err := rows.Scan(&g.AgentID, &g.Tool, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan tool grant: %w", err)
+		}
+		g.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+		grants = append(grants, g)
+	}
+	return grants, rows.Err()
+}
+
+// GrantAgentTool allows an agent to use a tool; granting it again is a no-op
+func GrantAgentTool(db *sql.DB, agentID, tool string) (*AgentToolGrant, error) {
+	now := time.Now().UTC()
+	if _, err := db.Exec(`
+		INSERT INTO agent_tool_grants (agent_id, tool, created_at) VALUES (?, ?, ?)
+		ON CONFLICT(agent_id, tool) DO NOTHING`,
+		agentID, tool, now.Format(time.RFC3339)); err != nil {
+		return nil, fmt.Errorf("failed to grant tool: %w", err)
+	}
+
+	g := &AgentToolGrant{AgentID: agentID, Tool: tool}
+	var createdAt string
+	if err := db.QueryRow(`SELECT created_at FROM agent_tool_grants WHERE agent_id = ? AND tool = ?`,
+		agentID, tool).Scan(&createdAt); err != nil {
+		return nil, fmt.Errorf("failed to get tool grant: %w", err)
+	}
+	g.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	return g, nil
+}
+
+// RevokeAgentTool takes a tool away from an agent
+func RevokeAgentTool(db *sql.DB, agentID, tool string) error {
+	result, err := db.Exec(`DELETE FROM agent_tool_grants WHERE agent_id = ? AND tool = ?`, agentID, tool)
+	if err != nil {
+		return fmt.Errorf("failed to revoke tool: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("tool grant not found")
+	}
+	return nil
+}
+
+// AgentHasTool reports whether an agent was granted a tool
+func AgentHasTool(db *sql.DB, agentID, tool string) (bool, error) {
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM agent_tool_grants WHERE agent_id = ? AND tool = ?`,
+		agentID, tool).Scan(&n); err != nil {
+		return false, fmt.Errorf("failed to check tool grant: %w", err)
+	}
+	return n > 0, nil
+}
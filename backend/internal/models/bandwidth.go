@@ -0,0 +1,137 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Bandwidth sources: what the bytes were downloaded for
+const (
+	BandwidthSourceOllamaPull = "ollama_pull"
+	BandwidthSourceWebFetch   = "web_fetch"
+	BandwidthSourceWebSearch  = "web_search"
+	BandwidthSourceRegistry   = "registry"
+)
+
+// BandwidthSources lists every source, for validation and stable output
+var BandwidthSources = []string{
+	BandwidthSourceOllamaPull,
+	BandwidthSourceWebFetch,
+	BandwidthSourceWebSearch,
+	BandwidthSourceRegistry,
+}
+
+// bandwidthCapsKey is the app_settings key holding BandwidthCaps
+const bandwidthCapsKey = "bandwidth_caps"
+
+// BandwidthCaps limits bytes downloaded per calendar month (UTC). A zero
+// limit means unlimited.
+type BandwidthCaps struct {
+	// MonthlyBytes caps all sources together
+	MonthlyBytes int64 `json:"monthly_bytes"`
+	// SourceMonthlyBytes caps single sources, e.g. {"ollama_pull": 50000000000}
+	SourceMonthlyBytes map[string]int64 `json:"source_monthly_bytes"`
+}
+
+// BandwidthDay is one day's downloaded bytes, in total and per source
+type BandwidthDay struct {
+	Day     string           `json:"day"`
+	Total   int64            `json:"total"`
+	Sources map[string]int64 `json:"sources"`
+}
+
+// GetBandwidthCaps returns the configured caps (unlimited if unset)
+func GetBandwidthCaps(db *sql.DB) (*BandwidthCaps, error) {
+	caps := &BandwidthCaps{SourceMonthlyBytes: map[string]int64{}}
+
+	var value string
+	err := db.QueryRow(`SELECT value FROM app_settings WHERE key = ?`, bandwidthCapsKey).Scan(&value)
+	if err == sql.ErrNoRows {
+		return caps, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bandwidth caps: %w", err)
+	}
+	if err := json.Unmarshal([]byte(value), caps); err != nil {
+		return nil, fmt.Errorf("failed to parse bandwidth caps: %w", err)
+	}
+	if caps.SourceMonthlyBytes == nil {
+		caps.SourceMonthlyBytes = map[string]int64{}
+	}
+	return caps, nil
+}
+
+// SaveBandwidthCaps replaces the configured caps
+func SaveBandwidthCaps(db *sql.DB, caps *BandwidthCaps) error {
+	value, err := json.Marshal(caps)
+	if err != nil {
+		return fmt.Errorf("failed to encode bandwidth caps: %w", err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO app_settings (key, value, updated_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		bandwidthCapsKey, string(value), time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to save bandwidth caps: %w", err)
+	}
+	return nil
+}
+
+// RecordBandwidth adds downloaded bytes to a source's usage for the given day
+func RecordBandwidth(db *sql.DB, day, source string, bytes int64) error {
+	_, err := db.Exec(`
+		INSERT INTO bandwidth_usage (day, source, bytes)
+		VALUES (?, ?, ?)
+		ON CONFLICT(day, source) DO UPDATE SET bytes = bytes + excluded.bytes`,
+		day, source, bytes)
+	if err != nil {
+		return fmt.Errorf("failed to record bandwidth usage: %w", err)
+	}
+	return nil
+}
+
+// GetBandwidthTotal returns the bytes downloaded between two days
+// (inclusive), for one source or for all of them when source is empty
+func GetBandwidthTotal(db *sql.DB, from, to, source string) (int64, error) {
+	var total int64
+	err := db.QueryRow(`
+		SELECT COALESCE(SUM(bytes), 0) FROM bandwidth_usage
+		WHERE day >= ? AND day <= ? AND (? = '' OR source = ?)`,
+		from, to, source, source).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get bandwidth usage: %w", err)
+	}
+	return total, nil
+}
+
+// ListBandwidthUsage returns the bytes downloaded per day between two days
+// (inclusive), oldest first
+func ListBandwidthUsage(db *sql.DB, from, to string) ([]BandwidthDay, error) {
+	rows, err := db.Query(`
+		SELECT day, source, bytes FROM bandwidth_usage
+		WHERE day >= ? AND day <= ?
+		ORDER BY day, source`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bandwidth usage: %w", err)
+	}
+	defer rows.Close()
+
+	days := []BandwidthDay{}
+	for rows.Next() {
+		var day, source string
+		var bytes int64
+		if err := rows.Scan(&day, &source, &bytes); err != nil {
+			return nil, fmt.Errorf("failed to scan bandwidth usage: %w", err)
+		}
+		if len(days) == 0 || days[len(days)-1].Day != day {
+			days = append(days, BandwidthDay{Day: day, Sources: map[string]int64{}})
+		}
+		d := &days[len(days)-1]
+		d.Sources[source] += bytes
+		d.Total += bytes
+	}
+	return days, rows.Err()
+}
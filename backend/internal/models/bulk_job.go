@@ -0,0 +1,242 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Bulk job statuses
+const (
+	BulkJobQueued    = "queued"
+	BulkJobRunning   = "running"
+	BulkJobCompleted = "completed"
+	BulkJobFailed    = "failed"
+	BulkJobCancelled = "cancelled"
+	// BulkJobDead is a job that failed on every attempt; dead jobs are kept
+	// for inspection until they are retried
+	BulkJobDead = "dead"
+)
+
+// Bulk job kinds
+const (
+	BulkJobDeleteChats       = "delete_chats"
+	BulkJobArchiveChats      = "archive_chats"
+	BulkJobReembedCollection = "reembed_collection"
+	BulkJobVerifyModels      = "verify_models"
+	BulkJobTranslateChat     = "translate_chat"
+	BulkJobPullModels        = "pull_models"
+	BulkJobRecrawlDocuments  = "recrawl_documents"
+)
+
+// Bulk job item statuses
+const (
+	BulkItemOK     = "ok"
+	BulkItemFailed = "failed"
+)
+
+// BulkJob is a batch operation run in the background. A job works through
+// its items one at a time; an item that fails is recorded and the job moves
+// on, so Failed counts items while Error is set only when the job as a whole
+// couldn't finish.
+type BulkJob struct {
+	ID     string          `json:"id"`
+	Kind   string          `json:"kind"`
+	Status string          `json:"status"`
+	Params json.RawMessage `json:"params"`
+	// Items are the IDs the job works through, stored so an interrupted
+	// job can carry on where it stopped
+	Items  []string `json:"-"`
+	Total  int      `json:"total"`
+	Done   int      `json:"done"`
+	Failed int      `json:"failed"`
+	// Results has one entry per item processed so far, in order
+	Results []BulkJobItem `json:"results"`
+	Error   string        `json:"error,omitempty"`
+	// Attempts counts the runs of the job that failed or were interrupted;
+	// a queued job with NextRunAt set waits to be retried until then
+	Attempts  int        `json:"attempts"`
+	NextRunAt *time.Time `json:"next_run_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// BulkJobItem is the outcome of one item of a bulk job
+type BulkJobItem struct {
+	// ID names the item: a chat or document ID, or a model name
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Finished reports whether the job is no longer queued or running
+func (j *BulkJob) Finished() bool {
+	return j.Status != BulkJobQueued && j.Status != BulkJobRunning
+}
+
+// bulkJobColumns is the column list matching scanBulkJob
+const bulkJobColumns = `id, kind, status, params, items, total, done, failed, results, error, attempts, next_run_at, created_at, updated_at`
+
+// scanBulkJob scans a row selected with bulkJobColumns
+func scanBulkJob(row rowScanner) (*BulkJob, error) {
+	j := &BulkJob{}
+	var params, items, results, createdAt, updatedAt string
+	var nextRunAt sql.NullString
+	if err := row.Scan(&j.ID, &j.Kind, &j.Status, &params, &items, &j.Total, &j.Done, &j.Failed, &results,
+		&j.Error, &j.Attempts, &nextRunAt, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	j.Params = json.RawMessage(params)
+	if err := json.Unmarshal([]byte(items), &j.Items); err != nil {
+		return nil, fmt.Errorf("failed to decode job items: %w", err)
+	}
+	if err := json.Unmarshal([]byte(results), &j.Results); err != nil {
+		return nil, fmt.Errorf("failed to decode job results: %w", err)
+	}
+	if nextRunAt.Valid {
+		if t, err := time.Parse(time.RFC3339, nextRunAt.String); err == nil {
+			j.NextRunAt = &t
+		}
+	}
+	j.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	j.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
+	return j, nil
+}
+
+// CreateBulkJob stores a new job
+func CreateBulkJob(db *sql.DB, j *BulkJob) error {
+	if j.ID == "" {
+		j.ID = uuid.New().String()
+	}
+	if len(j.Params) == 0 {
+		j.Params = json.RawMessage("{}")
+	}
+	if j.Results == nil {
+		j.Results = []BulkJobItem{}
+	}
+	if j.Items == nil {
+		j.Items = []string{}
+	}
+	items, err := json.Marshal(j.Items)
+	if err != nil {
+		return fmt.Errorf("failed to encode job items: %w", err)
+	}
+	now := time.Now().UTC()
+	j.CreatedAt = now
+	j.UpdatedAt = now
+
+	_, err = db.Exec(`
+		INSERT INTO bulk_jobs (id, kind, status, params, items, total, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		j.ID, j.Kind, j.Status, string(j.Params), string(items), j.Total, now.Format(time.RFC3339), now.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to create job: %w", err)
+	}
+	return nil
+}
+
+// GetBulkJob returns a job, or nil if it doesn't exist
+func GetBulkJob(db *sql.DB, id string) (*BulkJob, error) {
+	j, err := scanBulkJob(db.QueryRow(`SELECT `+bulkJobColumns+` FROM bulk_jobs WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	return j, nil
+}
+
+// ListBulkJobs returns the most recent jobs, newest first, optionally of one
+// kind and in one status
+func ListBulkJobs(db *sql.DB, kind, status string, limit int) ([]BulkJob, error) {
+	query := `SELECT ` + bulkJobColumns + ` FROM bulk_jobs WHERE 1 = 1`
+	var args []any
+	if kind != "" {
+		query += ` AND kind = ?`
+		args = append(args, kind)
+	}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY created_at DESC, rowid DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []BulkJob{}
+	for rows.Next() {
+		j, err := scanBulkJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, *j)
+	}
+	return jobs, rows.Err()
+}
+
+// SaveBulkJobProgress stores a job's status, counters, results and retry state
+func SaveBulkJobProgress(db *sql.DB, j *BulkJob) error {
+	j.UpdatedAt = time.Now().UTC()
+	results, err := json.Marshal(j.Results)
+	if err != nil {
+		return fmt.Errorf("failed to encode job results: %w", err)
+	}
+	var nextRunAt any
+	if j.NextRunAt != nil {
+		nextRunAt = j.NextRunAt.UTC().Format(time.RFC3339)
+	}
+	_, err = db.Exec(`
+		UPDATE bulk_jobs SET status = ?, total = ?, done = ?, failed = ?, results = ?, error = ?,
+			attempts = ?, next_run_at = ?, updated_at = ?
+		WHERE id = ?`,
+		j.Status, j.Total, j.Done, j.Failed, string(results), j.Error,
+		j.Attempts, nextRunAt, j.UpdatedAt.Format(time.RFC3339), j.ID)
+	if err != nil {
+		return fmt.Errorf("failed to save job progress: %w", err)
+	}
+	return nil
+}
+
+// ListUnfinishedBulkJobs returns the jobs still queued or running, oldest
+// first, e.g. those a previous process left behind
+func ListUnfinishedBulkJobs(db *sql.DB) ([]BulkJob, error) {
+	rows, err := db.Query(`SELECT `+bulkJobColumns+` FROM bulk_jobs
+		WHERE status IN (?, ?) ORDER BY created_at, rowid`, BulkJobQueued, BulkJobRunning)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unfinished jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []BulkJob{}
+	for rows.Next() {
+		j, err := scanBulkJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, *j)
+	}
+	return jobs, rows.Err()
+}
+
+// FailInterruptedBulkJobs marks jobs left queued or running by a previous
+// process as failed, when there is nothing to resume them with. The items
+// they finished stay done.
+func FailInterruptedBulkJobs(db *sql.DB) error {
+	_, err := db.Exec(`
+		UPDATE bulk_jobs SET status = ?, error = 'interrupted by server restart', next_run_at = NULL, updated_at = ?
+		WHERE status IN (?, ?)`,
+		BulkJobFailed, time.Now().UTC().Format(time.RFC3339), BulkJobQueued, BulkJobRunning)
+	if err != nil {
+		return fmt.Errorf("failed to clean up interrupted jobs: %w", err)
+	}
+	return nil
+}
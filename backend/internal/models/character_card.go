@@ -0,0 +1,178 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CharacterCard is a persona imported from a SillyTavern-compatible
+// character card. The fields follow the card spec; {{char}} and {{user}}
+// macros are kept as written and replaced when the prompt is assembled.
+type CharacterCard struct {
+	ID                      string   `json:"id"`
+	Name                    string   `json:"name"`
+	Description             string   `json:"description"`
+	Personality             string   `json:"personality"`
+	Scenario                string   `json:"scenario"`
+	FirstMessage            string   `json:"first_message"`
+	AlternateGreetings      []string `json:"alternate_greetings"`
+	ExampleMessages         string   `json:"example_messages"`
+	SystemPrompt            string   `json:"system_prompt"`
+	PostHistoryInstructions string   `json:"post_history_instructions"`
+	CreatorNotes            string   `json:"creator_notes"`
+	Creator                 string   `json:"creator"`
+	CharacterVersion        string   `json:"character_version"`
+	Tags                    []string `json:"tags"`
+	// Spec is the card format it was imported from (chara_card_v2, ...)
+	Spec string `json:"spec"`
+	// HasAvatar is set when the card came with an image; Avatar is only
+	// loaded by GetCharacterAvatar
+	HasAvatar bool      `json:"has_avatar"`
+	Avatar    []byte    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// characterCardColumns is the column list matching scanCharacterCard
+const characterCardColumns = `id, name, description, personality, scenario, first_message, alternate_greetings,
+	example_messages, system_prompt, post_history_instructions, creator_notes, creator, character_version, tags,
+	spec, avatar IS NOT NULL, created_at, updated_at`
+
+// scanCharacterCard scans a row selected with characterCardColumns
+func scanCharacterCard(row rowScanner) (*CharacterCard, error) {
+	card := &CharacterCard{}
+	var greetings, tags, createdAt, updatedAt string
+	if err := row.Scan(&card.ID, &card.Name, &card.Description, &card.Personality, &card.Scenario,
+		&card.FirstMessage, &greetings, &card.ExampleMessages, &card.SystemPrompt, &card.PostHistoryInstructions,
+		&card.CreatorNotes, &card.Creator, &card.CharacterVersion, &tags, &card.Spec, &card.HasAvatar,
+		&createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(greetings), &card.AlternateGreetings); err != nil {
+		return nil, fmt.Errorf("failed to parse greetings for character %s: %w", card.ID, err)
+	}
+	if err := json.Unmarshal([]byte(tags), &card.Tags); err != nil {
+		return nil, fmt.Errorf("failed to parse tags for character %s: %w", card.ID, err)
+	}
+	card.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	card.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
+	return card, nil
+}
+
+// CreateCharacterCard stores a new character card with its avatar
+func CreateCharacterCard(db *sql.DB, card *CharacterCard) error {
+	if card.ID == "" {
+		card.ID = uuid.New().String()
+	}
+	if card.AlternateGreetings == nil {
+		card.AlternateGreetings = []string{}
+	}
+	if card.Tags == nil {
+		card.Tags = []string{}
+	}
+	greetings, err := json.Marshal(card.AlternateGreetings)
+	if err != nil {
+		return fmt.Errorf("failed to encode greetings: %w", err)
+	}
+	tags, err := json.Marshal(card.Tags)
+	if err != nil {
+		return fmt.Errorf("failed to encode tags: %w", err)
+	}
+	now := time.Now().UTC()
+	card.CreatedAt = now
+	card.UpdatedAt = now
+	card.HasAvatar = len(card.Avatar) > 0
+
+	var avatar any
+	if card.HasAvatar {
+		avatar = card.Avatar
+	}
+	_, err = db.Exec(`
+		INSERT INTO character_cards (id, name, description, personality, scenario, first_message,
+			alternate_greetings, example_messages, system_prompt, post_history_instructions, creator_notes,
+			creator, character_version, tags, spec, avatar, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		card.ID, card.Name, card.Description, card.Personality, card.Scenario, card.FirstMessage,
+		string(greetings), card.ExampleMessages, card.SystemPrompt, card.PostHistoryInstructions, card.CreatorNotes,
+		card.Creator, card.CharacterVersion, string(tags), card.Spec, avatar,
+		now.Format(time.RFC3339), now.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to create character card: %w", err)
+	}
+	return nil
+}
+
+// GetCharacterCard returns a character card without its avatar, or nil if
+// it doesn't exist
+func GetCharacterCard(db *sql.DB, id string) (*CharacterCard, error) {
+	card, err := scanCharacterCard(db.QueryRow(`SELECT `+characterCardColumns+` FROM character_cards WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get character card: %w", err)
+	}
+	return card, nil
+}
+
+// ListCharacterCards returns all character cards ordered by name, without
+// their avatars
+func ListCharacterCards(db *sql.DB) ([]CharacterCard, error) {
+	rows, err := db.Query(`SELECT ` + characterCardColumns + ` FROM character_cards ORDER BY name COLLATE NOCASE`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list character cards: %w", err)
+	}
+	defer rows.Close()
+
+	cards := []CharacterCard{}
+	for rows.Next() {
+		card, err := scanCharacterCard(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan character card: %w", err)
+		}
+		cards = append(cards, *card)
+	}
+	return cards, rows.Err()
+}
+
+// GetCharacterAvatar returns a character card's avatar image, or nil if it
+// has none
+func GetCharacterAvatar(db *sql.DB, id string) ([]byte, error) {
+	var avatar []byte
+	err := db.QueryRow(`SELECT avatar FROM character_cards WHERE id = ?`, id).Scan(&avatar)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get character avatar: %w", err)
+	}
+	return avatar, nil
+}
+
+// DeleteCharacterCard removes a character card. Chats playing it keep their
+// messages and continue without the persona.
+func DeleteCharacterCard(db *sql.DB, id string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to delete character card: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM character_cards WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete character card: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("character card not found")
+	}
+	if _, err := tx.Exec(`
+		UPDATE chats SET character_id = NULL, updated_at = ?, sync_version = sync_version + 1
+		WHERE character_id = ?`, time.Now().UTC().Format(time.RFC3339), id); err != nil {
+		return fmt.Errorf("failed to detach character chats: %w", err)
+	}
+	return tx.Commit()
+}
@@ -3,12 +3,17 @@ package models
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-// Chat represents a chat conversation
+// Chat represents a chat conversation. Locale, Timezone and InjectDateTime
+// set the date context given to the chat's model; nil follows the inference
+// defaults. CharacterID is the character card the chat plays, and Language
+// the language it continues in after being translated. ExpandURLs fetches
+// the pages linked in the user's messages into the model's context.
 type Chat struct {
 	ID             string    `json:"id"`
 	Title          string    `json:"title"`
@@ -16,12 +21,94 @@ type Chat struct {
 	Pinned         bool      `json:"pinned"`
 	Archived       bool      `json:"archived"`
 	SystemPromptID *string   `json:"system_prompt_id,omitempty"`
+	KeepAlive      *string   `json:"keep_alive,omitempty"`
+	ProjectID      *string   `json:"project_id,omitempty"`
+	Locale         *string   `json:"locale,omitempty"`
+	Timezone       *string   `json:"timezone,omitempty"`
+	InjectDateTime *bool     `json:"inject_datetime,omitempty"`
+	CharacterID    *string   `json:"character_id,omitempty"`
+	Language       *string   `json:"language,omitempty"`
+	ExpandURLs     *bool     `json:"expand_urls,omitempty"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 	SyncVersion    int64     `json:"sync_version"`
 	Messages       []Message `json:"messages,omitempty"`
 }
 
+// chatColumns is the column list shared by queries that scan full Chat rows
+const chatColumns = `id, title, model, pinned, archived, system_prompt_id, keep_alive, project_id, locale, timezone,
+	inject_datetime, character_id, language, expand_urls, created_at, updated_at, sync_version`
+
+// UnfiledProject filters chat listings to chats that belong to no project
+const UnfiledProject = "none"
+
+// projectFilter returns the WHERE clause restricting chats to a project, or
+// to unfiled chats for UnfiledProject. An empty projectID matches all chats.
+func projectFilter(projectID string) (string, []any) {
+	switch projectID {
+	case "":
+		return "", nil
+	case UnfiledProject:
+		return " AND project_id IS NULL", nil
+	default:
+		return " AND project_id = ?", []any{projectID}
+	}
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanChat scans a row selected with chatColumns into a Chat
+func scanChat(row rowScanner) (*Chat, error) {
+	chat := &Chat{}
+	var createdAt, updatedAt string
+	var pinned, archived int
+	var systemPromptID, keepAlive, projectID, locale, timezone, characterID, language sql.NullString
+	var injectDateTime, expandURLs sql.NullBool
+
+	if err := row.Scan(&chat.ID, &chat.Title, &chat.Model, &pinned, &archived, &systemPromptID,
+		&keepAlive, &projectID, &locale, &timezone, &injectDateTime, &characterID, &language, &expandURLs,
+		&createdAt, &updatedAt, &chat.SyncVersion); err != nil {
+		return nil, err
+	}
+
+	chat.Pinned = pinned == 1
+	chat.Archived = archived == 1
+	if systemPromptID.Valid {
+		chat.SystemPromptID = &systemPromptID.String
+	}
+	if keepAlive.Valid {
+		chat.KeepAlive = &keepAlive.String
+	}
+	if projectID.Valid {
+		chat.ProjectID = &projectID.String
+	}
+	if locale.Valid {
+		chat.Locale = &locale.String
+	}
+	if timezone.Valid {
+		chat.Timezone = &timezone.String
+	}
+	if injectDateTime.Valid {
+		chat.InjectDateTime = &injectDateTime.Bool
+	}
+	if characterID.Valid {
+		chat.CharacterID = &characterID.String
+	}
+	if language.Valid {
+		chat.Language = &language.String
+	}
+	if expandURLs.Valid {
+		chat.ExpandURLs = &expandURLs.Bool
+	}
+	chat.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	chat.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
+
+	return chat, nil
+}
+
 // Message represents a chat message
 type Message struct {
 	ID           string       `json:"id"`
@@ -32,7 +119,10 @@ type Message struct {
 	SiblingIndex int          `json:"sibling_index"`
 	CreatedAt    time.Time    `json:"created_at"`
 	SyncVersion  int64        `json:"sync_version"`
+	SettingsHash *string      `json:"settings_hash,omitempty"`
 	Attachments  []Attachment `json:"attachments,omitempty"`
+	// Seed is the sampling seed the message was generated with
+	Seed *int64 `json:"seed,omitempty"`
 }
 
 // Attachment represents a file attached to a message
@@ -55,9 +145,11 @@ func CreateChat(db *sql.DB, chat *Chat) error {
 	chat.SyncVersion = 1
 
 	_, err := db.Exec(`
-		INSERT INTO chats (id, title, model, pinned, archived, system_prompt_id, created_at, updated_at, sync_version)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		chat.ID, chat.Title, chat.Model, chat.Pinned, chat.Archived, chat.SystemPromptID,
+		INSERT INTO chats (id, title, model, pinned, archived, system_prompt_id, keep_alive, project_id,
+			locale, timezone, inject_datetime, character_id, language, expand_urls, created_at, updated_at, sync_version)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		chat.ID, chat.Title, chat.Model, chat.Pinned, chat.Archived, chat.SystemPromptID, chat.KeepAlive, chat.ProjectID,
+		chat.Locale, chat.Timezone, chat.InjectDateTime, chat.CharacterID, chat.Language, chat.ExpandURLs,
 		chat.CreatedAt.Format(time.RFC3339), chat.UpdatedAt.Format(time.RFC3339), chat.SyncVersion,
 	)
 	if err != nil {
@@ -68,32 +160,11 @@ func CreateChat(db *sql.DB, chat *Chat) error {
 
 // GetChat retrieves a chat by ID with its messages
 func GetChat(db *sql.DB, id string) (*Chat, error) {
-	chat := &Chat{}
-	var createdAt, updatedAt string
-	var pinned, archived int
-	var systemPromptID sql.NullString
-
-	err := db.QueryRow(`
-		SELECT id, title, model, pinned, archived, system_prompt_id, created_at, updated_at, sync_version
-		FROM chats WHERE id = ?`, id).Scan(
-		&chat.ID, &chat.Title, &chat.Model, &pinned, &archived, &systemPromptID,
-		&createdAt, &updatedAt, &chat.SyncVersion,
-	)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to get chat: %w", err)
+	chat, err := GetChatMetadata(db, id)
+	if err != nil || chat == nil {
+		return chat, err
 	}
 
-	chat.Pinned = pinned == 1
-	chat.Archived = archived == 1
-	if systemPromptID.Valid {
-		chat.SystemPromptID = &systemPromptID.String
-	}
-	chat.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-	chat.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
-
 	// Get messages
 	messages, err := GetMessagesByChatID(db, id)
 	if err != nil {
@@ -104,17 +175,30 @@ func GetChat(db *sql.DB, id string) (*Chat, error) {
 	return chat, nil
 }
 
-// ListChats retrieves all chats ordered by updated_at
-func ListChats(db *sql.DB, includeArchived bool) ([]Chat, error) {
-	query := `
-		SELECT id, title, model, pinned, archived, system_prompt_id, created_at, updated_at, sync_version
-		FROM chats`
+// GetChatMetadata retrieves a chat by ID without loading its messages
+func GetChatMetadata(db *sql.DB, id string) (*Chat, error) {
+	chat, err := scanChat(db.QueryRow(`SELECT `+chatColumns+` FROM chats WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat: %w", err)
+	}
+	return chat, nil
+}
+
+// ListChats retrieves all chats ordered by updated_at, optionally limited to
+// a project (see projectFilter)
+func ListChats(db *sql.DB, includeArchived bool, projectID string) ([]Chat, error) {
+	query := `SELECT ` + chatColumns + ` FROM chats WHERE 1=1`
 	if !includeArchived {
-		query += " WHERE archived = 0"
+		query += " AND archived = 0"
 	}
+	filter, args := projectFilter(projectID)
+	query += filter
 	query += " ORDER BY pinned DESC, updated_at DESC"
 
-	rows, err := db.Query(query)
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list chats: %w", err)
 	}
@@ -122,24 +206,11 @@ func ListChats(db *sql.DB, includeArchived bool) ([]Chat, error) {
 
 	var chats []Chat
 	for rows.Next() {
-		var chat Chat
-		var createdAt, updatedAt string
-		var pinned, archived int
-		var systemPromptID sql.NullString
-
-		if err := rows.Scan(&chat.ID, &chat.Title, &chat.Model, &pinned, &archived, &systemPromptID,
-			&createdAt, &updatedAt, &chat.SyncVersion); err != nil {
+		chat, err := scanChat(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan chat: %w", err)
 		}
-
-		chat.Pinned = pinned == 1
-		chat.Archived = archived == 1
-		if systemPromptID.Valid {
-			chat.SystemPromptID = &systemPromptID.String
-		}
-		chat.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-		chat.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
-		chats = append(chats, chat)
+		chats = append(chats, *chat)
 	}
 
 	return chats, nil
@@ -152,9 +223,12 @@ func UpdateChat(db *sql.DB, chat *Chat) error {
 
 	result, err := db.Exec(`
 		UPDATE chats SET title = ?, model = ?, pinned = ?, archived = ?, system_prompt_id = ?,
-		updated_at = ?, sync_version = ?
+		keep_alive = ?, project_id = ?, locale = ?, timezone = ?, inject_datetime = ?, character_id = ?, language = ?,
+		expand_urls = ?, updated_at = ?, sync_version = ?
 		WHERE id = ?`,
 		chat.Title, chat.Model, chat.Pinned, chat.Archived, chat.SystemPromptID,
+		chat.KeepAlive, chat.ProjectID, chat.Locale, chat.Timezone, chat.InjectDateTime, chat.CharacterID, chat.Language,
+		chat.ExpandURLs,
 		chat.UpdatedAt.Format(time.RFC3339), chat.SyncVersion, chat.ID,
 	)
 	if err != nil {
@@ -169,6 +243,70 @@ func UpdateChat(db *sql.DB, chat *Chat) error {
 	return nil
 }
 
+// ChatFilter selects chats for bulk operations. Empty fields match any chat.
+type ChatFilter struct {
+	// ProjectID limits the match to a project's chats (see projectFilter)
+	ProjectID string `json:"project_id,omitempty"`
+	Model     string `json:"model,omitempty"`
+	// TitleContains matches chats whose title contains it, ignoring case
+	TitleContains string `json:"title_contains,omitempty"`
+	// UpdatedBefore matches chats last updated before it
+	UpdatedBefore *time.Time `json:"updated_before,omitempty"`
+	// IncludePinned also matches pinned chats, which are skipped by default
+	IncludePinned bool `json:"include_pinned,omitempty"`
+}
+
+// FindUnarchivedChatIDs returns the IDs of unarchived chats matching a
+// filter, least recently updated first
+func FindUnarchivedChatIDs(db *sql.DB, f ChatFilter) ([]string, error) {
+	filter, args := projectFilter(f.ProjectID)
+	query := `SELECT id FROM chats WHERE archived = 0` + filter
+	if f.Model != "" {
+		query += ` AND model = ?`
+		args = append(args, f.Model)
+	}
+	if f.TitleContains != "" {
+		query += ` AND instr(lower(title), ?) > 0`
+		args = append(args, strings.ToLower(f.TitleContains))
+	}
+	if f.UpdatedBefore != nil {
+		query += ` AND datetime(updated_at) < datetime(?)`
+		args = append(args, f.UpdatedBefore.UTC().Format(time.RFC3339))
+	}
+	if !f.IncludePinned {
+		query += ` AND pinned = 0`
+	}
+	query += ` ORDER BY updated_at ASC`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find chats: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan chat: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ArchiveChat archives a chat, keeping its updated_at so it sorts as before
+func ArchiveChat(db *sql.DB, id string) error {
+	result, err := db.Exec(`UPDATE chats SET archived = 1, sync_version = sync_version + 1 WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to archive chat: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("chat not found")
+	}
+	return nil
+}
+
 // DeleteChat deletes a chat and its associated messages
 func DeleteChat(db *sql.DB, id string) error {
 	result, err := db.Exec("DELETE FROM chats WHERE id = ?", id)
@@ -184,7 +322,7 @@ func DeleteChat(db *sql.DB, id string) error {
 	return nil
 }
 
-// CreateMessage creates a new message in the database
+// CreateMessage creates a new message in the database, with its attachments
 func CreateMessage(db *sql.DB, msg *Message) error {
 	if msg.ID == "" {
 		msg.ID = uuid.New().String()
@@ -192,27 +330,126 @@ func CreateMessage(db *sql.DB, msg *Message) error {
 	msg.CreatedAt = time.Now().UTC()
 	msg.SyncVersion = 1
 
-	_, err := db.Exec(`
-		INSERT INTO messages (id, chat_id, parent_id, role, content, sibling_index, created_at, sync_version)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-		msg.ID, msg.ChatID, msg.ParentID, msg.Role, msg.Content,
-		msg.SiblingIndex, msg.CreatedAt.Format(time.RFC3339), msg.SyncVersion,
+	content, err := EncryptContent(msg.Content)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt message: %w", err)
+	}
+
+	// The message and its attachments are stored together or not at all
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO messages (id, chat_id, parent_id, role, content, sibling_index, created_at, sync_version, settings_hash, seed)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		msg.ID, msg.ChatID, msg.ParentID, msg.Role, content,
+		msg.SiblingIndex, msg.CreatedAt.Format(time.RFC3339), msg.SyncVersion, msg.SettingsHash, msg.Seed,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create message: %w", err)
 	}
+	for i := range msg.Attachments {
+		a := &msg.Attachments[i]
+		if a.ID == "" {
+			a.ID = uuid.New().String()
+		}
+		a.MessageID = msg.ID
+		data, err := EncryptAttachment(a.Data)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt attachment: %w", err)
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO attachments (id, message_id, mime_type, data, filename)
+			VALUES (?, ?, ?, ?, ?)`,
+			a.ID, a.MessageID, a.MimeType, data, a.Filename); err != nil {
+			return fmt.Errorf("failed to create attachment: %w", err)
+		}
+	}
 
 	// Update chat's updated_at timestamp
-	db.Exec("UPDATE chats SET updated_at = ?, sync_version = sync_version + 1 WHERE id = ?",
+	tx.Exec("UPDATE chats SET updated_at = ?, sync_version = sync_version + 1 WHERE id = ?",
 		time.Now().UTC().Format(time.RFC3339), msg.ChatID)
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit message: %w", err)
+	}
+	return nil
+}
+
+// messageColumns is the column list matching scanMessage
+const messageColumns = `id, chat_id, parent_id, role, content, sibling_index, created_at, sync_version, settings_hash, seed`
+
+// scanMessage scans a row selected with messageColumns and decrypts its content
+func scanMessage(row rowScanner) (*Message, error) {
+	var msg Message
+	var createdAt string
+	var parentID, settingsHash sql.NullString
+	var seed sql.NullInt64
+	if err := row.Scan(&msg.ID, &msg.ChatID, &parentID, &msg.Role,
+		&msg.Content, &msg.SiblingIndex, &createdAt, &msg.SyncVersion, &settingsHash, &seed); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if msg.Content, err = DecryptContent(msg.Content); err != nil {
+		return nil, fmt.Errorf("failed to decrypt message %s: %w", msg.ID, err)
+	}
+	if parentID.Valid {
+		msg.ParentID = &parentID.String
+	}
+	if settingsHash.Valid {
+		msg.SettingsHash = &settingsHash.String
+	}
+	if seed.Valid {
+		msg.Seed = &seed.Int64
+	}
+	msg.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	return &msg, nil
+}
+
+// GetMessage returns a message in a chat, or nil if it doesn't exist
+func GetMessage(db *sql.DB, chatID, id string) (*Message, error) {
+	msg, err := scanMessage(db.QueryRow(`SELECT `+messageColumns+`
+		FROM messages WHERE id = ? AND chat_id = ?`, id, chatID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	return msg, nil
+}
+
+// UpdateMessageContent replaces a message's content, settings hash and seed
+// in place, bumping its sync version
+func UpdateMessageContent(db *sql.DB, msg *Message) error {
+	content, err := EncryptContent(msg.Content)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt message: %w", err)
+	}
+
+	result, err := db.Exec(`
+		UPDATE messages SET content = ?, settings_hash = ?, seed = ?, sync_version = sync_version + 1
+		WHERE id = ? AND chat_id = ?`, content, msg.SettingsHash, msg.Seed, msg.ID, msg.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to update message: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("message not found")
+	}
+	msg.SyncVersion++
+
+	db.Exec("UPDATE chats SET updated_at = ?, sync_version = sync_version + 1 WHERE id = ?",
+		time.Now().UTC().Format(time.RFC3339), msg.ChatID)
 	return nil
 }
 
 // GetMessagesByChatID retrieves all messages for a chat
 func GetMessagesByChatID(db *sql.DB, chatID string) ([]Message, error) {
-	rows, err := db.Query(`
-		SELECT id, chat_id, parent_id, role, content, sibling_index, created_at, sync_version
+	rows, err := db.Query(`SELECT `+messageColumns+`
 		FROM messages WHERE chat_id = ? ORDER BY created_at ASC`, chatID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get messages: %w", err)
@@ -221,29 +458,55 @@ func GetMessagesByChatID(db *sql.DB, chatID string) ([]Message, error) {
 
 	var messages []Message
 	for rows.Next() {
-		var msg Message
-		var createdAt string
-		var parentID sql.NullString
-
-		if err := rows.Scan(&msg.ID, &msg.ChatID, &parentID, &msg.Role,
-			&msg.Content, &msg.SiblingIndex, &createdAt, &msg.SyncVersion); err != nil {
+		msg, err := scanMessage(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan message: %w", err)
 		}
-
-		if parentID.Valid {
-			msg.ParentID = &parentID.String
-		}
-		msg.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-		messages = append(messages, msg)
+		messages = append(messages, *msg)
 	}
+	rows.Close()
 
+	if err := loadAttachments(db, chatID, messages); err != nil {
+		return nil, err
+	}
 	return messages, nil
 }
 
+// loadAttachments fills in the attachments of a chat's messages
+func loadAttachments(db *sql.DB, chatID string, messages []Message) error {
+	rows, err := db.Query(`
+		SELECT a.id, a.message_id, a.mime_type, a.data, a.filename
+		FROM attachments a JOIN messages m ON m.id = a.message_id
+		WHERE m.chat_id = ? ORDER BY a.rowid`, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to get attachments: %w", err)
+	}
+	defer rows.Close()
+
+	byMessage := make(map[string][]Attachment)
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.ID, &a.MessageID, &a.MimeType, &a.Data, &a.Filename); err != nil {
+			return fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		var err error
+		if a.Data, err = DecryptAttachment(a.Data); err != nil {
+			return fmt.Errorf("failed to decrypt attachment %s: %w", a.ID, err)
+		}
+		byMessage[a.MessageID] = append(byMessage[a.MessageID], a)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to get attachments: %w", err)
+	}
+	for i := range messages {
+		messages[i].Attachments = byMessage[messages[i].ID]
+	}
+	return nil
+}
+
 // GetChangedChats retrieves chats changed since a given sync version
 func GetChangedChats(db *sql.DB, sinceVersion int64) ([]Chat, error) {
-	rows, err := db.Query(`
-		SELECT id, title, model, pinned, archived, system_prompt_id, created_at, updated_at, sync_version
+	rows, err := db.Query(`SELECT `+chatColumns+`
 		FROM chats WHERE sync_version > ? ORDER BY sync_version ASC`, sinceVersion)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get changed chats: %w", err)
@@ -252,32 +515,21 @@ func GetChangedChats(db *sql.DB, sinceVersion int64) ([]Chat, error) {
 
 	var chats []Chat
 	for rows.Next() {
-		var chat Chat
-		var createdAt, updatedAt string
-		var pinned, archived int
-		var systemPromptID sql.NullString
-
-		if err := rows.Scan(&chat.ID, &chat.Title, &chat.Model, &pinned, &archived, &systemPromptID,
-			&createdAt, &updatedAt, &chat.SyncVersion); err != nil {
+		chat, err := scanChat(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan chat: %w", err)
 		}
+		chats = append(chats, *chat)
+	}
+	rows.Close()
 
-		chat.Pinned = pinned == 1
-		chat.Archived = archived == 1
-		if systemPromptID.Valid {
-			chat.SystemPromptID = &systemPromptID.String
-		}
-		chat.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-		chat.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
-
-		// Get messages for this chat
-		messages, err := GetMessagesByChatID(db, chat.ID)
+	// Get messages for each chat (after closing rows to free the connection)
+	for i := range chats {
+		messages, err := GetMessagesByChatID(db, chats[i].ID)
 		if err != nil {
 			return nil, err
 		}
-		chat.Messages = messages
-
-		chats = append(chats, chat)
+		chats[i].Messages = messages
 	}
 
 	return chats, nil
@@ -304,6 +556,7 @@ type GroupedChat struct {
 	Pinned         bool      `json:"pinned"`
 	Archived       bool      `json:"archived"`
 	SystemPromptID *string   `json:"system_prompt_id,omitempty"`
+	ProjectID      *string   `json:"project_id,omitempty"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 }
@@ -360,10 +613,10 @@ func getDateGroup(t time.Time, now time.Time) DateGroup {
 }
 
 // ListChatsGrouped retrieves chats grouped by date with search/filter support
-func ListChatsGrouped(db *sql.DB, search string, includeArchived bool, limit, offset int) (*GroupedChatsResponse, error) {
+func ListChatsGrouped(db *sql.DB, search string, includeArchived bool, projectID string, limit, offset int) (*GroupedChatsResponse, error) {
 	// Build query with optional search filter
 	query := `
-		SELECT id, title, model, pinned, archived, system_prompt_id, created_at, updated_at
+		SELECT id, title, model, pinned, archived, system_prompt_id, project_id, created_at, updated_at
 		FROM chats
 		WHERE 1=1`
 	args := []interface{}{}
@@ -372,6 +625,10 @@ func ListChatsGrouped(db *sql.DB, search string, includeArchived bool, limit, of
 		query += " AND archived = 0"
 	}
 
+	filter, filterArgs := projectFilter(projectID)
+	query += filter
+	args = append(args, filterArgs...)
+
 	if search != "" {
 		query += " AND title LIKE ?"
 		args = append(args, "%"+search+"%")
@@ -404,10 +661,10 @@ func ListChatsGrouped(db *sql.DB, search string, includeArchived bool, limit, of
 		var chat GroupedChat
 		var createdAt, updatedAt string
 		var pinned, archived int
-		var systemPromptID sql.NullString
+		var systemPromptID, projectID sql.NullString
 
 		if err := rows.Scan(&chat.ID, &chat.Title, &chat.Model, &pinned, &archived, &systemPromptID,
-			&createdAt, &updatedAt); err != nil {
+			&projectID, &createdAt, &updatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan chat: %w", err)
 		}
 
@@ -416,6 +673,9 @@ func ListChatsGrouped(db *sql.DB, search string, includeArchived bool, limit, of
 		if systemPromptID.Valid {
 			chat.SystemPromptID = &systemPromptID.String
 		}
+		if projectID.Valid {
+			chat.ProjectID = &projectID.String
+		}
 		chat.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
 		chat.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
 		chats = append(chats, chat)
@@ -463,6 +723,8 @@ func ListChatsGrouped(db *sql.DB, search string, includeArchived bool, limit, of
 	if !includeArchived {
 		countQuery += " AND archived = 0"
 	}
+	countQuery += filter
+	countArgs = append(countArgs, filterArgs...)
 	if search != "" {
 		countQuery += " AND title LIKE ?"
 		countArgs = append(countArgs, "%"+search+"%")
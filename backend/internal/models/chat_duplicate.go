@@ -0,0 +1,158 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DuplicateChat copies a chat with its settings, messages and attachments
+// into a new, independent chat. With upToID only the thread leading to that
+// message is copied, as the new chat's main thread; otherwise every branch
+// is. Feedback stays with the original. Returns nil if the chat doesn't exist.
+func DuplicateChat(db *sql.DB, id, upToID, title string) (*Chat, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to duplicate chat: %w", err)
+	}
+	defer tx.Rollback()
+
+	chat, err := scanChat(tx.QueryRow(`SELECT `+chatColumns+` FROM chats WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat: %w", err)
+	}
+
+	// Pick the messages to copy: everything, or one thread
+	tree, err := loadMessageTree(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	var keep map[string]bool
+	if upToID != "" {
+		upTo := tree.nodes[upToID]
+		if upTo == nil {
+			return nil, fmt.Errorf("message not found")
+		}
+		keep = make(map[string]bool)
+		for _, n := range tree.path(upTo) {
+			keep[n.id] = true
+		}
+	}
+
+	now := time.Now().UTC()
+	chat.ID = uuid.New().String()
+	if title != "" {
+		chat.Title = title
+	} else {
+		chat.Title += " (copy)"
+	}
+	chat.Pinned = false
+	chat.Archived = false
+	chat.CreatedAt, chat.UpdatedAt = now, now
+	chat.SyncVersion = 1
+
+	if _, err := tx.Exec(`
+		INSERT INTO chats (id, title, model, pinned, archived, system_prompt_id, keep_alive, project_id,
+			locale, timezone, inject_datetime, character_id, language, expand_urls, created_at, updated_at, sync_version)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		chat.ID, chat.Title, chat.Model, chat.Pinned, chat.Archived, chat.SystemPromptID, chat.KeepAlive, chat.ProjectID,
+		chat.Locale, chat.Timezone, chat.InjectDateTime, chat.CharacterID, chat.Language, chat.ExpandURLs,
+		now.Format(time.RFC3339), now.Format(time.RFC3339), chat.SyncVersion); err != nil {
+		return nil, fmt.Errorf("failed to create chat: %w", err)
+	}
+
+	// Content is copied as stored, so encrypted messages stay encrypted.
+	// Messages are read parents first, so parent IDs are always mapped.
+	rows, err := tx.Query(`
+		SELECT id, parent_id, role, content, sibling_index, created_at, settings_hash, seed
+		FROM messages WHERE chat_id = ? ORDER BY created_at, rowid`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load messages: %w", err)
+	}
+	type storedMessage struct {
+		id, role, content, createdAt string
+		parentID, settingsHash       sql.NullString
+		siblingIndex                 int
+		seed                         sql.NullInt64
+	}
+	var messages []storedMessage
+	for rows.Next() {
+		var m storedMessage
+		if err := rows.Scan(&m.id, &m.parentID, &m.role, &m.content, &m.siblingIndex, &m.createdAt, &m.settingsHash, &m.seed); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		if keep == nil || keep[m.id] {
+			messages = append(messages, m)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	newIDs := make(map[string]string, len(messages))
+	for _, m := range messages {
+		newIDs[m.id] = uuid.New().String()
+	}
+	for _, m := range messages {
+		var parentID any
+		if p, ok := newIDs[m.parentID.String]; ok {
+			parentID = p
+		}
+		siblingIndex := m.siblingIndex
+		if keep != nil {
+			siblingIndex = 0
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO messages (id, chat_id, parent_id, role, content, sibling_index, created_at, sync_version, settings_hash, seed)
+			VALUES (?, ?, ?, ?, ?, ?, ?, 1, ?, ?)`,
+			newIDs[m.id], chat.ID, parentID, m.role, m.content, siblingIndex, m.createdAt, m.settingsHash, m.seed); err != nil {
+			return nil, fmt.Errorf("failed to copy message: %w", err)
+		}
+		if err := copyAttachments(tx, m.id, newIDs[m.id]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to duplicate chat: %w", err)
+	}
+	return GetChat(db, chat.ID)
+}
+
+// copyAttachments copies a message's attachments onto another message
+func copyAttachments(tx *sql.Tx, fromID, toID string) error {
+	rows, err := tx.Query(`SELECT id FROM attachments WHERE message_id = ?`, fromID)
+	if err != nil {
+		return fmt.Errorf("failed to load attachments: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if _, err := tx.Exec(`
+			INSERT INTO attachments (id, message_id, mime_type, data, filename)
+			SELECT ?, ?, mime_type, data, filename FROM attachments WHERE id = ?`,
+			uuid.New().String(), toID, id); err != nil {
+			return fmt.Errorf("failed to copy attachment: %w", err)
+		}
+	}
+	return nil
+}
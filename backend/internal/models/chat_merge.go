@@ -0,0 +1,277 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrNothingToMerge is returned when a branch is already part of the thread
+// it would be merged into
+var ErrNothingToMerge = errors.New("branch is already part of the target thread")
+
+// messageNode is a message's position in its chat's tree
+type messageNode struct {
+	id           string
+	parentID     string
+	siblingIndex int
+	children     []*messageNode
+}
+
+// messageTree is a chat's messages linked into a tree. Messages whose parent
+// is missing are roots.
+type messageTree struct {
+	nodes map[string]*messageNode
+	roots []*messageNode
+}
+
+// loadMessageTree reads the parent links of a chat's messages
+func loadMessageTree(tx *sql.Tx, chatID string) (*messageTree, error) {
+	rows, err := tx.Query(`
+		SELECT id, parent_id, sibling_index FROM messages
+		WHERE chat_id = ? ORDER BY created_at, rowid`, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load messages: %w", err)
+	}
+	defer rows.Close()
+
+	tree := &messageTree{nodes: make(map[string]*messageNode)}
+	var ordered []*messageNode
+	for rows.Next() {
+		n := &messageNode{}
+		var parentID sql.NullString
+		if err := rows.Scan(&n.id, &parentID, &n.siblingIndex); err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		n.parentID = parentID.String
+		tree.nodes[n.id] = n
+		ordered = append(ordered, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, n := range ordered {
+		if parent := tree.nodes[n.parentID]; parent != nil {
+			parent.children = append(parent.children, n)
+		} else {
+			tree.roots = append(tree.roots, n)
+		}
+	}
+	bySibling := func(nodes []*messageNode) {
+		sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].siblingIndex < nodes[j].siblingIndex })
+	}
+	bySibling(tree.roots)
+	for _, n := range ordered {
+		bySibling(n.children)
+	}
+	return tree, nil
+}
+
+// mainLeaf returns the last message of the main thread, which follows the
+// first sibling at every fork, or nil for an empty chat
+func (t *messageTree) mainLeaf() *messageNode {
+	if len(t.roots) == 0 {
+		return nil
+	}
+	n := t.roots[0]
+	for len(n.children) > 0 {
+		n = n.children[0]
+	}
+	return n
+}
+
+// path returns the messages from the root down to n
+func (t *messageTree) path(n *messageNode) []*messageNode {
+	var path []*messageNode
+	for n != nil && len(path) <= len(t.nodes) {
+		path = append([]*messageNode{n}, path...)
+		n = t.nodes[n.parentID]
+	}
+	return path
+}
+
+// size counts n and its descendants
+func (n *messageNode) size() int {
+	total := 1
+	for _, child := range n.children {
+		total += child.size()
+	}
+	return total
+}
+
+// moveUnder re-parents messages under parentID ("" for roots), after the
+// parent's existing children
+func moveUnder(tx *sql.Tx, tree *messageTree, parentID string, moved []*messageNode) error {
+	var parent any
+	next := len(tree.roots)
+	if p := tree.nodes[parentID]; p != nil {
+		parent, next = parentID, len(p.children)
+	}
+	for _, n := range moved {
+		if _, err := tx.Exec(`
+			UPDATE messages SET parent_id = ?, sibling_index = ?, sync_version = sync_version + 1
+			WHERE id = ?`, parent, next, n.id); err != nil {
+			return fmt.Errorf("failed to move message: %w", err)
+		}
+		next++
+	}
+	return nil
+}
+
+// renumberSiblings closes the gap a moved message leaves among its former
+// siblings
+func renumberSiblings(tx *sql.Tx, tree *messageTree, moved *messageNode) error {
+	siblings := tree.roots
+	if p := tree.nodes[moved.parentID]; p != nil {
+		siblings = p.children
+	}
+	index := 0
+	for _, s := range siblings {
+		if s == moved {
+			continue
+		}
+		if s.siblingIndex != index {
+			if _, err := tx.Exec(`
+				UPDATE messages SET sibling_index = ?, sync_version = sync_version + 1
+				WHERE id = ?`, index, s.id); err != nil {
+				return fmt.Errorf("failed to renumber messages: %w", err)
+			}
+		}
+		index++
+	}
+	return nil
+}
+
+// touchChat bumps a chat's updated_at and sync version
+func touchChat(tx *sql.Tx, chatID string) error {
+	if _, err := tx.Exec(`UPDATE chats SET updated_at = ?, sync_version = sync_version + 1 WHERE id = ?`,
+		time.Now().UTC().Format(time.RFC3339), chatID); err != nil {
+		return fmt.Errorf("failed to update chat: %w", err)
+	}
+	return nil
+}
+
+// MergeBranch moves the branch ending at branchID onto the end of the thread
+// ending at targetID (the main thread when empty). The messages after the
+// point where the two diverge are re-parented under the target, in one
+// transaction. It returns how many messages were moved.
+func MergeBranch(db *sql.DB, chatID, branchID, targetID string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to merge branch: %w", err)
+	}
+	defer tx.Rollback()
+
+	tree, err := loadMessageTree(tx, chatID)
+	if err != nil {
+		return 0, err
+	}
+	branch := tree.nodes[branchID]
+	if branch == nil {
+		return 0, fmt.Errorf("message not found")
+	}
+	target := tree.mainLeaf()
+	if targetID != "" {
+		if target = tree.nodes[targetID]; target == nil {
+			return 0, fmt.Errorf("message not found")
+		}
+	}
+
+	branchPath, targetPath := tree.path(branch), tree.path(target)
+	shared := 0
+	for shared < len(branchPath) && shared < len(targetPath) && branchPath[shared] == targetPath[shared] {
+		shared++
+	}
+	// Nothing to do when one thread already contains the other
+	if shared == len(branchPath) || shared == len(targetPath) {
+		return 0, ErrNothingToMerge
+	}
+
+	// The first message only in the branch carries the rest along
+	first := branchPath[shared]
+	if err := moveUnder(tx, tree, target.id, []*messageNode{first}); err != nil {
+		return 0, err
+	}
+	if err := renumberSiblings(tx, tree, first); err != nil {
+		return 0, err
+	}
+	if err := touchChat(tx, chatID); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to merge branch: %w", err)
+	}
+	return first.size(), nil
+}
+
+// AppendChat moves every message of the source chat onto the end of the
+// thread ending at targetID (the main thread when empty) and deletes the
+// source chat, in one transaction. Feedback moves with its messages. It
+// returns how many messages were moved.
+func AppendChat(db *sql.DB, chatID, sourceChatID, targetID string) (int, error) {
+	if chatID == sourceChatID {
+		return 0, fmt.Errorf("cannot append a chat to itself")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to append chat: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, id := range []string{chatID, sourceChatID} {
+		var exists int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM chats WHERE id = ?`, id).Scan(&exists); err != nil {
+			return 0, fmt.Errorf("failed to get chat: %w", err)
+		}
+		if exists == 0 {
+			return 0, fmt.Errorf("chat not found")
+		}
+	}
+
+	tree, err := loadMessageTree(tx, chatID)
+	if err != nil {
+		return 0, err
+	}
+	source, err := loadMessageTree(tx, sourceChatID)
+	if err != nil {
+		return 0, err
+	}
+	target := tree.mainLeaf()
+	if targetID != "" {
+		if target = tree.nodes[targetID]; target == nil {
+			return 0, fmt.Errorf("message not found")
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE messages SET chat_id = ?, sync_version = sync_version + 1 WHERE chat_id = ?`,
+		chatID, sourceChatID); err != nil {
+		return 0, fmt.Errorf("failed to move messages: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE message_feedback SET chat_id = ? WHERE chat_id = ?`, chatID, sourceChatID); err != nil {
+		return 0, fmt.Errorf("failed to move feedback: %w", err)
+	}
+
+	// The source's roots continue the target thread, in their sibling order
+	parentID := ""
+	if target != nil {
+		parentID = target.id
+	}
+	if err := moveUnder(tx, tree, parentID, source.roots); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM chats WHERE id = ?`, sourceChatID); err != nil {
+		return 0, fmt.Errorf("failed to delete source chat: %w", err)
+	}
+	if err := touchChat(tx, chatID); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to append chat: %w", err)
+	}
+	return len(source.nodes), nil
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// GetCachedCompletion returns a cached response that hasn't expired. Entries
+// that can no longer be decrypted (e.g. after a key rotation) count as misses.
+func GetCachedCompletion(db *sql.DB, key string) (string, bool, error) {
+	var response string
+	err := db.QueryRow(`SELECT response FROM completion_cache WHERE key = ? AND expires_at > ?`,
+		key, time.Now().UTC().Format(time.RFC3339)).Scan(&response)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read completion cache: %w", err)
+	}
+
+	plain, err := DecryptContent(response)
+	if err != nil {
+		return "", false, nil
+	}
+	return plain, true, nil
+}
+
+// SaveCachedCompletion stores a response for ttl, replacing any existing
+// entry, and drops expired entries
+func SaveCachedCompletion(db *sql.DB, key, model, response string, ttl time.Duration) error {
+	encrypted, err := EncryptContent(response)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	_, err = db.Exec(`
+		INSERT OR REPLACE INTO completion_cache (key, model, response, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		key, model, encrypted, now.Format(time.RFC3339), now.Add(ttl).Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to write completion cache: %w", err)
+	}
+
+	if _, err := db.Exec(`DELETE FROM completion_cache WHERE expires_at <= ?`, now.Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("failed to purge completion cache: %w", err)
+	}
+	return nil
+}
+
+// ClearCompletionCache removes every cached completion and returns how many
+// were removed
+func ClearCompletionCache(db *sql.DB) (int64, error) {
+	result, err := db.Exec(`DELETE FROM completion_cache`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear completion cache: %w", err)
+	}
+	return result.RowsAffected()
+}
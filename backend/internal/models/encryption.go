@@ -0,0 +1,364 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"vessel-backend/internal/encryption"
+)
+
+// verifierPlaintext is encrypted with each key so a wrong passphrase is
+// detected at startup instead of surfacing as unreadable messages
+const verifierPlaintext = "vessel-encryption-check"
+
+// ErrWrongPassphrase is returned when the passphrase doesn't match the stored key
+var ErrWrongPassphrase = errors.New("encryption passphrase does not match the stored key")
+
+// ErrEncryptionRequired is returned when the database holds encrypted content
+// but no passphrase was configured
+var ErrEncryptionRequired = errors.New("database contains encrypted content; an encryption passphrase is required")
+
+// contentCiphers holds the active cipher used for writes plus any keys
+// retired by a rotation in this process, so in-flight rows stay readable
+var contentCiphers struct {
+	sync.RWMutex
+	current *encryption.Cipher
+	byID    map[string]*encryption.Cipher
+}
+
+// EncryptionStatus describes the state of content encryption
+type EncryptionStatus struct {
+	Enabled              bool       `json:"enabled"`
+	KeyID                string     `json:"key_id,omitempty"`
+	KeyCreatedAt         *time.Time `json:"key_created_at,omitempty"`
+	EncryptedMessages    int        `json:"encrypted_messages"`
+	PlaintextMessages    int        `json:"plaintext_messages"`
+	EncryptedAttachments int        `json:"encrypted_attachments"`
+	PlaintextAttachments int        `json:"plaintext_attachments"`
+}
+
+// setContentCipher makes c the cipher used for new writes
+func setContentCipher(c *encryption.Cipher) {
+	contentCiphers.Lock()
+	defer contentCiphers.Unlock()
+	if contentCiphers.byID == nil {
+		contentCiphers.byID = make(map[string]*encryption.Cipher)
+	}
+	contentCiphers.current = c
+	contentCiphers.byID[c.KeyID()] = c
+}
+
+// EncryptContent encrypts message content when encryption is enabled and
+// returns it unchanged otherwise
+func EncryptContent(content string) (string, error) {
+	contentCiphers.RLock()
+	c := contentCiphers.current
+	contentCiphers.RUnlock()
+
+	if c == nil {
+		return content, nil
+	}
+	return c.EncryptString(content)
+}
+
+// DecryptContent reverses EncryptContent. Plaintext values pass through,
+// including ones that merely start like ciphertext: a value naming a key
+// that was never loaded is taken as plaintext, since every stored row is
+// re-encrypted with the current key when it is loaded or rotated.
+func DecryptContent(content string) (string, error) {
+	keyID, _, ok := encryption.Parse(content)
+	if !ok {
+		return content, nil
+	}
+
+	contentCiphers.RLock()
+	c := contentCiphers.byID[keyID]
+	contentCiphers.RUnlock()
+
+	if c == nil {
+		return content, nil
+	}
+	return c.DecryptString(content)
+}
+
+// EncryptAttachment encrypts attachment data when encryption is enabled and
+// returns it unchanged otherwise
+func EncryptAttachment(data []byte) ([]byte, error) {
+	contentCiphers.RLock()
+	enabled := contentCiphers.current != nil
+	contentCiphers.RUnlock()
+
+	if !enabled {
+		return data, nil
+	}
+	encrypted, err := EncryptContent(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(encrypted), nil
+}
+
+// DecryptAttachment reverses EncryptAttachment. Plaintext data passes through.
+func DecryptAttachment(data []byte) ([]byte, error) {
+	if !encryption.IsEncrypted(string(data)) {
+		return data, nil
+	}
+	plain, err := DecryptContent(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(plain), nil
+}
+
+// SetupEncryption loads (or on first use creates) the content encryption key
+// for the passphrase and encrypts any plaintext messages. With an empty
+// passphrase it only checks that the database doesn't require one.
+func SetupEncryption(db *sql.DB, passphrase string) error {
+	var keyID, verifier string
+	var salt []byte
+	err := db.QueryRow(`SELECT id, salt, verifier FROM encryption_keys LIMIT 1`).Scan(&keyID, &salt, &verifier)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to load encryption key: %w", err)
+	}
+	keyExists := err == nil
+
+	if passphrase == "" {
+		if keyExists {
+			return ErrEncryptionRequired
+		}
+		return nil
+	}
+
+	if !keyExists {
+		// First use: encrypt existing plaintext along with storing the key
+		_, err := replaceEncryptionKey(db, passphrase, nil)
+		return err
+	}
+
+	c, err := encryption.NewCipher(keyID, encryption.DeriveKey(passphrase, salt))
+	if err != nil {
+		return err
+	}
+	if check, err := c.DecryptString(verifier); err != nil || check != verifierPlaintext {
+		return ErrWrongPassphrase
+	}
+	setContentCipher(c)
+
+	// Pick up plaintext rows written while the server ran without a passphrase
+	_, err = reencryptAll(db, c)
+	return err
+}
+
+// RotateEncryptionKey replaces the content key with one derived from the
+// given passphrase (which may be the current one) and re-encrypts every
+// message, translation and attachment. persist, when not nil, is called
+// just before the new key is committed so the passphrase can be saved with
+// it; the rotation is abandoned if it fails. Returns the number of rows
+// rewritten.
+func RotateEncryptionKey(db *sql.DB, passphrase string, persist func() error) (int, error) {
+	contentCiphers.RLock()
+	enabled := contentCiphers.current != nil
+	contentCiphers.RUnlock()
+	if !enabled {
+		return 0, fmt.Errorf("encryption is not enabled")
+	}
+
+	return replaceEncryptionKey(db, passphrase, persist)
+}
+
+// replaceEncryptionKey derives a new key and, in one transaction, stores it
+// and re-encrypts every message with it, so the database never references a
+// key that can't be derived from the stored passphrase
+func replaceEncryptionKey(db *sql.DB, passphrase string, persist func() error) (int, error) {
+	salt, err := encryption.NewSalt()
+	if err != nil {
+		return 0, err
+	}
+	c, err := encryption.NewCipher(uuid.New().String(), encryption.DeriveKey(passphrase, salt))
+	if err != nil {
+		return 0, err
+	}
+	verifier, err := c.EncryptString(verifierPlaintext)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM encryption_keys`); err != nil {
+		return 0, fmt.Errorf("failed to replace encryption key: %w", err)
+	}
+	_, err = tx.Exec(`INSERT INTO encryption_keys (id, salt, verifier, created_at) VALUES (?, ?, ?, ?)`,
+		c.KeyID(), salt, verifier, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, fmt.Errorf("failed to store encryption key: %w", err)
+	}
+
+	count, err := reencryptMessages(tx, c)
+	if err != nil {
+		return 0, err
+	}
+	if persist != nil {
+		if err := persist(); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit new encryption key: %w", err)
+	}
+	setContentCipher(c)
+
+	// Messages written with the old key while the transaction ran are still
+	// readable in memory; move them to the new key too
+	stragglers, err := reencryptAll(db, c)
+	return count + stragglers, err
+}
+
+// reencryptAll rewrites every message not encrypted with c in its own transaction
+func reencryptAll(db *sql.DB, c *encryption.Cipher) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	count, err := reencryptMessages(tx, c)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit re-encryption: %w", err)
+	}
+	return count, nil
+}
+
+// encryptedColumn is a column whose values are encrypted. Blob columns hold
+// the encrypted text form as bytes so the column keeps its type.
+type encryptedColumn struct {
+	table  string
+	column string
+	blob   bool
+}
+
+// encryptedColumns are the columns encrypted at rest
+var encryptedColumns = []encryptedColumn{
+	{table: "messages", column: "content"},
+	{table: "message_translations", column: "content"},
+	{table: "attachments", column: "data", blob: true},
+}
+
+// reencryptMessages rewrites every message, translation and attachment not
+// already encrypted with c
+func reencryptMessages(tx *sql.Tx, c *encryption.Cipher) (int, error) {
+	count := 0
+	for _, col := range encryptedColumns {
+		n, err := reencryptColumn(tx, c, col)
+		if err != nil {
+			return 0, err
+		}
+		count += n
+	}
+	return count, nil
+}
+
+// reencryptColumn rewrites every value of col not already encrypted with c
+func reencryptColumn(tx *sql.Tx, c *encryption.Cipher, col encryptedColumn) (int, error) {
+	keyPrefix := encryption.KeyPrefix(c.KeyID())
+	var prefixArg any = keyPrefix
+	if col.blob {
+		prefixArg = []byte(keyPrefix)
+	}
+	rows, err := tx.Query(`SELECT rowid, `+col.column+` FROM `+col.table+` WHERE substr(`+col.column+`, 1, ?) != ?`,
+		len(keyPrefix), prefixArg)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find %s to encrypt: %w", col.table, err)
+	}
+
+	type pending struct {
+		rowid int64
+		value string
+	}
+	var pendingRows []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.rowid, &p.value); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan %s: %w", col.table, err)
+		}
+		pendingRows = append(pendingRows, p)
+	}
+	rows.Close()
+
+	for _, r := range pendingRows {
+		plain, err := DecryptContent(r.value)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt %s row %d: %w", col.table, r.rowid, err)
+		}
+		encrypted, err := c.EncryptString(plain)
+		if err != nil {
+			return 0, err
+		}
+		var value any = encrypted
+		if col.blob {
+			value = []byte(encrypted)
+		}
+		if _, err := tx.Exec(`UPDATE `+col.table+` SET `+col.column+` = ? WHERE rowid = ?`, value, r.rowid); err != nil {
+			return 0, fmt.Errorf("failed to update %s row %d: %w", col.table, r.rowid, err)
+		}
+	}
+
+	return len(pendingRows), nil
+}
+
+// GetEncryptionStatus reports whether encryption is enabled and how many
+// messages and attachments are stored encrypted
+func GetEncryptionStatus(db *sql.DB) (*EncryptionStatus, error) {
+	status := &EncryptionStatus{}
+
+	contentCiphers.RLock()
+	current := contentCiphers.current
+	contentCiphers.RUnlock()
+
+	if current != nil {
+		status.Enabled = true
+		status.KeyID = current.KeyID()
+
+		var createdAt string
+		err := db.QueryRow(`SELECT created_at FROM encryption_keys WHERE id = ?`, current.KeyID()).Scan(&createdAt)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to load encryption key: %w", err)
+		}
+		if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
+			status.KeyCreatedAt = &t
+		}
+	}
+
+	err := db.QueryRow(`
+		SELECT
+			COALESCE(SUM(CASE WHEN content LIKE 'enc:v1:%' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN content LIKE 'enc:v1:%' THEN 0 ELSE 1 END), 0)
+		FROM messages`).Scan(&status.EncryptedMessages, &status.PlaintextMessages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count messages: %w", err)
+	}
+
+	err = db.QueryRow(`
+		SELECT
+			COALESCE(SUM(CASE WHEN substr(data, 1, 7) = CAST('enc:v1:' AS BLOB) THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN substr(data, 1, 7) = CAST('enc:v1:' AS BLOB) THEN 0 ELSE 1 END), 0)
+		FROM attachments`).Scan(&status.EncryptedAttachments, &status.PlaintextAttachments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count attachments: %w", err)
+	}
+
+	return status, nil
+}
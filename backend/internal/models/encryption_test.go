@@ -0,0 +1,264 @@
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"vessel-backend/internal/database"
+	"vessel-backend/internal/encryption"
+)
+
+// openEncryptionTestDB opens a migrated database and resets the process-wide
+// content ciphers around the test
+func openEncryptionTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	resetContentCiphers()
+	t.Cleanup(resetContentCiphers)
+
+	db, err := database.OpenDatabase(filepath.Join(t.TempDir(), "vessel.db"), database.DefaultOptions())
+	if err != nil {
+		t.Fatalf("OpenDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	return db
+}
+
+func resetContentCiphers() {
+	contentCiphers.Lock()
+	contentCiphers.current, contentCiphers.byID = nil, nil
+	contentCiphers.Unlock()
+}
+
+func createTestChat(t *testing.T, db *sql.DB) *Chat {
+	t.Helper()
+	chat := &Chat{Title: "test", Model: "llama3"}
+	if err := CreateChat(db, chat); err != nil {
+		t.Fatal(err)
+	}
+	return chat
+}
+
+// rawColumn returns a column of a row as stored
+func rawColumn(t *testing.T, db *sql.DB, query string, args ...any) string {
+	t.Helper()
+	var value []byte
+	if err := db.QueryRow(query, args...).Scan(&value); err != nil {
+		t.Fatal(err)
+	}
+	return string(value)
+}
+
+func TestEncryptionRoundTripsPrefixLikePlaintext(t *testing.T) {
+	db := openEncryptionTestDB(t)
+	chat := createTestChat(t, db)
+
+	tricky := []string{"enc:v1:foo:", "enc:v1:foo:YWJj", "enc:v1:"}
+	for _, content := range tricky {
+		if err := CreateMessage(db, &Message{ChatID: chat.ID, Role: "user", Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Enabling encryption re-encrypts the plaintext rows written before
+	if err := SetupEncryption(db, "passphrase"); err != nil {
+		t.Fatalf("SetupEncryption: %v", err)
+	}
+	for _, content := range tricky {
+		if err := CreateMessage(db, &Message{ChatID: chat.ID, Role: "user", Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	messages, err := GetMessagesByChatID(db, chat.ID)
+	if err != nil {
+		t.Fatalf("GetMessagesByChatID: %v", err)
+	}
+	if len(messages) != 2*len(tricky) {
+		t.Fatalf("got %d messages, want %d", len(messages), 2*len(tricky))
+	}
+	got := make(map[string]int)
+	for _, msg := range messages {
+		got[msg.Content]++
+	}
+	for _, content := range tricky {
+		if got[content] != 2 {
+			t.Errorf("content %q read back %d times, want 2 (got %v)", content, got[content], got)
+		}
+	}
+}
+
+func TestSetupEncryptionWrongPassphrase(t *testing.T) {
+	db := openEncryptionTestDB(t)
+	if err := SetupEncryption(db, "right"); err != nil {
+		t.Fatal(err)
+	}
+
+	resetContentCiphers()
+	if err := SetupEncryption(db, "wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("SetupEncryption with the wrong passphrase error = %v, want ErrWrongPassphrase", err)
+	}
+	if err := SetupEncryption(db, ""); !errors.Is(err, ErrEncryptionRequired) {
+		t.Errorf("SetupEncryption without a passphrase error = %v, want ErrEncryptionRequired", err)
+	}
+	if err := SetupEncryption(db, "right"); err != nil {
+		t.Errorf("SetupEncryption with the right passphrase: %v", err)
+	}
+}
+
+func TestRotateEncryptionKeyMovesStragglers(t *testing.T) {
+	db := openEncryptionTestDB(t)
+	chat := createTestChat(t, db)
+	if err := SetupEncryption(db, "first"); err != nil {
+		t.Fatal(err)
+	}
+	first := &Message{ChatID: chat.ID, Role: "user", Content: "before rotation"}
+	if err := CreateMessage(db, first); err != nil {
+		t.Fatal(err)
+	}
+
+	contentCiphers.RLock()
+	oldCipher := contentCiphers.current
+	contentCiphers.RUnlock()
+
+	if _, err := RotateEncryptionKey(db, "second", nil); err != nil {
+		t.Fatalf("RotateEncryptionKey: %v", err)
+	}
+	status, err := GetEncryptionStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newPrefix := encryption.KeyPrefix(status.KeyID)
+	if got := rawColumn(t, db, `SELECT content FROM messages WHERE id = ?`, first.ID); !strings.HasPrefix(got, newPrefix) {
+		t.Errorf("message after rotation = %q, want it encrypted with the new key", got)
+	}
+
+	// A write that raced the rotation still carries the old key
+	straggler, err := oldCipher.EncryptString("written during rotation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE messages SET content = ? WHERE id = ?`, straggler, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	contentCiphers.RLock()
+	current := contentCiphers.current
+	contentCiphers.RUnlock()
+	if n, err := reencryptAll(db, current); err != nil || n != 1 {
+		t.Fatalf("reencryptAll = %d, %v; want 1 row moved", n, err)
+	}
+	msg, err := GetMessage(db, chat.ID, first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Content != "written during rotation" {
+		t.Errorf("straggler content = %q", msg.Content)
+	}
+	if got := rawColumn(t, db, `SELECT content FROM messages WHERE id = ?`, first.ID); !strings.HasPrefix(got, newPrefix) {
+		t.Errorf("straggler = %q, want it encrypted with the new key", got)
+	}
+
+	// The rotated key is what a restart with the new passphrase loads
+	resetContentCiphers()
+	if err := SetupEncryption(db, "second"); err != nil {
+		t.Errorf("SetupEncryption with the rotated passphrase: %v", err)
+	}
+}
+
+func TestRotateEncryptionKeyAbandonedWhenPersistFails(t *testing.T) {
+	db := openEncryptionTestDB(t)
+	chat := createTestChat(t, db)
+	if err := SetupEncryption(db, "first"); err != nil {
+		t.Fatal(err)
+	}
+	msg := &Message{ChatID: chat.ID, Role: "user", Content: "kept"}
+	if err := CreateMessage(db, msg); err != nil {
+		t.Fatal(err)
+	}
+	before, err := GetEncryptionStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	persistErr := errors.New("store unavailable")
+	if _, err := RotateEncryptionKey(db, "second", func() error { return persistErr }); !errors.Is(err, persistErr) {
+		t.Fatalf("RotateEncryptionKey error = %v, want the persist error", err)
+	}
+	after, err := GetEncryptionStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.KeyID != before.KeyID {
+		t.Errorf("key id = %s after a failed rotation, want %s", after.KeyID, before.KeyID)
+	}
+	if got := rawColumn(t, db, `SELECT content FROM messages WHERE id = ?`, msg.ID); !strings.HasPrefix(got, encryption.KeyPrefix(before.KeyID)) {
+		t.Errorf("message = %q, want it still encrypted with the old key", got)
+	}
+
+	resetContentCiphers()
+	if err := SetupEncryption(db, "first"); err != nil {
+		t.Errorf("SetupEncryption with the old passphrase: %v", err)
+	}
+}
+
+func TestEncryptionCoversBlobAttachments(t *testing.T) {
+	db := openEncryptionTestDB(t)
+	chat := createTestChat(t, db)
+	data := []byte{0, 1, 2, 0xff, 'x'}
+
+	if err := CreateMessage(db, &Message{ChatID: chat.ID, Role: "user", Content: "before",
+		Attachments: []Attachment{{MimeType: "application/octet-stream", Data: data}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetupEncryption(db, "passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateMessage(db, &Message{ChatID: chat.ID, Role: "user", Content: "after",
+		Attachments: []Attachment{{MimeType: "application/octet-stream", Data: data}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RotateEncryptionKey(db, "rotated", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := GetEncryptionStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.EncryptedAttachments != 2 || status.PlaintextAttachments != 0 {
+		t.Errorf("attachment counts = %d encrypted, %d plaintext; want 2, 0",
+			status.EncryptedAttachments, status.PlaintextAttachments)
+	}
+
+	rows, err := db.Query(`SELECT typeof(data), data FROM attachments`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var typ string
+		var raw []byte
+		if err := rows.Scan(&typ, &raw); err != nil {
+			t.Fatal(err)
+		}
+		if typ != "blob" || !encryption.IsEncrypted(string(raw)) {
+			t.Errorf("stored attachment is %s %q, want an encrypted blob", typ, raw)
+		}
+	}
+	rows.Close()
+
+	messages, err := GetMessagesByChatID(db, chat.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range messages {
+		if len(msg.Attachments) != 1 || !bytes.Equal(msg.Attachments[0].Data, data) {
+			t.Errorf("message %q attachments = %+v, want the original data", msg.Content, msg.Attachments)
+		}
+	}
+}
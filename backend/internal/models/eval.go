@@ -0,0 +1,479 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Eval run statuses
+const (
+	EvalStatusQueued    = "queued"
+	EvalStatusRunning   = "running"
+	EvalStatusCompleted = "completed"
+	EvalStatusFailed    = "failed"
+	EvalStatusCancelled = "cancelled"
+)
+
+// EvalCase is one prompt in an eval suite with the checks its output must pass.
+// A case with no checks passes whenever the model answers without error.
+type EvalCase struct {
+	Prompt string `json:"prompt"`
+	System string `json:"system,omitempty"`
+	// ExpectPattern is a regular expression the output must match
+	ExpectPattern string `json:"expect_pattern,omitempty"`
+	// ExpectSchema is a JSON schema the output must parse as and satisfy
+	ExpectSchema json.RawMessage `json:"expect_schema,omitempty"`
+	// GraderPrompt describes what a correct answer looks like; a grader
+	// model judges the output against it
+	GraderPrompt string `json:"grader_prompt,omitempty"`
+}
+
+// EvalSuite is a named set of eval cases
+type EvalSuite struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Cases       []EvalCase `json:"cases"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// EvalTarget is a backend/model pair a suite runs against
+type EvalTarget struct {
+	Backend string         `json:"backend"`
+	Model   string         `json:"model"`
+	Options map[string]any `json:"options,omitempty"`
+}
+
+// EvalScore aggregates the results of one target in a run
+type EvalScore struct {
+	Backend      string  `json:"backend"`
+	Model        string  `json:"model"`
+	Cases        int     `json:"cases"`
+	Passed       int     `json:"passed"`
+	Score        float64 `json:"score"`
+	AvgLatencyMs int64   `json:"avg_latency_ms"`
+}
+
+// EvalRun is one execution of a suite against a set of targets
+type EvalRun struct {
+	ID          string       `json:"id"`
+	SuiteID     string       `json:"suite_id"`
+	Status      string       `json:"status"`
+	Targets     []EvalTarget `json:"targets"`
+	GraderModel string       `json:"grader_model,omitempty"`
+	Error       string       `json:"error,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	FinishedAt  *time.Time   `json:"finished_at,omitempty"`
+	Scores      []EvalScore  `json:"scores"`
+	Results     []EvalResult `json:"results,omitempty"`
+}
+
+// EvalResult is the outcome of one case against one target
+type EvalResult struct {
+	TargetIndex int     `json:"target_index"`
+	CaseIndex   int     `json:"case_index"`
+	Backend     string  `json:"backend"`
+	Model       string  `json:"model"`
+	Output      string  `json:"output"`
+	Passed      bool    `json:"passed"`
+	Score       float64 `json:"score"`
+	Reason      string  `json:"reason,omitempty"`
+	LatencyMs   int64   `json:"latency_ms"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// evalSuiteColumns is the column list matching scanEvalSuite
+const evalSuiteColumns = `id, name, description, cases, created_at, updated_at`
+
+// scanEvalSuite scans a row selected with evalSuiteColumns
+func scanEvalSuite(row rowScanner) (*EvalSuite, error) {
+	suite := &EvalSuite{}
+	var cases, createdAt, updatedAt string
+	if err := row.Scan(&suite.ID, &suite.Name, &suite.Description, &cases, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(cases), &suite.Cases); err != nil {
+		return nil, fmt.Errorf("failed to parse cases for suite %s: %w", suite.ID, err)
+	}
+	suite.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	suite.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
+	return suite, nil
+}
+
+// CreateEvalSuite stores a new eval suite
+func CreateEvalSuite(db *sql.DB, suite *EvalSuite) error {
+	if suite.ID == "" {
+		suite.ID = uuid.New().String()
+	}
+	cases, err := json.Marshal(suite.Cases)
+	if err != nil {
+		return fmt.Errorf("failed to encode cases: %w", err)
+	}
+	now := time.Now().UTC()
+	suite.CreatedAt = now
+	suite.UpdatedAt = now
+
+	_, err = db.Exec(`
+		INSERT INTO eval_suites (id, name, description, cases, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		suite.ID, suite.Name, suite.Description, string(cases),
+		now.Format(time.RFC3339), now.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to create eval suite: %w", err)
+	}
+	return nil
+}
+
+// GetEvalSuite returns a suite by ID, or nil if it doesn't exist
+func GetEvalSuite(db *sql.DB, id string) (*EvalSuite, error) {
+	suite, err := scanEvalSuite(db.QueryRow(`SELECT `+evalSuiteColumns+` FROM eval_suites WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get eval suite: %w", err)
+	}
+	return suite, nil
+}
+
+// ListEvalSuites returns all suites, most recently updated first
+func ListEvalSuites(db *sql.DB) ([]EvalSuite, error) {
+	rows, err := db.Query(`SELECT ` + evalSuiteColumns + ` FROM eval_suites ORDER BY updated_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list eval suites: %w", err)
+	}
+	defer rows.Close()
+
+	suites := []EvalSuite{}
+	for rows.Next() {
+		suite, err := scanEvalSuite(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan eval suite: %w", err)
+		}
+		suites = append(suites, *suite)
+	}
+	return suites, rows.Err()
+}
+
+// UpdateEvalSuite saves a suite's name, description and cases
+func UpdateEvalSuite(db *sql.DB, suite *EvalSuite) error {
+	cases, err := json.Marshal(suite.Cases)
+	if err != nil {
+		return fmt.Errorf("failed to encode cases: %w", err)
+	}
+	suite.UpdatedAt = time.Now().UTC()
+
+	_, err = db.Exec(`
+		UPDATE eval_suites SET name = ?, description = ?, cases = ?, updated_at = ?
+		WHERE id = ?`,
+		suite.Name, suite.Description, string(cases), suite.UpdatedAt.Format(time.RFC3339), suite.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update eval suite: %w", err)
+	}
+	return nil
+}
+
+// DeleteEvalSuite removes a suite along with its runs and results
+func DeleteEvalSuite(db *sql.DB, id string) error {
+	result, err := db.Exec(`DELETE FROM eval_suites WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete eval suite: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("eval suite not found")
+	}
+	return nil
+}
+
+// CreateEvalRun stores a new queued run
+func CreateEvalRun(db *sql.DB, run *EvalRun) error {
+	if run.ID == "" {
+		run.ID = uuid.New().String()
+	}
+	targets, err := json.Marshal(run.Targets)
+	if err != nil {
+		return fmt.Errorf("failed to encode targets: %w", err)
+	}
+	run.Status = EvalStatusQueued
+	run.CreatedAt = time.Now().UTC()
+	run.Scores = []EvalScore{}
+
+	_, err = db.Exec(`
+		INSERT INTO eval_runs (id, suite_id, status, targets, grader_model, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		run.ID, run.SuiteID, run.Status, string(targets), run.GraderModel, run.CreatedAt.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to create eval run: %w", err)
+	}
+	return nil
+}
+
+// SetEvalRunStatus updates a run's status. Terminal statuses also record
+// the finish time.
+func SetEvalRunStatus(db *sql.DB, id, status, errMsg string) error {
+	var finishedAt *string
+	if status != EvalStatusQueued && status != EvalStatusRunning {
+		now := time.Now().UTC().Format(time.RFC3339)
+		finishedAt = &now
+	}
+	_, err := db.Exec(`UPDATE eval_runs SET status = ?, error = ?, finished_at = ? WHERE id = ?`,
+		status, errMsg, finishedAt, id)
+	if err != nil {
+		return fmt.Errorf("failed to update eval run: %w", err)
+	}
+	return nil
+}
+
+// SaveEvalResult records the result of one case against one target
+func SaveEvalResult(db *sql.DB, runID string, result *EvalResult) error {
+	_, err := db.Exec(`
+		INSERT INTO eval_results (run_id, target_index, case_index, backend, model, output, passed, score, reason,
+			latency_ms, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		runID, result.TargetIndex, result.CaseIndex, result.Backend, result.Model, result.Output, result.Passed,
+		result.Score, result.Reason, result.LatencyMs, result.Error)
+	if err != nil {
+		return fmt.Errorf("failed to save eval result: %w", err)
+	}
+	return nil
+}
+
+// evalRunColumns is the column list matching scanEvalRun
+const evalRunColumns = `id, suite_id, status, targets, grader_model, error, created_at, finished_at`
+
+// scanEvalRun scans a row selected with evalRunColumns
+func scanEvalRun(row rowScanner) (*EvalRun, error) {
+	run := &EvalRun{Scores: []EvalScore{}}
+	var targets, createdAt string
+	var finishedAt sql.NullString
+	if err := row.Scan(&run.ID, &run.SuiteID, &run.Status, &targets, &run.GraderModel, &run.Error,
+		&createdAt, &finishedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(targets), &run.Targets); err != nil {
+		return nil, fmt.Errorf("failed to parse targets for run %s: %w", run.ID, err)
+	}
+	run.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	if finishedAt.Valid {
+		if t, err := time.Parse(time.RFC3339, finishedAt.String); err == nil {
+			run.FinishedAt = &t
+		}
+	}
+	return run, nil
+}
+
+// GetEvalRun returns a run with its aggregate scores and, if withResults is
+// set, every per-case result. Returns nil if the run doesn't exist.
+func GetEvalRun(db *sql.DB, id string, withResults bool) (*EvalRun, error) {
+	run, err := scanEvalRun(db.QueryRow(`SELECT `+evalRunColumns+` FROM eval_runs WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get eval run: %w", err)
+	}
+
+	if run.Scores, err = getEvalScores(db, id); err != nil {
+		return nil, err
+	}
+
+	if withResults {
+		rows, err := db.Query(`
+			SELECT target_index, case_index, backend, model, output, passed, score, reason, latency_ms, error
+			FROM eval_results WHERE run_id = ? ORDER BY id`, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get eval results: %w", err)
+		}
+		defer rows.Close()
+
+		run.Results = []EvalResult{}
+		for rows.Next() {
+			var r EvalResult
+			var passed int
+			if err := rows.Scan(&r.TargetIndex, &r.CaseIndex, &r.Backend, &r.Model, &r.Output, &passed, &r.Score,
+				&r.Reason, &r.LatencyMs, &r.Error); err != nil {
+				return nil, fmt.Errorf("failed to scan eval result: %w", err)
+			}
+			r.Passed = passed == 1
+			run.Results = append(run.Results, r)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return run, nil
+}
+
+// ListEvalRuns returns runs with their scores, newest first, optionally
+// limited to one suite
+func ListEvalRuns(db *sql.DB, suiteID string, limit int) ([]EvalRun, error) {
+	query := `SELECT ` + evalRunColumns + ` FROM eval_runs`
+	var args []any
+	if suiteID != "" {
+		query += ` WHERE suite_id = ?`
+		args = append(args, suiteID)
+	}
+	query += ` ORDER BY created_at DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list eval runs: %w", err)
+	}
+
+	runs := []EvalRun{}
+	for rows.Next() {
+		run, err := scanEvalRun(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan eval run: %w", err)
+		}
+		runs = append(runs, *run)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range runs {
+		if runs[i].Scores, err = getEvalScores(db, runs[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return runs, nil
+}
+
+// getEvalScores aggregates a run's results per target
+func getEvalScores(db *sql.DB, runID string) ([]EvalScore, error) {
+	rows, err := db.Query(`
+		SELECT backend, model, COUNT(*), COALESCE(SUM(passed), 0), COALESCE(AVG(score), 0),
+			CAST(COALESCE(AVG(latency_ms), 0) AS INTEGER)
+		FROM eval_results WHERE run_id = ?
+		GROUP BY backend, model
+		ORDER BY MIN(id)`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate eval results: %w", err)
+	}
+	defer rows.Close()
+
+	scores := []EvalScore{}
+	for rows.Next() {
+		var s EvalScore
+		if err := rows.Scan(&s.Backend, &s.Model, &s.Cases, &s.Passed, &s.Score, &s.AvgLatencyMs); err != nil {
+			return nil, fmt.Errorf("failed to scan eval score: %w", err)
+		}
+		scores = append(scores, s)
+	}
+	return scores, rows.Err()
+}
+
+// EvalCheckpoint is the partial output of the case a run is generating
+type EvalCheckpoint struct {
+	TargetIndex int
+	CaseIndex   int
+	Output      string
+	// ElapsedMs is the generation time spent on the output so far
+	ElapsedMs int64
+}
+
+// SaveEvalCheckpoint records the partial output of the case a run is
+// generating, replacing the previous checkpoint
+func SaveEvalCheckpoint(db *sql.DB, runID string, cp *EvalCheckpoint) error {
+	_, err := db.Exec(`
+		INSERT INTO eval_checkpoints (run_id, target_index, case_index, output, elapsed_ms, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(run_id) DO UPDATE SET
+			target_index = excluded.target_index,
+			case_index = excluded.case_index,
+			output = excluded.output,
+			elapsed_ms = excluded.elapsed_ms,
+			updated_at = excluded.updated_at`,
+		runID, cp.TargetIndex, cp.CaseIndex, cp.Output, cp.ElapsedMs, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to save eval checkpoint: %w", err)
+	}
+	return nil
+}
+
+// GetEvalCheckpoint returns a run's checkpoint, or nil if it has none
+func GetEvalCheckpoint(db *sql.DB, runID string) (*EvalCheckpoint, error) {
+	cp := &EvalCheckpoint{}
+	err := db.QueryRow(`
+		SELECT target_index, case_index, output, elapsed_ms FROM eval_checkpoints WHERE run_id = ?`, runID).
+		Scan(&cp.TargetIndex, &cp.CaseIndex, &cp.Output, &cp.ElapsedMs)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get eval checkpoint: %w", err)
+	}
+	return cp, nil
+}
+
+// ClearEvalCheckpoint removes a run's checkpoint
+func ClearEvalCheckpoint(db *sql.DB, runID string) error {
+	if _, err := db.Exec(`DELETE FROM eval_checkpoints WHERE run_id = ?`, runID); err != nil {
+		return fmt.Errorf("failed to clear eval checkpoint: %w", err)
+	}
+	return nil
+}
+
+// CompletedEvalCases returns the cases a run has results for, as
+// [target index, case index] pairs
+func CompletedEvalCases(db *sql.DB, runID string) (map[[2]int]bool, error) {
+	rows, err := db.Query(`SELECT target_index, case_index FROM eval_results WHERE run_id = ?`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list completed eval cases: %w", err)
+	}
+	defer rows.Close()
+
+	done := make(map[[2]int]bool)
+	for rows.Next() {
+		var key [2]int
+		if err := rows.Scan(&key[0], &key[1]); err != nil {
+			return nil, fmt.Errorf("failed to scan completed eval case: %w", err)
+		}
+		done[key] = true
+	}
+	return done, rows.Err()
+}
+
+// ListInterruptedEvalRuns returns the runs a previous process left queued
+// or running, oldest first
+func ListInterruptedEvalRuns(db *sql.DB) ([]EvalRun, error) {
+	rows, err := db.Query(`SELECT `+evalRunColumns+` FROM eval_runs WHERE status IN (?, ?) ORDER BY created_at`,
+		EvalStatusQueued, EvalStatusRunning)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interrupted eval runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []EvalRun{}
+	for rows.Next() {
+		run, err := scanEvalRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan eval run: %w", err)
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
+
+// FailInterruptedEvalRuns marks runs left queued or running by a previous
+// process as failed, for when they can't be resumed
+func FailInterruptedEvalRuns(db *sql.DB) error {
+	_, err := db.Exec(`
+		UPDATE eval_runs SET status = ?, error = 'interrupted by server restart', finished_at = ?
+		WHERE status IN (?, ?)`,
+		EvalStatusFailed, time.Now().UTC().Format(time.RFC3339), EvalStatusQueued, EvalStatusRunning)
+	if err != nil {
+		return fmt.Errorf("failed to clean up interrupted eval runs: %w", err)
+	}
+	return nil
+}
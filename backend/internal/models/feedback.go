@@ -0,0 +1,213 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Feedback ratings
+const (
+	FeedbackNegative = -1
+	FeedbackNeutral  = 0
+	FeedbackPositive = 1
+)
+
+// MessageFeedback is a user's annotation of a message: a thumbs up or down,
+// a free-text note and tags
+type MessageFeedback struct {
+	MessageID string   `json:"message_id"`
+	ChatID    string   `json:"chat_id"`
+	Rating    int      `json:"rating"`
+	Note      string   `json:"note"`
+	Tags      []string `json:"tags"`
+	// Model is the model that generated the message, from its settings
+	// snapshot or else the chat's model
+	Model     string    `json:"model,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// FeedbackFilter narrows feedback listings; zero values match everything
+type FeedbackFilter struct {
+	ChatID string
+	Rating *int
+	Tag    string
+	Model  string
+}
+
+// feedbackColumns is the column list matching scanFeedback. The message's
+// model comes from its settings snapshot, falling back to the chat's model.
+const feedbackColumns = `f.message_id, f.chat_id, f.rating, f.note, f.tags,
+	COALESCE(json_extract(s.data, '$.model'), c.model, ''), f.created_at, f.updated_at`
+
+// feedbackJoins joins the tables feedbackColumns reads from
+const feedbackJoins = `FROM message_feedback f
+	JOIN messages m ON m.id = f.message_id
+	JOIN chats c ON c.id = f.chat_id
+	LEFT JOIN settings_snapshots s ON s.hash = m.settings_hash`
+
+// scanFeedback scans a row selected with feedbackColumns
+func scanFeedback(row rowScanner) (*MessageFeedback, error) {
+	f := &MessageFeedback{}
+	var tags, createdAt, updatedAt string
+	if err := row.Scan(&f.MessageID, &f.ChatID, &f.Rating, &f.Note, &tags, &f.Model,
+		&createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(tags), &f.Tags); err != nil || f.Tags == nil {
+		f.Tags = []string{}
+	}
+	f.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	f.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
+	return f, nil
+}
+
+// feedbackWhere builds the WHERE clause for a filter
+func feedbackWhere(filter FeedbackFilter) (string, []any) {
+	where := []string{"1=1"}
+	var args []any
+	if filter.ChatID != "" {
+		where = append(where, "f.chat_id = ?")
+		args = append(args, filter.ChatID)
+	}
+	if filter.Rating != nil {
+		where = append(where, "f.rating = ?")
+		args = append(args, *filter.Rating)
+	}
+	if filter.Tag != "" {
+		where = append(where, "EXISTS (SELECT 1 FROM json_each(f.tags) WHERE json_each.value = ?)")
+		args = append(args, filter.Tag)
+	}
+	if filter.Model != "" {
+		where = append(where, "COALESCE(json_extract(s.data, '$.model'), c.model, '') = ?")
+		args = append(args, filter.Model)
+	}
+	return " WHERE " + strings.Join(where, " AND "), args
+}
+
+// SetMessageFeedback creates or replaces the feedback on a message
+func SetMessageFeedback(db *sql.DB, f *MessageFeedback) error {
+	if f.Tags == nil {
+		f.Tags = []string{}
+	}
+	tags, err := json.Marshal(f.Tags)
+	if err != nil {
+		return fmt.Errorf("failed to encode feedback tags: %w", err)
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	_, err = db.Exec(`
+		INSERT INTO message_feedback (message_id, chat_id, rating, note, tags, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(message_id) DO UPDATE SET
+			rating = excluded.rating, note = excluded.note, tags = excluded.tags, updated_at = excluded.updated_at`,
+		f.MessageID, f.ChatID, f.Rating, f.Note, string(tags), now, now)
+	if err != nil {
+		return fmt.Errorf("failed to save feedback: %w", err)
+	}
+	return nil
+}
+
+// GetMessageFeedback returns the feedback on a message, or nil if it has none
+func GetMessageFeedback(db *sql.DB, chatID, messageID string) (*MessageFeedback, error) {
+	f, err := scanFeedback(db.QueryRow(`SELECT `+feedbackColumns+` `+feedbackJoins+`
+		WHERE f.message_id = ? AND f.chat_id = ?`, messageID, chatID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feedback: %w", err)
+	}
+	return f, nil
+}
+
+// DeleteMessageFeedback removes the feedback on a message
+func DeleteMessageFeedback(db *sql.DB, chatID, messageID string) error {
+	result, err := db.Exec(`DELETE FROM message_feedback WHERE message_id = ? AND chat_id = ?`, messageID, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to delete feedback: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("feedback not found")
+	}
+	return nil
+}
+
+// ListFeedback returns feedback matching a filter, newest first
+func ListFeedback(db *sql.DB, filter FeedbackFilter) ([]MessageFeedback, error) {
+	where, args := feedbackWhere(filter)
+	rows, err := db.Query(`SELECT `+feedbackColumns+` `+feedbackJoins+where+`
+		ORDER BY f.updated_at DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feedback: %w", err)
+	}
+	defer rows.Close()
+
+	feedback := []MessageFeedback{}
+	for rows.Next() {
+		f, err := scanFeedback(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan feedback: %w", err)
+		}
+		feedback = append(feedback, *f)
+	}
+	return feedback, rows.Err()
+}
+
+// FeedbackCounts tallies ratings
+type FeedbackCounts struct {
+	Total    int `json:"total"`
+	Positive int `json:"positive"`
+	Negative int `json:"negative"`
+	Neutral  int `json:"neutral"`
+}
+
+// add counts one rating
+func (fc *FeedbackCounts) add(rating int) {
+	fc.Total++
+	switch {
+	case rating > 0:
+		fc.Positive++
+	case rating < 0:
+		fc.Negative++
+	default:
+		fc.Neutral++
+	}
+}
+
+// FeedbackSummary aggregates feedback overall, per model and per tag
+type FeedbackSummary struct {
+	FeedbackCounts
+	Models map[string]*FeedbackCounts `json:"models"`
+	Tags   map[string]*FeedbackCounts `json:"tags"`
+}
+
+// SummarizeFeedback aggregates the feedback matching a filter
+func SummarizeFeedback(db *sql.DB, filter FeedbackFilter) (*FeedbackSummary, error) {
+	feedback, err := ListFeedback(db, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &FeedbackSummary{
+		Models: make(map[string]*FeedbackCounts),
+		Tags:   make(map[string]*FeedbackCounts),
+	}
+	for _, f := range feedback {
+		summary.add(f.Rating)
+		if summary.Models[f.Model] == nil {
+			summary.Models[f.Model] = &FeedbackCounts{}
+		}
+		summary.Models[f.Model].add(f.Rating)
+		for _, tag := range f.Tags {
+			if summary.Tags[tag] == nil {
+				summary.Tags[tag] = &FeedbackCounts{}
+			}
+			summary.Tags[tag].add(f.Rating)
+		}
+	}
+	return summary, nil
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// inferenceDefaultsKey is the app_settings key holding InferenceDefaults
+const inferenceDefaultsKey = "inference_defaults"
+
+// InferenceDefaults are server-wide generation settings applied to every
+// chat request before per-chat and per-request values. Unset fields leave
+// the backend's own default in place.
+type InferenceDefaults struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	// MaxTokens maps to Ollama's num_predict
+	MaxTokens *int `json:"max_tokens,omitempty"`
+	// ContextBudget maps to Ollama's num_ctx
+	ContextBudget *int       `json:"context_budget,omitempty"`
+	Stream        *bool      `json:"stream,omitempty"`
+	SystemPrompt  string     `json:"system_prompt,omitempty"`
+	UpdatedAt     *time.Time `json:"updated_at,omitempty"`
+	// Locale and Timezone describe the user when neither the request nor
+	// the chat does
+	Locale   string `json:"locale,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+	// InjectDateTime gives the model the current date and time unless the
+	// chat or request turns it off
+	InjectDateTime bool `json:"inject_datetime,omitempty"`
+}
+
+// GetInferenceDefaults returns the stored defaults, or empty defaults if
+// none have been saved
+func GetInferenceDefaults(db *sql.DB) (*InferenceDefaults, error) {
+	var value, updatedAt string
+	err := db.QueryRow(`SELECT value, updated_at FROM app_settings WHERE key = ?`, inferenceDefaultsKey).
+		Scan(&value, &updatedAt)
+	if err == sql.ErrNoRows {
+		return &InferenceDefaults{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inference defaults: %w", err)
+	}
+
+	d := &InferenceDefaults{}
+	if err := json.Unmarshal([]byte(value), d); err != nil {
+		return nil, fmt.Errorf("failed to parse inference defaults: %w", err)
+	}
+	if t, err := time.Parse(time.RFC3339, updatedAt); err == nil {
+		d.UpdatedAt = &t
+	}
+	return d, nil
+}
+
+// SaveInferenceDefaults replaces the stored defaults
+func SaveInferenceDefaults(db *sql.DB, d *InferenceDefaults) error {
+	now := time.Now().UTC()
+	d.UpdatedAt = nil
+	value, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("failed to encode inference defaults: %w", err)
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO app_settings (key, value, updated_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		inferenceDefaultsKey, string(value), now.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to save inference defaults: %w", err)
+	}
+
+	d.UpdatedAt = &now
+	return nil
+}
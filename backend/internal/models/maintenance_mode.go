@@ -0,0 +1,55 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// maintenanceModeKey is the app_settings key holding MaintenanceMode
+const maintenanceModeKey = "maintenance_mode"
+
+// MaintenanceMode makes the API read-only while it is enabled, e.g. during
+// backups and migrations
+type MaintenanceMode struct {
+	Enabled bool `json:"enabled"`
+	// Message is shown to clients whose writes are rejected
+	Message string     `json:"message,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+// GetMaintenanceMode returns the stored maintenance mode (disabled if unset)
+func GetMaintenanceMode(db *sql.DB) (*MaintenanceMode, error) {
+	mode := &MaintenanceMode{}
+
+	var value string
+	err := db.QueryRow(`SELECT value FROM app_settings WHERE key = ?`, maintenanceModeKey).Scan(&value)
+	if err == sql.ErrNoRows {
+		return mode, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get maintenance mode: %w", err)
+	}
+	if err := json.Unmarshal([]byte(value), mode); err != nil {
+		return nil, fmt.Errorf("failed to parse maintenance mode: %w", err)
+	}
+	return mode, nil
+}
+
+// SaveMaintenanceMode replaces the stored maintenance mode
+func SaveMaintenanceMode(db *sql.DB, mode *MaintenanceMode) error {
+	value, err := json.Marshal(mode)
+	if err != nil {
+		return fmt.Errorf("failed to encode maintenance mode: %w", err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO app_settings (key, value, updated_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		maintenanceModeKey, string(value), time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to save maintenance mode: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxThreadDepth bounds walks up parent links, guarding against cycles
+const maxThreadDepth = 1000000
+
+// MessagePage is one page of a chat thread, oldest message first
+type MessagePage struct {
+	// LeafID is the last message of the thread being paged
+	LeafID   string    `json:"leaf_id,omitempty"`
+	Messages []Message `json:"messages"`
+	// NextCursor fetches the next page of older messages; empty when the
+	// page starts at the beginning of the thread
+	NextCursor string          `json:"next_cursor,omitempty"`
+	Earlier    EarlierMessages `json:"earlier"`
+}
+
+// EarlierMessages summarizes the thread's messages before a page, so clients
+// can show what was left out without loading it
+type EarlierMessages struct {
+	Count   int            `json:"count"`
+	Roles   map[string]int `json:"roles"`
+	FirstAt *time.Time     `json:"first_at,omitempty"`
+}
+
+// threadEntry is a message's place in a thread, without its content
+type threadEntry struct {
+	id        string
+	role      string
+	createdAt string
+}
+
+// GetMessagePage returns up to limit messages of a chat thread, ending just
+// before the cursor message (or at the end of the thread without one).
+// Threads follow parent links from leafID, or from the newest leaf when it is
+// empty; chats stored without parent links are one thread in creation order.
+// Only the indexed id, role and created_at columns are read for messages
+// outside the page. Returns nil if the leaf or cursor isn't in the chat.
+func GetMessagePage(db *sql.DB, chatID, leafID, cursor string, limit int) (*MessagePage, error) {
+	linked, err := chatHasLinks(db, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &MessagePage{Messages: []Message{}, Earlier: EarlierMessages{Roles: map[string]int{}}}
+	var entries []threadEntry
+	if linked {
+		if leafID == "" {
+			if leafID, err = newestLeaf(db, chatID); err != nil {
+				return nil, err
+			}
+		}
+		page.LeafID = leafID
+		start := leafID
+		if cursor != "" {
+			start = cursor
+		}
+		entries, err = threadFrom(db, chatID, start)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			return nil, nil
+		}
+		if cursor != "" {
+			entries = entries[1:]
+		}
+	} else {
+		if entries, err = linearThreadBefore(db, chatID, cursor); err != nil || entries == nil {
+			return nil, err
+		}
+	}
+
+	// entries run newest first; the page is the newest limit of them
+	pageEntries := entries[:min(limit, len(entries))]
+	earlier := entries[len(pageEntries):]
+	for _, e := range earlier {
+		page.Earlier.Count++
+		page.Earlier.Roles[e.role]++
+	}
+	if len(earlier) > 0 {
+		if first, err := time.Parse(time.RFC3339, earlier[len(earlier)-1].createdAt); err == nil {
+			page.Earlier.FirstAt = &first
+		}
+		page.NextCursor = pageEntries[len(pageEntries)-1].id
+	}
+
+	messages, err := messagesByID(db, chatID, pageEntries)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		page.Messages = append(page.Messages, messages[i])
+	}
+	return page, nil
+}
+
+// GetMessageHistory returns a message and the messages of its thread that
+// came before it, oldest first: what the model saw when the message was
+// generated. Returns nil if the message isn't in the chat.
+func GetMessageHistory(db *sql.DB, chatID, id string) (*Message, []Message, error) {
+	msg, err := GetMessage(db, chatID, id)
+	if err != nil || msg == nil {
+		return nil, nil, err
+	}
+
+	linked, err := chatHasLinks(db, chatID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var entries []threadEntry
+	switch {
+	case msg.ParentID != nil:
+		entries, err = threadFrom(db, chatID, *msg.ParentID)
+	case !linked:
+		entries, err = linearThreadBefore(db, chatID, id)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	history, err := messagesByID(db, chatID, entries)
+	if err != nil {
+		return nil, nil, err
+	}
+	slices.Reverse(history)
+	return msg, history, nil
+}
+
+// chatHasLinks reports whether a chat's messages are linked to their parents
+func chatHasLinks(db *sql.DB, chatID string) (bool, error) {
+	var linked bool
+	if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM messages WHERE chat_id = ? AND parent_id IS NOT NULL)`,
+		chatID).Scan(&linked); err != nil {
+		return false, fmt.Errorf("failed to get messages: %w", err)
+	}
+	return linked, nil
+}
+
+// newestLeaf returns the most recently created message without replies
+func newestLeaf(db *sql.DB, chatID string) (string, error) {
+	var id string
+	err := db.QueryRow(`
+		SELECT id FROM messages m
+		WHERE chat_id = ? AND NOT EXISTS (SELECT 1 FROM messages c WHERE c.parent_id = m.id)
+		ORDER BY created_at DESC, rowid DESC LIMIT 1`, chatID).Scan(&id)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to find latest message: %w", err)
+	}
+	return id, nil
+}
+
+// threadFrom walks parent links from a message up to the thread's root and
+// returns the messages newest first, or nothing if it isn't in the chat
+func threadFrom(db *sql.DB, chatID, id string) ([]threadEntry, error) {
+	rows, err := db.Query(`
+		WITH RECURSIVE thread(id, parent_id, role, created_at, depth) AS (
+			SELECT id, parent_id, role, created_at, 0 FROM messages WHERE id = ? AND chat_id = ?
+			UNION ALL
+			SELECT m.id, m.parent_id, m.role, m.created_at, t.depth + 1
+			FROM messages m JOIN thread t ON m.id = t.parent_id
+			WHERE m.chat_id = ? AND t.depth < ?
+		)
+		SELECT id, role, created_at FROM thread ORDER BY depth`, id, chatID, chatID, maxThreadDepth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load thread: %w", err)
+	}
+	return scanThreadEntries(rows)
+}
+
+// linearThreadBefore returns the messages of an unlinked chat created before
+// the cursor message (all of them without one), newest first. Returns nil if
+// the cursor isn't in the chat.
+func linearThreadBefore(db *sql.DB, chatID, cursor string) ([]threadEntry, error) {
+	if cursor == "" {
+		rows, err := db.Query(`
+			SELECT id, role, created_at FROM messages WHERE chat_id = ?
+			ORDER BY created_at DESC, rowid DESC`, chatID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load messages: %w", err)
+		}
+		return scanThreadEntries(rows)
+	}
+
+	var createdAt string
+	var rowID int64
+	err := db.QueryRow(`SELECT created_at, rowid FROM messages WHERE id = ? AND chat_id = ?`,
+		cursor, chatID).Scan(&createdAt, &rowID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	rows, err := db.Query(`
+		SELECT id, role, created_at FROM messages
+		WHERE chat_id = ? AND (created_at < ? OR (created_at = ? AND rowid < ?))
+		ORDER BY created_at DESC, rowid DESC`, chatID, createdAt, createdAt, rowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load messages: %w", err)
+	}
+	return scanThreadEntries(rows)
+}
+
+// scanThreadEntries reads id, role and created_at rows
+func scanThreadEntries(rows *sql.Rows) ([]threadEntry, error) {
+	defer rows.Close()
+	entries := []threadEntry{}
+	for rows.Next() {
+		var e threadEntry
+		if err := rows.Scan(&e.id, &e.role, &e.createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// messagesByID loads full messages in the order of entries
+func messagesByID(db *sql.DB, chatID string, entries []threadEntry) ([]Message, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	args := []any{chatID}
+	for _, e := range entries {
+		args = append(args, e.id)
+	}
+	rows, err := db.Query(`SELECT `+messageColumns+` FROM messages
+		WHERE chat_id = ? AND id IN (?`+strings.Repeat(", ?", len(entries)-1)+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+	defer rows.Close()
+
+	byID := make(map[string]Message, len(entries))
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		byID[msg.ID] = *msg
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	messages := make([]Message, 0, len(entries))
+	for _, e := range entries {
+		messages = append(messages, byID[e.id])
+	}
+	return messages, nil
+}
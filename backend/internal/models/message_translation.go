@@ -0,0 +1,95 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// MessageTranslation is a message translated into another language. The
+// original message is left unchanged.
+type MessageTranslation struct {
+	MessageID string    `json:"message_id"`
+	Language  string    `json:"language"`
+	Content   string    `json:"content"`
+	Model     string    `json:"model"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SaveMessageTranslation stores a translation, replacing an earlier one
+// into the same language
+func SaveMessageTranslation(db *sql.DB, t *MessageTranslation) error {
+	content, err := EncryptContent(t.Content)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt translation: %w", err)
+	}
+	t.CreatedAt = time.Now().UTC()
+
+	_, err = db.Exec(`
+		INSERT INTO message_translations (message_id, language, content, model, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(message_id, language) DO UPDATE SET
+			content = excluded.content,
+			model = excluded.model,
+			created_at = excluded.created_at`,
+		t.MessageID, t.Language, content, t.Model, t.CreatedAt.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to save translation: %w", err)
+	}
+	return nil
+}
+
+// ListChatTranslations returns the translations of a chat's messages into
+// a language, in message order
+func ListChatTranslations(db *sql.DB, chatID, language string) ([]MessageTranslation, error) {
+	rows, err := db.Query(`
+		SELECT t.message_id, t.language, t.content, t.model, t.created_at
+		FROM message_translations t
+		JOIN messages m ON m.id = t.message_id
+		WHERE m.chat_id = ? AND t.language = ?
+		ORDER BY m.created_at, m.rowid`, chatID, language)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list translations: %w", err)
+	}
+	defer rows.Close()
+
+	translations := []MessageTranslation{}
+	for rows.Next() {
+		var t MessageTranslation
+		var content, createdAt string
+		if err := rows.Scan(&t.MessageID, &t.Language, &content, &t.Model, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan translation: %w", err)
+		}
+		if t.Content, err = DecryptContent(content); err != nil {
+			return nil, fmt.Errorf("failed to decrypt translation of %s: %w", t.MessageID, err)
+		}
+		t.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+		translations = append(translations, t)
+	}
+	return translations, rows.Err()
+}
+
+// ListTranslationLanguages returns the languages a chat has translations
+// into
+func ListTranslationLanguages(db *sql.DB, chatID string) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT t.language
+		FROM message_translations t
+		JOIN messages m ON m.id = t.message_id
+		WHERE m.chat_id = ?
+		ORDER BY t.language`, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list translation languages: %w", err)
+	}
+	defer rows.Close()
+
+	languages := []string{}
+	for rows.Next() {
+		var language string
+		if err := rows.Scan(&language); err != nil {
+			return nil, fmt.Errorf("failed to scan translation language: %w", err)
+		}
+		languages = append(languages, language)
+	}
+	return languages, rows.Err()
+}
@@ -0,0 +1,181 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ModelLicense is the license of an installed model
+type ModelLicense struct {
+	Model string `json:"model"`
+	// Name is the identified license (e.g. "Apache-2.0"), "custom" if the
+	// text wasn't recognized, or empty if the model declares no license
+	Name string `json:"name"`
+	// Hash identifies the license text; acceptances are tied to it so a
+	// changed license has to be accepted again
+	Hash        string    `json:"hash"`
+	Text        string    `json:"text,omitempty"`
+	Restrictive bool      `json:"restrictive"`
+	Source      string    `json:"source"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+// LicenseAcceptance records that a model's license was accepted
+type LicenseAcceptance struct {
+	ID          int64     `json:"id"`
+	Model       string    `json:"model"`
+	LicenseName string    `json:"license_name"`
+	LicenseHash string    `json:"license_hash"`
+	AcceptedBy  string    `json:"accepted_by"`
+	Note        string    `json:"note"`
+	AcceptedAt  time.Time `json:"accepted_at"`
+}
+
+// modelLicenseColumns is the column list matching scanModelLicense
+const modelLicenseColumns = `model, license_name, license_hash, license_text, restrictive, source, fetched_at`
+
+// scanModelLicense scans a row selected with modelLicenseColumns
+func scanModelLicense(row rowScanner) (*ModelLicense, error) {
+	l := &ModelLicense{}
+	var restrictive int
+	var fetchedAt string
+	if err := row.Scan(&l.Model, &l.Name, &l.Hash, &l.Text, &restrictive, &l.Source, &fetchedAt); err != nil {
+		return nil, err
+	}
+	l.Restrictive = restrictive == 1
+	l.FetchedAt, _ = time.Parse(time.RFC3339, fetchedAt)
+	return l, nil
+}
+
+// GetModelLicense returns the stored license for a model, or nil if it
+// hasn't been fetched yet
+func GetModelLicense(db *sql.DB, model string) (*ModelLicense, error) {
+	row := db.QueryRow(`SELECT `+modelLicenseColumns+` FROM model_licenses WHERE model = ?`, model)
+	l, err := scanModelLicense(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get model license: %w", err)
+	}
+	return l, nil
+}
+
+// ListModelLicenses returns all stored licenses ordered by model
+func ListModelLicenses(db *sql.DB) ([]ModelLicense, error) {
+	rows, err := db.Query(`SELECT ` + modelLicenseColumns + ` FROM model_licenses ORDER BY model`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list model licenses: %w", err)
+	}
+	defer rows.Close()
+
+	licenses := []ModelLicense{}
+	for rows.Next() {
+		l, err := scanModelLicense(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan model license: %w", err)
+		}
+		licenses = append(licenses, *l)
+	}
+	return licenses, rows.Err()
+}
+
+// SaveModelLicense inserts or replaces the stored license for a model
+func SaveModelLicense(db *sql.DB, l *ModelLicense) error {
+	l.FetchedAt = time.Now().UTC()
+	_, err := db.Exec(`
+		INSERT INTO model_licenses (model, license_name, license_hash, license_text, restrictive, source, fetched_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(model) DO UPDATE SET
+			license_name = excluded.license_name,
+			license_hash = excluded.license_hash,
+			license_text = excluded.license_text,
+			restrictive = excluded.restrictive,
+			source = excluded.source,
+			fetched_at = excluded.fetched_at`,
+		l.Model, l.Name, l.Hash, l.Text, l.Restrictive, l.Source, l.FetchedAt.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to save model license: %w", err)
+	}
+	return nil
+}
+
+// DeleteModelLicense removes the stored license for a model so it is fetched
+// again on next use. Acceptances are kept.
+func DeleteModelLicense(db *sql.DB, model string) error {
+	if _, err := db.Exec(`DELETE FROM model_licenses WHERE model = ?`, model); err != nil {
+		return fmt.Errorf("failed to delete model license: %w", err)
+	}
+	return nil
+}
+
+// RecordLicenseAcceptance stores an acceptance of a model's current license
+func RecordLicenseAcceptance(db *sql.DB, a *LicenseAcceptance) error {
+	a.AcceptedAt = time.Now().UTC()
+	result, err := db.Exec(`
+		INSERT INTO license_acceptances (model, license_name, license_hash, accepted_by, note, accepted_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		a.Model, a.LicenseName, a.LicenseHash, a.AcceptedBy, a.Note, a.AcceptedAt.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to record license acceptance: %w", err)
+	}
+	a.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetLicenseAcceptance returns the latest acceptance of a model's license
+// text, or nil if it hasn't been accepted
+func GetLicenseAcceptance(db *sql.DB, model, hash string) (*LicenseAcceptance, error) {
+	row := db.QueryRow(`
+		SELECT id, model, license_name, license_hash, accepted_by, note, accepted_at
+		FROM license_acceptances WHERE model = ? AND license_hash = ?
+		ORDER BY id DESC LIMIT 1`, model, hash)
+	a, err := scanLicenseAcceptance(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get license acceptance: %w", err)
+	}
+	return a, nil
+}
+
+// ListLicenseAcceptances returns the acceptance audit trail, newest first,
+// optionally limited to one model
+func ListLicenseAcceptances(db *sql.DB, model string) ([]LicenseAcceptance, error) {
+	query := `SELECT id, model, license_name, license_hash, accepted_by, note, accepted_at FROM license_acceptances`
+	var args []any
+	if model != "" {
+		query += ` WHERE model = ?`
+		args = append(args, model)
+	}
+	query += ` ORDER BY id DESC`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list license acceptances: %w", err)
+	}
+	defer rows.Close()
+
+	acceptances := []LicenseAcceptance{}
+	for rows.Next() {
+		a, err := scanLicenseAcceptance(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan license acceptance: %w", err)
+		}
+		acceptances = append(acceptances, *a)
+	}
+	return acceptances, rows.Err()
+}
+
+// scanLicenseAcceptance scans a license_acceptances row
+func scanLicenseAcceptance(row rowScanner) (*LicenseAcceptance, error) {
+	a := &LicenseAcceptance{}
+	var acceptedAt string
+	if err := row.Scan(&a.ID, &a.Model, &a.LicenseName, &a.LicenseHash, &a.AcceptedBy, &a.Note, &acceptedAt); err != nil {
+		return nil, err
+	}
+	a.AcceptedAt, _ = time.Parse(time.RFC3339, acceptedAt)
+	return a, nil
+}
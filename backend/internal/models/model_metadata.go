@@ -0,0 +1,172 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ModelMetadata holds user-defined labels for an installed model
+type ModelMetadata struct {
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName"`
+	Tags        []string  `json:"tags"`
+	Notes       string    `json:"notes"`
+	Favorite    bool      `json:"favorite"`
+	Hidden      bool      `json:"hidden"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	// Corruption describes why the model failed checksum verification; such
+	// models are quarantined (left out of model lists) until re-downloaded
+	Corruption  string     `json:"corruption,omitempty"`
+	CorruptedAt *time.Time `json:"corruptedAt,omitempty"`
+	// LastUsedAt is when the model last answered a chat, and UseCount how
+	// many completions it has produced
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	UseCount   int64      `json:"useCount"`
+}
+
+// modelMetadataColumns is the column list matching scanModelMetadata
+const modelMetadataColumns = `name, display_name, tags, notes, favorite, hidden, corruption, corrupted_at, updated_at,
+	last_used_at, use_count`
+
+// scanModelMetadata scans a row selected with modelMetadataColumns
+func scanModelMetadata(row rowScanner) (*ModelMetadata, error) {
+	m := &ModelMetadata{}
+	var tags, updatedAt string
+	var corruptedAt, lastUsedAt sql.NullString
+	var favorite, hidden int
+	if err := row.Scan(&m.Name, &m.DisplayName, &tags, &m.Notes, &favorite, &hidden, &m.Corruption, &corruptedAt,
+		&updatedAt, &lastUsedAt, &m.UseCount); err != nil {
+		return nil, err
+	}
+	if corruptedAt.Valid {
+		if t, err := time.Parse(time.RFC3339, corruptedAt.String); err == nil {
+			m.CorruptedAt = &t
+		}
+	}
+	if lastUsedAt.Valid {
+		if t, err := time.Parse(time.RFC3339, lastUsedAt.String); err == nil {
+			m.LastUsedAt = &t
+		}
+	}
+	m.Favorite = favorite == 1
+	m.Hidden = hidden == 1
+	if err := json.Unmarshal([]byte(tags), &m.Tags); err != nil {
+		return nil, fmt.Errorf("failed to parse tags for %s: %w", m.Name, err)
+	}
+	if m.Tags == nil {
+		m.Tags = []string{}
+	}
+	m.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
+	return m, nil
+}
+
+// GetModelMetadata returns the metadata for a model, or an empty record if
+// none has been saved
+func GetModelMetadata(db *sql.DB, name string) (*ModelMetadata, error) {
+	row := db.QueryRow(`SELECT `+modelMetadataColumns+` FROM model_metadata WHERE name = ?`, name)
+	m, err := scanModelMetadata(row)
+	if err == sql.ErrNoRows {
+		return &ModelMetadata{Name: name, Tags: []string{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get model metadata: %w", err)
+	}
+	return m, nil
+}
+
+// ListModelMetadata returns all saved model metadata keyed by model name
+func ListModelMetadata(db *sql.DB) (map[string]*ModelMetadata, error) {
+	rows, err := db.Query(`SELECT ` + modelMetadataColumns + ` FROM model_metadata`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list model metadata: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string]*ModelMetadata)
+	for rows.Next() {
+		m, err := scanModelMetadata(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan model metadata: %w", err)
+		}
+		result[m.Name] = m
+	}
+	return result, rows.Err()
+}
+
+// SaveModelMetadata inserts or replaces the metadata for a model
+func SaveModelMetadata(db *sql.DB, m *ModelMetadata) error {
+	if m.Tags == nil {
+		m.Tags = []string{}
+	}
+	tags, err := json.Marshal(m.Tags)
+	if err != nil {
+		return fmt.Errorf("failed to encode tags: %w", err)
+	}
+	m.UpdatedAt = time.Now().UTC()
+
+	_, err = db.Exec(`
+		INSERT INTO model_metadata (name, display_name, tags, notes, favorite, hidden, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			display_name = excluded.display_name,
+			tags = excluded.tags,
+			notes = excluded.notes,
+			favorite = excluded.favorite,
+			hidden = excluded.hidden,
+			updated_at = excluded.updated_at`,
+		m.Name, m.DisplayName, string(tags), m.Notes, m.Favorite, m.Hidden, m.UpdatedAt.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to save model metadata: %w", err)
+	}
+	return nil
+}
+
+// SetModelCorruption quarantines a model that failed checksum verification,
+// or releases it when reason is empty. The model's other metadata is kept.
+func SetModelCorruption(db *sql.DB, name, reason string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	var corruptedAt any
+	if reason != "" {
+		corruptedAt = now
+	}
+	_, err := db.Exec(`
+		INSERT INTO model_metadata (name, corruption, corrupted_at, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			corruption = excluded.corruption,
+			corrupted_at = CASE WHEN excluded.corruption = '' THEN NULL
+				ELSE COALESCE(model_metadata.corrupted_at, excluded.corrupted_at) END,
+			updated_at = excluded.updated_at`,
+		name, reason, corruptedAt, now)
+	if err != nil {
+		return fmt.Errorf("failed to save model corruption: %w", err)
+	}
+	return nil
+}
+
+// RecordModelUsage records that a model answered a chat at the given time,
+// counting the use. The model's other metadata is kept.
+func RecordModelUsage(db *sql.DB, name string, at time.Time) error {
+	usedAt := at.UTC().Format(time.RFC3339)
+	_, err := db.Exec(`
+		INSERT INTO model_metadata (name, last_used_at, use_count, updated_at)
+		VALUES (?, ?, 1, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			last_used_at = excluded.last_used_at,
+			use_count = model_metadata.use_count + 1`,
+		name, usedAt, usedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record model usage: %w", err)
+	}
+	return nil
+}
+
+// DeleteModelMetadata removes the metadata for a model
+func DeleteModelMetadata(db *sql.DB, name string) error {
+	if _, err := db.Exec(`DELETE FROM model_metadata WHERE name = ?`, name); err != nil {
+		return fmt.Errorf("failed to delete model metadata: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Project groups related chats with shared instructions and knowledge links
+type Project struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Instructions string `json:"instructions"`
+	Color        string `json:"color"`
+	// DefaultAgentID names the agent new chats in the project start with
+	DefaultAgentID *string       `json:"default_agent_id,omitempty"`
+	Links          []ProjectLink `json:"links"`
+	ChatCount      int           `json:"chat_count"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+}
+
+// ProjectLink is a reference URL attached to a project as knowledge
+type ProjectLink struct {
+	ID          string    `json:"id"`
+	ProjectID   string    `json:"project_id"`
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// projectColumns is the column list matching scanProject
+const projectColumns = `id, name, description, instructions, color, default_agent_id, created_at, updated_at,
+	(SELECT COUNT(*) FROM chats WHERE chats.project_id = projects.id)`
+
+// scanProject scans a row selected with projectColumns
+func scanProject(row rowScanner) (*Project, error) {
+	p := &Project{Links: []ProjectLink{}}
+	var defaultAgentID sql.NullString
+	var createdAt, updatedAt string
+	if err := row.Scan(&p.ID, &p.Name, &p.Description, &p.Instructions, &p.Color, &defaultAgentID,
+		&createdAt, &updatedAt, &p.ChatCount); err != nil {
+		return nil, err
+	}
+	if defaultAgentID.Valid {
+		p.DefaultAgentID = &defaultAgentID.String
+	}
+	p.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	p.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
+	return p, nil
+}
+
+// CreateProject stores a new project
+func CreateProject(db *sql.DB, p *Project) error {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	now := time.Now().UTC()
+	p.CreatedAt = now
+	p.UpdatedAt = now
+	if p.Links == nil {
+		p.Links = []ProjectLink{}
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO projects (id, name, description, instructions, color, default_agent_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.ID, p.Name, p.Description, p.Instructions, p.Color, p.DefaultAgentID,
+		now.Format(time.RFC3339), now.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to create project: %w", err)
+	}
+	return nil
+}
+
+// GetProject returns a project with its links, or nil if it doesn't exist
+func GetProject(db *sql.DB, id string) (*Project, error) {
+	p, err := scanProject(db.QueryRow(`SELECT `+projectColumns+` FROM projects WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+
+	links, err := ListProjectLinks(db, id)
+	if err != nil {
+		return nil, err
+	}
+	p.Links = links
+	return p, nil
+}
+
+// ListProjects returns all projects ordered by name, without their links
+func ListProjects(db *sql.DB) ([]Project, error) {
+	rows, err := db.Query(`SELECT ` + projectColumns + ` FROM projects ORDER BY name COLLATE NOCASE`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+	defer rows.Close()
+
+	projects := []Project{}
+	for rows.Next() {
+		p, err := scanProject(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan project: %w", err)
+		}
+		projects = append(projects, *p)
+	}
+	return projects, rows.Err()
+}
+
+// UpdateProject saves a project's editable fields
+func UpdateProject(db *sql.DB, p *Project) error {
+	p.UpdatedAt = time.Now().UTC()
+
+	_, err := db.Exec(`
+		UPDATE projects SET name = ?, description = ?, instructions = ?, color = ?, default_agent_id = ?, updated_at = ?
+		WHERE id = ?`,
+		p.Name, p.Description, p.Instructions, p.Color, p.DefaultAgentID, p.UpdatedAt.Format(time.RFC3339), p.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update project: %w", err)
+	}
+	return nil
+}
+
+// DeleteProject removes a project and its links, and detaches its RAG
+// collections. Its chats are kept and become unfiled.
+func DeleteProject(db *sql.DB, id string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to delete project: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM projects WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete project: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("project not found")
+	}
+
+	// Links are removed explicitly since foreign keys may be disabled
+	if _, err := tx.Exec(`DELETE FROM project_links WHERE project_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete project links: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM rag_collection_links WHERE target_type = ? AND target_id = ?`,
+		RAGTargetProject, id); err != nil {
+		return fmt.Errorf("failed to detach project collections: %w", err)
+	}
+	if _, err := tx.Exec(`
+		UPDATE chats SET project_id = NULL, updated_at = ?, sync_version = sync_version + 1
+		WHERE project_id = ?`, time.Now().UTC().Format(time.RFC3339), id); err != nil {
+		return fmt.Errorf("failed to unfile project chats: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ListProjectLinks returns a project's links, oldest first
+func ListProjectLinks(db *sql.DB, projectID string) ([]ProjectLink, error) {
+	rows, err := db.Query(`
+		SELECT id, project_id, url, title, description, created_at
+		FROM project_links WHERE project_id = ? ORDER BY created_at`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list project links: %w", err)
+	}
+	defer rows.Close()
+
+	links := []ProjectLink{}
+	for rows.Next() {
+		var link ProjectLink
+		var createdAt string
+		if err := rows.Scan(&link.ID, &link.ProjectID, &link.URL, &link.Title, &link.Description, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan project link: %w", err)
+		}
+		link.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// CreateProjectLink attaches a link to a project
+func CreateProjectLink(db *sql.DB, link *ProjectLink) error {
+	if link.ID == "" {
+		link.ID = uuid.New().String()
+	}
+	link.CreatedAt = time.Now().UTC()
+
+	_, err := db.Exec(`
+		INSERT INTO project_links (id, project_id, url, title, description, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		link.ID, link.ProjectID, link.URL, link.Title, link.Description, link.CreatedAt.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to create project link: %w", err)
+	}
+	return nil
+}
+
+// DeleteProjectLink removes a link from a project
+func DeleteProjectLink(db *sql.DB, projectID, linkID string) error {
+	result, err := db.Exec(`DELETE FROM project_links WHERE id = ? AND project_id = ?`, linkID, projectID)
+	if err != nil {
+		return fmt.Errorf("failed to delete project link: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("project link not found")
+	}
+	return nil
+}
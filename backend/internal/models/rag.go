@@ -0,0 +1,777 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Link target types for RAG collections
+const (
+	RAGTargetProject = "project"
+	RAGTargetAgent   = "agent"
+)
+
+// Chunking strategies for RAG collections
+const (
+	// RAGChunkCharacters splits text into fixed-size character windows
+	RAGChunkCharacters = "characters"
+	// RAGChunkFixed splits text into fixed-size token windows
+	RAGChunkFixed = "fixed"
+	// RAGChunkParagraph packs whole paragraphs, splitting long ones at sentences
+	RAGChunkParagraph = "paragraph"
+	// RAGChunkMarkdown chunks each markdown section under its header path
+	RAGChunkMarkdown = "markdown"
+	// RAGChunkCode packs whole top-level definitions such as functions and types
+	RAGChunkCode = "code"
+)
+
+// RAGCollection is a named group of ingested documents. All chunks in a
+// collection are embedded with the same model.
+type RAGCollection struct {
+	ID             string      `json:"id"`
+	Name           string      `json:"name"`
+	Description    string      `json:"description"`
+	EmbeddingModel string      `json:"embedding_model"`
+	Chunking       RAGChunking `json:"chunking"`
+	ProjectIDs     []string    `json:"project_ids"`
+	AgentIDs       []string    `json:"agent_ids"`
+	DocumentCount  int         `json:"document_count"`
+	ChunkCount     int         `json:"chunk_count"`
+	CreatedAt      time.Time   `json:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+}
+
+// RAGChunking configures how a collection's documents are split into chunks.
+// Size and Overlap are in tokens, except for the character strategy, which
+// uses its own fixed sizes.
+type RAGChunking struct {
+	Strategy string `json:"strategy"`
+	Size     int    `json:"size"`
+	Overlap  int    `json:"overlap"`
+}
+
+// RAGDocument is a document ingested into a collection
+type RAGDocument struct {
+	ID           string `json:"id"`
+	CollectionID string `json:"collection_id"`
+	Title        string `json:"title"`
+	Source       string `json:"source"`
+	// URL is set for documents fetched from the web, which are re-crawled
+	URL string `json:"url,omitempty"`
+	// ContentHash identifies the ingested text so unchanged re-ingestions are skipped
+	ContentHash string     `json:"content_hash"`
+	ChunkCount  int        `json:"chunk_count"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	FetchedAt   *time.Time `json:"fetched_at,omitempty"`
+}
+
+// RAGChunk is an embedded piece of a document
+type RAGChunk struct {
+	ID            int64     `json:"id"`
+	DocumentID    string    `json:"document_id"`
+	DocumentTitle string    `json:"document_title"`
+	CollectionID  string    `json:"collection_id"`
+	Seq           int       `json:"seq"`
+	Content       string    `json:"content"`
+	Embedding     []float32 `json:"-"`
+}
+
+// ragCollectionColumns is the column list matching scanRAGCollection
+const ragCollectionColumns = `id, name, description, embedding_model, chunk_strategy, chunk_size, chunk_overlap,
+	created_at, updated_at,
+	(SELECT COUNT(*) FROM rag_documents d WHERE d.collection_id = rag_collections.id),
+	(SELECT COUNT(*) FROM rag_chunks k WHERE k.collection_id = rag_collections.id)`
+
+// scanRAGCollection scans a row selected with ragCollectionColumns
+func scanRAGCollection(row rowScanner) (*RAGCollection, error) {
+	col := &RAGCollection{ProjectIDs: []string{}, AgentIDs: []string{}}
+	var createdAt, updatedAt string
+	if err := row.Scan(&col.ID, &col.Name, &col.Description, &col.EmbeddingModel, &col.Chunking.Strategy,
+		&col.Chunking.Size, &col.Chunking.Overlap, &createdAt, &updatedAt,
+		&col.DocumentCount, &col.ChunkCount); err != nil {
+		return nil, err
+	}
+	col.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	col.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
+	return col, nil
+}
+
+// CreateRAGCollection stores a new collection and its links
+func CreateRAGCollection(db *sql.DB, col *RAGCollection) error {
+	if col.ID == "" {
+		col.ID = uuid.New().String()
+	}
+	now := time.Now().UTC()
+	col.CreatedAt = now
+	col.UpdatedAt = now
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to create collection: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO rag_collections (id, name, description, embedding_model, chunk_strategy, chunk_size, chunk_overlap,
+			created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		col.ID, col.Name, col.Description, col.EmbeddingModel, col.Chunking.Strategy, col.Chunking.Size,
+		col.Chunking.Overlap, now.Format(time.RFC3339), now.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to create collection: %w", err)
+	}
+	if err := replaceRAGCollectionLinks(tx, col); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetRAGCollection returns a collection with its links, or nil if it doesn't exist
+func GetRAGCollection(db *sql.DB, id string) (*RAGCollection, error) {
+	col, err := scanRAGCollection(db.QueryRow(`SELECT `+ragCollectionColumns+` FROM rag_collections WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection: %w", err)
+	}
+	if err := loadRAGCollectionLinks(db, []*RAGCollection{col}); err != nil {
+		return nil, err
+	}
+	return col, nil
+}
+
+// ListRAGCollections returns collections ordered by name. With a target type
+// and ID, only collections linked to that project or agent are returned.
+func ListRAGCollections(db *sql.DB, targetType, targetID string) ([]RAGCollection, error) {
+	query := `SELECT ` + ragCollectionColumns + ` FROM rag_collections`
+	var args []any
+	if targetType != "" {
+		query += ` WHERE id IN (SELECT collection_id FROM rag_collection_links WHERE target_type = ? AND target_id = ?)`
+		args = append(args, targetType, targetID)
+	}
+	query += ` ORDER BY name COLLATE NOCASE`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	defer rows.Close()
+
+	var cols []*RAGCollection
+	for rows.Next() {
+		col, err := scanRAGCollection(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan collection: %w", err)
+		}
+		cols = append(cols, col)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := loadRAGCollectionLinks(db, cols); err != nil {
+		return nil, err
+	}
+	result := make([]RAGCollection, 0, len(cols))
+	for _, col := range cols {
+		result = append(result, *col)
+	}
+	return result, nil
+}
+
+// UpdateRAGCollection saves a collection's name, description, embedding
+// model and links
+func UpdateRAGCollection(db *sql.DB, col *RAGCollection) error {
+	col.UpdatedAt = time.Now().UTC()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to update collection: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE rag_collections SET name = ?, description = ?, embedding_model = ?, chunk_strategy = ?, chunk_size = ?,
+			chunk_overlap = ?, updated_at = ?
+		WHERE id = ?`,
+		col.Name, col.Description, col.EmbeddingModel, col.Chunking.Strategy, col.Chunking.Size, col.Chunking.Overlap,
+		col.UpdatedAt.Format(time.RFC3339), col.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update collection: %w", err)
+	}
+	if err := replaceRAGCollectionLinks(tx, col); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteRAGCollection removes a collection with its documents, chunks and links
+func DeleteRAGCollection(db *sql.DB, id string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to delete collection: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM rag_collections WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete collection: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("collection not found")
+	}
+
+	// Dependents are removed explicitly since foreign keys may be disabled
+	for _, table := range []string{"rag_chunks", "rag_documents", "rag_collection_links", "rag_uploads"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE collection_id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete collection: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// replaceRAGCollectionLinks replaces a collection's project and agent links
+func replaceRAGCollectionLinks(tx *sql.Tx, col *RAGCollection) error {
+	if _, err := tx.Exec(`DELETE FROM rag_collection_links WHERE collection_id = ?`, col.ID); err != nil {
+		return fmt.Errorf("failed to update collection links: %w", err)
+	}
+	links := map[string][]string{RAGTargetProject: col.ProjectIDs, RAGTargetAgent: col.AgentIDs}
+	for targetType, ids := range links {
+		for _, id := range ids {
+			if _, err := tx.Exec(`
+				INSERT OR IGNORE INTO rag_collection_links (collection_id, target_type, target_id)
+				VALUES (?, ?, ?)`, col.ID, targetType, id); err != nil {
+				return fmt.Errorf("failed to update collection links: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// loadRAGCollectionLinks fills in the project and agent IDs of collections
+func loadRAGCollectionLinks(db *sql.DB, cols []*RAGCollection) error {
+	if len(cols) == 0 {
+		return nil
+	}
+	byID := make(map[string]*RAGCollection, len(cols))
+	placeholders := make([]string, 0, len(cols))
+	args := make([]any, 0, len(cols))
+	for _, col := range cols {
+		byID[col.ID] = col
+		placeholders = append(placeholders, "?")
+		args = append(args, col.ID)
+	}
+
+	rows, err := db.Query(`
+		SELECT collection_id, target_type, target_id FROM rag_collection_links
+		WHERE collection_id IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY target_id`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to load collection links: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var collectionID, targetType, targetID string
+		if err := rows.Scan(&collectionID, &targetType, &targetID); err != nil {
+			return fmt.Errorf("failed to scan collection link: %w", err)
+		}
+		col := byID[collectionID]
+		switch targetType {
+		case RAGTargetProject:
+			col.ProjectIDs = append(col.ProjectIDs, targetID)
+		case RAGTargetAgent:
+			col.AgentIDs = append(col.AgentIDs, targetID)
+		}
+	}
+	return rows.Err()
+}
+
+// LinkedRAGCollectionIDs returns the collections attached to a project or an
+// agent. Empty IDs are ignored.
+func LinkedRAGCollectionIDs(db *sql.DB, projectID, agentID string) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT collection_id FROM rag_collection_links
+		WHERE (target_type = ? AND target_id = ? AND ? != '')
+		   OR (target_type = ? AND target_id = ? AND ? != '')`,
+		RAGTargetProject, projectID, projectID, RAGTargetAgent, agentID, agentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get linked collections: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan linked collection: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ragDocumentColumns is the column list matching scanRAGDocument
+const ragDocumentColumns = `id, collection_id, title, source, url, content_hash, chunk_count, created_at,
+	COALESCE(updated_at, created_at), fetched_at`
+
+// scanRAGDocument scans a row selected with ragDocumentColumns
+func scanRAGDocument(row rowScanner) (*RAGDocument, error) {
+	doc := &RAGDocument{}
+	var createdAt, updatedAt string
+	var fetchedAt sql.NullString
+	if err := row.Scan(&doc.ID, &doc.CollectionID, &doc.Title, &doc.Source, &doc.URL, &doc.ContentHash,
+		&doc.ChunkCount, &createdAt, &updatedAt, &fetchedAt); err != nil {
+		return nil, err
+	}
+	doc.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	doc.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
+	if fetchedAt.Valid {
+		t, _ := time.Parse(time.RFC3339, fetchedAt.String)
+		doc.FetchedAt = &t
+	}
+	return doc, nil
+}
+
+// formatOptionalTime formats t as RFC3339, or returns nil for a nil time
+func formatOptionalTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.Format(time.RFC3339)
+}
+
+// CreateRAGDocument stores a document and its embedded chunks
+func CreateRAGDocument(db *sql.DB, doc *RAGDocument, chunks []RAGChunk) error {
+	if doc.ID == "" {
+		doc.ID = uuid.New().String()
+	}
+	doc.CreatedAt = time.Now().UTC()
+	doc.UpdatedAt = doc.CreatedAt
+	doc.ChunkCount = len(chunks)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to create document: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO rag_documents (id, collection_id, title, source, url, content_hash, chunk_count, created_at, updated_at, fetched_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		doc.ID, doc.CollectionID, doc.Title, doc.Source, doc.URL, doc.ContentHash, doc.ChunkCount,
+		doc.CreatedAt.Format(time.RFC3339), doc.UpdatedAt.Format(time.RFC3339), formatOptionalTime(doc.FetchedAt))
+	if err != nil {
+		return fmt.Errorf("failed to create document: %w", err)
+	}
+	if err := insertRAGChunks(tx, doc, chunks); err != nil {
+		return err
+	}
+	if err := touchRAGCollection(tx, doc.CollectionID, doc.UpdatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateRAGDocument replaces a document's chunks with the given ones. Chunks
+// with an ID are existing chunks that are kept (and renumbered); chunks
+// without one are inserted; the document's other chunks are removed.
+func UpdateRAGDocument(db *sql.DB, doc *RAGDocument, chunks []RAGChunk) error {
+	doc.UpdatedAt = time.Now().UTC()
+	doc.ChunkCount = len(chunks)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to update document: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE rag_documents SET title = ?, source = ?, url = ?, content_hash = ?, chunk_count = ?, updated_at = ?, fetched_at = ?
+		WHERE id = ?`,
+		doc.Title, doc.Source, doc.URL, doc.ContentHash, doc.ChunkCount, doc.UpdatedAt.Format(time.RFC3339),
+		formatOptionalTime(doc.FetchedAt), doc.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update document: %w", err)
+	}
+
+	kept := []any{doc.ID}
+	placeholders := []string{}
+	var added []RAGChunk
+	for i, chunk := range chunks {
+		if chunk.ID == 0 {
+			chunk.Seq = i
+			added = append(added, chunk)
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE rag_chunks SET seq = ? WHERE id = ?`, i, chunk.ID); err != nil {
+			return fmt.Errorf("failed to update chunk: %w", err)
+		}
+		kept = append(kept, chunk.ID)
+		placeholders = append(placeholders, "?")
+	}
+
+	removeQuery := `DELETE FROM rag_chunks WHERE document_id = ?`
+	if len(placeholders) > 0 {
+		removeQuery += ` AND id NOT IN (` + strings.Join(placeholders, ", ") + `)`
+	}
+	if _, err := tx.Exec(removeQuery, kept...); err != nil {
+		return fmt.Errorf("failed to remove stale chunks: %w", err)
+	}
+	if err := insertRAGChunks(tx, doc, added); err != nil {
+		return err
+	}
+	if err := touchRAGCollection(tx, doc.CollectionID, doc.UpdatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertRAGChunks stores new chunks of a document, keeping their Seq
+func insertRAGChunks(tx *sql.Tx, doc *RAGDocument, chunks []RAGChunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+	stmt, err := tx.Prepare(`
+		INSERT INTO rag_chunks (document_id, collection_id, seq, content, embedding)
+		VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to store chunks: %w", err)
+	}
+	defer stmt.Close()
+	for _, chunk := range chunks {
+		if _, err := stmt.Exec(doc.ID, doc.CollectionID, chunk.Seq, chunk.Content, EncodeEmbedding(chunk.Embedding)); err != nil {
+			return fmt.Errorf("failed to store chunk: %w", err)
+		}
+	}
+	return nil
+}
+
+// UpdateRAGChunkEmbeddings replaces the embeddings of existing chunks
+func UpdateRAGChunkEmbeddings(db *sql.DB, chunks []RAGChunk) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to update embeddings: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`UPDATE rag_chunks SET embedding = ? WHERE id = ?`)
+	if err != nil {
+		return fmt.Errorf("failed to update embeddings: %w", err)
+	}
+	defer stmt.Close()
+	for _, chunk := range chunks {
+		if _, err := stmt.Exec(EncodeEmbedding(chunk.Embedding), chunk.ID); err != nil {
+			return fmt.Errorf("failed to update embedding: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// touchRAGCollection bumps a collection's updated_at
+func touchRAGCollection(tx *sql.Tx, collectionID string, t time.Time) error {
+	if _, err := tx.Exec(`UPDATE rag_collections SET updated_at = ? WHERE id = ?`,
+		t.Format(time.RFC3339), collectionID); err != nil {
+		return fmt.Errorf("failed to update collection: %w", err)
+	}
+	return nil
+}
+
+// SetRAGDocumentFetched records when a URL document was last crawled
+func SetRAGDocumentFetched(db *sql.DB, id string, t time.Time) error {
+	if _, err := db.Exec(`UPDATE rag_documents SET fetched_at = ? WHERE id = ?`, t.Format(time.RFC3339), id); err != nil {
+		return fmt.Errorf("failed to update document: %w", err)
+	}
+	return nil
+}
+
+// GetRAGDocument returns a document in a collection, or nil if it doesn't exist
+func GetRAGDocument(db *sql.DB, collectionID, id string) (*RAGDocument, error) {
+	doc, err := scanRAGDocument(db.QueryRow(`SELECT `+ragDocumentColumns+`
+		FROM rag_documents WHERE id = ? AND collection_id = ?`, id, collectionID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document: %w", err)
+	}
+	return doc, nil
+}
+
+// FindRAGDocument returns the document in a collection that was ingested
+// from a URL or, without one, from a source. Returns nil if there's none or
+// both are empty.
+func FindRAGDocument(db *sql.DB, collectionID, url, source string) (*RAGDocument, error) {
+	column, value := "url", url
+	if url == "" {
+		column, value = "source", source
+	}
+	if value == "" {
+		return nil, nil
+	}
+
+	doc, err := scanRAGDocument(db.QueryRow(`SELECT `+ragDocumentColumns+`
+		FROM rag_documents WHERE collection_id = ? AND `+column+` = ?
+		ORDER BY created_at LIMIT 1`, collectionID, value))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find document: %w", err)
+	}
+	return doc, nil
+}
+
+// ListRAGDocuments returns a collection's documents, newest first
+func ListRAGDocuments(db *sql.DB, collectionID string) ([]RAGDocument, error) {
+	return queryRAGDocuments(db, `SELECT `+ragDocumentColumns+`
+		FROM rag_documents WHERE collection_id = ? ORDER BY created_at DESC`, collectionID)
+}
+
+// ListRAGDocumentsToRecrawl returns URL documents not crawled since cutoff,
+// least recently crawled first
+func ListRAGDocumentsToRecrawl(db *sql.DB, cutoff time.Time, limit int) ([]RAGDocument, error) {
+	return queryRAGDocuments(db, `SELECT `+ragDocumentColumns+`
+		FROM rag_documents
+		WHERE url != '' AND (fetched_at IS NULL OR datetime(fetched_at) < datetime(?))
+		ORDER BY COALESCE(fetched_at, '') LIMIT ?`, cutoff.Format(time.RFC3339), limit)
+}
+
+// queryRAGDocuments runs a query selecting ragDocumentColumns
+func queryRAGDocuments(db *sql.DB, query string, args ...any) ([]RAGDocument, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+	defer rows.Close()
+
+	docs := []RAGDocument{}
+	for rows.Next() {
+		doc, err := scanRAGDocument(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		docs = append(docs, *doc)
+	}
+	return docs, rows.Err()
+}
+
+// GetRAGDocumentChunks returns a document's chunks in order, with embeddings
+func GetRAGDocumentChunks(db *sql.DB, documentID string) ([]RAGChunk, error) {
+	rows, err := db.Query(`
+		SELECT id, document_id, collection_id, seq, content, embedding
+		FROM rag_chunks WHERE document_id = ? ORDER BY seq`, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks []RAGChunk
+	for rows.Next() {
+		var chunk RAGChunk
+		var embedding []byte
+		if err := rows.Scan(&chunk.ID, &chunk.DocumentID, &chunk.CollectionID, &chunk.Seq, &chunk.Content, &embedding); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		chunk.Embedding = DecodeEmbedding(embedding)
+		chunks = append(chunks, chunk)
+	}
+	return chunks, rows.Err()
+}
+
+// DeleteRAGDocument removes a document and its chunks from a collection
+func DeleteRAGDocument(db *sql.DB, collectionID, documentID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM rag_documents WHERE id = ? AND collection_id = ?`, documentID, collectionID)
+	if err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("document not found")
+	}
+	if _, err := tx.Exec(`DELETE FROM rag_chunks WHERE document_id = ?`, documentID); err != nil {
+		return fmt.Errorf("failed to delete document chunks: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ForEachRAGChunk calls fn for every chunk in a collection. Chunks are
+// streamed so large collections aren't held in memory at once.
+func ForEachRAGChunk(db *sql.DB, collectionID string, fn func(chunk *RAGChunk)) error {
+	rows, err := db.Query(`
+		SELECT k.id, k.document_id, d.title, k.collection_id, k.seq, k.content, k.embedding
+		FROM rag_chunks k JOIN rag_documents d ON d.id = k.document_id
+		WHERE k.collection_id = ?`, collectionID)
+	if err != nil {
+		return fmt.Errorf("failed to read chunks: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var chunk RAGChunk
+		var embedding []byte
+		if err := rows.Scan(&chunk.ID, &chunk.DocumentID, &chunk.DocumentTitle, &chunk.CollectionID, &chunk.Seq, &chunk.Content, &embedding); err != nil {
+			return fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		chunk.Embedding = DecodeEmbedding(embedding)
+		fn(&chunk)
+	}
+	return rows.Err()
+}
+
+// ImportRAGCollection stores a new collection with imported documents and
+// chunks in one transaction. Documents get new IDs; nextChunk streams the
+// chunks in, naming their document by its imported ID, and returns nil when
+// there are no more. Links to projects and agents aren't imported.
+func ImportRAGCollection(db *sql.DB, col *RAGCollection, docs []RAGDocument, nextChunk func() (*RAGChunk, error)) error {
+	col.ID = uuid.New().String()
+	now := time.Now().UTC()
+	col.CreatedAt = now
+	col.UpdatedAt = now
+	col.ProjectIDs, col.AgentIDs = []string{}, []string{}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to import collection: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO rag_collections (id, name, description, embedding_model, chunk_strategy, chunk_size, chunk_overlap,
+			created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		col.ID, col.Name, col.Description, col.EmbeddingModel, col.Chunking.Strategy, col.Chunking.Size,
+		col.Chunking.Overlap, now.Format(time.RFC3339), now.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to import collection: %w", err)
+	}
+
+	docIDs := make(map[string]string, len(docs))
+	for _, doc := range docs {
+		id := uuid.New().String()
+		docIDs[doc.ID] = id
+		if doc.CreatedAt.IsZero() {
+			doc.CreatedAt = now
+		}
+		if doc.UpdatedAt.IsZero() {
+			doc.UpdatedAt = doc.CreatedAt
+		}
+		_, err := tx.Exec(`
+			INSERT INTO rag_documents (id, collection_id, title, source, url, content_hash, chunk_count, created_at, updated_at, fetched_at)
+			VALUES (?, ?, ?, ?, ?, ?, 0, ?, ?, ?)`,
+			id, col.ID, doc.Title, doc.Source, doc.URL, doc.ContentHash, doc.CreatedAt.UTC().Format(time.RFC3339),
+			doc.UpdatedAt.UTC().Format(time.RFC3339), formatOptionalTime(doc.FetchedAt))
+		if err != nil {
+			return fmt.Errorf("failed to import document: %w", err)
+		}
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO rag_chunks (document_id, collection_id, seq, content, embedding)
+		VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to import chunks: %w", err)
+	}
+	defer stmt.Close()
+	for {
+		chunk, err := nextChunk()
+		if err != nil {
+			return err
+		}
+		if chunk == nil {
+			break
+		}
+		docID, ok := docIDs[chunk.DocumentID]
+		if !ok {
+			return fmt.Errorf("chunk refers to unknown document %q", chunk.DocumentID)
+		}
+		if _, err := stmt.Exec(docID, col.ID, chunk.Seq, chunk.Content, EncodeEmbedding(chunk.Embedding)); err != nil {
+			return fmt.Errorf("failed to import chunk: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE rag_documents SET chunk_count = (SELECT COUNT(*) FROM rag_chunks k WHERE k.document_id = rag_documents.id)
+		WHERE collection_id = ?`, col.ID); err != nil {
+		return fmt.Errorf("failed to count imported chunks: %w", err)
+	}
+	return tx.Commit()
+}
+
+// RAGKeywordMatch is a chunk found by keyword search. BM25 is SQLite's
+// bm25() rank, where lower (more negative) is better.
+type RAGKeywordMatch struct {
+	Chunk RAGChunk
+	BM25  float64
+}
+
+// SearchRAGChunks runs an FTS5 match expression against the chunks of the
+// given collections and returns up to limit matches, best first. Embeddings
+// aren't loaded.
+func SearchRAGChunks(db *sql.DB, collectionIDs []string, match string, limit int) ([]RAGKeywordMatch, error) {
+	if len(collectionIDs) == 0 || match == "" {
+		return nil, nil
+	}
+	placeholders := make([]string, len(collectionIDs))
+	args := []any{match}
+	for i, id := range collectionIDs {
+		placeholders[i] = "?"
+		args = append(args, id)
+	}
+	args = append(args, limit)
+
+	rows, err := db.Query(`
+		SELECT k.id, k.document_id, d.title, k.collection_id, k.seq, k.content, bm25(rag_chunks_fts)
+		FROM rag_chunks_fts
+		JOIN rag_chunks k ON k.id = rag_chunks_fts.rowid
+		JOIN rag_documents d ON d.id = k.document_id
+		WHERE rag_chunks_fts MATCH ? AND k.collection_id IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY bm25(rag_chunks_fts) LIMIT ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var matches []RAGKeywordMatch
+	for rows.Next() {
+		var m RAGKeywordMatch
+		if err := rows.Scan(&m.Chunk.ID, &m.Chunk.DocumentID, &m.Chunk.DocumentTitle, &m.Chunk.CollectionID,
+			&m.Chunk.Seq, &m.Chunk.Content, &m.BM25); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// EncodeEmbedding packs an embedding as little-endian float32s
+func EncodeEmbedding(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(f))
+	}
+	return buf
+}
+
+// DecodeEmbedding unpacks an embedding stored by EncodeEmbedding
+func DecodeEmbedding(buf []byte) []float32 {
+	v := make([]float32, len(buf)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return v
+}
@@ -0,0 +1,186 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RAG upload statuses
+const (
+	RAGUploadQueued    = "queued"
+	RAGUploadRunning   = "running"
+	RAGUploadCompleted = "completed"
+	RAGUploadFailed    = "failed"
+	RAGUploadCancelled = "cancelled"
+)
+
+// RAG upload stages, in the order they run
+const (
+	RAGStageExtract = "extract"
+	RAGStageChunk   = "chunk"
+	RAGStageEmbed   = "embed"
+	RAGStageStore   = "store"
+)
+
+// RAGUpload tracks a file being ingested into a collection. Stage is the
+// stage currently running, or the one a failed or cancelled upload resumes at.
+type RAGUpload struct {
+	ID             string    `json:"id"`
+	CollectionID   string    `json:"collection_id"`
+	Filename       string    `json:"filename"`
+	Title          string    `json:"title"`
+	Size           int64     `json:"size"`
+	Status         string    `json:"status"`
+	Stage          string    `json:"stage"`
+	PagesTotal     int       `json:"pages_total"`
+	PagesDone      int       `json:"pages_done"`
+	ChunksTotal    int       `json:"chunks_total"`
+	ChunksEmbedded int       `json:"chunks_embedded"`
+	DocumentID     *string   `json:"document_id,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Finished reports whether the upload is no longer queued or running
+func (u *RAGUpload) Finished() bool {
+	return u.Status != RAGUploadQueued && u.Status != RAGUploadRunning
+}
+
+// ragUploadColumns is the column list matching scanRAGUpload
+const ragUploadColumns = `id, collection_id, filename, title, size, status, stage, pages_total, pages_done,
+	chunks_total, chunks_embedded, document_id, error, created_at, updated_at`
+
+// scanRAGUpload scans a row selected with ragUploadColumns
+func scanRAGUpload(row rowScanner) (*RAGUpload, error) {
+	u := &RAGUpload{}
+	var documentID sql.NullString
+	var createdAt, updatedAt string
+	if err := row.Scan(&u.ID, &u.CollectionID, &u.Filename, &u.Title, &u.Size, &u.Status, &u.Stage,
+		&u.PagesTotal, &u.PagesDone, &u.ChunksTotal, &u.ChunksEmbedded, &documentID, &u.Error,
+		&createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	if documentID.Valid {
+		u.DocumentID = &documentID.String
+	}
+	u.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	u.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
+	return u, nil
+}
+
+// CreateRAGUpload stores a new upload
+func CreateRAGUpload(db *sql.DB, u *RAGUpload) error {
+	if u.ID == "" {
+		u.ID = uuid.New().String()
+	}
+	now := time.Now().UTC()
+	u.CreatedAt = now
+	u.UpdatedAt = now
+
+	_, err := db.Exec(`
+		INSERT INTO rag_uploads (id, collection_id, filename, title, size, status, stage, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		u.ID, u.CollectionID, u.Filename, u.Title, u.Size, u.Status, u.Stage,
+		now.Format(time.RFC3339), now.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to create upload: %w", err)
+	}
+	return nil
+}
+
+// GetRAGUpload returns an upload in a collection, or nil if it doesn't exist
+func GetRAGUpload(db *sql.DB, collectionID, id string) (*RAGUpload, error) {
+	u, err := scanRAGUpload(db.QueryRow(`SELECT `+ragUploadColumns+`
+		FROM rag_uploads WHERE id = ? AND collection_id = ?`, id, collectionID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upload: %w", err)
+	}
+	return u, nil
+}
+
+// ListRAGUploads returns a collection's uploads, newest first
+func ListRAGUploads(db *sql.DB, collectionID string) ([]RAGUpload, error) {
+	rows, err := db.Query(`SELECT `+ragUploadColumns+`
+		FROM rag_uploads WHERE collection_id = ? ORDER BY created_at DESC`, collectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list uploads: %w", err)
+	}
+	defer rows.Close()
+
+	uploads := []RAGUpload{}
+	for rows.Next() {
+		u, err := scanRAGUpload(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan upload: %w", err)
+		}
+		uploads = append(uploads, *u)
+	}
+	return uploads, rows.Err()
+}
+
+// ListAllRAGUploads returns the uploads of every collection
+func ListAllRAGUploads(db *sql.DB) ([]RAGUpload, error) {
+	rows, err := db.Query(`SELECT ` + ragUploadColumns + ` FROM rag_uploads`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list uploads: %w", err)
+	}
+	defer rows.Close()
+
+	uploads := []RAGUpload{}
+	for rows.Next() {
+		u, err := scanRAGUpload(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan upload: %w", err)
+		}
+		uploads = append(uploads, *u)
+	}
+	return uploads, rows.Err()
+}
+
+// SaveRAGUploadProgress stores an upload's status, stage and progress counters
+func SaveRAGUploadProgress(db *sql.DB, u *RAGUpload) error {
+	u.UpdatedAt = time.Now().UTC()
+
+	_, err := db.Exec(`
+		UPDATE rag_uploads SET status = ?, stage = ?, pages_total = ?, pages_done = ?, chunks_total = ?,
+			chunks_embedded = ?, document_id = ?, error = ?, updated_at = ?
+		WHERE id = ?`,
+		u.Status, u.Stage, u.PagesTotal, u.PagesDone, u.ChunksTotal, u.ChunksEmbedded, u.DocumentID,
+		u.Error, u.UpdatedAt.Format(time.RFC3339), u.ID)
+	if err != nil {
+		return fmt.Errorf("failed to save upload progress: %w", err)
+	}
+	return nil
+}
+
+// DeleteRAGUpload removes an upload record
+func DeleteRAGUpload(db *sql.DB, collectionID, id string) error {
+	result, err := db.Exec(`DELETE FROM rag_uploads WHERE id = ? AND collection_id = ?`, id, collectionID)
+	if err != nil {
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("upload not found")
+	}
+	return nil
+}
+
+// FailInterruptedRAGUploads marks uploads left queued or running by a
+// previous process as failed. They keep their stage so they can be resumed.
+func FailInterruptedRAGUploads(db *sql.DB) error {
+	_, err := db.Exec(`
+		UPDATE rag_uploads SET status = ?, error = 'interrupted by server restart', updated_at = ?
+		WHERE status IN (?, ?)`,
+		RAGUploadFailed, time.Now().UTC().Format(time.RFC3339), RAGUploadQueued, RAGUploadRunning)
+	if err != nil {
+		return fmt.Errorf("failed to clean up interrupted uploads: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// retentionPoliciesKey is the app_settings key holding RetentionPolicies
+const retentionPoliciesKey = "retention_policies"
+
+// retentionPreviewLimit caps how many affected items a report lists per policy
+const retentionPreviewLimit = 50
+
+// RetentionPolicies configure what scheduled retention removes. A zero value
+// disables a policy.
+type RetentionPolicies struct {
+	// ArchiveChatsAfterDays archives unpinned chats not updated for this many days
+	ArchiveChatsAfterDays int `json:"archive_chats_after_days"`
+	// PurgeUsageAfterDays deletes daily token usage records older than this
+	PurgeUsageAfterDays int `json:"purge_usage_after_days"`
+	// PurgeEvalRunsAfterDays deletes finished eval runs and their results
+	// older than this
+	PurgeEvalRunsAfterDays int `json:"purge_eval_runs_after_days"`
+}
+
+// RetentionItem identifies one record affected by a policy
+type RetentionItem struct {
+	ID    string `json:"id"`
+	Label string `json:"label,omitempty"`
+	Date  string `json:"date"`
+}
+
+// RetentionResult is what one policy affects (or affected)
+type RetentionResult struct {
+	Policy  string          `json:"policy"`
+	Enabled bool            `json:"enabled"`
+	Cutoff  string          `json:"cutoff,omitempty"`
+	Count   int64           `json:"count"`
+	Items   []RetentionItem `json:"items"`
+}
+
+// RetentionReport summarizes a retention preview or run
+type RetentionReport struct {
+	DryRun   bool              `json:"dry_run"`
+	RanAt    time.Time         `json:"ran_at"`
+	Policies []RetentionResult `json:"policies"`
+}
+
+// GetRetentionPolicies returns the stored policies (all disabled if unset)
+func GetRetentionPolicies(db *sql.DB) (*RetentionPolicies, error) {
+	policies := &RetentionPolicies{}
+
+	var value string
+	err := db.QueryRow(`SELECT value FROM app_settings WHERE key = ?`, retentionPoliciesKey).Scan(&value)
+	if err == sql.ErrNoRows {
+		return policies, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get retention policies: %w", err)
+	}
+	if err := json.Unmarshal([]byte(value), policies); err != nil {
+		return nil, fmt.Errorf("failed to parse retention policies: %w", err)
+	}
+	return policies, nil
+}
+
+// SaveRetentionPolicies replaces the stored policies
+func SaveRetentionPolicies(db *sql.DB, policies *RetentionPolicies) error {
+	value, err := json.Marshal(policies)
+	if err != nil {
+		return fmt.Errorf("failed to encode retention policies: %w", err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO app_settings (key, value, updated_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		retentionPoliciesKey, string(value), time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to save retention policies: %w", err)
+	}
+	return nil
+}
+
+// retentionPolicy is one policy's queries. Dates are compared through
+// SQLite's datetime() since rows mix RFC3339 and SQLite's default format.
+type retentionPolicy struct {
+	name  string
+	days  func(*RetentionPolicies) int
+	count string
+	list  string
+	apply string
+	// cutoff formats the cutoff time for the queries
+	cutoff func(time.Time) string
+}
+
+var retentionPolicies = []retentionPolicy{
+	{
+		name:  "archive_chats",
+		days:  func(p *RetentionPolicies) int { return p.ArchiveChatsAfterDays },
+		count: `SELECT COUNT(*) FROM chats WHERE archived = 0 AND pinned = 0 AND datetime(updated_at) < datetime(?)`,
+		list: `SELECT id, title, updated_at FROM chats
+			WHERE archived = 0 AND pinned = 0 AND datetime(updated_at) < datetime(?)
+			ORDER BY datetime(updated_at) LIMIT ?`,
+		apply: `UPDATE chats SET archived = 1, sync_version = sync_version + 1
+			WHERE archived = 0 AND pinned = 0 AND datetime(updated_at) < datetime(?)`,
+		cutoff: func(t time.Time) string { return t.Format(time.RFC3339) },
+	},
+	{
+		name:  "purge_usage",
+		days:  func(p *RetentionPolicies) int { return p.PurgeUsageAfterDays },
+		count: `SELECT COUNT(*) FROM token_usage WHERE day < ?`,
+		list: `SELECT scope || ':' || subject, '', day FROM token_usage
+			WHERE day < ? ORDER BY day LIMIT ?`,
+		apply:  `DELETE FROM token_usage WHERE day < ?`,
+		cutoff: UsageDay,
+	},
+	{
+		name: "purge_eval_runs",
+		days: func(p *RetentionPolicies) int { return p.PurgeEvalRunsAfterDays },
+		count: `SELECT COUNT(*) FROM eval_runs
+			WHERE finished_at IS NOT NULL AND datetime(finished_at) < datetime(?)`,
+		list: `SELECT r.id, COALESCE(s.name, ''), r.finished_at FROM eval_runs r
+			LEFT JOIN eval_suites s ON s.id = r.suite_id
+			WHERE r.finished_at IS NOT NULL AND datetime(r.finished_at) < datetime(?)
+			ORDER BY datetime(r.finished_at) LIMIT ?`,
+		apply: `DELETE FROM eval_runs
+			WHERE finished_at IS NOT NULL AND datetime(finished_at) < datetime(?)`,
+		cutoff: func(t time.Time) string { return t.Format(time.RFC3339) },
+	},
+}
+
+// RunRetention applies the policies, or with dryRun only reports what they
+// would affect
+func RunRetention(ctx context.Context, db *sql.DB, policies *RetentionPolicies, dryRun bool) (*RetentionReport, error) {
+	now := time.Now().UTC()
+	report := &RetentionReport{DryRun: dryRun, RanAt: now, Policies: []RetentionResult{}}
+
+	for _, policy := range retentionPolicies {
+		result := RetentionResult{Policy: policy.name, Items: []RetentionItem{}}
+		days := policy.days(policies)
+		if days <= 0 {
+			report.Policies = append(report.Policies, result)
+			continue
+		}
+		result.Enabled = true
+		cutoff := policy.cutoff(now.AddDate(0, 0, -days))
+		result.Cutoff = cutoff
+
+		if dryRun {
+			if err := db.QueryRowContext(ctx, policy.count, cutoff).Scan(&result.Count); err != nil {
+				return nil, fmt.Errorf("failed to preview %s: %w", policy.name, err)
+			}
+		}
+
+		// Items are listed before applying so a run reports what it removed
+		items, err := listRetentionItems(ctx, db, policy.list, cutoff)
+		if err != nil {
+			return nil, fmt.Errorf("failed to preview %s: %w", policy.name, err)
+		}
+		result.Items = items
+
+		if !dryRun {
+			res, err := db.ExecContext(ctx, policy.apply, cutoff)
+			if err != nil {
+				return nil, fmt.Errorf("failed to apply %s: %w", policy.name, err)
+			}
+			result.Count, _ = res.RowsAffected()
+		}
+		report.Policies = append(report.Policies, result)
+	}
+	return report, nil
+}
+
+// listRetentionItems returns up to retentionPreviewLimit affected records
+func listRetentionItems(ctx context.Context, db *sql.DB, query, cutoff string) ([]RetentionItem, error) {
+	rows, err := db.QueryContext(ctx, query, cutoff, retentionPreviewLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []RetentionItem{}
+	for rows.Next() {
+		var item RetentionItem
+		if err := rows.Scan(&item.ID, &item.Label, &item.Date); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
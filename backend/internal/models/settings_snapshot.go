@@ -0,0 +1,138 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// SettingsSnapshot is an immutable record of the effective configuration a
+// result was produced with, addressed by the hash of its normalized JSON
+type SettingsSnapshot struct {
+	Hash      string          `json:"hash"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// SettingsChange describes one value that differs between two snapshots
+type SettingsChange struct {
+	Path string `json:"path"`
+	Old  any    `json:"old"`
+	New  any    `json:"new"`
+}
+
+// normalizeSettings round-trips a value through JSON so that map keys are
+// sorted and numbers are represented consistently
+func normalizeSettings(settings any) ([]byte, error) {
+	raw, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	var generic any
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return nil, err
+	}
+	return json.Marshal(generic)
+}
+
+// SaveSettingsSnapshot stores a settings snapshot and returns it. Identical
+// settings always produce the same hash, so repeated saves are no-ops.
+func SaveSettingsSnapshot(db *sql.DB, settings any) (*SettingsSnapshot, error) {
+	data, err := normalizeSettings(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to normalize settings: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	snapshot := &SettingsSnapshot{
+		Hash:      hex.EncodeToString(sum[:]),
+		Data:      data,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	_, err = db.Exec(`
+		INSERT OR IGNORE INTO settings_snapshots (hash, data, created_at)
+		VALUES (?, ?, ?)`,
+		snapshot.Hash, string(data), snapshot.CreatedAt.Format(time.RFC3339),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save settings snapshot: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// GetSettingsSnapshot retrieves a snapshot by hash, returning nil if not found
+func GetSettingsSnapshot(db *sql.DB, hash string) (*SettingsSnapshot, error) {
+	snapshot := &SettingsSnapshot{}
+	var data, createdAt string
+
+	err := db.QueryRow(`SELECT hash, data, created_at FROM settings_snapshots WHERE hash = ?`, hash).
+		Scan(&snapshot.Hash, &data, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get settings snapshot: %w", err)
+	}
+
+	snapshot.Data = json.RawMessage(data)
+	snapshot.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	return snapshot, nil
+}
+
+// DiffSettingsSnapshots lists the values that differ between two snapshots,
+// keyed by dotted path (e.g. "options.temperature")
+func DiffSettingsSnapshots(a, b *SettingsSnapshot) ([]SettingsChange, error) {
+	var oldData, newData map[string]any
+	if err := json.Unmarshal(a.Data, &oldData); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot %s: %w", a.Hash, err)
+	}
+	if err := json.Unmarshal(b.Data, &newData); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot %s: %w", b.Hash, err)
+	}
+
+	oldFlat := make(map[string]any)
+	newFlat := make(map[string]any)
+	flattenSettings("", oldData, oldFlat)
+	flattenSettings("", newData, newFlat)
+
+	paths := make(map[string]bool)
+	for p := range oldFlat {
+		paths[p] = true
+	}
+	for p := range newFlat {
+		paths[p] = true
+	}
+
+	changes := []SettingsChange{}
+	for p := range paths {
+		if !reflect.DeepEqual(oldFlat[p], newFlat[p]) {
+			changes = append(changes, SettingsChange{Path: p, Old: oldFlat[p], New: newFlat[p]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+
+	return changes, nil
+}
+
+// flattenSettings walks nested objects, writing leaf values by dotted path.
+// Arrays are treated as leaves so reordered args show up as a single change.
+func flattenSettings(prefix string, value map[string]any, out map[string]any) {
+	for k, v := range value {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		if nested, ok := v.(map[string]any); ok {
+			flattenSettings(path, nested, out)
+			continue
+		}
+		out[path] = v
+	}
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Token usage scopes
+const (
+	UsageScopeChat = "chat"
+	UsageScopeKey  = "key"
+)
+
+// tokenBudgetsKey is the app_settings key holding TokenBudgets
+const tokenBudgetsKey = "token_budgets"
+
+// TokenBudgets limits daily token usage (input + output). A zero limit
+// means unlimited.
+type TokenBudgets struct {
+	ChatDaily int64 `json:"chat_daily"`
+	KeyDaily  int64 `json:"key_daily"`
+	// ExemptKeys lists API key identities ("admin", "api", "localhost",
+	// "anonymous") that are never limited
+	ExemptKeys []string `json:"exempt_keys"`
+	// ExemptChats lists chat IDs that are never limited
+	ExemptChats []string `json:"exempt_chats"`
+}
+
+// TokenUsage is one subject's usage for a day
+type TokenUsage struct {
+	Scope        string `json:"scope"`
+	Subject      string `json:"subject"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+	Total        int64  `json:"total"`
+}
+
+// UsageDay returns the UTC day budgets are counted against
+func UsageDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// GetTokenBudgets returns the configured budgets (unlimited if unset)
+func GetTokenBudgets(db *sql.DB) (*TokenBudgets, error) {
+	budgets := &TokenBudgets{ExemptKeys: []string{}, ExemptChats: []string{}}
+
+	var value string
+	err := db.QueryRow(`SELECT value FROM app_settings WHERE key = ?`, tokenBudgetsKey).Scan(&value)
+	if err == sql.ErrNoRows {
+		return budgets, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token budgets: %w", err)
+	}
+	if err := json.Unmarshal([]byte(value), budgets); err != nil {
+		return nil, fmt.Errorf("failed to parse token budgets: %w", err)
+	}
+	return budgets, nil
+}
+
+// SaveTokenBudgets replaces the configured budgets
+func SaveTokenBudgets(db *sql.DB, budgets *TokenBudgets) error {
+	value, err := json.Marshal(budgets)
+	if err != nil {
+		return fmt.Errorf("failed to encode token budgets: %w", err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO app_settings (key, value, updated_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		tokenBudgetsKey, string(value), time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to save token budgets: %w", err)
+	}
+	return nil
+}
+
+// RecordTokenUsage adds tokens to a subject's usage for the given day
+func RecordTokenUsage(db *sql.DB, day, scope, subject string, input, output int64) error {
+	_, err := db.Exec(`
+		INSERT INTO token_usage (day, scope, subject, input_tokens, output_tokens)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(day, scope, subject) DO UPDATE SET
+			input_tokens = input_tokens + excluded.input_tokens,
+			output_tokens = output_tokens + excluded.output_tokens`,
+		day, scope, subject, input, output)
+	if err != nil {
+		return fmt.Errorf("failed to record token usage: %w", err)
+	}
+	return nil
+}
+
+// GetTokenUsageTotal returns a subject's combined usage for the given day
+func GetTokenUsageTotal(db *sql.DB, day, scope, subject string) (int64, error) {
+	var total int64
+	err := db.QueryRow(`
+		SELECT COALESCE(SUM(input_tokens + output_tokens), 0)
+		FROM token_usage WHERE day = ? AND scope = ? AND subject = ?`,
+		day, scope, subject).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get token usage: %w", err)
+	}
+	return total, nil
+}
+
+// ListTokenUsage returns every subject's usage for the given day, heaviest first
+func ListTokenUsage(db *sql.DB, day string) ([]TokenUsage, error) {
+	rows, err := db.Query(`
+		SELECT scope, subject, input_tokens, output_tokens
+		FROM token_usage WHERE day = ?
+		ORDER BY input_tokens + output_tokens DESC`, day)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list token usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := []TokenUsage{}
+	for rows.Next() {
+		var u TokenUsage
+		if err := rows.Scan(&u.Scope, &u.Subject, &u.InputTokens, &u.OutputTokens); err != nil {
+			return nil, fmt.Errorf("failed to scan token usage: %w", err)
+		}
+		u.Total = u.InputTokens + u.OutputTokens
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
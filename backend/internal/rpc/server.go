@@ -0,0 +1,413 @@
+// Package rpc serves the Vessel gRPC interface. Each call is translated into
+// the matching REST request and dispatched to the HTTP handler in process, so
+// both interfaces share one pipeline (auth, maintenance mode, chat settings,
+// budgets, policy hooks) and can't drift apart.
+package rpc
+
+//go:generate protoc -I vesselpb --go_out=vesselpb --go_opt=paths=source_relative --go-grpc_out=vesselpb --go-grpc_opt=paths=source_relative vessel.proto
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"vessel-backend/internal/api"
+	"vessel-backend/internal/rpc/vesselpb"
+)
+
+// forwardedHeaders are the gRPC metadata keys passed on as HTTP headers
+var forwardedHeaders = []string{"authorization", "x-api-key", "accept-language", strings.ToLower(api.TimezoneHeader)}
+
+// Server implements the Vessel gRPC service on top of the REST handler
+type Server struct {
+	vesselpb.UnimplementedVesselServer
+	handler http.Handler
+}
+
+// NewServer creates a gRPC server whose calls are handled by handler, the
+// REST API's router
+func NewServer(handler http.Handler) *grpc.Server {
+	srv := grpc.NewServer()
+	vesselpb.RegisterVesselServer(srv, &Server{handler: handler})
+	return srv
+}
+
+// Chat streams a chat completion
+func (s *Server) Chat(req *vesselpb.ChatRequest, stream grpc.ServerStreamingServer[vesselpb.ChatResponse]) error {
+	body := map[string]any{
+		"model":    req.GetModel(),
+		"messages": toRESTMessages(req.GetMessages()),
+		"stream":   true,
+	}
+	if req.GetOptions() != nil {
+		body["options"] = req.GetOptions().AsMap()
+	}
+	if req.GetKeepAlive() != "" {
+		body["keep_alive"] = req.GetKeepAlive()
+	}
+	if format := strings.TrimSpace(req.GetFormat()); format != "" {
+		if strings.HasPrefix(format, "{") {
+			body["format"] = json.RawMessage(format)
+		} else {
+			body["format"] = format
+		}
+	}
+	if req.Think != nil {
+		body["think"] = req.GetThink()
+	}
+	if req.GetChatId() != "" {
+		body["chat_id"] = req.GetChatId()
+		body["persist"] = req.GetPersist()
+	}
+	if req.GetParentId() != "" {
+		body["parent_id"] = req.GetParentId()
+	}
+	if req.GetNoCache() {
+		body["no_cache"] = true
+	}
+
+	return s.stream(stream.Context(), http.MethodPost, "/api/v1/ollama/api/chat", body, func(header http.Header, line []byte) error {
+		var resp struct {
+			Model   string `json:"model"`
+			Message struct {
+				Role     string `json:"role"`
+				Content  string `json:"content"`
+				Thinking string `json:"thinking"`
+			} `json:"message"`
+			Done            bool   `json:"done"`
+			DoneReason      string `json:"done_reason"`
+			PromptEvalCount int64  `json:"prompt_eval_count"`
+			EvalCount       int64  `json:"eval_count"`
+			TotalDuration   int64  `json:"total_duration"`
+		}
+		if err := json.Unmarshal(line, &resp); err != nil {
+			return status.Errorf(codes.Internal, "invalid chat response: %v", err)
+		}
+		return stream.Send(&vesselpb.ChatResponse{
+			Model: resp.Model,
+			Message: &vesselpb.Message{
+				Role:     resp.Message.Role,
+				Content:  resp.Message.Content,
+				Thinking: resp.Message.Thinking,
+			},
+			Done:            resp.Done,
+			DoneReason:      resp.DoneReason,
+			PromptEvalCount: resp.PromptEvalCount,
+			EvalCount:       resp.EvalCount,
+			TotalDurationNs: resp.TotalDuration,
+			GenerationId:    header.Get(api.GenerationIDHeader),
+		})
+	})
+}
+
+// Embed returns one embedding per input
+func (s *Server) Embed(ctx context.Context, req *vesselpb.EmbedRequest) (*vesselpb.EmbedResponse, error) {
+	body := map[string]any{
+		"model": req.GetModel(),
+		"input": req.GetInput(),
+	}
+	if req.GetTruncate() {
+		body["truncate"] = true
+	}
+	if req.GetKeepAlive() != "" {
+		body["keep_alive"] = req.GetKeepAlive()
+	}
+
+	var resp struct {
+		Model           string      `json:"model"`
+		Embeddings      [][]float32 `json:"embeddings"`
+		PromptEvalCount int64       `json:"prompt_eval_count"`
+	}
+	if err := s.call(ctx, http.MethodPost, "/api/v1/ollama/api/embed", body, &resp); err != nil {
+		return nil, err
+	}
+
+	out := &vesselpb.EmbedResponse{Model: resp.Model, PromptEvalCount: resp.PromptEvalCount}
+	for _, values := range resp.Embeddings {
+		out.Embeddings = append(out.Embeddings, &vesselpb.Embedding{Values: values})
+	}
+	return out, nil
+}
+
+// ListModels returns the installed models
+func (s *Server) ListModels(ctx context.Context, req *vesselpb.ListModelsRequest) (*vesselpb.ListModelsResponse, error) {
+	path := "/api/v1/ollama/api/tags"
+	if req.GetIncludeHidden() {
+		path += "?include_hidden=true"
+	}
+
+	var resp struct {
+		Models []struct {
+			Name       string `json:"name"`
+			Size       int64  `json:"size"`
+			Digest     string `json:"digest"`
+			ModifiedAt string `json:"modified_at"`
+			Details    struct {
+				Family            string `json:"family"`
+				ParameterSize     string `json:"parameter_size"`
+				QuantizationLevel string `json:"quantization_level"`
+			} `json:"details"`
+		} `json:"models"`
+	}
+	if err := s.call(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	out := &vesselpb.ListModelsResponse{}
+	for _, m := range resp.Models {
+		out.Models = append(out.Models, &vesselpb.Model{
+			Name:              m.Name,
+			Size:              m.Size,
+			Digest:            m.Digest,
+			ModifiedAt:        m.ModifiedAt,
+			Family:            m.Details.Family,
+			ParameterSize:     m.Details.ParameterSize,
+			QuantizationLevel: m.Details.QuantizationLevel,
+		})
+	}
+	return out, nil
+}
+
+// PullModel downloads a model and streams its progress
+func (s *Server) PullModel(req *vesselpb.PullModelRequest, stream grpc.ServerStreamingServer[vesselpb.PullProgress]) error {
+	body := map[string]any{"model": req.GetModel(), "insecure": req.GetInsecure()}
+	return s.stream(stream.Context(), http.MethodPost, "/api/v1/ollama/api/pull", body, func(_ http.Header, line []byte) error {
+		var resp struct {
+			Status    string `json:"status"`
+			Digest    string `json:"digest"`
+			Total     int64  `json:"total"`
+			Completed int64  `json:"completed"`
+		}
+		if err := json.Unmarshal(line, &resp); err != nil {
+			return status.Errorf(codes.Internal, "invalid pull progress: %v", err)
+		}
+		return stream.Send(&vesselpb.PullProgress{
+			Status:    resp.Status,
+			Digest:    resp.Digest,
+			Total:     resp.Total,
+			Completed: resp.Completed,
+		})
+	})
+}
+
+// DeleteModel removes an installed model
+func (s *Server) DeleteModel(ctx context.Context, req *vesselpb.DeleteModelRequest) (*vesselpb.DeleteModelResponse, error) {
+	body := map[string]any{"model": req.GetModel()}
+	if err := s.call(ctx, http.MethodDelete, "/api/v1/ollama/api/delete", body, nil); err != nil {
+		return nil, err
+	}
+	return &vesselpb.DeleteModelResponse{}, nil
+}
+
+// toRESTMessages converts chat messages to their JSON form
+func toRESTMessages(messages []*vesselpb.Message) []map[string]any {
+	out := make([]map[string]any, 0, len(messages))
+	for _, m := range messages {
+		msg := map[string]any{"role": m.GetRole(), "content": m.GetContent()}
+		if m.GetThinking() != "" {
+			msg["thinking"] = m.GetThinking()
+		}
+		if len(m.GetImages()) > 0 {
+			msg["images"] = m.GetImages()
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
+// call dispatches a REST request and decodes its JSON response into out
+// (when not nil), turning error responses into gRPC errors
+func (s *Server) call(ctx context.Context, method, path string, body, out any) error {
+	w := &responseBuffer{header: make(http.Header), status: http.StatusOK}
+	if err := s.serve(ctx, method, path, body, w); err != nil {
+		return err
+	}
+	if w.status >= http.StatusBadRequest {
+		return errorFromResponse(w.status, w.body.Bytes())
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(w.body.Bytes(), out); err != nil {
+		return status.Errorf(codes.Internal, "invalid response: %v", err)
+	}
+	return nil
+}
+
+// stream dispatches a REST request answered with NDJSON and passes each line
+// to send. An error line, or an error response, ends the call with a gRPC
+// error.
+func (s *Server) stream(ctx context.Context, method, path string, body any, send func(http.Header, []byte) error) error {
+	w := &lineWriter{header: make(http.Header), status: http.StatusOK}
+	w.onLine = func(line []byte) error {
+		if w.status >= http.StatusBadRequest {
+			// Error responses are a single JSON object; collect it
+			w.errBody = append(w.errBody, line...)
+			return nil
+		}
+		var event struct {
+			Error string `json:"error"`
+			Code  string `json:"code"`
+		}
+		if json.Unmarshal(line, &event) == nil && event.Error != "" {
+			code := codes.Unavailable
+			if event.Code == api.BandwidthCapErrorCode {
+				code = codes.ResourceExhausted
+			}
+			return status.Error(code, event.Error)
+		}
+		return send(w.header, line)
+	}
+
+	if err := s.serve(ctx, method, path, body, w); err != nil {
+		return err
+	}
+	if err := w.finish(); err != nil {
+		return err
+	}
+	if w.status >= http.StatusBadRequest {
+		return errorFromResponse(w.status, w.errBody)
+	}
+	return nil
+}
+
+// serve builds the HTTP request for a call, carrying over the caller's
+// credentials and address, and runs it through the handler
+func (s *Server) serve(ctx context.Context, method, path string, body any, w http.ResponseWriter) error {
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, method, path, reader)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to build request: %v", err)
+	}
+	r.Header.Set("Content-Type", "application/json")
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, key := range forwardedHeaders {
+			if values := md.Get(key); len(values) > 0 {
+				r.Header.Set(key, values[0])
+			}
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		r.RemoteAddr = p.Addr.String()
+	}
+
+	s.handler.ServeHTTP(w, r)
+	return ctx.Err()
+}
+
+// errorFromResponse converts a REST error response into a gRPC error
+func errorFromResponse(code int, body []byte) error {
+	var resp struct {
+		Error string `json:"error"`
+	}
+	msg := http.StatusText(code)
+	if json.Unmarshal(body, &resp) == nil && resp.Error != "" {
+		msg = resp.Error
+	}
+	return status.Error(grpcCode(code), msg)
+}
+
+// grpcCode maps an HTTP status to the closest gRPC code
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
+
+// responseBuffer is an http.ResponseWriter that keeps the whole response
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *responseBuffer) Header() http.Header         { return w.header }
+func (w *responseBuffer) WriteHeader(status int)      { w.status = status }
+func (w *responseBuffer) Write(p []byte) (int, error) { return w.body.Write(p) }
+
+// lineWriter is an http.ResponseWriter that hands each complete line of the
+// response to onLine as it is written. Streaming handlers need it to be an
+// http.Flusher; flushing is a no-op since lines are passed on at once.
+type lineWriter struct {
+	header  http.Header
+	status  int
+	onLine  func([]byte) error
+	partial []byte
+	errBody []byte
+	err     error
+}
+
+func (w *lineWriter) Header() http.Header    { return w.header }
+func (w *lineWriter) WriteHeader(status int) { w.status = status }
+func (w *lineWriter) Flush()                 {}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := bytes.TrimSpace(w.partial[:i])
+		w.partial = w.partial[i+1:]
+		if len(line) == 0 {
+			continue
+		}
+		if err := w.onLine(line); err != nil {
+			// Stop the handler; it sees a broken connection
+			w.err = err
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// finish passes on a last line without a trailing newline and returns the
+// first error a line produced
+func (w *lineWriter) finish() error {
+	if w.err == nil {
+		if line := bytes.TrimSpace(w.partial); len(line) > 0 {
+			w.partial = nil
+			w.err = w.onLine(line)
+		}
+	}
+	if w.err != nil {
+		return w.err
+	}
+	return nil
+}
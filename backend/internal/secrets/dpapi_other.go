@@ -0,0 +1,8 @@
+//go:build !windows
+
+package secrets
+
+// newDPAPIStore returns nil; the Data Protection API only exists on Windows
+func newDPAPIStore(dir string) Store {
+	return nil
+}
@@ -0,0 +1,101 @@
+//go:build windows
+
+package secrets
+
+import (
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// dpapiStore keeps secrets in a JSON file, each value protected with the
+// Windows Data Protection API so only the same user account on the same
+// machine can read it back
+type dpapiStore struct {
+	file *fileStore
+}
+
+func newDPAPIStore(dir string) Store {
+	return &dpapiStore{file: &fileStore{path: filepath.Join(dir, "secrets.dpapi.json")}}
+}
+
+func (d *dpapiStore) Backend() string {
+	return "dpapi"
+}
+
+func (d *dpapiStore) Get(name string) (string, error) {
+	d.file.mu.Lock()
+	defer d.file.mu.Unlock()
+
+	entries, err := d.file.load()
+	if err != nil {
+		return "", err
+	}
+	encoded, ok := entries[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	protected, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid secret encoding: %w", err)
+	}
+	plain, err := dpapiUnprotect(protected)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return string(plain), nil
+}
+
+func (d *dpapiStore) Set(name, value string) error {
+	d.file.mu.Lock()
+	defer d.file.mu.Unlock()
+
+	entries, err := d.file.load()
+	if err != nil {
+		return err
+	}
+	protected, err := dpapiProtect([]byte(value))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+	entries[name] = base64.StdEncoding.EncodeToString(protected)
+	return d.file.save(entries)
+}
+
+func (d *dpapiStore) Delete(name string) error {
+	return d.file.Delete(name)
+}
+
+// dpapiProtect encrypts data for the current user
+func dpapiProtect(data []byte) ([]byte, error) {
+	var out windows.DataBlob
+	if err := windows.CryptProtectData(dpapiBlob(data), nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, err
+	}
+	return dpapiTake(&out), nil
+}
+
+// dpapiUnprotect reverses dpapiProtect
+func dpapiUnprotect(data []byte) ([]byte, error) {
+	var out windows.DataBlob
+	if err := windows.CryptUnprotectData(dpapiBlob(data), nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, err
+	}
+	return dpapiTake(&out), nil
+}
+
+func dpapiBlob(data []byte) *windows.DataBlob {
+	if len(data) == 0 {
+		return &windows.DataBlob{}
+	}
+	return &windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+}
+
+// dpapiTake copies a blob allocated by DPAPI and frees it
+func dpapiTake(blob *windows.DataBlob) []byte {
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(blob.Data)))
+	return append([]byte(nil), unsafe.Slice(blob.Data, blob.Size)...)
+}
@@ -0,0 +1,142 @@
+package secrets
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"vessel-backend/internal/encryption"
+)
+
+// fileStore keeps secrets AES-GCM encrypted in a JSON file. The key lives in
+// a separate owner-only file, which keeps secrets out of plaintext config and
+// backups of the secrets file alone, but not away from someone with full
+// access to the data directory.
+type fileStore struct {
+	mu      sync.Mutex
+	path    string
+	keyPath string
+}
+
+func newFileStore(dir string) *fileStore {
+	return &fileStore{
+		path:    filepath.Join(dir, "secrets.json"),
+		keyPath: filepath.Join(dir, "secrets.key"),
+	}
+}
+
+func (f *fileStore) Backend() string {
+	return "file"
+}
+
+// cipher loads the file key, creating it on first use
+func (f *fileStore) cipher() (*encryption.Cipher, error) {
+	key, err := os.ReadFile(f.keyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate secrets key: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(f.keyPath), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create secrets directory: %w", err)
+		}
+		if err := os.WriteFile(f.keyPath, key, 0600); err != nil {
+			return nil, fmt.Errorf("failed to write secrets key: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read secrets key: %w", err)
+	}
+	return encryption.NewCipher("file", key)
+}
+
+// load reads the encrypted name -> value map
+func (f *fileStore) load() (map[string]string, error) {
+	entries := make(map[string]string)
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets file: %w", err)
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets file: %w", err)
+	}
+	return entries, nil
+}
+
+// save writes the map atomically with owner-only permissions
+func (f *fileStore) save(entries map[string]string) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write secrets file: %w", err)
+	}
+	if err := os.Rename(tmp, f.path); err != nil {
+		return fmt.Errorf("failed to write secrets file: %w", err)
+	}
+	return nil
+}
+
+func (f *fileStore) Get(name string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entries, err := f.load()
+	if err != nil {
+		return "", err
+	}
+	encrypted, ok := entries[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	c, err := f.cipher()
+	if err != nil {
+		return "", err
+	}
+	return c.DecryptString(encrypted)
+}
+
+func (f *fileStore) Set(name, value string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, err := f.cipher()
+	if err != nil {
+		return err
+	}
+	entries, err := f.load()
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := c.EncryptString(value)
+	if err != nil {
+		return err
+	}
+	entries[name] = encrypted
+	return f.save(entries)
+}
+
+func (f *fileStore) Delete(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entries, err := f.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := entries[name]; !ok {
+		return nil
+	}
+	delete(entries, name)
+	return f.save(entries)
+}
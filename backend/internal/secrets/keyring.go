@@ -0,0 +1,150 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// keyringService is the service name secrets are filed under in the keyring
+const keyringService = "vessel"
+
+// securityMaxLine is the longest command line security's interactive mode reads
+const securityMaxLine = 4096
+
+// keyringStore keeps secrets in the OS keyring by shelling out to the
+// platform's keyring tool: secret-tool (Secret Service) on Linux and
+// security (Keychain) on macOS
+type keyringStore struct {
+	tool string
+}
+
+// newKeyringStore returns a keyring store if a usable keyring is available
+func newKeyringStore() *keyringStore {
+	var tool string
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd":
+		tool = "secret-tool"
+	case "darwin":
+		tool = "security"
+	default:
+		return nil
+	}
+
+	path, err := exec.LookPath(tool)
+	if err != nil {
+		return nil
+	}
+	ks := &keyringStore{tool: path}
+
+	// secret-tool is often installed on headless machines without a running
+	// Secret Service; a lookup of a missing item succeeds silently only when
+	// the service is reachable
+	if tool == "secret-tool" {
+		var stderr bytes.Buffer
+		cmd := exec.Command(path, "lookup", "service", keyringService, "account", "__probe__")
+		cmd.Stderr = &stderr
+		cmd.Run()
+		if stderr.Len() > 0 {
+			return nil
+		}
+	}
+
+	return ks
+}
+
+func (k *keyringStore) Backend() string {
+	return "keyring"
+}
+
+func (k *keyringStore) isSecretTool() bool {
+	return strings.HasSuffix(k.tool, "secret-tool")
+}
+
+func (k *keyringStore) Get(name string) (string, error) {
+	var cmd *exec.Cmd
+	if k.isSecretTool() {
+		cmd = exec.Command(k.tool, "lookup", "service", keyringService, "account", name)
+	} else {
+		cmd = exec.Command(k.tool, "find-generic-password", "-s", keyringService, "-a", name, "-w")
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if k.isNotFound(err, stderr.String()) {
+			return "", ErrNotFound
+		}
+		// A locked keyring or an unreachable daemon must not look like an
+		// unset secret, or the server would start without it
+		return "", fmt.Errorf("failed to read secret from keyring: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	value := strings.TrimRight(string(out), "\n")
+	if value == "" {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// isNotFound reports whether a failed lookup only means the item is missing.
+// secret-tool exits 1 without output for a missing item and prints an error
+// for anything else; security exits 44 for a missing item.
+func (k *keyringStore) isNotFound(err error, stderr string) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	if k.isSecretTool() {
+		return exitErr.ExitCode() == 1 && strings.TrimSpace(stderr) == ""
+	}
+	return exitErr.ExitCode() == 44
+}
+
+func (k *keyringStore) Set(name, value string) error {
+	var cmd *exec.Cmd
+	if k.isSecretTool() {
+		// secret-tool reads the secret from stdin, keeping it out of argv
+		cmd = exec.Command(k.tool, "store", "--label=Vessel "+name, "service", keyringService, "account", name)
+		cmd.Stdin = strings.NewReader(value)
+	} else {
+		// security takes the password only as an argument, so the command is
+		// fed to its interactive mode on stdin rather than put in argv, with
+		// the password hex encoded to avoid quoting it
+		line := fmt.Sprintf("add-generic-password -U -s %s -a %s -X %s\n",
+			securityQuote(keyringService), securityQuote(name), hex.EncodeToString([]byte(value)))
+		if len(line) > securityMaxLine {
+			return fmt.Errorf("secret is too long to store in the keychain")
+		}
+		cmd = exec.Command(k.tool, "-i")
+		cmd.Stdin = strings.NewReader(line)
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to store secret in keyring: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// securityQuote quotes an argument for security's interactive mode
+func securityQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func (k *keyringStore) Delete(name string) error {
+	var cmd *exec.Cmd
+	if k.isSecretTool() {
+		cmd = exec.Command(k.tool, "clear", "service", keyringService, "account", name)
+	} else {
+		cmd = exec.Command(k.tool, "delete-generic-password", "-s", keyringService, "-a", name)
+	}
+
+	// Both tools fail when the item doesn't exist, which is fine for a delete
+	cmd.Run()
+	return nil
+}
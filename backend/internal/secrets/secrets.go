@@ -0,0 +1,111 @@
+// Package secrets stores credentials such as passphrases and API tokens
+// outside of plaintext config, preferring the OS keyring and falling back
+// to an encrypted file.
+package secrets
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound is returned when a secret has not been stored
+var ErrNotFound = errors.New("secret not found")
+
+// Store persists named secrets
+type Store interface {
+	Get(name string) (string, error)
+	Set(name, value string) error
+	Delete(name string) error
+	// Backend names the storage in use ("keyring", "dpapi" or "file")
+	Backend() string
+}
+
+// Secret describes a secret the server knows how to use
+type Secret struct {
+	Name        string
+	EnvVar      string
+	Description string
+}
+
+// Known lists the secrets that can be managed through the store. Environment
+// variables still take precedence so existing deployments keep working.
+var Known = []Secret{
+	{Name: "encryption_passphrase", EnvVar: "VESSEL_ENCRYPTION_PASSPHRASE", Description: "Passphrase for message encryption at rest"},
+	{Name: "api_token", EnvVar: "VESSEL_API_TOKEN", Description: "Token required for API access"},
+	{Name: "admin_token", EnvVar: "VESSEL_ADMIN_TOKEN", Description: "Token required for administrative routes"},
+}
+
+// Lookup returns the known secret with the given name
+func Lookup(name string) (Secret, bool) {
+	for _, s := range Known {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Secret{}, false
+}
+
+// Source describes where a resolved secret came from
+type Source string
+
+const (
+	SourceNone  Source = ""
+	SourceEnv   Source = "env"
+	SourceStore Source = "store"
+)
+
+var (
+	defaultStore Store
+	defaultOnce  sync.Once
+)
+
+// Open returns the process-wide secret store, using the OS keyring when a
+// supported keyring tool is installed, DPAPI-protected values on Windows and
+// an encrypted file in dataDir otherwise
+func Open(dataDir string) Store {
+	defaultOnce.Do(func() {
+		if ks := newKeyringStore(); ks != nil {
+			defaultStore = ks
+			return
+		}
+		if ds := newDPAPIStore(dataDir); ds != nil {
+			defaultStore = ds
+			return
+		}
+		defaultStore = newFileStore(dataDir)
+	})
+	return defaultStore
+}
+
+// Resolve returns a secret's value, preferring its environment variable
+// over the store
+func Resolve(store Store, name string) (string, Source, error) {
+	if s, ok := Lookup(name); ok && s.EnvVar != "" {
+		if value := os.Getenv(s.EnvVar); value != "" {
+			return value, SourceEnv, nil
+		}
+	}
+
+	value, err := store.Get(name)
+	if errors.Is(err, ErrNotFound) {
+		return "", SourceNone, nil
+	}
+	if err != nil {
+		return "", SourceNone, err
+	}
+	return value, SourceStore, nil
+}
+
+// Mask hides a secret for display, keeping only the last few characters of
+// long values so users can tell tokens apart
+func Mask(value string) string {
+	if value == "" {
+		return ""
+	}
+	if len(value) < 12 {
+		return strings.Repeat("*", 8)
+	}
+	return strings.Repeat("*", 8) + value[len(value)-4:]
+}
@@ -9,16 +9,37 @@ import type { Handle } from '@sveltejs/kit';
 const OLLAMA_URL = process.env.OLLAMA_API_URL || 'http://localhost:11434';
 const BACKEND_URL = process.env.BACKEND_URL || 'http://localhost:9090';
 
+// Token added to proxied backend requests that don't carry their own. The
+// browser never sends one, so without it an authenticated backend rejects the
+// UI. Anyone who can reach this server then acts with this token: only set it
+// when the frontend itself is not exposed to untrusted clients.
+const BACKEND_TOKEN = process.env.BACKEND_API_TOKEN || '';
+
 /**
  * Proxy a request to a target URL
  */
-async function proxyRequest(request: Request, targetBase: string, path: string): Promise<Response> {
+async function proxyRequest(
+	request: Request,
+	targetBase: string,
+	path: string,
+	clientAddress: string,
+	token = ''
+): Promise<Response> {
 	const targetUrl = `${targetBase}${path}`;
 
 	const headers = new Headers(request.headers);
 	// Remove host header to avoid issues
 	headers.delete('host');
 
+	// Name the original client, so the backend doesn't mistake proxied
+	// requests for local ones and skip authentication
+	const forwardedFor = headers.get('x-forwarded-for');
+	headers.set('x-forwarded-for', forwardedFor ? `${forwardedFor}, ${clientAddress}` : clientAddress);
+
+	if (token && !headers.has('authorization') && !headers.has('x-api-key')) {
+		headers.set('authorization', `Bearer ${token}`);
+	}
+
 	try {
 		const response = await fetch(targetUrl, {
 			method: request.method,
@@ -64,7 +85,7 @@ export const handle: Handle = async ({ event, resolve }) => {
 
 	// Proxy /health to backend
 	if (pathname === '/health') {
-		return proxyRequest(event.request, BACKEND_URL, '/health');
+		return proxyRequest(event.request, BACKEND_URL, '/health', event.getClientAddress(), BACKEND_TOKEN);
 	}
 
 	// Include query string for all API proxying
@@ -72,12 +93,12 @@ export const handle: Handle = async ({ event, resolve }) => {
 
 	// Proxy /api/v1/* to backend (must come before /api/* check)
 	if (pathname.startsWith('/api/v1/')) {
-		return proxyRequest(event.request, BACKEND_URL, fullPath);
+		return proxyRequest(event.request, BACKEND_URL, fullPath, event.getClientAddress(), BACKEND_TOKEN);
 	}
 
 	// Proxy /api/* to Ollama
 	if (pathname.startsWith('/api/')) {
-		return proxyRequest(event.request, OLLAMA_URL, fullPath);
+		return proxyRequest(event.request, OLLAMA_URL, fullPath, event.getClientAddress());
 	}
 
 	// All other requests go to SvelteKit